@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/omept/trading-engine/pkg/store"
+)
+
+// actorFromRequest identifies who issued a control request.
+// The authenticated key name wins, then X-Actor, then the client address.
+func actorFromRequest(r *http.Request) string {
+	if id, ok := identityFrom(r.Context()); ok {
+		return id.Name
+	}
+	if a := r.Header.Get("X-Actor"); a != "" {
+		return a
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// recordAudit stores a control-plane action. Failures are logged, never returned,
+// so auditing can't block the action itself.
+func recordAudit(db store.Store, r *http.Request, action string, payload interface{}) {
+	recordAuditAs(db, actorFromRequest(r), action, payload)
+}
+
+// recordAuditAs stores an action taken by actor, for callers outside HTTP
+func recordAuditAs(db store.Store, actor, action string, payload interface{}) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("audit: marshal payload for %s: %v", action, err)
+		return
+	}
+	if err := db.SaveAudit(actor, action, string(b)); err != nil {
+		log.Printf("audit: save %s: %v", action, err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// role gates access to API endpoints. Higher roles include the lower ones.
+type role int
+
+const (
+	roleViewer role = iota + 1
+	roleOperator
+	roleAdmin
+)
+
+// parseRole reads a role name. Tokens may also use the read and trade scopes
+// for viewer and operator.
+func parseRole(s string) (role, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "viewer", "read":
+		return roleViewer, true
+	case "operator", "trade":
+		return roleOperator, true
+	case "admin":
+		return roleAdmin, true
+	}
+	return 0, false
+}
+
+func (r role) String() string {
+	switch r {
+	case roleViewer:
+		return "viewer"
+	case roleOperator:
+		return "operator"
+	case roleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// identity is the authenticated caller of a request
+type identity struct {
+	Name string
+	Role role
+}
+
+type identityKey struct{}
+
+func identityFrom(ctx context.Context) (identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(identity)
+	return id, ok
+}
+
+// authenticator resolves API keys and signed tokens to identities
+type authenticator struct {
+	keys      map[string]identity // sha256(key) -> identity
+	jwtSecret []byte              // verifies HS256 bearer tokens when set
+}
+
+// newAuthenticator parses API_KEYS entries of the form name:key:role separated
+// by commas, and accepts JWTs signed with jwtSecret if it is not empty. With
+// neither configured every request is let through, as before auth existed.
+func newAuthenticator(spec, jwtSecret string) *authenticator {
+	a := &authenticator{keys: make(map[string]identity), jwtSecret: []byte(jwtSecret)}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[1] == "" {
+			log.Fatalf("invalid API_KEYS entry %q, expected name:key:role", entry)
+		}
+		r, ok := parseRole(parts[2])
+		if !ok {
+			log.Fatalf("invalid role %q for API key %s", parts[2], parts[0])
+		}
+		a.keys[hashKey(parts[1])] = identity{Name: parts[0], Role: r}
+	}
+	if !a.enabled() {
+		log.Println("API_KEYS and API_JWT_SECRET not set - control API is unauthenticated")
+	}
+	return a
+}
+
+func hashKey(k string) string {
+	sum := sha256.Sum256([]byte(k))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *authenticator) enabled() bool {
+	return len(a.keys) > 0 || len(a.jwtSecret) > 0
+}
+
+// identify returns the caller presenting key, a JWT or an API key
+func (a *authenticator) identify(key string) (identity, error) {
+	if len(a.jwtSecret) > 0 && looksLikeJWT(key) {
+		id, err := verifyJWT(key, a.jwtSecret, time.Now())
+		if err != nil {
+			return id, fmt.Errorf("invalid token: %w", err)
+		}
+		return id, nil
+	}
+	id, ok := a.keys[hashKey(key)]
+	if !ok {
+		return id, errors.New("missing or invalid API key")
+	}
+	return id, nil
+}
+
+// queryKeyPaths are the WebSocket and EventSource endpoints, whose browser
+// clients cannot set headers
+var queryKeyPaths = map[string]bool{"/api/ws": true, "/api/events": true}
+
+// keyFromRequest reads the key or JWT from X-API-Key or an Authorization
+// bearer token. GET requests of queryKeyPaths may pass it as the api_key
+// query parameter instead, no other request can, so keys stay out of
+// the URLs logged elsewhere.
+func keyFromRequest(r *http.Request) string {
+	if k := r.Header.Get("X-API-Key"); k != "" {
+		return k
+	}
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	if r.Method == http.MethodGet && queryKeyPaths[r.URL.Path] {
+		return r.URL.Query().Get("api_key")
+	}
+	return ""
+}
+
+// require wraps h so it only runs for callers holding at least min
+func (a *authenticator) require(min role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.enabled() {
+			h(w, r)
+			return
+		}
+		id, err := a.identify(keyFromRequest(r))
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if id.Role < min {
+			writeError(w, http.StatusForbidden, "requires "+min.String()+" role")
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	}
+}
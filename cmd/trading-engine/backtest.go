@@ -1,66 +1,138 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/omept/trading-engine/pkg/backtest"
 	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/exchange"
 	"github.com/omept/trading-engine/pkg/store"
 	"github.com/omept/trading-engine/pkg/strategy"
+	"github.com/shopspring/decimal"
 )
 
-func runBacktest(which, symbol string, eng *engine.Engine, db *store.SQLiteStore) []byte {
-	log.Println("Running backtest:", which, symbol)
+// allSymbols as a backtest's symbol runs a portfolio of the strategies on
+// every symbol
+const allSymbols = "all"
 
-	// Load candles directly from SQLite
-	data, err := db.LoadCandles(symbol, 300)
-	if err != nil {
-		log.Fatal("LoadCandlesBetween:", err)
-	}
-	if len(data) == 0 {
-		log.Fatal("no candles found for backtest")
-	}
+// backtestRequest is one backtest of stored candles of Symbol between From
+// and To, a zero From starts at the oldest candle and a zero To ends at the
+// newest. The simulated exchange starts with Balance USD and charges fills
+// per Fills, the trades are resampled per MonteCarlo.
+type backtestRequest struct {
+	ID         string                    `json:"-"`        // the job running it
+	Strategy   string                    `json:"strategy"` // ema | mean | strategy name | all
+	Symbol     string                    `json:"symbol"`   // or all for a portfolio
+	From       time.Time                 `json:"from,omitzero"`
+	To         time.Time                 `json:"to,omitzero"`
+	Balance    float64                   `json:"balance"`
+	Fills      exchange.FillModel        `json:"fills"`
+	MonteCarlo backtest.MonteCarloConfig `json:"monte_carlo"`
+}
 
-	// Select strategy based on env
-	var strats []engine.Strategy
+// runBacktest runs req and stores its result, stopping when ctx ends.
+// progress, when set, follows the candles replayed.
+func runBacktest(ctx context.Context, req backtestRequest, progress func(done, total int), eng *engine.Engine, db store.Store) ([]byte, error) {
+	which, symbol, from, to := req.Strategy, req.Symbol, req.From, req.To
+	log.Println("Running backtest:", which, symbol, from.Format(time.RFC3339), to.Format(time.RFC3339))
 
+	// Select strategies on symbol, or on any symbol for a portfolio, by
+	// type, instance name or all of them
+	if which == "mean" {
+		which = strategy.TypeMeanReversion
+	}
+	portfolio := symbol == allSymbols
+	var strats []engine.Strategy
 	for _, s := range eng.Strategies() {
-		name := s.Name()
-
-		if which == "ema" && name == strategy.ST_NAME_EMA {
-			strats = append(strats, s)
+		if !portfolio && s.Symbol() != symbol {
+			continue
 		}
-		if which == "mean" && name == strategy.ST_NAME_MEAN {
-			strats = append(strats, s)
-		}
-		if which == "all" {
+		if which == "all" || which == s.Name() || which == strategy.TypeOf(s) {
 			strats = append(strats, s)
 		}
 	}
 
 	if len(strats) == 0 {
-		log.Fatal("no strategy selected for backtest")
+		return nil, fmt.Errorf("no %s strategy on %s to backtest", which, symbol)
 	}
 
-	bytes, err := json.Marshal(data)
-	if err != nil {
-		log.Fatal(err)
+	// candles of every symbol traded, interleaved by time in the run
+	end := to
+	if end.IsZero() {
+		end = time.Now()
 	}
-	var candles []engine.Candle
-	if err := json.Unmarshal(bytes, &candles); err != nil {
-		log.Fatal(err)
+	series := map[string][]engine.Candle{}
+	for _, s := range strats {
+		for _, sym := range engine.StrategySymbols(s) {
+			if _, ok := series[sym]; ok {
+				continue
+			}
+			interval := s.Interval()
+			if interval <= 0 {
+				interval = engine.DefaultCandleInterval
+			}
+			data, err := db.LoadCandlesBetween(sym, interval, from, end)
+			if err != nil {
+				return nil, fmt.Errorf("load candles: %w", err)
+			}
+			if len(data) == 0 {
+				return nil, fmt.Errorf("no %s candles found for the backtest", sym)
+			}
+			series[sym] = candlesFromRows(data)
+		}
 	}
 
-	bt := backtest.NewBacktester(candles, eng, db)
-	stats, _ := bt.Run("BTCUSDT")
+	// the backtest runs on clones against its own simulated exchange
+	bt, err := backtest.NewPortfolioBacktester(series, strats, decimal.NewFromFloat(req.Balance))
+	if err != nil {
+		return nil, err
+	}
+	bt.SetRunID(req.ID)
+	bt.SetRange(from, to)
+	bt.SetFillModel(req.Fills)
+	bt.SetMonteCarlo(req.MonteCarlo)
+	if progress != nil {
+		bt.SetProgress(progress)
+	}
+	stats, err := bt.RunPortfolio(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	// convert to JSON
 	jsonBytes, err := json.MarshalIndent(stats, "", "  ")
 	if err != nil {
-		log.Fatal("Failed to marshal stats:", err)
+		return nil, fmt.Errorf("marshal stats: %w", err)
+	}
+
+	// keep the result so it can be browsed later
+	rec := store.BacktestRecord{
+		ID:          stats.RunID,
+		Strategy:    which,
+		Symbol:      stats.Symbol,
+		Started:     stats.Start,
+		Finished:    stats.End,
+		FinalEquity: stats.FinalEquity,
+	}
+	if err := db.SaveBacktest(rec, jsonBytes); err != nil {
+		log.Println("failed to save backtest:", err)
+	}
+	trades := make([]store.BacktestTrade, 0, len(stats.Trades))
+	for _, t := range stats.Trades {
+		trades = append(trades, store.BacktestTrade{
+			Strategy: t.Strategy, Side: string(t.Side), EntryTime: t.EntryTime, ExitTime: t.ExitTime,
+			EntryPrice: t.EntryPrice, ExitPrice: t.ExitPrice, Quantity: t.Quantity, PnL: t.PnL,
+			Holding: t.HoldingPeriod.Seconds(),
+		})
+	}
+	if err := db.SaveBacktestTrades(stats.RunID, trades); err != nil {
+		log.Println("failed to save backtest trades:", err)
 	}
 
 	log.Println("Backtest complete.")
-	return jsonBytes
+	return jsonBytes, nil
 }
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/backtest"
+	"github.com/omept/trading-engine/pkg/config"
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/exchange"
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/omept/trading-engine/pkg/strategy"
+	"github.com/shopspring/decimal"
+)
+
+// command is a subcommand of the binary, run with the arguments after its name
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"run":      {"run the live engine and its control APIs (the default)", runCommand},
+		"backtest": {"backtest configured strategies on stored candles", backtestCommand},
+		"download": {"store an exchange's historical candles for backtests", downloadCommand},
+		"optimize": {"grid search a strategy's params on stored candles", optimizeCommand},
+		"db":       {"manage the store: db migrate [--to version|latest]", dbCommand},
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: trading-engine [command] [flags]")
+	fmt.Fprintln(w)
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "run trading-engine <command> -h for the flags of a command")
+}
+
+// newFlagSet returns the flags of command name with the --config flag every
+// command takes
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON config file, env variables override it")
+	return fs, file
+}
+
+// openConfigured loads the config in file and opens its store
+func openConfigured(file string) (*config.Config, store.Store, error) {
+	cfg, err := config.Load(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := openStore(cfg.Store)
+	if err != nil {
+		return nil, nil, fmt.Errorf("store init: %w", err)
+	}
+	return cfg, db, nil
+}
+
+// interruptible returns a context that ends on an interrupt, so long
+// commands stop cleanly
+func interruptible() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// offlineEngine registers the strategies of cfg on an engine that trades
+// nothing, for commands that only backtest them
+func offlineEngine(cfg *config.Config, db store.Store) (*engine.Engine, strategyFactory, error) {
+	mock := exchange.NewMockExchange(decimal.NewFromFloat(cfg.Backtest.USDBalance), db)
+	eng := engine.NewEngine()
+	risk := engine.NewFixedPercentRisk(cfg.Risk.FixedPercent)
+	newStrategy := newStrategyFactory(risk, engine.NewOrderManager(mock, db), eng)
+	for _, spec := range cfg.Strategies {
+		st, err := newStrategy(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		eng.RegisterStrategy(st)
+	}
+	return eng, newStrategy, nil
+}
+
+// writeOutput writes data to the file path, or stdout when path is empty
+func writeOutput(path string, data []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func runCommand(args []string) error {
+	fs, file := newFlagSet("run")
+	fs.Parse(args)
+
+	// CONFIG_FILE (YAML or JSON) over the defaults, env variables over the file
+	cfg, err := config.Load(*file)
+	if err != nil {
+		return err
+	}
+	serve(*file, cfg)
+	return nil
+}
+
+func backtestCommand(args []string) error {
+	fs, file := newFlagSet("backtest")
+	which := fs.String("strategy", "all", "ema | mean | strategy name | all")
+	symbol := fs.String("symbol", "BTCUSD", "symbol backtested, or all for a portfolio of every strategy")
+	from := fs.String("from", "", "first candle, RFC3339 or 2006-01-02, the oldest stored when empty")
+	to := fs.String("to", "", "last candle, RFC3339 or 2006-01-02, the newest stored when empty")
+	balance := fs.Float64("balance", 0, "starting USD balance, the configured backtest balance when 0")
+	mcRuns := fs.Int("mc-runs", -1, "Monte Carlo runs over the trades, 0 skips them, the configured runs when negative")
+	out := fs.String("out", "", "file the stats JSON is written to, stdout when empty")
+	report := fs.String("report", "", "file an HTML report of the backtest is written to")
+	fs.Parse(args)
+
+	cfg, db, err := openConfigured(*file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	req := backtestRequest{
+		Strategy:   *which,
+		Symbol:     *symbol,
+		Balance:    cfg.Backtest.USDBalance,
+		Fills:      cfg.Backtest.Fills,
+		MonteCarlo: cfg.Backtest.MonteCarlo,
+	}
+	if req.From, err = parseTimeParam(*from, time.Time{}); err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	if req.To, err = parseTimeParam(*to, time.Time{}); err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+	if *balance > 0 {
+		req.Balance = *balance
+	}
+	if *mcRuns >= 0 {
+		req.MonteCarlo.Runs = *mcRuns
+	}
+	if err := req.MonteCarlo.Validate(); err != nil {
+		return err
+	}
+
+	eng, _, err := offlineEngine(cfg, db)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptible()
+	defer cancel()
+	result, err := runBacktest(ctx, req, nil, eng, db)
+	if err != nil {
+		return err
+	}
+
+	if *report != "" {
+		var stats backtest.BacktestStats
+		if err := json.Unmarshal(result, &stats); err != nil {
+			return err
+		}
+		f, err := os.Create(*report)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := backtest.WriteReport(f, &stats); err != nil {
+			return err
+		}
+		log.Println("Wrote backtest report to", *report)
+	}
+	return writeOutput(*out, result)
+}
+
+func downloadCommand(args []string) error {
+	fs, file := newFlagSet("download")
+	name := fs.String("exchange", "", "exchange the candles come from, the configured exchange when empty")
+	symbol := fs.String("symbol", "BTCUSD", "symbol downloaded")
+	interval := fs.Duration("interval", time.Hour, "candle interval, e.g. 1m, 15m, 1h or 24h")
+	from := fs.String("from", "", "first candle, RFC3339 or 2006-01-02")
+	to := fs.String("to", "", "last candle, RFC3339 or 2006-01-02, now when empty")
+	fs.Parse(args)
+
+	start, err := parseTimeParam(*from, time.Time{})
+	if err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	if start.IsZero() {
+		return fmt.Errorf("--from is required")
+	}
+	end, err := parseTimeParam(*to, time.Now())
+	if err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+	if *interval < time.Minute || *interval%time.Second != 0 {
+		return fmt.Errorf("--interval %s must be whole seconds of at least a minute", *interval)
+	}
+
+	cfg, db, err := openConfigured(*file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if *name == "" {
+		*name = cfg.Exchange.Name
+	}
+
+	var exch engine.ExchangeAdapter
+	if *name == "BINANCE" {
+		// klines are public, no API keys needed
+		exch, err = exchange.NewBinanceAdapter(nil, db)
+		if err == nil {
+			exch.(*exchange.BinanceAdapter).SetURLs(cfg.Exchange.Binance.URLs(false))
+		}
+	} else {
+		exch, err = initExhangeAdapter(*name, cfg.Exchange, initSecretProvider(), db)
+	}
+	if err != nil {
+		return err
+	}
+	history, ok := exch.(engine.CandleHistory)
+	if !ok {
+		return fmt.Errorf("%s serves no historical candles", exch.AdapterName())
+	}
+
+	ctx, cancel := interruptible()
+	defer cancel()
+	secs := int64(*interval / time.Second)
+	candles, err := history.HistoricalCandles(ctx, *symbol, secs, start, end)
+	if err != nil {
+		return err
+	}
+	for _, c := range candles {
+		if err := db.SaveCandle(*symbol, secs, c.Time.UTC().Format(time.RFC3339), c.Open, c.High, c.Low, c.Close, c.Volume); err != nil {
+			return fmt.Errorf("save candle: %w", err)
+		}
+	}
+	log.Printf("Stored %d %s candles of %s from %s", len(candles), *interval, *symbol, exch.AdapterName())
+	return nil
+}
+
+func optimizeCommand(args []string) error {
+	fs, file := newFlagSet("optimize")
+	typ := fs.String("type", strategy.TypeEMA, "strategy type optimized")
+	symbol := fs.String("symbol", "BTCUSD", "symbol whose stored candles are replayed")
+	params := fs.String("params", "", `JSON params kept fixed, e.g. {"trend": true}`)
+	grid := fs.String("grid", "", `JSON ranges of the params searched, e.g. {"short": {"min": 5, "max": 15, "step": 1}}`)
+	rank := fs.String("rank", backtest.RankSharpe, "sharpe, final_equity or return_over_drawdown")
+	top := fs.Int("top", 10, "results kept, best first")
+	workers := fs.Int("workers", 0, "backtests run at once, one per CPU when 0")
+	from := fs.String("from", "", "first candle, RFC3339 or 2006-01-02, the oldest stored when empty")
+	to := fs.String("to", "", "last candle, RFC3339 or 2006-01-02, the newest stored when empty")
+	out := fs.String("out", "", "file the report JSON is written to, stdout when empty")
+	fs.Parse(args)
+
+	spec := strategy.Spec{Type: *typ, Symbol: *symbol}
+	if *params != "" {
+		if err := json.Unmarshal([]byte(*params), &spec.Params); err != nil {
+			return fmt.Errorf("--params: %w", err)
+		}
+	}
+	var ranges map[string]backtest.ParamRange
+	if err := json.Unmarshal([]byte(*grid), &ranges); err != nil {
+		return fmt.Errorf("--grid: %w", err)
+	}
+	start, err := parseTimeParam(*from, time.Time{})
+	if err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	end, err := parseTimeParam(*to, time.Time{})
+	if err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+
+	cfg, db, err := openConfigured(*file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	spec.Capital = cfg.Backtest.USDBalance
+
+	last := end
+	if last.IsZero() {
+		last = time.Now()
+	}
+	interval, err := specInterval(spec)
+	if err != nil {
+		return err
+	}
+	rows, err := db.LoadCandlesBetween(*symbol, interval, start, last)
+	if err != nil {
+		return fmt.Errorf("load candles: %w", err)
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no candles found for %s", *symbol)
+	}
+
+	_, newStrategy, err := offlineEngine(cfg, db)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptible()
+	defer cancel()
+	rep, err := backtest.Optimize(ctx, candlesFromRows(rows), backtest.OptimizeConfig{
+		Spec:        spec,
+		Grid:        ranges,
+		Rank:        *rank,
+		Top:         *top,
+		Workers:     *workers,
+		Balance:     decimal.NewFromFloat(cfg.Backtest.USDBalance),
+		Fills:       cfg.Backtest.Fills,
+		From:        start,
+		To:          end,
+		NewStrategy: newStrategy,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Optimized %s %s over %d combinations in %s", spec.Type, spec.Symbol, rep.Combos, rep.Duration.Round(time.Millisecond))
+
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, data)
+}
+
+func dbCommand(args []string) error {
+	if len(args) == 0 || args[0] != "migrate" {
+		return fmt.Errorf("usage: trading-engine db migrate [--to version|latest]")
+	}
+	fs, file := newFlagSet("db migrate")
+	to := fs.String("to", "latest", "schema version moved to, reverting newer migrations, or latest")
+	fs.Parse(args[1:])
+
+	// opening the store applies the latest migrations already
+	_, db, err := openConfigured(*file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return migrateStore(db, strings.TrimSpace(*to))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// apiError is the body of every error response of the HTTP API
+type apiError struct {
+	Code    string `json:"code"` // the status in snake case, e.g. not_found
+	Message string `json:"message"`
+}
+
+// writeError answers with status and an apiError carrying message, the
+// status text when message is empty
+func writeError(w http.ResponseWriter, status int, message string) {
+	text := http.StatusText(status)
+	if message == "" {
+		message = strings.ToLower(text)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(apiError{
+		Code:    strings.ReplaceAll(strings.ToLower(text), " ", "_"),
+		Message: message,
+	})
+}
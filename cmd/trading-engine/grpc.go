@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	pb "github.com/omept/trading-engine/pkg/grpcapi/tradingenginev1"
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/omept/trading-engine/pkg/strategy"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcStreamBuffer is how many events a stream holds for a slow client
+// before dropping them, like the WebSocket and SSE push
+const grpcStreamBuffer = 256
+
+// grpcRoles is the role each method needs, methods not listed need admin
+var grpcRoles = map[string]role{
+	pb.EngineService_GetStatus_FullMethodName:         roleViewer,
+	pb.EngineService_Start_FullMethodName:             roleOperator,
+	pb.EngineService_Stop_FullMethodName:              roleOperator,
+	pb.EngineService_Halt_FullMethodName:              roleOperator,
+	pb.EngineService_Resume_FullMethodName:            roleOperator,
+	pb.EngineService_ListStrategies_FullMethodName:    roleViewer,
+	pb.EngineService_AddStrategy_FullMethodName:       roleAdmin,
+	pb.EngineService_RemoveStrategy_FullMethodName:    roleAdmin,
+	pb.EngineService_PlaceOrder_FullMethodName:        roleOperator,
+	pb.EngineService_CancelOrder_FullMethodName:       roleOperator,
+	pb.EngineService_ListOpenOrders_FullMethodName:    roleViewer,
+	pb.EngineService_ListPositions_FullMethodName:     roleViewer,
+	pb.EngineService_StreamMarketData_FullMethodName:  roleViewer,
+	pb.EngineService_StreamOrderEvents_FullMethodName: roleViewer,
+}
+
+// grpcServer serves the engine over gRPC with the same roles, audit trail
+// and strategy factory as the REST API
+type grpcServer struct {
+	pb.UnimplementedEngineServiceServer
+	eng         *engine.Engine
+	db          store.Store
+	newStrategy strategyFactory
+}
+
+// newGRPCServer builds the gRPC server, over TLS when tlsConfig is set
+func newGRPCServer(eng *engine.Engine, db store.Store, auth *authenticator, newStrategy strategyFactory, tlsConfig *tls.Config) *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(auth.unaryInterceptor),
+		grpc.StreamInterceptor(auth.streamInterceptor),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	srv := grpc.NewServer(opts...)
+	pb.RegisterEngineServiceServer(srv, &grpcServer{eng: eng, db: db, newStrategy: newStrategy})
+	return srv
+}
+
+// serveGRPC listens on addr until srv stops
+func serveGRPC(srv *grpc.Server, addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Println("gRPC server listening on", addr)
+	return srv.Serve(lis)
+}
+
+// authorize resolves the caller of a gRPC call from its x-api-key or
+// authorization metadata and checks it holds the role method needs
+func (a *authenticator) authorize(ctx context.Context, method string) (context.Context, error) {
+	if !a.enabled() {
+		return ctx, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	key := ""
+	if v := md.Get("x-api-key"); len(v) > 0 {
+		key = v[0]
+	} else if v := md.Get("authorization"); len(v) > 0 && strings.HasPrefix(v[0], "Bearer ") {
+		key = strings.TrimPrefix(v[0], "Bearer ")
+	}
+	id, err := a.identify(key)
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+	need, ok := grpcRoles[method]
+	if !ok {
+		need = roleAdmin
+	}
+	if id.Role < need {
+		return ctx, status.Error(codes.PermissionDenied, "requires "+need.String()+" role")
+	}
+	return context.WithValue(ctx, identityKey{}, id), nil
+}
+
+func (a *authenticator) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, h grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return h(ctx, req)
+}
+
+func (a *authenticator) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+	ctx, err := a.authorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return h(srv, &identifiedStream{ServerStream: ss, ctx: ctx})
+}
+
+// identifiedStream carries the caller's identity in its context
+type identifiedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identifiedStream) Context() context.Context { return s.ctx }
+
+// grpcActor identifies who issued a gRPC call for the audit log
+func grpcActor(ctx context.Context) string {
+	if id, ok := identityFrom(ctx); ok {
+		return id.Name
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return "grpc"
+}
+
+func (s *grpcServer) GetStatus(ctx context.Context, _ *pb.GetStatusRequest) (*pb.GetStatusResponse, error) {
+	return &pb.GetStatusResponse{Message: s.eng.Status().Message}, nil
+}
+
+func (s *grpcServer) Start(ctx context.Context, _ *pb.StartRequest) (*pb.StartResponse, error) {
+	go s.eng.Start(context.Background())
+	recordAuditAs(s.db, grpcActor(ctx), "engine.start", nil)
+	return &pb.StartResponse{}, nil
+}
+
+func (s *grpcServer) Stop(ctx context.Context, _ *pb.StopRequest) (*pb.StopResponse, error) {
+	s.eng.Stop()
+	recordAuditAs(s.db, grpcActor(ctx), "engine.stop", nil)
+	return &pb.StopResponse{}, nil
+}
+
+func (s *grpcServer) Halt(ctx context.Context, _ *pb.HaltRequest) (*pb.HaltResponse, error) {
+	s.eng.Halt()
+	recordAuditAs(s.db, grpcActor(ctx), "engine.halt", nil)
+	return &pb.HaltResponse{}, nil
+}
+
+func (s *grpcServer) Resume(ctx context.Context, _ *pb.ResumeRequest) (*pb.ResumeResponse, error) {
+	s.eng.Resume()
+	recordAuditAs(s.db, grpcActor(ctx), "engine.resume", nil)
+	return &pb.ResumeResponse{}, nil
+}
+
+func (s *grpcServer) ListStrategies(ctx context.Context, _ *pb.ListStrategiesRequest) (*pb.ListStrategiesResponse, error) {
+	out := &pb.ListStrategiesResponse{}
+	for _, st := range s.eng.Strategies() {
+		out.Strategies = append(out.Strategies, strategyProto(st))
+	}
+	return out, nil
+}
+
+func (s *grpcServer) AddStrategy(ctx context.Context, req *pb.AddStrategyRequest) (*pb.AddStrategyResponse, error) {
+	spec := strategy.Spec{
+		Type:     req.GetType(),
+		Name:     req.GetName(),
+		Symbol:   req.GetSymbol(),
+		Capital:  req.GetCapital(),
+		Interval: req.GetInterval(),
+		LongOnly: req.LongOnly,
+	}
+	if p := req.GetParamsJson(); p != "" {
+		if !json.Valid([]byte(p)) {
+			return nil, status.Error(codes.InvalidArgument, "params_json is not valid JSON")
+		}
+		spec.Params = json.RawMessage(p)
+	}
+	st, err := s.newStrategy(spec)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.eng.AddStrategy(st); err != nil {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	recordAuditAs(s.db, grpcActor(ctx), "strategy.add", spec)
+	return &pb.AddStrategyResponse{Strategy: strategyProto(st)}, nil
+}
+
+func (s *grpcServer) RemoveStrategy(ctx context.Context, req *pb.RemoveStrategyRequest) (*pb.RemoveStrategyResponse, error) {
+	st, err := s.eng.RemoveStrategy(req.GetName())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	recordAuditAs(s.db, grpcActor(ctx), "strategy.remove", map[string]string{"name": st.Name(), "symbol": st.Symbol()})
+	return &pb.RemoveStrategyResponse{}, nil
+}
+
+func (s *grpcServer) PlaceOrder(ctx context.Context, req *pb.PlaceOrderRequest) (*pb.PlaceOrderResponse, error) {
+	om := s.eng.OrderManager()
+	if om == nil {
+		return nil, status.Error(codes.Unavailable, "no order manager is running")
+	}
+	o := engine.Order{
+		Symbol:        strings.ToUpper(req.GetSymbol()),
+		ClientOrderID: req.GetClientOrderId(),
+		Strategy:      req.GetStrategy(),
+		Type:          engine.OrderMarket,
+	}
+	switch req.GetSide() {
+	case pb.Side_SIDE_BUY:
+		o.Side = engine.SideBuy
+	case pb.Side_SIDE_SELL:
+		o.Side = engine.SideSell
+	default:
+		return nil, status.Error(codes.InvalidArgument, "side is required")
+	}
+	if req.GetType() == pb.OrderType_ORDER_TYPE_LIMIT {
+		o.Type = engine.OrderLimit
+	}
+	if o.Symbol == "" {
+		return nil, status.Error(codes.InvalidArgument, "symbol is required")
+	}
+	qty, err := decimal.NewFromString(req.GetQuantity())
+	if err != nil || !qty.IsPositive() {
+		return nil, status.Error(codes.InvalidArgument, "quantity must be a positive decimal")
+	}
+	o.Quantity = qty
+	if p := req.GetPrice(); p != "" {
+		price, err := decimal.NewFromString(p)
+		if err != nil || !price.IsPositive() {
+			return nil, status.Error(codes.InvalidArgument, "price must be a positive decimal")
+		}
+		o.Price = price
+	}
+	if o.Type == engine.OrderLimit && !o.Price.IsPositive() {
+		return nil, status.Error(codes.InvalidArgument, "limit orders need a price")
+	}
+
+	placed, err := om.Submit(ctx, o)
+	recordAuditAs(s.db, grpcActor(ctx), "order.place", map[string]interface{}{
+		"symbol": o.Symbol, "side": o.Side, "type": o.Type, "quantity": o.Quantity, "price": o.Price,
+		"client_order_id": o.ClientOrderID, "order_id": placed.ID, "error": errString(err),
+	})
+	if err != nil {
+		if errors.Is(err, engine.ErrKillSwitch) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	return &pb.PlaceOrderResponse{Order: orderProto(placed)}, nil
+}
+
+func (s *grpcServer) CancelOrder(ctx context.Context, req *pb.CancelOrderRequest) (*pb.CancelOrderResponse, error) {
+	x := s.eng.ExchangeAdapter()
+	if x == nil {
+		return nil, status.Error(codes.Unavailable, "no exchange adapter is set")
+	}
+	symbol := strings.ToUpper(req.GetSymbol())
+	if symbol == "" || req.GetOrderId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "symbol and order_id are required")
+	}
+	// an order queued for the market open is not on the exchange yet, it
+	// is canceled by its client order id
+	if q, ok := s.eng.OrderManager().(interface {
+		CancelQueued(string) (engine.Order, bool)
+	}); ok {
+		if _, ok := q.CancelQueued(req.GetOrderId()); ok {
+			recordAuditAs(s.db, grpcActor(ctx), "order.queued.cancel", map[string]string{"symbol": symbol, "client_order_id": req.GetOrderId()})
+			return &pb.CancelOrderResponse{}, nil
+		}
+	}
+	err := x.CancelOrder(ctx, symbol, req.GetOrderId())
+	recordAuditAs(s.db, grpcActor(ctx), "order.cancel", map[string]string{"symbol": symbol, "order_id": req.GetOrderId(), "error": errString(err)})
+	if err != nil {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	return &pb.CancelOrderResponse{}, nil
+}
+
+func (s *grpcServer) ListOpenOrders(ctx context.Context, _ *pb.ListOpenOrdersRequest) (*pb.ListOpenOrdersResponse, error) {
+	out := &pb.ListOpenOrdersResponse{}
+	if t, ok := s.eng.OrderManager().(interface{ OpenOrders() []engine.Order }); ok {
+		orders := t.OpenOrders()
+		sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+		for _, o := range orders {
+			out.Orders = append(out.Orders, orderProto(o))
+		}
+	}
+	return out, nil
+}
+
+func (s *grpcServer) ListPositions(ctx context.Context, _ *pb.ListPositionsRequest) (*pb.ListPositionsResponse, error) {
+	out := &pb.ListPositionsResponse{}
+	for _, p := range s.eng.Positions().Positions() {
+		out.Positions = append(out.Positions, &pb.Position{
+			Strategy:   p.Strategy,
+			Symbol:     p.Symbol,
+			Quantity:   p.Quantity.String(),
+			AvgPrice:   p.AvgPrice.String(),
+			Realized:   p.Realized.String(),
+			Unrealized: p.Unrealized.String(),
+			Fees:       p.Fees.String(),
+			MarkPrice:  p.MarkPrice.String(),
+		})
+	}
+	return out, nil
+}
+
+func (s *grpcServer) StreamMarketData(req *pb.StreamMarketDataRequest, stream pb.EngineService_StreamMarketDataServer) error {
+	symbols := symbolSet(req.GetSymbols())
+	ch := make(chan *pb.MarketDataEvent, grpcStreamBuffer)
+	unsubscribe := s.eng.Events().Subscribe(engine.EventCandle, func(ev engine.Event) {
+		if len(symbols) > 0 && !symbols[strings.ToUpper(ev.Symbol)] {
+			return
+		}
+		c := ev.Candle
+		select {
+		case ch <- &pb.MarketDataEvent{Symbol: ev.Symbol, Candle: &pb.Candle{
+			Time: timestamppb.New(c.Time), Open: c.Open, High: c.High, Low: c.Low, Close: c.Close, Volume: c.Volume,
+		}}:
+		default:
+		}
+	})
+	defer unsubscribe()
+	return forward(stream.Context(), ch, stream.Send)
+}
+
+func (s *grpcServer) StreamOrderEvents(req *pb.StreamOrderEventsRequest, stream pb.EngineService_StreamOrderEventsServer) error {
+	symbols := symbolSet(req.GetSymbols())
+	ch := make(chan *pb.OrderEvent, grpcStreamBuffer)
+	push := func(typ pb.OrderEvent_Type) func(engine.Event) {
+		return func(ev engine.Event) {
+			if len(symbols) > 0 && !symbols[strings.ToUpper(ev.Order.Symbol)] {
+				return
+			}
+			m := &pb.OrderEvent{Type: typ, Time: timestamppb.New(ev.Time), Order: orderProto(ev.Order)}
+			if typ == pb.OrderEvent_TYPE_FILLED {
+				m.Fee = ev.Order.Fee.String()
+			}
+			select {
+			case ch <- m:
+			default:
+			}
+		}
+	}
+	bus := s.eng.Events()
+	unsubscribeUpdates := bus.Subscribe(engine.EventOrderUpdated, push(pb.OrderEvent_TYPE_UPDATED))
+	defer unsubscribeUpdates()
+	unsubscribeFills := bus.Subscribe(engine.EventOrderFilled, push(pb.OrderEvent_TYPE_FILLED))
+	defer unsubscribeFills()
+	return forward(stream.Context(), ch, stream.Send)
+}
+
+// forward sends what arrives on ch until the client goes away
+func forward[T any](ctx context.Context, ch <-chan T, send func(T) error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m := <-ch:
+			if err := send(m); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func symbolSet(symbols []string) map[string]bool {
+	set := map[string]bool{}
+	for _, s := range symbols {
+		if s = strings.TrimSpace(s); s != "" {
+			set[strings.ToUpper(s)] = true
+		}
+	}
+	return set
+}
+
+func strategyProto(s engine.Strategy) *pb.Strategy {
+	return &pb.Strategy{Name: s.Name(), Type: strategy.TypeOf(s), Symbol: s.Symbol(), IntervalSeconds: s.Interval(), AccountUsd: s.AccountBalUSD().String()}
+}
+
+func orderProto(o engine.Order) *pb.Order {
+	side := pb.Side_SIDE_BUY
+	if o.Side == engine.SideSell {
+		side = pb.Side_SIDE_SELL
+	}
+	typ := pb.OrderType_ORDER_TYPE_MARKET
+	if o.Type == engine.OrderLimit {
+		typ = pb.OrderType_ORDER_TYPE_LIMIT
+	}
+	return &pb.Order{
+		Id:            o.ID,
+		ClientOrderId: o.ClientOrderID,
+		Strategy:      o.Strategy,
+		Symbol:        o.Symbol,
+		Side:          side,
+		Type:          typ,
+		Price:         o.Price.String(),
+		Quantity:      o.Quantity.String(),
+		FilledQty:     o.FilledQty.String(),
+		FilledPrice:   o.FilledPrice.String(),
+		Remaining:     o.Remaining().String(),
+		Status:        string(o.Status),
+		TraceId:       o.TraceID,
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Backtest job states
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+const (
+	// maxRunningBacktests is how many backtest jobs run at once, the rest wait queued
+	maxRunningBacktests = 2
+	// backtestJobTTL is how long a finished job's status stays in memory,
+	// the results of jobs that finished are in the store for good
+	backtestJobTTL = time.Hour
+)
+
+var errJobFinished = errors.New("backtest job already finished")
+
+// backtestJob is a backtest running in the background
+type backtestJob struct {
+	ID       string          `json:"id"`
+	Request  backtestRequest `json:"request"`
+	Status   string          `json:"status"`
+	Progress float64         `json:"progress"` // percent of the candles replayed
+	Error    string          `json:"error,omitempty"`
+	Created  time.Time       `json:"created"`
+	Started  time.Time       `json:"started,omitzero"`
+	Finished time.Time       `json:"finished,omitzero"`
+	Result   json.RawMessage `json:"result,omitempty"` // the backtest's stats once done
+
+	cancel context.CancelFunc
+}
+
+func (j *backtestJob) finished() bool {
+	return j.Status == jobDone || j.Status == jobFailed || j.Status == jobCanceled
+}
+
+// backtestJobs runs backtests in the background, a few at a time, and
+// keeps their status for polling
+type backtestJobs struct {
+	mt    sync.Mutex
+	jobs  map[string]*backtestJob
+	slots chan struct{}
+	run   func(ctx context.Context, req backtestRequest, progress func(done, total int)) ([]byte, error)
+}
+
+func newBacktestJobs(run func(ctx context.Context, req backtestRequest, progress func(done, total int)) ([]byte, error)) *backtestJobs {
+	return &backtestJobs{
+		jobs:  map[string]*backtestJob{},
+		slots: make(chan struct{}, maxRunningBacktests),
+		run:   run,
+	}
+}
+
+// newBacktestID names a job started at now, the random suffix keeps jobs
+// started in the same instant apart
+func newBacktestID(now time.Time) string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return "backtest_" + now.Format("20060102_150405") + "_" + hex.EncodeToString(b)
+}
+
+// start queues req as a new job and returns a copy of it
+func (b *backtestJobs) start(req backtestRequest) backtestJob {
+	now := time.Now().UTC()
+	req.ID = newBacktestID(now)
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &backtestJob{ID: req.ID, Request: req, Status: jobQueued, Created: now, cancel: cancel}
+
+	b.mt.Lock()
+	b.prune(now)
+	b.jobs[job.ID] = job
+	view := *job
+	b.mt.Unlock()
+
+	go b.execute(ctx, job)
+	return view
+}
+
+func (b *backtestJobs) execute(ctx context.Context, job *backtestJob) {
+	defer job.cancel()
+	select {
+	case b.slots <- struct{}{}:
+		defer func() { <-b.slots }()
+	case <-ctx.Done():
+		b.finish(job, nil, ctx.Err())
+		return
+	}
+
+	b.mt.Lock()
+	job.Status, job.Started = jobRunning, time.Now().UTC()
+	b.mt.Unlock()
+
+	result, err := b.run(ctx, job.Request, func(done, total int) {
+		b.mt.Lock()
+		job.Progress = 100 * float64(done) / float64(total)
+		b.mt.Unlock()
+	})
+	b.finish(job, result, err)
+}
+
+func (b *backtestJobs) finish(job *backtestJob, result []byte, err error) {
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	job.Finished = time.Now().UTC()
+	switch {
+	case errors.Is(err, context.Canceled):
+		job.Status = jobCanceled
+		log.Printf("backtest %s canceled", job.ID)
+	case err != nil:
+		job.Status, job.Error = jobFailed, err.Error()
+		log.Printf("backtest %s failed: %v", job.ID, err)
+	default:
+		job.Status, job.Progress, job.Result = jobDone, 100, result
+	}
+}
+
+// get returns a copy of the job with id
+func (b *backtestJobs) get(id string) (backtestJob, bool) {
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	job, ok := b.jobs[id]
+	if !ok {
+		return backtestJob{}, false
+	}
+	return *job, true
+}
+
+// cancel stops the job with id, queued or running
+func (b *backtestJobs) cancel(id string) error {
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	job, ok := b.jobs[id]
+	if !ok {
+		return fmt.Errorf("no backtest job %s", id)
+	}
+	if job.finished() {
+		return errJobFinished
+	}
+	job.cancel()
+	return nil
+}
+
+// prune forgets jobs that finished more than backtestJobTTL before now.
+// Callers must hold b.mt.
+func (b *backtestJobs) prune(now time.Time) {
+	for id, job := range b.jobs {
+		if job.finished() && now.Sub(job.Finished) > backtestJobTTL {
+			delete(b.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// jwtClaims are the token claims the control API reads. The role comes from
+// the role claim, or the highest role named in a space separated scope.
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	Scope     string `json:"scope"`
+	Expires   int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+// looksLikeJWT tells a bearer token from a plain API key
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// verifyJWT checks an HS256 token signed with secret and returns its caller
+func verifyJWT(token string, secret []byte, now time.Time) (identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return identity{}, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return identity{}, fmt.Errorf("header: %w", err)
+	}
+	if header.Alg != "HS256" {
+		return identity{}, fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return identity{}, fmt.Errorf("signature: %w", err)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return identity{}, errors.New("bad signature")
+	}
+
+	var c jwtClaims
+	if err := decodeJWTPart(parts[1], &c); err != nil {
+		return identity{}, fmt.Errorf("claims: %w", err)
+	}
+	if c.Expires == 0 {
+		return identity{}, errors.New("token has no expiry")
+	}
+	if now.Unix() >= c.Expires {
+		return identity{}, errors.New("token expired")
+	}
+	if c.NotBefore != 0 && now.Unix() < c.NotBefore {
+		return identity{}, errors.New("token not valid yet")
+	}
+
+	r, ok := parseRole(c.Role)
+	for _, s := range strings.Fields(c.Scope) {
+		if sr, sok := parseRole(s); sok && sr > r {
+			r, ok = sr, true
+		}
+	}
+	if !ok {
+		return identity{}, errors.New("token grants no role")
+	}
+	name := c.Subject
+	if name == "" {
+		name = "jwt"
+	}
+	return identity{Name: name, Role: r}, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -2,131 +2,243 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/omept/trading-engine/pkg/config"
 	"github.com/omept/trading-engine/pkg/engine"
 	"github.com/omept/trading-engine/pkg/exchange"
+	"github.com/omept/trading-engine/pkg/notify"
+	"github.com/omept/trading-engine/pkg/secrets"
 	"github.com/omept/trading-engine/pkg/store"
 	"github.com/omept/trading-engine/pkg/strategy"
+	"github.com/omept/trading-engine/pkg/telemetry"
 
 	"github.com/joho/godotenv"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc"
 )
 
 func main() {
-	log.Println("Starting trading engine ...")
-
 	if err := godotenv.Load(); err != nil {
 		log.Println(".env not found or could not be loaded - continuing with environment variables")
 	}
 
-	// Initialize persistence (SQLite)
-	sqlLiteFD := os.Getenv("SQLITE_FILE_DIR")
-	if sqlLiteFD == "" {
-		sqlLiteFD = "engine.db"
+	// the first argument names the command, the engine runs live without one
+	name, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-	db, err := store.NewSQLiteStore(sqlLiteFD)
-	if err != nil {
-		log.Fatal("sqlite init:", err)
+	if name == "help" {
+		printUsage(os.Stdout)
+		return
 	}
-	defer db.Close()
-
-	// Read config
-	exchangeName := os.Getenv("EXCHANGE") // MOCK | BINANCE | ALPACA
-	if exchangeName == "" {
-		exchangeName = "MOCK"
+	cmd, ok := commands[name]
+	if !ok {
+		printUsage(os.Stderr)
+		os.Exit(2)
 	}
-
-	// Risk manager
-	fdprS := os.Getenv("FIXED_DECIMAL_PERCENT_RISK")
-	fdpr, err := strconv.ParseFloat(fdprS, 64)
-	if err != nil || fdpr <= 0 {
-		fdpr = 0.005 // defaults to  0.5%
+	if err := cmd.run(args); err != nil {
+		log.Fatal(err)
 	}
+}
 
-	// Strategy names and account balance
-	emacSymbol := os.Getenv("EMAC_CROSSOVER_STRATEGY")
-	if emacSymbol == "" {
-		emacSymbol = "BTCUSD"
-	}
-	mrSymbol := os.Getenv("MEAN_REVERSION_CROSSOVER_STRATEGY")
-	if mrSymbol == "" {
-		mrSymbol = "BTCUSD"
+// serve runs the live engine with cfg, loaded from file, and its control
+// APIs until interrupted
+func serve(file string, cfg *config.Config) {
+	log.Println("Starting trading engine ...")
+
+	// Tracing for the order path
+	shutdownTracing, err := telemetry.Init()
+	if err != nil {
+		log.Fatal("tracing init:", err)
 	}
+	defer shutdownTracing(context.Background())
 
-	usdBalS := os.Getenv("ACCOUNT_USD_BAL")
-	usdBal, err := strconv.ParseFloat(usdBalS, 64)
-	if err != nil || usdBal <= 0 {
-		usdBal = 300 // defaults to 300
+	// Initialize persistence (SQLite by default, Postgres to share one database between instances)
+	db, err := openStore(cfg.Store)
+	if err != nil {
+		log.Fatal("store init:", err)
 	}
+	defer db.Close()
 
-	// Create exchange adapter based on env
-	exch := initExhangeAdapter(exchangeName, db)
+	// Where exchange API keys come from
+	secretProvider := initSecretProvider()
+
+	// Create exchange adapter based on config
+	exch, err := initExhangeAdapter(cfg.Exchange.Name, cfg.Exchange, secretProvider, db)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Order manager
 	om := engine.NewOrderManager(exch, db)
+	om.(*engine.OrderManager).SetPollInterval(cfg.Orders.PollInterval.Std())
+	om.(*engine.OrderManager).SetIdempotencyTTL(cfg.Orders.IdempotencyTTL.Std())
+	om.(*engine.OrderManager).SetAlgo(cfg.Orders.Algo.Config())
+	om.(*engine.OrderManager).SetBreakerConfig(cfg.Exchange.Breaker.Config())
+	for sym, max := range cfg.Orders.MaxSize {
+		om.(*engine.OrderManager).SetMaxOrderSize(sym, max)
+	}
 
-	// Risk manager
-	risk := engine.NewFixedPercentRisk(fdpr)
-
-	// Strategies
-	ema := strategy.NewEMACrossover(emacSymbol, 9, 21, om, risk)
-	ema.SetAccountUSD(usdBal)
-	mr := strategy.NewMeanReversion(mrSymbol, 20, 2.0, om, risk)
-	mr.SetAccountUSD(usdBal)
+	// Risk manager, shared by strategies without their own sizing
+	risk := engine.NewFixedPercentRisk(cfg.Risk.FixedPercent)
 
 	// Engine
 	eng := engine.NewEngine()
-	eng.RegisterStrategy(ema)
-	eng.RegisterStrategy(mr)
+	// strategies trade through the execution algorithm, slicing large orders
+	newStrategy := newStrategyFactory(risk, om.(*engine.OrderManager).AlgoExecutor(), eng)
+
+	// Strategies, one instance per config entry
+	for _, spec := range cfg.Strategies {
+		st, err := newStrategy(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		eng.RegisterStrategy(st)
+		log.Printf("Registered %s strategy %q on %s with %.2f USD", spec.Type, st.Name(), st.Symbol(), spec.Capital)
+	}
 	eng.SetExchangeAdapter(exch)
 	eng.SetOrderManager(om)
 	eng.SetStore(db)
+	eng.SetEquityInterval(cfg.Session.EquityEvery.Std())
+	eng.SetEquityQuote(cfg.Exchange.QuoteAsset)
+	eng.SetStateInterval(cfg.Session.StateEvery.Std())
+
+	// Portfolio exposure limits across all strategies, checked before every order
+	eng.SetPortfolioRisk(engine.NewPortfolioRiskManager(cfg.Risk.Portfolio))
+
+	// Daily loss kill switch, halts the strategies once the day's PnL breaches the limit
+	eng.SetKillSwitch(engine.NewKillSwitch(cfg.Risk.KillSwitch))
+
+	// Stop-loss and take-profit exits behind every position a strategy opens
+	eng.SetProtection(engine.NewPositionProtector(cfg.Risk.Protection, om))
+
+	// Orders on equities held to the sessions of their market
+	if cal := marketCalendar(cfg.Orders.MarketHours.Calendar, exch); cal != nil {
+		eng.SetMarketHours(engine.NewMarketHours(cal, cfg.Orders.MarketHours.MarketHoursConfig))
+	}
+
+	// Warning when a futures position nears its liquidation price
+	eng.SetLiquidationBuffer(decimal.NewFromFloat(cfg.Risk.LiquidationBuffer))
+
+	// Exchange latency and clock drift, warning before signed requests start failing
+	eng.SetHealthMonitor(engine.NewHealthMonitor(cfg.Exchange.Health.Config()))
+
+	// Periodic comparison of local orders, positions and balances with the exchange
+	eng.SetReconciler(engine.NewReconciler(cfg.Reconcile.ReconcileConfig), cfg.Reconcile.Every.Std())
+
+	// Alerts on fills, rejected orders, signals, kill switch trips, shutdown and daily PnL
+	alerts, err := notify.NewDispatcher(cfg.Notify.Channels, secretProvider)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// tracked without channels too, a config reload may add some
+	alerts.Track(eng.Events())
+	eng.AddNotifier(alerts)
+	if !alerts.Empty() {
+		log.Printf("Sending alerts to %d notification channels", len(cfg.Notify.Channels))
+	}
+
+	// Signed order and trade events for systems outside the engine
+	var sink *notify.EventSink
+	if wh := cfg.Notify.EventWebhook; wh.URL != "" {
+		sink = notify.NewEventSink(wh.URL, wh.Secret, wh.MaxAttempts, wh.Backoff.Std())
+		sink.Track(eng.Events())
+		log.Printf("Posting order and trade events to %s", wh.URL)
+	}
+
+	// Session recording of candles and orders for later replay
+	if cfg.Session.Record {
+		eng.SetRecorder(engine.NewRecorder(db))
+	}
+
+	// Candle feed backpressure for all feeds, with per symbol overrides
+	eng.SetFeedConfig("", feedConfig(cfg.Feeds.Backpressure, cfg.Feeds.Buffer))
+	for sym, policy := range cfg.Feeds.Symbols {
+		eng.SetFeedConfig(sym, feedConfig(policy, cfg.Feeds.Buffer))
+	}
+
+	// Rebuild state a crash or deploy left in the store, or only restore
+	// strategy state from a snapshot (an id or "latest") or from the state
+	// the strategies saved last, before starting
+	if cfg.Session.Recover {
+		snapID := cfg.Session.Restore
+		if snapID == "" {
+			snapID = "latest"
+		}
+		if _, err := eng.Recover(context.Background(), snapID); err != nil {
+			log.Fatal("recover:", err)
+		}
+	} else if snapID := cfg.Session.Restore; snapID != "" {
+		if _, err := eng.Restore(context.Background(), snapID); err != nil {
+			log.Fatal("restore snapshot:", err)
+		}
+	} else if _, err := eng.LoadStrategyStates(); err != nil {
+		log.Fatal("strategy state:", err)
+	}
 
 	// HTTP control server and minimal UI
-	httpAddr := os.Getenv("HTTP_ADDR")
-	if httpAddr == "" {
-		httpAddr = ":8080"
+	httpAddr := cfg.HTTPAddr
+
+	// API keys and their roles (viewer | operator | admin), and the secret
+	// JWTs issued by an identity provider are signed with
+	auth := newAuthenticator(os.Getenv("API_KEYS"), os.Getenv("API_JWT_SECRET"))
+
+	// builds adapters for runtime swaps via the API
+	newExchange := func(name string) (engine.ExchangeAdapter, error) {
+		return initExhangeAdapter(name, cfg.Exchange, secretProvider, db)
 	}
 
-	mux := setUpAPIs(eng, db)
-	srv := &http.Server{Addr: httpAddr, Handler: mux}
+	// applies config changes from PUT /api/config or the config file
+	reloader := newConfigReloader(cfg, eng, db, risk, alerts, newStrategy)
+
+	mux := setUpAPIs(eng, db, cfg, auth, newExchange, newStrategy, reloader)
+	srv, err := newControlServer(httpAddr, limitRequests(telemetry.Handler(mux), cfg.Limits, auth), cfg.TLS)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Start HTTP server
 	go func() {
-		log.Println("HTTP control server listening on", httpAddr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := serveControl(srv, cfg.TLS); err != nil && err != http.ErrServerClosed {
 			log.Fatal(err)
 		}
 	}()
 
-	// ------------------------------------------------------
-	// BACKTEST MODE
-	// ------------------------------------------------------
-	backtestMode := os.Getenv("BACKTEST") == "1"
-	selectedStrategy := os.Getenv("STRATEGY") // ema | mean | all
-	if selectedStrategy == "" {
-		selectedStrategy = "all"
-	}
-
-	if backtestMode {
-		log.Println("BACKTEST MODE ENABLED")
-
-		sym := os.Getenv("BACKTEST_SYMBOL")
-		if sym == "" {
-			sym = "BTCUSD"
+	// gRPC control and data API next to the REST API
+	var grpcSrv *grpc.Server
+	if cfg.GRPCAddr != "" {
+		tlsConfig, err := grpcTLSConfig(srv, cfg.TLS)
+		if err != nil {
+			log.Fatal(err)
 		}
-
+		grpcSrv = newGRPCServer(eng, db, auth, newStrategy, tlsConfig)
+		go func() {
+			if err := serveGRPC(grpcSrv, cfg.GRPCAddr); err != nil {
+				log.Fatal(err)
+			}
+		}()
 	}
 
 	// Start engine automatically
 	ctx, cancel := context.WithCancel(context.Background())
 	go eng.Start(ctx)
+	go alerts.RunDailySummary(ctx, eng)
+	if file != "" && cfg.Reload.Watch > 0 {
+		go reloader.watch(ctx, file, cfg.Reload.Watch.Std())
+	}
+	if policy := cfg.Retention.Policy(); cfg.Retention.Every > 0 && !policy.Empty() {
+		go store.RunRetention(ctx, db, policy, cfg.Retention.Every.Std())
+	}
 
 	// Wait for interrupt
 	stop := make(chan os.Signal, 1)
@@ -141,57 +253,337 @@ func main() {
 	if err := srv.Shutdown(ctxShutdown); err != nil {
 		log.Println("HTTP server Shutdown:", err)
 	}
+	if grpcSrv != nil {
+		// streams stay open until their clients leave, so they are cut off
+		grpcSrv.Stop()
+	}
 
-	// Stop engine
+	// Stop engine: drain feeds and in-flight orders, optionally cancel open
+	// orders, flush events and store a final snapshot before the store closes
+	ctxStop, cancelStop := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout.Std())
+	defer cancelStop()
+	opts := engine.ShutdownOptions{CancelOpenOrders: cfg.Shutdown.CancelOrders}
+	if err := eng.Shutdown(ctxStop, opts); err != nil {
+		log.Println(err)
+	}
+	// the shutdown report is still queued for the alert channels
+	if err := alerts.Flush(ctxStop); err != nil {
+		log.Println("notify: flush alerts:", err)
+	}
+	if sink != nil {
+		if err := sink.Flush(ctxStop); err != nil {
+			log.Println("event webhook: flush events:", err)
+		}
+	}
 	cancel()
-	eng.Stop()
 
 	log.Println("done")
 }
 
-func initExhangeAdapter(exchangeName string, db *store.SQLiteStore) engine.ExchangeAdapter {
-	var exch engine.ExchangeAdapter
-	var err error
+// newStrategyFactory builds strategies trading through om, sized by risk
+// unless their spec sets a sizer of their own. Kelly sizing learns from the
+// round trips the trade journal of eng keeps. Signal-only strategies record
+// their signals through eng instead of trading.
+func newStrategyFactory(risk *engine.FixedPercentRisk, om engine.OrderExecutor, eng *engine.Engine) strategyFactory {
+	return func(spec strategy.Spec) (engine.Strategy, error) {
+		var r engine.RiskManager = risk
+		if spec.Sizing != nil {
+			var err error
+			if r, err = engine.NewRiskManager(*spec.Sizing, risk.Share(), eng.TradeJournal()); err != nil {
+				return nil, fmt.Errorf("strategy %s %s: %w", spec.Type, spec.Symbol, err)
+			}
+		}
+		exec := om
+		if spec.SignalOnly {
+			exec = eng.SignalExecutor()
+		}
+		return strategy.New(spec, exec, r)
+	}
+}
+
+// initSecretProvider picks the secret backend from SECRETS_PROVIDER (env | vault | aws | file)
+func initSecretProvider() secrets.Provider {
+	switch os.Getenv("SECRETS_PROVIDER") {
+	case "vault":
+		addr := os.Getenv("VAULT_ADDR")
+		token := os.Getenv("VAULT_TOKEN")
+		path := os.Getenv("VAULT_SECRET_PATH")
+		if addr == "" || token == "" || path == "" {
+			log.Fatal("VAULT_ADDR, VAULT_TOKEN and VAULT_SECRET_PATH must be set for vault secrets")
+		}
+		log.Println("Reading exchange secrets from Vault")
+		return secrets.NewVaultProvider(addr, token, os.Getenv("VAULT_MOUNT"), path)
+
+	case "aws":
+		region := os.Getenv("AWS_REGION")
+		secretID := os.Getenv("AWS_SECRET_ID")
+		accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+		secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if region == "" || secretID == "" || accessKey == "" || secretKey == "" {
+			log.Fatal("AWS_REGION, AWS_SECRET_ID, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set for aws secrets")
+		}
+		log.Println("Reading exchange secrets from AWS Secrets Manager")
+		return secrets.NewAWSSecretsManagerProvider(region, secretID, accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN"))
+
+	case "file":
+		p, err := secrets.NewEncryptedFileProvider(os.Getenv("SECRETS_FILE"), os.Getenv("SECRETS_FILE_KEY"))
+		if err != nil {
+			log.Fatal("secrets file:", err)
+		}
+		log.Println("Reading exchange secrets from encrypted file")
+		return p
+
+	default:
+		return secrets.EnvProvider{}
+	}
+}
+
+// feedConfig builds a feed config from a validated backpressure policy and buffer size
+func feedConfig(policy string, buffer int) engine.FeedConfig {
+	p, _ := engine.ParseBackpressurePolicy(policy)
+	return engine.FeedConfig{Policy: p, Buffer: buffer}
+}
+
+// watchedCredentials holds the key pairs being re-read, one watcher per
+// provider and pair however often the exchange adapter is swapped
+var watchedCredentials = struct {
+	sync.Mutex
+	pairs map[string]*secrets.Credentials
+}{pairs: map[string]*secrets.Credentials{}}
+
+// loadCredentials reads an exchange key pair, re-reading it every SECRETS_REFRESH
+// for external providers so rotated keys apply without a restart. Adapters
+// built for the same pair share its credentials and their watcher.
+func loadCredentials(p secrets.Provider, keyName, secretName string) (*secrets.Credentials, error) {
+	id := p.Name() + "/" + keyName + "/" + secretName
+	watchedCredentials.Lock()
+	defer watchedCredentials.Unlock()
+	if creds, ok := watchedCredentials.pairs[id]; ok {
+		return creds, nil
+	}
+
+	every := time.Duration(0)
+	if _, isEnv := p.(secrets.EnvProvider); !isEnv {
+		every = 5 * time.Minute
+		if d, err := time.ParseDuration(os.Getenv("SECRETS_REFRESH")); err == nil {
+			every = d
+		}
+	}
+	creds, err := secrets.WatchCredentials(context.Background(), p, keyName, secretName, every)
+	if err != nil {
+		return nil, fmt.Errorf("%s and %s must be available from %s secrets: %w", keyName, secretName, p.Name(), err)
+	}
+	watchedCredentials.pairs[id] = creds
+	return creds, nil
+}
+
+// initExhangeAdapter builds the adapter exchangeName with the settings of xc
+func initExhangeAdapter(exchangeName string, xc config.Exchange, sp secrets.Provider, db store.Store) (engine.ExchangeAdapter, error) {
 	switch exchangeName {
 	case "BINANCE":
 		log.Println("Using Binance adapter (REST)")
-		binKey := os.Getenv("BINANCE_API_KEY")
-		binSecret := os.Getenv("BINANCE_API_SECRET")
-		if binKey == "" || binSecret == "" {
-			log.Fatal("BINANCE_API_KEY and BINANCE_API_SECRET must be set for BINANCE exchange")
+		creds, err := loadCredentials(sp, "BINANCE_API_KEY", "BINANCE_API_SECRET")
+		if err != nil {
+			if !xc.Paper {
+				return nil, err
+			}
+			// klines and exchange info are public, paper trading needs no keys
+			log.Printf("Paper trading Binance without API keys: %v", err)
+			creds = secrets.NewCredentials("", "")
 		}
-		// exchange.NewBinanceAdapter should be implemented in your exchange package.
-		exch, err = exchange.NewBinanceAdapter(binKey, binSecret, db)
+		exch, err := exchange.NewBinanceAdapter(creds, db)
 		if err != nil {
-			log.Fatal("failed to init binance adapter:", err)
+			return nil, fmt.Errorf("failed to init binance adapter: %w", err)
 		}
+		if xc.Binance.Testnet {
+			log.Println("Using the Binance spot testnet")
+		}
+		exch.(*exchange.BinanceAdapter).SetURLs(xc.Binance.URLs(false))
+		exch.(*exchange.BinanceAdapter).SetRateLimit(xc.RateLimit.Config())
+		exch.(*exchange.BinanceAdapter).SetRecvWindow(xc.Binance.RecvWindow.Std())
+		return paperTrading(exch, xc, db), nil
+
+	case "BINANCE_FUTURES":
+		log.Println("Using Binance USD-M futures adapter (REST + WebSocket)")
+		creds, err := loadCredentials(sp, "BINANCE_API_KEY", "BINANCE_API_SECRET")
+		if err != nil {
+			return nil, err
+		}
+		exch, err := exchange.NewBinanceFuturesAdapter(creds, db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init binance futures adapter: %w", err)
+		}
+		if xc.Binance.Testnet {
+			log.Println("Using the Binance futures testnet")
+		}
+		futures := exch.(*exchange.BinanceFuturesAdapter)
+		futures.SetURLs(xc.Binance.URLs(true))
+		futures.SetRateLimit(xc.RateLimit.Config())
+		futures.SetRecvWindow(xc.Binance.RecvWindow.Std())
+		futures.SetLeverage(xc.Binance.Leverage)
+		return paperTrading(exch, xc, db), nil
+
+	case "COINBASE":
+		log.Println("Using Coinbase Advanced Trade adapter (REST + WebSocket)")
+		creds, err := loadCredentials(sp, "COINBASE_API_KEY", "COINBASE_API_SECRET")
+		if err != nil {
+			return nil, err
+		}
+		exch, err := exchange.NewCoinbaseAdapter(creds, db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init coinbase adapter: %w", err)
+		}
+		exch.(*exchange.CoinbaseAdapter).SetRateLimit(xc.RateLimit.Config())
+		return paperTrading(exch, xc, db), nil
 
 	case "ALPACA":
 		log.Println("Using Alpaca adapter (REST)")
-		alpKey := os.Getenv("ALPACA_API_KEY")
-		alpSecret := os.Getenv("ALPACA_API_SECRET")
-		alpBase := os.Getenv("ALPACA_BASE_URL")
-		if alpBase == "" {
-			alpBase = "https://paper-api.alpaca.markets"
+		creds, err := loadCredentials(sp, "ALPACA_API_KEY", "ALPACA_API_SECRET")
+		if err != nil {
+			return nil, err
 		}
-		if alpKey == "" || alpSecret == "" {
-			log.Fatal("ALPACA_API_KEY and ALPACA_API_SECRET must be set for ALPACA exchange")
+		exch, err := exchange.NewAlpacaAdapter(creds, xc.Alpaca.BaseURL, db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init alpaca adapter: %w", err)
 		}
-		exch, err = exchange.NewAlpacaAdapter(alpKey, alpSecret, alpBase, db)
+		alpaca := exch.(*exchange.AlpacaAdapter)
+		alpaca.SetDataURL(xc.Alpaca.DataURL)
+		alpaca.SetFeed(xc.Alpaca.Feed)
+		alpaca.SetRateLimit(xc.RateLimit.Config())
+		return paperTrading(exch, xc, db), nil
+
+	case "OANDA":
+		log.Println("Using OANDA v20 adapter (REST + price stream)")
+		creds, err := loadCredentials(sp, "OANDA_API_TOKEN", "OANDA_ACCOUNT_ID")
 		if err != nil {
-			log.Fatal("failed to init alpaca adapter:", err)
+			return nil, err
 		}
+		exch, err := exchange.NewOandaAdapter(creds, db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init oanda adapter: %w", err)
+		}
+		if xc.Oanda.Live {
+			log.Println("Using a live OANDA account")
+		}
+		oanda := exch.(*exchange.OandaAdapter)
+		oanda.SetURLs(xc.Oanda.URLs())
+		oanda.SetRateLimit(xc.RateLimit.Config())
+		return paperTrading(exch, xc, db), nil
 
-	default:
+	case "MOCK", "":
 		log.Println("Using Mock exchange (default)")
-		// Mock exchange config (defaults)
-		mockExchangeUSDBalS := os.Getenv("MOCK_EXCHANGE_USD_BAL")
-		mockExchangeUSDBal, err := strconv.ParseFloat(mockExchangeUSDBalS, 64)
-		if err != nil || mockExchangeUSDBal <= 0 {
-			mockExchangeUSDBal = 100000 // defaults to 100000
+		mock := exchange.NewMockExchange(decimal.NewFromFloat(xc.Mock.USDBalance), db)
+
+		// Fault injection for testing retries and recovery
+		if xc.Mock.Chaos != nil {
+			mock.(*exchange.MockExchange).SetChaos(*xc.Mock.Chaos)
+		}
+
+		// Short selling on borrowed base
+		if xc.Mock.Margin != nil {
+			mock.(*exchange.MockExchange).SetMargin(*xc.Mock.Margin)
+		}
+
+		// Fees and slippage of simulated fills
+		mock.(*exchange.MockExchange).SetFillModel(xc.Mock.Fills)
+		return mock, nil
+
+	case "REPLAY":
+		bal := decimal.NewFromFloat(xc.Mock.USDBalance)
+		var replay engine.ExchangeAdapter
+		var err error
+		if xc.Replay.Source == "candles" {
+			log.Println("Using Replay exchange (stored candles, simulated execution)")
+			replay, err = exchange.NewCandleReplayExchange(xc.Replay.From, xc.Replay.To, xc.Replay.Speed, bal, db)
+		} else {
+			log.Println("Using Replay exchange (recorded session, simulated execution)")
+			replay, err = exchange.NewReplayExchange(xc.Replay.Session, xc.Replay.Speed, bal, db)
 		}
-		exch = exchange.NewMockExchange(mockExchangeUSDBal, db)
+		if err != nil {
+			return nil, err
+		}
+		replay.(*exchange.ReplayExchange).SetFillModel(xc.Mock.Fills)
+		return replay, nil
+	}
+
+	return nil, fmt.Errorf("unknown exchange %q", exchangeName)
+}
+
+// paperTrading wraps live in a PaperTradingAdapter when xc.Paper is set,
+// simulating orders with the mock exchange settings
+func paperTrading(live engine.ExchangeAdapter, xc config.Exchange, db store.Store) engine.ExchangeAdapter {
+	if !xc.Paper {
+		return live
 	}
+	log.Printf("Paper trading on %s market data, orders are simulated", live.AdapterName())
+	paper := exchange.NewPaperTradingAdapter(live, decimal.NewFromFloat(xc.Mock.USDBalance), db).(*exchange.PaperTradingAdapter)
+	if xc.Mock.Margin != nil {
+		paper.SetMargin(*xc.Mock.Margin)
+	}
+	paper.SetFillModel(xc.Mock.Fills)
+	return paper
+}
 
-	return exch
+// marketCalendar is the calendar named by the market hours settings, the
+// one of x or of the exchange it paper trades on for auto, nil for none
+func marketCalendar(name string, x engine.ExchangeAdapter) engine.MarketCalendar {
+	switch name {
+	case "nyse":
+		return engine.NYSECalendar{}
+	case "auto":
+		if p, ok := x.(*exchange.PaperTradingAdapter); ok {
+			x = p.Live()
+		}
+		if c, ok := x.(engine.MarketCalendar); ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// migrateStore moves the schema of db to version to, "latest" for the newest
+func migrateStore(db store.Store, to string) error {
+	m, ok := db.(store.Migrator)
+	if !ok {
+		return fmt.Errorf("store has no versioned migrations")
+	}
+	version := -1
+	if to != "latest" {
+		v, err := strconv.Atoi(to)
+		if err != nil || v < 0 {
+			return fmt.Errorf("migrate to %q: want a version or latest", to)
+		}
+		version = v
+	}
+	if err := m.MigrateTo(version); err != nil {
+		return err
+	}
+	v, err := m.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	log.Printf("Schema at version %d", v)
+	return nil
+}
+
+// openStore opens the store picked by sc.Driver (sqlite | postgres)
+func openStore(sc config.Store) (store.Store, error) {
+	switch sc.Driver {
+	case "sqlite":
+		return store.NewSQLiteStore(sc.SQLitePath, store.SQLiteConfig{
+			BusyTimeout: sc.BusyTimeout.Std(),
+			CandleBatch: sc.CandleBatch,
+			CandleFlush: sc.CandleFlush.Std(),
+		})
+	case "postgres":
+		pool := store.PoolConfig{
+			MaxOpenConns:    sc.MaxOpenConns,
+			MaxIdleConns:    sc.MaxIdleConns,
+			ConnMaxLifetime: sc.ConnMaxLifetime.Std(),
+		}
+		log.Println("Using Postgres store")
+		return store.NewPostgresStore(sc.DatabaseURL, pool)
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", sc.Driver)
+	}
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/store"
+)
+
+// promWriter writes metrics in the Prometheus text exposition format
+type promWriter struct {
+	w io.Writer
+}
+
+// metric writes the help and type lines of a metric family
+func (p promWriter) metric(name, kind, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one sample of name, labels alternating names and values
+func (p promWriter) sample(name string, v float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i] + "=" + strconv.Quote(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(p.w, "%s %s\n", b.String(), strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// servePrometheus reports the store counts, feed drops, circuit breakers and
+// exchange health for Prometheus to scrape
+func servePrometheus(eng *engine.Engine, db store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		p := promWriter{w: w}
+
+		counts := []struct {
+			name, help string
+			count      func() (int64, error)
+		}{
+			{"trading_engine_orders", "Orders in the store.", db.CountOrders},
+			{"trading_engine_trades", "Trades in the store.", db.CountTrades},
+			{"trading_engine_runs", "Engine runs in the store.", db.CountRuns},
+		}
+		for _, c := range counts {
+			if n, err := c.count(); err == nil {
+				p.metric(c.name, "gauge", c.help)
+				p.sample(c.name, float64(n))
+			}
+		}
+
+		p.metric("trading_engine_candles_dropped_total", "counter", "Candles dropped by feed backpressure.")
+		for _, f := range eng.FeedStats() {
+			p.sample("trading_engine_candles_dropped_total", float64(f.Dropped), "strategy", f.Strategy, "symbol", f.Symbol)
+		}
+
+		st := eng.Status()
+		p.metric("trading_engine_exchange_circuit_open", "gauge", "Whether order submission to the exchange is paused by its circuit breaker.")
+		for _, b := range st.Breakers {
+			p.sample("trading_engine_exchange_circuit_open", boolValue(b.Open), "exchange", b.Exchange)
+		}
+		if len(st.Health) == 0 {
+			return
+		}
+		p.metric("trading_engine_exchange_up", "gauge", "Whether the latest health check of the exchange passed.")
+		for _, h := range st.Health {
+			p.sample("trading_engine_exchange_up", boolValue(h.Healthy), "exchange", h.Exchange)
+		}
+		p.metric("trading_engine_exchange_latency_seconds", "gauge", "Round trip of the latest exchange health check.")
+		for _, h := range st.Health {
+			p.sample("trading_engine_exchange_latency_seconds", h.LatencyMs/1000, "exchange", h.Exchange)
+		}
+		p.metric("trading_engine_exchange_clock_drift_seconds", "gauge", "Exchange clock minus the local clock.")
+		for _, h := range st.Health {
+			if h.DriftMs != nil {
+				p.sample("trading_engine_exchange_clock_drift_seconds", *h.DriftMs/1000, "exchange", h.Exchange)
+			}
+		}
+		p.metric("trading_engine_exchange_health_checks_total", "counter", "Exchange health checks run.")
+		for _, h := range st.Health {
+			p.sample("trading_engine_exchange_health_checks_total", float64(h.Checks), "exchange", h.Exchange)
+		}
+		p.metric("trading_engine_exchange_health_check_failures_total", "counter", "Exchange health checks that failed.")
+		for _, h := range st.Health {
+			p.sample("trading_engine_exchange_health_check_failures_total", float64(h.Failures), "exchange", h.Exchange)
+		}
+	}
+}
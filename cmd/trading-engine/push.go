@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/shopspring/decimal"
+)
+
+// pushEquityEvery is how often connected clients get the PnL of all positions
+const pushEquityEvery = 5 * time.Second
+
+// pushMessage is one event pushed to UI clients
+type pushMessage struct {
+	Type   string      `json:"type"` // order | fill | candle | equity | status
+	Time   time.Time   `json:"time"`
+	Symbol string      `json:"symbol,omitempty"`
+	Data   interface{} `json:"data"`
+}
+
+// fillView is a fill as pushed to UI clients
+type fillView struct {
+	orderView
+	FilledPrice decimal.Decimal `json:"filled_price"`
+	Fee         decimal.Decimal `json:"fee"`
+}
+
+// equityView sums the PnL of every strategy position
+type equityView struct {
+	Realized   decimal.Decimal `json:"realized"`
+	Unrealized decimal.Decimal `json:"unrealized"`
+	PnL        decimal.Decimal `json:"pnl"`
+}
+
+// pushTypes are the message types clients can filter on
+var pushTypes = []string{"order", "fill", "signal", "candle", "equity", "status"}
+
+// pushFilter picks the messages a client wants, empty sets let all through.
+// Messages about no symbol in particular pass any symbol filter.
+type pushFilter struct {
+	types   map[string]bool
+	symbols map[string]bool
+}
+
+// parsePushFilter reads comma separated types and symbols from the query
+func parsePushFilter(q url.Values) (pushFilter, error) {
+	f := pushFilter{types: map[string]bool{}, symbols: map[string]bool{}}
+	for _, t := range strings.Split(q.Get("types"), ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if !slices.Contains(pushTypes, t) {
+			return f, fmt.Errorf("unknown event type %q, known: %s", t, strings.Join(pushTypes, ", "))
+		}
+		f.types[t] = true
+	}
+	for _, s := range strings.Split(q.Get("symbol"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			f.symbols[strings.ToUpper(s)] = true
+		}
+	}
+	return f, nil
+}
+
+func (f pushFilter) match(m pushMessage) bool {
+	if len(f.types) > 0 && !f.types[m.Type] {
+		return false
+	}
+	return len(f.symbols) == 0 || m.Symbol == "" || f.symbols[strings.ToUpper(m.Symbol)]
+}
+
+// pushHub fans engine events out to connected UI clients. A client that
+// falls behind loses messages rather than slowing the others down.
+type pushHub struct {
+	mt      sync.Mutex
+	clients map[chan pushMessage]pushFilter
+}
+
+func newPushHub(eng *engine.Engine) *pushHub {
+	h := &pushHub{clients: make(map[chan pushMessage]pushFilter)}
+	bus := eng.Events()
+	bus.Subscribe(engine.EventOrderUpdated, func(ev engine.Event) {
+		h.publish(pushMessage{Type: "order", Time: ev.Time, Symbol: ev.Order.Symbol, Data: viewOrder(ev.Order)})
+	})
+	bus.Subscribe(engine.EventOrderFilled, func(ev engine.Event) {
+		o := ev.Order
+		h.publish(pushMessage{Type: "fill", Time: ev.Time, Symbol: o.Symbol, Data: fillView{viewOrder(o), o.FilledPrice, o.Fee}})
+	})
+	bus.Subscribe(engine.EventSignal, func(ev engine.Event) {
+		h.publish(pushMessage{Type: "signal", Time: ev.Time, Symbol: ev.Order.Symbol, Data: viewOrder(ev.Order)})
+	})
+	bus.Subscribe(engine.EventCandle, func(ev engine.Event) {
+		h.publish(pushMessage{Type: "candle", Time: ev.Time, Symbol: ev.Symbol, Data: ev.Candle})
+	})
+	bus.Subscribe(engine.EventStatus, func(ev engine.Event) {
+		h.publish(pushMessage{Type: "status", Time: ev.Time, Data: map[string]string{"message": ev.Status}})
+	})
+	go h.pushEquity(eng)
+	return h
+}
+
+// pushEquity sends the PnL of all positions while clients are connected
+func (h *pushHub) pushEquity(eng *engine.Engine) {
+	for now := range time.Tick(pushEquityEvery) {
+		if h.count() == 0 {
+			continue
+		}
+		var eq equityView
+		for _, s := range eng.Positions().Symbols() {
+			eq.Realized = eq.Realized.Add(s.Realized)
+			eq.Unrealized = eq.Unrealized.Add(s.Unrealized)
+		}
+		eq.PnL = eq.Realized.Add(eq.Unrealized)
+		h.publish(pushMessage{Type: "equity", Time: now, Data: eq})
+	}
+}
+
+func (h *pushHub) count() int {
+	h.mt.Lock()
+	defer h.mt.Unlock()
+	return len(h.clients)
+}
+
+// join returns the channel a new client reads the messages f matches from
+func (h *pushHub) join(f pushFilter) chan pushMessage {
+	ch := make(chan pushMessage, 256)
+	h.mt.Lock()
+	defer h.mt.Unlock()
+	h.clients[ch] = f
+	return ch
+}
+
+func (h *pushHub) leave(ch chan pushMessage) {
+	h.mt.Lock()
+	defer h.mt.Unlock()
+	delete(h.clients, ch)
+}
+
+func (h *pushHub) publish(m pushMessage) {
+	h.mt.Lock()
+	defer h.mt.Unlock()
+	for ch, f := range h.clients {
+		if !f.match(m) {
+			continue
+		}
+		select {
+		case ch <- m:
+		default:
+		}
+	}
+}
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+
+// serveWS upgrades r to a WebSocket and pushes hub messages to it until
+// either side goes away
+func (h *pushHub) serveWS(w http.ResponseWriter, r *http.Request) {
+	f, err := parsePushFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already answered with an error
+		return
+	}
+	defer conn.Close()
+
+	msgs := h.join(f)
+	defer h.leave(msgs)
+
+	// clients send nothing, reading only notices when they close
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case m := <-msgs:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(m); err != nil {
+				log.Printf("push client %s went away: %v", r.RemoteAddr, err)
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveSSE streams hub messages as Server-Sent Events, for clients that
+// cannot open WebSockets. Each event is named after the message type.
+func (h *pushHub) serveSSE(w http.ResponseWriter, r *http.Request) {
+	f, err := parsePushFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep proxies from buffering the stream
+
+	msgs := h.join(f)
+	defer h.leave(msgs)
+
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	// comments keep idle connections from timing out
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case m := <-msgs:
+			data, err := json.Marshal(m)
+			if err != nil {
+				log.Printf("push: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", m.Type, data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/config"
+)
+
+// rateLimiter hands every client a token bucket refilled at rate per second
+// up to burst tokens. Clients are told apart by the identity their key
+// verifies as, or by address when they send no valid one.
+type rateLimiter struct {
+	mt        sync.Mutex
+	rate      float64
+	burst     float64
+	clients   map[string]*bucket
+	lastSweep time.Time
+}
+
+// maxRateClients is how many buckets are kept before idle ones are swept
+// early, addresses alone could otherwise grow the map for a minute
+const maxRateClients = 10000
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(max(burst, 1)), clients: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// allow takes a token of client, or returns how long until one is available
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mt.Lock()
+	defer l.mt.Unlock()
+	l.sweep(now)
+	b := l.clients[client]
+	if b == nil {
+		b = &bucket{tokens: l.burst, last: now}
+		l.clients[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep forgets clients idle long enough for their bucket to refill, at
+// most once a minute unless the map has grown past maxRateClients. A
+// forgotten client starts again with a full bucket, as it would have.
+// Callers must hold l.mt.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute && len(l.clients) < maxRateClients {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for c, b := range l.clients {
+		if now.Sub(b.last) > full {
+			delete(l.clients, c)
+		}
+	}
+}
+
+// clientOf names the caller of r for rate limiting: the identity its key or
+// token verifies as, else its address. Keys are checked first, so sending a
+// new made-up key with each request still draws on the address's bucket.
+func clientOf(r *http.Request, auth *authenticator) string {
+	if k := keyFromRequest(r); k != "" && auth != nil && auth.enabled() {
+		if id, err := auth.identify(k); err == nil {
+			return "id:" + id.Name
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// limitRequests caps the body size of every request and the request rate of
+// every client, answering 429 once a client runs out of tokens
+func limitRequests(h http.Handler, lc config.Limits, auth *authenticator) http.Handler {
+	var limiter *rateLimiter
+	if lc.RatePerSecond > 0 {
+		limiter = newRateLimiter(lc.RatePerSecond, lc.Burst)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limiter != nil {
+			if ok, wait := limiter.allow(clientOf(r, auth), time.Now()); !ok {
+				secs := int(math.Ceil(wait.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(max(secs, 1)))
+				writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				log.Printf("rate limited %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+				return
+			}
+		}
+		if lc.MaxBodyBytes > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, int64(lc.MaxBodyBytes))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/config"
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/notify"
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/omept/trading-engine/pkg/strategy"
+)
+
+// configChange is what a reload of the config changed
+type configChange struct {
+	Applied []string `json:"applied"`           // settings changed on the running engine
+	Restart []string `json:"restart,omitempty"` // changed settings that take effect on the next start
+}
+
+// maxConfigBytes caps the body of a config change
+const maxConfigBytes = 1 << 20
+
+// configReloader applies a changed config to the running engine: the risk
+// settings, the strategies of the config and the alert channels. Strategies
+// added through the API are left alone.
+type configReloader struct {
+	mt          sync.Mutex
+	cfg         *config.Config // the config running, restart-only changes left out
+	eng         *engine.Engine
+	db          store.Store
+	risk        *engine.FixedPercentRisk
+	alerts      *notify.Dispatcher
+	newStrategy strategyFactory
+}
+
+func newConfigReloader(cfg *config.Config, eng *engine.Engine, db store.Store, risk *engine.FixedPercentRisk, alerts *notify.Dispatcher, newStrategy strategyFactory) *configReloader {
+	return &configReloader{cfg: cfg, eng: eng, db: db, risk: risk, alerts: alerts, newStrategy: newStrategy}
+}
+
+// current returns a copy of the config running
+func (r *configReloader) current() (*config.Config, error) {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	return copyConfig(r.cfg)
+}
+
+// update decodes the JSON body over the config applied last, so it may set
+// only the settings it changes, and applies the result
+func (r *configReloader) update(body []byte, actor string) (configChange, error) {
+	next, err := r.current()
+	if err != nil {
+		return configChange{}, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(next); err != nil {
+		return configChange{}, fmt.Errorf("config: %w", err)
+	}
+	r.mt.Lock()
+	err = next.KeepSecrets(r.cfg)
+	r.mt.Unlock()
+	if err != nil {
+		return configChange{}, fmt.Errorf("config: %w", err)
+	}
+	if err := next.Validate(); err != nil {
+		return configChange{}, err
+	}
+	return r.apply(next, actor)
+}
+
+// apply moves the running engine to the validated config next. Nothing is
+// changed when next holds a strategy or alert channel that cannot be built.
+func (r *configReloader) apply(next *config.Config, actor string) (configChange, error) {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	prev := r.cfg
+
+	change := configChange{Applied: []string{}}
+	for _, key := range changedKeys(prev, next) {
+		switch key {
+		case "risk":
+			for _, k := range changedKeys(prev.Risk, next.Risk) {
+				change.Applied = append(change.Applied, "risk."+k)
+			}
+		case "strategies":
+			change.Applied = append(change.Applied, key)
+		case "notify":
+			for _, k := range changedKeys(prev.Notify, next.Notify) {
+				if k == "channels" {
+					change.Applied = append(change.Applied, "notify."+k)
+				} else {
+					change.Restart = append(change.Restart, "notify."+k)
+				}
+			}
+		default:
+			change.Restart = append(change.Restart, key)
+		}
+	}
+	if len(change.Applied) == 0 && len(change.Restart) == 0 {
+		return change, nil
+	}
+
+	// build everything that can fail first
+	prevStrats, err := r.buildStrategies(prev.Strategies)
+	if err != nil {
+		return configChange{}, err
+	}
+	nextStrats, err := r.buildStrategies(next.Strategies)
+	if err != nil {
+		return configChange{}, err
+	}
+	if !jsonEqual(prev.Notify.Channels, next.Notify.Channels) {
+		if err := r.alerts.SetChannels(next.Notify.Channels); err != nil {
+			return configChange{}, err
+		}
+	}
+
+	r.risk.SetPercent(next.Risk.FixedPercent)
+	if p := r.eng.PortfolioRisk(); p != nil {
+		p.SetLimits(next.Risk.Portfolio)
+	}
+	if k := r.eng.KillSwitch(); k != nil {
+		k.SetConfig(next.Risk.KillSwitch)
+	}
+	if p := r.eng.Protection(); p != nil {
+		p.SetConfig(next.Risk.Protection)
+	}
+	r.reconcileStrategies(prevStrats, nextStrats)
+
+	// settings that take effect on the next start are not running yet, the
+	// next change is compared against what is
+	running, err := copyConfig(prev)
+	if err != nil {
+		return configChange{}, err
+	}
+	running.Risk, running.Strategies, running.Notify.Channels = next.Risk, next.Strategies, next.Notify.Channels
+	r.cfg = running
+
+	for _, k := range change.Restart {
+		log.Printf("config: %s changed, it takes effect on the next start", k)
+	}
+	log.Printf("config: applied %v", change.Applied)
+	recordAuditAs(r.db, actor, "config.update", struct {
+		configChange
+		Risk       config.Risk     `json:"risk"`
+		Strategies []strategy.Spec `json:"strategies"`
+	}{change, next.Risk, next.Strategies})
+	return change, nil
+}
+
+// builtStrategy is a strategy of the config and the spec it was built from
+type builtStrategy struct {
+	spec     strategy.Spec
+	strategy engine.Strategy
+}
+
+// buildStrategies builds specs by strategy name
+func (r *configReloader) buildStrategies(specs []strategy.Spec) (map[string]builtStrategy, error) {
+	out := make(map[string]builtStrategy, len(specs))
+	for _, spec := range specs {
+		s, err := r.newStrategy(spec)
+		if err != nil {
+			return nil, err
+		}
+		out[s.Name()] = builtStrategy{spec, s}
+	}
+	return out, nil
+}
+
+// reconcileStrategies removes the strategies that left the config, swaps
+// the ones whose spec changed and adds the new ones
+func (r *configReloader) reconcileStrategies(prev, next map[string]builtStrategy) {
+	for name := range prev {
+		if _, ok := next[name]; ok {
+			continue
+		}
+		if _, err := r.eng.RemoveStrategy(name); err != nil {
+			log.Printf("config: %v", err)
+		}
+	}
+	for name, b := range next {
+		old, ok := prev[name]
+		switch {
+		case !ok:
+			if err := r.eng.AddStrategy(b.strategy); err != nil {
+				log.Printf("config: %v", err)
+			}
+		case !jsonEqual(old.spec, b.spec):
+			if err := r.eng.ReplaceStrategy(b.strategy); err != nil {
+				log.Printf("config: %v", err)
+			}
+		}
+	}
+}
+
+// watch reloads file whenever it is modified, checking every interval
+// until ctx is done. A file that fails to load or validate is logged and
+// the running config kept.
+func (r *configReloader) watch(ctx context.Context, file string, every time.Duration) {
+	modified := func() time.Time {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}
+		}
+		return fi.ModTime()
+	}
+	last := modified()
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		m := modified()
+		if m.IsZero() || m.Equal(last) {
+			continue
+		}
+		last = m
+		next, err := config.Load(file)
+		if err != nil {
+			log.Printf("config: %s not reloaded: %v", file, err)
+			continue
+		}
+		if _, err := r.apply(next, "config file"); err != nil {
+			log.Printf("config: %s not reloaded: %v", file, err)
+		}
+	}
+}
+
+// copyConfig returns a deep copy of c
+func copyConfig(c *config.Config) (*config.Config, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	out := &config.Config{}
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// changedKeys lists the JSON keys of a and b whose values differ, sorted
+func changedKeys(a, b interface{}) []string {
+	var ma, mb map[string]json.RawMessage
+	da, _ := json.Marshal(a)
+	db, _ := json.Marshal(b)
+	_ = json.Unmarshal(da, &ma)
+	_ = json.Unmarshal(db, &mb)
+	var keys []string
+	for k, v := range ma {
+		if !bytes.Equal(v, mb[k]) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range mb {
+		if _, ok := ma[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonEqual(a, b interface{}) bool {
+	da, _ := json.Marshal(a)
+	db, _ := json.Marshal(b)
+	return bytes.Equal(da, db)
+}
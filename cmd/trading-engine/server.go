@@ -1,51 +1,898 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/omept/trading-engine/pkg/backtest"
+	"github.com/omept/trading-engine/pkg/config"
 	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/exchange"
 	"github.com/omept/trading-engine/pkg/store"
+	"github.com/omept/trading-engine/pkg/strategy"
 	"github.com/omept/trading-engine/web/dist"
+	"github.com/shopspring/decimal"
 )
 
-func setUpAPIs(eng *engine.Engine, db *store.SQLiteStore) *http.ServeMux {
+// fundable is an exchange that simulates external deposits and withdrawals
+type fundable interface {
+	Deposit(asset string, amount decimal.Decimal, note string) (decimal.Decimal, error)
+	Withdraw(asset string, amount decimal.Decimal, note string) (decimal.Decimal, error)
+	CashFlows() []exchange.CashFlow
+}
+
+// orderView is an order as the API reports it, Order carries no json tags
+type orderView struct {
+	ID            string             `json:"id"`
+	ClientOrderID string             `json:"client_order_id,omitempty"`
+	Strategy      string             `json:"strategy"`
+	Symbol        string             `json:"symbol"`
+	Side          engine.Side        `json:"side"`
+	Type          engine.OrderType   `json:"type"`
+	Price         decimal.Decimal    `json:"price"`
+	Quantity      decimal.Decimal    `json:"quantity"`
+	FilledQty     decimal.Decimal    `json:"filled_qty"`
+	Remaining     decimal.Decimal    `json:"remaining"`
+	Status        engine.OrderStatus `json:"status"`
+	TimeInForce   engine.TimeInForce `json:"time_in_force,omitempty"`
+	ExpireAt      *time.Time         `json:"expire_at,omitempty"`
+}
+
+func viewOrder(o engine.Order) orderView {
+	v := orderView{ID: o.ID, ClientOrderID: o.ClientOrderID, Strategy: o.Strategy, Symbol: o.Symbol, Side: o.Side, Type: o.Type,
+		Price: o.Price, Quantity: o.Quantity, FilledQty: o.FilledQty, Remaining: o.Remaining(), Status: o.Status, TimeInForce: o.TimeInForce}
+	if !o.ExpireAt.IsZero() {
+		v.ExpireAt = &o.ExpireAt
+	}
+	return v
+}
+
+// algoOrderView is a parent order of the execution algorithm and its children
+type algoOrderView struct {
+	orderView
+	AvgPrice decimal.Decimal `json:"avg_price"` // of the children's fills
+	Fee      decimal.Decimal `json:"fee"`
+	Method   string          `json:"method"`
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	Children []orderView     `json:"children"`
+}
+
+func viewAlgoOrder(a engine.AlgoOrder) algoOrderView {
+	v := algoOrderView{orderView: viewOrder(a.Order), AvgPrice: a.FilledPrice, Fee: a.Fee, Method: a.Method, Start: a.Start, End: a.End, Children: []orderView{}}
+	for _, c := range a.Children {
+		v.Children = append(v.Children, viewOrder(c))
+	}
+	return v
+}
+
+// bracketView is an entry order and the stop-loss and take-profit protecting its fill
+type bracketView struct {
+	Entry      orderView       `json:"entry"`
+	StopLoss   decimal.Decimal `json:"stop_loss"`
+	TakeProfit decimal.Decimal `json:"take_profit"`
+	Quantity   decimal.Decimal `json:"quantity"` // protected, what the entry filled
+	Armed      bool            `json:"armed"`
+	Native     bool            `json:"native"` // an OCO pair resting on the exchange
+	StopID     string          `json:"stop_id,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Exiting    string          `json:"exiting,omitempty"`
+}
+
+func viewBracket(b engine.BracketOrder) bracketView {
+	return bracketView{Entry: viewOrder(b.Entry), StopLoss: b.Bracket.StopLoss, TakeProfit: b.Bracket.TakeProfit, Quantity: b.Quantity,
+		Armed: b.Armed, Native: b.Native, StopID: b.StopID, TargetID: b.TargetID, Exiting: b.Exiting}
+}
+
+// strategyInfo describes a registered strategy and its current params
+type strategyInfo struct {
+	Name       string          `json:"name"`
+	Type       string          `json:"type,omitempty"`
+	Symbol     string          `json:"symbol"`
+	Interval   int64           `json:"interval"` // candle size in seconds
+	AccountUSD decimal.Decimal `json:"account_usd"`
+	Params     json.RawMessage `json:"params,omitempty"` // of strategies that can be tuned
+	SignalOnly bool            `json:"signal_only,omitempty"`
+}
+
+func viewStrategy(s engine.Strategy) strategyInfo {
+	info := strategyInfo{Name: s.Name(), Type: strategy.TypeOf(s), Symbol: s.Symbol(), Interval: s.Interval(), AccountUSD: s.AccountBalUSD()}
+	if t, ok := s.(strategy.Tunable); ok {
+		info.Params = t.Params()
+	}
+	if so, ok := s.(engine.SignalOnlyStrategy); ok {
+		info.SignalOnly = so.SignalOnly()
+	}
+	return info
+}
+
+// exchangeFactory builds an exchange adapter by name (MOCK | BINANCE | ALPACA)
+type exchangeFactory func(name string) (engine.ExchangeAdapter, error)
+
+// strategyFactory builds a strategy instance from its spec
+type strategyFactory func(spec strategy.Spec) (engine.Strategy, error)
+
+func setUpAPIs(eng *engine.Engine, db store.Store, cfg *config.Config, auth *authenticator, newExchange exchangeFactory, newStrategy strategyFactory, reloader *configReloader) *http.ServeMux {
 
 	mux := http.NewServeMux()
 
+	backtests := newBacktestJobs(func(ctx context.Context, req backtestRequest, progress func(done, total int)) ([]byte, error) {
+		return runBacktest(ctx, req, progress, eng, db)
+	})
+
 	// Minimal web UI
 	mux.Handle("/", http.FileServer(http.FS(dist.WebDist)))
 
 	// REST endpoints
-	mux.HandleFunc("/api/start", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/start", auth.require(roleOperator, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			writeError(w, http.StatusMethodNotAllowed, "")
 			return
 		}
 		ctx := r.Context()
 		go eng.Start(ctx)
+		recordAudit(db, r, "engine.start", nil)
 		w.WriteHeader(http.StatusAccepted)
 		w.Write([]byte("started"))
-	})
+	}))
 
-	mux.HandleFunc("/api/stop", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/stop", auth.require(roleOperator, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			writeError(w, http.StatusMethodNotAllowed, "")
 			return
 		}
 		eng.Stop()
+		recordAudit(db, r, "engine.stop", nil)
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("stopped"))
-	})
+	}))
+
+	mux.HandleFunc("GET /api/exchange", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"exchange": eng.ExchangeAdapter().AdapterName()})
+	}))
+
+	mux.HandleFunc("POST /api/exchange", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Exchange string `json:"exchange"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Exchange == "" {
+			writeError(w, http.StatusBadRequest, `body must be {"exchange": "MOCK|BINANCE|ALPACA|COINBASE|OANDA"}`)
+			return
+		}
+		from := eng.ExchangeAdapter().AdapterName()
+		x, err := newExchange(strings.ToUpper(req.Exchange))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := eng.SwapExchangeAdapter(r.Context(), x); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		recordAudit(db, r, "exchange.swap", map[string]string{"from": from, "to": x.AdapterName()})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"exchange": x.AdapterName()})
+	}))
+
+	mux.HandleFunc("GET /api/exchange/cashflows", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		funds, ok := eng.ExchangeAdapter().(fundable)
+		if !ok {
+			writeError(w, http.StatusConflict, "deposits and withdrawals are only simulated on the mock exchange")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(funds.CashFlows())
+	}))
+
+	mux.HandleFunc("POST /api/exchange/{op}", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		op := r.PathValue("op")
+		if op != "deposit" && op != "withdraw" {
+			writeError(w, http.StatusNotFound, "unknown operation "+op)
+			return
+		}
+		funds, ok := eng.ExchangeAdapter().(fundable)
+		if !ok {
+			writeError(w, http.StatusConflict, "deposits and withdrawals are only simulated on the mock exchange")
+			return
+		}
+		var req struct {
+			Asset    string          `json:"asset"`
+			Amount   decimal.Decimal `json:"amount"`
+			Strategy string          `json:"strategy"` // optionally move the strategy's capital too
+			Note     string          `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Asset == "" {
+			req.Asset = "USD"
+		}
+
+		var strat engine.Strategy
+		if req.Strategy != "" {
+			for _, s := range eng.Strategies() {
+				if s.Name() == req.Strategy {
+					strat = s
+				}
+			}
+			if strat == nil {
+				writeError(w, http.StatusNotFound, "unknown strategy "+req.Strategy)
+				return
+			}
+		}
+
+		var bal decimal.Decimal
+		var err error
+		if op == "deposit" {
+			bal, err = funds.Deposit(req.Asset, req.Amount, req.Note)
+		} else {
+			bal, err = funds.Withdraw(req.Asset, req.Amount, req.Note)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if strat != nil {
+			delta := req.Amount
+			if op == "withdraw" {
+				delta = delta.Neg()
+			}
+			strat.SetAccountUSD(strat.AccountBalUSD().Add(delta))
+		}
+		recordAudit(db, r, "exchange."+op, req)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"asset": strings.ToUpper(req.Asset), "balance": bal})
+	}))
+
+	mux.HandleFunc("GET /api/exchange/margin", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		mock, ok := eng.ExchangeAdapter().(*exchange.MockExchange)
+		if !ok {
+			writeError(w, http.StatusConflict, "margin is only simulated on the mock exchange")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(mock.Margin())
+	}))
+
+	mux.HandleFunc("PUT /api/exchange/margin", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		mock, ok := eng.ExchangeAdapter().(*exchange.MockExchange)
+		if !ok {
+			writeError(w, http.StatusConflict, "margin is only simulated on the mock exchange")
+			return
+		}
+		var cfg exchange.MarginConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		mock.SetMargin(cfg)
+		recordAudit(db, r, "margin.update", cfg)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(mock.Margin())
+	}))
+
+	mux.HandleFunc("GET /api/exchange/fills", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		mock, ok := eng.ExchangeAdapter().(interface{ FillModel() exchange.FillModel })
+		if !ok {
+			writeError(w, http.StatusConflict, "fees and slippage are only simulated on the mock, replay and paper exchanges")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(mock.FillModel())
+	}))
+
+	mux.HandleFunc("PUT /api/exchange/fills", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		mock, ok := eng.ExchangeAdapter().(interface {
+			FillModel() exchange.FillModel
+			SetFillModel(exchange.FillModel)
+		})
+		if !ok {
+			writeError(w, http.StatusConflict, "fees and slippage are only simulated on the mock, replay and paper exchanges")
+			return
+		}
+		var f exchange.FillModel
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := f.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		mock.SetFillModel(f)
+		recordAudit(db, r, "fills.update", f)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(mock.FillModel())
+	}))
+
+	mux.HandleFunc("GET /api/chaos", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		mock, ok := eng.ExchangeAdapter().(*exchange.MockExchange)
+		if !ok {
+			writeError(w, http.StatusConflict, "chaos testing is only available on the mock exchange")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(mock.Chaos())
+	}))
+
+	mux.HandleFunc("PUT /api/chaos", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		mock, ok := eng.ExchangeAdapter().(*exchange.MockExchange)
+		if !ok {
+			writeError(w, http.StatusConflict, "chaos testing is only available on the mock exchange")
+			return
+		}
+		var cfg exchange.ChaosConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		mock.SetChaos(cfg)
+		recordAudit(db, r, "chaos.update", cfg)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(cfg)
+	}))
+
+	mux.HandleFunc("GET /api/strategies", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		out := []strategyInfo{}
+		for _, s := range eng.Strategies() {
+			out = append(out, viewStrategy(s))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+
+	// change params of a strategy while it trades, params left out keep
+	// their value, e.g. {"short": 12} or {"k": 2.5}
+	mux.HandleFunc("PATCH /api/strategies/{name}/params", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		var s engine.Strategy
+		for _, x := range eng.Strategies() {
+			if x.Name() == name {
+				s = x
+				break
+			}
+		}
+		if s == nil {
+			writeError(w, http.StatusNotFound, "unknown strategy "+name)
+			return
+		}
+		t, ok := s.(strategy.Tunable)
+		if !ok {
+			writeError(w, http.StatusConflict, "strategy "+name+" has no params to tune")
+			return
+		}
+		var params json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := t.SetParams(params); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		recordAudit(db, r, "strategy.params", map[string]interface{}{"name": name, "params": params})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(viewStrategy(s))
+	}))
+
+	// add a strategy instance, it starts trading right away on a running engine
+	mux.HandleFunc("POST /api/strategies", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		var spec strategy.Spec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s, err := newStrategy(spec)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := eng.AddStrategy(s); err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		recordAudit(db, r, "strategy.add", spec)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"name": s.Name(), "symbol": s.Symbol()})
+	}))
+
+	// remove a strategy instance, its open orders are left working
+	mux.HandleFunc("DELETE /api/strategies/{id}", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		s, err := eng.RemoveStrategy(id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		recordAudit(db, r, "strategy.remove", map[string]string{"name": s.Name(), "symbol": s.Symbol()})
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// orders still working on the exchange and how much of each is left to fill
+	mux.HandleFunc("GET /api/orders/open", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		out := []orderView{}
+		if t, ok := eng.OrderManager().(interface{ OpenOrders() []engine.Order }); ok {
+			for _, o := range t.OpenOrders() {
+				out = append(out, viewOrder(o))
+			}
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+
+	// orders submitted while their market was closed, placed at its next open
+	mux.HandleFunc("GET /api/orders/queued", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		out := []orderView{}
+		if q, ok := eng.OrderManager().(interface{ QueuedOrders() []engine.Order }); ok {
+			for _, o := range q.QueuedOrders() {
+				out = append(out, viewOrder(o))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+
+	// takes an order off the queue for the market open by its client order id
+	mux.HandleFunc("POST /api/orders/queued/{id}/cancel", auth.require(roleOperator, func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		q, ok := eng.OrderManager().(interface {
+			CancelQueued(string) (engine.Order, bool)
+		})
+		if !ok {
+			writeError(w, http.StatusNotFound, "no order "+id+" is queued")
+			return
+		}
+		o, ok := q.CancelQueued(id)
+		if !ok {
+			writeError(w, http.StatusNotFound, "no order "+id+" is queued")
+			return
+		}
+		recordAudit(db, r, "order.queued.cancel", map[string]string{"client_order_id": id})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(viewOrder(o))
+	}))
+
+	// parent orders of the execution algorithm, being worked or finished last,
+	// with their children
+	mux.HandleFunc("GET /api/orders/algo", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		out := []algoOrderView{}
+		if a, ok := eng.OrderManager().(interface{ AlgoOrders() []engine.AlgoOrder }); ok {
+			for _, o := range a.AlgoOrders() {
+				out = append(out, viewAlgoOrder(o))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+
+	// bracketed entries and the legs protecting their fills, until one of the legs exits
+	mux.HandleFunc("GET /api/orders/brackets", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		out := []bracketView{}
+		if b, ok := eng.OrderManager().(interface{ BracketOrders() []engine.BracketOrder }); ok {
+			for _, o := range b.BracketOrders() {
+				out = append(out, viewBracket(o))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+
+	// stops a parent order placing children and cancels its resting ones
+	mux.HandleFunc("POST /api/orders/algo/{id}/cancel", auth.require(roleOperator, func(w http.ResponseWriter, r *http.Request) {
+		a, ok := eng.OrderManager().(interface {
+			CancelAlgo(context.Context, string) (engine.AlgoOrder, error)
+		})
+		if !ok {
+			writeError(w, http.StatusNotFound, "the order manager has no execution algorithm")
+			return
+		}
+		id := r.PathValue("id")
+		o, err := a.CancelAlgo(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		recordAudit(db, r, "order.algo.cancel", map[string]string{"id": id})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(viewAlgoOrder(o))
+	}))
+
+	// orders resting on the exchange, of ?symbol= or every traded symbol, to
+	// reconcile against what the order manager tracks
+	mux.HandleFunc("GET /api/orders/exchange", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		type restingOrder struct {
+			orderView
+			Tracked bool `json:"tracked"`
+		}
+		tracked := map[string]engine.Order{}
+		if t, ok := eng.OrderManager().(interface{ OpenOrders() []engine.Order }); ok {
+			for _, o := range t.OpenOrders() {
+				tracked[o.ID] = o
+			}
+		}
+		symbols := []string{}
+		if s := r.URL.Query().Get("symbol"); s != "" {
+			symbols = append(symbols, s)
+		} else {
+			seen := map[string]bool{}
+			for _, s := range eng.Strategies() {
+				if !seen[s.Symbol()] {
+					seen[s.Symbol()] = true
+					symbols = append(symbols, s.Symbol())
+				}
+			}
+		}
+
+		out := []restingOrder{}
+		x := eng.ExchangeAdapter()
+		for _, symbol := range symbols {
+			resting, err := x.GetOpenOrders(r.Context(), symbol)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, fmt.Sprintf("list %s orders on %s: %v", symbol, x.AdapterName(), err))
+				return
+			}
+			for _, o := range resting {
+				t, ok := tracked[o.ID]
+				if ok {
+					o.Strategy = t.Strategy
+				}
+				out = append(out, restingOrder{orderView: viewOrder(o), Tracked: ok})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+
+	// positions of every strategy with their realized and unrealized PnL,
+	// ?signals=true for the paper positions of signal-only strategies
+	mux.HandleFunc("GET /api/positions", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		name, symbol, side := q.Get("strategy"), strings.ToUpper(q.Get("symbol")), strings.ToLower(q.Get("side"))
+		switch side {
+		case "", "long", "short", "flat":
+		default:
+			writeError(w, http.StatusBadRequest, "side must be long, short or flat")
+			return
+		}
+		limit, offset := pageParams(q)
+
+		pm := eng.Positions()
+		if q.Get("signals") == "true" {
+			pm = eng.SignalPositions()
+		}
+		positions := []engine.StrategyPosition{}
+		for _, p := range pm.Positions() {
+			if name != "" && p.Strategy != name || symbol != "" && p.Symbol != symbol {
+				continue
+			}
+			if side == "long" && !p.Quantity.IsPositive() || side == "short" && !p.Quantity.IsNegative() || side == "flat" && !p.Quantity.IsZero() {
+				continue
+			}
+			positions = append(positions, p)
+		}
+		symbols := []engine.SymbolPnL{}
+		for _, s := range pm.Symbols() {
+			if symbol == "" || s.Symbol == symbol {
+				symbols = append(symbols, s)
+			}
+		}
+		total := len(positions)
+		positions = positions[min(offset, total):min(offset+limit, total)]
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"total":     total,
+			"limit":     limit,
+			"offset":    offset,
+			"positions": positions,
+			"symbols":   symbols,
+		})
+	}))
+
+	// realized plus unrealized PnL at the last prices, of one symbol or all
+	mux.HandleFunc("GET /api/pnl", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		symbol := strings.ToUpper(r.URL.Query().Get("symbol"))
+		type symbolPnL struct {
+			engine.SymbolPnL
+			PnL       decimal.Decimal `json:"pnl"`
+			MarkPrice decimal.Decimal `json:"mark_price"`
+		}
+		var total equityView
+		symbols := []symbolPnL{}
+		for _, s := range eng.Positions().Symbols() {
+			if symbol != "" && s.Symbol != symbol {
+				continue
+			}
+			mark, _ := eng.Prices().LastPrice(s.Symbol)
+			symbols = append(symbols, symbolPnL{s, s.Realized.Add(s.Unrealized), mark})
+			total.Realized = total.Realized.Add(s.Realized)
+			total.Unrealized = total.Unrealized.Add(s.Unrealized)
+		}
+		total.PnL = total.Realized.Add(total.Unrealized)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			equityView
+			Symbols []symbolPnL `json:"symbols"`
+		}{total, symbols})
+	}))
+
+	// account equity samples between from and to, the last day by default
+	mux.HandleFunc("GET /api/equity", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		to, err := parseTimeParam(q.Get("to"), time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		from, err := parseTimeParam(q.Get("from"), to.Add(-24*time.Hour))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		points, err := db.LoadEquity(from, to)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		current, err := eng.Equity(r.Context())
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"from":    from.UTC(),
+			"to":      to.UTC(),
+			"current": current,
+			"points":  points,
+		})
+	}))
+
+	// flatten positions by hand with offsetting market orders, one per
+	// strategy holding the symbol
+	closePositions := func(w http.ResponseWriter, r *http.Request, symbol string) {
+		om := eng.OrderManager()
+		if om == nil {
+			writeError(w, http.StatusServiceUnavailable, "no order manager is running")
+			return
+		}
+		orders := eng.Positions().CloseOrders(symbol)
+		if len(orders) == 0 {
+			writeError(w, http.StatusNotFound, "no open position to close")
+			return
+		}
+		type closeResult struct {
+			orderView
+			Error string `json:"error,omitempty"`
+		}
+		results := make([]closeResult, 0, len(orders))
+		failed := 0
+		for _, o := range orders {
+			placed, err := om.Submit(r.Context(), o)
+			if err != nil {
+				log.Printf("could not close %s %s of %s: %v", o.Quantity, o.Symbol, o.Strategy, err)
+				results = append(results, closeResult{viewOrder(o), err.Error()})
+				failed++
+				continue
+			}
+			results = append(results, closeResult{orderView: viewOrder(placed)})
+		}
+		action := "positions.close_all"
+		if symbol != "" {
+			action = "positions.close"
+		}
+		recordAudit(db, r, action, map[string]interface{}{"symbol": symbol, "orders": len(orders), "failed": failed})
+		w.Header().Set("Content-Type", "application/json")
+		if failed > 0 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"orders": results, "failed": failed})
+	}
+
+	mux.HandleFunc("POST /api/positions/{symbol}/close", auth.require(roleOperator, func(w http.ResponseWriter, r *http.Request) {
+		closePositions(w, r, strings.ToUpper(r.PathValue("symbol")))
+	}))
+
+	mux.HandleFunc("POST /api/positions/close-all", auth.require(roleOperator, func(w http.ResponseWriter, r *http.Request) {
+		closePositions(w, r, "")
+	}))
+
+	// order history, newest first, or the children of ?parent=
+	mux.HandleFunc("GET /api/orders", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		f, err := historyFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		f.Status = strings.ToUpper(r.URL.Query().Get("status"))
+		f.Parent = r.URL.Query().Get("parent")
+		items, total, err := db.ListOrders(f)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Total  int64               `json:"total"`
+			Limit  int                 `json:"limit"`
+			Offset int                 `json:"offset"`
+			Items  []store.OrderRecord `json:"items"`
+		}{total, f.Limit, f.Offset, items})
+	}))
+
+	// parent orders of the execution algorithm and of order splitting,
+	// newest first, filtered like orders
+	mux.HandleFunc("GET /api/orders/parents", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		f, err := historyFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		f.Status = strings.ToUpper(r.URL.Query().Get("status"))
+		items, total, err := db.ListParentOrders(f)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Total  int64                     `json:"total"`
+			Limit  int                       `json:"limit"`
+			Offset int                       `json:"offset"`
+			Items  []store.ParentOrderRecord `json:"items"`
+		}{total, f.Limit, f.Offset, items})
+	}))
+
+	// trade (fill) history, newest first
+	mux.HandleFunc("GET /api/trades", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		f, err := historyFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		items, total, err := db.ListTrades(f)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Total  int64               `json:"total"`
+			Limit  int                 `json:"limit"`
+			Offset int                 `json:"offset"`
+			Items  []store.TradeRecord `json:"items"`
+		}{total, f.Limit, f.Offset, items})
+	}))
+
+	// signals of signal-only strategies, filtered like trades
+	mux.HandleFunc("GET /api/signals", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		f, err := historyFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		items, total, err := db.ListSignals(f)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Total  int64                `json:"total"`
+			Limit  int                  `json:"limit"`
+			Offset int                  `json:"offset"`
+			Items  []store.SignalRecord `json:"items"`
+		}{total, f.Limit, f.Offset, items})
+	}))
+
+	// stop-loss and take-profit levels of every open position
+	mux.HandleFunc("GET /api/protection", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		p := eng.Protection()
+		if p == nil {
+			writeError(w, http.StatusNotFound, "position protection is not enabled")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"config":   p.Config(),
+			"brackets": p.Brackets(),
+		})
+	}))
+
+	mux.HandleFunc("GET /api/exposure", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		p := eng.PortfolioRisk()
+		if p == nil {
+			writeError(w, http.StatusNotFound, "portfolio limits are not enabled")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"limits":    p.Limits(),
+			"exposures": p.Exposures(),
+		})
+	}))
+
+	mux.HandleFunc("GET /api/killswitch", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		k := eng.KillSwitch()
+		if k == nil {
+			writeError(w, http.StatusNotFound, "kill switch is not enabled")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(k.Status())
+	}))
+
+	// re-arm a tripped kill switch and resume feeding the strategies
+	mux.HandleFunc("POST /api/killswitch/reset", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		k := eng.KillSwitch()
+		if k == nil {
+			writeError(w, http.StatusNotFound, "kill switch is not enabled")
+			return
+		}
+		before := k.Status()
+		k.Reset()
+		eng.Resume()
+		recordAudit(db, r, "killswitch.reset", map[string]interface{}{"was_tripped": before.Tripped, "reason": before.Reason, "pnl": before.PnL})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(k.Status())
+	}))
 
-	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("GET /api/reconcile", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		rc := eng.Reconciler()
+		if rc == nil {
+			writeError(w, http.StatusNotFound, "reconciliation is not enabled")
+			return
+		}
+		last := rc.Last()
+		if last == nil {
+			writeError(w, http.StatusNotFound, "no reconciliation has run yet")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(last)
+	}))
+
+	// reconcile with the exchange now instead of waiting for the next pass
+	mux.HandleFunc("POST /api/reconcile", auth.require(roleOperator, func(w http.ResponseWriter, r *http.Request) {
+		rep, err := eng.Reconcile(r.Context())
+		if err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		recordAudit(db, r, "reconcile", map[string]interface{}{"discrepancies": len(rep.Discrepancies)})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rep)
+	}))
+
+	mux.HandleFunc("/api/status", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
 		st := eng.Status()
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(st)
-	})
+	}))
+
+	// live engine events for the web UI, over a WebSocket or Server-Sent
+	// Events where WebSockets are blocked. ?types=order,fill&symbol=BTCUSD filters them.
+	push := newPushHub(eng)
+	mux.HandleFunc("GET /api/ws", auth.require(roleViewer, push.serveWS))
+	mux.HandleFunc("GET /api/events", auth.require(roleViewer, push.serveSSE))
 
-	mux.HandleFunc("/api/metrics", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/metrics", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
 		// simple metrics from store: counts of orders/trades/runs
 		metrics := map[string]int64{}
 		orders, _ := db.CountOrders()
@@ -54,57 +901,659 @@ func setUpAPIs(eng *engine.Engine, db *store.SQLiteStore) *http.ServeMux {
 		metrics["orders"] = orders
 		metrics["trades"] = trades
 		metrics["runs"] = runs
+		var dropped int64
+		for _, f := range eng.FeedStats() {
+			dropped += f.Dropped
+		}
+		metrics["candles_dropped"] = dropped
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(metrics)
-	})
+	}))
+
+	// the same numbers and the exchange's health in the Prometheus format,
+	// scrapers send their API key as a bearer token
+	mux.HandleFunc("GET /metrics", auth.require(roleViewer, servePrometheus(eng, db)))
 
-	mux.HandleFunc("/api/candles", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/feeds", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(eng.FeedStats())
+	}))
+
+	mux.HandleFunc("/api/prices", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(eng.Prices().Quotes())
+	}))
+
+	mux.HandleFunc("/api/candles", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
 		symbol := r.URL.Query().Get("symbol")
 		if symbol == "" {
 			symbol = "BTCUSD"
 		}
+		interval := r.URL.Query().Get("interval")
+		if interval == "" {
+			interval = "1m"
+		}
+		step, err := engine.ParseInterval(interval)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		limit := 100
-		candles, err := db.LoadCandles(symbol, limit)
+		candles, err := db.LoadCandles(symbol, int64(step/time.Second), limit)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
+			writeError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(candles)
-	})
+	}))
+
+	mux.HandleFunc("/api/chart", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "")
+			return
+		}
+		q := r.URL.Query()
+		symbol := q.Get("symbol")
+		if symbol == "" {
+			symbol = "BTCUSD"
+		}
+		interval := q.Get("interval")
+		if interval == "" {
+			interval = "1m"
+		}
+		step, err := engine.ParseInterval(interval)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		to, err := parseTimeParam(q.Get("to"), time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+			return
+		}
+		// default window holds 500 bars of the requested interval
+		from, err := parseTimeParam(q.Get("from"), to.Add(-500*step))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+			return
+		}
+
+		// candles retention rolled up to the interval chart too
+		rows, err := db.LoadCandleHistory(symbol, int64(step/time.Second), from, to)
+		if err == nil && len(rows) == 0 && step > time.Minute {
+			// no candles stored at the interval, build them from minute candles
+			rows, err = db.LoadCandlesBetween(symbol, engine.DefaultCandleInterval, from, to)
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		trades, err := db.LoadTradesBetween(symbol, from, to)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		orders, err := db.LoadOpenOrders(symbol, to)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
 
-	mux.HandleFunc("/api/backtest", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Symbol   string              `json:"symbol"`
+			Interval string              `json:"interval"`
+			From     time.Time           `json:"from"`
+			To       time.Time           `json:"to"`
+			Candles  []engine.Candle     `json:"candles"`
+			Trades   []store.TradeRecord `json:"trades"`
+			Orders   []store.OrderRecord `json:"orders"`
+		}{
+			Symbol:   symbol,
+			Interval: interval,
+			From:     from,
+			To:       to,
+			Candles:  engine.ResampleCandles(candlesFromRows(rows), step),
+			Trades:   trades,
+			Orders:   orders,
+		})
+	}))
+
+	mux.HandleFunc("/api/backtest", auth.require(roleOperator, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			w.Write([]byte("method not allowed, use POST"))
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed, use POST")
 			return
 		}
 
 		// Read query parameters or JSON body (here using query params for simplicity)
-		which := r.URL.Query().Get("strategy") // ema | mean | all
+		which := r.URL.Query().Get("strategy") // ema | mean | strategy name | all
 		if which == "" {
 			which = "all"
 		}
-		symbol := r.URL.Query().Get("symbol")
+		symbol := r.URL.Query().Get("symbol") // all backtests the strategies of every symbol as one portfolio
 		if symbol == "" {
 			symbol = "BTCUSD"
 		}
 
-		// Optional: start/end for future range selection
+		// optional candle range, the whole stored history by default
 		start := r.URL.Query().Get("start")
 		end := r.URL.Query().Get("end")
-		if start == "" || end == "" {
-			// default: ignore or use entire DB range
+		from, err := parseTimeParam(start, time.Time{})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid start: "+err.Error())
+			return
+		}
+		to, err := parseTimeParam(end, time.Time{})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid end: "+err.Error())
+			return
+		}
+		if !from.IsZero() && !to.IsZero() && to.Before(from) {
+			writeError(w, http.StatusBadRequest, "end is before start")
+			return
 		}
 
-		log.Println("Running backtest via API:", which, symbol)
-		statsJSON := runBacktest(which, symbol, eng, db)
+		// fees and slippage, each field defaults to the configured fill model
+		fills := cfg.Backtest.Fills
+		for param, v := range map[string]*float64{
+			"maker_bps":  &fills.MakerBps,
+			"taker_bps":  &fills.TakerBps,
+			"spread_bps": &fills.SpreadBps,
+			"impact_bps": &fills.ImpactBps,
+		} {
+			if s := r.URL.Query().Get(param); s != "" {
+				f, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, "invalid "+param+": "+err.Error())
+					return
+				}
+				*v = f
+			}
+		}
+		if s := r.URL.Query().Get("slippage"); s != "" {
+			fills.Slippage = s
+		}
+		if err := fills.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 
+		// Monte Carlo analysis of the trades, mc_runs=0 skips it
+		mc := cfg.Backtest.MonteCarlo
+		if s := r.URL.Query().Get("mc_runs"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid mc_runs: "+err.Error())
+				return
+			}
+			mc.Runs = n
+		}
+		if s := r.URL.Query().Get("mc_slippage_bps"); s != "" {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid mc_slippage_bps: "+err.Error())
+				return
+			}
+			mc.SlippageBps = f
+		}
+		if err := mc.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		job := backtests.start(backtestRequest{
+			Strategy:   which,
+			Symbol:     symbol,
+			From:       from,
+			To:         to,
+			Balance:    cfg.Backtest.USDBalance,
+			Fills:      fills,
+			MonteCarlo: mc,
+		})
+		log.Println("Queued backtest via API:", job.ID, which, symbol)
+		recordAudit(db, r, "backtest.run", map[string]interface{}{
+			"id":       job.ID,
+			"strategy": which,
+			"symbol":   symbol,
+			"start":    start,
+			"end":      end,
+			"fills":    fills,
+			"mc":       mc,
+		})
+
+		// the job runs in the background, poll GET /api/backtests/{id}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(statsJSON)
-	})
+		w.Header().Set("Location", "/api/backtests/"+job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(job)
+	}))
+
+	// grid search of a strategy's params over stored candles, best first
+	mux.HandleFunc("POST /api/backtest/optimize", auth.require(roleOperator, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Spec    strategy.Spec                  `json:"spec"`
+			Grid    map[string]backtest.ParamRange `json:"grid"` // e.g. {"short": {"min": 5, "max": 15, "step": 1}}
+			Rank    string                         `json:"rank"` // sharpe, final_equity or return_over_drawdown
+			Top     int                            `json:"top"`
+			Workers int                            `json:"workers"`
+			Start   string                         `json:"start"`
+			End     string                         `json:"end"`
+			Fills   *exchange.FillModel            `json:"fills"` // the configured fill model when unset
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Spec.Symbol == "" {
+			req.Spec.Symbol = "BTCUSD"
+		}
+		if req.Spec.Capital <= 0 {
+			req.Spec.Capital = cfg.Backtest.USDBalance
+		}
+		from, err := parseTimeParam(req.Start, time.Time{})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid start: "+err.Error())
+			return
+		}
+		to, err := parseTimeParam(req.End, time.Time{})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid end: "+err.Error())
+			return
+		}
+		fills := cfg.Backtest.Fills
+		if req.Fills != nil {
+			fills = *req.Fills
+		}
+		if err := fills.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		end := to
+		if end.IsZero() {
+			end = time.Now()
+		}
+		interval, err := specInterval(req.Spec)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		rows, err := db.LoadCandlesBetween(req.Spec.Symbol, interval, from, end)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(rows) == 0 {
+			writeError(w, http.StatusNotFound, "no candles found for "+req.Spec.Symbol)
+			return
+		}
+
+		recordAudit(db, r, "backtest.optimize", req)
+		rep, err := backtest.Optimize(r.Context(), candlesFromRows(rows), backtest.OptimizeConfig{
+			Spec:        req.Spec,
+			Grid:        req.Grid,
+			Rank:        req.Rank,
+			Top:         req.Top,
+			Workers:     req.Workers,
+			Balance:     decimal.NewFromFloat(cfg.Backtest.USDBalance),
+			Fills:       fills,
+			From:        from,
+			To:          to,
+			NewStrategy: newStrategy,
+		})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("Optimized %s %s over %d combinations in %s", req.Spec.Type, req.Spec.Symbol, rep.Combos, rep.Duration.Round(time.Millisecond))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rep)
+	}))
+
+	// live runs of the engine from Start to Stop, newest first
+	mux.HandleFunc("GET /api/runs", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		limit, offset := pageParams(r.URL.Query())
+		items, total, err := db.ListRuns(limit, offset)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Total  int64             `json:"total"`
+			Limit  int               `json:"limit"`
+			Offset int               `json:"offset"`
+			Items  []store.RunRecord `json:"items"`
+		}{total, limit, offset, items})
+	}))
+
+	mux.HandleFunc("GET /api/backtests", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit := 20
+		if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 && l <= 200 {
+			limit = l
+		}
+		offset := 0
+		if o, err := strconv.Atoi(q.Get("offset")); err == nil && o >= 0 {
+			offset = o
+		}
+		sortBy := q.Get("sort")
+		if sortBy == "" {
+			sortBy = "created_at"
+		}
+		if !store.BacktestSortable(sortBy) {
+			writeError(w, http.StatusBadRequest, "unsupported sort metric: "+sortBy)
+			return
+		}
+		desc := q.Get("order") != "asc"
+
+		items, total, err := db.ListBacktests(sortBy, desc, limit, offset)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			Total  int64                  `json:"total"`
+			Limit  int                    `json:"limit"`
+			Offset int                    `json:"offset"`
+			Items  []store.BacktestRecord `json:"items"`
+		}{total, limit, offset, items})
+	}))
+
+	// a backtest job's status and progress, with its stats once done.
+	// Backtests older than the jobs kept in memory are read from the store.
+	mux.HandleFunc("GET /api/backtests/{id}", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if job, ok := backtests.get(id); ok {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(job)
+			return
+		}
+		stats, err := db.LoadBacktestStats(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "backtest not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(backtestJob{ID: id, Status: jobDone, Progress: 100, Result: stats})
+	}))
+
+	// a stored backtest as a self-contained HTML report
+	mux.HandleFunc("GET /api/backtests/{id}/report.html", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		raw, err := db.LoadBacktestStats(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "backtest not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		var stats backtest.BacktestStats
+		if err := json.Unmarshal(raw, &stats); err != nil {
+			writeError(w, http.StatusInternalServerError, "stored backtest: "+err.Error())
+			return
+		}
+		var page bytes.Buffer
+		if err := backtest.WriteReport(&page, &stats); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+"_report.html"))
+		w.Write(page.Bytes())
+	}))
+
+	mux.HandleFunc("POST /api/backtests/{id}/cancel", auth.require(roleOperator, func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		err := backtests.cancel(id)
+		if errors.Is(err, errJobFinished) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		recordAudit(db, r, "backtest.cancel", map[string]string{"id": id})
+		job, _ := backtests.get(id)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(job)
+	}))
+
+	// the trade log of a backtest, one closed round trip per row
+	mux.HandleFunc("GET /api/backtests/{id}/trades.csv", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, err := db.LoadBacktestStats(id); errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "backtest not found")
+			return
+		}
+		trades, err := db.LoadBacktestTrades(id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+"_trades.csv"))
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"strategy", "side", "entry_time", "exit_time", "entry_price", "exit_price", "quantity", "pnl", "holding_sec"})
+		f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+		for _, t := range trades {
+			_ = cw.Write([]string{
+				t.Strategy, t.Side, t.EntryTime.UTC().Format(time.RFC3339), t.ExitTime.UTC().Format(time.RFC3339),
+				f(t.EntryPrice), f(t.ExitPrice), f(t.Quantity), f(t.PnL), f(t.Holding),
+			})
+		}
+		cw.Flush()
+	}))
+
+	mux.HandleFunc("POST /api/snapshots", auth.require(roleOperator, func(w http.ResponseWriter, r *http.Request) {
+		snap, err := eng.Snapshot(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		recordAudit(db, r, "engine.snapshot", map[string]string{"id": snap.ID})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(snap)
+	}))
+
+	mux.HandleFunc("GET /api/snapshots/{id}", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		data, err := db.LoadSnapshot(r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "snapshot not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+
+	mux.HandleFunc("POST /api/snapshots/{id}/restore", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		snap, err := eng.Restore(r.Context(), r.PathValue("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "snapshot not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		recordAudit(db, r, "engine.restore", map[string]string{"id": snap.ID})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(snap)
+	}))
+
+	mux.HandleFunc("GET /api/sessions", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		sessions, err := db.ListSessions(100)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(sessions)
+	}))
+
+	mux.HandleFunc("GET /api/sessions/{id}/events", auth.require(roleViewer, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		from, err := parseTimeParam(q.Get("from"), time.Time{})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+			return
+		}
+		to, err := parseTimeParam(q.Get("to"), time.Time{})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+			return
+		}
+		events, err := db.LoadSessionEvents(r.PathValue("id"), q.Get("kind"), q.Get("symbol"), from, to)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(events)
+	}))
+
+	// the config running now, its secrets redacted
+	mux.HandleFunc("GET /api/config", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		c, err := reloader.current()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Redact()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(c)
+	}))
+
+	// change the config without a restart, the body holds the settings to
+	// change. Risk, strategies and alert channels apply right away, the
+	// response lists other changes as taking effect on the next start.
+	// Secrets left redacted keep their running values.
+	mux.HandleFunc("PUT /api/config", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigBytes))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		change, err := reloader.update(body, actorFromRequest(r))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(change)
+	}))
+
+	mux.HandleFunc("/api/audit", auth.require(roleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "")
+			return
+		}
+		limit := 100
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+			limit = l
+		}
+		entries, err := db.LoadAudit(limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(entries)
+	}))
 
 	return mux
 }
+
+// pageParams reads limit (default 50, at most 500) and offset from the query
+func pageParams(q url.Values) (limit, offset int) {
+	limit = 50
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(q.Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+	return limit, offset
+}
+
+// historyFilter reads the symbol, side, from/to, run and page of an order
+// or trade history query
+func historyFilter(q url.Values) (store.HistoryFilter, error) {
+	f := store.HistoryFilter{Symbol: strings.ToUpper(q.Get("symbol")), Side: strings.ToUpper(q.Get("side"))}
+	if f.Side != "" && f.Side != string(engine.SideBuy) && f.Side != string(engine.SideSell) {
+		return f, fmt.Errorf("side must be %s or %s", engine.SideBuy, engine.SideSell)
+	}
+	var err error
+	if f.From, err = parseTimeParam(q.Get("from"), time.Time{}); err != nil {
+		return f, err
+	}
+	if f.To, err = parseTimeParam(q.Get("to"), time.Time{}); err != nil {
+		return f, err
+	}
+	f.Run = q.Get("run")
+	f.Limit, f.Offset = pageParams(q)
+	return f, nil
+}
+
+// parseTimeParam accepts RFC3339, a plain date or unix seconds, returning def when s is empty
+func parseTimeParam(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", s)
+}
+
+// specInterval is the candle size in seconds the strategy of spec trades
+func specInterval(spec strategy.Spec) (int64, error) {
+	if spec.Interval == "" {
+		return engine.DefaultCandleInterval, nil
+	}
+	d, err := engine.ParseInterval(spec.Interval)
+	if err != nil {
+		return 0, err
+	}
+	return int64(d / time.Second), nil
+}
+
+// candlesFromRows converts store candle rows into engine candles
+func candlesFromRows(rows []map[string]interface{}) []engine.Candle {
+	candles := make([]engine.Candle, 0, len(rows))
+	for _, r := range rows {
+		ts, _ := r["time"].(string)
+		t, err := parseTimeParam(ts, time.Time{})
+		if err != nil {
+			t, _ = time.Parse("2006-01-02 15:04:05", ts)
+		}
+		c := engine.Candle{Time: t}
+		c.Open, _ = r["open"].(float64)
+		c.High, _ = r["high"].(float64)
+		c.Low, _ = r["low"].(float64)
+		c.Close, _ = r["close"].(float64)
+		c.Volume, _ = r["volume"].(float64)
+		candles = append(candles, c)
+	}
+	return candles
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/config"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newControlServer builds the server of the control API. Header and idle
+// timeouts keep slow or abandoned connections from piling up, there is no
+// write timeout as event streams stay open. With autocert it also starts
+// the plain HTTP server answering HTTP-01 challenges, closed with srv.
+func newControlServer(addr string, h http.Handler, tc config.TLS) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 << 10,
+	}
+	if !tc.Enabled() {
+		return srv, nil
+	}
+
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(tc.AutocertHosts) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tc.AutocertHosts...),
+			Cache:      autocert.DirCache(tc.AutocertCache),
+		}
+		srv.TLSConfig = m.TLSConfig()
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+		log.Printf("Requesting certificates for %s from Let's Encrypt", strings.Join(tc.AutocertHosts, ", "))
+		if tc.AutocertHTTPAddr != "" {
+			serveChallenges(srv, m, tc.AutocertHTTPAddr)
+		}
+	}
+	if tc.ClientCAFile != "" {
+		pem, err := os.ReadFile(tc.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("client CA: no certificates in %s", tc.ClientCAFile)
+		}
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return srv, nil
+}
+
+// serveChallenges answers the HTTP-01 challenges of m on addr, redirecting
+// every other request to HTTPS, until srv shuts down
+func serveChallenges(srv *http.Server, m *autocert.Manager, addr string) {
+	challenges := &http.Server{
+		Addr:              addr,
+		Handler:           m.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+	srv.RegisterOnShutdown(func() { challenges.Close() })
+	go func() {
+		log.Println("ACME HTTP-01 challenges listening on", addr)
+		if err := challenges.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("ACME HTTP-01 challenges: %v, only TLS-ALPN-01 is answered", err)
+		}
+	}()
+}
+
+// serveControl serves srv over HTTPS when tc enables it, plain HTTP otherwise
+func serveControl(srv *http.Server, tc config.TLS) error {
+	if !tc.Enabled() {
+		log.Println("HTTP control server listening on", srv.Addr)
+		return srv.ListenAndServe()
+	}
+	mtls := ""
+	if tc.ClientCAFile != "" {
+		mtls = " with client certificates"
+	}
+	log.Printf("HTTPS control server listening on %s%s", srv.Addr, mtls)
+	// autocert supplies certificates through the TLS config
+	return srv.ListenAndServeTLS(tc.CertFile, tc.KeyFile)
+}
+
+// grpcTLSConfig is the TLS config of the gRPC server, the control server's
+// with the certificate files loaded since gRPC does not read them itself.
+// It is nil when the control API is served over plain HTTP.
+func grpcTLSConfig(srv *http.Server, tc config.TLS) (*tls.Config, error) {
+	if srv.TLSConfig == nil {
+		return nil, nil
+	}
+	cfg := srv.TLSConfig.Clone()
+	if tc.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("grpc tls: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
@@ -2,81 +2,460 @@ package backtest
 
 import (
 	"context"
+	"fmt"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/omept/trading-engine/pkg/engine"
 	"github.com/omept/trading-engine/pkg/exchange"
-	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
 )
 
+// Backtester replays candles through clones of strategies on a private
+// engine and simulated exchange, so a run never touches live state
 type Backtester struct {
 	candles  []engine.Candle
+	series   map[string][]engine.Candle // by symbol, set for a portfolio
 	strats   []engine.Strategy
-	store    *store.SQLiteStore
-	exchange engine.ExchangeAdapter
+	exchange *exchange.MockExchange
+	orders   *engine.OrderManager
+	prices   *engine.PriceBook
+	events   *engine.EventBus
+	clock    *engine.SimClock // at the time of the candle replayed
+	from, to time.Time        // zero leaves that end of the range open
+	mc       MonteCarloConfig
+	id       string
+	progress func(done, total int)
 }
 
 type BacktestStats struct {
 	RunID       string
+	Symbol      string   // the symbols replayed, comma separated
+	Symbols     []string // sorted
+	Strategies  []string
 	Start       time.Time
 	End         time.Time
+	DataStart   time.Time // first candle replayed
+	DataEnd     time.Time // last candle replayed
+	Candles     int
 	FinalEquity float64
+	NetDeposits float64 // external USD flows during the run, excluded from PnL
+	PnL         float64
 	EquityCurve []float64
+	Trades      []Trade // closed round trips, in the order they closed
+	Metrics
+	MonteCarlo *MonteCarloStats `json:",omitempty"` // nil unless enabled with SetMonteCarlo and trades closed
+	// PerStrategy is the run of each strategy on its own capital, in
+	// registration order
+	PerStrategy []StrategyStats
 }
 
-func NewBacktester(candles []engine.Candle, eng *engine.Engine, store *store.SQLiteStore) *Backtester {
+// StrategyStats is one strategy's part of a backtest, valued from its own
+// fills and starting capital
+type StrategyStats struct {
+	Strategy    string
+	Symbol      string
+	StartEquity float64
+	FinalEquity float64
+	PnL         float64
+	EquityCurve []float64 // one point per time of the combined curve
+	Metrics
+}
+
+// NewBacktester clones strats onto a fresh engine whose mock exchange starts
+// with balance USD. Orders are neither sent to the live exchange nor stored.
+func NewBacktester(candles []engine.Candle, strats []engine.Strategy, balance decimal.Decimal) (*Backtester, error) {
+	mock := exchange.NewMockExchange(balance, nil).(*exchange.MockExchange)
+	om := engine.NewOrderManager(mock, nil)
+	eng := engine.NewEngine()
+	// time moves with the candles, waits such as order retries skip ahead
+	clock := engine.NewSimClock(time.Time{})
+	clock.SetAutoAdvance(true)
+	eng.SetClock(clock)
+	eng.SetExchangeAdapter(mock)
+	eng.SetOrderManager(om)
+	for _, s := range strats {
+		c, ok := s.(engine.Cloner)
+		if !ok {
+			return nil, fmt.Errorf("strategy %s cannot be cloned for a backtest", s.Name())
+		}
+		eng.RegisterStrategy(c.Clone(om))
+	}
 	return &Backtester{
 		candles:  candles,
 		strats:   eng.Strategies(),
-		exchange: eng.ExchangeAdapter(),
-		store:    store,
+		exchange: mock,
+		orders:   om.(*engine.OrderManager),
+		prices:   eng.Prices(),
+		events:   eng.Events(),
+		clock:    clock,
+	}, nil
+}
+
+// NewPortfolioBacktester is NewBacktester over candles of several symbols,
+// each strategy trading the candles of its own symbol and those of the
+// other symbols it reads. Run it with RunPortfolio.
+func NewPortfolioBacktester(series map[string][]engine.Candle, strats []engine.Strategy, balance decimal.Decimal) (*Backtester, error) {
+	if len(series) == 0 {
+		return nil, fmt.Errorf("a portfolio backtest needs candles")
+	}
+	b, err := NewBacktester(nil, strats, balance)
+	if err != nil {
+		return nil, err
 	}
+	b.series = series
+	return b, nil
+}
+
+// drain waits until the events published so far are handled
+func (b *Backtester) drain() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return b.events.Drain(ctx)
+}
+
+// SetFillModel sets the fees and slippage the run's fills pay, they fill
+// for free at the expected price otherwise
+func (b *Backtester) SetFillModel(f exchange.FillModel) {
+	b.exchange.SetFillModel(f)
 }
 
+// SetRange limits the run to candles with from <= time <= to
+func (b *Backtester) SetRange(from, to time.Time) {
+	b.from, b.to = from, to
+}
+
+// SetMonteCarlo resamples the trades of the run per cfg for confidence
+// intervals of its outcome
+func (b *Backtester) SetMonteCarlo(cfg MonteCarloConfig) {
+	b.mc = cfg
+}
+
+// SetRunID names the run, a timestamped id is used otherwise
+func (b *Backtester) SetRunID(id string) {
+	b.id = id
+}
+
+// SetProgress calls fn after each candle with the candles replayed so far
+// and the candles the run replays
+func (b *Backtester) SetProgress(fn func(done, total int)) {
+	b.progress = fn
+}
+
+// Run replays the candles once for the strategies trading symbol, the
+// backtester cannot be reused afterwards
 func (b *Backtester) Run(symbol string) (*BacktestStats, error) {
-	sort.Slice(b.candles, func(i, j int) bool {
-		return b.candles[i].Time.Before(b.candles[j].Time)
-	})
+	return b.RunContext(context.Background(), symbol)
+}
 
-	ch, _ := b.exchange.SubscribeCandles(context.Background(), symbol, -1)
+// RunContext is Run stopping with ctx's error once ctx ends
+func (b *Backtester) RunContext(ctx context.Context, symbol string) (*BacktestStats, error) {
+	series := b.series
+	if series == nil {
+		series = map[string][]engine.Candle{symbol: b.candles}
+	}
+	if _, ok := series[symbol]; !ok {
+		return nil, fmt.Errorf("no %s candles to backtest", symbol)
+	}
+	return b.run(ctx, map[string][]engine.Candle{symbol: series[symbol]})
+}
 
-	stats := &BacktestStats{
-		RunID: "backtest_" + time.Now().Format("150405"),
-		Start: time.Now(),
+// RunPortfolio replays the candles of every symbol of a portfolio
+// backtester interleaved by time, each strategy getting the candles of its
+// own symbol. The backtester cannot be reused afterwards.
+func (b *Backtester) RunPortfolio(ctx context.Context) (*BacktestStats, error) {
+	if b.series == nil {
+		return nil, fmt.Errorf("not a portfolio backtester, use Run")
 	}
+	return b.run(ctx, b.series)
+}
+
+// run replays the candles of series, by symbol, through the strategies on
+// those symbols
+func (b *Backtester) run(ctx context.Context, series map[string][]engine.Candle) (*BacktestStats, error) {
+	defer b.events.Close()
 
-	equityCurve := make([]float64, 0, len(b.candles))
+	symbols := make([]string, 0, len(series))
+	for sym := range series {
+		symbols = append(symbols, sym)
+	}
+	sort.Strings(symbols)
 
+	// candles in range of every symbol, in time order and by symbol within a time
+	var candles []symbolCandle
+	for _, sym := range symbols {
+		in := series[sym]
+		sort.Slice(in, func(i, j int) bool { return in[i].Time.Before(in[j].Time) })
+		n := 0
+		for _, c := range in {
+			if (!b.from.IsZero() && c.Time.Before(b.from)) || (!b.to.IsZero() && c.Time.After(b.to)) {
+				continue
+			}
+			candles = append(candles, symbolCandle{sym, c})
+			n++
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("no %s candles between %s and %s", sym, b.from.Format(time.RFC3339), b.to.Format(time.RFC3339))
+		}
+	}
+	sort.SliceStable(candles, func(i, j int) bool { return candles[i].Time.Before(candles[j].Time) })
+
+	// strategies on the symbols replayed, each handed candles of its symbol's
+	// step and, when it reads other symbols too, the candles of those
+	var strats []engine.Strategy
+	handlers := map[string][]func(engine.Candle){}
 	for _, strat := range b.strats {
+		in, ok := series[strat.Symbol()]
+		if !ok {
+			continue
+		}
+		if ms, ok := strat.(engine.MultiSymbolStrategy); ok {
+			missing := false
+			for _, sym := range ms.Symbols() {
+				if _, ok := series[sym]; !ok {
+					missing = true
+				}
+			}
+			if missing {
+				continue
+			}
+			for _, sym := range ms.Symbols() {
+				if sym != strat.Symbol() {
+					handlers[sym] = append(handlers[sym], func(c engine.Candle) { ms.OnSymbolCandle(sym, c) })
+				}
+			}
+		}
+		strats = append(strats, strat)
+		handlers[strat.Symbol()] = append(handlers[strat.Symbol()], engine.CandleHandler(strat, baseInterval(in)))
+	}
+	if len(strats) == 0 {
+		return nil, fmt.Errorf("no strategy trades %s", strings.Join(symbols, ", "))
+	}
+
+	feeds := make(map[string]<-chan engine.Candle, len(symbols))
+	for _, sym := range symbols {
+		feeds[sym], _ = b.exchange.SubscribeCandles(context.Background(), sym, -1)
+	}
+
+	stats := &BacktestStats{
+		RunID:   b.id,
+		Symbol:  strings.Join(symbols, ","),
+		Symbols: symbols,
+		Start:   time.Now(),
+
+		DataStart: candles[0].Time,
+		DataEnd:   candles[len(candles)-1].Time,
+		Candles:   len(candles),
+	}
+	if stats.RunID == "" {
+		stats.RunID = "backtest_" + time.Now().Format("20060102_150405.000")
+	}
+
+	// fills of this run's strategies at the time of the candle they filled
+	// on, for the trade log and metrics, and each strategy's own ledger
+	var fillsMt sync.Mutex
+	var fills []fill
+	var now time.Time
+	ledgers := map[string]*ledger{}
+	for _, strat := range strats {
+		stats.Strategies = append(stats.Strategies, strat.Name())
+		ledgers[strat.Name()] = newLedger(engine.StrategySymbols(strat), strat.AccountBalUSD())
+	}
+	unsubscribe := b.events.Subscribe(engine.EventOrderFilled, func(ev engine.Event) {
+		l, ok := ledgers[ev.Order.Strategy]
+		if !ok || !l.trades(ev.Order.Symbol) {
+			return
+		}
+		fillsMt.Lock()
+		fills = append(fills, fill{Order: ev.Order, at: now})
+		l.apply(ev.Order)
+		fillsMt.Unlock()
+	})
+	defer unsubscribe()
+
+	b.clock.Set(candles[0].Time)
+	for _, strat := range strats {
 		strat.OnStart()
 	}
 
-	for _, c := range b.candles {
+	startBal, _ := b.exchange.GetBalances(context.Background())
+	startEquity := startBal["USD"]
+	startDeposits := b.exchange.NetDeposits("USD")
+	starts := map[string]float64{}
+	for name, l := range ledgers {
+		starts[name] = l.cash.InexactFloat64()
+	}
+
+	var equityCurve []float64
+	curves := map[string][]float64{}
+	closes := map[string]decimal.Decimal{}
+	for i, c := range candles {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("backtest stopped after %d of %d candles: %w", i, len(candles), err)
+		}
+		fillsMt.Lock()
+		now = c.Time
+		fillsMt.Unlock()
+		b.clock.Set(c.Time)
+
 		// 1. push candle manually
-		b.exchange.(*exchange.MockExchange).PushCandleInBacktest(symbol, c)
+		b.exchange.PushCandleInBacktest(c.symbol, c.Candle)
 
 		// 2. read from exchange feed (strategies react inside OnCandle)
-		chCandle := <-ch
-		for _, strat := range b.strats {
-			strat.OnCandle(chCandle)
+		chCandle := <-feeds[c.symbol]
+		b.prices.UpdateCandle(c.symbol, chCandle)
+		for _, onCandle := range handlers[c.symbol] {
+			onCandle(chCandle)
+		}
+		closes[c.symbol] = decimal.NewFromFloat(chCandle.Close)
+		// limit orders the candle crossed filled on the exchange
+		b.orders.PollOrders(context.Background())
+		// strategies read positions and capital from fills, let them land before the next candle
+		if err := b.drain(); err != nil {
+			return nil, fmt.Errorf("waiting for fills: %w", err)
+		}
+		if b.progress != nil {
+			b.progress(i+1, len(candles))
+		}
+		if i+1 < len(candles) && candles[i+1].Time.Equal(c.Time) {
+			// the other symbols' candles of this time land first
+			continue
 		}
 
-		// 3. compute equity from exchange balances + positions
+		// 3. compute equity from exchange balances + positions, once per time
 		bal, _ := b.exchange.GetBalances(context.Background())
-		pos, _ := b.exchange.GetPosition(context.Background(), symbol)
-
-		equity := bal["USD"] + pos.Quantity*chCandle.Close
-		equityCurve = append(equityCurve, equity)
+		equity := bal["USD"]
+		for sym, px := range closes {
+			pos, _ := b.exchange.GetPosition(context.Background(), sym)
+			equity = equity.Add(pos.Quantity.Mul(px))
+		}
+		equityCurve = append(equityCurve, equity.InexactFloat64())
+		fillsMt.Lock()
+		for name, l := range ledgers {
+			curves[name] = append(curves[name], l.equity(closes).InexactFloat64())
+		}
+		fillsMt.Unlock()
 	}
 
-	for _, strat := range b.strats {
+	for _, strat := range strats {
 		strat.OnStop()
 	}
 
 	stats.EquityCurve = equityCurve
 	stats.FinalEquity = equityCurve[len(equityCurve)-1]
+	deposits := b.exchange.NetDeposits("USD").Sub(startDeposits)
+	stats.NetDeposits = deposits.InexactFloat64()
+	stats.PnL = decimal.NewFromFloat(stats.FinalEquity).Sub(startEquity).Sub(deposits).InexactFloat64()
 	stats.End = time.Now()
 
+	var step time.Duration
+	span := stats.DataEnd.Sub(stats.DataStart)
+	if len(equityCurve) > 1 {
+		step = span / time.Duration(len(equityCurve)-1)
+	}
+	curveMetrics(&stats.Metrics, startEquity.InexactFloat64(), equityCurve, step, span)
+
+	if err := b.drain(); err != nil {
+		return stats, fmt.Errorf("waiting for fills: %w", err)
+	}
+	fillsMt.Lock()
+	stats.Trades = tradeLog(fills)
+	fillsMt.Unlock()
+	tradeMetrics(&stats.Metrics, stats.Trades)
+
+	// what the trades do not account for, an open position's PnL, is added
+	// to every simulation as it is
+	rest := stats.PnL
+	for _, t := range stats.Trades {
+		rest -= t.PnL
+	}
+	stats.MonteCarlo = MonteCarlo(stats.Trades, startEquity.InexactFloat64(), rest, b.mc)
+
+	for _, strat := range strats {
+		name := strat.Name()
+		curve := curves[name]
+		ss := StrategyStats{
+			Strategy:    name,
+			Symbol:      strat.Symbol(),
+			StartEquity: starts[name],
+			FinalEquity: curve[len(curve)-1],
+			EquityCurve: curve,
+		}
+		ss.PnL = ss.FinalEquity - ss.StartEquity
+		var trades []Trade
+		for _, t := range stats.Trades {
+			if t.Strategy == name {
+				trades = append(trades, t)
+			}
+		}
+		curveMetrics(&ss.Metrics, ss.StartEquity, curve, step, span)
+		tradeMetrics(&ss.Metrics, trades)
+		stats.PerStrategy = append(stats.PerStrategy, ss)
+	}
+
 	return stats, nil
 }
+
+// baseInterval is the step of candles in seconds, the default candle
+// interval when they are too few to tell
+func baseInterval(candles []engine.Candle) int64 {
+	if len(candles) > 1 {
+		if d := int64(candles[1].Time.Sub(candles[0].Time) / time.Second); d > 0 {
+			return d
+		}
+	}
+	return engine.DefaultCandleInterval
+}
+
+// symbolCandle is a candle of a portfolio backtest with its symbol
+type symbolCandle struct {
+	symbol string
+	engine.Candle
+}
+
+// ledger follows the cash and positions of one strategy from its fills,
+// starting from the capital it was given
+type ledger struct {
+	cash decimal.Decimal
+	qty  map[string]decimal.Decimal // by symbol the strategy trades
+}
+
+func newLedger(symbols []string, cash decimal.Decimal) *ledger {
+	l := &ledger{cash: cash, qty: make(map[string]decimal.Decimal, len(symbols))}
+	for _, sym := range symbols {
+		l.qty[sym] = decimal.Zero
+	}
+	return l
+}
+
+// trades reports whether the strategy of l trades symbol
+func (l *ledger) trades(symbol string) bool {
+	_, ok := l.qty[symbol]
+	return ok
+}
+
+func (l *ledger) apply(o engine.Order) {
+	price := o.FilledPrice
+	if !price.IsPositive() {
+		price = o.Price
+	}
+	notional := o.Quantity.Mul(price)
+	if o.Side == engine.SideBuy {
+		l.cash = l.cash.Sub(notional).Sub(o.Fee)
+		l.qty[o.Symbol] = l.qty[o.Symbol].Add(o.Quantity)
+	} else {
+		l.cash = l.cash.Add(notional).Sub(o.Fee)
+		l.qty[o.Symbol] = l.qty[o.Symbol].Sub(o.Quantity)
+	}
+}
+
+// equity is the ledger's cash and its positions at the last close of their symbols
+func (l *ledger) equity(closes map[string]decimal.Decimal) decimal.Decimal {
+	eq := l.cash
+	for sym, qty := range l.qty {
+		eq = eq.Add(qty.Mul(closes[sym]))
+	}
+	return eq
+}
@@ -0,0 +1,208 @@
+package backtest
+
+import (
+	"math"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/shopspring/decimal"
+)
+
+const year = 365 * 24 * time.Hour
+
+// Metrics summarizes a run's risk and trade performance. Ratios that are
+// undefined for the run, such as a profit factor without losing trades, are 0.
+type Metrics struct {
+	MaxDrawdown  float64 // largest peak to trough drop as a fraction of the peak
+	Sharpe       float64 // annualized, risk free rate of 0
+	Sortino      float64 // annualized, downside deviation below 0
+	CAGR         float64
+	TotalTrades  int // closed round trips
+	WinRate      float64
+	AvgWin       float64
+	AvgLoss      float64 // negative
+	ProfitFactor float64 // gross profit / gross loss
+}
+
+// curveMetrics computes drawdown and return ratios of an equity curve that
+// starts at start and has one point per candle step
+func curveMetrics(m *Metrics, start float64, curve []float64, step, span time.Duration) {
+	if len(curve) == 0 || start <= 0 {
+		return
+	}
+
+	peak := start
+	prev := start
+	returns := make([]float64, 0, len(curve))
+	for _, eq := range curve {
+		if eq > peak {
+			peak = eq
+		}
+		if peak > 0 {
+			m.MaxDrawdown = math.Max(m.MaxDrawdown, (peak-eq)/peak)
+		}
+		if prev > 0 {
+			returns = append(returns, eq/prev-1)
+		}
+		prev = eq
+	}
+
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	var variance, downside float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	variance /= float64(len(returns))
+	downside /= float64(len(returns))
+
+	periods := 0.0
+	if step > 0 {
+		periods = float64(year) / float64(step)
+	}
+	if variance > 0 {
+		m.Sharpe = mean / math.Sqrt(variance) * math.Sqrt(periods)
+	}
+	if downside > 0 {
+		m.Sortino = mean / math.Sqrt(downside) * math.Sqrt(periods)
+	}
+
+	final := curve[len(curve)-1]
+	if span > 0 && final > 0 {
+		m.CAGR = math.Pow(final/start, float64(year)/float64(span)) - 1
+	}
+}
+
+// position is one strategy's average cost position while replaying fills
+type position struct {
+	qty    decimal.Decimal // negative when short
+	cost   decimal.Decimal // average entry price including opening fees
+	opened time.Time       // when it last opened from flat
+}
+
+// fill is an order fill at the time of the candle it filled on
+type fill struct {
+	engine.Order
+	at time.Time
+}
+
+// Trade is one closed round trip of a backtest: the part of a strategy
+// position that one fill closed, at the position's average entry price
+type Trade struct {
+	Strategy      string
+	Side          engine.Side // of the position, BUY for a long and SELL for a short
+	EntryTime     time.Time   // when the position opened
+	ExitTime      time.Time
+	EntryPrice    float64 // average, including opening fees
+	ExitPrice     float64
+	Quantity      float64
+	PnL           float64 // net of the closing fee
+	HoldingPeriod time.Duration
+}
+
+// tradeLog replays fills per strategy with average cost accounting. Every
+// fill that reduces a position closes one trade.
+func tradeLog(fills []fill) []Trade {
+	positions := map[string]*position{}
+	trades := []Trade{}
+	for _, f := range fills {
+		price := f.FilledPrice
+		if !price.IsPositive() {
+			price = f.Price
+		}
+		qty := f.Quantity
+		if f.Side == engine.SideSell {
+			qty = qty.Neg()
+		}
+		p := positions[f.Strategy]
+		if p == nil {
+			p = &position{}
+			positions[f.Strategy] = p
+		}
+
+		if p.qty.IsZero() || p.qty.Sign() == qty.Sign() {
+			// opening or adding, fees raise a long's cost and lower a short's entry
+			if p.qty.IsZero() {
+				p.opened = f.at
+			}
+			fee := f.Fee
+			if qty.IsNegative() {
+				fee = fee.Neg()
+			}
+			total := p.qty.Abs().Mul(p.cost).Add(qty.Abs().Mul(price)).Add(fee)
+			p.qty = p.qty.Add(qty)
+			p.cost = total.Div(p.qty.Abs())
+			continue
+		}
+
+		closed := decimal.Min(qty.Abs(), p.qty.Abs())
+		pnl := price.Sub(p.cost).Mul(closed)
+		side := engine.SideBuy
+		if p.qty.IsNegative() {
+			pnl = pnl.Neg()
+			side = engine.SideSell
+		}
+		pnl = pnl.Sub(f.Fee)
+		trades = append(trades, Trade{
+			Strategy:      f.Strategy,
+			Side:          side,
+			EntryTime:     p.opened,
+			ExitTime:      f.at,
+			EntryPrice:    p.cost.InexactFloat64(),
+			ExitPrice:     price.InexactFloat64(),
+			Quantity:      closed.InexactFloat64(),
+			PnL:           pnl.InexactFloat64(),
+			HoldingPeriod: f.at.Sub(p.opened),
+		})
+
+		p.qty = p.qty.Add(qty)
+		if !p.qty.IsZero() && p.qty.Sign() == qty.Sign() {
+			// flipped through zero, the rest opened at this price
+			p.cost = price
+			p.opened = f.at
+		}
+	}
+	return trades
+}
+
+// tradeMetrics summarizes the closed trades of a run
+func tradeMetrics(m *Metrics, trades []Trade) {
+	var wins, losses []float64
+	for _, t := range trades {
+		if t.PnL > 0 {
+			wins = append(wins, t.PnL)
+		} else {
+			losses = append(losses, t.PnL)
+		}
+	}
+
+	m.TotalTrades = len(wins) + len(losses)
+	if m.TotalTrades == 0 {
+		return
+	}
+	m.WinRate = float64(len(wins)) / float64(m.TotalTrades)
+	grossWin, grossLoss := sum(wins), sum(losses)
+	if len(wins) > 0 {
+		m.AvgWin = grossWin / float64(len(wins))
+	}
+	if len(losses) > 0 {
+		m.AvgLoss = grossLoss / float64(len(losses))
+	}
+	if grossLoss < 0 {
+		m.ProfitFactor = grossWin / -grossLoss
+	}
+}
+
+func sum(xs []float64) float64 {
+	var s float64
+	for _, x := range xs {
+		s += x
+	}
+	return s
+}
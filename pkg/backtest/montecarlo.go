@@ -0,0 +1,141 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// DefaultConfidence is the width of the Monte Carlo intervals when none is
+// set, the 2.5th to 97.5th percentile
+const DefaultConfidence = 0.95
+
+// MonteCarloConfig is how a backtest's trades are resampled to see how much
+// of its result is down to the order they came in
+type MonteCarloConfig struct {
+	Runs int `json:"runs"` // simulations, 0 skips the analysis
+	// Resample draws each simulation's trades with replacement instead of
+	// shuffling the trades that happened
+	Resample bool `json:"resample,omitempty"`
+	// SlippageBps is the most extra slippage charged on each side of a
+	// trade, every fill draws its own uniformly between 0 and this
+	SlippageBps float64 `json:"slippage_bps,omitempty"`
+	Confidence  float64 `json:"confidence"`     // width of the reported intervals, e.g. 0.9 for the 5th to 95th percentile, DefaultConfidence when 0 is passed to MonteCarlo
+	Seed        int64   `json:"seed,omitempty"` // 0 seeds from the clock
+}
+
+// Validate rejects negative counts and rates and confidences outside (0, 1),
+// a confidence of 0 included
+func (c MonteCarloConfig) Validate() error {
+	if c.Runs < 0 || c.SlippageBps < 0 {
+		return fmt.Errorf("monte carlo runs and slippage_bps must not be negative")
+	}
+	if c.Confidence <= 0 || c.Confidence >= 1 {
+		return fmt.Errorf("monte carlo confidence must be between 0 and 1, got %v", c.Confidence)
+	}
+	return nil
+}
+
+// Interval is the spread of a value across the simulations
+type Interval struct {
+	Low    float64 // lower bound of the confidence interval
+	Median float64
+	High   float64
+}
+
+// MonteCarloStats are the confidence intervals of a backtest's outcome
+// over reordered and re-slipped trades
+type MonteCarloStats struct {
+	Runs        int
+	Confidence  float64
+	FinalEquity Interval
+	MaxDrawdown Interval // of the equity after each trade, as a fraction of the peak
+	LossChance  float64  // share of simulations ending below the starting equity
+}
+
+// MonteCarlo simulates cfg.Runs orderings of trades from start equity. Each
+// ends with rest added, the PnL the trades do not account for such as a
+// position still open, so without slippage the median final equity is the
+// backtest's. Nil when there are no runs or no trades.
+func MonteCarlo(trades []Trade, start, rest float64, cfg MonteCarloConfig) *MonteCarloStats {
+	if cfg.Runs <= 0 || len(trades) == 0 {
+		return nil
+	}
+	if cfg.Confidence == 0 {
+		cfg.Confidence = DefaultConfidence
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	finals := make([]float64, cfg.Runs)
+	drawdowns := make([]float64, cfg.Runs)
+	order := make([]int, len(trades))
+	losses := 0
+	for run := range cfg.Runs {
+		for i := range order {
+			if cfg.Resample {
+				order[i] = rng.Intn(len(trades))
+			} else {
+				order[i] = i
+			}
+		}
+		if !cfg.Resample {
+			rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		}
+
+		equity, peak, dd := start, start, 0.0
+		for _, i := range order {
+			t := trades[i]
+			pnl := t.PnL
+			if cfg.SlippageBps > 0 {
+				// each side's fill moves against the trade by its own draw
+				pnl -= t.Quantity * (t.EntryPrice*rng.Float64() + t.ExitPrice*rng.Float64()) * cfg.SlippageBps / 10000
+			}
+			equity += pnl
+			peak = math.Max(peak, equity)
+			if peak > 0 {
+				dd = math.Max(dd, (peak-equity)/peak)
+			}
+		}
+		equity += rest
+		finals[run], drawdowns[run] = equity, dd
+		if equity < start {
+			losses++
+		}
+	}
+
+	return &MonteCarloStats{
+		Runs:        cfg.Runs,
+		Confidence:  cfg.Confidence,
+		FinalEquity: interval(finals, cfg.Confidence),
+		MaxDrawdown: interval(drawdowns, cfg.Confidence),
+		LossChance:  float64(losses) / float64(cfg.Runs),
+	}
+}
+
+// interval sorts xs and returns the bounds holding confidence of them
+// around the median
+func interval(xs []float64, confidence float64) Interval {
+	sort.Float64s(xs)
+	tail := (1 - confidence) / 2
+	return Interval{
+		Low:    percentile(xs, tail),
+		Median: percentile(xs, 0.5),
+		High:   percentile(xs, 1-tail),
+	}
+}
+
+// percentile interpolates the q quantile of sorted xs
+func percentile(xs []float64, q float64) float64 {
+	pos := q * float64(len(xs)-1)
+	i := int(pos)
+	if i >= len(xs)-1 {
+		return xs[len(xs)-1]
+	}
+	return xs[i] + (xs[i+1]-xs[i])*(pos-float64(i))
+}
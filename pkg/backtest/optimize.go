@@ -0,0 +1,279 @@
+package backtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/exchange"
+	"github.com/omept/trading-engine/pkg/strategy"
+	"github.com/shopspring/decimal"
+)
+
+// Ranking metrics of an optimization
+const (
+	RankSharpe             = "sharpe"
+	RankFinalEquity        = "final_equity"
+	RankReturnOverDrawdown = "return_over_drawdown" // total return per unit of max drawdown
+)
+
+// MaxGridSize caps the parameter combinations one optimization runs
+const MaxGridSize = 10000
+
+// minDrawdown is the drawdown return_over_drawdown divides by at least, so
+// runs that never drew down do not rank infinitely high
+const minDrawdown = 0.01
+
+// ParamRange is the values one strategy parameter takes: Min to Max by
+// Step, or exactly Values when they are given
+type ParamRange struct {
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Step   float64   `json:"step"`
+	Values []float64 `json:"values,omitempty"`
+}
+
+func (r ParamRange) values() ([]float64, error) {
+	if len(r.Values) > 0 {
+		return r.Values, nil
+	}
+	if r.Step <= 0 || r.Max < r.Min {
+		return nil, fmt.Errorf("needs a positive step and min <= max")
+	}
+	var out []float64
+	// counted in steps so float error does not drop the last value
+	n := int(math.Floor((r.Max-r.Min)/r.Step + 1e-9))
+	for i := 0; i <= n; i++ {
+		out = append(out, r.Min+float64(i)*r.Step)
+		if len(out) > MaxGridSize {
+			break
+		}
+	}
+	return out, nil
+}
+
+// OptimizeConfig is a grid search of one strategy spec over candles
+type OptimizeConfig struct {
+	Spec    strategy.Spec         // base spec, grid values override its params
+	Grid    map[string]ParamRange // by params field, e.g. "short" and "long" of ema
+	Rank    string                // one of the Rank constants, sharpe when empty
+	Top     int                   // results returned, 10 when zero
+	Workers int                   // backtests run at once, the CPU count when zero
+	Balance decimal.Decimal       // USD the simulated exchange starts with
+	Fills   exchange.FillModel
+	From    time.Time // zero leaves that end of the range open
+	To      time.Time
+	// NewStrategy builds the strategy of one combination, the backtest
+	// runs a clone of it
+	NewStrategy func(spec strategy.Spec) (engine.Strategy, error)
+}
+
+// OptimizeResult is the outcome of one parameter combination
+type OptimizeResult struct {
+	Params      map[string]float64 `json:"params"`
+	Score       float64            `json:"score"`
+	FinalEquity float64            `json:"final_equity"`
+	PnL         float64            `json:"pnl"`
+	Metrics     Metrics            `json:"metrics"`
+}
+
+// OptimizeReport ranks the combinations of a grid search
+type OptimizeReport struct {
+	Rank     string           `json:"rank"`
+	Combos   int              `json:"combos"`           // combinations in the grid
+	Skipped  int              `json:"skipped"`          // combinations the strategy rejected, such as short >= long
+	Failed   int              `json:"failed"`           // backtests that errored
+	Errors   []string         `json:"errors,omitempty"` // first few failures
+	Results  []OptimizeResult `json:"results"`          // best first
+	Duration time.Duration    `json:"duration_ns"`
+}
+
+// Optimize backtests cfg.Spec with every combination of the grid on
+// candles, across cfg.Workers goroutines, and returns the best cfg.Top
+// ranked by cfg.Rank. Each run has its own engine and simulated exchange.
+func Optimize(ctx context.Context, candles []engine.Candle, cfg OptimizeConfig) (*OptimizeReport, error) {
+	start := time.Now()
+	if cfg.Rank == "" {
+		cfg.Rank = RankSharpe
+	}
+	if score(cfg.Rank, nil, 0) == nil {
+		return nil, fmt.Errorf("unknown rank metric %q, use %s, %s or %s", cfg.Rank, RankSharpe, RankFinalEquity, RankReturnOverDrawdown)
+	}
+	if cfg.Top <= 0 {
+		cfg.Top = 10
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+	if cfg.NewStrategy == nil {
+		return nil, fmt.Errorf("optimize needs a strategy factory")
+	}
+	combos, err := grid(cfg.Grid)
+	if err != nil {
+		return nil, err
+	}
+	base := map[string]any{}
+	if len(cfg.Spec.Params) > 0 {
+		if err := json.Unmarshal(cfg.Spec.Params, &base); err != nil {
+			return nil, fmt.Errorf("params: %w", err)
+		}
+	}
+
+	// sorted once, each run replays its own copy
+	sorted := append([]engine.Candle(nil), candles...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	rep := &OptimizeReport{Rank: cfg.Rank, Combos: len(combos)}
+	var mt sync.Mutex
+	jobs := make(chan map[string]float64)
+	var wg sync.WaitGroup
+	for w := 0; w < min(cfg.Workers, len(combos)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for params := range jobs {
+				res, skipped, err := runCombo(ctx, sorted, cfg, base, params)
+				mt.Lock()
+				switch {
+				case err == nil:
+					rep.Results = append(rep.Results, *res)
+				case skipped:
+					rep.Skipped++
+				default:
+					rep.Failed++
+				}
+				if err != nil && len(rep.Errors) < 5 {
+					rep.Errors = append(rep.Errors, fmt.Sprintf("%v: %v", params, err))
+				}
+				mt.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, params := range combos {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- params:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(rep.Results, func(i, j int) bool { return rep.Results[i].Score > rep.Results[j].Score })
+	if len(rep.Results) > cfg.Top {
+		rep.Results = rep.Results[:cfg.Top]
+	}
+	rep.Duration = time.Since(start)
+	return rep, nil
+}
+
+// runCombo backtests the spec with params over base params. Combinations
+// the strategy rejects are reported as skipped, with the reason, rather
+// than failed.
+func runCombo(ctx context.Context, candles []engine.Candle, cfg OptimizeConfig, base map[string]any, params map[string]float64) (*OptimizeResult, bool, error) {
+	merged := make(map[string]any, len(base)+len(params))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range params {
+		merged[k] = v
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, false, err
+	}
+	spec := cfg.Spec
+	spec.Params = raw
+	s, err := cfg.NewStrategy(spec)
+	if err != nil {
+		return nil, true, err
+	}
+
+	bt, err := NewBacktester(append([]engine.Candle(nil), candles...), []engine.Strategy{s}, cfg.Balance)
+	if err != nil {
+		return nil, false, err
+	}
+	bt.SetRange(cfg.From, cfg.To)
+	bt.SetFillModel(cfg.Fills)
+	stats, err := bt.RunContext(ctx, spec.Symbol)
+	if err != nil {
+		return nil, false, err
+	}
+	return &OptimizeResult{
+		Params:      params,
+		Score:       *score(cfg.Rank, stats, cfg.Balance.InexactFloat64()),
+		FinalEquity: stats.FinalEquity,
+		PnL:         stats.PnL,
+		Metrics:     stats.Metrics,
+	}, false, nil
+}
+
+// score is what rank orders stats by, higher being better. With nil stats
+// it only reports whether rank is known.
+func score(rank string, stats *BacktestStats, balance float64) *float64 {
+	var v float64
+	switch rank {
+	case RankSharpe:
+		if stats != nil {
+			v = stats.Sharpe
+		}
+	case RankFinalEquity:
+		if stats != nil {
+			v = stats.FinalEquity
+		}
+	case RankReturnOverDrawdown:
+		if stats != nil && balance > 0 {
+			v = stats.PnL / balance / math.Max(stats.MaxDrawdown, minDrawdown)
+		}
+	default:
+		return nil
+	}
+	return &v
+}
+
+// grid expands ranges into every combination of their values
+func grid(ranges map[string]ParamRange) ([]map[string]float64, error) {
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("the grid has no parameters")
+	}
+	names := make([]string, 0, len(ranges))
+	for name := range ranges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	combos := []map[string]float64{{}}
+	for _, name := range names {
+		vals, err := ranges[name].values()
+		if err != nil {
+			return nil, fmt.Errorf("grid %s: %w", name, err)
+		}
+		if len(combos)*len(vals) > MaxGridSize {
+			return nil, fmt.Errorf("the grid has more than %s combinations", strconv.Itoa(MaxGridSize))
+		}
+		next := make([]map[string]float64, 0, len(combos)*len(vals))
+		for _, c := range combos {
+			for _, v := range vals {
+				m := make(map[string]float64, len(c)+1)
+				for k, x := range c {
+					m[k] = x
+				}
+				m[name] = v
+				next = append(next, m)
+			}
+		}
+		combos = next
+	}
+	return combos, nil
+}
@@ -0,0 +1,92 @@
+package backtest
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+//go:embed templates/report.html
+var reportFiles embed.FS
+
+// chart size in pixels, curves longer than the width are thinned to it
+const (
+	chartWidth  = 900
+	chartHeight = 240
+)
+
+var reportTemplate = template.Must(template.New("report.html").Funcs(template.FuncMap{
+	"join":  strings.Join,
+	"money": func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"num":   func(v float64) string { return fmt.Sprintf("%.4g", v) },
+	"pct":   func(v float64) string { return fmt.Sprintf("%.4g%%", v*100) },
+	"date":  func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04") },
+	"sign": func(v float64) string {
+		switch {
+		case v > 0:
+			return "pos"
+		case v < 0:
+			return "neg"
+		}
+		return ""
+	},
+}).ParseFS(reportFiles, "templates/report.html"))
+
+// WriteReport renders s as a self-contained HTML page with its metrics,
+// equity and drawdown charts and trades
+func WriteReport(w io.Writer, s *BacktestStats) error {
+	drawdowns := make([]float64, len(s.EquityCurve))
+	var peak float64
+	for i, eq := range s.EquityCurve {
+		peak = math.Max(peak, eq)
+		if peak > 0 {
+			drawdowns[i] = -(peak - eq) / peak * 100
+		}
+	}
+	return reportTemplate.Execute(w, struct {
+		Stats    *BacktestStats
+		Equity   template.HTML
+		Drawdown template.HTML
+	}{
+		Stats:    s,
+		Equity:   svgChart(s.EquityCurve, "#0969da", "%.2f"),
+		Drawdown: svgChart(drawdowns, "#cf222e", "%.2f%%"),
+	})
+}
+
+// svgChart draws values as a line scaled to the chart, labelled with its
+// highest and lowest value in format
+func svgChart(values []float64, color, format string) template.HTML {
+	if len(values) == 0 {
+		return `<p class="muted">No data.</p>`
+	}
+	step := max(1, len(values)/chartWidth)
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	span := hi - lo
+	if span == 0 {
+		span = 1
+	}
+
+	var pts strings.Builder
+	n := (len(values)-1)/step + 1
+	for i := 0; i < n; i++ {
+		x := 0.0
+		if n > 1 {
+			x = float64(i) / float64(n-1) * chartWidth
+		}
+		y := (hi - values[i*step]) / span * chartHeight
+		fmt.Fprintf(&pts, "%.1f,%.1f ", x, y)
+	}
+	return template.HTML(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="-60 -10 %d %d">`+
+		`<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`+
+		`<text x="-55" y="4" font-size="11">%s</text><text x="-55" y="%d" font-size="11">%s</text></svg>`,
+		chartWidth+70, chartHeight+20, chartWidth+70, chartHeight+20, color, strings.TrimSpace(pts.String()),
+		fmt.Sprintf(format, hi), chartHeight, fmt.Sprintf(format, lo)))
+}
@@ -0,0 +1,658 @@
+// Package config loads the engine configuration from a YAML or JSON file,
+// applies environment overrides and validates the result.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/backtest"
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/exchange"
+	"github.com/omept/trading-engine/pkg/notify"
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/omept/trading-engine/pkg/strategy"
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything needed to assemble the engine. API keys and exchange
+// secrets are not part of it, they stay with the secrets provider.
+type Config struct {
+	HTTPAddr string `json:"http_addr"`
+	GRPCAddr string `json:"grpc_addr"` // serves the gRPC API too when set, with the same TLS and API keys
+	TLS      TLS    `json:"tls"`
+	Limits   Limits `json:"limits"`
+
+	Store      Store           `json:"store"`
+	Exchange   Exchange        `json:"exchange"`
+	Risk       Risk            `json:"risk"`
+	Strategies []strategy.Spec `json:"strategies"`
+	Feeds      Feeds           `json:"feeds"`
+	Orders     Orders          `json:"orders"`
+	Session    Session         `json:"session"`
+	Backtest   Backtest        `json:"backtest"`
+	Shutdown   Shutdown        `json:"shutdown"`
+	Reconcile  Reconcile       `json:"reconcile"`
+	Notify     Notify          `json:"notify"`
+	Retention  Retention       `json:"retention"`
+	Reload     Reload          `json:"reload"`
+}
+
+// TLS serves the control API over HTTPS, from certificate files or
+// certificates obtained from Let's Encrypt. Empty serves plain HTTP.
+type TLS struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// AutocertHosts are the host names Let's Encrypt certificates are
+	// requested for, instead of cert and key files
+	AutocertHosts []string `json:"autocert_hosts"`
+	AutocertCache string   `json:"autocert_cache"` // directory obtained certificates are kept in
+	// AutocertHTTPAddr serves the HTTP-01 challenges of Let's Encrypt and
+	// redirects other plain HTTP requests to HTTPS. Empty leaves only the
+	// TLS-ALPN-01 challenge, answered on the control API's own port, which
+	// must then be 443.
+	AutocertHTTPAddr string `json:"autocert_http_addr"`
+	// ClientCAFile turns on mutual TLS, clients must present a certificate it signed
+	ClientCAFile string `json:"client_ca_file"`
+}
+
+// Enabled reports whether the control API is served over HTTPS
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || len(t.AutocertHosts) > 0
+}
+
+// Limits protect the control API from a misbehaving dashboard or scanner
+type Limits struct {
+	RatePerSecond float64 `json:"rate_per_second"` // requests per second of each client, 0 for no limit
+	Burst         int     `json:"burst"`           // requests a client may send at once
+	MaxBodyBytes  int     `json:"max_body_bytes"`  // largest request body accepted, 0 for no cap
+}
+
+type Store struct {
+	Driver          string   `json:"driver"` // sqlite | postgres
+	SQLitePath      string   `json:"sqlite_path"`
+	DatabaseURL     string   `json:"database_url"`
+	MaxOpenConns    int      `json:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+	// sqlite only
+	BusyTimeout Duration `json:"busy_timeout"` // how long a write waits for the database lock
+	CandleBatch int      `json:"candle_batch"` // candles written per transaction, 0 writes each as it arrives
+	CandleFlush Duration `json:"candle_flush"` // longest a batched candle waits to be written
+}
+
+type Exchange struct {
+	Name string `json:"name"` // MOCK | BINANCE | BINANCE_FUTURES | ALPACA | COINBASE | OANDA | REPLAY
+	// Paper streams market data from a live exchange but simulates orders
+	// and balances with the mock settings
+	Paper bool `json:"paper"`
+	// QuoteAsset is the balance counted as cash when valuing and
+	// reconciling the account, empty for the exchange's: USDT on Binance,
+	// the home currency on OANDA, USD elsewhere
+	QuoteAsset string `json:"quote_asset"`
+
+	Mock struct {
+		USDBalance float64                `json:"usd_balance"`
+		Chaos      *exchange.ChaosConfig  `json:"chaos,omitempty"`
+		Margin     *exchange.MarginConfig `json:"margin,omitempty"`
+		Fills      exchange.FillModel     `json:"fills"` // fees and slippage of simulated fills, also used by replay
+	} `json:"mock"`
+
+	Alpaca struct {
+		BaseURL string `json:"base_url"` // trading API, live or paper
+		DataURL string `json:"data_url"` // market data API the bars are polled from
+		Feed    string `json:"feed"`     // stock bars feed, iex or sip
+	} `json:"alpaca"`
+
+	Binance ExchangeBinance `json:"binance"`
+
+	Oanda ExchangeOanda `json:"oanda"`
+
+	// RateLimit overrides the request budget of the Binance, Alpaca,
+	// Coinbase and OANDA adapters, zero fields keep each exchange's published limits
+	RateLimit ExchangeRateLimit `json:"rate_limit"`
+
+	// Breaker pauses order submission after consecutive connectivity
+	// failures of the exchange until its health checks pass again
+	Breaker ExchangeBreaker `json:"circuit_breaker"`
+
+	// Health checks the connectivity, latency and clock drift of the
+	// exchange, reported in /api/status and /metrics
+	Health ExchangeHealth `json:"health"`
+
+	// Replay replays a recorded session, or with source candles the stored
+	// candles between From and To, at Speed times real time, 0 for unpaced
+	Replay struct {
+		Source  string    `json:"source"`  // session | candles
+		Session string    `json:"session"` // session id or "latest"
+		From    time.Time `json:"from,omitzero"`
+		To      time.Time `json:"to,omitzero"`
+		Speed   float64   `json:"speed"`
+	} `json:"replay"`
+}
+
+type Risk struct {
+	FixedPercent float64                 `json:"fixed_percent"` // fraction of capital risked per trade
+	Portfolio    engine.PortfolioLimits  `json:"portfolio"`     // exposure limits across all strategies
+	KillSwitch   engine.KillSwitchConfig `json:"kill_switch"`   // daily loss circuit breaker
+	Protection   engine.ProtectionConfig `json:"protection"`    // stop-loss and take-profit behind every position
+	// LiquidationBuffer warns when the mark price of a futures position comes
+	// within this fraction of the mark of its liquidation price, 0 for never
+	LiquidationBuffer float64 `json:"liquidation_buffer"`
+}
+
+type Feeds struct {
+	Backpressure string            `json:"backpressure"` // block | drop-oldest | conflate
+	Buffer       int               `json:"buffer"`
+	Symbols      map[string]string `json:"symbols,omitempty"` // per symbol backpressure
+}
+
+type Orders struct {
+	PollInterval   Duration  `json:"poll_interval"`
+	IdempotencyTTL Duration  `json:"idempotency_ttl"` // how long a client order id returns the order it placed, unless that order is final first
+	Algo           OrderAlgo `json:"algo"`
+	// orders over the max size of their symbol are placed as sequential smaller orders
+	MaxSize     map[string]decimal.Decimal `json:"max_order_size,omitempty"`
+	MarketHours OrderMarketHours           `json:"market_hours"`
+}
+
+// OrderMarketHours holds orders on equities to the sessions of their market
+type OrderMarketHours struct {
+	// Calendar is auto for the exchange's calendar when it serves one, as
+	// Alpaca does, nyse for the built-in NYSE calendar or off
+	Calendar string `json:"calendar"`
+	engine.MarketHoursConfig
+}
+
+// ExchangeBinance are the endpoints and signing settings of the Binance
+// spot and futures adapters
+type ExchangeBinance struct {
+	Testnet bool   `json:"testnet"`  // testnet.binance.vision or testnet.binancefuture.com, with their own API keys
+	BaseURL string `json:"base_url"` // REST API over the live or testnet one, e.g. a local mock server
+	WSURL   string `json:"ws_url"`   // WebSocket streams over the live or testnet ones
+	// RecvWindow is how long after its timestamp Binance accepts a
+	// signed request, 0 keeps Binance's default of 5s
+	RecvWindow Duration `json:"recv_window"`
+	// Leverage is set on every futures symbol before its first order, 0
+	// keeps the account's
+	Leverage int `json:"leverage"`
+}
+
+// URLs are the REST and WebSocket endpoints of the spot adapter, or of the
+// futures adapter, empty ones keep the live exchange
+func (b ExchangeBinance) URLs(futures bool) (base, ws string) {
+	switch {
+	case b.Testnet && futures:
+		base, ws = exchange.BinanceFuturesTestnetURL, exchange.BinanceFuturesTestnetWSURL
+	case b.Testnet:
+		base, ws = exchange.BinanceTestnetURL, exchange.BinanceTestnetWSURL
+	}
+	if b.BaseURL != "" {
+		base = b.BaseURL
+	}
+	if b.WSURL != "" {
+		ws = b.WSURL
+	}
+	return base, ws
+}
+
+// ExchangeOanda are the endpoints of the OANDA adapter, a practice account
+// unless Live
+type ExchangeOanda struct {
+	Live      bool   `json:"live"`       // api-fxtrade.oanda.com, with a live account's token
+	BaseURL   string `json:"base_url"`   // REST API over the practice or live one
+	StreamURL string `json:"stream_url"` // price streams over the practice or live ones
+}
+
+// URLs are the REST and streaming endpoints of the adapter
+func (o ExchangeOanda) URLs() (base, stream string) {
+	base, stream = exchange.OandaPracticeURL, exchange.OandaPracticeStreamURL
+	if o.Live {
+		base, stream = exchange.OandaLiveURL, exchange.OandaLiveStreamURL
+	}
+	if o.BaseURL != "" {
+		base = o.BaseURL
+	}
+	if o.StreamURL != "" {
+		stream = o.StreamURL
+	}
+	return base, stream
+}
+
+// ExchangeRateLimit is the request budget of a live exchange adapter
+type ExchangeRateLimit struct {
+	Window  Duration `json:"window"`
+	MaxWait Duration `json:"max_wait"` // requests that would queue longer fail
+	exchange.RateLimit
+}
+
+// Config is the adapters' rate limit config
+func (r ExchangeRateLimit) Config() exchange.RateLimit {
+	c := r.RateLimit
+	c.Window, c.MaxWait = r.Window.Std(), r.MaxWait.Std()
+	return c
+}
+
+// ExchangeBreaker is the circuit breaker around the exchange adapter
+type ExchangeBreaker struct {
+	ProbeEvery Duration `json:"probe_every"`
+	engine.BreakerConfig
+}
+
+// Config is the engine's circuit breaker config
+func (b ExchangeBreaker) Config() engine.BreakerConfig {
+	c := b.BreakerConfig
+	c.ProbeEvery = b.ProbeEvery.Std()
+	return c
+}
+
+// ExchangeHealth is the periodic health check of the exchange adapter
+type ExchangeHealth struct {
+	Every    Duration `json:"every"`     // 0 turns it off
+	MaxDrift Duration `json:"max_drift"` // clock drift that is warned about
+}
+
+// Config is the engine's health check config
+func (h ExchangeHealth) Config() engine.HealthConfig {
+	return engine.HealthConfig{Every: h.Every.Std(), MaxDrift: h.MaxDrift.Std()}
+}
+
+// OrderAlgo slices large strategy orders into child orders over a horizon
+type OrderAlgo struct {
+	Horizon Duration `json:"horizon"`
+	engine.AlgoConfig
+}
+
+// Config is the engine's algo config
+func (a OrderAlgo) Config() engine.AlgoConfig {
+	c := a.AlgoConfig
+	c.Horizon = a.Horizon.Std()
+	return c
+}
+
+type Session struct {
+	Record  bool   `json:"record"`
+	Restore string `json:"restore"` // snapshot id or "latest" to restore on boot
+	// Recover rebuilds positions, open orders, strategy history and runs
+	// from the store on boot, starting from the restore snapshot or the latest one
+	Recover bool `json:"recover"`
+	// EquityEvery is how often account equity is persisted for /api/equity, 0 for never
+	EquityEvery Duration `json:"equity_every"`
+	// StateEvery is how often strategy state is saved for the next start,
+	// 0 saves it on shutdown only
+	StateEvery Duration `json:"state_every"`
+}
+
+type Backtest struct {
+	USDBalance float64            `json:"usd_balance"`
+	Fills      exchange.FillModel `json:"fills"` // fees and slippage, backtest requests can override each field
+	// MonteCarlo resamples each backtest's trades for confidence intervals
+	// of its final equity and drawdown
+	MonteCarlo backtest.MonteCarloConfig `json:"monte_carlo"`
+}
+
+type Shutdown struct {
+	CancelOrders bool     `json:"cancel_orders"`
+	Timeout      Duration `json:"timeout"`
+}
+
+// Reconcile compares local orders, positions and balances with the exchange
+type Reconcile struct {
+	Every Duration `json:"every"` // 0 only reconciles on demand through the API
+	engine.ReconcileConfig
+}
+
+// Notify sends alerts to operators, each channel with its own event filters
+type Notify struct {
+	Channels     []notify.ChannelConfig `json:"channels"`
+	EventWebhook EventWebhook           `json:"event_webhook"`
+}
+
+// EventWebhook posts every order update and trade as signed JSON, for
+// portfolio trackers and other systems outside the engine. Empty URL turns it off.
+type EventWebhook struct {
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret"`       // HMAC-SHA256 key of the X-Event-Signature header
+	MaxAttempts int      `json:"max_attempts"` // tries per event before it is dropped
+	Backoff     Duration `json:"backoff"`      // wait before the first retry, doubled for each next one
+}
+
+// Retention prunes old data from the store so it does not grow without
+// bound. Zero ages keep data forever, which is the default.
+type Retention struct {
+	Every         Duration          `json:"every"`   // how often compaction runs, 0 for never
+	Candles       []CandleRetention `json:"candles"` // e.g. keep 1m candles 90d, rolled up to 1h
+	Trades        Duration          `json:"trades"`  // trades and the orders that are final
+	SessionEvents Duration          `json:"session_events"`
+	Equity        Duration          `json:"equity"`
+}
+
+// Reload applies edits of the config file to the running engine. Risk
+// settings, strategies and alert channels change in place, other settings
+// take effect on the next start.
+type Reload struct {
+	Watch Duration `json:"watch"` // how often the config file is checked for changes, 0 for never
+}
+
+// CandleRetention keeps candles of one interval for Keep, rolling them up
+// to the RollUp interval first when it is set
+type CandleRetention struct {
+	Interval Duration `json:"interval"`
+	Keep     Duration `json:"keep"`
+	RollUp   Duration `json:"roll_up"`
+}
+
+// Policy is the store retention policy of r
+func (r Retention) Policy() store.RetentionPolicy {
+	p := store.RetentionPolicy{
+		Trades:        r.Trades.Std(),
+		SessionEvents: r.SessionEvents.Std(),
+		Equity:        r.Equity.Std(),
+	}
+	for _, c := range r.Candles {
+		p.Candles = append(p.Candles, store.CandleRetention{
+			Interval: int64(c.Interval.Std() / time.Second),
+			Keep:     c.Keep.Std(),
+			RollUp:   int64(c.RollUp.Std() / time.Second),
+		})
+	}
+	return p
+}
+
+// Default returns the configuration the engine runs with when nothing is set
+func Default() *Config {
+	c := &Config{HTTPAddr: ":8080"}
+	c.TLS.AutocertCache = "certs"
+	c.TLS.AutocertHTTPAddr = ":80"
+	c.Limits.RatePerSecond = 20
+	c.Limits.Burst = 40
+	c.Limits.MaxBodyBytes = 1 << 20
+	c.Store.Driver = "sqlite"
+	c.Store.SQLitePath = "engine.db"
+	c.Store.BusyTimeout = Duration(5 * time.Second)
+	c.Store.CandleBatch = 100
+	c.Store.CandleFlush = Duration(time.Second)
+	c.Exchange.Name = "MOCK"
+	c.Exchange.Mock.USDBalance = 100000
+	c.Exchange.Alpaca.BaseURL = "https://paper-api.alpaca.markets"
+	c.Exchange.Alpaca.DataURL = exchange.AlpacaDataURL
+	c.Exchange.Alpaca.Feed = exchange.AlpacaFeedIEX
+	c.Exchange.Breaker.Failures = 5
+	c.Exchange.Breaker.Probes = 2
+	c.Exchange.Breaker.ProbeEvery = Duration(10 * time.Second)
+	c.Exchange.Health.Every = Duration(30 * time.Second)
+	c.Exchange.Health.MaxDrift = Duration(time.Second)
+	c.Exchange.Replay.Source = "session"
+	c.Exchange.Replay.Session = "latest"
+	c.Exchange.Replay.Speed = 1
+	c.Risk.FixedPercent = 0.005
+	c.Risk.LiquidationBuffer = 0.1
+	c.Strategies = []strategy.Spec{
+		{Type: strategy.TypeEMA, Symbol: "BTCUSD", Capital: 300},
+		{Type: strategy.TypeMeanReversion, Symbol: "BTCUSD", Capital: 300},
+	}
+	c.Feeds.Backpressure = string(engine.BackpressureBlock)
+	c.Orders.PollInterval = Duration(2 * time.Second)
+	c.Orders.IdempotencyTTL = Duration(10 * time.Minute)
+	c.Orders.Algo.Horizon = Duration(10 * time.Minute)
+	c.Orders.Algo.Slices = 10
+	c.Orders.Algo.MinNotional = decimal.NewFromInt(10000)
+	c.Orders.MarketHours.Calendar = "auto"
+	c.Session.EquityEvery = Duration(time.Minute)
+	c.Session.StateEvery = Duration(time.Minute)
+	c.Session.Recover = true
+	c.Backtest.USDBalance = 100000
+	c.Backtest.MonteCarlo = backtest.MonteCarloConfig{Runs: 1000, Confidence: backtest.DefaultConfidence}
+	c.Shutdown.Timeout = Duration(30 * time.Second)
+	c.Reconcile.Every = Duration(5 * time.Minute)
+	c.Notify.EventWebhook.MaxAttempts = 5
+	c.Notify.EventWebhook.Backoff = Duration(time.Second)
+	c.Retention.Every = Duration(time.Hour)
+	return c
+}
+
+// Load reads path over the defaults, applies environment overrides and
+// validates the result. An empty path uses defaults and environment only.
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path != "" {
+		if err := c.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.ApplyEnv(os.Getenv); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// readFile decodes a YAML or JSON file into c. YAML is converted to JSON
+// first so both formats share the json tags and unknown keys are rejected.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".json" {
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("config %s: %w", path, err)
+		}
+		if raw == nil {
+			return nil
+		}
+		if data, err = json.Marshal(raw); err != nil {
+			return fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.HTTPAddr != "", "http_addr is required")
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	check(c.TLS.CertFile == "" || len(c.TLS.AutocertHosts) == 0, "tls.autocert_hosts cannot be combined with tls.cert_file")
+	check(c.TLS.ClientCAFile == "" || c.TLS.Enabled(), "tls.client_ca_file needs a certificate or tls.autocert_hosts")
+	check(c.Limits.RatePerSecond >= 0, "limits.rate_per_second must not be negative")
+	check(c.Limits.RatePerSecond == 0 || c.Limits.Burst > 0, "limits.burst must be positive")
+	check(c.Limits.MaxBodyBytes >= 0, "limits.max_body_bytes must not be negative")
+
+	switch c.Store.Driver {
+	case "sqlite":
+		check(c.Store.SQLitePath != "", "store.sqlite_path is required for the sqlite driver")
+		check(c.Store.CandleBatch >= 0, "store.candle_batch must not be negative")
+	case "postgres":
+		check(c.Store.DatabaseURL != "", "store.database_url is required for the postgres driver")
+	default:
+		check(false, "store.driver %q must be sqlite or postgres", c.Store.Driver)
+	}
+
+	check(c.Retention.Every >= 0, "retention.every must not be negative")
+	check(c.Reload.Watch >= 0, "reload.watch must not be negative")
+	check(c.Retention.Trades >= 0 && c.Retention.SessionEvents >= 0 && c.Retention.Equity >= 0,
+		"retention.trades, retention.session_events and retention.equity must not be negative")
+	kept := map[Duration]bool{}
+	for i, r := range c.Retention.Candles {
+		check(r.Interval >= Duration(time.Second) && r.Interval%Duration(time.Second) == 0,
+			"retention.candles[%d].interval must be a whole number of seconds", i)
+		check(r.Keep > 0, "retention.candles[%d].keep must be positive", i)
+		check(r.RollUp == 0 || (r.RollUp > r.Interval && r.Interval > 0 && r.RollUp%r.Interval == 0),
+			"retention.candles[%d].roll_up must be a multiple of interval larger than it", i)
+		check(!kept[r.Interval], "retention.candles[%d]: interval %s has a rule already", i, r.Interval.Std())
+		kept[r.Interval] = true
+	}
+
+	switch c.Exchange.Name {
+	case "MOCK", "BINANCE", "BINANCE_FUTURES", "ALPACA", "COINBASE", "OANDA", "REPLAY":
+	default:
+		check(false, "exchange.name %q must be MOCK, BINANCE, BINANCE_FUTURES, ALPACA, COINBASE, OANDA or REPLAY", c.Exchange.Name)
+	}
+	check(c.Exchange.Mock.USDBalance > 0, "exchange.mock.usd_balance must be positive")
+	err := c.Exchange.Mock.Fills.Validate()
+	check(err == nil, "exchange.mock.fills: %v", err)
+	rp := c.Exchange.Replay
+	check(rp.Source == "session" || rp.Source == "candles", "exchange.replay.source %q must be session or candles", rp.Source)
+	check(rp.Speed == 0 || rp.Speed >= 1 && rp.Speed <= 1000, "exchange.replay.speed must be between 1 and 1000, or 0 for unpaced")
+	check(rp.To.IsZero() || rp.From.Before(rp.To), "exchange.replay.from must be before exchange.replay.to")
+	ap := c.Exchange.Alpaca
+	check(ap.BaseURL == "" || strings.HasPrefix(ap.BaseURL, "http://") || strings.HasPrefix(ap.BaseURL, "https://"), "exchange.alpaca.base_url %q must be an http or https URL", ap.BaseURL)
+	check(ap.DataURL == "" || strings.HasPrefix(ap.DataURL, "http://") || strings.HasPrefix(ap.DataURL, "https://"), "exchange.alpaca.data_url %q must be an http or https URL", ap.DataURL)
+	switch strings.ToLower(ap.Feed) {
+	case "", exchange.AlpacaFeedIEX, exchange.AlpacaFeedSIP:
+	default:
+		check(false, "exchange.alpaca.feed %q must be iex or sip", ap.Feed)
+	}
+	bn := c.Exchange.Binance
+	check(bn.BaseURL == "" || strings.HasPrefix(bn.BaseURL, "http://") || strings.HasPrefix(bn.BaseURL, "https://"), "exchange.binance.base_url %q must be an http or https URL", bn.BaseURL)
+	check(bn.WSURL == "" || strings.HasPrefix(bn.WSURL, "ws://") || strings.HasPrefix(bn.WSURL, "wss://"), "exchange.binance.ws_url %q must be a ws or wss URL", bn.WSURL)
+	check(bn.Leverage >= 0 && bn.Leverage <= exchange.MaxBinanceLeverage, "exchange.binance.leverage must be between 0 and %d", exchange.MaxBinanceLeverage)
+	rw := bn.RecvWindow.Std()
+	check(rw >= 0 && rw <= exchange.MaxBinanceRecvWindow, "exchange.binance.recv_window must be between 0 and %s", exchange.MaxBinanceRecvWindow)
+	oa := c.Exchange.Oanda
+	check(oa.BaseURL == "" || strings.HasPrefix(oa.BaseURL, "http://") || strings.HasPrefix(oa.BaseURL, "https://"), "exchange.oanda.base_url %q must be an http or https URL", oa.BaseURL)
+	check(oa.StreamURL == "" || strings.HasPrefix(oa.StreamURL, "http://") || strings.HasPrefix(oa.StreamURL, "https://"), "exchange.oanda.stream_url %q must be an http or https URL", oa.StreamURL)
+	rl := c.Exchange.RateLimit
+	check(rl.Capacity >= 0, "exchange.rate_limit.capacity must not be negative")
+	check(rl.Window >= 0, "exchange.rate_limit.window must not be negative")
+	check(rl.MaxWait >= 0, "exchange.rate_limit.max_wait must not be negative")
+	for ep, w := range rl.Weights {
+		check(w > 0, "exchange.rate_limit.weights[%q] must be positive", ep)
+	}
+	br := c.Exchange.Breaker
+	check(br.Failures >= 0, "exchange.circuit_breaker.failures must not be negative")
+	check(br.Probes >= 0, "exchange.circuit_breaker.probes must not be negative")
+	check(br.ProbeEvery >= 0, "exchange.circuit_breaker.probe_every must not be negative")
+	check(c.Exchange.Health.Every >= 0, "exchange.health.every must not be negative")
+	check(c.Exchange.Health.MaxDrift >= 0, "exchange.health.max_drift must not be negative")
+
+	check(c.Risk.FixedPercent > 0 && c.Risk.FixedPercent < 1, "risk.fixed_percent must be between 0 and 1")
+	pl := c.Risk.Portfolio
+	check(!pl.MaxTotal.IsNegative(), "risk.portfolio.max_total_usd must not be negative")
+	check(!pl.MaxPerSymbol.IsNegative(), "risk.portfolio.max_symbol_usd must not be negative")
+	for sym, v := range pl.Symbols {
+		check(!v.IsNegative(), "risk.portfolio.symbols.%s must not be negative", sym)
+	}
+	check(!c.Risk.KillSwitch.DailyLossLimit.IsNegative(), "risk.kill_switch.daily_loss_limit_usd must not be negative")
+	check(c.Risk.Protection.StopLoss >= 0 && c.Risk.Protection.StopLoss < 1, "risk.protection.stop_loss must be between 0 and 1")
+	check(c.Risk.Protection.TakeProfit >= 0, "risk.protection.take_profit must not be negative")
+	check(c.Risk.LiquidationBuffer >= 0 && c.Risk.LiquidationBuffer < 1, "risk.liquidation_buffer must be between 0 and 1")
+
+	// names attribute orders, fills and snapshots to one instance
+	names := map[string]bool{}
+	for i, spec := range c.Strategies {
+		st, err := strategy.New(spec, nil, nil)
+		if err != nil {
+			check(false, "strategies[%d]: %v", i, err)
+			continue
+		}
+		check(!names[st.Name()], "strategies[%d]: name %q is already used, give the instance a unique name", i, st.Name())
+		names[st.Name()] = true
+		if spec.Sizing != nil {
+			_, err := engine.NewRiskManager(*spec.Sizing, c.Risk.FixedPercent, nil)
+			check(err == nil, "strategies[%d]: %v", i, err)
+		}
+	}
+
+	_, err = engine.ParseBackpressurePolicy(c.Feeds.Backpressure)
+	check(err == nil, "feeds.backpressure: %v", err)
+	for sym, p := range c.Feeds.Symbols {
+		_, err := engine.ParseBackpressurePolicy(p)
+		check(err == nil, "feeds.symbols.%s: %v", sym, err)
+	}
+	check(c.Feeds.Buffer >= 0, "feeds.buffer must not be negative")
+
+	check(c.Orders.PollInterval > 0, "orders.poll_interval must be positive")
+	check(c.Orders.IdempotencyTTL > 0, "orders.idempotency_ttl must be positive")
+	err = c.Orders.Algo.Config().Validate()
+	check(err == nil, "orders.algo: %v", err)
+	for sym, max := range c.Orders.MaxSize {
+		check(max.IsPositive(), "orders.max_order_size.%s must be positive", sym)
+	}
+	switch c.Orders.MarketHours.Calendar {
+	case "auto", "nyse", "off":
+	default:
+		check(false, "orders.market_hours.calendar %q must be auto, nyse or off", c.Orders.MarketHours.Calendar)
+	}
+	check(c.Session.EquityEvery >= 0, "session.equity_every must not be negative")
+	check(c.Session.StateEvery >= 0, "session.state_every must not be negative")
+	check(c.Backtest.USDBalance > 0, "backtest.usd_balance must be positive")
+	err = c.Backtest.Fills.Validate()
+	check(err == nil, "backtest.fills: %v", err)
+	err = c.Backtest.MonteCarlo.Validate()
+	check(err == nil, "backtest.monte_carlo: %v", err)
+	check(c.Shutdown.Timeout > 0, "shutdown.timeout must be positive")
+	check(c.Reconcile.Every >= 0, "reconcile.every must not be negative")
+	check(!c.Reconcile.CashTolerance.IsNegative(), "reconcile.cash_tolerance_usd must not be negative")
+	for i, ch := range c.Notify.Channels {
+		err := ch.Validate()
+		check(err == nil, "notify.channels[%d]: %v", i, err)
+	}
+	check(c.Notify.EventWebhook.MaxAttempts > 0, "notify.event_webhook.max_attempts must be positive")
+	check(c.Notify.EventWebhook.Backoff >= 0, "notify.event_webhook.backoff must not be negative")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Duration is a time.Duration written as a string such as "30s", "5m" or
+// "90d", days being 24 hours
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\": %s", b)
+	}
+	v, err := parseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// parseDuration parses a Go duration or a whole number of days such as "90d"
+func parseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("time: invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
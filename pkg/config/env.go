@@ -0,0 +1,290 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/exchange"
+	"github.com/omept/trading-engine/pkg/strategy"
+	"github.com/shopspring/decimal"
+)
+
+// ApplyEnv overrides file settings with the environment variables the engine
+// has always read. Unset variables leave the setting alone.
+func (c *Config) ApplyEnv(getenv func(string) string) error {
+	var errs []string
+	str := func(name string, dst *string) {
+		if v := getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	float := func(name string, dst *float64) {
+		v := getenv(name)
+		if v == "" {
+			return
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		*dst = f
+	}
+	integer := func(name string, dst *int) {
+		v := getenv(name)
+		if v == "" {
+			return
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		*dst = n
+	}
+	duration := func(name string, dst *Duration) {
+		v := getenv(name)
+		if v == "" {
+			return
+		}
+		d, err := parseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		*dst = Duration(d)
+	}
+	timestamp := func(name string, dst *time.Time) {
+		v := getenv(name)
+		if v == "" {
+			return
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		*dst = t
+	}
+	dec := func(name string, dst *decimal.Decimal) {
+		v := getenv(name)
+		if v == "" {
+			return
+		}
+		d, err := decimal.NewFromString(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		*dst = d
+	}
+	flag := func(name string, dst *bool) {
+		if v := getenv(name); v != "" {
+			*dst = v == "1"
+		}
+	}
+
+	str("HTTP_ADDR", &c.HTTPAddr)
+	str("GRPC_ADDR", &c.GRPCAddr)
+	str("TLS_CERT_FILE", &c.TLS.CertFile)
+	str("TLS_KEY_FILE", &c.TLS.KeyFile)
+	if v := getenv("TLS_AUTOCERT_HOSTS"); v != "" {
+		c.TLS.AutocertHosts = nil
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				c.TLS.AutocertHosts = append(c.TLS.AutocertHosts, h)
+			}
+		}
+	}
+	str("TLS_AUTOCERT_CACHE", &c.TLS.AutocertCache)
+	str("TLS_AUTOCERT_HTTP_ADDR", &c.TLS.AutocertHTTPAddr)
+	str("TLS_CLIENT_CA_FILE", &c.TLS.ClientCAFile)
+	float("API_RATE_LIMIT", &c.Limits.RatePerSecond)
+	integer("API_RATE_BURST", &c.Limits.Burst)
+	integer("API_MAX_BODY_BYTES", &c.Limits.MaxBodyBytes)
+
+	if v := getenv("STORE_DRIVER"); v != "" {
+		c.Store.Driver = strings.ToLower(v)
+	}
+	str("SQLITE_FILE_DIR", &c.Store.SQLitePath)
+	str("DATABASE_URL", &c.Store.DatabaseURL)
+	integer("DB_MAX_OPEN_CONNS", &c.Store.MaxOpenConns)
+	integer("DB_MAX_IDLE_CONNS", &c.Store.MaxIdleConns)
+	duration("DB_CONN_MAX_LIFETIME", &c.Store.ConnMaxLifetime)
+	duration("SQLITE_BUSY_TIMEOUT", &c.Store.BusyTimeout)
+	integer("SQLITE_CANDLE_BATCH", &c.Store.CandleBatch)
+	duration("SQLITE_CANDLE_FLUSH", &c.Store.CandleFlush)
+
+	str("EXCHANGE", &c.Exchange.Name)
+	flag("PAPER", &c.Exchange.Paper)
+	str("EXCHANGE_QUOTE_ASSET", &c.Exchange.QuoteAsset)
+	float("MOCK_EXCHANGE_USD_BAL", &c.Exchange.Mock.USDBalance)
+	if v := getenv("MOCK_CHAOS"); v != "" {
+		var cfg exchange.ChaosConfig
+		if err := json.Unmarshal([]byte(v), &cfg); err != nil {
+			errs = append(errs, fmt.Sprintf("MOCK_CHAOS: %v", err))
+		}
+		c.Exchange.Mock.Chaos = &cfg
+	}
+	if v := getenv("MOCK_MARGIN"); v != "" {
+		var cfg exchange.MarginConfig
+		if err := json.Unmarshal([]byte(v), &cfg); err != nil {
+			errs = append(errs, fmt.Sprintf("MOCK_MARGIN: %v", err))
+		}
+		c.Exchange.Mock.Margin = &cfg
+	}
+	if v := getenv("MOCK_FILLS"); v != "" {
+		if err := json.Unmarshal([]byte(v), &c.Exchange.Mock.Fills); err != nil {
+			errs = append(errs, fmt.Sprintf("MOCK_FILLS: %v", err))
+		}
+	}
+	str("ALPACA_BASE_URL", &c.Exchange.Alpaca.BaseURL)
+	str("ALPACA_DATA_URL", &c.Exchange.Alpaca.DataURL)
+	str("ALPACA_FEED", &c.Exchange.Alpaca.Feed)
+	flag("BINANCE_TESTNET", &c.Exchange.Binance.Testnet)
+	str("BINANCE_BASE_URL", &c.Exchange.Binance.BaseURL)
+	str("BINANCE_WS_URL", &c.Exchange.Binance.WSURL)
+	duration("BINANCE_RECV_WINDOW", &c.Exchange.Binance.RecvWindow)
+	integer("BINANCE_LEVERAGE", &c.Exchange.Binance.Leverage)
+	flag("OANDA_LIVE", &c.Exchange.Oanda.Live)
+	str("OANDA_BASE_URL", &c.Exchange.Oanda.BaseURL)
+	str("OANDA_STREAM_URL", &c.Exchange.Oanda.StreamURL)
+	integer("EXCHANGE_RATE_LIMIT", &c.Exchange.RateLimit.Capacity)
+	duration("EXCHANGE_RATE_LIMIT_WINDOW", &c.Exchange.RateLimit.Window)
+	duration("EXCHANGE_RATE_LIMIT_MAX_WAIT", &c.Exchange.RateLimit.MaxWait)
+	if v := getenv("EXCHANGE_RATE_LIMIT_WEIGHTS"); v != "" {
+		if err := json.Unmarshal([]byte(v), &c.Exchange.RateLimit.Weights); err != nil {
+			errs = append(errs, fmt.Sprintf("EXCHANGE_RATE_LIMIT_WEIGHTS: %v", err))
+		}
+	}
+	integer("EXCHANGE_BREAKER_FAILURES", &c.Exchange.Breaker.Failures)
+	integer("EXCHANGE_BREAKER_PROBES", &c.Exchange.Breaker.Probes)
+	duration("EXCHANGE_BREAKER_PROBE_EVERY", &c.Exchange.Breaker.ProbeEvery)
+	duration("EXCHANGE_HEALTH_EVERY", &c.Exchange.Health.Every)
+	duration("EXCHANGE_MAX_CLOCK_DRIFT", &c.Exchange.Health.MaxDrift)
+	str("REPLAY_SOURCE", &c.Exchange.Replay.Source)
+	str("REPLAY_SESSION", &c.Exchange.Replay.Session)
+	timestamp("REPLAY_FROM", &c.Exchange.Replay.From)
+	timestamp("REPLAY_TO", &c.Exchange.Replay.To)
+	if getenv("REPLAY_SPEED") == "max" {
+		c.Exchange.Replay.Speed = exchange.ReplayUnpaced
+	} else {
+		float("REPLAY_SPEED", &c.Exchange.Replay.Speed)
+	}
+
+	float("FIXED_DECIMAL_PERCENT_RISK", &c.Risk.FixedPercent)
+	dec("MAX_TOTAL_EXPOSURE_USD", &c.Risk.Portfolio.MaxTotal)
+	dec("MAX_SYMBOL_EXPOSURE_USD", &c.Risk.Portfolio.MaxPerSymbol)
+	flag("EXPOSURE_SCALE_DOWN", &c.Risk.Portfolio.ScaleDown)
+	dec("DAILY_LOSS_LIMIT_USD", &c.Risk.KillSwitch.DailyLossLimit)
+	flag("KILL_SWITCH_FLATTEN", &c.Risk.KillSwitch.Flatten)
+	float("STOP_LOSS_PERCENT", &c.Risk.Protection.StopLoss)
+	float("TAKE_PROFIT_PERCENT", &c.Risk.Protection.TakeProfit)
+	flag("TRAILING_STOP", &c.Risk.Protection.Trailing)
+	float("LIQUIDATION_BUFFER", &c.Risk.LiquidationBuffer)
+
+	// symbol overrides apply to every instance of a type, capital to every instance
+	for i := range c.Strategies {
+		spec := &c.Strategies[i]
+		switch spec.Type {
+		case strategy.TypeEMA:
+			str("EMAC_CROSSOVER_STRATEGY", &spec.Symbol)
+		case strategy.TypeMeanReversion:
+			str("MEAN_REVERSION_CROSSOVER_STRATEGY", &spec.Symbol)
+		}
+		float("ACCOUNT_USD_BAL", &spec.Capital)
+	}
+
+	str("CANDLE_BACKPRESSURE", &c.Feeds.Backpressure)
+	integer("CANDLE_BUFFER", &c.Feeds.Buffer)
+	for _, spec := range c.Strategies {
+		sym := spec.Symbol
+		if v := getenv("CANDLE_BACKPRESSURE_" + sym); v != "" {
+			if c.Feeds.Symbols == nil {
+				c.Feeds.Symbols = map[string]string{}
+			}
+			c.Feeds.Symbols[sym] = v
+		}
+	}
+
+	duration("ORDER_POLL_INTERVAL", &c.Orders.PollInterval)
+	duration("ORDER_IDEMPOTENCY_TTL", &c.Orders.IdempotencyTTL)
+	str("ORDER_ALGO", &c.Orders.Algo.Method)
+	duration("ORDER_ALGO_HORIZON", &c.Orders.Algo.Horizon)
+	integer("ORDER_ALGO_SLICES", &c.Orders.Algo.Slices)
+	dec("ORDER_ALGO_MIN_NOTIONAL_USD", &c.Orders.Algo.MinNotional)
+	for _, spec := range c.Strategies {
+		sym := spec.Symbol
+		if getenv("MAX_ORDER_SIZE_"+sym) == "" {
+			continue
+		}
+		if c.Orders.MaxSize == nil {
+			c.Orders.MaxSize = map[string]decimal.Decimal{}
+		}
+		max := c.Orders.MaxSize[sym]
+		dec("MAX_ORDER_SIZE_"+sym, &max)
+		c.Orders.MaxSize[sym] = max
+	}
+	if v := getenv("MARKET_CALENDAR"); v != "" {
+		c.Orders.MarketHours.Calendar = strings.ToLower(v)
+	}
+	if v := getenv("MARKET_HOURS_SYMBOLS"); v != "" {
+		c.Orders.MarketHours.Symbols = nil
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				c.Orders.MarketHours.Symbols = append(c.Orders.MarketHours.Symbols, s)
+			}
+		}
+	}
+	flag("MARKET_QUEUE_FOR_OPEN", &c.Orders.MarketHours.QueueForOpen)
+	flag("RECORD_SESSION", &c.Session.Record)
+	str("RESTORE_SNAPSHOT", &c.Session.Restore)
+	flag("RECOVER_STATE", &c.Session.Recover)
+	duration("EQUITY_EVERY", &c.Session.EquityEvery)
+	duration("STATE_EVERY", &c.Session.StateEvery)
+	float("BACKTEST_USD_BAL", &c.Backtest.USDBalance)
+	if v := getenv("BACKTEST_FILLS"); v != "" {
+		if err := json.Unmarshal([]byte(v), &c.Backtest.Fills); err != nil {
+			errs = append(errs, fmt.Sprintf("BACKTEST_FILLS: %v", err))
+		}
+	}
+	if v := getenv("BACKTEST_MONTE_CARLO"); v != "" {
+		if err := json.Unmarshal([]byte(v), &c.Backtest.MonteCarlo); err != nil {
+			errs = append(errs, fmt.Sprintf("BACKTEST_MONTE_CARLO: %v", err))
+		}
+	}
+	flag("SHUTDOWN_CANCEL_ORDERS", &c.Shutdown.CancelOrders)
+	duration("SHUTDOWN_TIMEOUT", &c.Shutdown.Timeout)
+	duration("RECONCILE_EVERY", &c.Reconcile.Every)
+	flag("RECONCILE_AUTO_CORRECT", &c.Reconcile.AutoCorrect)
+	dec("RECONCILE_CASH_TOLERANCE_USD", &c.Reconcile.CashTolerance)
+	if v := getenv("NOTIFY_CHANNELS"); v != "" {
+		c.Notify.Channels = nil
+		if err := json.Unmarshal([]byte(v), &c.Notify.Channels); err != nil {
+			errs = append(errs, fmt.Sprintf("NOTIFY_CHANNELS: %v", err))
+		}
+	}
+	str("EVENT_WEBHOOK_URL", &c.Notify.EventWebhook.URL)
+	str("EVENT_WEBHOOK_SECRET", &c.Notify.EventWebhook.Secret)
+	integer("EVENT_WEBHOOK_MAX_ATTEMPTS", &c.Notify.EventWebhook.MaxAttempts)
+	duration("EVENT_WEBHOOK_BACKOFF", &c.Notify.EventWebhook.Backoff)
+	duration("RETENTION_EVERY", &c.Retention.Every)
+	if v := getenv("RETENTION_CANDLES"); v != "" {
+		c.Retention.Candles = nil
+		if err := json.Unmarshal([]byte(v), &c.Retention.Candles); err != nil {
+			errs = append(errs, fmt.Sprintf("RETENTION_CANDLES: %v", err))
+		}
+	}
+	duration("RETENTION_TRADES", &c.Retention.Trades)
+	duration("RETENTION_SESSION_EVENTS", &c.Retention.SessionEvents)
+	duration("RETENTION_EQUITY", &c.Retention.Equity)
+	duration("CONFIG_WATCH", &c.Reload.Watch)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config env: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
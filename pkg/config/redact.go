@@ -0,0 +1,57 @@
+package config
+
+import "fmt"
+
+// Redacted stands in for the secrets of a config shown through the API
+const Redacted = "REDACTED"
+
+// secrets lists the settings of c that hold secrets by their config key
+func (c *Config) secrets() map[string]*string {
+	out := map[string]*string{
+		"store.database_url":          &c.Store.DatabaseURL,
+		"notify.event_webhook.secret": &c.Notify.EventWebhook.Secret,
+	}
+	for i := range c.Notify.Channels {
+		ch := &c.Notify.Channels[i]
+		out[fmt.Sprintf("notify.channels[%d].url", i)] = &ch.URL
+		out[fmt.Sprintf("notify.channels[%d].bot_token", i)] = &ch.BotToken
+		out[fmt.Sprintf("notify.channels[%d].password", i)] = &ch.Password
+	}
+	return out
+}
+
+// Redact replaces the secrets c holds with Redacted: the database URL, the
+// event webhook key and the URLs, tokens and passwords of alert channels
+func (c *Config) Redact() {
+	for _, s := range c.secrets() {
+		if *s != "" {
+			*s = Redacted
+		}
+	}
+}
+
+// KeepSecrets puts the secrets of prev back where c holds Redacted, so a
+// config read through the API can be sent back changed. A redacted secret
+// of an alert channel prev does not have at the same place, with the same
+// type, is an error.
+func (c *Config) KeepSecrets(prev *Config) error {
+	kept := prev.secrets()
+	for i, ch := range prev.Notify.Channels {
+		if i >= len(c.Notify.Channels) || c.Notify.Channels[i].Type != ch.Type {
+			for _, k := range []string{"url", "bot_token", "password"} {
+				delete(kept, fmt.Sprintf("notify.channels[%d].%s", i, k))
+			}
+		}
+	}
+	for key, s := range c.secrets() {
+		if *s != Redacted {
+			continue
+		}
+		p, ok := kept[key]
+		if !ok || *p == "" {
+			return fmt.Errorf("%s is %s, send the secret itself", key, Redacted)
+		}
+		*s = *p
+	}
+	return nil
+}
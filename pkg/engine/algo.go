@@ -0,0 +1,448 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// Execution algorithms slicing large orders over time
+const (
+	AlgoTWAP = "twap" // equal child orders at equal intervals
+	AlgoVWAP = "vwap" // child orders following the volume traded over the same window a day earlier
+)
+
+// AlgoConfig has orders of at least MinNotional worked by an execution
+// algorithm: split into Slices child orders spread over Horizon
+type AlgoConfig struct {
+	Method      string          `json:"method"`           // twap or vwap, "" places every order whole
+	Slices      int             `json:"slices"`           // child orders per parent order
+	MinNotional decimal.Decimal `json:"min_notional_usd"` // smaller orders are placed whole
+	Horizon     time.Duration   `json:"-"`                // the children are spread over
+}
+
+// Validate checks c
+func (c AlgoConfig) Validate() error {
+	switch c.Method {
+	case "":
+		return nil
+	case AlgoTWAP, AlgoVWAP:
+	default:
+		return fmt.Errorf("unknown method %q, known: %s, %s", c.Method, AlgoTWAP, AlgoVWAP)
+	}
+	if c.Slices < 2 {
+		return fmt.Errorf("slices must be at least 2, got %d", c.Slices)
+	}
+	if c.Horizon <= 0 {
+		return fmt.Errorf("horizon must be positive")
+	}
+	if c.MinNotional.IsNegative() {
+		return fmt.Errorf("min_notional_usd must not be negative")
+	}
+	return nil
+}
+
+// AlgoOrder is a parent order worked by an execution algorithm, or split
+// under the max order size of its symbol. Its FilledQty, FilledPrice and Fee
+// add up the fills of its children.
+type AlgoOrder struct {
+	Order
+	Method   string
+	Start    time.Time
+	End      time.Time // when the last child is due, zero for splits
+	Children []Order   // latest state of each child placed so far
+	Done     bool      // no more children will be placed
+	stopped  bool      // canceled or a child failed before the last slice
+	failed   bool      // a child could not be placed
+	cancel   context.CancelFunc
+	settled  chan struct{} // gets a value whenever a child turns final
+}
+
+// SetAlgo has orders submitted through AlgoExecutor that are large enough
+// worked by the execution algorithm of cfg
+func (om *OrderManager) SetAlgo(cfg AlgoConfig) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.algo = cfg
+}
+
+// AlgoExecutor returns the executor of strategy orders: orders of at least
+// the algo's minimum notional are sliced into child orders placed over its
+// horizon, the others and bracketed orders are submitted whole. Exits of
+// the protection and the kill switch submit to the order manager directly
+// and are never sliced.
+func (om *OrderManager) AlgoExecutor() OrderExecutor {
+	return algoExecutor{om}
+}
+
+type algoExecutor struct {
+	om *OrderManager
+}
+
+func (x algoExecutor) Submit(ctx context.Context, o Order) (Order, error) {
+	om := x.om
+	om.mt.Lock()
+	cfg, prices := om.algo, om.prices
+	om.mt.Unlock()
+	if cfg.Method == "" || o.Bracket != nil {
+		return om.Submit(ctx, o)
+	}
+	price := o.Price
+	if !price.IsPositive() && prices != nil {
+		price, _ = prices.LastPrice(o.Symbol)
+	}
+	if !price.IsPositive() || o.Quantity.Mul(price).LessThan(cfg.MinNotional) {
+		return om.Submit(ctx, o)
+	}
+	return om.startAlgo(ctx, cfg, o, price)
+}
+
+// startAlgo registers o as a parent order and works it in the background
+func (om *OrderManager) startAlgo(ctx context.Context, cfg AlgoConfig, o Order, price decimal.Decimal) (Order, error) {
+	if o.Type == OrderMarket {
+		o.Price = price
+	}
+	a, ctx, dup := om.newParent(ctx, cfg.Method, o, cfg.Horizon)
+	if dup {
+		return a, nil
+	}
+	weights := make([]float64, cfg.Slices)
+	for i := range weights {
+		weights[i] = 1
+	}
+	if cfg.Method == AlgoVWAP {
+		weights = om.volumeWeights(o.Symbol, time.Unix(a.Created, 0).Add(-24*time.Hour), cfg.Horizon, cfg.Slices)
+	}
+	go om.workAlgo(ctx, a.ID, a, time.Unix(a.Created, 0), cfg.Horizon/time.Duration(cfg.Slices), weights)
+	log.Printf("%s %s %s %s sliced by %s into %d orders over %s as %s", o.Strategy, o.Side, o.Quantity, o.Symbol, cfg.Method, cfg.Slices, cfg.Horizon, a.ID)
+	return a, nil
+}
+
+// newParent registers o as a parent order worked by method over horizon
+// and returns it with the context its children are placed with. A client
+// order id that already made a parent order gets that one back, with dup set.
+func (om *OrderManager) newParent(ctx context.Context, method string, o Order, horizon time.Duration) (Order, context.Context, bool) {
+	om.mt.Lock()
+	if o.ClientOrderID != "" {
+		for _, a := range om.algos {
+			if a.ClientOrderID == o.ClientOrderID {
+				om.mt.Unlock()
+				return a.Order, nil, true
+			}
+		}
+	} else {
+		o.ClientOrderID = newClientOrderID()
+	}
+	now := om.clock.Now()
+	o.ID = "algo_" + newClientOrderID()
+	o.Status, o.Created = OrderStatusNew, now.Unix()
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	a := &AlgoOrder{Order: o, Method: method, Start: now, cancel: cancel, settled: make(chan struct{}, 1)}
+	if horizon > 0 {
+		a.End = now.Add(horizon)
+	}
+	om.algos[o.ID] = a
+	om.algoDirty = append(om.algoDirty, *a)
+	om.pruneAlgos()
+	om.mt.Unlock()
+	om.saveAlgos()
+	return o, ctx, false
+}
+
+// volumeWeights shares the volume of symbol traded over horizon from
+// start into slices, read from its minute candles, evenly when the store
+// has none of them
+func (om *OrderManager) volumeWeights(symbol string, start time.Time, horizon time.Duration, slices int) []float64 {
+	weights := make([]float64, slices)
+	var total float64
+	if om.db != nil {
+		rows, err := om.db.LoadCandlesBetween(symbol, DefaultCandleInterval, start, start.Add(horizon))
+		if err != nil {
+			log.Printf("vwap volume profile of %s: %v", symbol, err)
+		}
+		for _, c := range StoredCandles(rows) {
+			i := int(c.Time.Sub(start) * time.Duration(slices) / horizon)
+			if i >= 0 && i < slices {
+				weights[i] += c.Volume
+				total += c.Volume
+			}
+		}
+	}
+	if total <= 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	return weights
+}
+
+// workAlgo places a child of parent o at the start of each slice, sized
+// so the children placed so far hold the share of o the weights up to that
+// slice give, until the last slice or ctx ends
+func (om *OrderManager) workAlgo(ctx context.Context, id string, o Order, start time.Time, step time.Duration, weights []float64) {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	clock := om.currentClock()
+	placed, cum := decimal.Zero, 0.0
+	for i, w := range weights {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				om.endAlgo(id, true, false)
+				return
+			case <-clock.After(start.Add(time.Duration(i) * step).Sub(clock.Now())):
+			}
+		}
+		cum += w
+		target := o.Quantity
+		if i < len(weights)-1 {
+			target = o.Quantity.Mul(decimal.NewFromFloat(cum / total)).Round(8)
+		}
+		qty := target.Sub(placed)
+		if !qty.IsPositive() {
+			continue
+		}
+		child := Order{Symbol: o.Symbol, Side: o.Side, Type: o.Type, Quantity: qty, Strategy: o.Strategy, ClientOrderID: newClientOrderID()}
+		if o.Type == OrderLimit {
+			child.Price = o.Price
+		}
+		om.mt.Lock()
+		om.algoChildren[child.ClientOrderID] = id
+		om.mt.Unlock()
+		r, err := om.Submit(ctx, child)
+		if err != nil {
+			log.Printf("algo order %s slice %d/%d of %s not placed: %v", id, i+1, len(weights), child.Quantity, err)
+			om.mt.Lock()
+			delete(om.algoChildren, child.ClientOrderID)
+			om.mt.Unlock()
+			om.endAlgo(id, true, true)
+			return
+		}
+		placed = placed.Add(r.Quantity)
+	}
+	om.endAlgo(id, false, false)
+}
+
+// algoUpdate applies the update cur of an order from prev to its parent,
+// if it is the child of one: the child's state and what it filled since prev
+func (om *OrderManager) algoUpdate(prev, cur Order) {
+	om.mt.Lock()
+	om.algoUpdateLocked(prev, cur)
+	om.mt.Unlock()
+	om.saveAlgos()
+}
+
+// algoUpdateLocked is algoUpdate. Callers must hold om.mt.
+func (om *OrderManager) algoUpdateLocked(prev, cur Order) {
+	a, ok := om.algos[om.algoChildren[cur.ClientOrderID]]
+	if !ok {
+		return
+	}
+	before := a.Order
+	found := false
+	for i := range a.Children {
+		if a.Children[i].ID == cur.ID {
+			a.Children[i], found = cur, true
+		}
+	}
+	if !found {
+		a.Children = append(a.Children, cur)
+	}
+	if cur.Status.Final() {
+		delete(om.algoChildren, cur.ClientOrderID)
+		select {
+		case a.settled <- struct{}{}:
+		default:
+		}
+	}
+
+	if qty := cur.FilledQty.Sub(prev.FilledQty); qty.IsPositive() {
+		price := cur.FilledPrice
+		if prev.FilledQty.IsPositive() {
+			price = cur.FilledQty.Mul(cur.FilledPrice).Sub(prev.FilledQty.Mul(prev.FilledPrice)).DivRound(qty, 8)
+		}
+		filled := a.FilledQty.Add(qty)
+		a.FilledPrice = a.FilledQty.Mul(a.FilledPrice).Add(qty.Mul(price)).DivRound(filled, 8)
+		a.FilledQty = filled
+		a.Fee = a.Fee.Add(cur.Fee.Sub(prev.Fee))
+	}
+	om.settleAlgo(a, before)
+}
+
+// endAlgo marks the parent id as placing no more children, stopped before
+// its last slice when stopped, for a child that failed when failed
+func (om *OrderManager) endAlgo(id string, stopped, failed bool) {
+	om.mt.Lock()
+	a, ok := om.algos[id]
+	if ok && !a.Done {
+		before := a.Order
+		a.Done, a.stopped, a.failed = true, stopped, failed
+		a.cancel()
+		om.settleAlgo(a, before)
+	}
+	om.mt.Unlock()
+	om.saveAlgos()
+}
+
+// settleAlgo sets the status of a from its children. A parent whose status
+// or fills moved from before is saved and, when it is the child of another
+// parent, updates that one. Callers must hold om.mt.
+func (om *OrderManager) settleAlgo(a *AlgoOrder, before Order) {
+	working := !a.Done
+	allFilled := true
+	for _, c := range a.Children {
+		if !c.Status.Final() {
+			working = true
+		}
+		if c.Status != OrderStatusFilled {
+			allFilled = false
+		}
+	}
+	switch {
+	case working && a.FilledQty.IsPositive():
+		a.Status = OrderStatusPartiallyFilled
+	case working:
+		a.Status = OrderStatusNew
+	case !a.stopped && allFilled:
+		a.Status, a.Filled = OrderStatusFilled, true
+	case a.failed && a.FilledQty.IsZero():
+		a.Status = OrderStatusRejected
+	default:
+		a.Status = OrderStatusCanceled
+	}
+	if a.Status == before.Status && a.FilledQty.Equal(before.FilledQty) {
+		return
+	}
+	if a.Status != before.Status {
+		log.Printf("Algo order %s %s -> %s (filled %s/%s at %s)", a.ID, before.Status, a.Status, a.FilledQty, a.Quantity, a.FilledPrice)
+	}
+	om.algoDirty = append(om.algoDirty, *a)
+	om.algoUpdateLocked(before, a.Order)
+}
+
+// saveAlgos stores the parent orders that changed since it last ran
+func (om *OrderManager) saveAlgos() {
+	om.mt.Lock()
+	dirty := om.algoDirty
+	om.algoDirty = nil
+	om.mt.Unlock()
+	if om.db == nil {
+		return
+	}
+	for _, a := range dirty {
+		err := om.db.SaveParentOrder(store.ParentOrderRecord{
+			ID: a.ID, ClientOrderID: a.ClientOrderID, Strategy: a.Strategy, Symbol: a.Symbol, Side: string(a.Side), Type: string(a.Type),
+			Method: a.Method, Price: a.Price.InexactFloat64(), Quantity: a.Quantity.InexactFloat64(),
+			FilledQty: a.FilledQty.InexactFloat64(), FilledPrice: a.FilledPrice.InexactFloat64(), Fee: a.Fee.InexactFloat64(),
+			Status: string(a.Status), Created: a.Start, Updated: om.currentClock().Now(),
+		})
+		if err != nil {
+			log.Printf("failed to persist algo order %s: %v", a.ID, err)
+		}
+	}
+}
+
+// maxFinishedAlgos is how many final parent orders AlgoOrders keeps reporting
+const maxFinishedAlgos = 100
+
+// pruneAlgos forgets the oldest final parent orders past maxFinishedAlgos.
+// Callers must hold om.mt.
+func (om *OrderManager) pruneAlgos() {
+	var finished []*AlgoOrder
+	for _, a := range om.algos {
+		if a.Status.Final() {
+			finished = append(finished, a)
+		}
+	}
+	if len(finished) <= maxFinishedAlgos {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].Start.Before(finished[j].Start) })
+	for _, a := range finished[:len(finished)-maxFinishedAlgos] {
+		delete(om.algos, a.ID)
+	}
+}
+
+// AlgoOrders returns the parent orders being worked and the last ones
+// finished, newest first
+func (om *OrderManager) AlgoOrders() []AlgoOrder {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	out := make([]AlgoOrder, 0, len(om.algos))
+	for _, a := range om.algos {
+		c := *a
+		c.Children = append([]Order(nil), a.Children...)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.After(out[j].Start) })
+	return out
+}
+
+// CancelAlgo stops the parent order id from placing more children and
+// cancels those still resting on the exchange
+func (om *OrderManager) CancelAlgo(ctx context.Context, id string) (AlgoOrder, error) {
+	om.mt.Lock()
+	a, ok := om.algos[id]
+	if !ok {
+		om.mt.Unlock()
+		return AlgoOrder{}, fmt.Errorf("no algo order %s", id)
+	}
+	if a.Done {
+		om.mt.Unlock()
+		return AlgoOrder{}, fmt.Errorf("algo order %s is %s", id, a.Status)
+	}
+	var resting []Order
+	for _, c := range a.Children {
+		if !c.Status.Final() {
+			resting = append(resting, c)
+		}
+	}
+	ex := om.exchange
+	om.mt.Unlock()
+
+	om.endAlgo(id, true, false)
+	for _, c := range resting {
+		// a child over the max order size is itself split
+		om.mt.Lock()
+		_, split := om.algos[c.ID]
+		om.mt.Unlock()
+		if split {
+			if _, err := om.CancelAlgo(ctx, c.ID); err != nil {
+				log.Printf("algo order %s: cancel child %s: %v", id, c.ID, err)
+			}
+			continue
+		}
+		if err := ex.CancelOrder(ctx, c.Symbol, c.ID); err != nil {
+			log.Printf("algo order %s: cancel child %s: %v", id, c.ID, err)
+		}
+	}
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	out := *a
+	out.Children = append([]Order(nil), a.Children...)
+	return out, nil
+}
+
+// StopAlgos stops every parent order being worked from placing more
+// children and returns how many were stopped
+func (om *OrderManager) StopAlgos() int {
+	om.mt.Lock()
+	var ids []string
+	for id, a := range om.algos {
+		if !a.Done {
+			ids = append(ids, id)
+		}
+	}
+	om.mt.Unlock()
+	for _, id := range ids {
+		om.endAlgo(id, true, false)
+	}
+	return len(ids)
+}
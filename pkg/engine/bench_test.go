@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// benchExchange fills every order immediately without touching a store
+type benchExchange struct {
+	mt  sync.Mutex
+	seq int64
+}
+
+func (x *benchExchange) PlaceOrder(ctx context.Context, o Order) (Order, error) {
+	x.mt.Lock()
+	x.seq++
+	o.ID = "bench_" + strconv.FormatInt(x.seq, 10)
+	x.mt.Unlock()
+	o.Filled = true
+	o.FilledPrice = o.Price
+	return o, nil
+}
+
+func (x *benchExchange) GetPosition(ctx context.Context, symbol string) (Position, error) {
+	return Position{Symbol: symbol}, nil
+}
+
+func (x *benchExchange) GetBalances(ctx context.Context) (map[string]decimal.Decimal, error) {
+	return nil, nil
+}
+
+func (x *benchExchange) SubscribeCandles(ctx context.Context, symbol string, interval int64) (<-chan Candle, error) {
+	return nil, nil
+}
+
+func (x *benchExchange) CancelOrder(ctx context.Context, symbol, orderID string) error { return nil }
+func (x *benchExchange) CancelAllOrders(ctx context.Context, symbol string) error      { return nil }
+func (x *benchExchange) AdapterName() string                                           { return "Bench" }
+
+func (x *benchExchange) GetOpenOrders(ctx context.Context, symbol string) ([]Order, error) {
+	return nil, nil
+}
+
+func (x *benchExchange) SubscribeTrades(ctx context.Context, symbol string) (<-chan Trade, error) {
+	return nil, ErrNoTradeStream
+}
+
+func (x *benchExchange) SubscribeOrderBook(ctx context.Context, symbol string, depth int) (<-chan OrderBook, error) {
+	return nil, ErrNoOrderBook
+}
+
+func benchCandle(i int) Candle {
+	p := 30000 + float64(i%100)
+	return Candle{Time: time.Unix(int64(i)*60, 0), Open: p, High: p + 1, Low: p - 1, Close: p, Volume: 1}
+}
+
+func benchmarkFeed(b *testing.B, policy BackpressurePolicy) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan Candle, 1024)
+	feed := newCandleFeed(ctx, "bench", "BTCUSD", in, FeedConfig{Policy: policy, Buffer: 1024})
+
+	done := make(chan struct{})
+	go func() {
+		for range feed.out {
+		}
+		close(done)
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		in <- benchCandle(i)
+	}
+	close(in)
+	<-done
+}
+
+func BenchmarkCandleFeedBlock(b *testing.B)      { benchmarkFeed(b, BackpressureBlock) }
+func BenchmarkCandleFeedDropOldest(b *testing.B) { benchmarkFeed(b, BackpressureDropOldest) }
+func BenchmarkCandleFeedConflate(b *testing.B)   { benchmarkFeed(b, BackpressureConflate) }
+
+// BenchmarkCandlePipelineSymbols pushes candles through one feed per symbol,
+// updating the price book the way the engine's feed loop does
+func BenchmarkCandlePipelineSymbols(b *testing.B) {
+	const symbols = 64
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	prices := NewPriceBook()
+	ins := make([]chan Candle, symbols)
+	var wg sync.WaitGroup
+	for s := 0; s < symbols; s++ {
+		ins[s] = make(chan Candle, 1024)
+		symbol := "SYM" + strconv.Itoa(s)
+		feed := newCandleFeed(ctx, "bench", symbol, ins[s], FeedConfig{Policy: BackpressureBlock})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range feed.out {
+				prices.UpdateCandle(symbol, c)
+			}
+		}()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ins[i%symbols] <- benchCandle(i)
+	}
+	for _, in := range ins {
+		close(in)
+	}
+	wg.Wait()
+}
+
+func BenchmarkOrderManagerSubmit(b *testing.B) {
+	om := NewOrderManager(&benchExchange{}, nil)
+	prices := NewPriceBook()
+	prices.Update("BTCUSD", decimal.NewFromInt(30000), time.Now())
+	om.(*OrderManager).SetPriceSource(prices)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o := Order{Symbol: "BTCUSD", Side: SideBuy, Type: OrderMarket, Quantity: decimal.NewFromInt(1)}
+		if _, err := om.Submit(ctx, o); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFixedPercentRiskSize(b *testing.B) {
+	risk := NewFixedPercentRisk(0.01)
+	price := decimal.NewFromInt(30000)
+	bal := decimal.NewFromInt(10000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		risk.Size("bench", "BTCUSD", price, bal)
+	}
+}
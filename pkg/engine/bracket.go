@@ -0,0 +1,379 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// OrderBracket is the stop-loss and take-profit that exit the fill of an
+// entry order, as prices. Zero leaves that leg off.
+type OrderBracket struct {
+	StopLoss   decimal.Decimal `json:"stop_loss"`
+	TakeProfit decimal.Decimal `json:"take_profit"`
+}
+
+// validate checks that the legs sit on either side of price for an entry on side
+func (b OrderBracket) validate(side Side, price decimal.Decimal) error {
+	if b.StopLoss.IsNegative() || b.TakeProfit.IsNegative() {
+		return fmt.Errorf("bracket prices must not be negative")
+	}
+	if !b.StopLoss.IsPositive() && !b.TakeProfit.IsPositive() {
+		return fmt.Errorf("bracket needs a stop-loss or a take-profit")
+	}
+	if !price.IsPositive() {
+		return nil
+	}
+	long := side == SideBuy
+	if sl := b.StopLoss; sl.IsPositive() && (long && !sl.LessThan(price) || !long && !sl.GreaterThan(price)) {
+		return fmt.Errorf("stop-loss %s of a %s at %s does not limit a loss", sl, side, price)
+	}
+	if tp := b.TakeProfit; tp.IsPositive() && (long && !tp.GreaterThan(price) || !long && !tp.LessThan(price)) {
+		return fmt.Errorf("take-profit %s of a %s at %s does not take a profit", tp, side, price)
+	}
+	return nil
+}
+
+// OCOPlacer is implemented by exchange adapters that hold a stop-loss and a
+// take-profit as one order pair, the exchange canceling one when the other
+// executes
+type OCOPlacer interface {
+	// PlaceOCO places the exit of qty on symbol, a take-profit limit at
+	// target and a stop at stop, side closing the position. It returns the
+	// stop and take-profit legs.
+	PlaceOCO(ctx context.Context, symbol string, side Side, qty, stop, target decimal.Decimal) (Order, Order, error)
+}
+
+// BracketOrder is an entry order and the legs protecting its fill
+type BracketOrder struct {
+	Entry    Order
+	Bracket  OrderBracket
+	Quantity decimal.Decimal // protected, what the entry filled
+	Armed    bool            // the entry is done and the legs are working
+	Native   bool            // the legs rest on the exchange as an OCO pair
+	StopID   string          // of native legs
+	TargetID string
+	Exiting  string // the leg that executed or triggered
+}
+
+// bracketOrder is a BracketOrder being worked. stop and target hold the
+// latest state of native legs.
+type bracketOrder struct {
+	BracketOrder
+	stop   Order
+	target Order
+}
+
+// bracketFor registers the bracket of entry o before it is placed. Orders
+// without one are left alone.
+func (om *OrderManager) bracketFor(o Order) {
+	if o.Bracket == nil {
+		return
+	}
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.brackets[o.ClientOrderID] = &bracketOrder{BracketOrder: BracketOrder{Entry: o, Bracket: *o.Bracket}}
+}
+
+// dropBracket forgets the bracket of an entry that was never placed
+func (om *OrderManager) dropBracket(clientOrderID string) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	delete(om.brackets, clientOrderID)
+}
+
+// bracketUpdate follows an order of a bracket from prev to cur. An entry
+// that is done arms its legs for what it filled; a leg that executes
+// cancels the other one.
+func (om *OrderManager) bracketUpdate(ctx context.Context, prev, cur Order) {
+	om.mt.Lock()
+	if b, ok := om.brackets[cur.ClientOrderID]; ok {
+		cur.Bracket = b.Entry.Bracket
+		b.Entry = cur
+		if !cur.Status.Final() || b.Armed {
+			om.mt.Unlock()
+			return
+		}
+		if !cur.FilledQty.IsPositive() {
+			delete(om.brackets, cur.ClientOrderID)
+			om.mt.Unlock()
+			return
+		}
+		b.Quantity, b.Armed = cur.FilledQty, true
+		bo := *b
+		om.mt.Unlock()
+		om.saveBracket(bo.BracketOrder)
+		om.armBracket(ctx, bo)
+		return
+	}
+	key, ok := om.bracketLegs[cur.ID]
+	b := om.brackets[key]
+	if !ok || b == nil {
+		om.mt.Unlock()
+		return
+	}
+	other, exit := b.target, ExitStopLoss
+	if cur.ID == b.StopID {
+		b.stop = cur
+	} else {
+		b.target = cur
+		other, exit = b.stop, ExitTakeProfit
+	}
+	if cur.FilledQty.IsPositive() {
+		b.Exiting = exit
+	}
+	if cur.Status.Final() {
+		delete(om.bracketLegs, cur.ID)
+	}
+	done := b.stop.Status.Final() && b.target.Status.Final()
+	if done {
+		delete(om.brackets, key)
+	}
+	om.mt.Unlock()
+	if done {
+		om.forgetBracket(key)
+	}
+	if cur.FilledQty.GreaterThan(prev.FilledQty) && !other.Status.Final() {
+		// exchanges cancel the other leg of their OCO pairs themselves, this covers the ones that lag
+		if err := om.currentExchange().CancelOrder(ctx, other.Symbol, other.ID); err != nil {
+			log.Printf("bracket of %s: cancel leg %s: %v", key, other.ID, err)
+		}
+	}
+}
+
+// armBracket places the legs of b on the exchange as an OCO pair when it
+// holds them, or leaves them to OnCandle
+func (om *OrderManager) armBracket(ctx context.Context, b bracketOrder) {
+	side := SideSell
+	if b.Entry.Side == SideSell {
+		side = SideBuy
+	}
+	p, ok := om.currentExchange().(OCOPlacer)
+	if !ok || !b.Bracket.StopLoss.IsPositive() || !b.Bracket.TakeProfit.IsPositive() {
+		log.Printf("%s %s bracket armed for %s: stop-loss %s, take-profit %s", b.Entry.Strategy, b.Entry.Symbol, b.Quantity, b.Bracket.StopLoss, b.Bracket.TakeProfit)
+		return
+	}
+	qty, stopPrice, targetPrice := b.Quantity, b.Bracket.StopLoss, b.Bracket.TakeProfit
+	if sp, ok := p.(SymbolInfoProvider); ok {
+		if info, err := om.symbolInfo(ctx, sp, b.Entry.Symbol); err == nil {
+			// the take-profit rounds away from the market, the stop toward it
+			qty = roundStep(qty, info.StepSize, false)
+			stopPrice = roundStep(stopPrice, info.TickSize, side == SideSell)
+			targetPrice = roundStep(targetPrice, info.TickSize, side == SideSell)
+		}
+	}
+	stop, target, err := p.PlaceOCO(ctx, b.Entry.Symbol, side, qty, stopPrice, targetPrice)
+	if err != nil {
+		log.Printf("%s %s bracket not placed on the exchange, emulating it: %v", b.Entry.Strategy, b.Entry.Symbol, err)
+		return
+	}
+	om.mt.Lock()
+	a, ok := om.brackets[b.Entry.ClientOrderID]
+	if ok {
+		a.Native, a.StopID, a.TargetID = true, stop.ID, target.ID
+		a.stop, a.target = stop, target
+		b = *a
+	}
+	om.bracketLegs[stop.ID] = b.Entry.ClientOrderID
+	om.bracketLegs[target.ID] = b.Entry.ClientOrderID
+	om.mt.Unlock()
+	if ok {
+		om.saveBracket(b.BracketOrder)
+	}
+	log.Printf("%s %s bracket placed on the exchange for %s: stop-loss %s (%s), take-profit %s (%s)", b.Entry.Strategy, b.Entry.Symbol, b.Quantity, b.Bracket.StopLoss, stop.ID, b.Bracket.TakeProfit, target.ID)
+	for _, leg := range []Order{stop, target} {
+		leg.Strategy, leg.TraceID = b.Entry.Strategy, b.Entry.TraceID
+		om.trackLeg(ctx, leg)
+	}
+}
+
+// trackLeg follows a leg placed on the exchange like any submitted order
+func (om *OrderManager) trackLeg(ctx context.Context, r Order) {
+	if r.Status == "" {
+		r.Status = OrderStatusNew
+	}
+	om.mt.Lock()
+	if !r.Status.Final() {
+		om.open[r.ID] = r
+	}
+	bus := om.events
+	om.mt.Unlock()
+	if bus != nil {
+		bus.Publish(Event{Type: EventOrderUpdated, Order: r})
+	}
+	if err := om.saveOrder(ctx, r, ""); err != nil {
+		log.Printf("failed to persist bracket leg %s: %v", r.ID, err)
+	}
+	if err := om.recordFill(ctx, Order{}, r); err != nil {
+		log.Printf("failed to persist fill of bracket leg %s: %v", r.ID, err)
+	}
+	om.bracketUpdate(ctx, Order{}, r)
+	om.applyEarly(r.ID)
+}
+
+// OnCandle checks the emulated brackets of symbol against c. The leg c
+// reached exits what the entry filled, or the position of its strategy
+// when that is smaller, with a market order and disarms the other; a
+// candle reaching both counts as a stop-loss. A bracket whose position was
+// closed another way is dropped. Exits are submitted on their own
+// goroutines so the candle feed is never held up.
+func (om *OrderManager) OnCandle(ctx context.Context, symbol string, c Candle) {
+	high, low := decimal.NewFromFloat(c.High), decimal.NewFromFloat(c.Low)
+	if c.High == 0 && c.Low == 0 {
+		high = decimal.NewFromFloat(c.Close)
+		low = high
+	}
+
+	exits := map[string]Order{} // by the client order id of the entry
+	var closed []string
+	om.mt.Lock()
+	positions := om.positions
+	for key, b := range om.brackets {
+		if b.Entry.Symbol != symbol || !b.Armed || b.Native || b.Exiting != "" {
+			continue
+		}
+		long := b.Entry.Side == SideBuy
+		adverse, favorable := low, high
+		if !long {
+			adverse, favorable = high, low
+		}
+		switch {
+		case b.Bracket.StopLoss.IsPositive() && reached(adverse, b.Bracket.StopLoss, !long):
+			b.Exiting = ExitStopLoss
+		case b.Bracket.TakeProfit.IsPositive() && reached(favorable, b.Bracket.TakeProfit, long):
+			b.Exiting = ExitTakeProfit
+		default:
+			continue
+		}
+		qty := b.Quantity
+		if positions != nil {
+			held := positions.Position(b.Entry.Strategy, symbol).Quantity
+			if !long {
+				held = held.Neg()
+			}
+			if !held.IsPositive() {
+				log.Printf("%s %s bracket %s hit with no position left to exit, dropped", b.Entry.Strategy, symbol, b.Exiting)
+				delete(om.brackets, key)
+				closed = append(closed, key)
+				continue
+			}
+			qty = decimal.Min(qty, held)
+		}
+		side := SideSell
+		if !long {
+			side = SideBuy
+		}
+		exits[key] = Order{Symbol: symbol, Side: side, Type: OrderMarket, Quantity: qty, Strategy: b.Entry.Strategy}
+		log.Printf("%s %s bracket %s hit, exiting %s and cancelling the other leg", b.Entry.Strategy, symbol, b.Exiting, qty)
+	}
+	om.mt.Unlock()
+
+	for _, key := range closed {
+		om.forgetBracket(key)
+	}
+	for key, o := range exits {
+		go om.bracketExit(ctx, key, o)
+	}
+}
+
+// bracketExit submits the market order of an emulated leg. When it fails
+// the bracket is re-armed and the next candle tries again.
+func (om *OrderManager) bracketExit(ctx context.Context, key string, o Order) {
+	_, err := om.Submit(ctx, o)
+	om.mt.Lock()
+	if err != nil {
+		log.Printf("bracket: exit %s %s %s of %s failed: %v", o.Side, o.Quantity, o.Symbol, o.Strategy, err)
+		if b := om.brackets[key]; b != nil {
+			b.Exiting = ""
+		}
+		om.mt.Unlock()
+		return
+	}
+	delete(om.brackets, key)
+	om.mt.Unlock()
+	om.forgetBracket(key)
+}
+
+// SetPositionReader sizes the exits of emulated brackets to the position
+// of their strategy, which may have been reduced since the entry filled
+func (om *OrderManager) SetPositionReader(r PositionReader) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.positions = r
+}
+
+// heldBracket is the kind armed brackets are stored under
+const heldBracket = "bracket"
+
+// saveBracket stores armed bracket b so a restart keeps protecting its fill
+func (om *OrderManager) saveBracket(b BracketOrder) {
+	if om.db == nil {
+		return
+	}
+	data, err := json.Marshal(b)
+	if err == nil {
+		err = om.db.SaveHeldOrder(heldBracket, b.Entry.ClientOrderID, data, om.currentClock().Now())
+	}
+	if err != nil {
+		log.Printf("failed to persist bracket of %s: %v", b.Entry.ClientOrderID, err)
+	}
+}
+
+// forgetBracket drops the stored bracket of the entry key
+func (om *OrderManager) forgetBracket(key string) {
+	if om.db == nil {
+		return
+	}
+	if err := om.db.DeleteHeldOrder(heldBracket, key); err != nil {
+		log.Printf("failed to forget bracket of %s: %v", key, err)
+	}
+}
+
+// loadBrackets restores the brackets an earlier run armed. Native legs are
+// settled by polling once the orders left open in the store are adopted,
+// emulated ones are checked against candles again.
+func (om *OrderManager) loadBrackets() {
+	held, err := om.db.LoadHeldOrders(heldBracket)
+	if err != nil {
+		log.Printf("failed to load armed brackets: %v", err)
+		return
+	}
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	for _, h := range held {
+		var b BracketOrder
+		if err := json.Unmarshal(h.Payload, &b); err != nil {
+			log.Printf("bracket %s unreadable, dropped: %v", h.ID, err)
+			continue
+		}
+		// an exit in flight when the run ended is tried again
+		b.Exiting = ""
+		bo := &bracketOrder{BracketOrder: b}
+		if b.Native {
+			bo.stop = Order{ID: b.StopID, Symbol: b.Entry.Symbol, Status: OrderStatusNew}
+			bo.target = Order{ID: b.TargetID, Symbol: b.Entry.Symbol, Status: OrderStatusNew}
+			om.bracketLegs[b.StopID] = h.ID
+			om.bracketLegs[b.TargetID] = h.ID
+		}
+		om.brackets[h.ID] = bo
+	}
+	if len(held) > 0 {
+		log.Printf("Restored %d armed brackets", len(om.brackets))
+	}
+}
+
+// BracketOrders reports the brackets waiting on their entry or protecting its fill
+func (om *OrderManager) BracketOrders() []BracketOrder {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	out := make([]BracketOrder, 0, len(om.brackets))
+	for _, b := range om.brackets {
+		out = append(out, b.BracketOrder)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Entry.Created < out[j].Entry.Created })
+	return out
+}
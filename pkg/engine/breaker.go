@@ -0,0 +1,280 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for orders submitted while the circuit breaker
+// of the exchange is open
+var ErrCircuitOpen = errors.New("exchange circuit breaker open")
+
+// BreakerConfig sets when the circuit breaker around an exchange adapter
+// trips and how it recovers. Zero failures disables it.
+type BreakerConfig struct {
+	Failures   int           `json:"failures"` // consecutive connectivity failures that trip it
+	ProbeEvery time.Duration `json:"-"`        // how often an open breaker checks the exchange's health
+	Probes     int           `json:"probes"`   // consecutive healthy checks that close it again
+}
+
+// defaultProbeEvery is how often open breakers probe without ProbeEvery
+const defaultProbeEvery = 10 * time.Second
+
+// BreakerStatus is the state of the circuit breaker of one exchange adapter
+type BreakerStatus struct {
+	Exchange string     `json:"exchange"`
+	Open     bool       `json:"open"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	Failures int        `json:"failures"`         // consecutive, while closed
+	Healthy  int        `json:"healthy"`          // consecutive healthy probes, while open
+	Reason   string     `json:"reason,omitempty"` // the failure that opened it, or the last failed probe
+}
+
+// HealthChecker is implemented by exchange adapters with a cheap
+// connectivity check. Open breakers probe other adapters with GetBalances.
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+}
+
+// CircuitBreaker counts consecutive connectivity failures of an exchange
+// adapter: network timeouts, transport errors and 5xx answers. Once they
+// reach the limit it opens and order submission pauses until health
+// probes pass. Any other answer, a rejection included, shows the exchange
+// is reachable and starts the count over.
+type CircuitBreaker struct {
+	mt       sync.Mutex
+	cfg      BreakerConfig
+	exchange ExchangeAdapter
+	clock    Clock
+	onChange func(BreakerStatus)
+
+	failures int
+	open     bool
+	openedAt time.Time
+	healthy  int
+	reason   string
+}
+
+func newCircuitBreaker(ex ExchangeAdapter, cfg BreakerConfig, clock Clock, onChange func(BreakerStatus)) *CircuitBreaker {
+	return &CircuitBreaker{cfg: cfg, exchange: ex, clock: clock, onChange: onChange}
+}
+
+// connectivityFailure reports whether err says the exchange could not be
+// reached, rather than that it answered
+func connectivityFailure(err error) bool {
+	return Retryable(err) && !errors.Is(err, ErrRateLimited)
+}
+
+// allow fails while the breaker is open
+func (b *CircuitBreaker) allow() error {
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	if !b.open {
+		return nil
+	}
+	return fmt.Errorf("%w: %s since %s: %s", ErrCircuitOpen, b.exchange.AdapterName(), b.openedAt.Format(time.RFC3339), b.reason)
+}
+
+// record counts the outcome of a request to the exchange, opening the
+// breaker once connectivity failures reach the limit
+func (b *CircuitBreaker) record(err error) {
+	b.mt.Lock()
+	if b.open || b.cfg.Failures <= 0 {
+		b.mt.Unlock()
+		return
+	}
+	if !connectivityFailure(err) {
+		b.failures = 0
+		b.mt.Unlock()
+		return
+	}
+	b.failures++
+	if b.failures < b.cfg.Failures {
+		b.mt.Unlock()
+		return
+	}
+	b.open, b.openedAt, b.healthy = true, b.clock.Now(), 0
+	b.reason = fmt.Sprintf("%d consecutive failures, the last: %v", b.failures, err)
+	st, onChange := b.status(), b.onChange
+	b.mt.Unlock()
+
+	log.Printf("Circuit breaker of %s opened, order submission paused: %s", st.Exchange, st.Reason)
+	if onChange != nil {
+		go onChange(st)
+	}
+}
+
+// probe checks the health of the exchange of an open breaker, closing it
+// once enough checks in a row pass
+func (b *CircuitBreaker) probe(ctx context.Context) {
+	b.mt.Lock()
+	ex, open := b.exchange, b.open
+	b.mt.Unlock()
+	if !open {
+		return
+	}
+	var err error
+	if h, ok := ex.(HealthChecker); ok {
+		err = h.Ping(ctx)
+	} else {
+		_, err = ex.GetBalances(ctx)
+	}
+
+	b.mt.Lock()
+	if !b.open {
+		b.mt.Unlock()
+		return
+	}
+	if err != nil {
+		b.healthy = 0
+		b.reason = fmt.Sprintf("health check failed: %v", err)
+		b.mt.Unlock()
+		return
+	}
+	b.healthy++
+	if b.healthy < max(b.cfg.Probes, 1) {
+		b.mt.Unlock()
+		return
+	}
+	down := b.clock.Now().Sub(b.openedAt)
+	b.open, b.openedAt, b.failures, b.healthy, b.reason = false, time.Time{}, 0, 0, ""
+	st, onChange := b.status(), b.onChange
+	b.mt.Unlock()
+
+	log.Printf("Circuit breaker of %s closed after %s, order submission resumed", st.Exchange, down.Round(time.Second))
+	if onChange != nil {
+		go onChange(st)
+	}
+}
+
+// status reports the breaker. Callers must hold b.mt.
+func (b *CircuitBreaker) status() BreakerStatus {
+	st := BreakerStatus{
+		Exchange: b.exchange.AdapterName(),
+		Open:     b.open,
+		Failures: b.failures,
+		Healthy:  b.healthy,
+		Reason:   b.reason,
+	}
+	if b.open {
+		at := b.openedAt
+		st.OpenedAt = &at
+	}
+	return st
+}
+
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	return b.status()
+}
+
+// SetBreakerConfig sets when the circuit breakers of exchange adapters trip
+// and recover. Open breakers stay open until their probes pass.
+func (om *OrderManager) SetBreakerConfig(cfg BreakerConfig) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.breakerCfg = cfg
+	for _, b := range om.breakers {
+		b.mt.Lock()
+		b.cfg = cfg
+		b.mt.Unlock()
+	}
+}
+
+// OnBreaker sets what runs when a circuit breaker opens or closes, on its
+// own goroutine so submissions never wait on it
+func (om *OrderManager) OnBreaker(fn func(BreakerStatus)) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.onBreaker = fn
+	for _, b := range om.breakers {
+		b.mt.Lock()
+		b.onChange = fn
+		b.mt.Unlock()
+	}
+}
+
+// breaker is the circuit breaker of the current exchange adapter, one per
+// adapter name so a swap back finds the breaker it left
+func (om *OrderManager) breaker() *CircuitBreaker {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	name := om.exchange.AdapterName()
+	b := om.breakers[name]
+	if b == nil {
+		b = newCircuitBreaker(om.exchange, om.breakerCfg, om.clock, om.onBreaker)
+		om.breakers[name] = b
+		return b
+	}
+	b.mt.Lock()
+	b.exchange, b.clock = om.exchange, om.clock
+	b.mt.Unlock()
+	return b
+}
+
+func (om *OrderManager) allBreakers() []*CircuitBreaker {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	out := make([]*CircuitBreaker, 0, len(om.breakers))
+	for _, b := range om.breakers {
+		out = append(out, b)
+	}
+	return out
+}
+
+// Breakers reports the circuit breakers of the exchange adapters used so far
+func (om *OrderManager) Breakers() []BreakerStatus {
+	breakers := om.allBreakers()
+	out := make([]BreakerStatus, 0, len(breakers))
+	for _, b := range breakers {
+		out = append(out, b.Status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Exchange < out[j].Exchange })
+	return out
+}
+
+// ProbeExchange runs the health checks of open circuit breakers until ctx
+// is done
+func (om *OrderManager) ProbeExchange(ctx context.Context) {
+	om.mt.Lock()
+	every, clock := om.breakerCfg.ProbeEvery, om.clock
+	om.mt.Unlock()
+	if every <= 0 {
+		every = defaultProbeEvery
+	}
+
+	tick := clock.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C():
+			for _, b := range om.allBreakers() {
+				b.probe(ctx)
+			}
+		}
+	}
+}
+
+// breakerChanged tells the notifiers that order submission to an exchange
+// paused or resumed
+func (e *Engine) breakerChanged(st BreakerStatus) {
+	e.lock.Lock()
+	ctx := e.ctx
+	e.lock.Unlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if st.Open {
+		e.notify(ctx, SubjectCircuitOpen, fmt.Sprintf("Order submission to %s paused: %s", st.Exchange, st.Reason))
+		return
+	}
+	e.notify(ctx, SubjectCircuitClosed, fmt.Sprintf("Order submission to %s resumed, its health checks passed", st.Exchange))
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"context"
+	"time"
+	_ "time/tzdata" // the NYSE calendar runs on New York time wherever the engine does
+)
+
+// MarketSession is one trading day of a market, from its open to its close
+type MarketSession struct {
+	Open  time.Time `json:"open"`
+	Close time.Time `json:"close"`
+}
+
+// MarketCalendar serves the trading sessions of a market. NYSECalendar
+// computes those of US equities, exchange adapters may serve their own.
+type MarketCalendar interface {
+	// Sessions returns the sessions of the trading days from through to,
+	// by their date where the market is, oldest first
+	Sessions(ctx context.Context, from, to time.Time) ([]MarketSession, error)
+}
+
+// NYSECalendar is the regular session of the New York Stock Exchange, 9:30
+// to 16:00 New York time on weekdays, closing at 13:00 the day before
+// Independence Day, after Thanksgiving and on Christmas Eve. Its holidays
+// follow the exchange's rules; closures it announces ad hoc are not known.
+type NYSECalendar struct{}
+
+var newYork, _ = time.LoadLocation("America/New_York")
+
+func (NYSECalendar) Sessions(ctx context.Context, from, to time.Time) ([]MarketSession, error) {
+	var out []MarketSession
+	end := to.In(newYork)
+	for d := from.In(newYork); !dayOf(d).After(dayOf(end)); d = d.AddDate(0, 0, 1) {
+		y, m, day := d.Date()
+		if wd := d.Weekday(); wd == time.Saturday || wd == time.Sunday || nyseHoliday(y, m, day) {
+			continue
+		}
+		closeHour := 16
+		if nyseEarlyClose(y, m, day) {
+			closeHour = 13
+		}
+		out = append(out, MarketSession{
+			Open:  time.Date(y, m, day, 9, 30, 0, 0, newYork),
+			Close: time.Date(y, m, day, closeHour, 0, 0, 0, newYork),
+		})
+	}
+	return out, nil
+}
+
+// dayOf is the midnight starting the day of t, in its location
+func dayOf(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// nyseHoliday reports whether the exchange is closed on the weekday y-m-d
+func nyseHoliday(y int, m time.Month, d int) bool {
+	date := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	// fixed holidays on a Sunday are observed the Monday after and on a
+	// Saturday the Friday before, except New Year's Day which is then skipped
+	for _, h := range []struct {
+		m     time.Month
+		d     int
+		since int
+	}{{time.January, 1, 0}, {time.June, 19, 2022}, {time.July, 4, 0}, {time.December, 25, 0}} {
+		if y < h.since {
+			continue
+		}
+		hd := time.Date(y, h.m, h.d, 0, 0, 0, 0, time.UTC)
+		switch hd.Weekday() {
+		case time.Sunday:
+			hd = hd.AddDate(0, 0, 1)
+		case time.Saturday:
+			if h.m == time.January {
+				continue
+			}
+			hd = hd.AddDate(0, 0, -1)
+		}
+		if hd.Equal(date) {
+			return true
+		}
+	}
+
+	switch m {
+	case time.January: // Martin Luther King Jr. Day
+		return date.Equal(nthWeekday(y, m, time.Monday, 3))
+	case time.February: // Washington's Birthday
+		return date.Equal(nthWeekday(y, m, time.Monday, 3))
+	case time.May: // Memorial Day
+		return date.Equal(nthWeekday(y, m, time.Monday, -1))
+	case time.September: // Labor Day
+		return date.Equal(nthWeekday(y, m, time.Monday, 1))
+	case time.November: // Thanksgiving Day
+		return date.Equal(nthWeekday(y, m, time.Thursday, 4))
+	}
+	return date.Equal(easter(y).AddDate(0, 0, -2)) // Good Friday
+}
+
+// nyseEarlyClose reports whether the exchange closes at 13:00 on y-m-d
+func nyseEarlyClose(y int, m time.Month, d int) bool {
+	date := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	switch {
+	case m == time.July && d == 3:
+		wd := time.Date(y, time.July, 4, 0, 0, 0, 0, time.UTC).Weekday()
+		return wd >= time.Tuesday && wd <= time.Friday
+	case m == time.November:
+		return date.Equal(nthWeekday(y, m, time.Thursday, 4).AddDate(0, 0, 1))
+	case m == time.December && d == 24:
+		wd := date.Weekday()
+		return wd >= time.Monday && wd <= time.Thursday
+	}
+	return false
+}
+
+// nthWeekday is the nth wd of month m of year y, the last one for n = -1
+func nthWeekday(y int, m time.Month, wd time.Weekday, n int) time.Time {
+	if n < 0 {
+		last := time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC)
+		return last.AddDate(0, 0, -int(last.Weekday()-wd+7)%7)
+	}
+	first := time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	return first.AddDate(0, 0, int(wd-first.Weekday()+7)%7+7*(n-1))
+}
+
+// easter is Easter Sunday of year y in the Gregorian calendar
+func easter(y int) time.Time {
+	a, b, c := y%19, y/100, y%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(y, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
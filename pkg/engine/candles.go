@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseInterval parses candle intervals like "1m", "15m", "4h", "1d" or "1w"
+func ParseInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+	switch s[len(s)-1] {
+	case 's':
+		return time.Duration(n) * time.Second, nil
+	case 'm':
+		return time.Duration(n) * time.Minute, nil
+	case 'h':
+		return time.Duration(n) * time.Hour, nil
+	case 'd':
+		return time.Duration(n) * 24 * time.Hour, nil
+	case 'w':
+		return time.Duration(n) * 7 * 24 * time.Hour, nil
+	}
+	return 0, fmt.Errorf("invalid interval %q", s)
+}
+
+// ResampleCandles merges time-ordered candles into buckets of width d
+func ResampleCandles(candles []Candle, d time.Duration) []Candle {
+	if d <= 0 || len(candles) == 0 {
+		return candles
+	}
+	out := make([]Candle, 0, len(candles))
+	var cur Candle
+	var bucket time.Time
+	for i, c := range candles {
+		b := c.Time.Truncate(d)
+		if i == 0 || !b.Equal(bucket) {
+			if i > 0 {
+				out = append(out, cur)
+			}
+			bucket = b
+			cur = Candle{Time: b, Open: c.Open, High: c.High, Low: c.Low, Close: c.Close, Volume: c.Volume}
+			continue
+		}
+		if c.High > cur.High {
+			cur.High = c.High
+		}
+		if c.Low < cur.Low {
+			cur.Low = c.Low
+		}
+		cur.Close = c.Close
+		cur.Volume += c.Volume
+	}
+	return append(out, cur)
+}
+
+// MultiTimeframeStrategy is implemented by strategies that also read larger
+// candles built from their own feed, such as an hourly trend filter on a
+// one minute strategy. Timeframes are in seconds and multiples of the
+// strategy's interval.
+type MultiTimeframeStrategy interface {
+	Strategy
+	Timeframes() []int64
+	// OnCandleTF is called with each completed candle of timeframe tf, before
+	// OnCandle of the candle that completed it
+	OnCandleTF(tf int64, c Candle)
+}
+
+// MultiSymbolStrategy is implemented by strategies that read and trade
+// other symbols besides their own, such as a pairs trade. The engine
+// subscribes to each of Symbols at the strategy's interval and hands their
+// candles to OnSymbolCandle; the candles of Symbol still go to OnCandle.
+type MultiSymbolStrategy interface {
+	Strategy
+	// Symbols lists every symbol of the strategy, Symbol included
+	Symbols() []string
+	OnSymbolCandle(symbol string, c Candle)
+}
+
+// StrategySymbols lists the symbols s reads and trades
+func StrategySymbols(s Strategy) []string {
+	if ms, ok := s.(MultiSymbolStrategy); ok {
+		return ms.Symbols()
+	}
+	return []string{s.Symbol()}
+}
+
+// TimeframeCandle is a completed candle of a larger timeframe, in seconds
+type TimeframeCandle struct {
+	Timeframe int64
+	Candle
+}
+
+// CandleAggregator builds candles of larger timeframes from a feed of base
+// candles. A candle completes with the last base candle inside it, or when a
+// base candle of a later bucket shows the feed skipped its end.
+type CandleAggregator struct {
+	base   time.Duration
+	frames []aggFrame
+}
+
+type aggFrame struct {
+	tf   int64
+	d    time.Duration
+	cur  Candle
+	open bool
+}
+
+// NewCandleAggregator aggregates base candles of base seconds into each of
+// timeframes, which must be larger multiples of base
+func NewCandleAggregator(base int64, timeframes []int64) (*CandleAggregator, error) {
+	if base <= 0 {
+		return nil, fmt.Errorf("invalid base interval %ds", base)
+	}
+	tfs := append([]int64(nil), timeframes...)
+	sort.Slice(tfs, func(i, j int) bool { return tfs[i] < tfs[j] })
+	a := &CandleAggregator{base: time.Duration(base) * time.Second}
+	for i, tf := range tfs {
+		if tf <= base || tf%base != 0 {
+			return nil, fmt.Errorf("timeframe %ds is not a larger multiple of the %ds interval", tf, base)
+		}
+		if i > 0 && tf == tfs[i-1] {
+			continue
+		}
+		a.frames = append(a.frames, aggFrame{tf: tf, d: time.Duration(tf) * time.Second})
+	}
+	return a, nil
+}
+
+// Add folds c into every timeframe and returns the candles it completed,
+// smallest timeframe first
+func (a *CandleAggregator) Add(c Candle) []TimeframeCandle {
+	var out []TimeframeCandle
+	for i := range a.frames {
+		f := &a.frames[i]
+		start := c.Time.Truncate(f.d)
+		if f.open && !f.cur.Time.Equal(start) {
+			out = append(out, TimeframeCandle{Timeframe: f.tf, Candle: f.cur})
+			f.open = false
+		}
+		if !f.open {
+			f.cur = Candle{Time: start, Open: c.Open, High: c.High, Low: c.Low, Close: c.Close, Volume: c.Volume}
+			f.open = true
+		} else {
+			if c.High > f.cur.High {
+				f.cur.High = c.High
+			}
+			if c.Low < f.cur.Low {
+				f.cur.Low = c.Low
+			}
+			f.cur.Close = c.Close
+			f.cur.Volume += c.Volume
+		}
+		if !c.Time.Add(a.base).Before(start.Add(f.d)) {
+			out = append(out, TimeframeCandle{Timeframe: f.tf, Candle: f.cur})
+			f.open = false
+		}
+	}
+	return out
+}
+
+// CandleHandler returns what hands st its candles of base seconds. For a
+// MultiTimeframeStrategy it first hands over the larger candles they complete.
+func CandleHandler(st Strategy, base int64) func(Candle) {
+	mtf, ok := st.(MultiTimeframeStrategy)
+	if !ok || len(mtf.Timeframes()) == 0 {
+		return st.OnCandle
+	}
+	agg, err := NewCandleAggregator(base, mtf.Timeframes())
+	if err != nil {
+		log.Printf("%s gets no larger timeframes: %v", st.Name(), err)
+		return st.OnCandle
+	}
+	return func(c Candle) {
+		for _, tc := range agg.Add(c) {
+			mtf.OnCandleTF(tc.Timeframe, tc.Candle)
+		}
+		st.OnCandle(c)
+	}
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to time dependent logic, so backtests and tests can
+// run it on simulated time
+type Clock interface {
+	Now() time.Time
+	// After sends the time on the returned channel once d has passed
+	After(d time.Duration) <-chan time.Time
+	// Sleep blocks until d has passed
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks of a Clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the wall clock
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
+
+// SimClock is a clock moved by hand with Set and Advance. Its timers and
+// tickers fire as it moves past them, ticks a reader has not taken yet are
+// dropped like those of a time.Ticker.
+type SimClock struct {
+	mt      sync.Mutex
+	now     time.Time
+	auto    bool
+	waiters []*simWaiter
+}
+
+// simWaiter is a pending timer, or a ticker when every is set
+type simWaiter struct {
+	at      time.Time
+	every   time.Duration
+	ch      chan time.Time
+	stopped bool
+}
+
+func NewSimClock(start time.Time) *SimClock {
+	return &SimClock{now: start}
+}
+
+// SetAutoAdvance makes After move the clock to the end of the wait right
+// away, for simulations run by a single goroutine where a wait would
+// otherwise never end, such as an order retry inside a backtest
+func (c *SimClock) SetAutoAdvance(on bool) {
+	c.mt.Lock()
+	defer c.mt.Unlock()
+	c.auto = on
+}
+
+func (c *SimClock) Now() time.Time {
+	c.mt.Lock()
+	defer c.mt.Unlock()
+	return c.now
+}
+
+func (c *SimClock) After(d time.Duration) <-chan time.Time {
+	c.mt.Lock()
+	defer c.mt.Unlock()
+	w := &simWaiter{at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	if c.auto && w.at.After(c.now) {
+		c.now = w.at
+	}
+	c.fire()
+	return w.ch
+}
+
+// Sleep waits for the clock to move d ahead, or moves it there itself
+// when it auto advances
+func (c *SimClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+func (c *SimClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for SimClock.NewTicker")
+	}
+	c.mt.Lock()
+	defer c.mt.Unlock()
+	w := &simWaiter{at: c.now.Add(d), every: d, ch: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	return &simTicker{clock: c, w: w}
+}
+
+// Set moves the clock to t, it never goes back
+func (c *SimClock) Set(t time.Time) {
+	c.mt.Lock()
+	defer c.mt.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+	c.fire()
+}
+
+// Advance moves the clock forward by d
+func (c *SimClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// fire delivers the timers and ticks that are due and forgets the timers
+// delivered. Callers must hold c.mt.
+func (c *SimClock) fire() {
+	kept := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.stopped {
+			continue
+		}
+		if w.at.After(c.now) {
+			kept = append(kept, w)
+			continue
+		}
+		select {
+		case w.ch <- w.at:
+		default:
+		}
+		if w.every <= 0 {
+			continue
+		}
+		// one tick for however many intervals passed
+		for !w.at.After(c.now) {
+			w.at = w.at.Add(w.every)
+		}
+		kept = append(kept, w)
+	}
+	c.waiters = kept
+}
+
+type simTicker struct {
+	clock *SimClock
+	w     *simWaiter
+}
+
+func (t *simTicker) C() <-chan time.Time { return t.w.ch }
+
+func (t *simTicker) Stop() {
+	t.clock.mt.Lock()
+	defer t.clock.mt.Unlock()
+	t.w.stopped = true
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+var simStart = time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+
+// received reports whether ch has a value ready
+func received(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-ch:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestSimClockAdvance(t *testing.T) {
+	c := NewSimClock(simStart)
+	c.Advance(90 * time.Second)
+	if want := simStart.Add(90 * time.Second); !c.Now().Equal(want) {
+		t.Fatalf("now %s, want %s", c.Now(), want)
+	}
+	c.Set(simStart)
+	if want := simStart.Add(90 * time.Second); !c.Now().Equal(want) {
+		t.Fatalf("Set moved the clock back to %s", c.Now())
+	}
+}
+
+func TestSimClockAfter(t *testing.T) {
+	c := NewSimClock(simStart)
+	ch := c.After(time.Minute)
+	c.Advance(59 * time.Second)
+	if _, ok := received(ch); ok {
+		t.Fatal("timer fired before it was due")
+	}
+	c.Advance(time.Second)
+	at, ok := received(ch)
+	if !ok {
+		t.Fatal("timer did not fire when due")
+	}
+	if want := simStart.Add(time.Minute); !at.Equal(want) {
+		t.Fatalf("timer sent %s, want %s", at, want)
+	}
+	c.Advance(time.Hour)
+	if _, ok := received(ch); ok {
+		t.Fatal("timer fired twice")
+	}
+	if _, ok := received(c.After(0)); !ok {
+		t.Fatal("timer of no duration did not fire at once")
+	}
+}
+
+func TestSimClockTicker(t *testing.T) {
+	c := NewSimClock(simStart)
+	tick := c.NewTicker(time.Minute)
+	c.Advance(30 * time.Second)
+	if _, ok := received(tick.C()); ok {
+		t.Fatal("ticker ticked before its interval")
+	}
+	// three intervals pass at once, the reader gets one tick and the next
+	// is due an interval after now
+	c.Advance(150 * time.Second)
+	if at, ok := received(tick.C()); !ok || !at.Equal(simStart.Add(time.Minute)) {
+		t.Fatalf("tick %s %v, want the first interval", at, ok)
+	}
+	if _, ok := received(tick.C()); ok {
+		t.Fatal("missed ticks were queued")
+	}
+	c.Advance(time.Minute)
+	if at, ok := received(tick.C()); !ok || !at.Equal(simStart.Add(4*time.Minute)) {
+		t.Fatalf("tick %s %v, want the next interval", at, ok)
+	}
+	tick.Stop()
+	c.Advance(time.Hour)
+	if _, ok := received(tick.C()); ok {
+		t.Fatal("stopped ticker ticked")
+	}
+}
+
+func TestSimClockNewTickerPanicsOnZeroInterval(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	NewSimClock(simStart).NewTicker(0)
+}
+
+func TestSimClockSleep(t *testing.T) {
+	c := NewSimClock(simStart)
+	woke := make(chan struct{})
+	go func() {
+		c.Sleep(time.Minute)
+		close(woke)
+	}()
+	// the sleeper has to be waiting before the clock moves past it
+	for {
+		c.mt.Lock()
+		n := len(c.waiters)
+		c.mt.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-woke:
+		t.Fatal("woke before the clock moved")
+	case <-time.After(10 * time.Millisecond):
+	}
+	c.Advance(time.Minute)
+	select {
+	case <-woke:
+	case <-time.After(time.Second):
+		t.Fatal("did not wake once the clock moved")
+	}
+
+	c.SetAutoAdvance(true)
+	c.Sleep(time.Hour)
+	if want := simStart.Add(time.Hour + time.Minute); !c.Now().Equal(want) {
+		t.Fatalf("auto advancing sleep left the clock at %s, want %s", c.Now(), want)
+	}
+}
@@ -2,114 +2,911 @@ package engine
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
 )
 
 type Engine struct {
 	strategies []Strategy
 	exchange   ExchangeAdapter
 	om         OrderExecutor
-	store      *store.SQLiteStore
+	store      store.Store
 	status     string
 
+	recorder  *Recorder
+	prices    *PriceBook
+	events    *EventBus
+	portfolio *PortfolioRiskManager
+	kill      *KillSwitch
+	journal   *TradeJournal
+	positions *PositionManager
+	signals   *PositionManager // paper positions of signal-only strategies
+	protect   *PositionProtector
+	halted    bool
+
+	equityEvery time.Duration
+	quote       string // balance counted as cash, "" for the exchange's
+	stateEvery  time.Duration
+
+	recon      *Reconciler
+	reconEvery time.Duration
+	health     *HealthMonitor
+	hours      *MarketHours
+	liqBuffer  decimal.Decimal
+	liqWatched map[string]bool // symbols whose liquidation price this run watches
+
+	run      store.RunRecord // the current run, zero when stopped
+	runStart decimal.Decimal // PnL of all positions when the run started
+
+	notifiers []Notifier
+
+	clock Clock
+
+	feedMt  sync.Mutex
+	feedCfg map[string]FeedConfig
+	feeds   []*candleFeed
+
+	groups map[feedKey]*feedGroup
+	subs   map[string]*feedSub // by strategy name
+
 	ctx    context.Context
 	cancel context.CancelFunc
-	wg     sync.WaitGroup
-	lock   sync.Mutex
+
+	feedCtx    context.Context
+	feedCancel context.CancelFunc
+	wg         sync.WaitGroup
+	lock       sync.Mutex
 }
 
 func NewEngine() *Engine {
-	return &Engine{}
+	e := &Engine{feedCfg: make(map[string]FeedConfig), prices: NewPriceBook(), events: NewEventBus(), journal: NewTradeJournal(), positions: NewPositionManager(), signals: NewPositionManager(), clock: RealClock}
+	e.events.Subscribe(EventOrderFilled, e.applyFill)
+	e.journal.Track(e.events)
+	e.positions.SetPriceSource(e.prices)
+	e.signals.SetPriceSource(e.prices)
+	e.positions.Track(e.events)
+	e.events.Subscribe(EventOrderUpdated, e.dispatchOrderUpdate)
+	return e
 }
 
+// DefaultCandleInterval is the candle size in seconds of strategies that do
+// not ask for another
+const DefaultCandleInterval = int64(60)
+
 func (e *Engine) RegisterStrategy(s Strategy) {
 	e.lock.Lock()
 	defer e.lock.Unlock()
 	e.strategies = append(e.strategies, s)
+	e.givePositions(s)
+}
+
+// givePositions lets s read its own position if it wants to
+func (e *Engine) givePositions(s Strategy) {
+	pa, ok := s.(PositionAware)
+	switch {
+	case !ok:
+	case signalOnly(s):
+		pa.SetPositionReader(e.signals)
+	default:
+		pa.SetPositionReader(e.positions)
+	}
+}
+
+// Positions is the position manager following every strategy's fills
+func (e *Engine) Positions() *PositionManager {
+	return e.positions
+}
+
+// AddStrategy registers s while the engine may be running. On a running
+// engine s is started and joins the candle feed of its symbol right away.
+func (e *Engine) AddStrategy(s Strategy) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, x := range e.strategies {
+		if x.Name() == s.Name() {
+			return fmt.Errorf("strategy %q already exists", s.Name())
+		}
+	}
+	e.strategies = append(e.strategies, s)
+	e.givePositions(s)
+	if e.running() {
+		s.OnStart()
+		if err := e.attach(s); err != nil {
+			log.Printf("strategy %s added without a candle feed: %v", s.Name(), err)
+		}
+	}
+	log.Printf("Strategy %s on %s added", s.Name(), s.Symbol())
+	return nil
+}
+
+// RemoveStrategy stops the strategy called name and unregisters it. The
+// candle it is handling finishes first; its open orders are left working.
+func (e *Engine) RemoveStrategy(name string) (Strategy, error) {
+	e.lock.Lock()
+	var s Strategy
+	for i, x := range e.strategies {
+		if x.Name() == name {
+			s = x
+			e.strategies = append(e.strategies[:i:i], e.strategies[i+1:]...)
+			break
+		}
+	}
+	if s == nil {
+		e.lock.Unlock()
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+	sub := e.detach(s)
+	running := e.running()
+	e.lock.Unlock()
+
+	// wait outside the lock, the candle in hand may still submit orders
+	if sub != nil {
+		sub.wait()
+	}
+	if running {
+		s.OnStop()
+	}
+	log.Printf("Strategy %s on %s removed", s.Name(), s.Symbol())
+	return s, nil
 }
 
+// ReplaceStrategy swaps the strategy with the name of s for s, as when its
+// params change. s keeps the positions of the name and, when it needs a
+// history, warms up on the newest stored candles of its symbol.
+func (e *Engine) ReplaceStrategy(s Strategy) error {
+	if _, err := e.RemoveStrategy(s.Name()); err != nil {
+		return err
+	}
+	e.lock.Lock()
+	db := e.store
+	e.lock.Unlock()
+	if ws, ok := s.(WarmUpStrategy); ok && db != nil {
+		rows, err := db.LoadRecentCandles(s.Symbol(), candleInterval(s), ws.WarmUpCandles())
+		if err != nil {
+			log.Printf("strategy %s replaced without a warm up: %v", s.Name(), err)
+		} else if candles := StoredCandles(rows); len(candles) > 0 {
+			ws.WarmUp(candles)
+		}
+	}
+	return e.AddStrategy(s)
+}
+
+// SetExchangeAdapter sets the adapter before Start, use SwapExchangeAdapter on a running engine
 func (e *Engine) SetExchangeAdapter(x ExchangeAdapter) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
 	e.exchange = x
+	setPriceSource(x, e.prices)
+	setClock(x, e.clock)
 }
 
 func (e *Engine) SetOrderManager(o OrderExecutor) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
 	e.om = o
+	setPriceSource(o, e.prices)
+	setClock(o, e.clock)
+	if s, ok := o.(interface{ SetEventBus(*EventBus) }); ok {
+		s.SetEventBus(e.events)
+	}
+	if s, ok := o.(interface{ OnBreaker(func(BreakerStatus)) }); ok {
+		s.OnBreaker(e.breakerChanged)
+	}
+	if pa, ok := o.(PositionAware); ok {
+		pa.SetPositionReader(e.positions)
+	}
 }
 
-func (e *Engine) SetStore(s *store.SQLiteStore) {
+// Events is the bus engine components publish order and fill events on
+func (e *Engine) Events() *EventBus {
+	return e.events
+}
+
+// applyFill moves the owning strategy's capital by the actual fill notional and fees
+func (e *Engine) applyFill(ev Event) {
+	o := ev.Order
+	price := o.FilledPrice
+	if !price.IsPositive() {
+		price = o.Price
+	}
+	notional := o.Quantity.Mul(price)
+
+	for _, s := range e.Strategies() {
+		if s.Name() != o.Strategy || !slices.Contains(StrategySymbols(s), o.Symbol) {
+			continue
+		}
+		bal := s.AccountBalUSD()
+		switch o.Side {
+		case SideBuy:
+			bal = bal.Sub(notional)
+		case SideSell:
+			bal = bal.Add(notional)
+		}
+		bal = bal.Sub(o.Fee)
+		s.SetAccountUSD(bal)
+		log.Printf("%s capital after %s fill %s: %s", s.Name(), o.Side, o.ID, bal.StringFixed(2))
+		return
+	}
+}
+
+// dispatchOrderUpdate hands an order's new status to the strategy that placed it
+func (e *Engine) dispatchOrderUpdate(ev Event) {
+	for _, s := range e.Strategies() {
+		if s.Name() == ev.Order.Strategy && slices.Contains(StrategySymbols(s), ev.Order.Symbol) {
+			s.OnOrderUpdate(ev.Order)
+			return
+		}
+	}
+}
+
+// Prices is the last-price service fed by the engine's candle feeds
+func (e *Engine) Prices() *PriceBook {
+	return e.prices
+}
+
+// SetClock sets the clock the engine and its order manager, exchange
+// adapter, kill switch and event bus tell time by. Set it before Start,
+// components set later are handed it too.
+func (e *Engine) SetClock(c Clock) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.clock = c
+	e.events.SetClock(c)
+	setClock(e.exchange, c)
+	setClock(e.om, c)
+	if e.kill != nil {
+		e.kill.SetClock(c)
+	}
+}
+
+// Clock is the clock the engine tells time by
+func (e *Engine) Clock() Clock {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.clock
+}
+
+// setClock hands the clock to components that tell time
+func setClock(v interface{}, c Clock) {
+	if s, ok := v.(interface{ SetClock(Clock) }); ok {
+		s.SetClock(c)
+	}
+}
+
+// setPriceSource hands the price book to components that need market prices
+func setPriceSource(v interface{}, p PriceSource) {
+	if s, ok := v.(interface{ SetPriceSource(PriceSource) }); ok {
+		s.SetPriceSource(p)
+	}
+}
+
+func (e *Engine) SetStore(s store.Store) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
 	e.store = s
+	e.journal.SetStore(s)
+}
+
+// TradeJournal is the round trip history of every strategy, kelly sizing reads it
+func (e *Engine) TradeJournal() *TradeJournal {
+	return e.journal
+}
+
+// SetRecorder enables session recording of candles and orders
+func (e *Engine) SetRecorder(r *Recorder) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.recorder = r
+	if s, ok := e.om.(interface{ SetRecorder(*Recorder) }); ok {
+		s.SetRecorder(r)
+	}
+}
+
+// SetPortfolioRisk enforces the portfolio exposure limits of p on every
+// order. Set the order manager first.
+func (e *Engine) SetPortfolioRisk(p *PortfolioRiskManager) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.portfolio = p
+	p.SetPriceSource(e.prices)
+	p.Track(e.events)
+	if s, ok := e.om.(interface{ AddOrderCheck(OrderCheck) }); ok {
+		s.AddOrderCheck(p)
+	}
+}
+
+// PortfolioRisk is the portfolio risk manager, nil when limits are not enforced
+func (e *Engine) PortfolioRisk() *PortfolioRiskManager {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.portfolio
+}
+
+// SetKillSwitch halts trading once k trips, flattening positions if k is
+// configured to. Set the order manager first.
+func (e *Engine) SetKillSwitch(k *KillSwitch) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.kill = k
+	k.SetPriceSource(e.prices)
+	k.SetClock(e.clock)
+	k.Track(e.events)
+	k.OnTrip(e.tripKillSwitch)
+	if s, ok := e.om.(interface{ AddOrderCheck(OrderCheck) }); ok {
+		s.AddOrderCheck(k)
+	}
+}
+
+// SetProtection keeps stop-loss and take-profit exits behind every position
+func (e *Engine) SetProtection(p *PositionProtector) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.protect = p
+	p.Track(e.events)
+}
+
+// Protection is the position protector, nil when none is set
+func (e *Engine) Protection() *PositionProtector {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.protect
+}
+
+// KillSwitch is the daily loss kill switch, nil when none is set
+func (e *Engine) KillSwitch() *KillSwitch {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.kill
+}
+
+// tripKillSwitch halts the strategies, cancels their resting orders and
+// closes positions if configured
+func (e *Engine) tripKillSwitch(reason string) {
+	e.Halt()
+	e.lock.Lock()
+	k, om := e.kill, e.om
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	uncanceled := 0
+	if e.exchange != nil {
+		uncanceled = e.cancelOpenOrders(ctx, e.exchange)
+	}
+	e.lock.Unlock()
+
+	report := "Trading halted: " + reason
+	if uncanceled > 0 {
+		report += fmt.Sprintf("\nopen orders of %d symbols could not be canceled", uncanceled)
+	}
+	// orders waiting for their market to open are not placed either
+	if q, ok := om.(interface{ DropQueued() []Order }); ok {
+		if dropped := q.DropQueued(); len(dropped) > 0 {
+			log.Printf("kill switch: dropped %d orders queued for the market open", len(dropped))
+			report += fmt.Sprintf("\ndropped %d orders queued for the market open", len(dropped))
+		}
+	}
+	if k != nil && k.Config().Flatten && om != nil {
+		for _, o := range k.FlattenOrders() {
+			r, err := om.Submit(ctx, o)
+			if err != nil {
+				log.Printf("kill switch: could not flatten %s %s of %s: %v", o.Quantity, o.Symbol, o.Strategy, err)
+				report += fmt.Sprintf("\nfailed to flatten %s %s of %s: %v", o.Quantity, o.Symbol, o.Strategy, err)
+				continue
+			}
+			if r.Status == OrderStatusQueued {
+				report += fmt.Sprintf("\nqueued %s %s %s of %s to flatten at the market open", o.Side, o.Quantity, o.Symbol, o.Strategy)
+				continue
+			}
+			report += fmt.Sprintf("\nflattened %s %s %s of %s", o.Side, o.Quantity, o.Symbol, o.Strategy)
+		}
+	}
+	e.notify(ctx, SubjectKillSwitch, report)
+}
+
+// Halt stops feeding candles to strategies while the engine keeps running.
+// The candle in hand finishes first. Resume starts the feeds again.
+func (e *Engine) Halt() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.halted {
+		return
+	}
+	e.halted = true
+	if e.running() {
+		e.feedCancel()
+		e.wg.Wait()
+	}
+	e.setStatus("Halted")
+	log.Println("Engine halted, strategies receive no candles")
+}
+
+// Resume restarts the candle feeds of a halted engine
+func (e *Engine) Resume() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if !e.halted {
+		return
+	}
+	e.halted = false
+	if e.ctx != nil && e.ctx.Err() == nil {
+		e.subscribe()
+		e.setStatus("Started")
+	}
+	log.Println("Engine resumed")
 }
 
 func (e *Engine) ExchangeAdapter() ExchangeAdapter {
+	e.lock.Lock()
+	defer e.lock.Unlock()
 	return e.exchange
 }
 
 func (e *Engine) OrderManager() OrderExecutor {
+	e.lock.Lock()
+	defer e.lock.Unlock()
 	return e.om
 }
 
-func (e *Engine) Store() *store.SQLiteStore {
+func (e *Engine) Store() store.Store {
+	e.lock.Lock()
+	defer e.lock.Unlock()
 	return e.store
 }
 
+// Strategies returns a copy of the registered strategies
 func (e *Engine) Strategies() []Strategy {
-	return e.strategies
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	out := make([]Strategy, len(e.strategies))
+	copy(out, e.strategies)
+	return out
+}
+
+// SetFeedConfig sets the backpressure policy for candle feeds of symbol.
+// An empty symbol sets the default for all feeds.
+func (e *Engine) SetFeedConfig(symbol string, cfg FeedConfig) {
+	e.feedMt.Lock()
+	defer e.feedMt.Unlock()
+	e.feedCfg[symbol] = cfg
+}
+
+func (e *Engine) feedConfig(symbol string) FeedConfig {
+	e.feedMt.Lock()
+	defer e.feedMt.Unlock()
+	if cfg, ok := e.feedCfg[symbol]; ok {
+		return cfg
+	}
+	return e.feedCfg[""]
+}
+
+// FeedStats reports received, delivered and dropped candles per strategy feed
+func (e *Engine) FeedStats() []FeedStats {
+	e.feedMt.Lock()
+	defer e.feedMt.Unlock()
+	out := make([]FeedStats, 0, len(e.feeds))
+	for _, f := range e.feeds {
+		out = append(out, f.stats())
+	}
+	return out
 }
 
 // Start subscribes strategies to candle feeds and runs them
 func (e *Engine) Start(ctx context.Context) {
-	e.ctx, e.cancel = context.WithCancel(ctx)
-
+	// the exchange is not called while holding the lock
+	eq, valued := e.runEquity()
 	e.lock.Lock()
-	defer e.lock.Unlock()
+	e.ctx, e.cancel = context.WithCancel(ctx)
+	e.liqWatched = make(map[string]bool)
 	log.Println("Loading strategies")
 	for _, s := range e.strategies {
 		// Start each strategy
 		s.OnStart()
+	}
+	if e.recorder != nil {
+		e.recorder.Begin()
+	}
+	if e.store != nil {
+		e.beginRun(eq, valued)
+	}
+	if !e.halted {
+		e.subscribe()
+	}
+	if t, ok := e.om.(interface{ TrackOrders(context.Context) }); ok {
+		symbols, ctx := e.symbols(), e.ctx
+		go func() {
+			// orders an earlier run left working are tracked alongside new ones
+			if r, ok := t.(interface {
+				Reconcile(context.Context, string) ([]Order, error)
+			}); ok {
+				for _, symbol := range symbols {
+					if _, err := r.Reconcile(ctx, symbol); err != nil {
+						log.Printf("could not list %s orders resting on the exchange: %v", symbol, err)
+					}
+				}
+			}
+			t.TrackOrders(ctx)
+		}()
+	}
+	if p, ok := e.om.(interface{ ProbeExchange(context.Context) }); ok {
+		go p.ProbeExchange(e.ctx)
+	}
+	if e.kill != nil {
+		go e.kill.Run(e.ctx, 5*time.Second)
+	}
+	if e.equityEvery > 0 && e.store != nil {
+		go e.recordEquity(e.ctx, e.store, e.equityEvery)
+	}
+	if e.stateEvery > 0 && e.store != nil {
+		go e.saveStates(e.ctx, e.stateEvery)
+	}
+	if e.health != nil && e.health.Config().Every > 0 {
+		go e.runHealthChecks(e.ctx, e.health.Config().Every)
+	}
+	// a halted engine still watches its positions
+	for _, symbol := range e.symbols() {
+		e.watchLiquidationOf(symbol)
+	}
+	if e.recon != nil && e.reconEvery > 0 {
+		go e.runReconciler(e.ctx, e.reconEvery)
+	}
 
-		// Subscribe to exchange candles for strategy symbol
-		symbol := s.Symbol()  // assume Strategy interface has Symbol()
-		interval := int64(60) // 1-min candles, adjust as needed
-		candleCh, err := e.exchange.SubscribeCandles(e.ctx, symbol, interval)
+	log.Println("Engine started")
+	if e.halted {
+		e.setStatus("Halted")
+	} else {
+		e.setStatus("Started")
+	}
+	runCtx := e.ctx
+	e.lock.Unlock()
+
+	// Wait until canceled
+	<-runCtx.Done()
+}
+
+// running reports whether candle feeds are live. Callers must hold e.lock.
+func (e *Engine) running() bool {
+	return e.feedCtx != nil && e.feedCtx.Err() == nil
+}
+
+// subscribe opens one candle subscription per symbol on the current exchange
+// adapter and gives every strategy its own feed of it. Callers must hold e.lock.
+func (e *Engine) subscribe() {
+	e.feedCtx, e.feedCancel = context.WithCancel(e.ctx)
+	e.groups = make(map[feedKey]*feedGroup)
+	e.subs = make(map[string]*feedSub)
+
+	e.feedMt.Lock()
+	e.feeds = nil
+	e.feedMt.Unlock()
+
+	for _, s := range e.strategies {
+		if err := e.attach(s); err != nil {
+			log.Printf("failed to subscribe candles for %s: %v", s.Symbol(), err)
+		}
+	}
+}
+
+// candleInterval is the candle size s subscribes to
+func candleInterval(s Strategy) int64 {
+	if iv := s.Interval(); iv > 0 {
+		return iv
+	}
+	return DefaultCandleInterval
+}
+
+// attach gives s its own feed of the upstream subscription of its symbol,
+// and of each other symbol it reads, opening the subscriptions s is the
+// first strategy on. Callers must hold e.lock.
+func (e *Engine) attach(s Strategy) error {
+	key := feedKey{symbol: s.Symbol(), interval: candleInterval(s)}
+	sub := &feedSub{strategy: s, ch: make(chan Candle), done: make(chan struct{})}
+	if err := e.join(key, sub); err != nil {
+		return err
+	}
+	if ms, ok := s.(MultiSymbolStrategy); ok {
+		for _, symbol := range ms.Symbols() {
+			if symbol == key.symbol {
+				continue
+			}
+			leg := &feedSub{strategy: s, ch: make(chan Candle), done: make(chan struct{})}
+			if err := e.join(feedKey{symbol: symbol, interval: key.interval}, leg); err != nil {
+				for _, l := range sub.legs {
+					e.leave(l)
+				}
+				e.leave(sub)
+				return err
+			}
+			sub.legs = append(sub.legs, leg)
+		}
+	}
+
+	e.subs[s.Name()] = sub
+	sub.feed = e.newFeed(sub)
+	// strategies added or replaced while running trade symbols Start did not watch
+	for _, symbol := range StrategySymbols(s) {
+		e.watchLiquidationOf(symbol)
+	}
+
+	// tick-driven strategies also get the trades of their symbol
+	var trades <-chan Trade
+	if _, ok := s.(TickStrategy); ok {
+		ch, err := e.exchange.SubscribeTrades(sub.ctx, key.symbol)
 		if err != nil {
-			log.Printf("failed to subscribe candles for %s: %v", symbol, err)
-			continue
+			log.Printf("%s gets no %s trades: %v", s.Name(), key.symbol, err)
+		} else {
+			trades = ch
 		}
+	}
+	var books <-chan OrderBook
+	if bs, ok := s.(BookStrategy); ok {
+		ch, err := e.exchange.SubscribeOrderBook(sub.ctx, key.symbol, bs.BookDepth())
+		if err != nil {
+			log.Printf("%s gets no %s order book: %v", s.Name(), key.symbol, err)
+		} else {
+			books = ch
+		}
+	}
 
-		// Launch a goroutine to feed candles to the strategy
+	// Launch a goroutine to feed candles to the strategy
+	e.wg.Add(1)
+	go func() {
+		defer close(sub.done)
+		e.runStrategy(sub.ctx, s, key.interval, sub.feed.out, trades, books)
+	}()
+	for _, leg := range sub.legs {
+		leg.feed = e.newFeed(leg)
 		e.wg.Add(1)
-		cc := 0
-		go func(st Strategy, ch <-chan Candle) {
-			log.Printf("Candle receiver started, now feeding candle to Strategy : %s", s.Name())
-			defer e.wg.Done()
-			for {
-				select {
-				case c, ok := <-ch:
-					if !ok {
-						log.Printf("Candle sending closed. Sent total %d candles", cc)
-						return
+		go func() {
+			defer close(leg.done)
+			e.runLeg(leg.ctx, s.(MultiSymbolStrategy), leg.key.symbol, leg.feed.out)
+		}()
+	}
+	return nil
+}
+
+// join adds sub to the upstream subscription of key, opening it if sub is
+// the first on it. Callers must hold e.lock.
+func (e *Engine) join(key feedKey, sub *feedSub) error {
+	sub.key = key
+	for {
+		g := e.groups[key]
+		var in <-chan Candle
+		if g == nil {
+			// one upstream subscription per symbol and interval, fanned out to strategies
+			g = newFeedGroup(e.feedCtx, key)
+			ch, err := e.exchange.SubscribeCandles(g.ctx, key.symbol, key.interval)
+			if err != nil {
+				g.cancel()
+				return err
+			}
+			in = ch
+			e.groups[key] = g
+		}
+		sub.ctx, sub.cancel = context.WithCancel(g.ctx)
+		if !g.join(sub) {
+			// the upstream ended, start over with a new subscription
+			sub.cancel()
+			delete(e.groups, key)
+			continue
+		}
+		if in != nil {
+			rec := e.recorder
+			prices := e.prices
+			protect, runCtx := e.protect, e.ctx
+			brackets, _ := e.om.(interface {
+				OnCandle(context.Context, string, Candle)
+			})
+			bus := e.events
+			db := e.store
+			go g.fanOut(in, func(c Candle) {
+				prices.UpdateCandle(key.symbol, c)
+				bus.Publish(Event{Type: EventCandle, Symbol: key.symbol, Candle: c})
+				if db != nil {
+					// kept to warm strategies up after a restart
+					if err := db.SaveCandle(key.symbol, key.interval, c.Time.UTC().Format(time.RFC3339), c.Open, c.High, c.Low, c.Close, c.Volume); err != nil {
+						log.Printf("failed to save %s candle: %v", key.symbol, err)
 					}
-					cc++
-					st.OnCandle(c)
-				case <-e.ctx.Done():
-					log.Printf("Candle sending stopped. Sent total %d candles", cc)
-					return
 				}
+				if rec != nil {
+					rec.RecordCandle("feed", key.symbol, c)
+				}
+				if protect != nil {
+					protect.OnCandle(runCtx, key.symbol, c)
+				}
+				if brackets != nil {
+					brackets.OnCandle(runCtx, key.symbol, c)
+				}
+			})
+		} else {
+			log.Printf("Sharing one %s candle subscription between %d strategies", key.symbol, len(g.subscribers()))
+		}
+		return nil
+	}
+}
+
+// newFeed opens the candle feed sub reads through. Callers must hold e.lock.
+func (e *Engine) newFeed(sub *feedSub) *candleFeed {
+	f := newCandleFeed(sub.ctx, sub.strategy.Name(), sub.key.symbol, sub.ch, e.feedConfig(sub.key.symbol))
+	e.feedMt.Lock()
+	e.feeds = append(e.feeds, f)
+	e.feedMt.Unlock()
+	return f
+}
+
+// detach stops the feeds of s and closes the upstream subscriptions once
+// no strategy is left on them. Callers must hold e.lock and wait on the
+// returned sub after releasing it.
+func (e *Engine) detach(s Strategy) *feedSub {
+	sub := e.subs[s.Name()]
+	if sub == nil {
+		return nil
+	}
+	delete(e.subs, s.Name())
+	for _, leg := range sub.legs {
+		e.leave(leg)
+	}
+	e.leave(sub)
+	return sub
+}
+
+// leave stops the feed of sub and closes its upstream subscription once no
+// strategy is left on it. Callers must hold e.lock.
+func (e *Engine) leave(sub *feedSub) {
+	sub.cancel()
+	if g := e.groups[sub.key]; g != nil && g.leave(sub) == 0 {
+		g.cancel()
+		delete(e.groups, sub.key)
+	}
+
+	e.feedMt.Lock()
+	for i, f := range e.feeds {
+		if f == sub.feed {
+			e.feeds = append(e.feeds[:i:i], e.feeds[i+1:]...)
+			break
+		}
+	}
+	e.feedMt.Unlock()
+}
+
+// runLeg hands the candles of symbol from ch to st until the feed closes or stops
+func (e *Engine) runLeg(ctx context.Context, st MultiSymbolStrategy, symbol string, ch <-chan Candle) {
+	defer e.wg.Done()
+	for {
+		select {
+		case c, ok := <-ch:
+			if !ok {
+				return
 			}
-		}(s, candleCh)
+			st.OnSymbolCandle(symbol, c)
+		case <-ctx.Done():
+			return
+		}
 	}
+}
 
-	log.Println("Engine started")
-	e.status = "Started"
+// runStrategy hands candles from ch to st until the feed closes or stops
+func (e *Engine) runStrategy(ctx context.Context, st Strategy, interval int64, ch <-chan Candle, trades <-chan Trade, books <-chan OrderBook) {
+	log.Printf("Candle receiver started, now feeding candle to Strategy : %s", st.Name())
+	defer e.wg.Done()
+	onCandle := CandleHandler(st, interval)
+	cc := 0
+	for {
+		select {
+		case c, ok := <-ch:
+			if !ok {
+				log.Printf("Candle sending closed. Sent total %d candles", cc)
+				return
+			}
+			cc++
+			onCandle(c)
+		case t, ok := <-trades:
+			if !ok {
+				// candles keep coming without trades
+				trades = nil
+				continue
+			}
+			st.(TickStrategy).OnTrade(t)
+		case b, ok := <-books:
+			if !ok {
+				books = nil
+				continue
+			}
+			st.(BookStrategy).OnOrderBook(b)
+		case <-ctx.Done():
+			log.Printf("Candle sending stopped. Sent total %d candles", cc)
+			return
+		}
+	}
+}
 
-	// Wait until canceled
-	<-e.ctx.Done()
+// SwapExchangeAdapter replaces the exchange adapter while the engine keeps running.
+// Candle feeds are stopped and drained, open orders on the old adapter are
+// canceled, then strategies are resubscribed on the new adapter.
+func (e *Engine) SwapExchangeAdapter(ctx context.Context, x ExchangeAdapter) error {
+	if x == nil {
+		return errors.New("nil exchange adapter")
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	old := e.exchange
+	running := e.running()
+	if running {
+		e.feedCancel()
+		e.wg.Wait()
+	}
+
+	if old != nil {
+		e.cancelOpenOrders(ctx, old)
+	}
+
+	e.exchange = x
+	setPriceSource(x, e.prices)
+	setClock(x, e.clock)
+	if s, ok := e.om.(interface{ SetExchange(ExchangeAdapter) }); ok {
+		s.SetExchange(x)
+	}
+	log.Printf("Exchange adapter swapped to %s", x.AdapterName())
+
+	if running {
+		e.subscribe()
+	}
+	return nil
+}
+
+// symbols returns the symbols the strategies trade. Callers must hold e.lock.
+func (e *Engine) symbols() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, s := range e.strategies {
+		for _, symbol := range StrategySymbols(s) {
+			if !seen[symbol] {
+				seen[symbol] = true
+				out = append(out, symbol)
+			}
+		}
+	}
+	return out
+}
+
+// cancelOpenOrders cancels every order resting on x in the symbols the
+// strategies trade and marks the ones the store still considers open
+// canceled. Symbols x fails to cancel are left open and logged for
+// reconciliation; their count is returned.
+func (e *Engine) cancelOpenOrders(ctx context.Context, x ExchangeAdapter) (failed int) {
+	for _, symbol := range e.symbols() {
+		var orders []store.OrderRecord
+		if e.store != nil {
+			var err error
+			if orders, err = e.store.LoadOpenOrders(symbol, e.clock.Now()); err != nil {
+				log.Printf("failed to load open orders for %s: %v", symbol, err)
+			}
+		}
+		if err := x.CancelAllOrders(ctx, symbol); err != nil {
+			log.Printf("could not cancel %s orders on %s, needs reconciliation: %v", symbol, x.AdapterName(), err)
+			failed++
+			continue
+		}
+		for _, o := range orders {
+			if err := e.store.UpdateOrderStatus(o.ID, string(OrderStatusCanceled)); err != nil {
+				log.Printf("failed to mark order %s canceled: %v", o.ID, err)
+			}
+		}
+	}
+	return failed
 }
 
 func (e *Engine) Stop() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
 	if e.cancel != nil {
 		e.cancel()
 	}
@@ -117,14 +914,46 @@ func (e *Engine) Stop() {
 	for _, s := range e.strategies {
 		s.OnStop()
 	}
-	e.status = "Stopped"
+	run := e.run.ID
+	// the closing equity is valued without the lock, the exchange may be slow
+	e.lock.Unlock()
+	var eq float64
+	var valued bool
+	if run != "" {
+		eq, valued = e.runEquity()
+	}
+	e.lock.Lock()
+	e.endRun(run, eq, valued)
+	e.setStatus("Stopped")
 	log.Println("Engine stopped")
 }
 
-func (e *Engine) Status() interface{} {
-	return struct {
-		Message string `json:"message"`
-	}{
-		Message: e.status,
+// setStatus records and publishes the engine status. Callers must hold e.lock.
+func (e *Engine) setStatus(status string) {
+	if status == e.status {
+		return
+	}
+	e.status = status
+	e.events.Publish(Event{Type: EventStatus, Status: status})
+}
+
+// EngineStatus is what /api/status reports
+type EngineStatus struct {
+	Message  string           `json:"message"`       // Started | Halted | Stopped
+	Run      string           `json:"run,omitempty"` // id of the current run
+	Breakers []BreakerStatus  `json:"breakers,omitempty"`
+	Health   []ExchangeHealth `json:"exchange_health,omitempty"`
+}
+
+func (e *Engine) Status() EngineStatus {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	st := EngineStatus{Message: e.status, Run: e.run.ID}
+	if b, ok := e.om.(interface{ Breakers() []BreakerStatus }); ok {
+		st.Breakers = b.Breakers()
+	}
+	if e.health != nil {
+		st.Health = e.health.Health()
 	}
+	return st
 }
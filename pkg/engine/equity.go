@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultEquityQuote is the balance counted as cash when valuing the
+// account, unless set with SetEquityQuote or named by the exchange
+const DefaultEquityQuote = "USD"
+
+// SetEquityQuote sets the balance counted as cash when valuing and
+// reconciling the account, "" takes the one the exchange names
+func (e *Engine) SetEquityQuote(asset string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.quote = asset
+}
+
+// quoteAsset is the balance of ex counted as cash: asset when set, else
+// the one ex names, else DefaultEquityQuote
+func quoteAsset(ex ExchangeAdapter, asset string) string {
+	if asset != "" {
+		return asset
+	}
+	if q, ok := ex.(QuoteAssetProvider); ok && q.QuoteAsset() != "" {
+		return q.QuoteAsset()
+	}
+	return DefaultEquityQuote
+}
+
+// SetEquityInterval makes the engine persist an equity sample every d while
+// it runs, zero turns the recorder off. Set the store first.
+func (e *Engine) SetEquityInterval(d time.Duration) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.equityEvery = d
+}
+
+// Equity values the account now: the quote balance on the exchange plus
+// every open strategy position marked to its last price
+func (e *Engine) Equity(ctx context.Context) (store.EquityRecord, error) {
+	e.lock.Lock()
+	ex, asset := e.exchange, e.quote
+	e.lock.Unlock()
+	return e.equity(ctx, ex, asset)
+}
+
+// equity values the account with the balances of ex, nil for none, cash
+// being the balance quoteAsset picks for asset
+func (e *Engine) equity(ctx context.Context, ex ExchangeAdapter, asset string) (store.EquityRecord, error) {
+	rec := store.EquityRecord{Time: e.clock.Now().UTC()}
+	var cash, value, realized, unrealized decimal.Decimal
+	if ex != nil {
+		bals, err := ex.GetBalances(ctx)
+		if err != nil {
+			return rec, err
+		}
+		cash = bals[quoteAsset(ex, asset)]
+	}
+	for _, s := range e.positions.Symbols() {
+		realized = realized.Add(s.Realized)
+		unrealized = unrealized.Add(s.Unrealized)
+		if mark, ok := e.prices.LastPrice(s.Symbol); ok {
+			value = value.Add(s.Quantity.Mul(mark))
+		}
+	}
+	rec.Cash = cash.InexactFloat64()
+	rec.Equity = cash.Add(value).InexactFloat64()
+	rec.Realized = realized.InexactFloat64()
+	rec.Unrealized = unrealized.InexactFloat64()
+	return rec, nil
+}
+
+// recordEquity persists an equity sample every interval until ctx ends
+func (e *Engine) recordEquity(ctx context.Context, db store.Store, every time.Duration) {
+	t := e.clock.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			rec, err := e.Equity(ctx)
+			if err != nil {
+				log.Printf("equity recorder: %v", err)
+				continue
+			}
+			if err := db.SaveEquity(rec); err != nil {
+				log.Printf("equity recorder: save: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type EventType string
+
+const (
+	// EventOrderFilled is published by the order manager after an order fills
+	EventOrderFilled EventType = "order.filled"
+	// EventOrderUpdated is published whenever an order changes status
+	EventOrderUpdated EventType = "order.updated"
+	// EventCandle is published for each candle the engine receives
+	EventCandle EventType = "candle"
+	// EventStatus is published when the engine starts, halts or stops
+	EventStatus EventType = "engine.status"
+	// EventSignal is published for each signal of a signal-only strategy,
+	// carrying the order it would have submitted
+	EventSignal EventType = "strategy.signal"
+	// EventBalance is published when the exchange pushes balance changes
+	EventBalance EventType = "account.balance"
+)
+
+// Event carries the order it is about. For EventOrderFilled Quantity,
+// FilledPrice and Fee describe just that fill, a partial fill of a larger
+// order publishes one event per execution. Candle events carry Symbol and
+// Candle instead, status events the new Status and balance events the free
+// Balances of the assets that changed.
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	Order    Order
+	Symbol   string
+	Candle   Candle
+	Status   string
+	Balances map[string]decimal.Decimal
+}
+
+// EventBus fans engine events out to subscribers. Each subscriber gets its own
+// queue and goroutine, so publishing never blocks on a slow handler and
+// handlers may take locks the publisher is holding.
+type EventBus struct {
+	mt      sync.RWMutex
+	subs    map[EventType][]*subscriber
+	pending atomic.Int64
+	clock   Clock // stamps events published without a time
+}
+
+type subscriber struct {
+	mt    sync.Mutex
+	queue []Event
+	wake  chan struct{}
+	fn    func(Event)
+	bus   *EventBus
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[EventType][]*subscriber), clock: RealClock}
+}
+
+// Subscribe calls fn for every event of type t, in publish order, until the
+// returned func is called. Events queued before then are still handled.
+func (b *EventBus) Subscribe(t EventType, fn func(Event)) (unsubscribe func()) {
+	s := &subscriber{wake: make(chan struct{}, 1), fn: fn, bus: b}
+	go s.run()
+
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	b.subs[t] = append(b.subs[t], s)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mt.Lock()
+			defer b.mt.Unlock()
+			subs := b.subs[t]
+			for i, cur := range subs {
+				if cur == s {
+					b.subs[t] = append(subs[:i:i], subs[i+1:]...)
+					close(s.wake)
+					return
+				}
+			}
+		})
+	}
+}
+
+// Close stops every subscriber once its queued events are handled
+func (b *EventBus) Close() {
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	for _, subs := range b.subs {
+		for _, s := range subs {
+			close(s.wake)
+		}
+	}
+	b.subs = make(map[EventType][]*subscriber)
+}
+
+// SetClock sets the clock stamping events published without a time
+func (b *EventBus) SetClock(c Clock) {
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	b.clock = c
+}
+
+func (b *EventBus) Publish(ev Event) {
+	b.mt.RLock()
+	defer b.mt.RUnlock()
+	if ev.Time.IsZero() {
+		ev.Time = b.clock.Now()
+	}
+	for _, s := range b.subs[ev.Type] {
+		b.pending.Add(1)
+		s.push(ev)
+	}
+}
+
+// Drain waits until every published event has been handled
+func (b *EventBus) Drain(ctx context.Context) error {
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	for b.pending.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+	return nil
+}
+
+func (s *subscriber) push(ev Event) {
+	s.mt.Lock()
+	s.queue = append(s.queue, ev)
+	s.mt.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) run() {
+	for range s.wake {
+		for {
+			s.mt.Lock()
+			if len(s.queue) == 0 {
+				s.mt.Unlock()
+				break
+			}
+			ev := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mt.Unlock()
+			s.fn(ev)
+			s.bus.pending.Add(-1)
+		}
+	}
+}
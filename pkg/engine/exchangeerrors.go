@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// maxPlaceAttempts bounds how often Submit sends an order whose errors are
+// Retryable
+const maxPlaceAttempts = 5
+
+// Classes of the errors exchanges answer with. Adapters return them as the
+// Class of an ExchangeError, so callers test them with errors.Is.
+var (
+	ErrRateLimited       = errors.New("rate limited")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrInvalidSymbol     = errors.New("invalid symbol")
+	ErrMinNotional       = errors.New("below the minimum order size")
+	ErrRejected          = errors.New("rejected")
+	ErrNetworkTimeout    = errors.New("network timeout")
+)
+
+// ExchangeError is an error answered by an exchange, sorted into one of
+// the classes above
+type ExchangeError struct {
+	Exchange   string
+	Class      error
+	Code       string        // the exchange's own error code, when it sends one
+	Message    string        // what the exchange said
+	RetryAfter time.Duration // how long a rate limited caller is asked to wait
+}
+
+func (e *ExchangeError) Error() string {
+	msg := fmt.Sprintf("%s: %v", e.Exchange, e.Class)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Code != "" {
+		msg += " (code " + e.Code + ")"
+	}
+	return msg
+}
+
+func (e *ExchangeError) Unwrap() error { return e.Class }
+
+// Retryable reports whether sending a request again may succeed after err.
+// Rate limits and network timeouts pass, so do transport errors that never
+// reached the exchange; every other answer would only be repeated, as would
+// errors nothing classified.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrNetworkTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// retryWait is how long to wait after failed attempt n with err: a backoff
+// doubling from base, jittered over its upper half so callers failing
+// together do not retry together, or the wait a rate limit asked for when
+// that is longer
+func retryWait(base time.Duration, n int, err error) time.Duration {
+	d := base << (n - 1)
+	d = d/2 + rand.N(d/2+1)
+	var xe *ExchangeError
+	if errors.As(err, &xe) && xe.RetryAfter > d {
+		d = xe.RetryAfter
+	}
+	return d
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ExpiringExchange is implemented by exchange adapters that can place GTT
+// orders, the exchange canceling them at their ExpireAt. The order manager
+// cancels the expired orders of the others itself.
+type ExpiringExchange interface {
+	ExpiresOrders() bool
+}
+
+// withTimeInForce fills in the time in force of o and checks it against
+// its expiry at now
+func withTimeInForce(o Order, now time.Time) (Order, error) {
+	switch {
+	case o.TimeInForce == "" && !o.ExpireAt.IsZero():
+		o.TimeInForce = TimeInForceGTT
+	case o.TimeInForce == "":
+		o.TimeInForce = TimeInForceGTC
+	}
+	switch o.TimeInForce {
+	case TimeInForceGTC, TimeInForceIOC, TimeInForceFOK:
+		if !o.ExpireAt.IsZero() {
+			return o, fmt.Errorf("%s order cannot expire, only %s orders do", o.TimeInForce, TimeInForceGTT)
+		}
+	case TimeInForceGTT:
+		if o.ExpireAt.IsZero() {
+			return o, fmt.Errorf("%s order needs an expiry", TimeInForceGTT)
+		}
+		if !o.ExpireAt.After(now) {
+			return o, fmt.Errorf("order expiry %s has passed", o.ExpireAt.UTC().Format(time.RFC3339))
+		}
+	default:
+		return o, fmt.Errorf("unknown time in force %q", o.TimeInForce)
+	}
+	return o, nil
+}
+
+// expireOrders cancels the tracked orders past their ExpireAt, unless the
+// exchange expires them itself
+func (om *OrderManager) expireOrders(ctx context.Context) {
+	ex := om.currentExchange()
+	if e, ok := ex.(ExpiringExchange); ok && e.ExpiresOrders() {
+		return
+	}
+	now := om.currentClock().Now()
+	for _, o := range om.OpenOrders() {
+		if o.ExpireAt.IsZero() || now.Before(o.ExpireAt) {
+			continue
+		}
+		if err := ex.CancelOrder(ctx, o.Symbol, o.ID); err != nil {
+			log.Printf("order %s expired but could not be canceled: %v", o.ID, err)
+			continue
+		}
+		log.Printf("Order %s expired at %s and was canceled", o.ID, o.ExpireAt.UTC().Format(time.RFC3339))
+		// what filled before the cancel still counts
+		cur := o
+		if q, ok := ex.(OrderQuerier); ok {
+			if r, err := q.GetOrder(ctx, o.Symbol, o.ID); err == nil {
+				cur = r
+			}
+		}
+		if !cur.Status.Final() {
+			cur.Status = OrderStatusCanceled
+		}
+		om.transition(o, cur)
+	}
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// BackpressurePolicy decides what a candle feed does when its strategy falls behind
+type BackpressurePolicy string
+
+const (
+	// BackpressureBlock stops reading from the adapter until the strategy catches up
+	BackpressureBlock BackpressurePolicy = "block"
+	// BackpressureDropOldest discards the oldest queued candle to make room
+	BackpressureDropOldest BackpressurePolicy = "drop-oldest"
+	// BackpressureConflate keeps only the latest undelivered candle
+	BackpressureConflate BackpressurePolicy = "conflate"
+)
+
+const defaultFeedBuffer = 1024
+
+func ParseBackpressurePolicy(s string) (BackpressurePolicy, error) {
+	switch p := BackpressurePolicy(s); p {
+	case BackpressureBlock, BackpressureDropOldest, BackpressureConflate:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown backpressure policy %q", s)
+}
+
+// FeedConfig is the backpressure setup of a candle feed
+type FeedConfig struct {
+	Policy BackpressurePolicy
+	Buffer int
+}
+
+// FeedStats is a snapshot of a feed's counters
+type FeedStats struct {
+	Strategy  string             `json:"strategy"`
+	Symbol    string             `json:"symbol"`
+	Policy    BackpressurePolicy `json:"policy"`
+	Received  int64              `json:"received"`
+	Delivered int64              `json:"delivered"`
+	Dropped   int64              `json:"dropped"`
+	Queued    int64              `json:"queued"`
+}
+
+// candleFeed sits between an adapter channel and a strategy and applies the policy
+type candleFeed struct {
+	strategy string
+	symbol   string
+	cfg      FeedConfig
+	out      chan Candle
+
+	received  atomic.Int64
+	delivered atomic.Int64
+	dropped   atomic.Int64
+	queued    atomic.Int64
+}
+
+func newCandleFeed(ctx context.Context, strategy, symbol string, in <-chan Candle, cfg FeedConfig) *candleFeed {
+	if cfg.Policy == "" {
+		cfg.Policy = BackpressureBlock
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = defaultFeedBuffer
+	}
+	if cfg.Policy == BackpressureConflate {
+		cfg.Buffer = 1
+	}
+	f := &candleFeed{strategy: strategy, symbol: symbol, cfg: cfg, out: make(chan Candle)}
+	go f.pump(ctx, in)
+	return f
+}
+
+func (f *candleFeed) pump(ctx context.Context, in <-chan Candle) {
+	defer close(f.out)
+	// fixed ring buffer, the queue never allocates after startup
+	ring := make([]Candle, f.cfg.Buffer)
+	head, size := 0, 0
+
+	for {
+		f.queued.Store(int64(size))
+
+		var out chan Candle
+		var next Candle
+		if size > 0 {
+			out = f.out
+			next = ring[head]
+		}
+		src := in
+		if f.cfg.Policy == BackpressureBlock && size >= f.cfg.Buffer {
+			src = nil
+		}
+
+		select {
+		case c, ok := <-src:
+			if !ok {
+				// upstream closed, hand over what is left
+				for ; size > 0; size-- {
+					select {
+					case f.out <- ring[head]:
+						f.delivered.Add(1)
+					case <-ctx.Done():
+						return
+					}
+					head = (head + 1) % len(ring)
+				}
+				return
+			}
+			f.received.Add(1)
+			if size >= f.cfg.Buffer {
+				// only drop-oldest and conflate get here, block stops reading when full
+				head = (head + 1) % len(ring)
+				size--
+				f.dropped.Add(1)
+			}
+			ring[(head+size)%len(ring)] = c
+			size++
+		case out <- next:
+			head = (head + 1) % len(ring)
+			size--
+			f.delivered.Add(1)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *candleFeed) stats() FeedStats {
+	return FeedStats{
+		Strategy:  f.strategy,
+		Symbol:    f.symbol,
+		Policy:    f.cfg.Policy,
+		Received:  f.received.Load(),
+		Delivered: f.delivered.Load(),
+		Dropped:   f.dropped.Load(),
+		Queued:    f.queued.Load(),
+	}
+}
@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SubjectClockDrift is the notification subject of an exchange clock
+// drifting too far from the local one
+const SubjectClockDrift = "Exchange clock drift"
+
+// TimeSyncer is implemented by exchange adapters that report the time of
+// the exchange's servers
+type TimeSyncer interface {
+	ServerTime(ctx context.Context) (time.Time, error)
+}
+
+// ClockOffsetter is implemented by exchange adapters that stamp signed
+// requests with the exchange's clock rather than the local one
+type ClockOffsetter interface {
+	ClockOffset() time.Duration
+}
+
+// HealthConfig sets how often the exchange is checked and how far its clock
+// may drift before signed requests risk rejection. Binance rejects
+// requests stamped over a second ahead of its clock.
+type HealthConfig struct {
+	Every    time.Duration `json:"-"` // 0 only checks on demand
+	MaxDrift time.Duration `json:"-"`
+}
+
+// ExchangeHealth is the latest health check of one exchange adapter
+type ExchangeHealth struct {
+	Exchange  string    `json:"exchange"`
+	Healthy   bool      `json:"healthy"`
+	CheckedAt time.Time `json:"checked_at"`
+	LatencyMs float64   `json:"latency_ms"` // round trip of the check
+	// DriftMs is the exchange's clock minus the local one, measured at the
+	// middle of the round trip. Adapters without server time report none.
+	DriftMs *float64 `json:"clock_drift_ms,omitempty"`
+	// OffsetMs is the part of the drift the adapter corrects its signed
+	// requests for, as it stood before the check
+	OffsetMs *float64 `json:"clock_offset_ms,omitempty"`
+	Drifting bool     `json:"drifting,omitempty"` // the uncorrected drift is over the limit
+	Error    string   `json:"error,omitempty"`
+	Checks   int64    `json:"checks"`
+	Failures int64    `json:"failures"`
+}
+
+// ms is d in milliseconds
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// HealthMonitor checks the connectivity, latency and clock drift of
+// exchange adapters, keeping the latest result of each. Signed requests are
+// stamped with the local clock, so a drifting one gets them rejected.
+type HealthMonitor struct {
+	mt   sync.Mutex
+	cfg  HealthConfig
+	last map[string]*ExchangeHealth // by adapter name
+}
+
+func NewHealthMonitor(cfg HealthConfig) *HealthMonitor {
+	return &HealthMonitor{cfg: cfg, last: map[string]*ExchangeHealth{}}
+}
+
+// Config returns the settings of h
+func (h *HealthMonitor) Config() HealthConfig {
+	h.mt.Lock()
+	defer h.mt.Unlock()
+	return h.cfg
+}
+
+// Check runs one health check of x: its server time when it reports one,
+// its health check or a balance query otherwise. It reports whether the
+// drift went over the limit with this check.
+func (h *HealthMonitor) Check(ctx context.Context, x ExchangeAdapter) (ExchangeHealth, bool) {
+	// the local clock is the wall clock signed requests are stamped with,
+	// moved by the offset of adapters that correct it
+	var offset *time.Duration
+	if o, ok := x.(ClockOffsetter); ok {
+		d := o.ClockOffset()
+		offset = &d
+	}
+	start := time.Now()
+	var server time.Time
+	var err error
+	switch c := x.(type) {
+	case TimeSyncer:
+		server, err = c.ServerTime(ctx)
+	case HealthChecker:
+		err = c.Ping(ctx)
+	default:
+		_, err = x.GetBalances(ctx)
+	}
+	latency := time.Since(start)
+
+	h.mt.Lock()
+	defer h.mt.Unlock()
+	name := x.AdapterName()
+	st := h.last[name]
+	if st == nil {
+		st = &ExchangeHealth{Exchange: name}
+		h.last[name] = st
+	}
+	wasDrifting := st.Drifting
+	st.CheckedAt, st.LatencyMs, st.Checks = start.UTC(), ms(latency), st.Checks+1
+	st.Healthy, st.Error = err == nil, ""
+	if err != nil {
+		st.Failures++
+		st.Error = err.Error()
+		return *st, false
+	}
+	if !server.IsZero() {
+		drift := server.Sub(start.Add(latency / 2))
+		st.DriftMs = new(float64)
+		*st.DriftMs = ms(drift)
+		if offset != nil {
+			st.OffsetMs = new(float64)
+			*st.OffsetMs = ms(*offset)
+			drift -= *offset
+		}
+		st.Drifting = h.cfg.MaxDrift > 0 && drift.Abs() > h.cfg.MaxDrift
+	}
+	return *st, st.Drifting && !wasDrifting
+}
+
+// Health returns the latest check of every adapter checked so far
+func (h *HealthMonitor) Health() []ExchangeHealth {
+	h.mt.Lock()
+	defer h.mt.Unlock()
+	out := make([]ExchangeHealth, 0, len(h.last))
+	for _, st := range h.last {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Exchange < out[j].Exchange })
+	return out
+}
+
+// SetHealthMonitor checks the exchange adapter with h while the engine
+// runs, every interval of its config
+func (e *Engine) SetHealthMonitor(h *HealthMonitor) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.health = h
+}
+
+// HealthMonitor returns the exchange health monitor, nil when none is set
+func (e *Engine) HealthMonitor() *HealthMonitor {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.health
+}
+
+// runHealthChecks checks the exchange every interval until ctx ends
+func (e *Engine) runHealthChecks(ctx context.Context, every time.Duration) {
+	t := e.clock.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			if _, err := e.CheckExchangeHealth(ctx); err != nil {
+				log.Printf("exchange health: %v", err)
+			}
+		}
+	}
+}
+
+// CheckExchangeHealth runs one health check of the exchange adapter,
+// warning when its clock drifts too far for signed requests
+func (e *Engine) CheckExchangeHealth(ctx context.Context) (ExchangeHealth, error) {
+	e.lock.Lock()
+	h, x := e.health, e.exchange
+	e.lock.Unlock()
+	if h == nil {
+		return ExchangeHealth{}, fmt.Errorf("exchange health checks are not enabled")
+	}
+	if x == nil {
+		return ExchangeHealth{}, fmt.Errorf("no exchange adapter")
+	}
+	st, drifted := h.Check(ctx, x)
+	if !st.Healthy {
+		log.Printf("Exchange health check of %s failed after %.0fms: %s", st.Exchange, st.LatencyMs, st.Error)
+	}
+	if drifted {
+		off := *st.DriftMs
+		if st.OffsetMs != nil {
+			off -= *st.OffsetMs
+		}
+		msg := fmt.Sprintf("%s clock is %.0fms off the clock signed requests are stamped with, over the %s they tolerate. Sync the host clock.", st.Exchange, off, h.Config().MaxDrift)
+		log.Printf("WARNING: %s", msg)
+		e.notify(ctx, SubjectClockDrift, msg)
+	}
+	return st, nil
+}
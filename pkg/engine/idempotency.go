@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+)
+
+// defaultIdempotencyTTL is how long a client order id maps to its order
+// when SetIdempotencyTTL was not called
+const defaultIdempotencyTTL = 10 * time.Minute
+
+// idempotent is the order a client order id placed. orderID is empty while
+// the order is still being placed.
+type idempotent struct {
+	orderID string
+	expires time.Time
+}
+
+// newClientOrderID returns a random client order id, short enough for every
+// exchange adapter to pass on
+func newClientOrderID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// SetIdempotencyTTL sets how long a client order id keeps returning the
+// order it placed, unless that order reaches a final status first
+func (om *OrderManager) SetIdempotencyTTL(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.idemTTL = d
+}
+
+// loadIdempotency restores the client order ids saved by an earlier run
+func (om *OrderManager) loadIdempotency() {
+	keys, err := om.db.LoadIdempotencyKeys(om.currentClock().Now())
+	if err != nil {
+		log.Printf("failed to load idempotency keys: %v", err)
+		return
+	}
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	for _, k := range keys {
+		om.idem[k.ClientOrderID] = idempotent{orderID: k.OrderID, expires: k.Expires}
+		om.idemOrders[k.OrderID] = k.ClientOrderID
+	}
+}
+
+// reserve claims clientID for a new order. When it already placed one that
+// order's ID is returned; an error means it is being placed right now.
+func (om *OrderManager) reserve(clientID string) (string, error) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	now := om.clock.Now()
+	// expired ids are swept once per TTL, keeping submits cheap
+	if now.Sub(om.idemSwept) >= om.idemTTL {
+		for id, e := range om.idem {
+			if !now.Before(e.expires) {
+				delete(om.idem, id)
+				delete(om.idemOrders, e.orderID)
+			}
+		}
+		om.idemSwept = now
+	}
+	if e, ok := om.idem[clientID]; ok {
+		if !now.Before(e.expires) {
+			delete(om.idemOrders, e.orderID)
+		} else if e.orderID == "" {
+			return "", fmt.Errorf("order with client id %s is already being placed", clientID)
+		} else {
+			return e.orderID, nil
+		}
+	}
+	om.idem[clientID] = idempotent{expires: now.Add(om.idemTTL)}
+	return "", nil
+}
+
+// release frees clientID after its order could not be placed
+func (om *OrderManager) release(clientID string) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	if e, ok := om.idem[clientID]; ok && e.orderID == "" {
+		delete(om.idem, clientID)
+	}
+}
+
+// placed ties clientID to the order it placed, until the order is final
+func (om *OrderManager) placed(clientID string, o Order) {
+	if o.Status.Final() {
+		om.release(clientID)
+		return
+	}
+	om.mt.Lock()
+	e := idempotent{orderID: o.ID, expires: om.clock.Now().Add(om.idemTTL)}
+	om.idem[clientID] = e
+	om.idemOrders[o.ID] = clientID
+	om.mt.Unlock()
+	if om.db != nil {
+		if err := om.db.SaveIdempotencyKey(clientID, o.ID, e.expires); err != nil {
+			log.Printf("failed to persist client order id %s: %v", clientID, err)
+		}
+	}
+}
+
+// forget frees the client order id of an order that reached a final status
+func (om *OrderManager) forget(orderID string) {
+	om.mt.Lock()
+	clientID, ok := om.idemOrders[orderID]
+	if ok {
+		delete(om.idemOrders, orderID)
+		delete(om.idem, clientID)
+	}
+	om.mt.Unlock()
+	if ok && om.db != nil {
+		if err := om.db.DeleteIdempotencyKey(clientID); err != nil {
+			log.Printf("failed to delete client order id %s: %v", clientID, err)
+		}
+	}
+}
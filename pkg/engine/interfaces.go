@@ -3,10 +3,14 @@ package engine
 import (
 	"context"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type Side string
 type OrderType string
+type OrderStatus string
+type TimeInForce string
 
 const (
 	SideBuy  Side = "BUY"
@@ -14,8 +18,25 @@ const (
 
 	OrderMarket OrderType = "MARKET"
 	OrderLimit  OrderType = "LIMIT"
+
+	OrderStatusNew             OrderStatus = "NEW"
+	OrderStatusPartiallyFilled OrderStatus = "PARTIALLY_FILLED"
+	OrderStatusFilled          OrderStatus = "FILLED"
+	OrderStatusCanceled        OrderStatus = "CANCELED"
+	OrderStatusRejected        OrderStatus = "REJECTED"
+	OrderStatusQueued          OrderStatus = "QUEUED" // held by the engine until its market opens
+
+	TimeInForceGTC TimeInForce = "GTC" // good till canceled
+	TimeInForceIOC TimeInForce = "IOC" // what does not fill at once is canceled
+	TimeInForceFOK TimeInForce = "FOK" // fills in full at once or is canceled
+	TimeInForceGTT TimeInForce = "GTT" // good till ExpireAt
 )
 
+// Final reports whether an order in status s can no longer change
+func (s OrderStatus) Final() bool {
+	return s == OrderStatusFilled || s == OrderStatusCanceled || s == OrderStatusRejected
+}
+
 type Candle struct {
 	Time   time.Time `json:"time"`
 	Open   float64   `json:"open"`
@@ -26,44 +47,147 @@ type Candle struct {
 }
 
 type Order struct {
-	ID          string
-	Symbol      string
-	Side        Side
-	Type        OrderType
-	Price       float64
-	FilledPrice float64
-	Quantity    float64
-	Created     int64
-	Filled      bool
+	ID            string
+	ClientOrderID string // idempotency key of the submit, generated when empty
+	Symbol        string
+	Side          Side
+	Type          OrderType
+	Price         decimal.Decimal
+	FilledPrice   decimal.Decimal
+	Quantity      decimal.Decimal
+	Fee           decimal.Decimal // paid in the quote asset
+	Strategy      string          // name of the strategy that submitted the order
+	Created       int64
+	Filled        bool
+	FilledQty     decimal.Decimal // executed so far, equals Quantity once filled
+	Status        OrderStatus
+	TraceID       string
+	Bracket       *OrderBracket // stop-loss and take-profit placed once the order is done, on what it filled
+	TimeInForce   TimeInForce   // of limit orders, GTC when empty and GTT when ExpireAt is set
+	ExpireAt      time.Time     // when a GTT order still resting is canceled
+}
+
+// Remaining is the quantity still working on the exchange, zero once the
+// order is final even if it was canceled part filled
+func (o Order) Remaining() decimal.Decimal {
+	if o.Status.Final() || o.Filled {
+		return decimal.Zero
+	}
+	if r := o.Quantity.Sub(o.FilledQty); r.IsPositive() {
+		return r
+	}
+	return decimal.Zero
 }
 
 type Position struct {
 	Symbol   string
-	Quantity float64
-	AvgPrice float64
+	Quantity decimal.Decimal // negative when short
+	AvgPrice decimal.Decimal
+	// derivatives positions only, zero for spot balances
+	MarkPrice        decimal.Decimal
+	LiquidationPrice decimal.Decimal
+	Leverage         int
 }
 
 type Strategy interface {
 	OnCandle(c Candle)
 	Symbol() string
-	SetAccountUSD(v float64)
-	AccountBalUSD() float64
+	SetAccountUSD(v decimal.Decimal)
+	AccountBalUSD() decimal.Decimal
 	OnStart()
 	OnStop()
 	Name() string
+	// Interval is the candle size in seconds the strategy trades on
+	Interval() int64
+	// OnOrderUpdate is called when one of the strategy's orders changes status
+	OnOrderUpdate(o Order)
+}
+
+// StatefulStrategy is implemented by strategies whose internal state can be
+// serialized into engine snapshots and restored later
+type StatefulStrategy interface {
+	Strategy
+	SaveState() ([]byte, error)
+	LoadState(data []byte) error
+}
+
+// WarmUpStrategy is implemented by strategies that need a history of
+// candles before they signal. On recovery the engine hands them the recent
+// candles it stored, which they take in without trading.
+type WarmUpStrategy interface {
+	Strategy
+	// WarmUpCandles is how many candles fill the strategy's history
+	WarmUpCandles() int
+	WarmUp(candles []Candle)
+}
+
+// Cloner is implemented by strategies that can make a fresh copy of
+// themselves with the same parameters and capital but no market state,
+// trading through exec. Backtests run on clones.
+type Cloner interface {
+	Clone(exec OrderExecutor) Strategy
 }
 
 type ExchangeAdapter interface {
 	PlaceOrder(ctx context.Context, o Order) (Order, error)
 	GetPosition(ctx context.Context, symbol string) (Position, error)
-	GetBalances(ctx context.Context) (map[string]float64, error)
+	GetBalances(ctx context.Context) (map[string]decimal.Decimal, error)
 	SubscribeCandles(ctx context.Context, symbol string, interval int64) (<-chan Candle, error)
-	CancelOrder(ctx context.Context, orderID string) error
+	SubscribeTrades(ctx context.Context, symbol string) (<-chan Trade, error)                   // ErrNoTradeStream when the exchange has none
+	SubscribeOrderBook(ctx context.Context, symbol string, depth int) (<-chan OrderBook, error) // ErrNoOrderBook when the exchange has none
+	CancelOrder(ctx context.Context, symbol, orderID string) error
+	CancelAllOrders(ctx context.Context, symbol string) error // cancels every order resting on symbol
+	GetOpenOrders(ctx context.Context, symbol string) ([]Order, error)
 	AdapterName() string
 }
 
+// OrderQuerier is implemented by exchange adapters that can report the
+// current state of an order, the order manager polls it to track fills
+type OrderQuerier interface {
+	GetOrder(ctx context.Context, symbol, orderID string) (Order, error)
+}
+
+// ShortSeller is implemented by exchange adapters that can sell symbols the
+// account does not hold, opening a short. Adapters without it trade long only.
+type ShortSeller interface {
+	CanShort(symbol string) bool
+}
+
+// QuoteAssetProvider is implemented by exchange adapters whose account is
+// not kept in USD, naming the balance the account is valued in
+type QuoteAssetProvider interface {
+	QuoteAsset() string
+}
+
+// AccountStreamer is implemented by exchange adapters that push changes of
+// orders and balances as they happen. While the stream runs the order
+// manager applies them and only polls as a safety net.
+type AccountStreamer interface {
+	SubscribeAccount(ctx context.Context) (<-chan AccountUpdate, error)
+}
+
+// AccountUpdate is one change an account stream pushes: an order, the free
+// balances of the assets that changed, or Resync after the stream
+// reconnected and changes may have been missed
+type AccountUpdate struct {
+	Order    *Order
+	Balances map[string]decimal.Decimal
+	Resync   bool
+}
+
+// CandleHistory is implemented by exchange adapters that serve past
+// candles, downloads fill the store from it for backtests
+type CandleHistory interface {
+	// HistoricalCandles returns the closed candles of interval seconds
+	// starting between from and to, oldest first
+	HistoricalCandles(ctx context.Context, symbol string, interval int64, from, to time.Time) ([]Candle, error)
+}
+
+// RiskManager sizes the orders of strategies. Strategies pass each candle
+// they receive to Observe, so sizers can follow the market.
 type RiskManager interface {
-	Size(symbol string, price float64, accountBalance float64) float64
+	Size(strategy, symbol string, price decimal.Decimal, accountBalance decimal.Decimal) decimal.Decimal
+	Observe(symbol string, c Candle)
 }
 
 type OrderExecutor interface {
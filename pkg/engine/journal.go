@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"log"
+	"sync"
+
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// maxJournalResults caps the round trips kept in memory per strategy
+const maxJournalResults = 1000
+
+// TradeHistory reports the closed round trips of a strategy, sizers that
+// learn from past trades read it
+type TradeHistory interface {
+	// Results returns the PnL of up to n of the most recent round trips of strategy, oldest first
+	Results(strategy string, n int) []float64
+}
+
+// avgPosition is an average cost position, qty is negative when short
+type avgPosition struct {
+	qty  decimal.Decimal
+	cost decimal.Decimal
+}
+
+// apply adds a fill of signed qty at price and returns the PnL it realized
+func (p *avgPosition) apply(qty, price decimal.Decimal) decimal.Decimal {
+	if qty.IsZero() {
+		return decimal.Zero
+	}
+	if p.qty.IsZero() || p.qty.Sign() == qty.Sign() {
+		total := p.qty.Abs().Mul(p.cost).Add(qty.Abs().Mul(price))
+		p.qty = p.qty.Add(qty)
+		p.cost = total.Div(p.qty.Abs())
+		return decimal.Zero
+	}
+	closed := decimal.Min(qty.Abs(), p.qty.Abs())
+	pnl := price.Sub(p.cost).Mul(closed)
+	if p.qty.IsNegative() {
+		pnl = pnl.Neg()
+	}
+	p.qty = p.qty.Add(qty)
+	if !p.qty.IsZero() && p.qty.Sign() == qty.Sign() {
+		// flipped through zero, the rest opened at this price
+		p.cost = price
+	}
+	return pnl
+}
+
+// roundTrip is a strategy's position in one symbol from open to close
+type roundTrip struct {
+	avgPosition
+	pnl decimal.Decimal // realized so far, net of fees
+}
+
+// TradeJournal turns fills into round trips per strategy and symbol. A round
+// trip closes once its position is back to zero or flips side; its PnL is
+// saved to the store and kept in memory for sizing.
+type TradeJournal struct {
+	mt      sync.Mutex
+	store   store.Store
+	open    map[string]*roundTrip // by strategy and symbol
+	results map[string][]float64  // by strategy, oldest first
+	loaded  map[string]bool       // results of the strategy were read from the store
+}
+
+func NewTradeJournal() *TradeJournal {
+	return &TradeJournal{
+		open:    make(map[string]*roundTrip),
+		results: make(map[string][]float64),
+		loaded:  make(map[string]bool),
+	}
+}
+
+// SetStore sets where round trips are saved and earlier ones are loaded from
+func (j *TradeJournal) SetStore(s store.Store) {
+	j.mt.Lock()
+	defer j.mt.Unlock()
+	j.store = s
+	j.results = make(map[string][]float64)
+	j.loaded = make(map[string]bool)
+}
+
+// Track follows fills published on bus
+func (j *TradeJournal) Track(bus *EventBus) {
+	bus.Subscribe(EventOrderFilled, j.onFill)
+}
+
+func (j *TradeJournal) onFill(ev Event) {
+	o := ev.Order
+	if o.Strategy == "" {
+		return
+	}
+	price := o.FilledPrice
+	if !price.IsPositive() {
+		price = o.Price
+	}
+
+	j.mt.Lock()
+	defer j.mt.Unlock()
+	key := o.Strategy + "\x00" + o.Symbol
+	rt := j.open[key]
+	if rt == nil {
+		rt = &roundTrip{}
+		j.open[key] = rt
+	}
+	side := rt.qty.Sign()
+	rt.pnl = rt.pnl.Sub(o.Fee).Add(rt.apply(signedQty(o.Side, o.Quantity), price))
+	if side == 0 || rt.qty.Sign() == side {
+		return
+	}
+
+	pnl, _ := rt.pnl.Float64()
+	rt.pnl = decimal.Zero
+	if rt.qty.IsZero() {
+		delete(j.open, key)
+	}
+	// without a store the memory is all there is, otherwise the next load picks it up
+	if j.store == nil || j.loaded[o.Strategy] {
+		r := append(j.results[o.Strategy], pnl)
+		if len(r) > maxJournalResults {
+			r = r[len(r)-maxJournalResults:]
+		}
+		j.results[o.Strategy] = r
+	}
+	if j.store != nil {
+		if err := j.store.SaveTradeResult(o.Strategy, o.Symbol, pnl, ev.Time); err != nil {
+			log.Printf("trade journal: save %s %s round trip: %v", o.Strategy, o.Symbol, err)
+		}
+	}
+}
+
+// Results implements TradeHistory, loading the strategy's round trips from
+// the store the first time it is asked for them
+func (j *TradeJournal) Results(strategy string, n int) []float64 {
+	j.mt.Lock()
+	defer j.mt.Unlock()
+	if j.store != nil && !j.loaded[strategy] {
+		recs, err := j.store.LoadTradeResults(strategy, maxJournalResults)
+		if err != nil {
+			log.Printf("trade journal: load %s round trips: %v", strategy, err)
+			return nil
+		}
+		r := make([]float64, len(recs))
+		for i, rec := range recs {
+			r[len(recs)-1-i] = rec.PnL
+		}
+		j.results[strategy] = r
+		j.loaded[strategy] = true
+	}
+	r := j.results[strategy]
+	if n > 0 && len(r) > n {
+		r = r[len(r)-n:]
+	}
+	return append([]float64(nil), r...)
+}
@@ -0,0 +1,295 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrKillSwitch is returned for orders that would add risk while the kill switch is tripped
+var ErrKillSwitch = errors.New("kill switch tripped")
+
+// KillSwitchConfig sets when the kill switch trips. A zero loss limit disables it.
+type KillSwitchConfig struct {
+	DailyLossLimit decimal.Decimal `json:"daily_loss_limit_usd"` // trip once the day's PnL falls to minus this
+	Flatten        bool            `json:"flatten"`              // close every position when tripped
+}
+
+// KillSwitchStatus is the state reported by /api/killswitch
+type KillSwitchStatus struct {
+	Enabled    bool            `json:"enabled"`
+	Tripped    bool            `json:"tripped"`
+	TrippedAt  *time.Time      `json:"tripped_at,omitempty"`
+	Reason     string          `json:"reason,omitempty"`
+	Day        string          `json:"day"`
+	Realized   decimal.Decimal `json:"realized"`
+	Unrealized decimal.Decimal `json:"unrealized"`
+	PnL        decimal.Decimal `json:"pnl"` // since the start of the day or the last reset
+	LossLimit  decimal.Decimal `json:"loss_limit_usd"`
+	Flatten    bool            `json:"flatten"`
+}
+
+// killPosition is a strategy's average cost position in one symbol
+type killPosition struct {
+	avgPosition
+	strategy string
+	symbol   string
+}
+
+// KillSwitch follows fills per strategy and symbol and trips once the
+// realized plus unrealized PnL of the UTC day breaches the loss limit.
+// While tripped it only lets orders through that reduce a position.
+// It stays tripped across days until Reset.
+type KillSwitch struct {
+	mt        sync.Mutex
+	cfg       KillSwitchConfig
+	prices    PriceSource
+	positions map[string]*killPosition // by strategy and symbol
+	clock     Clock
+
+	day      time.Time
+	realized decimal.Decimal // today's realized PnL net of fees
+	baseline decimal.Decimal // unrealized PnL at the start of the day, moved by Reset
+
+	tripped   bool
+	trippedAt time.Time
+	reason    string
+	onTrip    func(reason string)
+}
+
+func NewKillSwitch(cfg KillSwitchConfig) *KillSwitch {
+	return &KillSwitch{cfg: cfg, positions: make(map[string]*killPosition), clock: RealClock}
+}
+
+// SetClock sets the clock days and trips are told by
+func (k *KillSwitch) SetClock(c Clock) {
+	k.mt.Lock()
+	defer k.mt.Unlock()
+	k.clock = c
+}
+
+// SetPriceSource sets where open positions get their mark prices from
+func (k *KillSwitch) SetPriceSource(ps PriceSource) {
+	k.mt.Lock()
+	defer k.mt.Unlock()
+	k.prices = ps
+}
+
+// OnTrip sets what runs once the kill switch trips
+func (k *KillSwitch) OnTrip(fn func(reason string)) {
+	k.mt.Lock()
+	defer k.mt.Unlock()
+	k.onTrip = fn
+}
+
+// SetConfig changes the loss limit and whether a trip flattens positions.
+// A trip already taken stands until Reset.
+func (k *KillSwitch) SetConfig(cfg KillSwitchConfig) {
+	k.mt.Lock()
+	defer k.mt.Unlock()
+	k.cfg = cfg
+}
+
+func (k *KillSwitch) Config() KillSwitchConfig {
+	k.mt.Lock()
+	defer k.mt.Unlock()
+	return k.cfg
+}
+
+// Track follows fills published on bus
+func (k *KillSwitch) Track(bus *EventBus) {
+	bus.Subscribe(EventOrderFilled, k.onFill)
+}
+
+// Run re-evaluates the PnL of open positions until ctx is done, so the
+// switch trips on adverse price moves and not just on fills
+func (k *KillSwitch) Run(ctx context.Context, every time.Duration) {
+	k.mt.Lock()
+	t := k.clock.NewTicker(every)
+	k.mt.Unlock()
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C():
+			k.evaluate(now)
+		}
+	}
+}
+
+func (k *KillSwitch) onFill(ev Event) {
+	o := ev.Order
+	price := o.FilledPrice
+	if !price.IsPositive() {
+		price = o.Price
+	}
+	qty := signedQty(o.Side, o.Quantity)
+
+	k.mt.Lock()
+	k.rollover(ev.Time)
+	key := o.Strategy + "\x00" + o.Symbol
+	p := k.positions[key]
+	if p == nil {
+		p = &killPosition{strategy: o.Strategy, symbol: o.Symbol}
+		k.positions[key] = p
+	}
+	k.realized = k.realized.Sub(o.Fee).Add(p.apply(qty, price))
+	k.mt.Unlock()
+
+	k.evaluate(ev.Time)
+}
+
+// rollover starts a new day at UTC midnight. Callers must hold k.mt.
+func (k *KillSwitch) rollover(now time.Time) {
+	if now.IsZero() {
+		now = k.clock.Now()
+	}
+	day := now.UTC().Truncate(24 * time.Hour)
+	if !day.After(k.day) {
+		return
+	}
+	if !k.day.IsZero() {
+		log.Printf("Kill switch: day %s closed with PnL %s", k.day.Format("2006-01-02"), k.pnl().StringFixed(2))
+	}
+	k.day = day
+	k.realized = decimal.Zero
+	k.baseline = k.unrealized()
+}
+
+// unrealized marks every open position to its last price. Callers must hold k.mt.
+func (k *KillSwitch) unrealized() decimal.Decimal {
+	total := decimal.Zero
+	for _, p := range k.positions {
+		if p.qty.IsZero() || k.prices == nil {
+			continue
+		}
+		mark, ok := k.prices.LastPrice(p.symbol)
+		if !ok {
+			continue
+		}
+		total = total.Add(mark.Sub(p.cost).Mul(p.qty))
+	}
+	return total
+}
+
+// pnl is the day's PnL. Callers must hold k.mt.
+func (k *KillSwitch) pnl() decimal.Decimal {
+	return k.realized.Add(k.unrealized()).Sub(k.baseline)
+}
+
+// evaluate trips the switch if the day's loss is over the limit
+func (k *KillSwitch) evaluate(now time.Time) {
+	k.mt.Lock()
+	k.rollover(now)
+	limit := k.cfg.DailyLossLimit
+	if k.tripped || !limit.IsPositive() {
+		k.mt.Unlock()
+		return
+	}
+	pnl := k.pnl()
+	if pnl.GreaterThan(limit.Neg()) {
+		k.mt.Unlock()
+		return
+	}
+	k.tripped = true
+	k.trippedAt = k.clock.Now()
+	k.reason = fmt.Sprintf("daily PnL %s breached the loss limit of %s USD", pnl.StringFixed(2), limit)
+	reason, onTrip := k.reason, k.onTrip
+	k.mt.Unlock()
+
+	log.Printf("Kill switch tripped: %s", reason)
+	if onTrip != nil {
+		onTrip(reason)
+	}
+}
+
+// Tripped reports whether the kill switch is holding trading
+func (k *KillSwitch) Tripped() bool {
+	k.mt.Lock()
+	defer k.mt.Unlock()
+	return k.tripped
+}
+
+// Check rejects orders that would open or add to a position while tripped
+func (k *KillSwitch) Check(o Order) (Order, error) {
+	k.mt.Lock()
+	defer k.mt.Unlock()
+	if !k.tripped {
+		return o, nil
+	}
+	if p := k.positions[o.Strategy+"\x00"+o.Symbol]; p != nil && !p.qty.IsZero() {
+		next := p.qty.Add(signedQty(o.Side, o.Quantity))
+		if next.IsZero() || (next.Sign() == p.qty.Sign() && next.Abs().LessThan(p.qty.Abs())) {
+			return o, nil
+		}
+	}
+	return o, fmt.Errorf("%w: %s", ErrKillSwitch, k.reason)
+}
+
+// FlattenOrders returns the market orders that close every open position,
+// each attributed to the strategy holding it
+func (k *KillSwitch) FlattenOrders() []Order {
+	k.mt.Lock()
+	defer k.mt.Unlock()
+	var out []Order
+	for _, p := range k.positions {
+		if p.qty.IsZero() {
+			continue
+		}
+		side := SideSell
+		if p.qty.IsNegative() {
+			side = SideBuy
+		}
+		out = append(out, Order{Symbol: p.symbol, Side: side, Type: OrderMarket, Quantity: p.qty.Abs(), Strategy: p.strategy})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Strategy != out[j].Strategy {
+			return out[i].Strategy < out[j].Strategy
+		}
+		return out[i].Symbol < out[j].Symbol
+	})
+	return out
+}
+
+// Reset re-arms a tripped kill switch. The loss limit then applies to the
+// PnL made from this point on for the rest of the day.
+func (k *KillSwitch) Reset() {
+	k.mt.Lock()
+	defer k.mt.Unlock()
+	k.rollover(k.clock.Now())
+	k.tripped = false
+	k.trippedAt = time.Time{}
+	k.reason = ""
+	k.baseline = k.realized.Add(k.unrealized())
+	log.Println("Kill switch reset")
+}
+
+func (k *KillSwitch) Status() KillSwitchStatus {
+	k.mt.Lock()
+	defer k.mt.Unlock()
+	k.rollover(k.clock.Now())
+	unrealized := k.unrealized()
+	st := KillSwitchStatus{
+		Enabled:    k.cfg.DailyLossLimit.IsPositive(),
+		Tripped:    k.tripped,
+		Reason:     k.reason,
+		Day:        k.day.Format("2006-01-02"),
+		Realized:   k.realized,
+		Unrealized: unrealized,
+		PnL:        k.realized.Add(unrealized).Sub(k.baseline),
+		LossLimit:  k.cfg.DailyLossLimit,
+		Flatten:    k.cfg.Flatten,
+	}
+	if k.tripped {
+		at := k.trippedAt
+		st.TrippedAt = &at
+	}
+	return st
+}
@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// SubjectLiquidation is the notification subject of a position whose mark
+// price nears its liquidation price
+const SubjectLiquidation = "Position near liquidation"
+
+// liquidationRefresh is how often the watched position is read again,
+// fills of its symbol read it at once
+const liquidationRefresh = time.Minute
+
+// MarkPrice is the price a derivatives exchange values positions and
+// liquidates them at
+type MarkPrice struct {
+	Symbol      string
+	Price       decimal.Decimal
+	IndexPrice  decimal.Decimal
+	FundingRate decimal.Decimal
+	NextFunding time.Time
+	Time        time.Time
+}
+
+// MarkPriceStreamer is implemented by derivatives exchange adapters that
+// stream mark prices
+type MarkPriceStreamer interface {
+	SubscribeMarkPrice(ctx context.Context, symbol string) (<-chan MarkPrice, error)
+}
+
+// LiquidationDistance is how far mark is from the liquidation price of p,
+// as a fraction of mark. It reports false for flat positions and those
+// without a liquidation price.
+func (p Position) LiquidationDistance(mark decimal.Decimal) (decimal.Decimal, bool) {
+	if p.Quantity.IsZero() || !p.LiquidationPrice.IsPositive() || !mark.IsPositive() {
+		return decimal.Zero, false
+	}
+	return mark.Sub(p.LiquidationPrice).Abs().Div(mark), true
+}
+
+// SetLiquidationBuffer warns when the mark price of a derivatives position
+// comes within buffer, a fraction of the mark, of its liquidation price.
+// Zero turns the warning off. It applies from the next Start.
+func (e *Engine) SetLiquidationBuffer(buffer decimal.Decimal) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.liqBuffer = buffer
+}
+
+// watchLiquidationOf starts watching the liquidation price of symbol for
+// the run, unless it already is. Callers must hold e.lock.
+func (e *Engine) watchLiquidationOf(symbol string) {
+	m, ok := e.exchange.(MarkPriceStreamer)
+	if !ok || !e.liqBuffer.IsPositive() || e.liqWatched[symbol] {
+		return
+	}
+	e.liqWatched[symbol] = true
+	go e.watchLiquidation(e.ctx, m, symbol, e.liqBuffer)
+}
+
+// watchLiquidation follows the mark price of symbol until ctx ends, warning
+// each time the position in it comes within buffer of liquidation
+func (e *Engine) watchLiquidation(ctx context.Context, m MarkPriceStreamer, symbol string, buffer decimal.Decimal) {
+	marks, err := m.SubscribeMarkPrice(ctx, symbol)
+	if err != nil {
+		log.Printf("no %s mark prices, its liquidation price is not watched: %v", symbol, err)
+		return
+	}
+	x := e.ExchangeAdapter()
+	filled := make(chan struct{}, 1)
+	unsubscribe := e.events.Subscribe(EventOrderFilled, func(ev Event) {
+		if ev.Order.Symbol == symbol {
+			select {
+			case filled <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer unsubscribe()
+	t := e.clock.NewTicker(liquidationRefresh)
+	defer t.Stop()
+
+	pos, err := x.GetPosition(ctx, symbol)
+	if err != nil {
+		log.Printf("%s position: %v", symbol, err)
+	}
+	near := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-filled:
+		case <-t.C():
+		case mark, ok := <-marks:
+			if !ok {
+				return
+			}
+			d, ok := pos.LiquidationDistance(mark.Price)
+			was := near
+			near = ok && d.LessThan(buffer)
+			if near && !was {
+				msg := fmt.Sprintf("%s %s position is %s%% from liquidation: mark %s, liquidation %s", symbol, pos.Quantity, d.Mul(decimal.NewFromInt(100)).StringFixed(1), mark.Price, pos.LiquidationPrice)
+				log.Printf("WARNING: %s", msg)
+				e.notify(ctx, SubjectLiquidation, msg)
+			}
+			continue
+		}
+		if p, err := x.GetPosition(ctx, symbol); err != nil {
+			log.Printf("%s position: %v", symbol, err)
+		} else {
+			pos = p
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrMarketClosed rejects orders on a symbol outside the sessions of its market
+var ErrMarketClosed = errors.New("market closed")
+
+// marketLookahead is how far ahead sessions are read from the calendar, a
+// long weekend and a holiday still leave the next open in range
+const marketLookahead = 14 * 24 * time.Hour
+
+// MarketHoursConfig picks the symbols held to the sessions of their market
+// and what happens to their orders outside them
+type MarketHoursConfig struct {
+	// Symbols trade in market hours only, empty for every symbol but
+	// crypto pairs, which are written with a slash as in BTC/USD
+	Symbols []string `json:"symbols,omitempty"`
+	// QueueForOpen holds orders submitted outside a session and places them
+	// at the next open instead of rejecting them
+	QueueForOpen bool `json:"queue_for_open"`
+}
+
+// MarketHours knows when the market of equity symbols is open, from the
+// sessions of a calendar read two weeks ahead at a time
+type MarketHours struct {
+	mt       sync.Mutex
+	cal      MarketCalendar
+	cfg      MarketHoursConfig
+	sessions []MarketSession
+	from     time.Time // sessions are known from here
+}
+
+func NewMarketHours(cal MarketCalendar, cfg MarketHoursConfig) *MarketHours {
+	return &MarketHours{cal: cal, cfg: cfg}
+}
+
+// Config returns the settings of m
+func (m *MarketHours) Config() MarketHoursConfig {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	return m.cfg
+}
+
+// Applies reports whether orders on symbol are held to market hours
+func (m *MarketHours) Applies(symbol string) bool {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	if len(m.cfg.Symbols) == 0 {
+		return !strings.Contains(symbol, "/")
+	}
+	return slices.ContainsFunc(m.cfg.Symbols, func(s string) bool { return strings.EqualFold(s, symbol) })
+}
+
+// Session returns the session in progress at t or else the next one, and
+// whether the market is open at t
+func (m *MarketHours) Session(ctx context.Context, t time.Time) (MarketSession, bool, error) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	if !t.Before(m.from) {
+		if s, ok := nextSession(m.sessions, t); ok {
+			return s, !t.Before(s.Open), nil
+		}
+	}
+	// read from the day before t, a session that began on the previous
+	// date where the market is may still be open
+	from := t.Add(-24 * time.Hour)
+	sessions, err := m.cal.Sessions(ctx, from, t.Add(marketLookahead))
+	if err != nil {
+		return MarketSession{}, false, fmt.Errorf("market calendar: %w", err)
+	}
+	m.sessions, m.from = sessions, from
+	if s, ok := nextSession(sessions, t); ok {
+		return s, !t.Before(s.Open), nil
+	}
+	return MarketSession{}, false, fmt.Errorf("no market session in the %s after %s", marketLookahead, t.UTC().Format(time.RFC3339))
+}
+
+// nextSession is the first of sessions still to close at t
+func nextSession(sessions []MarketSession, t time.Time) (MarketSession, bool) {
+	for _, s := range sessions {
+		if t.Before(s.Close) {
+			return s, true
+		}
+	}
+	return MarketSession{}, false
+}
+
+// SetMarketHours holds orders on the symbols h applies to to the sessions
+// of their market, rejecting or queueing those submitted outside them. Set
+// the order manager first.
+func (e *Engine) SetMarketHours(h *MarketHours) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.hours = h
+	if s, ok := e.om.(interface{ SetMarketHours(*MarketHours) }); ok {
+		s.SetMarketHours(h)
+	}
+}
+
+// MarketHours returns the market hours orders are held to, nil when they are not
+func (e *Engine) MarketHours() *MarketHours {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.hours
+}
+
+// marketOpen checks the market of symbol is open at now, returning the next
+// open when it is not. Orders go through when the calendar cannot be read,
+// the exchange rejects them if the market is closed after all.
+func marketOpen(ctx context.Context, h *MarketHours, symbol string, now time.Time) (time.Time, error) {
+	if h == nil || !h.Applies(symbol) {
+		return time.Time{}, nil
+	}
+	s, open, err := h.Session(ctx, now)
+	if err != nil {
+		log.Printf("market hours of %s unknown, order not held: %v", symbol, err)
+		return time.Time{}, nil
+	}
+	if open {
+		return time.Time{}, nil
+	}
+	return s.Open, fmt.Errorf("%s: %w until %s", symbol, ErrMarketClosed, s.Open.UTC().Format(time.RFC3339))
+}
+
+// SetMarketHours holds orders to the sessions of h, nil trades around the clock
+func (om *OrderManager) SetMarketHours(h *MarketHours) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.hours = h
+}
+
+// heldQueued is the kind queued orders are stored under
+const heldQueued = "queued"
+
+// queuedOrder is an order submitted while its market was closed, placed at
+// the open
+type queuedOrder struct {
+	Order Order     `json:"order"`
+	At    time.Time `json:"at"`
+}
+
+// queueForOpen holds o until open, returning it QUEUED. The queue is
+// stored, an order that cannot be is rejected rather than held by a run
+// that may not live to the open. A tripped kill switch rejects orders
+// that would add risk before they are queued.
+func (om *OrderManager) queueForOpen(o Order, open time.Time) (Order, error) {
+	if o.ClientOrderID == "" {
+		o.ClientOrderID = newClientOrderID()
+	}
+	o.Status = OrderStatusQueued
+	om.mt.Lock()
+	checks := om.checks
+	for _, q := range om.queued {
+		if q.Order.ClientOrderID == o.ClientOrderID {
+			om.mt.Unlock()
+			return q.Order, nil
+		}
+	}
+	om.mt.Unlock()
+	for _, c := range checks {
+		if k, ok := c.(*KillSwitch); ok {
+			if _, err := k.Check(o); err != nil {
+				return Order{}, err
+			}
+		}
+	}
+	q := queuedOrder{Order: o, At: open}
+	if err := om.saveQueued(q); err != nil {
+		return Order{}, fmt.Errorf("%s: %w until %s, and the order could not be queued: %v", o.Symbol, ErrMarketClosed, open.UTC().Format(time.RFC3339), err)
+	}
+	om.mt.Lock()
+	om.queued = append(om.queued, q)
+	om.mt.Unlock()
+	log.Printf("%s %s %s %s queued for the market open at %s", o.Strategy, o.Side, o.Quantity, o.Symbol, open.UTC().Format(time.RFC3339))
+	return o, nil
+}
+
+// saveQueued stores q so a restart keeps it, without a store only a run
+// with no store to lose anyway holds it
+func (om *OrderManager) saveQueued(q queuedOrder) error {
+	if om.db == nil {
+		return nil
+	}
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	return om.db.SaveHeldOrder(heldQueued, q.Order.ClientOrderID, data, om.currentClock().Now())
+}
+
+// unqueue forgets the stored queued orders
+func (om *OrderManager) unqueue(orders []Order) {
+	if om.db == nil {
+		return
+	}
+	for _, o := range orders {
+		if err := om.db.DeleteHeldOrder(heldQueued, o.ClientOrderID); err != nil {
+			log.Printf("failed to forget queued order %s: %v", o.ClientOrderID, err)
+		}
+	}
+}
+
+// loadQueued restores the queue an earlier run stored
+func (om *OrderManager) loadQueued() {
+	held, err := om.db.LoadHeldOrders(heldQueued)
+	if err != nil {
+		log.Printf("failed to load orders queued for the market open: %v", err)
+		return
+	}
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	for _, h := range held {
+		var q queuedOrder
+		if err := json.Unmarshal(h.Payload, &q); err != nil {
+			log.Printf("queued order %s unreadable, dropped: %v", h.ID, err)
+			continue
+		}
+		om.queued = append(om.queued, q)
+	}
+	if len(om.queued) > 0 {
+		log.Printf("Restored %d orders queued for the market open", len(om.queued))
+	}
+}
+
+// QueuedOrders returns the orders waiting for their market to open
+func (om *OrderManager) QueuedOrders() []Order {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	out := make([]Order, 0, len(om.queued))
+	for _, q := range om.queued {
+		out = append(out, q.Order)
+	}
+	return out
+}
+
+// CancelQueued takes the order with client order id clientID off the
+// queue, returning it CANCELED, or false when no queued order has that id
+func (om *OrderManager) CancelQueued(clientID string) (Order, bool) {
+	om.mt.Lock()
+	var canceled []Order
+	om.queued = slices.DeleteFunc(om.queued, func(q queuedOrder) bool {
+		if q.Order.ClientOrderID != clientID {
+			return false
+		}
+		canceled = append(canceled, q.Order)
+		return true
+	})
+	om.mt.Unlock()
+	if len(canceled) == 0 {
+		return Order{}, false
+	}
+	om.unqueue(canceled)
+	o := canceled[0]
+	o.Status = OrderStatusCanceled
+	log.Printf("%s %s %s %s queued for the market open canceled", o.Strategy, o.Side, o.Quantity, o.Symbol)
+	return o, true
+}
+
+// DropQueued empties the queue, as when the kill switch trips, returning
+// the orders dropped
+func (om *OrderManager) DropQueued() []Order {
+	om.mt.Lock()
+	dropped := make([]Order, 0, len(om.queued))
+	for _, q := range om.queued {
+		dropped = append(dropped, q.Order)
+	}
+	om.queued = nil
+	om.mt.Unlock()
+	om.unqueue(dropped)
+	return dropped
+}
+
+// releaseQueued places the queued orders whose market has opened by now.
+// Market orders are priced afresh, at the last price when placed. The
+// pre-trade checks run when each is placed, so a tripped kill switch
+// rejects those that would add risk.
+func (om *OrderManager) releaseQueued(ctx context.Context, now time.Time) {
+	om.mt.Lock()
+	var due []Order
+	om.queued = slices.DeleteFunc(om.queued, func(q queuedOrder) bool {
+		if now.Before(q.At) {
+			return false
+		}
+		due = append(due, q.Order)
+		return true
+	})
+	om.mt.Unlock()
+	if len(due) == 0 {
+		return
+	}
+	om.unqueue(due)
+	go func() {
+		for _, o := range due {
+			o.Status = ""
+			if o.Type == OrderMarket {
+				o.Price = decimal.Zero
+			}
+			if _, err := om.Submit(ctx, o); err != nil {
+				log.Printf("%s %s %s %s queued for the open not placed: %v", o.Strategy, o.Side, o.Quantity, o.Symbol, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"context"
+	"sync"
+)
+
+// feedKey identifies one upstream candle subscription
+type feedKey struct {
+	symbol   string
+	interval int64
+}
+
+// feedGroup is one upstream subscription shared by the strategies on its
+// (symbol, interval). Strategies join and leave while it runs.
+type feedGroup struct {
+	key    feedKey
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mt     sync.Mutex
+	subs   []*feedSub
+	closed bool // upstream ended, new strategies need a new group
+}
+
+// feedSub is one strategy's place in a feed group
+type feedSub struct {
+	strategy Strategy
+	key      feedKey
+	feed     *candleFeed
+	ch       chan Candle
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{} // closed once the strategy stopped receiving candles
+	legs     []*feedSub    // the feeds of the other symbols of a MultiSymbolStrategy
+}
+
+// wait blocks until the strategy stopped receiving candles of every symbol
+func (s *feedSub) wait() {
+	<-s.done
+	for _, leg := range s.legs {
+		<-leg.done
+	}
+}
+
+func newFeedGroup(ctx context.Context, key feedKey) *feedGroup {
+	g := &feedGroup{key: key}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	return g
+}
+
+// join adds a subscriber, false when the upstream already ended
+func (g *feedGroup) join(s *feedSub) bool {
+	g.mt.Lock()
+	defer g.mt.Unlock()
+	if g.closed {
+		return false
+	}
+	g.subs = append(g.subs, s)
+	return true
+}
+
+// leave removes a subscriber and reports how many are left
+func (g *feedGroup) leave(s *feedSub) int {
+	g.mt.Lock()
+	defer g.mt.Unlock()
+	for i, x := range g.subs {
+		if x == s {
+			g.subs = append(g.subs[:i], g.subs[i+1:]...)
+			break
+		}
+	}
+	return len(g.subs)
+}
+
+func (g *feedGroup) subscribers() []*feedSub {
+	g.mt.Lock()
+	defer g.mt.Unlock()
+	return append([]*feedSub(nil), g.subs...)
+}
+
+// fanOut copies every candle from the upstream subscription to each
+// subscriber. Each subscriber reads through its own candleFeed, so a drop or
+// conflate policy on one strategy never holds the others back; a block policy
+// pauses the shared upstream, just like it did with one subscription each.
+func (g *feedGroup) fanOut(in <-chan Candle, onCandle func(Candle)) {
+	defer func() {
+		g.mt.Lock()
+		defer g.mt.Unlock()
+		g.closed = true
+		for _, s := range g.subs {
+			close(s.ch)
+		}
+	}()
+	for {
+		select {
+		case c, ok := <-in:
+			if !ok {
+				return
+			}
+			onCandle(c)
+			for _, s := range g.subscribers() {
+				select {
+				case s.ch <- c:
+				case <-s.ctx.Done():
+					// removed while the candle was on its way
+				case <-g.ctx.Done():
+					return
+				}
+			}
+		case <-g.ctx.Done():
+			return
+		}
+	}
+}
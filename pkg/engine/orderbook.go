@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoOrderBook is returned by exchange adapters that cannot stream order books
+var ErrNoOrderBook = errors.New("order book stream not supported")
+
+// BookLevel is the size resting at one price of an order book
+type BookLevel struct {
+	Price float64 `json:"price"`
+	Size  float64 `json:"size"`
+}
+
+// OrderBook is the top of a symbol's book, best prices first on both sides
+type OrderBook struct {
+	Symbol string      `json:"symbol"`
+	Bids   []BookLevel `json:"bids"`
+	Asks   []BookLevel `json:"asks"`
+	Time   time.Time   `json:"time"`
+}
+
+// Mid is halfway between the best bid and ask, zero when a side is empty
+func (b OrderBook) Mid() float64 {
+	if len(b.Bids) == 0 || len(b.Asks) == 0 {
+		return 0
+	}
+	return (b.Bids[0].Price + b.Asks[0].Price) / 2
+}
+
+// Spread is the best ask less the best bid, zero when a side is empty
+func (b OrderBook) Spread() float64 {
+	if len(b.Bids) == 0 || len(b.Asks) == 0 {
+		return 0
+	}
+	return b.Asks[0].Price - b.Bids[0].Price
+}
+
+// BookStrategy is implemented by strategies that read the order book of
+// their symbol, BookDepth levels a side. OnOrderBook is called from the
+// same goroutine as OnCandle.
+type BookStrategy interface {
+	Strategy
+	BookDepth() int
+	OnOrderBook(b OrderBook)
+}
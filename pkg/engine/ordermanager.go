@@ -3,73 +3,442 @@ package engine
 import (
 	"context"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
 	"github.com/omept/trading-engine/pkg/store"
+	"github.com/omept/trading-engine/pkg/telemetry"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type OrderManager struct {
 	exchange ExchangeAdapter
 	mt       sync.Mutex
-	pending  map[string]string
-	db       *store.SQLiteStore
+	db       store.Store
+	recorder *Recorder
+	prices   PriceSource
+	events   *EventBus
+	checks   []OrderCheck
+
+	open      map[string]Order             // orders tracked until they reach a final status
+	spans     map[string]trace.SpanContext // submit spans of tracked orders, their fills join the trace
+	pollEvery time.Duration
+	polledAt  time.Time
+	streaming bool                   // the exchange pushes order changes, polling is a safety net
+	early     map[string]earlyUpdate // pushed changes of orders not tracked yet, by ID
+	updateMt  sync.Mutex             // held while a polled or pushed order change is applied
+	symbols   map[string]SymbolInfo  // trading rules of the exchange by symbol
+
+	idem       map[string]idempotent // by client order id
+	idemOrders map[string]string     // client order id by order ID
+	idemTTL    time.Duration
+	idemSwept  time.Time
+
+	algo         AlgoConfig
+	algos        map[string]*AlgoOrder      // parent orders by ID
+	algoChildren map[string]string          // parent order ID by client order id of its working children
+	algoDirty    []AlgoOrder                // parent orders changed since they were last stored
+	maxSize      map[string]decimal.Decimal // max quantity of a single order by symbol
+
+	brackets    map[string]*bracketOrder // by client order id of the entry
+	bracketLegs map[string]string        // client order id of the entry by ID of its native legs
+	positions   PositionReader           // sizes emulated bracket exits
+
+	hours  *MarketHours
+	queued []queuedOrder // orders waiting for their market to open
+
+	breakers   map[string]*CircuitBreaker // by adapter name
+	breakerCfg BreakerConfig
+	onBreaker  func(BreakerStatus)
+
+	clock Clock
+}
+
+func NewOrderManager(ex ExchangeAdapter, db store.Store) OrderExecutor {
+	om := &OrderManager{
+		exchange:     ex,
+		db:           db,
+		open:         make(map[string]Order),
+		spans:        make(map[string]trace.SpanContext),
+		early:        make(map[string]earlyUpdate),
+		symbols:      make(map[string]SymbolInfo),
+		pollEvery:    2 * time.Second,
+		idem:         make(map[string]idempotent),
+		idemOrders:   make(map[string]string),
+		idemTTL:      defaultIdempotencyTTL,
+		algos:        make(map[string]*AlgoOrder),
+		algoChildren: make(map[string]string),
+		maxSize:      make(map[string]decimal.Decimal),
+		brackets:     make(map[string]*bracketOrder),
+		bracketLegs:  make(map[string]string),
+		breakers:     make(map[string]*CircuitBreaker),
+		clock:        RealClock,
+	}
+	if db != nil {
+		om.loadIdempotency()
+		om.loadQueued()
+		om.loadBrackets()
+	}
+	return om
+}
+
+// SetRecorder records accepted orders into the current session
+func (om *OrderManager) SetRecorder(r *Recorder) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.recorder = r
+}
+
+// SetPriceSource sets where market orders get their expected price from
+func (om *OrderManager) SetPriceSource(p PriceSource) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.prices = p
+}
+
+// SetEventBus publishes fills on bus
+func (om *OrderManager) SetEventBus(bus *EventBus) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.events = bus
+}
+
+// SetExchange points the order manager at a new exchange adapter.
+// Orders tracked on the old adapter are no longer polled.
+func (om *OrderManager) SetExchange(ex ExchangeAdapter) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.exchange = ex
+	om.symbols = make(map[string]SymbolInfo)
+	if len(om.open) > 0 {
+		log.Printf("Stopped tracking %d open orders of the previous exchange", len(om.open))
+		om.open = make(map[string]Order)
+		om.spans = make(map[string]trace.SpanContext)
+	}
+}
+
+// CanShort reports whether the exchange orders are placed on can sell
+// symbol short
+func (om *OrderManager) CanShort(symbol string) bool {
+	s, ok := om.currentExchange().(ShortSeller)
+	return ok && s.CanShort(symbol)
+}
+
+// OrderCheck vets an order before it is placed. It returns the order to
+// place, possibly with a smaller quantity, or an error to reject it.
+type OrderCheck interface {
+	Check(o Order) (Order, error)
+}
+
+// AddOrderCheck runs c on every order before placing it, after the checks added before
+func (om *OrderManager) AddOrderCheck(c OrderCheck) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.checks = append(om.checks, c)
+}
+
+func (om *OrderManager) currentExchange() ExchangeAdapter {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	return om.exchange
 }
 
-func NewOrderManager(ex ExchangeAdapter, db *store.SQLiteStore) OrderExecutor {
-	return &OrderManager{exchange: ex, pending: make(map[string]string), db: db}
+// SetClock sets the clock order retries wait on and client order ids
+// expire by
+func (om *OrderManager) SetClock(c Clock) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.clock = c
+}
+
+func (om *OrderManager) currentClock() Clock {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	return om.clock
 }
 
 func (om *OrderManager) Submit(ctx context.Context, o Order) (Order, error) {
-	key := fmt.Sprintf("%s:%s:%f:%s", o.Symbol, o.Side, o.Quantity, o.Type)
+	ctx, span := telemetry.Tracer().Start(ctx, "ordermanager.submit",
+		trace.WithAttributes(
+			attribute.String("symbol", o.Symbol),
+			attribute.String("side", string(o.Side)),
+			attribute.String("type", string(o.Type)),
+			attribute.String("quantity", o.Quantity.String()),
+		))
+	defer span.End()
+	o.TraceID = telemetry.TraceID(ctx)
+
+	// equities trade in the sessions of their market, outside them orders
+	// are rejected or wait for the open
 	om.mt.Lock()
-	if id, ok := om.pending[key]; ok {
+	hours := om.hours
+	om.mt.Unlock()
+	if open, err := marketOpen(ctx, hours, o.Symbol, om.currentClock().Now()); err != nil {
+		if hours.Config().QueueForOpen {
+			span.SetAttributes(attribute.Bool("queued", true))
+			return om.queueForOpen(o, open)
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return Order{}, err
+	}
+
+	// a bracket protects the fill of one entry, bracketed orders are placed whole
+	if max, ok := om.maxOrderSize(o.Symbol); ok && o.Bracket == nil && o.Quantity.GreaterThan(max) {
+		return om.startSplit(ctx, o, max)
+	}
+
+	// a client order id that already placed an order gets that order back
+	if o.ClientOrderID == "" {
+		o.ClientOrderID = newClientOrderID()
+	}
+	span.SetAttributes(attribute.String("client_order_id", o.ClientOrderID))
+	id, err := om.reserve(o.ClientOrderID)
+	if err != nil {
+		span.RecordError(err)
+		return Order{}, err
+	}
+	if id != "" {
+		span.SetAttributes(attribute.Bool("deduplicated", true))
+		om.mt.Lock()
+		r, ok := om.open[id]
 		om.mt.Unlock()
-		return Order{ID: id}, nil
+		if !ok {
+			r = Order{ID: id, ClientOrderID: o.ClientOrderID, TraceID: o.TraceID}
+		}
+		return r, nil
+	}
+
+	// market orders carry the expected price so fills and PnL are not booked at 0
+	if o.Type == OrderMarket && !o.Price.IsPositive() {
+		om.mt.Lock()
+		prices := om.prices
+		om.mt.Unlock()
+		if prices == nil {
+			om.release(o.ClientOrderID)
+			return Order{}, fmt.Errorf("no price source to price %s market order", o.Symbol)
+		}
+		price, ok := prices.LastPrice(o.Symbol)
+		if !ok {
+			om.release(o.ClientOrderID)
+			return Order{}, fmt.Errorf("no last price for %s market order", o.Symbol)
+		}
+		o.Price = price
+		span.SetAttributes(attribute.String("expected_price", price.String()))
+	}
+	o, err = withTimeInForce(o, om.currentClock().Now())
+	if err != nil {
+		om.release(o.ClientOrderID)
+		return Order{}, err
 	}
+	if o.Bracket != nil {
+		if err := o.Bracket.validate(o.Side, o.Price); err != nil {
+			om.release(o.ClientOrderID)
+			return Order{}, err
+		}
+	}
+
+	// nothing is sent while the exchange is unreachable
+	breaker := om.breaker()
+	if err := breaker.allow(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		om.reject(o)
+		return Order{}, err
+	}
+
+	om.mt.Lock()
+	checks := om.checks
 	om.mt.Unlock()
+	for _, c := range checks {
+		checked, err := c.Check(o)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			om.reject(o)
+			return Order{}, err
+		}
+		if !checked.Quantity.Equal(o.Quantity) {
+			log.Printf("%s %s %s scaled down from %s to %s by pre-trade checks", o.Strategy, o.Side, o.Symbol, o.Quantity, checked.Quantity)
+			span.SetAttributes(attribute.String("scaled_quantity", checked.Quantity.String()))
+		}
+		o = checked
+	}
+
+	// exchanges reject quantities and prices off their step and tick sizes
+	if p, ok := om.currentExchange().(SymbolInfoProvider); ok {
+		info, err := om.symbolInfo(ctx, p, o.Symbol)
+		if err == nil {
+			o, err = info.Normalize(o)
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			om.reject(o)
+			return Order{}, err
+		}
+	}
 
+	om.bracketFor(o)
 	var lastErr error
-	wait := 100 * time.Millisecond
-	for i := 0; i < 5; i++ {
-		r, err := om.exchange.PlaceOrder(ctx, o)
+	for attempt := 1; attempt <= maxPlaceAttempts; attempt++ {
+		if attempt > 1 {
+			om.currentClock().Sleep(retryWait(100*time.Millisecond, attempt-1, lastErr))
+		}
+		r, err := om.placeOrder(ctx, o, attempt)
+		breaker.record(err)
 		if err == nil {
+			r.TraceID = o.TraceID
+			r.Strategy = o.Strategy
+			r.ClientOrderID = o.ClientOrderID
+			r.TimeInForce, r.ExpireAt = o.TimeInForce, o.ExpireAt
+			if r.Status == "" {
+				r.Status = OrderStatusNew
+				if r.Filled {
+					r.Status = OrderStatusFilled
+				}
+			}
+			if r.Filled && r.FilledQty.IsZero() {
+				r.FilledQty = r.Quantity
+			}
+			om.placed(o.ClientOrderID, r)
+			// the stream may have pushed a change before the exchange answered
+			defer om.applyEarly(r.ID)
 			om.mt.Lock()
-			om.pending[key] = r.ID
+			if !r.Status.Final() {
+				om.open[r.ID] = r
+				om.spans[r.ID] = span.SpanContext()
+			}
+			rec := om.recorder
+			bus := om.events
 			om.mt.Unlock()
-			if om.db != nil {
-				//persist order
-				err = om.db.SaveOrder(
-					r.ID,
-					r.Symbol,
-					string(r.Side),
-					string(r.Type),
-					r.Price,
-					r.FilledPrice,
-					r.Quantity,
-				)
-				if err != nil {
-					return r, err
-				}
-				// persist trade
-				tradeID := r.ID + "_trade"
-				err = om.db.SaveTrade(
-					tradeID,
-					r.ID,
-					r.Symbol,
-					string(r.Side),
-					r.FilledPrice,
-					r.Quantity,
-				)
-				if err != nil {
-					return r, err
-				}
+			if rec != nil {
+				rec.RecordOrder(r)
 			}
+			if bus != nil {
+				bus.Publish(Event{Type: EventOrderUpdated, Order: r})
+			}
+			om.mt.Lock()
+			parent := om.algoChildren[r.ClientOrderID]
+			om.mt.Unlock()
+			om.algoUpdate(Order{}, r)
+			om.bracketUpdate(ctx, Order{}, r)
+			if err := om.saveOrder(ctx, r, parent); err != nil {
+				span.RecordError(err)
+				return r, err
+			}
+			// persist the trade, resting orders have not traded yet
+			if err := om.recordFill(ctx, Order{}, r); err != nil {
+				span.RecordError(err)
+				return r, err
+			}
+			span.SetAttributes(attribute.String("order_id", r.ID))
 			return r, nil
 		}
 		lastErr = err
-		time.Sleep(wait)
-		wait *= 2
+		if !Retryable(err) || ctx.Err() != nil || breaker.allow() != nil {
+			break
+		}
 	}
+	span.RecordError(lastErr)
+	span.SetStatus(codes.Error, lastErr.Error())
+	om.reject(o)
 	return Order{}, lastErr
 }
+
+// saveOrder persists a placed order, the child of parent when set, inside
+// its own span
+func (om *OrderManager) saveOrder(ctx context.Context, r Order, parent string) error {
+	if om.db == nil {
+		return nil
+	}
+	_, span := telemetry.Tracer().Start(ctx, "store.save_order", trace.WithAttributes(attribute.String("order_id", r.ID)))
+	defer span.End()
+	err := om.db.SaveOrder(
+		r.ID,
+		r.Symbol,
+		string(r.Side),
+		string(r.Type),
+		r.Price.InexactFloat64(),
+		r.FilledPrice.InexactFloat64(),
+		r.Quantity.InexactFloat64(),
+		r.Filled,
+		r.TraceID,
+		r.Strategy,
+	)
+	if err == nil && r.Status == OrderStatusPartiallyFilled {
+		err = om.db.UpdateOrderFill(r.ID, string(r.Status), r.FilledQty.InexactFloat64(), r.FilledPrice.InexactFloat64())
+	}
+	if err == nil && parent != "" {
+		err = om.db.SetOrderParent(r.ID, parent)
+	}
+	if err == nil && (r.TimeInForce != "" || !r.ExpireAt.IsZero()) {
+		err = om.db.SetOrderExpiry(r.ID, string(r.TimeInForce), r.ExpireAt)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// symbolInfo returns the trading rules of symbol, asking p the first time
+func (om *OrderManager) symbolInfo(ctx context.Context, p SymbolInfoProvider, symbol string) (SymbolInfo, error) {
+	om.mt.Lock()
+	info, ok := om.symbols[symbol]
+	om.mt.Unlock()
+	if ok {
+		return info, nil
+	}
+	info, err := p.GetSymbolInfo(ctx, symbol)
+	if err != nil {
+		return info, fmt.Errorf("trading rules of %s: %w", symbol, err)
+	}
+	om.mt.Lock()
+	om.symbols[symbol] = info
+	om.mt.Unlock()
+	return info, nil
+}
+
+// reject tells the strategy that o was never placed
+func (om *OrderManager) reject(o Order) {
+	om.release(o.ClientOrderID)
+	om.dropBracket(o.ClientOrderID)
+	om.mt.Lock()
+	checks := om.checks
+	om.mt.Unlock()
+	// checks holding something for o give it back at once
+	for _, c := range checks {
+		if r, ok := c.(interface{ Release(Order) }); ok {
+			r.Release(o)
+		}
+	}
+	om.mt.Lock()
+	bus := om.events
+	om.mt.Unlock()
+	if bus != nil {
+		o.Status = OrderStatusRejected
+		bus.Publish(Event{Type: EventOrderUpdated, Order: o})
+	}
+}
+
+// placeOrder wraps a single exchange attempt in its own span
+func (om *OrderManager) placeOrder(ctx context.Context, o Order, attempt int) (Order, error) {
+	ex := om.currentExchange()
+	ctx, span := telemetry.Tracer().Start(ctx, "exchange.place_order",
+		trace.WithAttributes(
+			attribute.String("exchange", ex.AdapterName()),
+			attribute.Int("attempt", attempt),
+		))
+	defer span.End()
+	r, err := ex.PlaceOrder(ctx, o)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return r, err
+}
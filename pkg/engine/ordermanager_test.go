@@ -0,0 +1,417 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// testExchange fills market orders at their price when placed and rests
+// limit orders until they are canceled
+type testExchange struct {
+	mt        sync.Mutex
+	seq       int64
+	orders    map[string]Order
+	placed    []Order
+	positions map[string]Position
+}
+
+func newTestExchange() *testExchange {
+	return &testExchange{orders: map[string]Order{}, positions: map[string]Position{}}
+}
+
+func (x *testExchange) PlaceOrder(ctx context.Context, o Order) (Order, error) {
+	x.mt.Lock()
+	defer x.mt.Unlock()
+	x.seq++
+	o.ID = "test_" + strconv.FormatInt(x.seq, 10)
+	o.Status = OrderStatusNew
+	if o.Type == OrderMarket {
+		o.Status, o.Filled = OrderStatusFilled, true
+		o.FilledQty, o.FilledPrice = o.Quantity, o.Price
+	}
+	x.orders[o.ID] = o
+	x.placed = append(x.placed, o)
+	return o, nil
+}
+
+// placedOrders returns the orders placed so far, oldest first
+func (x *testExchange) placedOrders() []Order {
+	x.mt.Lock()
+	defer x.mt.Unlock()
+	return append([]Order(nil), x.placed...)
+}
+
+func (x *testExchange) GetOrder(ctx context.Context, symbol, orderID string) (Order, error) {
+	x.mt.Lock()
+	defer x.mt.Unlock()
+	o, ok := x.orders[orderID]
+	if !ok {
+		return Order{}, fmt.Errorf("order %s not found", orderID)
+	}
+	return o, nil
+}
+
+func (x *testExchange) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	x.mt.Lock()
+	defer x.mt.Unlock()
+	o, ok := x.orders[orderID]
+	if !ok {
+		return fmt.Errorf("order %s not found", orderID)
+	}
+	if !o.Status.Final() {
+		o.Status = OrderStatusCanceled
+		x.orders[orderID] = o
+	}
+	return nil
+}
+
+func (x *testExchange) CancelAllOrders(ctx context.Context, symbol string) error { return nil }
+
+func (x *testExchange) GetOpenOrders(ctx context.Context, symbol string) ([]Order, error) {
+	x.mt.Lock()
+	defer x.mt.Unlock()
+	var out []Order
+	for _, o := range x.orders {
+		if o.Symbol == symbol && !o.Status.Final() {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+func (x *testExchange) GetPosition(ctx context.Context, symbol string) (Position, error) {
+	x.mt.Lock()
+	defer x.mt.Unlock()
+	p := x.positions[symbol]
+	p.Symbol = symbol
+	return p, nil
+}
+
+func (x *testExchange) GetBalances(ctx context.Context) (map[string]decimal.Decimal, error) {
+	return map[string]decimal.Decimal{"USD": decimal.NewFromInt(10000)}, nil
+}
+
+func (x *testExchange) SubscribeCandles(ctx context.Context, symbol string, interval int64) (<-chan Candle, error) {
+	return nil, nil
+}
+
+func (x *testExchange) SubscribeTrades(ctx context.Context, symbol string) (<-chan Trade, error) {
+	return nil, ErrNoTradeStream
+}
+
+func (x *testExchange) SubscribeOrderBook(ctx context.Context, symbol string, depth int) (<-chan OrderBook, error) {
+	return nil, ErrNoOrderBook
+}
+
+func (x *testExchange) AdapterName() string { return "Test" }
+
+// waitFor fails t unless cond holds within a second, orders worked in the
+// background get there on their own goroutines
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// newTestOrderManager places orders on x on clock, market orders priced
+// at 100 for BTCUSD and 150 for AAPL
+func newTestOrderManager(x *testExchange, clock Clock) *OrderManager {
+	om := NewOrderManager(x, nil).(*OrderManager)
+	om.SetClock(clock)
+	prices := NewPriceBook()
+	prices.Update("BTCUSD", dec("100"), simStart)
+	prices.Update("AAPL", dec("150"), simStart)
+	om.SetPriceSource(prices)
+	return om
+}
+
+func dec(s string) decimal.Decimal { return decimal.RequireFromString(s) }
+
+func TestSubmitSplitsOrdersOverMaxSize(t *testing.T) {
+	x := newTestExchange()
+	om := newTestOrderManager(x, NewSimClock(simStart))
+	om.SetMaxOrderSize("BTCUSD", dec("1"))
+
+	parent, err := om.Submit(context.Background(), Order{Symbol: "BTCUSD", Side: SideBuy, Type: OrderMarket, Quantity: dec("2.5"), Price: dec("100")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the split to finish", func() bool {
+		algos := om.AlgoOrders()
+		return len(algos) == 1 && algos[0].Done
+	})
+
+	placed := x.placedOrders()
+	if len(placed) != 3 {
+		t.Fatalf("placed %d orders, want 3", len(placed))
+	}
+	for i, want := range []string{"1", "1", "0.5"} {
+		if !placed[i].Quantity.Equal(dec(want)) {
+			t.Errorf("child %d quantity %s, want %s", i+1, placed[i].Quantity, want)
+		}
+	}
+	a := om.AlgoOrders()[0]
+	if a.ID != parent.ID || a.Method != AlgoSplit {
+		t.Fatalf("parent %s %s, want %s %s", a.ID, a.Method, parent.ID, AlgoSplit)
+	}
+	if a.Status != OrderStatusFilled || !a.FilledQty.Equal(dec("2.5")) {
+		t.Fatalf("parent %s filled %s, want FILLED 2.5", a.Status, a.FilledQty)
+	}
+}
+
+func TestAlgoExecutorSlicesOverHorizon(t *testing.T) {
+	x := newTestExchange()
+	clock := NewSimClock(simStart)
+	om := newTestOrderManager(x, clock)
+	om.SetAlgo(AlgoConfig{Method: AlgoTWAP, Slices: 3, Horizon: 3 * time.Minute})
+
+	if _, err := om.AlgoExecutor().Submit(context.Background(), Order{Symbol: "BTCUSD", Side: SideSell, Type: OrderMarket, Quantity: dec("3"), Price: dec("100")}); err != nil {
+		t.Fatal(err)
+	}
+	for n := 1; n <= 3; n++ {
+		waitFor(t, fmt.Sprintf("slice %d", n), func() bool { return len(x.placedOrders()) == n })
+		// the next slice waits for the clock
+		time.Sleep(5 * time.Millisecond)
+		if got := len(x.placedOrders()); got != n {
+			t.Fatalf("%d slices placed before the clock reached slice %d", got, n+1)
+		}
+		clock.Advance(time.Minute)
+	}
+	waitFor(t, "the algo order to finish", func() bool {
+		algos := om.AlgoOrders()
+		return len(algos) == 1 && algos[0].Status == OrderStatusFilled
+	})
+	for i, o := range x.placedOrders() {
+		if !o.Quantity.Equal(dec("1")) || o.Side != SideSell {
+			t.Errorf("slice %d %s %s, want SELL 1", i+1, o.Side, o.Quantity)
+		}
+	}
+}
+
+// testPositions holds one quantity for every strategy and symbol
+type testPositions struct{ qty decimal.Decimal }
+
+func (p testPositions) Position(strategy, symbol string) StrategyPosition {
+	return StrategyPosition{Strategy: strategy, Symbol: symbol, Quantity: p.qty}
+}
+
+func TestEmulatedBracketExitsAtTakeProfit(t *testing.T) {
+	x := newTestExchange()
+	om := newTestOrderManager(x, NewSimClock(simStart))
+	om.SetPositionReader(testPositions{qty: dec("2")})
+	ctx := context.Background()
+
+	entry := Order{Symbol: "BTCUSD", Side: SideBuy, Type: OrderMarket, Quantity: dec("2"), Price: dec("100"), Strategy: "s",
+		Bracket: &OrderBracket{StopLoss: dec("90"), TakeProfit: dec("120")}}
+	if _, err := om.Submit(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if b := om.BracketOrders(); len(b) != 1 || !b[0].Armed || !b[0].Quantity.Equal(dec("2")) {
+		t.Fatalf("brackets %+v, want one armed for 2", b)
+	}
+
+	om.OnCandle(ctx, "BTCUSD", Candle{Time: simStart, Open: 100, High: 110, Low: 95, Close: 105})
+	time.Sleep(5 * time.Millisecond)
+	if n := len(x.placedOrders()); n != 1 {
+		t.Fatalf("%d orders placed by a candle between the legs", n-1)
+	}
+
+	om.OnCandle(ctx, "BTCUSD", Candle{Time: simStart.Add(time.Minute), Open: 105, High: 121, Low: 104, Close: 118})
+	waitFor(t, "the take-profit exit", func() bool { return len(x.placedOrders()) == 2 })
+	exit := x.placedOrders()[1]
+	if exit.Side != SideSell || exit.Type != OrderMarket || !exit.Quantity.Equal(dec("2")) {
+		t.Fatalf("exit %s %s %s, want market SELL 2", exit.Type, exit.Side, exit.Quantity)
+	}
+	waitFor(t, "the bracket to be dropped", func() bool { return len(om.BracketOrders()) == 0 })
+}
+
+func TestSubmitRejectsInvalidBracket(t *testing.T) {
+	om := newTestOrderManager(newTestExchange(), NewSimClock(simStart))
+	o := Order{Symbol: "BTCUSD", Side: SideBuy, Type: OrderMarket, Quantity: dec("1"), Price: dec("100"),
+		Bracket: &OrderBracket{StopLoss: dec("110")}}
+	if _, err := om.Submit(context.Background(), o); err == nil {
+		t.Fatal("stop-loss above a buy was accepted")
+	}
+	if b := om.BracketOrders(); len(b) != 0 {
+		t.Fatalf("rejected entry left brackets %+v", b)
+	}
+}
+
+func TestPushedUpdateBeforePlacementIsApplied(t *testing.T) {
+	x := newTestExchange()
+	om := newTestOrderManager(x, NewSimClock(simStart))
+	ctx := context.Background()
+
+	// the stream reports the fill before the exchange answers the placement
+	fill := Order{ID: "test_1", Status: OrderStatusFilled, FilledQty: dec("1"), FilledPrice: dec("90")}
+	om.applyAccountUpdate(ctx, AccountUpdate{Order: &fill})
+	if _, err := om.Submit(ctx, Order{Symbol: "BTCUSD", Side: SideBuy, Type: OrderLimit, Quantity: dec("1"), Price: dec("90")}); err != nil {
+		t.Fatal(err)
+	}
+	if open := om.OpenOrders(); len(open) != 0 {
+		t.Fatalf("tracking %v, want the order settled by the fill pushed before it was placed", open)
+	}
+}
+
+func TestExpiredOrdersAreCanceled(t *testing.T) {
+	x := newTestExchange()
+	clock := NewSimClock(simStart)
+	om := newTestOrderManager(x, clock)
+	ctx := context.Background()
+
+	if _, err := om.Submit(ctx, Order{Symbol: "BTCUSD", Side: SideBuy, Type: OrderLimit, Quantity: dec("1"), Price: dec("90"), ExpireAt: simStart}); err == nil {
+		t.Fatal("order expiring now was accepted")
+	}
+	r, err := om.Submit(ctx, Order{Symbol: "BTCUSD", Side: SideBuy, Type: OrderLimit, Quantity: dec("1"), Price: dec("90"), ExpireAt: simStart.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.TimeInForce != TimeInForceGTT {
+		t.Fatalf("time in force %q, want %s", r.TimeInForce, TimeInForceGTT)
+	}
+
+	clock.Advance(30 * time.Minute)
+	om.PollOrders(ctx)
+	if n := len(om.OpenOrders()); n != 1 {
+		t.Fatalf("%d orders open before the expiry, want 1", n)
+	}
+	clock.Advance(30 * time.Minute)
+	om.PollOrders(ctx)
+	if n := len(om.OpenOrders()); n != 0 {
+		t.Fatalf("%d orders open after the expiry, want 0", n)
+	}
+	if o, _ := x.GetOrder(ctx, "BTCUSD", r.ID); o.Status != OrderStatusCanceled {
+		t.Fatalf("order %s on the exchange, want canceled", o.Status)
+	}
+}
+
+// testCalendar has one session, from open to close
+type testCalendar struct{ open, close time.Time }
+
+func (c testCalendar) Sessions(ctx context.Context, from, to time.Time) ([]MarketSession, error) {
+	return []MarketSession{{Open: c.open, Close: c.close}}, nil
+}
+
+func TestMarketHoursRejectOrQueueOrders(t *testing.T) {
+	open := simStart.Add(time.Hour)
+	cal := testCalendar{open: open, close: open.Add(6 * time.Hour)}
+	o := Order{Symbol: "AAPL", Side: SideBuy, Type: OrderMarket, Quantity: dec("10"), Price: dec("150")}
+	ctx := context.Background()
+
+	x := newTestExchange()
+	clock := NewSimClock(simStart)
+	om := newTestOrderManager(x, clock)
+	om.SetMarketHours(NewMarketHours(cal, MarketHoursConfig{}))
+	if _, err := om.Submit(ctx, o); !errors.Is(err, ErrMarketClosed) {
+		t.Fatalf("submit before the open: %v, want %v", err, ErrMarketClosed)
+	}
+	if _, err := om.Submit(ctx, Order{Symbol: "BTC/USD", Side: SideBuy, Type: OrderMarket, Quantity: dec("1"), Price: dec("100")}); err != nil {
+		t.Fatalf("crypto pair held to market hours: %v", err)
+	}
+
+	om.SetMarketHours(NewMarketHours(cal, MarketHoursConfig{QueueForOpen: true}))
+	q, err := om.Submit(ctx, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Status != OrderStatusQueued || len(om.QueuedOrders()) != 1 {
+		t.Fatalf("order %s with %d queued, want QUEUED with 1", q.Status, len(om.QueuedOrders()))
+	}
+	clock.Set(open.Add(-time.Minute))
+	om.releaseQueued(ctx, clock.Now())
+	if n := len(om.QueuedOrders()); n != 1 {
+		t.Fatalf("%d orders queued before the open, want 1", n)
+	}
+	clock.Set(open)
+	om.releaseQueued(ctx, clock.Now())
+	waitFor(t, "the queued order to be placed", func() bool { return len(x.placedOrders()) == 2 })
+	if placed := x.placedOrders()[1]; placed.Symbol != "AAPL" || placed.ClientOrderID != q.ClientOrderID {
+		t.Fatalf("placed %s %s, want the queued AAPL order %s", placed.Symbol, placed.ClientOrderID, q.ClientOrderID)
+	}
+	if n := len(om.QueuedOrders()); n != 0 {
+		t.Fatalf("%d orders still queued after the open", n)
+	}
+}
+
+// testStrategy trades one symbol and does nothing
+type testStrategy struct {
+	name, symbol string
+}
+
+func (s *testStrategy) OnCandle(c Candle)               {}
+func (s *testStrategy) Symbol() string                  { return s.symbol }
+func (s *testStrategy) SetAccountUSD(v decimal.Decimal) {}
+func (s *testStrategy) AccountBalUSD() decimal.Decimal  { return decimal.Zero }
+func (s *testStrategy) OnStart()                        {}
+func (s *testStrategy) OnStop()                         {}
+func (s *testStrategy) Name() string                    { return s.name }
+func (s *testStrategy) Interval() int64                 { return DefaultCandleInterval }
+func (s *testStrategy) OnOrderUpdate(o Order)           {}
+
+func TestReconcileCorrectsOrdersAndPositions(t *testing.T) {
+	x := newTestExchange()
+	x.positions["BTCUSD"] = Position{Quantity: dec("2"), AvgPrice: dec("100")}
+	// canceled on the exchange while the engine still tracks it
+	gone := Order{ID: "gone", Symbol: "BTCUSD", Side: SideBuy, Type: OrderLimit, Quantity: dec("1"), Price: dec("90"), Status: OrderStatusNew}
+	x.orders[gone.ID] = Order{ID: gone.ID, Symbol: "BTCUSD", Status: OrderStatusCanceled}
+	// resting on the exchange and not tracked
+	x.orders["left"] = Order{ID: "left", Symbol: "BTCUSD", Side: SideSell, Type: OrderLimit, Quantity: dec("1"), Price: dec("130"), Status: OrderStatusNew}
+
+	om := newTestOrderManager(x, NewSimClock(simStart))
+	om.Adopt(gone)
+	e := NewEngine()
+	e.SetExchangeAdapter(x)
+	e.SetOrderManager(om)
+	if err := e.AddStrategy(&testStrategy{name: "s", symbol: "BTCUSD"}); err != nil {
+		t.Fatal(err)
+	}
+	e.SetReconciler(NewReconciler(ReconcileConfig{AutoCorrect: true}), 0)
+	ctx := context.Background()
+
+	rep, err := e.Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Discrepancies) != 0 {
+		t.Fatalf("first pass reported %v, differences have to show twice", rep.Discrepancies)
+	}
+	rep, err = e.Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Discrepancies) != 3 {
+		t.Fatalf("second pass reported %v, want the two orders and the position", rep.Discrepancies)
+	}
+	for _, d := range rep.Discrepancies {
+		if !d.Corrected {
+			t.Errorf("%s not corrected", d)
+		}
+	}
+
+	open := om.OpenOrders()
+	if len(open) != 1 || open[0].ID != "left" {
+		t.Fatalf("tracking %v, want only the order resting on the exchange", open)
+	}
+	if p := e.Positions().Position("s", "BTCUSD"); !p.Quantity.Equal(dec("2")) {
+		t.Fatalf("position %s, want the exchange's 2", p.Quantity)
+	}
+	rep, err = e.Reconcile(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Discrepancies) != 0 {
+		t.Fatalf("pass after the corrections reported %v", rep.Discrepancies)
+	}
+}
@@ -0,0 +1,292 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrExposureLimit is returned for orders that would exceed a portfolio limit
+var ErrExposureLimit = errors.New("exposure limit")
+
+// PortfolioLimits caps notional exposure in USD across all strategies.
+// Zero leaves a limit off.
+type PortfolioLimits struct {
+	MaxTotal     decimal.Decimal            `json:"max_total_usd"`
+	MaxPerSymbol decimal.Decimal            `json:"max_symbol_usd"`
+	Symbols      map[string]decimal.Decimal `json:"symbols,omitempty"` // per symbol caps over MaxPerSymbol
+	ScaleDown    bool                       `json:"scale_down"`        // shrink orders to fit instead of rejecting them
+}
+
+// symbolLimit is the cap of symbol, zero when there is none
+func (l PortfolioLimits) symbolLimit(symbol string) decimal.Decimal {
+	if v, ok := l.Symbols[symbol]; ok {
+		return v
+	}
+	return l.MaxPerSymbol
+}
+
+// Exposure is the notional a symbol adds to the portfolio
+type Exposure struct {
+	Symbol   string          `json:"symbol"`
+	Position decimal.Decimal `json:"position"`  // net filled quantity, negative when short
+	Open     decimal.Decimal `json:"open"`      // net quantity of resting orders
+	Notional decimal.Decimal `json:"notional"`  // |position + open| at the last price
+	Limit    decimal.Decimal `json:"limit_usd"` // zero when unlimited
+}
+
+// PortfolioRiskManager tracks filled positions and resting orders of every
+// strategy from the event bus and checks orders against portfolio limits
+// before they are placed. An order that passes reserves its exposure at
+// once, so orders checked before the events of the last one arrive see
+// it. Resting orders count as if they were filled.
+type PortfolioRiskManager struct {
+	mt        sync.Mutex
+	limits    PortfolioLimits
+	prices    PriceSource
+	positions map[string]decimal.Decimal // signed filled quantity per symbol
+	orders    map[string]*exposureOrder  // reserved and resting orders by client order id, else id
+}
+
+// exposureOrder is an order counted in the exposure of its symbol from its
+// check until every fill of it is in the positions
+type exposureOrder struct {
+	order  Order           // latest state, as checked until the exchange reports it
+	filled decimal.Decimal // fills already in the positions
+}
+
+// remaining is what o adds to its symbol beyond the positions
+func (o *exposureOrder) remaining() decimal.Decimal {
+	qty := o.order.Quantity
+	if o.order.Status.Final() {
+		// a done order adds the fills reported but not applied yet
+		qty = o.order.FilledQty
+	}
+	if r := qty.Sub(o.filled); r.IsPositive() {
+		return r
+	}
+	return decimal.Zero
+}
+
+func NewPortfolioRiskManager(limits PortfolioLimits) *PortfolioRiskManager {
+	return &PortfolioRiskManager{
+		limits:    limits,
+		positions: make(map[string]decimal.Decimal),
+		orders:    make(map[string]*exposureOrder),
+	}
+}
+
+// exposureKey is the key o is counted under, "" for an order the manager
+// cannot tell apart from others
+func exposureKey(o Order) string {
+	if o.ClientOrderID != "" {
+		return o.ClientOrderID
+	}
+	return o.ID
+}
+
+// SetPriceSource sets where exposure gets its mark prices from
+func (p *PortfolioRiskManager) SetPriceSource(ps PriceSource) {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	p.prices = ps
+}
+
+// SetLimits replaces the limits, orders already placed are not affected
+func (p *PortfolioRiskManager) SetLimits(l PortfolioLimits) {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	p.limits = l
+}
+
+func (p *PortfolioRiskManager) Limits() PortfolioLimits {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	return p.limits
+}
+
+// Track follows fills and order updates published on bus
+func (p *PortfolioRiskManager) Track(bus *EventBus) {
+	bus.Subscribe(EventOrderFilled, p.onFill)
+	bus.Subscribe(EventOrderUpdated, p.onUpdate)
+}
+
+func (p *PortfolioRiskManager) onFill(ev Event) {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	o := ev.Order
+	p.positions[o.Symbol] = p.positions[o.Symbol].Add(signedQty(o.Side, o.Quantity))
+	key := exposureKey(o)
+	if t, ok := p.orders[key]; ok {
+		t.filled = t.filled.Add(o.Quantity)
+		p.settle(key, t)
+	}
+}
+
+func (p *PortfolioRiskManager) onUpdate(ev Event) {
+	o := ev.Order
+	key := exposureKey(o)
+	if key == "" {
+		return
+	}
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	t, ok := p.orders[key]
+	if !ok {
+		if o.Status.Final() {
+			return
+		}
+		t = &exposureOrder{}
+		p.orders[key] = t
+	}
+	t.order = o
+	p.settle(key, t)
+}
+
+// Release gives back the exposure reserved for o, an order checked but
+// never placed
+func (p *PortfolioRiskManager) Release(o Order) {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	if t, ok := p.orders[exposureKey(o)]; ok && t.order.ID == "" {
+		delete(p.orders, exposureKey(o))
+	}
+}
+
+// settle stops counting t once it is done and its fills are all in the
+// positions. Callers must hold p.mt.
+func (p *PortfolioRiskManager) settle(key string, t *exposureOrder) {
+	if t.order.Status.Final() && !t.remaining().IsPositive() {
+		delete(p.orders, key)
+	}
+}
+
+func signedQty(side Side, qty decimal.Decimal) decimal.Decimal {
+	if side == SideSell {
+		return qty.Neg()
+	}
+	return qty
+}
+
+// netQty is the filled plus resting quantity of symbol. Callers must hold p.mt.
+func (p *PortfolioRiskManager) netQty(symbol string) (pos, open decimal.Decimal) {
+	pos = p.positions[symbol]
+	for _, t := range p.orders {
+		if t.order.Symbol == symbol {
+			open = open.Add(signedQty(t.order.Side, t.remaining()))
+		}
+	}
+	return pos, open
+}
+
+// markPrice is the last price of symbol, falling back to fallback. Callers must hold p.mt.
+func (p *PortfolioRiskManager) markPrice(symbol string, fallback decimal.Decimal) decimal.Decimal {
+	if p.prices != nil {
+		if price, ok := p.prices.LastPrice(symbol); ok {
+			return price
+		}
+	}
+	return fallback
+}
+
+// Exposures reports the exposure of every symbol with a position or resting order
+func (p *PortfolioRiskManager) Exposures() []Exposure {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	symbols := p.symbolsLocked()
+	out := make([]Exposure, 0, len(symbols))
+	for s := range symbols {
+		pos, open := p.netQty(s)
+		out = append(out, Exposure{
+			Symbol:   s,
+			Position: pos,
+			Open:     open,
+			Notional: pos.Add(open).Abs().Mul(p.markPrice(s, decimal.Zero)),
+			Limit:    p.limits.symbolLimit(s),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
+}
+
+// Check returns o if it fits the limits, o with a smaller quantity if it
+// does not but scaling down is on, or ErrExposureLimit. Orders that reduce
+// the exposure of their symbol always pass. The order returned is reserved
+// until its outcome arrives or Release. o.Price must be set.
+func (p *PortfolioRiskManager) Check(o Order) (Order, error) {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	o, err := p.check(o)
+	if key := exposureKey(o); err == nil && key != "" {
+		if _, ok := p.orders[key]; !ok {
+			p.orders[key] = &exposureOrder{order: o}
+		}
+	}
+	return o, err
+}
+
+// check is Check without the reservation. Callers must hold p.mt.
+func (p *PortfolioRiskManager) check(o Order) (Order, error) {
+	price := p.markPrice(o.Symbol, o.Price)
+	if !price.IsPositive() {
+		return o, nil
+	}
+
+	pos, open := p.netQty(o.Symbol)
+	cur := pos.Add(open).Abs()
+	next := pos.Add(open).Add(signedQty(o.Side, o.Quantity)).Abs()
+	if next.LessThanOrEqual(cur) {
+		return o, nil
+	}
+	// only the part of the order beyond the current exposure adds to it
+	added := next.Sub(cur)
+
+	allowed := added
+	limitHit := ""
+	if limit := p.limits.symbolLimit(o.Symbol); limit.IsPositive() {
+		room := limit.Sub(cur.Mul(price)).Div(price)
+		if room.LessThan(allowed) {
+			allowed, limitHit = room, fmt.Sprintf("%s limit %s USD", o.Symbol, limit)
+		}
+	}
+	if p.limits.MaxTotal.IsPositive() {
+		total := decimal.Zero
+		for s := range p.symbolsLocked() {
+			mark := price
+			if s != o.Symbol {
+				mark = p.markPrice(s, decimal.Zero)
+			}
+			sp, so := p.netQty(s)
+			total = total.Add(sp.Add(so).Abs().Mul(mark))
+		}
+		room := p.limits.MaxTotal.Sub(total).Div(price)
+		if room.LessThan(allowed) {
+			allowed, limitHit = room, fmt.Sprintf("total limit %s USD", p.limits.MaxTotal)
+		}
+	}
+	if limitHit == "" {
+		return o, nil
+	}
+
+	allowed = allowed.RoundFloor(8)
+	if !p.limits.ScaleDown || !allowed.IsPositive() {
+		return o, fmt.Errorf("%w: %s %s %s would exceed the %s", ErrExposureLimit, o.Side, o.Quantity, o.Symbol, limitHit)
+	}
+	o.Quantity = o.Quantity.Sub(added.Sub(allowed))
+	return o, nil
+}
+
+// symbolsLocked lists symbols with a position or resting order. Callers must hold p.mt.
+func (p *PortfolioRiskManager) symbolsLocked() map[string]bool {
+	out := map[string]bool{}
+	for s := range p.positions {
+		out[s] = true
+	}
+	for _, t := range p.orders {
+		out[t.order.Symbol] = true
+	}
+	return out
+}
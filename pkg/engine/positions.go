@@ -0,0 +1,215 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// StrategyPosition is what one strategy holds of a symbol and made on it
+type StrategyPosition struct {
+	Strategy   string          `json:"strategy"`
+	Symbol     string          `json:"symbol"`
+	Quantity   decimal.Decimal `json:"quantity"` // negative when short
+	AvgPrice   decimal.Decimal `json:"avg_price"`
+	Realized   decimal.Decimal `json:"realized"` // net of fees
+	Unrealized decimal.Decimal `json:"unrealized"`
+	Fees       decimal.Decimal `json:"fees"`
+	MarkPrice  decimal.Decimal `json:"mark_price"` // zero until the symbol has a price
+}
+
+// SymbolPnL sums the positions of every strategy in one symbol
+type SymbolPnL struct {
+	Symbol     string          `json:"symbol"`
+	Quantity   decimal.Decimal `json:"quantity"`
+	Realized   decimal.Decimal `json:"realized"`
+	Unrealized decimal.Decimal `json:"unrealized"`
+}
+
+// PositionReader reports a strategy's position in a symbol, zero when it holds none
+type PositionReader interface {
+	Position(strategy, symbol string) StrategyPosition
+}
+
+// PositionAware is implemented by strategies that read their own position.
+// The engine hands them its position manager when they are registered.
+type PositionAware interface {
+	SetPositionReader(r PositionReader)
+}
+
+// managedPosition is the running state behind a StrategyPosition
+type managedPosition struct {
+	avgPosition
+	realized decimal.Decimal
+	fees     decimal.Decimal
+}
+
+// PositionManager derives the position of every strategy in every symbol
+// from fills, with its average entry price and realized PnL. Unrealized PnL
+// is marked at the last price when read.
+type PositionManager struct {
+	mt        sync.Mutex
+	prices    PriceSource
+	positions map[string]*managedPosition // by strategy and symbol
+	keys      map[string][2]string        // strategy and symbol of each key
+}
+
+func NewPositionManager() *PositionManager {
+	return &PositionManager{positions: make(map[string]*managedPosition), keys: make(map[string][2]string)}
+}
+
+// SetPriceSource sets where open positions get their mark prices from
+func (pm *PositionManager) SetPriceSource(ps PriceSource) {
+	pm.mt.Lock()
+	defer pm.mt.Unlock()
+	pm.prices = ps
+}
+
+// Track follows fills published on bus
+func (pm *PositionManager) Track(bus *EventBus) {
+	bus.Subscribe(EventOrderFilled, pm.onFill)
+}
+
+func (pm *PositionManager) onFill(ev Event) {
+	o := ev.Order
+	price := o.FilledPrice
+	if !price.IsPositive() {
+		price = o.Price
+	}
+	pm.mt.Lock()
+	defer pm.mt.Unlock()
+	p := pm.get(o.Strategy, o.Symbol)
+	p.realized = p.realized.Add(p.apply(signedQty(o.Side, o.Quantity), price)).Sub(o.Fee)
+	p.fees = p.fees.Add(o.Fee)
+}
+
+// get returns the position of strategy in symbol, creating it. Callers must hold pm.mt.
+func (pm *PositionManager) get(strategy, symbol string) *managedPosition {
+	key := strategy + "\x00" + symbol
+	p := pm.positions[key]
+	if p == nil {
+		p = &managedPosition{}
+		pm.positions[key] = p
+		pm.keys[key] = [2]string{strategy, symbol}
+	}
+	return p
+}
+
+// view marks p to the last price of symbol. Callers must hold pm.mt.
+func (pm *PositionManager) view(strategy, symbol string, p *managedPosition) StrategyPosition {
+	sp := StrategyPosition{
+		Strategy: strategy,
+		Symbol:   symbol,
+		Quantity: p.qty,
+		AvgPrice: p.cost,
+		Realized: p.realized,
+		Fees:     p.fees,
+	}
+	if p.qty.IsZero() {
+		sp.AvgPrice = decimal.Zero
+	}
+	if pm.prices != nil {
+		if mark, ok := pm.prices.LastPrice(symbol); ok {
+			sp.MarkPrice = mark
+			if !p.qty.IsZero() {
+				sp.Unrealized = mark.Sub(p.cost).Mul(p.qty)
+			}
+		}
+	}
+	return sp
+}
+
+// Position implements PositionReader
+func (pm *PositionManager) Position(strategy, symbol string) StrategyPosition {
+	pm.mt.Lock()
+	defer pm.mt.Unlock()
+	p := pm.positions[strategy+"\x00"+symbol]
+	if p == nil {
+		return StrategyPosition{Strategy: strategy, Symbol: symbol}
+	}
+	return pm.view(strategy, symbol, p)
+}
+
+// Positions reports every strategy position that was ever filled, closed
+// ones included for their realized PnL
+func (pm *PositionManager) Positions() []StrategyPosition {
+	pm.mt.Lock()
+	defer pm.mt.Unlock()
+	out := make([]StrategyPosition, 0, len(pm.positions))
+	for key, p := range pm.positions {
+		k := pm.keys[key]
+		out = append(out, pm.view(k[0], k[1], p))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Strategy != out[j].Strategy {
+			return out[i].Strategy < out[j].Strategy
+		}
+		return out[i].Symbol < out[j].Symbol
+	})
+	return out
+}
+
+// Symbols sums the positions by symbol
+func (pm *PositionManager) Symbols() []SymbolPnL {
+	bySymbol := map[string]*SymbolPnL{}
+	out := []SymbolPnL{}
+	for _, p := range pm.Positions() {
+		s := bySymbol[p.Symbol]
+		if s == nil {
+			s = &SymbolPnL{Symbol: p.Symbol}
+			bySymbol[p.Symbol] = s
+		}
+		s.Quantity = s.Quantity.Add(p.Quantity)
+		s.Realized = s.Realized.Add(p.Realized)
+		s.Unrealized = s.Unrealized.Add(p.Unrealized)
+	}
+	for _, s := range bySymbol {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
+}
+
+// CloseOrders returns the market orders that bring every open position in
+// symbol back to flat, or in every symbol when symbol is empty. Each order is
+// attributed to the strategy holding the position.
+func (pm *PositionManager) CloseOrders(symbol string) []Order {
+	var out []Order
+	for _, p := range pm.Positions() {
+		if p.Quantity.IsZero() || symbol != "" && p.Symbol != symbol {
+			continue
+		}
+		side := SideSell
+		if p.Quantity.IsNegative() {
+			side = SideBuy
+		}
+		out = append(out, Order{Symbol: p.Symbol, Side: side, Type: OrderMarket, Quantity: p.Quantity.Abs(), Strategy: p.Strategy})
+	}
+	return out
+}
+
+// SetQuantity overrides what strategy holds of symbol to match the
+// exchange. A position that opens or flips takes avg as its entry price.
+func (pm *PositionManager) SetQuantity(strategy, symbol string, qty, avg decimal.Decimal) {
+	pm.mt.Lock()
+	defer pm.mt.Unlock()
+	p := pm.get(strategy, symbol)
+	if p.qty.Sign() != qty.Sign() {
+		p.cost = avg
+	}
+	p.qty = qty
+}
+
+// Restore replaces the tracked positions with those of a snapshot
+func (pm *PositionManager) Restore(positions []StrategyPosition) {
+	pm.mt.Lock()
+	defer pm.mt.Unlock()
+	pm.positions = make(map[string]*managedPosition)
+	pm.keys = make(map[string][2]string)
+	for _, sp := range positions {
+		p := pm.get(sp.Strategy, sp.Symbol)
+		p.qty, p.cost = sp.Quantity, sp.AvgPrice
+		p.realized, p.fees = sp.Realized, sp.Fees
+	}
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PriceSource resolves the latest known price of a symbol
+type PriceSource interface {
+	LastPrice(symbol string) (decimal.Decimal, bool)
+}
+
+// Quote is the last price seen for a symbol
+type Quote struct {
+	Symbol string          `json:"symbol"`
+	Price  decimal.Decimal `json:"price"`
+	Time   time.Time       `json:"time"`
+}
+
+// PriceBook keeps the latest candle close per symbol
+type PriceBook struct {
+	mt     sync.RWMutex
+	quotes map[string]Quote
+}
+
+func NewPriceBook() *PriceBook {
+	return &PriceBook{quotes: make(map[string]Quote)}
+}
+
+// Update records price as the latest quote of symbol
+func (p *PriceBook) Update(symbol string, price decimal.Decimal, at time.Time) {
+	if !price.IsPositive() {
+		return
+	}
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	p.quotes[symbol] = Quote{Symbol: symbol, Price: price, Time: at}
+}
+
+// UpdateCandle records the close of c
+func (p *PriceBook) UpdateCandle(symbol string, c Candle) {
+	p.Update(symbol, decimal.NewFromFloat(c.Close), c.Time)
+}
+
+func (p *PriceBook) LastPrice(symbol string) (decimal.Decimal, bool) {
+	p.mt.RLock()
+	defer p.mt.RUnlock()
+	q, ok := p.quotes[symbol]
+	return q.Price, ok
+}
+
+// Quotes returns the latest quote of every known symbol
+func (p *PriceBook) Quotes() []Quote {
+	p.mt.RLock()
+	defer p.mt.RUnlock()
+	out := make([]Quote, 0, len(p.quotes))
+	for _, q := range p.quotes {
+		out = append(out, q)
+	}
+	return out
+}
@@ -0,0 +1,261 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// ProtectionConfig sets the exits kept behind every position. Distances are
+// fractions of the entry price, 0.02 being 2%; zero leaves that exit off.
+type ProtectionConfig struct {
+	StopLoss   float64 `json:"stop_loss"`
+	TakeProfit float64 `json:"take_profit"`
+	Trailing   bool    `json:"trailing"` // the stop follows the best price since entry at the same distance
+}
+
+func (c ProtectionConfig) enabled() bool {
+	return c.StopLoss > 0 || c.TakeProfit > 0
+}
+
+// Exit kinds of a bracket
+const (
+	ExitStopLoss   = "stop_loss"
+	ExitTakeProfit = "take_profit"
+)
+
+// Bracket is the stop-loss and take-profit pair protecting one position
+type Bracket struct {
+	Strategy   string          `json:"strategy"`
+	Symbol     string          `json:"symbol"`
+	Quantity   decimal.Decimal `json:"quantity"` // negative when short
+	Entry      decimal.Decimal `json:"entry"`    // average entry price
+	StopLoss   decimal.Decimal `json:"stop_loss"`
+	TakeProfit decimal.Decimal `json:"take_profit"`
+	Best       decimal.Decimal `json:"best"`              // best price since entry
+	Exiting    string          `json:"exiting,omitempty"` // the exit that triggered, until its fill closes the position
+}
+
+// bracket is a strategy's position in a symbol with its exit levels
+type bracket struct {
+	avgPosition
+	strategy string
+	symbol   string
+	stop     decimal.Decimal
+	target   decimal.Decimal
+	best     decimal.Decimal
+	exiting  string
+}
+
+// PositionProtector keeps a stop-loss and take-profit behind the position
+// each strategy builds from its fills. None of the exchange adapters hold
+// stop orders, so both legs are simulated: candle highs and lows are
+// checked against them and the leg hit first exits the whole position with
+// a market order, cancelling the other one (OCO). A candle reaching both
+// counts as a stop-loss.
+type PositionProtector struct {
+	mt       sync.Mutex
+	cfg      ProtectionConfig
+	exec     OrderExecutor
+	brackets map[string]*bracket // by strategy and symbol
+}
+
+func NewPositionProtector(cfg ProtectionConfig, exec OrderExecutor) *PositionProtector {
+	return &PositionProtector{cfg: cfg, exec: exec, brackets: make(map[string]*bracket)}
+}
+
+// SetConfig changes the exit distances, positions get them on their next fill
+func (p *PositionProtector) SetConfig(cfg ProtectionConfig) {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	p.cfg = cfg
+}
+
+func (p *PositionProtector) Config() ProtectionConfig {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	return p.cfg
+}
+
+// Track follows fills published on bus
+func (p *PositionProtector) Track(bus *EventBus) {
+	bus.Subscribe(EventOrderFilled, p.onFill)
+}
+
+func (p *PositionProtector) onFill(ev Event) {
+	o := ev.Order
+	if o.Strategy == "" {
+		return
+	}
+	price := o.FilledPrice
+	if !price.IsPositive() {
+		price = o.Price
+	}
+
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	if !p.cfg.enabled() {
+		return
+	}
+	key := o.Strategy + "\x00" + o.Symbol
+	b := p.brackets[key]
+	if b == nil {
+		b = &bracket{strategy: o.Strategy, symbol: o.Symbol}
+		p.brackets[key] = b
+	}
+	before := b.qty
+	b.apply(signedQty(o.Side, o.Quantity), price)
+	switch {
+	case b.qty.IsZero():
+		delete(p.brackets, key)
+	case b.qty.Sign() != before.Sign():
+		// opened, or flipped to the other side
+		b.exiting = ""
+		b.best = price
+		p.setLevels(b)
+	case b.qty.Abs().GreaterThan(before.Abs()):
+		// added to, the levels move with the average entry
+		p.setLevels(b)
+	}
+}
+
+// setLevels places the exits of b at their distance from its entry. Callers must hold p.mt.
+func (p *PositionProtector) setLevels(b *bracket) {
+	b.stop, b.target = decimal.Zero, decimal.Zero
+	dir := decimal.NewFromInt(int64(b.qty.Sign()))
+	if p.cfg.StopLoss > 0 {
+		b.stop = b.cost.Mul(decimal.NewFromInt(1).Sub(dir.Mul(decimal.NewFromFloat(p.cfg.StopLoss))))
+	}
+	if p.cfg.TakeProfit > 0 {
+		b.target = b.cost.Mul(decimal.NewFromInt(1).Add(dir.Mul(decimal.NewFromFloat(p.cfg.TakeProfit))))
+	}
+	if p.cfg.Trailing {
+		p.trail(b)
+	}
+}
+
+// trail raises the stop of a long, or lowers that of a short, to its
+// distance from the best price. Callers must hold p.mt.
+func (p *PositionProtector) trail(b *bracket) {
+	if p.cfg.StopLoss <= 0 {
+		return
+	}
+	dist := decimal.NewFromFloat(p.cfg.StopLoss)
+	if b.qty.IsPositive() {
+		if stop := b.best.Mul(decimal.NewFromInt(1).Sub(dist)); stop.GreaterThan(b.stop) {
+			b.stop = stop
+		}
+		return
+	}
+	if stop := b.best.Mul(decimal.NewFromInt(1).Add(dist)); stop.LessThan(b.stop) {
+		b.stop = stop
+	}
+}
+
+// OnCandle checks the brackets of symbol against c, exiting the positions
+// whose stop-loss or take-profit it reached. Exits are submitted on their
+// own goroutines so the candle feed is never held up.
+func (p *PositionProtector) OnCandle(ctx context.Context, symbol string, c Candle) {
+	high, low := decimal.NewFromFloat(c.High), decimal.NewFromFloat(c.Low)
+	if c.High == 0 && c.Low == 0 {
+		high = decimal.NewFromFloat(c.Close)
+		low = high
+	}
+
+	var exits []Order
+	p.mt.Lock()
+	for _, b := range p.brackets {
+		if b.symbol != symbol || b.exiting != "" {
+			continue
+		}
+		long := b.qty.IsPositive()
+		// the price against the position is checked before the one for it
+		adverse, favorable := low, high
+		if !long {
+			adverse, favorable = high, low
+		}
+		switch {
+		case b.stop.IsPositive() && reached(adverse, b.stop, !long):
+			b.exiting = ExitStopLoss
+		case b.target.IsPositive() && reached(favorable, b.target, long):
+			b.exiting = ExitTakeProfit
+		default:
+			if (long && favorable.GreaterThan(b.best)) || (!long && favorable.LessThan(b.best)) {
+				b.best = favorable
+				if p.cfg.Trailing {
+					p.trail(b)
+				}
+			}
+			continue
+		}
+		side := SideSell
+		if !long {
+			side = SideBuy
+		}
+		exits = append(exits, Order{Symbol: b.symbol, Side: side, Type: OrderMarket, Quantity: b.qty.Abs(), Strategy: b.strategy})
+		level := b.stop
+		if b.exiting == ExitTakeProfit {
+			level = b.target
+		}
+		log.Printf("%s %s %s hit at %s, exiting %s and cancelling the other leg", b.strategy, b.symbol, b.exiting, level, b.qty.Abs())
+	}
+	exec := p.exec
+	p.mt.Unlock()
+
+	for _, o := range exits {
+		go p.exit(ctx, exec, o)
+	}
+}
+
+// reached reports whether price got to level, from below when up is set
+func reached(price, level decimal.Decimal, up bool) bool {
+	if up {
+		return price.GreaterThanOrEqual(level)
+	}
+	return price.LessThanOrEqual(level)
+}
+
+// exit submits the market order closing a position. When it fails the
+// bracket is re-armed and the next candle tries again.
+func (p *PositionProtector) exit(ctx context.Context, exec OrderExecutor, o Order) {
+	if exec == nil {
+		return
+	}
+	if _, err := exec.Submit(ctx, o); err != nil {
+		log.Printf("protection: exit %s %s %s of %s failed: %v", o.Side, o.Quantity, o.Symbol, o.Strategy, err)
+		p.mt.Lock()
+		if b := p.brackets[o.Strategy+"\x00"+o.Symbol]; b != nil {
+			b.exiting = ""
+		}
+		p.mt.Unlock()
+	}
+}
+
+// Brackets reports the exits protecting every open position
+func (p *PositionProtector) Brackets() []Bracket {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	out := make([]Bracket, 0, len(p.brackets))
+	for _, b := range p.brackets {
+		out = append(out, Bracket{
+			Strategy:   b.strategy,
+			Symbol:     b.symbol,
+			Quantity:   b.qty,
+			Entry:      b.cost,
+			StopLoss:   b.stop,
+			TakeProfit: b.target,
+			Best:       b.best,
+			Exiting:    b.exiting,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Strategy != out[j].Strategy {
+			return out[i].Strategy < out[j].Strategy
+		}
+		return out[i].Symbol < out[j].Symbol
+	})
+	return out
+}
@@ -0,0 +1,340 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// SubjectReconcile is the notification subject of reconciliation discrepancies
+const SubjectReconcile = "Exchange reconciliation"
+
+// ReconcileConfig sets what the reconciliation job does about discrepancies
+type ReconcileConfig struct {
+	AutoCorrect   bool            `json:"auto_correct"`       // bring local state in line with the exchange
+	CashTolerance decimal.Decimal `json:"cash_tolerance_usd"` // quote balance drift that is not reported
+}
+
+// Discrepancy is one difference between what the engine tracks and what the exchange reports
+type Discrepancy struct {
+	Kind      string `json:"kind"` // order | position | balance
+	Symbol    string `json:"symbol,omitempty"`
+	OrderID   string `json:"order_id,omitempty"`
+	Asset     string `json:"asset,omitempty"`
+	Local     string `json:"local"`
+	Exchange  string `json:"exchange"`
+	Corrected bool   `json:"corrected"`
+}
+
+func (d Discrepancy) key() string {
+	return d.Kind + "/" + d.Symbol + "/" + d.OrderID + "/" + d.Asset
+}
+
+func (d Discrepancy) String() string {
+	what := d.Symbol
+	if d.OrderID != "" {
+		what = d.OrderID
+	} else if d.Asset != "" {
+		what = d.Asset
+	}
+	s := fmt.Sprintf("%s %s: local %s, exchange %s", d.Kind, what, d.Local, d.Exchange)
+	if d.Corrected {
+		s += ", corrected"
+	}
+	return s
+}
+
+// ReconcileReport is the outcome of one reconciliation pass
+type ReconcileReport struct {
+	Time          time.Time     `json:"time"`
+	Exchange      string        `json:"exchange"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+	Errors        []string      `json:"errors,omitempty"`
+}
+
+// Reconciler compares the orders the order manager tracks, the strategy
+// positions and the quote balance expected from fills with what the
+// exchange reports. A difference has to show on two passes in a row to be
+// reported, so orders and fills in flight are not flagged. When auto
+// correcting it stops tracking orders the exchange no longer lists, tracks
+// the ones it does, sets the position of a symbol traded by one strategy to
+// the exchange's and moves the expected balance to the reported one.
+type Reconciler struct {
+	mt      sync.Mutex
+	cfg     ReconcileConfig
+	cash    decimal.Decimal // quote balance expected from the last pass and the fills since
+	hasCash bool
+	seen    map[string]bool // discrepancies of the last pass
+	alerted map[string]bool // discrepancies last notified
+	last    *ReconcileReport
+}
+
+func NewReconciler(cfg ReconcileConfig) *Reconciler {
+	return &Reconciler{cfg: cfg, seen: map[string]bool{}, alerted: map[string]bool{}}
+}
+
+// Config returns the settings of r
+func (r *Reconciler) Config() ReconcileConfig {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	return r.cfg
+}
+
+// Track follows fills published on bus to move the expected quote balance
+func (r *Reconciler) Track(bus *EventBus) {
+	bus.Subscribe(EventOrderFilled, func(ev Event) {
+		o := ev.Order
+		price := o.FilledPrice
+		if !price.IsPositive() {
+			price = o.Price
+		}
+		r.mt.Lock()
+		defer r.mt.Unlock()
+		r.cash = r.cash.Sub(signedQty(o.Side, o.Quantity).Mul(price)).Sub(o.Fee)
+	})
+}
+
+// Last returns the report of the latest pass, nil before the first
+func (r *Reconciler) Last() *ReconcileReport {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	return r.last
+}
+
+// orderTracker is the part of the order manager reconciliation checks and corrects
+type orderTracker interface {
+	OpenOrders() []Order
+	Reconcile(ctx context.Context, symbol string) ([]Order, error)
+	Refresh(ctx context.Context, o Order) (Order, error)
+}
+
+// SetReconciler runs r every interval while the engine runs, a zero
+// interval only runs it on demand
+func (e *Engine) SetReconciler(r *Reconciler, every time.Duration) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.recon = r
+	e.reconEvery = every
+	r.Track(e.events)
+}
+
+// Reconciler returns the reconciliation job, nil when none is set
+func (e *Engine) Reconciler() *Reconciler {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.recon
+}
+
+// runReconciler reconciles every interval until ctx ends
+func (e *Engine) runReconciler(ctx context.Context, every time.Duration) {
+	t := e.clock.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			if _, err := e.Reconcile(ctx); err != nil {
+				log.Printf("reconcile: %v", err)
+			}
+		}
+	}
+}
+
+// Reconcile runs one reconciliation pass, logging what differs and
+// notifying when the set of discrepancies changes
+func (e *Engine) Reconcile(ctx context.Context) (*ReconcileReport, error) {
+	e.lock.Lock()
+	r, x, om, asset := e.recon, e.exchange, e.om, e.quote
+	symbols := e.symbols()
+	traders := map[string][]string{} // strategies by symbol
+	for _, s := range e.strategies {
+		for _, symbol := range StrategySymbols(s) {
+			traders[symbol] = append(traders[symbol], s.Name())
+		}
+	}
+	e.lock.Unlock()
+	if r == nil {
+		return nil, fmt.Errorf("reconciliation is not enabled")
+	}
+	if x == nil {
+		return nil, fmt.Errorf("no exchange adapter")
+	}
+	cfg := r.Config()
+	rep := &ReconcileReport{Time: e.clock.Now().UTC(), Exchange: x.AdapterName()}
+	var found []Discrepancy
+
+	// orders
+	tracker, _ := om.(orderTracker)
+	if tracker != nil {
+		local := map[string][]Order{}
+		for _, o := range tracker.OpenOrders() {
+			local[o.Symbol] = append(local[o.Symbol], o)
+			if !slices.Contains(symbols, o.Symbol) {
+				symbols = append(symbols, o.Symbol)
+			}
+		}
+		for _, symbol := range symbols {
+			resting, err := x.GetOpenOrders(ctx, symbol)
+			if err != nil {
+				rep.Errors = append(rep.Errors, fmt.Sprintf("%s open orders: %v", symbol, err))
+				continue
+			}
+			onExchange := map[string]bool{}
+			for _, o := range resting {
+				onExchange[o.ID] = true
+			}
+			tracked := map[string]bool{}
+			for _, o := range local[symbol] {
+				tracked[o.ID] = true
+				if !onExchange[o.ID] {
+					found = append(found, Discrepancy{Kind: "order", Symbol: symbol, OrderID: o.ID, Local: string(o.Status), Exchange: "not open"})
+				}
+			}
+			for _, o := range resting {
+				if !tracked[o.ID] && !o.Status.Final() {
+					found = append(found, Discrepancy{Kind: "order", Symbol: symbol, OrderID: o.ID, Local: "not tracked", Exchange: string(o.Status)})
+				}
+			}
+		}
+	}
+
+	// positions
+	held := map[string]decimal.Decimal{}
+	for _, p := range e.positions.Positions() {
+		held[p.Symbol] = held[p.Symbol].Add(p.Quantity)
+	}
+	exchangePos := map[string]Position{}
+	for _, symbol := range symbols {
+		pos, err := x.GetPosition(ctx, symbol)
+		if err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("%s position: %v", symbol, err))
+			continue
+		}
+		exchangePos[symbol] = pos
+		if !pos.Quantity.Equal(held[symbol]) {
+			found = append(found, Discrepancy{Kind: "position", Symbol: symbol, Local: held[symbol].String(), Exchange: pos.Quantity.String()})
+		}
+	}
+
+	// quote balance
+	var cash decimal.Decimal
+	bals, err := x.GetBalances(ctx)
+	if err != nil {
+		rep.Errors = append(rep.Errors, fmt.Sprintf("balances: %v", err))
+	} else {
+		quote := quoteAsset(x, asset)
+		cash = bals[quote]
+		r.mt.Lock()
+		if r.hasCash && cash.Sub(r.cash).Abs().GreaterThan(cfg.CashTolerance) {
+			found = append(found, Discrepancy{Kind: "balance", Asset: quote, Local: r.cash.StringFixed(2), Exchange: cash.StringFixed(2)})
+		}
+		if !r.hasCash {
+			r.cash, r.hasCash = cash, true
+		}
+		r.mt.Unlock()
+	}
+
+	// only what the last pass saw too is reported
+	r.mt.Lock()
+	seen := map[string]bool{}
+	for _, d := range found {
+		seen[d.key()] = true
+		if r.seen[d.key()] {
+			rep.Discrepancies = append(rep.Discrepancies, d)
+		}
+	}
+	r.seen = seen
+	r.mt.Unlock()
+
+	if cfg.AutoCorrect {
+		for i, d := range rep.Discrepancies {
+			rep.Discrepancies[i].Corrected = e.correct(ctx, r, tracker, d, traders[d.Symbol], exchangePos[d.Symbol], cash)
+		}
+	}
+	sort.Slice(rep.Discrepancies, func(i, j int) bool { return rep.Discrepancies[i].key() < rep.Discrepancies[j].key() })
+
+	r.mt.Lock()
+	r.last = rep
+	alerted := map[string]bool{}
+	changed := false
+	for _, d := range rep.Discrepancies {
+		alerted[d.key()] = true
+		changed = changed || !r.alerted[d.key()]
+	}
+	changed = changed || len(alerted) != len(r.alerted)
+	r.alerted = alerted
+	r.mt.Unlock()
+
+	for _, d := range rep.Discrepancies {
+		log.Printf("reconcile: %s", d)
+	}
+	if changed && len(rep.Discrepancies) > 0 {
+		lines := make([]string, 0, len(rep.Discrepancies))
+		for _, d := range rep.Discrepancies {
+			lines = append(lines, d.String())
+		}
+		e.notify(ctx, SubjectReconcile, fmt.Sprintf("%d discrepancies with %s\n%s", len(lines), rep.Exchange, strings.Join(lines, "\n")))
+	}
+	return rep, nil
+}
+
+// correct brings the local state behind d in line with the exchange and
+// reports whether it could
+func (e *Engine) correct(ctx context.Context, r *Reconciler, tracker orderTracker, d Discrepancy, traders []string, pos Position, cash decimal.Decimal) bool {
+	switch d.Kind {
+	case "order":
+		if tracker == nil {
+			return false
+		}
+		if d.Local == "not tracked" {
+			_, err := tracker.Reconcile(ctx, d.Symbol)
+			return err == nil
+		}
+		// an order no longer open may have filled as well as been canceled,
+		// it settles with whatever the exchange says became of it
+		for _, o := range tracker.OpenOrders() {
+			if o.ID != d.OrderID {
+				continue
+			}
+			cur, err := tracker.Refresh(ctx, o)
+			if err != nil {
+				log.Printf("reconcile: order %s left open, its status is unknown: %v", o.ID, err)
+				return false
+			}
+			return cur.Status.Final()
+		}
+		return false
+	case "position":
+		// positions split across strategies cannot be attributed
+		if len(traders) != 1 {
+			return false
+		}
+		avg := pos.AvgPrice
+		if !avg.IsPositive() {
+			avg, _ = e.prices.LastPrice(d.Symbol)
+		}
+		// the strategy takes what fills of others, such as manual orders, do not account for
+		others := decimal.Zero
+		for _, p := range e.positions.Positions() {
+			if p.Symbol == d.Symbol && p.Strategy != traders[0] {
+				others = others.Add(p.Quantity)
+			}
+		}
+		e.positions.SetQuantity(traders[0], d.Symbol, pos.Quantity.Sub(others), avg)
+		return true
+	case "balance":
+		r.mt.Lock()
+		defer r.mt.Unlock()
+		r.cash = cash
+		return true
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/store"
+)
+
+// Recorder writes the candles strategies see and the orders they submit
+// to the store under a session id, so a session can be inspected or replayed
+type Recorder struct {
+	db        store.Store
+	mt        sync.Mutex
+	sessionID string
+}
+
+func NewRecorder(db store.Store) *Recorder {
+	return &Recorder{db: db}
+}
+
+// Begin starts a new session and returns its id
+func (r *Recorder) Begin() string {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	r.sessionID = "session_" + time.Now().UTC().Format("20060102_150405")
+	log.Printf("Recording session %s", r.sessionID)
+	return r.sessionID
+}
+
+// SessionID returns the session being recorded, "" before Begin
+func (r *Recorder) SessionID() string {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	return r.sessionID
+}
+
+// RecordCandle stores a candle delivered to strategy
+func (r *Recorder) RecordCandle(strategy, symbol string, c Candle) {
+	r.record("candle", strategy, symbol, c)
+}
+
+// RecordOrder stores an order accepted by the exchange
+func (r *Recorder) RecordOrder(o Order) {
+	r.record("order", "", o.Symbol, o)
+}
+
+func (r *Recorder) record(kind, source, symbol string, v interface{}) {
+	id := r.SessionID()
+	if id == "" {
+		return
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("recorder: marshal %s: %v", kind, err)
+		return
+	}
+	if err := r.db.SaveSessionEvent(id, kind, source, symbol, time.Now(), payload); err != nil {
+		log.Printf("recorder: save %s: %v", kind, err)
+	}
+}
@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// Recovery reports what Recover rebuilt from the store
+type Recovery struct {
+	Snapshot    string   `json:"snapshot,omitempty"` // restored snapshot, empty when there was none
+	Trades      int      `json:"trades"`             // fills replayed into positions
+	OpenOrders  int      `json:"open_orders"`        // orders tracked again
+	WarmedUp    []string `json:"warmed_up,omitempty"`
+	StoppedRuns []string `json:"stopped_runs,omitempty"` // runs an unclean exit left open
+	Mismatches  []string `json:"mismatches,omitempty"`   // symbols whose position differs on the exchange
+}
+
+// Recover rebuilds the engine from the store after a crash or deploy,
+// before Start. It restores snapshot (an id or "latest", skipped when the
+// store has none) and the strategy state saved after it, replays the trades
+// persisted since the snapshot into the strategy positions, tracks the
+// orders still open in the store until the exchange settles them, warms
+// strategies up with stored candles, closes runs left open, and logs
+// positions that differ from what the exchange holds.
+func (e *Engine) Recover(ctx context.Context, snapshot string) (*Recovery, error) {
+	if e.store == nil {
+		return nil, fmt.Errorf("recover needs a store")
+	}
+	rec := &Recovery{}
+
+	// trades up to the snapshot are in its positions, the store keeps trade
+	// times to the second so that second is taken to be in it
+	var since time.Time
+	restored := map[string]time.Time{} // when the state of a strategy was taken
+	if snapshot != "" {
+		snap, err := e.Restore(ctx, snapshot)
+		switch {
+		case errors.Is(err, sql.ErrNoRows) && snapshot == "latest":
+			log.Println("recover: no snapshot to restore, rebuilding positions from every trade")
+		case err != nil:
+			return nil, fmt.Errorf("recover: %w", err)
+		default:
+			rec.Snapshot = snap.ID
+			since = snap.Created.Truncate(time.Second)
+			for _, ss := range snap.Strategies {
+				if len(ss.State) > 0 {
+					restored[ss.Name] = snap.Created
+				}
+			}
+		}
+	}
+
+	trades, err := e.store.LoadTradesSince(since)
+	if err != nil {
+		return nil, fmt.Errorf("recover trades: %w", err)
+	}
+	for _, t := range trades {
+		price := decimal.NewFromFloat(t.Price)
+		e.positions.onFill(Event{Type: EventOrderFilled, Time: t.Created, Order: Order{
+			ID: t.OrderID, Symbol: t.Symbol, Side: Side(t.Side), Strategy: t.Strategy,
+			Quantity: decimal.NewFromFloat(t.Quantity), Price: price, FilledPrice: price,
+			Fee: decimal.NewFromFloat(t.Fee),
+		}})
+	}
+	rec.Trades = len(trades)
+
+	e.lock.Lock()
+	err = e.recoverLocked(rec, restored)
+	x, symbols := e.exchange, e.symbols()
+	e.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// the exchange is not called while holding the lock
+	if x != nil {
+		held := map[string]decimal.Decimal{}
+		for _, p := range e.positions.Positions() {
+			held[p.Symbol] = held[p.Symbol].Add(p.Quantity)
+		}
+		for _, symbol := range symbols {
+			pos, err := x.GetPosition(ctx, symbol)
+			if err != nil {
+				log.Printf("recover: could not read %s position: %v", symbol, err)
+				continue
+			}
+			if !pos.Quantity.Equal(held[symbol]) {
+				log.Printf("recover: strategies hold %s %s, %s reports %s",
+					held[symbol], symbol, x.AdapterName(), pos.Quantity)
+				rec.Mismatches = append(rec.Mismatches, symbol)
+			}
+		}
+	}
+
+	log.Printf("Engine recovered: %d trades replayed, %d open orders tracked", rec.Trades, rec.OpenOrders)
+	return rec, nil
+}
+
+// recoverLocked tracks the open orders of the store, loads the strategy
+// states saved after restored, warms the strategies up and closes the runs
+// left open. Callers must hold e.lock.
+func (e *Engine) recoverLocked(rec *Recovery, restored map[string]time.Time) error {
+	adopt, _ := e.om.(interface{ Adopt(Order) })
+	for _, symbol := range e.symbols() {
+		orders, err := e.store.LoadOpenOrders(symbol, e.clock.Now())
+		if err != nil {
+			return fmt.Errorf("recover %s open orders: %w", symbol, err)
+		}
+		if adopt == nil {
+			continue
+		}
+		for _, o := range orders {
+			adopt.Adopt(orderFromRecord(o))
+			rec.OpenOrders++
+		}
+	}
+
+	// state the strategies saved after the snapshot replaces its state
+	if err := e.loadStrategyStates(restored); err != nil {
+		return fmt.Errorf("recover: %w", err)
+	}
+	for _, s := range e.strategies {
+		n, err := e.warmUpSince(s, restored[s.Name()])
+		if err != nil {
+			return fmt.Errorf("recover %w", err)
+		}
+		if n == 0 {
+			continue
+		}
+		rec.WarmedUp = append(rec.WarmedUp, s.Name())
+		log.Printf("recover: warmed %s up with %d candles", s.Name(), n)
+	}
+
+	stopped, err := e.store.StopOpenRuns()
+	if err != nil {
+		return fmt.Errorf("recover runs: %w", err)
+	}
+	rec.StoppedRuns = stopped
+	for _, id := range rec.StoppedRuns {
+		log.Printf("recover: run %s was left open by an unclean exit, marked stopped", id)
+	}
+	return nil
+}
+
+// orderFromRecord is the engine order of a persisted order row
+func orderFromRecord(o store.OrderRecord) Order {
+	r := Order{
+		ID:          o.ID,
+		Symbol:      o.Symbol,
+		Side:        Side(o.Side),
+		Type:        OrderType(o.Type),
+		Price:       decimal.NewFromFloat(o.Price),
+		FilledPrice: decimal.NewFromFloat(o.FilledPrice),
+		Quantity:    decimal.NewFromFloat(o.Quantity),
+		FilledQty:   decimal.NewFromFloat(o.FilledQty),
+		Status:      OrderStatus(o.Status),
+		Created:     o.Created.Unix(),
+		TraceID:     o.TraceID,
+		Strategy:    o.Strategy,
+		TimeInForce: TimeInForce(o.TimeInForce),
+	}
+	if o.ExpireAt != nil {
+		r.ExpireAt = *o.ExpireAt
+	}
+	return r
+}
+
+// StoredCandles converts candle rows of the store, skipping ones with an
+// unreadable time
+func StoredCandles(rows []map[string]interface{}) []Candle {
+	candles := make([]Candle, 0, len(rows))
+	for _, r := range rows {
+		ts, _ := r["time"].(string)
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			continue
+		}
+		c := Candle{Time: t}
+		c.Open, _ = r["open"].(float64)
+		c.High, _ = r["high"].(float64)
+		c.Low, _ = r["low"].(float64)
+		c.Close, _ = r["close"].(float64)
+		c.Volume, _ = r["volume"].(float64)
+		candles = append(candles, c)
+	}
+	return candles
+}
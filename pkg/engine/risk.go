@@ -1,21 +1,44 @@
 package engine
 
-import "math"
+import (
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
 
 type FixedPercentRisk struct {
-    Percent float64
+	mt      sync.RWMutex
+	Percent decimal.Decimal
 }
 
 func NewFixedPercentRisk(p float64) *FixedPercentRisk {
-    return &FixedPercentRisk{Percent: p}
+	return &FixedPercentRisk{Percent: decimal.NewFromFloat(p)}
+}
+
+// SetPercent changes the share of the balance sized into each order
+func (r *FixedPercentRisk) SetPercent(p float64) {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	r.Percent = decimal.NewFromFloat(p)
 }
 
-func (r *FixedPercentRisk) Size(symbol string, price float64, accountBalance float64) float64 {
-    if price <= 0 {
-        return 0
-    }
-    usd := accountBalance * r.Percent
-    qty := usd / price
-    // floor to 8 decimal places
-    return math.Floor(qty*1e8) / 1e8
+// Share is the share of the balance sized into each order
+func (r *FixedPercentRisk) Share() float64 {
+	r.mt.RLock()
+	defer r.mt.RUnlock()
+	return r.Percent.InexactFloat64()
 }
+
+func (r *FixedPercentRisk) Size(strategy, symbol string, price decimal.Decimal, accountBalance decimal.Decimal) decimal.Decimal {
+	if !price.IsPositive() {
+		return decimal.Zero
+	}
+	r.mt.RLock()
+	usd := accountBalance.Mul(r.Percent)
+	r.mt.RUnlock()
+	qty := usd.DivRound(price, 16)
+	// floor to 8 decimal places
+	return qty.RoundFloor(8)
+}
+
+func (r *FixedPercentRisk) Observe(symbol string, c Candle) {}
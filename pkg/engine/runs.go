@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// runValuationTimeout bounds the balance reads valuing the account when a
+// run starts and stops
+const runValuationTimeout = 10 * time.Second
+
+// Run returns the id of the current run, empty while the engine is stopped
+func (e *Engine) Run() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.run.ID
+}
+
+// beginRun records a run of the registered strategies with the equity it
+// starts from, valued by runEquity when ok, and tags the orders, trades
+// and candles stored from now on with it. Callers must hold e.lock.
+func (e *Engine) beginRun(eq float64, ok bool) {
+	now := e.clock.Now().UTC()
+	run := store.RunRecord{
+		ID:      "run_" + now.Format("20060102_150405.000"),
+		Started: now,
+		Symbols: e.symbols(),
+	}
+	for _, s := range e.strategies {
+		run.Strategies = append(run.Strategies, s.Name())
+	}
+	if ok {
+		run.StartEquity = &eq
+	}
+	if err := e.store.SaveRunStart(run); err != nil {
+		log.Printf("failed to record run %s: %v", run.ID, err)
+		return
+	}
+	e.store.SetRun(run.ID)
+	e.run, e.runStart = run, e.totalPnL()
+	log.Printf("Run %s started", run.ID)
+}
+
+// endRun records the stop of run id, when it is still the current one,
+// with the PnL made during it, the equity it ends with, valued by
+// runEquity when ok, and its largest drawdown. Callers must hold e.lock.
+func (e *Engine) endRun(id string, eq float64, ok bool) {
+	if e.run.ID == "" || e.run.ID != id {
+		return
+	}
+	run := e.run
+	now := e.clock.Now().UTC()
+	pnl := e.totalPnL().Sub(e.runStart).InexactFloat64()
+	run.Stopped, run.FinalPnL = &now, &pnl
+	if ok {
+		run.FinalEquity = &eq
+	}
+	if run.StartEquity != nil && run.FinalEquity != nil {
+		// the samples of the equity recorder fill in the curve between the ends
+		curve := []float64{*run.StartEquity}
+		samples, err := e.store.LoadEquity(run.Started, now)
+		if err != nil {
+			log.Printf("run %s: could not load equity samples: %v", run.ID, err)
+		}
+		for _, s := range samples {
+			curve = append(curve, s.Equity)
+		}
+		dd := maxDrawdown(append(curve, *run.FinalEquity))
+		run.MaxDrawdown = &dd
+	}
+	if err := e.store.SaveRunStop(run); err != nil {
+		log.Printf("failed to record the stop of run %s: %v", run.ID, err)
+	}
+	e.store.SetRun("")
+	log.Printf("Run %s stopped, PnL %.2f", run.ID, pnl)
+	e.run = store.RunRecord{}
+}
+
+// runEquity values the account for the run records, logging when it cannot
+// and reporting false without a store. The balances are read without
+// holding e.lock, callers must not hold it.
+func (e *Engine) runEquity() (float64, bool) {
+	e.lock.Lock()
+	ex, asset, db := e.exchange, e.quote, e.store
+	e.lock.Unlock()
+	if db == nil {
+		return 0, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), runValuationTimeout)
+	defer cancel()
+	rec, err := e.equity(ctx, ex, asset)
+	if err != nil {
+		log.Printf("could not value the account for run records: %v", err)
+		return 0, false
+	}
+	return rec.Equity, true
+}
+
+// maxDrawdown is the largest peak to trough drop of curve as a fraction of the peak
+func maxDrawdown(curve []float64) float64 {
+	var peak, dd float64
+	for _, eq := range curve {
+		peak = math.Max(peak, eq)
+		if peak > 0 {
+			dd = math.Max(dd, (peak-eq)/peak)
+		}
+	}
+	return dd
+}
+
+// totalPnL is the realized and unrealized PnL of every strategy position
+func (e *Engine) totalPnL() decimal.Decimal {
+	total := decimal.Zero
+	for _, s := range e.positions.Symbols() {
+		total = total.Add(s.Realized).Add(s.Unrealized)
+	}
+	return total
+}
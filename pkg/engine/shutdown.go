@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Notifier delivers operator notifications such as the shutdown report
+type Notifier interface {
+	Notify(ctx context.Context, subject, message string) error
+}
+
+// Subjects of the notifications the engine sends
+const (
+	SubjectKillSwitch    = "Kill switch tripped"
+	SubjectShutdown      = "Trading engine shutdown"
+	SubjectCircuitOpen   = "Exchange circuit breaker open"
+	SubjectCircuitClosed = "Exchange circuit breaker closed"
+)
+
+// ShutdownOptions controls what happens to live state on shutdown
+type ShutdownOptions struct {
+	// CancelOpenOrders cancels resting orders on the exchange, otherwise
+	// they are left working
+	CancelOpenOrders bool
+}
+
+// AddNotifier registers n for engine notifications
+func (e *Engine) AddNotifier(n Notifier) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.notifiers = append(e.notifiers, n)
+}
+
+func (e *Engine) notify(ctx context.Context, subject, message string) {
+	e.lock.Lock()
+	notifiers := append([]Notifier(nil), e.notifiers...)
+	e.lock.Unlock()
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, subject, message); err != nil {
+			log.Printf("notify %q failed: %v", subject, err)
+		}
+	}
+}
+
+// Shutdown stops the engine in a safe order: candle feeds stop and the
+// candle and order submission in hand finishes, algo orders stop slicing,
+// open orders are canceled if asked, queued events are flushed, the
+// strategies' state and a final snapshot with balances are stored and
+// notifiers are told. ctx bounds how long each step may wait.
+func (e *Engine) Shutdown(ctx context.Context, opts ShutdownOptions) error {
+	log.Println("Engine shutting down")
+
+	e.lock.Lock()
+	if e.feedCancel != nil {
+		e.feedCancel()
+	}
+	e.lock.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		log.Println("shutdown: timed out waiting for strategies to finish")
+	}
+
+	// sliced orders place no more children once the strategies stopped
+	if a, ok := e.OrderManager().(interface{ StopAlgos() int }); ok {
+		if n := a.StopAlgos(); n > 0 {
+			log.Printf("shutdown: stopped %d algo orders with children left to place", n)
+		}
+	}
+
+	uncanceled := 0
+	if opts.CancelOpenOrders {
+		e.lock.Lock()
+		if e.exchange != nil {
+			uncanceled = e.cancelOpenOrders(ctx, e.exchange)
+		}
+		e.lock.Unlock()
+	}
+
+	var errs []string
+	if err := e.events.Drain(ctx); err != nil {
+		errs = append(errs, "flush events: "+err.Error())
+	}
+
+	if err := e.SaveStrategyStates(); err != nil {
+		errs = append(errs, "save strategy state: "+err.Error())
+	}
+
+	report := "engine stopped"
+	snap, err := e.Snapshot(ctx)
+	if err != nil {
+		errs = append(errs, "final snapshot: "+err.Error())
+	} else {
+		report = fmt.Sprintf("engine stopped, final snapshot %s", snap.ID)
+		for asset, bal := range snap.Balances {
+			if !bal.IsZero() {
+				report += fmt.Sprintf("\n%s %s", asset, bal.StringFixed(4))
+			}
+		}
+		if opts.CancelOpenOrders && uncanceled > 0 {
+			report += fmt.Sprintf("\nopen orders of %d symbols could not be canceled", uncanceled)
+		} else if opts.CancelOpenOrders {
+			report += "\nopen orders canceled"
+		} else if len(snap.OpenOrders) > 0 {
+			report += fmt.Sprintf("\n%d open orders left working", len(snap.OpenOrders))
+		}
+	}
+
+	e.Stop()
+
+	if len(errs) > 0 {
+		report += "\nerrors: " + strings.Join(errs, "; ")
+	}
+	e.notify(ctx, SubjectShutdown, report)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("shutdown: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
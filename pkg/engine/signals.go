@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"context"
+	"log"
+
+	"github.com/omept/trading-engine/pkg/store"
+)
+
+// SignalOnlyStrategy is implemented by strategies that can run signal-only,
+// evaluated live without risking capital. The engine gives those running
+// signal-only the paper positions of their signals to read.
+type SignalOnlyStrategy interface {
+	Strategy
+	SignalOnly() bool
+}
+
+// signalOnly reports whether s runs signal-only
+func signalOnly(s Strategy) bool {
+	so, ok := s.(SignalOnlyStrategy)
+	return ok && so.SignalOnly()
+}
+
+// SignalExecutor returns the executor of signal-only strategies. It fills
+// each order on paper at its price, or the last price of its symbol, and
+// records it as a signal: published as EventSignal and stored, never sent
+// to the exchange.
+func (e *Engine) SignalExecutor() OrderExecutor {
+	return signalExecutor{e}
+}
+
+// SignalPositions are the paper positions of signal-only strategies, as if
+// each of their signals had filled
+func (e *Engine) SignalPositions() *PositionManager {
+	return e.signals
+}
+
+type signalExecutor struct {
+	e *Engine
+}
+
+func (x signalExecutor) Submit(ctx context.Context, o Order) (Order, error) {
+	e := x.e
+	now := e.clock.Now()
+	// signals outside market hours are skipped, they could not have traded
+	if _, err := marketOpen(ctx, e.MarketHours(), o.Symbol, now); err != nil {
+		return Order{}, err
+	}
+	if !o.Price.IsPositive() {
+		if p, ok := e.prices.LastPrice(o.Symbol); ok {
+			o.Price = p
+		}
+	}
+	o.ID = "sig_" + newClientOrderID()
+	o.Created = now.Unix()
+	o.Status, o.Filled, o.FilledQty, o.FilledPrice = OrderStatusFilled, true, o.Quantity, o.Price
+
+	ev := Event{Type: EventSignal, Time: now, Order: o, Symbol: o.Symbol}
+	e.signals.onFill(ev)
+	if db := e.Store(); db != nil {
+		if err := db.SaveSignal(store.SignalRecord{
+			ID: o.ID, Strategy: o.Strategy, Symbol: o.Symbol, Side: string(o.Side),
+			Price: o.Price.InexactFloat64(), Quantity: o.Quantity.InexactFloat64(), Created: now,
+		}); err != nil {
+			log.Printf("signal %s of %s not stored: %v", o.ID, o.Strategy, err)
+		}
+	}
+	e.events.Publish(ev)
+	log.Printf("Signal %s %s %s at %s from %s", o.Side, o.Quantity, o.Symbol, o.Price, o.Strategy)
+	return o, nil
+}
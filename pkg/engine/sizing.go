@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/omept/trading-engine/pkg/indicators"
+	"github.com/shopspring/decimal"
+)
+
+// Sizing methods of SizingConfig
+const (
+	SizingFixed     = "fixed"
+	SizingKelly     = "kelly"
+	SizingVolTarget = "vol_target"
+)
+
+// SizingConfig picks how one strategy sizes its orders. Zero fields take
+// the defaults noted next to them.
+type SizingConfig struct {
+	Method        string  `json:"method"`                   // fixed (default), kelly or vol_target
+	Percent       float64 `json:"percent,omitempty"`        // share of capital per order for fixed, and until kelly or vol_target have enough data; risk.fixed_percent by default
+	MaxPercent    float64 `json:"max_percent,omitempty"`    // cap on the share of capital kelly and vol_target put in one order, 0.25 by default
+	KellyFraction float64 `json:"kelly_fraction,omitempty"` // share of the full Kelly bet to take, 0.5 by default
+	MinTrades     int     `json:"min_trades,omitempty"`     // round trips kelly needs before it sizes, 20 by default
+	Lookback      int     `json:"lookback,omitempty"`       // most recent round trips kelly sizes from, 100 by default
+	TargetVol     float64 `json:"target_vol,omitempty"`     // share of capital a one standard deviation candle move should cost, required for vol_target
+	Window        int     `json:"window,omitempty"`         // candles vol_target measures volatility over, 20 by default
+}
+
+func (c SizingConfig) withDefaults(percent float64) SizingConfig {
+	if c.Method == "" {
+		c.Method = SizingFixed
+	}
+	if c.Percent == 0 {
+		c.Percent = percent
+	}
+	if c.MaxPercent == 0 {
+		c.MaxPercent = 0.25
+	}
+	if c.KellyFraction == 0 {
+		c.KellyFraction = 0.5
+	}
+	if c.MinTrades == 0 {
+		c.MinTrades = 20
+	}
+	if c.Lookback == 0 {
+		c.Lookback = 100
+	}
+	if c.Window == 0 {
+		c.Window = 20
+	}
+	return c
+}
+
+func (c SizingConfig) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(c.Percent > 0 && c.Percent < 1, "sizing percent must be between 0 and 1, got %g", c.Percent)
+	check(c.MaxPercent > 0 && c.MaxPercent <= 1, "sizing max_percent must be between 0 and 1, got %g", c.MaxPercent)
+	switch c.Method {
+	case SizingFixed:
+	case SizingKelly:
+		check(c.KellyFraction > 0 && c.KellyFraction <= 1, "sizing kelly_fraction must be between 0 and 1, got %g", c.KellyFraction)
+		check(c.MinTrades > 0, "sizing min_trades must be positive, got %d", c.MinTrades)
+		check(c.Lookback >= c.MinTrades, "sizing lookback must be at least min_trades, got %d", c.Lookback)
+	case SizingVolTarget:
+		check(c.TargetVol > 0, "sizing target_vol must be positive, got %g", c.TargetVol)
+		check(c.Window >= 2, "sizing window must be at least 2, got %d", c.Window)
+	default:
+		check(false, "unknown sizing method %q, known: %s, %s, %s", c.Method, SizingFixed, SizingKelly, SizingVolTarget)
+	}
+	return errors.Join(errs...)
+}
+
+// NewRiskManager builds the sizer cfg describes. percent is the default
+// share of capital per order, history feeds kelly and may be nil, in which
+// case kelly never leaves its fixed percent start.
+func NewRiskManager(cfg SizingConfig, percent float64, history TradeHistory) (RiskManager, error) {
+	cfg = cfg.withDefaults(percent)
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	fixed := NewFixedPercentRisk(cfg.Percent)
+	switch cfg.Method {
+	case SizingKelly:
+		return &KellyRisk{cfg: cfg, history: history, fallback: fixed}, nil
+	case SizingVolTarget:
+		return &VolTargetRisk{cfg: cfg, closes: make(map[string]*indicators.Ring[float64]), fallback: fixed}, nil
+	}
+	return fixed, nil
+}
+
+// CloneRisk returns a risk manager with the settings of r and none of the
+// market data or trades it followed, for strategies cloned into a backtest
+func CloneRisk(r RiskManager) RiskManager {
+	if c, ok := r.(interface{ Clone() RiskManager }); ok {
+		return c.Clone()
+	}
+	return r
+}
+
+// sizeShare turns a share of capital into a quantity floored to 8 decimals
+func sizeShare(share float64, price, accountBalance decimal.Decimal) decimal.Decimal {
+	if share <= 0 || !price.IsPositive() {
+		return decimal.Zero
+	}
+	usd := accountBalance.Mul(decimal.NewFromFloat(share))
+	return usd.DivRound(price, 16).RoundFloor(8)
+}
+
+// KellyRisk sizes by the Kelly criterion from the win rate and payoff of
+// the strategy's recent round trips, taking only a fraction of the full
+// bet since that is very aggressive on estimated odds. It sizes like
+// FixedPercentRisk until there are enough round trips, and sizes nothing
+// while the recent trades show no edge.
+type KellyRisk struct {
+	cfg      SizingConfig
+	history  TradeHistory
+	fallback *FixedPercentRisk
+}
+
+func (r *KellyRisk) Size(strategy, symbol string, price decimal.Decimal, accountBalance decimal.Decimal) decimal.Decimal {
+	var results []float64
+	if r.history != nil {
+		results = r.history.Results(strategy, r.cfg.Lookback)
+	}
+	if len(results) < r.cfg.MinTrades {
+		return r.fallback.Size(strategy, symbol, price, accountBalance)
+	}
+	share := math.Min(kellyShare(results)*r.cfg.KellyFraction, r.cfg.MaxPercent)
+	return sizeShare(share, price, accountBalance)
+}
+
+func (r *KellyRisk) Observe(symbol string, c Candle) {}
+
+// Clone returns a KellyRisk with the same settings and an empty journal of
+// its own instead of the live one, so a backtest neither sizes from the
+// live round trips nor sees them change under it. The clone sizes like
+// FixedPercentRisk.
+func (r *KellyRisk) Clone() RiskManager {
+	return &KellyRisk{cfg: r.cfg, history: NewTradeJournal(), fallback: r.fallback}
+}
+
+// kellyShare is the full Kelly share of capital W - (1-W)/R for win rate W
+// and payoff ratio R of results. Break even trades are left out.
+func kellyShare(results []float64) float64 {
+	var wins, losses int
+	var won, lost float64
+	for _, pnl := range results {
+		switch {
+		case pnl > 0:
+			wins++
+			won += pnl
+		case pnl < 0:
+			losses++
+			lost -= pnl
+		}
+	}
+	if wins == 0 {
+		return 0
+	}
+	if losses == 0 {
+		return 1
+	}
+	w := float64(wins) / float64(wins+losses)
+	payoff := (won / float64(wins)) / (lost / float64(losses))
+	return w - (1-w)/payoff
+}
+
+// VolTargetRisk sizes so a one standard deviation move of the candle close
+// costs TargetVol of capital: the calmer the market, the larger the order.
+// It sizes like FixedPercentRisk until it has seen a full window of candles.
+type VolTargetRisk struct {
+	mt       sync.Mutex
+	cfg      SizingConfig
+	closes   map[string]*indicators.Ring[float64] // last window+1 closes by symbol
+	fallback *FixedPercentRisk
+}
+
+func (r *VolTargetRisk) Observe(symbol string, c Candle) {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+	ring := r.closes[symbol]
+	if ring == nil {
+		ring = indicators.NewRing[float64](r.cfg.Window + 1)
+		r.closes[symbol] = ring
+	}
+	ring.Push(c.Close)
+}
+
+func (r *VolTargetRisk) Size(strategy, symbol string, price decimal.Decimal, accountBalance decimal.Decimal) decimal.Decimal {
+	r.mt.Lock()
+	vol, ok := r.volatility(symbol)
+	r.mt.Unlock()
+	if !ok {
+		return r.fallback.Size(strategy, symbol, price, accountBalance)
+	}
+	share := r.cfg.MaxPercent
+	if vol > 0 {
+		share = math.Min(r.cfg.TargetVol/vol, share)
+	}
+	return sizeShare(share, price, accountBalance)
+}
+
+// volatility is the standard deviation of the close to close returns of
+// symbol over the window. Callers must hold r.mt.
+func (r *VolTargetRisk) volatility(symbol string) (float64, bool) {
+	ring := r.closes[symbol]
+	if ring == nil || !ring.Full() {
+		return 0, false
+	}
+	n := ring.Len() - 1
+	var sum, sumSq float64
+	for i := 0; i < n; i++ {
+		prev := ring.At(i)
+		if prev <= 0 {
+			return 0, false
+		}
+		ret := ring.At(i+1)/prev - 1
+		sum += ret
+		sumSq += ret * ret
+	}
+	mean := sum / float64(n)
+	return math.Sqrt(math.Max(sumSq/float64(n)-mean*mean, 0)), true
+}
+
+// Clone returns a VolTargetRisk with the same settings and no closes seen
+func (r *VolTargetRisk) Clone() RiskManager {
+	return &VolTargetRisk{cfg: r.cfg, closes: make(map[string]*indicators.Ring[float64]), fallback: r.fallback}
+}
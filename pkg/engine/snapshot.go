@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Snapshot is a point-in-time copy of engine state
+type Snapshot struct {
+	ID                string                     `json:"id"`
+	Created           time.Time                  `json:"created_at"`
+	Exchange          string                     `json:"exchange"`
+	Strategies        []StrategySnapshot         `json:"strategies"`
+	Positions         []Position                 `json:"positions"`
+	StrategyPositions []StrategyPosition         `json:"strategy_positions,omitempty"` // as tracked from fills
+	OpenOrders        []Order                    `json:"open_orders"`
+	Balances          map[string]decimal.Decimal `json:"balances,omitempty"`
+}
+
+// StrategySnapshot holds a strategy's allocation and, when it supports it, its internal state
+type StrategySnapshot struct {
+	Name       string          `json:"name"`
+	Symbol     string          `json:"symbol"`
+	AccountUSD decimal.Decimal `json:"account_usd"`
+	State      json.RawMessage `json:"state,omitempty"`
+}
+
+// Snapshot captures strategy state, allocations, positions and open orders
+// and persists them to the store
+func (e *Engine) Snapshot(ctx context.Context) (*Snapshot, error) {
+	e.lock.Lock()
+	x, db, now := e.exchange, e.store, e.clock.Now()
+	snap := &Snapshot{
+		ID:      "snap_" + now.UTC().Format("20060102_150405.000"),
+		Created: now.UTC(),
+	}
+	symbols, err := e.snapshotStrategies(snap)
+	e.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// the exchange is not called while holding the lock
+	if x != nil {
+		snap.Exchange = x.AdapterName()
+		bals, err := x.GetBalances(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("snapshot balances: %w", err)
+		}
+		snap.Balances = bals
+	}
+
+	for symbol := range symbols {
+		if x != nil {
+			pos, err := x.GetPosition(ctx, symbol)
+			if err != nil {
+				return nil, fmt.Errorf("snapshot position %s: %w", symbol, err)
+			}
+			snap.Positions = append(snap.Positions, pos)
+		}
+		if db != nil {
+			orders, err := db.LoadOpenOrders(symbol, now)
+			if err != nil {
+				return nil, fmt.Errorf("snapshot open orders %s: %w", symbol, err)
+			}
+			for _, o := range orders {
+				snap.OpenOrders = append(snap.OpenOrders, orderFromRecord(o))
+			}
+		}
+	}
+
+	snap.StrategyPositions = e.positions.Positions()
+
+	if db != nil {
+		data, err := json.Marshal(snap)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.SaveSnapshot(snap.ID, data); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("Engine snapshot %s saved", snap.ID)
+	return snap, nil
+}
+
+// snapshotStrategies adds the allocation and state of each strategy to
+// snap and returns the symbols they trade. Callers must hold e.lock.
+func (e *Engine) snapshotStrategies(snap *Snapshot) (map[string]bool, error) {
+	symbols := map[string]bool{}
+	for _, s := range e.strategies {
+		ss := StrategySnapshot{Name: s.Name(), Symbol: s.Symbol(), AccountUSD: s.AccountBalUSD()}
+		if st, ok := s.(StatefulStrategy); ok {
+			data, err := st.SaveState()
+			if err != nil {
+				return nil, fmt.Errorf("snapshot %s: %w", s.Name(), err)
+			}
+			ss.State = data
+		}
+		snap.Strategies = append(snap.Strategies, ss)
+		for _, symbol := range StrategySymbols(s) {
+			symbols[symbol] = true
+		}
+	}
+	return symbols, nil
+}
+
+// Restore loads snapshot id from the store ("" or "latest" for the newest one).
+// Strategy state and allocations are restored; positions and open orders are
+// checked against the exchange and store, and missing open orders are re-recorded.
+func (e *Engine) Restore(ctx context.Context, id string) (*Snapshot, error) {
+	if e.store == nil {
+		return nil, fmt.Errorf("restore needs a store")
+	}
+	data, err := e.store.LoadSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+
+	e.lock.Lock()
+	err = e.restoreStrategies(&snap)
+	x, now := e.exchange, e.clock.Now()
+	e.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// the exchange is not called while holding the lock
+	if x != nil {
+		for _, p := range snap.Positions {
+			cur, err := x.GetPosition(ctx, p.Symbol)
+			if err != nil {
+				log.Printf("restore: could not read %s position: %v", p.Symbol, err)
+				continue
+			}
+			if !cur.Quantity.Equal(p.Quantity) {
+				log.Printf("restore: %s position is %s on %s, snapshot had %s",
+					p.Symbol, cur.Quantity, x.AdapterName(), p.Quantity)
+			}
+		}
+	}
+
+	for _, o := range snap.OpenOrders {
+		open, err := e.store.LoadOpenOrders(o.Symbol, now)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, r := range open {
+			if r.ID == o.ID {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		if err := e.store.SaveOrder(o.ID, o.Symbol, string(o.Side), string(o.Type),
+			o.Price.InexactFloat64(), o.FilledPrice.InexactFloat64(), o.Quantity.InexactFloat64(),
+			false, o.TraceID, o.Strategy); err != nil {
+			return nil, err
+		}
+		if o.FilledQty.IsPositive() {
+			if err := e.store.UpdateOrderFill(o.ID, string(OrderStatusPartiallyFilled), o.FilledQty.InexactFloat64(), o.FilledPrice.InexactFloat64()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	log.Printf("Engine restored from snapshot %s", snap.ID)
+	return &snap, nil
+}
+
+// restoreStrategies gives the strategies their allocation and state in
+// snap and the positions it tracked. Callers must hold e.lock.
+func (e *Engine) restoreStrategies(snap *Snapshot) error {
+	byName := map[string]StrategySnapshot{}
+	for _, ss := range snap.Strategies {
+		byName[ss.Name] = ss
+	}
+	for _, s := range e.strategies {
+		ss, ok := byName[s.Name()]
+		if !ok {
+			log.Printf("snapshot %s has no state for strategy %s", snap.ID, s.Name())
+			continue
+		}
+		s.SetAccountUSD(ss.AccountUSD)
+		if st, ok := s.(StatefulStrategy); ok && len(ss.State) > 0 {
+			if err := st.LoadState(ss.State); err != nil {
+				return fmt.Errorf("restore %s: %w", s.Name(), err)
+			}
+		}
+	}
+	if snap.StrategyPositions != nil {
+		e.positions.Restore(snap.StrategyPositions)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// balanceExchange reads positions from its balances the way spot adapters
+// do, GetPosition calling GetBalances which takes the adapter lock. It
+// records whether it was called while the engine lock was held.
+type balanceExchange struct {
+	*testExchange
+	bmt      sync.Mutex
+	engine   *Engine
+	underMt  bool
+	balances map[string]decimal.Decimal
+}
+
+func (x *balanceExchange) GetBalances(ctx context.Context) (map[string]decimal.Decimal, error) {
+	x.bmt.Lock()
+	defer x.bmt.Unlock()
+	if x.engine.lock.TryLock() {
+		x.engine.lock.Unlock()
+	} else {
+		x.underMt = true
+	}
+	out := make(map[string]decimal.Decimal, len(x.balances))
+	for k, v := range x.balances {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (x *balanceExchange) GetPosition(ctx context.Context, symbol string) (Position, error) {
+	bals, err := x.GetBalances(ctx)
+	if err != nil {
+		return Position{Symbol: symbol}, err
+	}
+	return Position{Symbol: symbol, Quantity: bals["BTC"]}, nil
+}
+
+// within fails t unless f returns within a few seconds
+func within(t *testing.T, what string, f func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s did not return", what)
+	}
+}
+
+func TestSnapshotRestoreReadPositionsOutsideEngineLock(t *testing.T) {
+	db, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "engine.db"), store.SQLiteConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	e := NewEngine()
+	e.SetClock(NewSimClock(simStart))
+	x := &balanceExchange{testExchange: newTestExchange(), engine: e,
+		balances: map[string]decimal.Decimal{"BTC": dec("0.5"), "USDT": dec("1000")}}
+	e.SetExchangeAdapter(x)
+	e.SetStore(db)
+	if err := e.AddStrategy(&testStrategy{name: "s", symbol: "BTCUSDT"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var snap *Snapshot
+	within(t, "Snapshot", func() { snap, err = e.Snapshot(ctx) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Positions) != 1 || !snap.Positions[0].Quantity.Equal(dec("0.5")) {
+		t.Fatalf("snapshot positions %+v, want 0.5 BTCUSDT", snap.Positions)
+	}
+
+	var restored *Snapshot
+	within(t, "Restore", func() { restored, err = e.Restore(ctx, snap.ID) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.ID != snap.ID {
+		t.Fatalf("restored %s, want %s", restored.ID, snap.ID)
+	}
+	if x.underMt {
+		t.Fatal("exchange called while the engine lock was held")
+	}
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"log"
+
+	"github.com/shopspring/decimal"
+)
+
+// AlgoSplit works an order over the max order size of its symbol as
+// sequential child orders no larger than the max
+const AlgoSplit = "split"
+
+// SetMaxOrderSize caps the quantity of a single order on symbol. Orders over
+// it are split into child orders of at most max, each placed once the one
+// before it is done, under a parent order listed with the algo orders. Zero
+// removes the cap.
+func (om *OrderManager) SetMaxOrderSize(symbol string, max decimal.Decimal) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	if !max.IsPositive() {
+		delete(om.maxSize, symbol)
+		return
+	}
+	om.maxSize[symbol] = max
+}
+
+// maxOrderSize returns the cap on the quantity of a single order on symbol
+func (om *OrderManager) maxOrderSize(symbol string) (decimal.Decimal, bool) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	max, ok := om.maxSize[symbol]
+	return max, ok
+}
+
+// startSplit registers o as a parent order and places its children in the background
+func (om *OrderManager) startSplit(ctx context.Context, o Order, max decimal.Decimal) (Order, error) {
+	om.mt.Lock()
+	prices := om.prices
+	om.mt.Unlock()
+	if o.Type == OrderMarket && !o.Price.IsPositive() && prices != nil {
+		o.Price, _ = prices.LastPrice(o.Symbol)
+	}
+	a, ctx, dup := om.newParent(ctx, AlgoSplit, o, 0)
+	if dup {
+		return a, nil
+	}
+	go om.workSplit(ctx, a.ID, a, max)
+	log.Printf("%s %s %s %s split into orders of at most %s as %s", o.Strategy, o.Side, o.Quantity, o.Symbol, max, a.ID)
+	return a, nil
+}
+
+// workSplit places the children of parent id one at a time until o is
+// filled. A child that does not fill in full stops the split; one still
+// resting when the split is stopped is canceled.
+func (om *OrderManager) workSplit(ctx context.Context, id string, o Order, max decimal.Decimal) {
+	om.mt.Lock()
+	settled := om.algos[id].settled
+	om.mt.Unlock()
+	for placed, n := decimal.Zero, 1; placed.LessThan(o.Quantity); n++ {
+		child := Order{Symbol: o.Symbol, Side: o.Side, Type: o.Type, Quantity: decimal.Min(max, o.Quantity.Sub(placed)), Strategy: o.Strategy, ClientOrderID: newClientOrderID(),
+			TimeInForce: o.TimeInForce, ExpireAt: o.ExpireAt}
+		if o.Type == OrderLimit {
+			child.Price = o.Price
+		}
+		om.mt.Lock()
+		om.algoChildren[child.ClientOrderID] = id
+		om.mt.Unlock()
+		// a child that filled at once left a signal behind, it is not this one's
+		select {
+		case <-settled:
+		default:
+		}
+		r, err := om.Submit(ctx, child)
+		if err != nil {
+			log.Printf("split order %s child %d of %s not placed: %v", id, n, child.Quantity, err)
+			om.mt.Lock()
+			delete(om.algoChildren, child.ClientOrderID)
+			om.mt.Unlock()
+			om.endAlgo(id, true, true)
+			return
+		}
+		for {
+			status, _ := om.childStatus(id, r.ClientOrderID)
+			if status.Final() {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				om.endAlgo(id, true, false)
+				om.cancelChild(id, r)
+				return
+			case <-settled:
+			}
+		}
+		if status, _ := om.childStatus(id, r.ClientOrderID); status != OrderStatusFilled {
+			log.Printf("split order %s stopped, child %d %s did not fill", id, n, r.ID)
+			om.endAlgo(id, true, false)
+			return
+		}
+		placed = placed.Add(r.Quantity)
+	}
+	om.endAlgo(id, false, false)
+}
+
+// childStatus returns the latest status of the child of parent id with
+// clientOrderID
+func (om *OrderManager) childStatus(id, clientOrderID string) (OrderStatus, bool) {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	for _, c := range om.algos[id].Children {
+		if c.ClientOrderID == clientOrderID {
+			return c.Status, true
+		}
+	}
+	return "", false
+}
+
+// cancelChild cancels the child c of the stopped parent id if it still rests
+// on the exchange
+func (om *OrderManager) cancelChild(id string, c Order) {
+	if status, _ := om.childStatus(id, c.ClientOrderID); status.Final() {
+		return
+	}
+	if err := om.currentExchange().CancelOrder(context.Background(), c.Symbol, c.ID); err != nil {
+		log.Printf("split order %s: cancel child %s: %v", id, c.ID, err)
+	}
+}
@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// SetStateInterval makes the engine save the state of every stateful
+// strategy to the store every d while it runs, zero saves it on shutdown
+// only. Set the store first.
+func (e *Engine) SetStateInterval(d time.Duration) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.stateEvery = d
+}
+
+// SaveStrategyStates stores the state of every stateful strategy under its
+// name, replacing the state it saved before
+func (e *Engine) SaveStrategyStates() error {
+	e.lock.Lock()
+	db, strategies, now := e.store, append([]Strategy(nil), e.strategies...), e.clock.Now()
+	e.lock.Unlock()
+	if db == nil {
+		return nil
+	}
+	var errs []error
+	for _, s := range strategies {
+		st, ok := s.(StatefulStrategy)
+		if !ok {
+			continue
+		}
+		data, err := st.SaveState()
+		if err == nil {
+			err = db.SaveStrategyState(s.Name(), data, now)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LoadStrategyStates restores every stateful strategy from the state it
+// saved last and, when it needs a history, warms it up on the candles
+// stored since. Strategies without a saved state start cold. Call it
+// before Start; Recover does the same on its own.
+func (e *Engine) LoadStrategyStates() ([]string, error) {
+	if e.store == nil {
+		return nil, fmt.Errorf("strategy state needs a store")
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	restored := map[string]time.Time{}
+	if err := e.loadStrategyStates(restored); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, s := range e.strategies {
+		since, ok := restored[s.Name()]
+		if !ok {
+			continue
+		}
+		names = append(names, s.Name())
+		if _, err := e.warmUpSince(s, since); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// loadStrategyStates loads the saved state of each stateful strategy that
+// restored has no newer state for, and sets restored to when it was saved.
+// Callers must hold e.lock.
+func (e *Engine) loadStrategyStates(restored map[string]time.Time) error {
+	saved, err := e.store.LoadStrategyStates()
+	if err != nil {
+		return fmt.Errorf("load strategy state: %w", err)
+	}
+	byName := map[string]int{}
+	for i, st := range saved {
+		byName[st.Name] = i
+	}
+	for _, s := range e.strategies {
+		st, ok := s.(StatefulStrategy)
+		if !ok {
+			continue
+		}
+		i, ok := byName[s.Name()]
+		if !ok || len(saved[i].State) == 0 {
+			continue
+		}
+		if at, ok := restored[s.Name()]; ok && !saved[i].Saved.After(at) {
+			continue
+		}
+		if err := st.LoadState(saved[i].State); err != nil {
+			return fmt.Errorf("load %s state: %w", s.Name(), err)
+		}
+		restored[s.Name()] = saved[i].Saved
+		log.Printf("Strategy %s state saved %s loaded", s.Name(), saved[i].Saved.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// warmUpSince warms s up on its stored candles newer than since, the ones
+// its state already holds, or on all it needs for a zero since. It returns
+// how many candles s took. Callers must hold e.lock.
+func (e *Engine) warmUpSince(s Strategy, since time.Time) (int, error) {
+	ws, ok := s.(WarmUpStrategy)
+	if !ok {
+		return 0, nil
+	}
+	rows, err := e.store.LoadRecentCandles(s.Symbol(), candleInterval(s), ws.WarmUpCandles())
+	if err != nil {
+		return 0, fmt.Errorf("%s candles: %w", s.Name(), err)
+	}
+	candles := StoredCandles(rows)
+	if !since.IsZero() {
+		// the store keeps times to the second, that second is taken to be in the state
+		since = since.Truncate(time.Second)
+		i := 0
+		for i < len(candles) && !candles[i].Time.After(since) {
+			i++
+		}
+		candles = candles[i:]
+	}
+	if len(candles) == 0 {
+		return 0, nil
+	}
+	ws.WarmUp(candles)
+	e.prices.UpdateCandle(s.Symbol(), candles[len(candles)-1])
+	return len(candles), nil
+}
+
+// saveStates saves the strategies' state every interval until ctx ends
+func (e *Engine) saveStates(ctx context.Context, every time.Duration) {
+	t := e.clock.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			if err := e.SaveStrategyStates(); err != nil {
+				log.Printf("strategy state: %v", err)
+			}
+		}
+	}
+}
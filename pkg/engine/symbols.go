@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// SymbolInfo holds the trading rules an exchange sets for a symbol. Zero
+// fields put no constraint on orders.
+type SymbolInfo struct {
+	Symbol         string          `json:"symbol"`
+	TickSize       decimal.Decimal `json:"tick_size"`    // price increment
+	StepSize       decimal.Decimal `json:"step_size"`    // quantity increment, the lot size
+	MinQty         decimal.Decimal `json:"min_qty"`      // smallest quantity accepted
+	MinNotional    decimal.Decimal `json:"min_notional"` // smallest price times quantity accepted
+	PricePrecision int32           `json:"price_precision"`
+	QtyPrecision   int32           `json:"qty_precision"`
+}
+
+// SymbolInfoProvider is implemented by exchange adapters that publish the
+// trading rules of their symbols. The order manager rounds and validates
+// orders against them before they are placed.
+type SymbolInfoProvider interface {
+	GetSymbolInfo(ctx context.Context, symbol string) (SymbolInfo, error)
+}
+
+// Precision is the number of decimals of an increment such as a tick or
+// step size, 0.001 having 3
+func Precision(increment decimal.Decimal) int32 {
+	if !increment.IsPositive() {
+		return 0
+	}
+	var n int32
+	for !increment.Equal(increment.Truncate(n)) {
+		n++
+	}
+	return n
+}
+
+// Normalize rounds the quantity of o down to the step size and the price of
+// a limit order to the tick size, down for buys and up for sells so it is
+// never more aggressive than asked. It fails with ErrMinNotional when what
+// is left is below the minimum quantity or notional.
+func (si SymbolInfo) Normalize(o Order) (Order, error) {
+	o.Quantity = roundStep(o.Quantity, si.StepSize, false)
+	if o.Type == OrderLimit {
+		o.Price = roundStep(o.Price, si.TickSize, o.Side == SideSell)
+		if !o.Price.IsPositive() {
+			return o, fmt.Errorf("%s price rounds to zero at tick size %s", o.Symbol, si.TickSize)
+		}
+	}
+	if !o.Quantity.IsPositive() {
+		return o, fmt.Errorf("%s quantity rounds to zero at step size %s", o.Symbol, si.StepSize)
+	}
+	if si.MinQty.IsPositive() && o.Quantity.LessThan(si.MinQty) {
+		return o, fmt.Errorf("%w: %s quantity %s is below the minimum of %s", ErrMinNotional, o.Symbol, o.Quantity, si.MinQty)
+	}
+	if notional := o.Quantity.Mul(o.Price); si.MinNotional.IsPositive() && o.Price.IsPositive() && notional.LessThan(si.MinNotional) {
+		return o, fmt.Errorf("%w: %s notional %s is below the minimum of %s", ErrMinNotional, o.Symbol, notional.StringFixed(2), si.MinNotional)
+	}
+	return o, nil
+}
+
+// roundStep rounds v to a multiple of step, down unless up is set. A zero
+// step leaves v as is.
+func roundStep(v, step decimal.Decimal, up bool) decimal.Decimal {
+	if !step.IsPositive() {
+		return v
+	}
+	n := v.Div(step)
+	if up {
+		n = n.Ceil()
+	} else {
+		n = n.Floor()
+	}
+	return n.Mul(step).Truncate(Precision(step))
+}
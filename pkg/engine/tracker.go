@@ -0,0 +1,380 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SetPollInterval sets how often open orders are checked on the exchange
+func (om *OrderManager) SetPollInterval(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	om.pollEvery = d
+}
+
+// OpenOrders returns the orders still being tracked
+func (om *OrderManager) OpenOrders() []Order {
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	out := make([]Order, 0, len(om.open))
+	for _, o := range om.open {
+		out = append(out, o)
+	}
+	return out
+}
+
+// Reconcile lists the orders resting on the exchange for symbol and starts
+// tracking the ones the order manager does not know about, such as orders
+// left working by an earlier run. It returns what the exchange reported.
+func (om *OrderManager) Reconcile(ctx context.Context, symbol string) ([]Order, error) {
+	resting, err := om.currentExchange().GetOpenOrders(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	for _, o := range resting {
+		if _, ok := om.open[o.ID]; ok || o.Status.Final() {
+			continue
+		}
+		if o.Status == "" {
+			o.Status = OrderStatusNew
+		}
+		om.open[o.ID] = o
+		log.Printf("Tracking order %s %s %s %s resting on %s", o.ID, o.Side, o.Remaining(), o.Symbol, om.exchange.AdapterName())
+	}
+	return resting, nil
+}
+
+// Adopt starts tracking o, an order an earlier run placed and left open in
+// the store, so polling settles it with whatever the exchange did since
+// and a GTT order is still canceled at its expiry. An order reconciled
+// from the exchange already gets the time in force stored with o.
+func (om *OrderManager) Adopt(o Order) {
+	if o.Status == "" {
+		o.Status = OrderStatusNew
+	}
+	if o.Status.Final() {
+		return
+	}
+	om.mt.Lock()
+	defer om.mt.Unlock()
+	cur, ok := om.open[o.ID]
+	if !ok {
+		om.open[o.ID] = o
+		return
+	}
+	if cur.TimeInForce == "" && cur.ExpireAt.IsZero() {
+		cur.TimeInForce, cur.ExpireAt = o.TimeInForce, o.ExpireAt
+		om.open[o.ID] = cur
+	}
+}
+
+// Refresh asks the exchange for the status of the tracked order o and
+// applies it, as when the exchange no longer lists o as open. An order
+// that filled since the last poll settles with its fill, not as canceled.
+func (om *OrderManager) Refresh(ctx context.Context, o Order) (Order, error) {
+	ex := om.currentExchange()
+	q, ok := ex.(OrderQuerier)
+	if !ok {
+		return o, fmt.Errorf("%s cannot report the status of order %s", ex.AdapterName(), o.ID)
+	}
+	cur, err := q.GetOrder(ctx, o.Symbol, o.ID)
+	if err != nil {
+		return o, err
+	}
+	om.applyQueried(o.ID, cur)
+	return cur, nil
+}
+
+// applyQueried applies cur, what an order query answered about the
+// tracked order id
+func (om *OrderManager) applyQueried(id string, cur Order) {
+	om.updateMt.Lock()
+	defer om.updateMt.Unlock()
+	om.mt.Lock()
+	prev, ok := om.open[id]
+	om.mt.Unlock()
+	// a pushed change may have overtaken the query
+	if ok && !cur.FilledQty.LessThan(prev.FilledQty) {
+		om.transition(prev, cur)
+	}
+}
+
+// streamPollEvery is how often tracked orders are polled while the
+// exchange pushes their changes, catching any the stream missed
+const streamPollEvery = time.Minute
+
+// TrackOrders follows open orders until ctx is done, moving them through
+// NEW -> PARTIALLY_FILLED -> FILLED/CANCELED/REJECTED. Exchanges that push
+// order changes are polled rarely, others every poll interval.
+func (om *OrderManager) TrackOrders(ctx context.Context) {
+	om.mt.Lock()
+	every, clock := om.pollEvery, om.clock
+	om.mt.Unlock()
+	om.streamAccount(ctx)
+
+	tick := clock.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C():
+			om.releaseQueued(ctx, clock.Now())
+			om.mt.Lock()
+			pushed := om.streaming && clock.Now().Sub(om.polledAt) < streamPollEvery
+			om.mt.Unlock()
+			if pushed {
+				om.expireOrders(ctx)
+				continue
+			}
+			om.PollOrders(ctx)
+		}
+	}
+}
+
+// streamAccount applies the order and balance changes the exchange pushes,
+// when it pushes them, until ctx is done
+func (om *OrderManager) streamAccount(ctx context.Context) {
+	ex := om.currentExchange()
+	s, ok := ex.(AccountStreamer)
+	if !ok {
+		return
+	}
+	updates, err := s.SubscribeAccount(ctx)
+	if err != nil {
+		log.Printf("%s account stream unavailable, polling orders: %v", ex.AdapterName(), err)
+		return
+	}
+	om.mt.Lock()
+	om.streaming = true
+	om.mt.Unlock()
+	go func() {
+		defer func() {
+			om.mt.Lock()
+			om.streaming = false
+			om.mt.Unlock()
+		}()
+		for u := range updates {
+			om.applyAccountUpdate(ctx, u)
+		}
+	}()
+}
+
+// applyAccountUpdate applies one change pushed by the exchange
+func (om *OrderManager) applyAccountUpdate(ctx context.Context, u AccountUpdate) {
+	if u.Resync {
+		om.PollOrders(ctx)
+	}
+	if u.Order != nil {
+		om.updateMt.Lock()
+		om.mt.Lock()
+		prev, ok := om.open[u.Order.ID]
+		if !ok {
+			om.holdEarly(*u.Order)
+		}
+		om.mt.Unlock()
+		if ok {
+			om.transition(prev, *u.Order)
+		}
+		om.updateMt.Unlock()
+	}
+	if len(u.Balances) > 0 {
+		om.mt.Lock()
+		bus := om.events
+		om.mt.Unlock()
+		if bus != nil {
+			bus.Publish(Event{Type: EventBalance, Balances: u.Balances})
+		}
+	}
+}
+
+// earlyUpdateTTL is how long a pushed change of an order not tracked yet
+// is held for it, the stream can beat the answer to the placement
+const earlyUpdateTTL = 30 * time.Second
+
+// earlyUpdate is a pushed change of an order not tracked yet
+type earlyUpdate struct {
+	order Order
+	at    time.Time
+}
+
+// holdEarly keeps o, pushed before its order was tracked, until the order
+// is, dropping what was held too long for an order never tracked. Callers
+// must hold om.mt.
+func (om *OrderManager) holdEarly(o Order) {
+	now := om.clock.Now()
+	for id, u := range om.early {
+		if now.Sub(u.at) > earlyUpdateTTL {
+			delete(om.early, id)
+		}
+	}
+	om.early[o.ID] = earlyUpdate{order: o, at: now}
+}
+
+// applyEarly applies the change pushed for order id before it was
+// tracked. It runs where updateMt may already be held, as when a bracket
+// leg is placed from inside a transition, so it does not take it.
+func (om *OrderManager) applyEarly(id string) {
+	om.mt.Lock()
+	u, held := om.early[id]
+	delete(om.early, id)
+	prev, ok := om.open[id]
+	om.mt.Unlock()
+	// a change pushed since the order was tracked may have overtaken it
+	if held && ok && !u.order.FilledQty.LessThan(prev.FilledQty) {
+		om.transition(prev, u.order)
+	}
+}
+
+// PollOrders checks every tracked order on the exchange once and cancels
+// the expired ones. Backtests call it after each candle instead of running
+// TrackOrders.
+func (om *OrderManager) PollOrders(ctx context.Context) {
+	om.expireOrders(ctx)
+	q, ok := om.currentExchange().(OrderQuerier)
+	if !ok {
+		return
+	}
+	breaker := om.breaker()
+	om.mt.Lock()
+	om.polledAt = om.clock.Now()
+	om.mt.Unlock()
+	for _, o := range om.OpenOrders() {
+		cur, err := q.GetOrder(ctx, o.Symbol, o.ID)
+		breaker.record(err)
+		if err != nil {
+			log.Printf("order %s status check failed: %v", o.ID, err)
+			continue
+		}
+		om.applyQueried(o.ID, cur)
+	}
+}
+
+// transition applies the exchange's view cur of a tracked order prev
+func (om *OrderManager) transition(prev, cur Order) {
+	// exchanges only report what they know, keep what the engine knows
+	cur.ID, cur.Symbol, cur.Side, cur.Type = prev.ID, prev.Symbol, prev.Side, prev.Type
+	cur.Strategy, cur.TraceID, cur.Created = prev.Strategy, prev.TraceID, prev.Created
+	cur.ClientOrderID = prev.ClientOrderID
+	cur.TimeInForce, cur.ExpireAt = prev.TimeInForce, prev.ExpireAt
+	if !cur.Quantity.IsPositive() {
+		cur.Quantity = prev.Quantity
+	}
+	if !cur.Price.IsPositive() {
+		cur.Price = prev.Price
+	}
+	if cur.Status == "" {
+		cur.Status = prev.Status
+	}
+	if cur.Fee.LessThan(prev.Fee) {
+		// some order queries report no fees, keep the ones already charged
+		cur.Fee = prev.Fee
+	}
+	if cur.Status == prev.Status && cur.FilledQty.Equal(prev.FilledQty) {
+		return
+	}
+	cur.Filled = cur.Status == OrderStatusFilled
+
+	om.mt.Lock()
+	sc := om.spans[cur.ID]
+	if cur.Status.Final() {
+		delete(om.open, cur.ID)
+		delete(om.spans, cur.ID)
+	} else {
+		om.open[cur.ID] = cur
+	}
+	bus := om.events
+	om.mt.Unlock()
+
+	// the update joins the trace of the submit, so signal to fill is one trace
+	ctx, span := telemetry.Tracer().Start(trace.ContextWithRemoteSpanContext(context.Background(), sc), "order.update",
+		trace.WithAttributes(
+			attribute.String("order_id", cur.ID),
+			attribute.String("status", string(cur.Status)),
+			attribute.String("filled_qty", cur.FilledQty.String()),
+		))
+	defer span.End()
+	if cur.Status.Final() {
+		om.forget(cur.ID)
+	}
+
+	log.Printf("Order %s %s -> %s (filled %s/%s)", cur.ID, prev.Status, cur.Status, cur.FilledQty, cur.Quantity)
+	if om.db != nil {
+		_, ss := telemetry.Tracer().Start(ctx, "store.update_order")
+		if err := om.db.UpdateOrderFill(cur.ID, string(cur.Status), cur.FilledQty.InexactFloat64(), cur.FilledPrice.InexactFloat64()); err != nil {
+			log.Printf("failed to persist order %s status: %v", cur.ID, err)
+			ss.RecordError(err)
+			ss.SetStatus(codes.Error, err.Error())
+		}
+		ss.End()
+	}
+	om.algoUpdate(prev, cur)
+	om.bracketUpdate(ctx, prev, cur)
+	if err := om.recordFill(ctx, prev, cur); err != nil {
+		log.Printf("failed to persist fill of order %s: %v", cur.ID, err)
+		span.RecordError(err)
+	}
+	if bus != nil {
+		bus.Publish(Event{Type: EventOrderUpdated, Order: cur})
+	}
+}
+
+// recordFill stores and publishes what executed between prev and cur.
+// FilledPrice is the average over the whole order, so the price of this
+// execution is backed out of the two averages.
+func (om *OrderManager) recordFill(ctx context.Context, prev, cur Order) error {
+	qty := cur.FilledQty.Sub(prev.FilledQty)
+	if !qty.IsPositive() {
+		return nil
+	}
+	fill := cur
+	fill.Quantity = qty
+	fill.FilledPrice = cur.FilledPrice
+	if prev.FilledQty.IsPositive() {
+		fill.FilledPrice = cur.FilledQty.Mul(cur.FilledPrice).Sub(prev.FilledQty.Mul(prev.FilledPrice)).DivRound(qty, 8)
+	}
+	fill.Fee = cur.Fee.Sub(prev.Fee)
+
+	om.mt.Lock()
+	bus := om.events
+	om.mt.Unlock()
+	if bus != nil {
+		bus.Publish(Event{Type: EventOrderFilled, Order: fill})
+	}
+
+	if om.db == nil {
+		return nil
+	}
+	tradeID := cur.ID + "_trade"
+	if !qty.Equal(cur.Quantity) {
+		tradeID += "_" + cur.FilledQty.String()
+	}
+	_, span := telemetry.Tracer().Start(ctx, "store.save_trade", trace.WithAttributes(attribute.String("trade_id", tradeID)))
+	defer span.End()
+	err := om.db.SaveTrade(
+		tradeID,
+		cur.ID,
+		cur.Symbol,
+		string(cur.Side),
+		fill.FilledPrice.InexactFloat64(),
+		qty.InexactFloat64(),
+		fill.Fee.InexactFloat64(),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
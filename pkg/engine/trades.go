@@ -0,0 +1,26 @@
+package engine
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoTradeStream is returned by exchange adapters that cannot stream trades
+var ErrNoTradeStream = errors.New("trade stream not supported")
+
+// Trade is one execution on the exchange's public tape
+type Trade struct {
+	Symbol string    `json:"symbol"`
+	Price  float64   `json:"price"`
+	Size   float64   `json:"size"`
+	Side   Side      `json:"side"` // side of the taker
+	Time   time.Time `json:"time"`
+}
+
+// TickStrategy is implemented by strategies that react to every trade of
+// their symbol. OnTrade and OnCandle are called from the same goroutine, so
+// they never run at once.
+type TickStrategy interface {
+	Strategy
+	OnTrade(t Trade)
+}
@@ -3,58 +3,147 @@ package exchange
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/secrets"
 	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// AlpacaDataURL is the market data API, bars are served there rather than
+// by the live or paper trading API
+const AlpacaDataURL = "https://data.alpaca.markets"
+
+// Stock bar feeds: IEX is free, SIP covers every US exchange and needs a
+// market data subscription
+const (
+	AlpacaFeedIEX = "iex"
+	AlpacaFeedSIP = "sip"
 )
 
 type AlpacaAdapter struct {
-	key     string
-	secret  string
+	creds   *secrets.Credentials
 	baseURL string
+	dataURL string
+	feed    string
 	client  *http.Client
 	mt      sync.Mutex
-	db      *store.SQLiteStore
+	db      store.Store
+	limit   *limiter
+	priceSource
 }
 
-func NewAlpacaAdapter(key, secret, base string, db *store.SQLiteStore) (engine.ExchangeAdapter, error) {
+// alpacaRateLimit is the requests Alpaca allows an API key a minute
+var alpacaRateLimit = RateLimit{Capacity: 200, Window: time.Minute, MaxWait: 10 * time.Second}
+
+func NewAlpacaAdapter(creds *secrets.Credentials, base string, db store.Store) (engine.ExchangeAdapter, error) {
 	return &AlpacaAdapter{
-		key:     key,
-		secret:  secret,
+		creds:   creds,
 		baseURL: base,
+		dataURL: AlpacaDataURL,
+		feed:    AlpacaFeedIEX,
 		client:  &http.Client{Timeout: 15 * time.Second},
 		db:      db,
+		limit:   newLimiter("alpaca", alpacaRateLimit),
 	}, nil
 }
 
+// SetRateLimit changes the request budget, zero fields keep Alpaca's limits
+func (a *AlpacaAdapter) SetRateLimit(cfg RateLimit) {
+	a.limit.set(cfg)
+}
+
+// SetDataURL points market data requests at url, empty keeps the current one
+func (a *AlpacaAdapter) SetDataURL(url string) {
+	if url != "" {
+		a.dataURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// SetFeed selects the feed of stock bars, iex or sip, empty keeps the current one
+func (a *AlpacaAdapter) SetFeed(feed string) {
+	if feed != "" {
+		a.feed = strings.ToLower(feed)
+	}
+}
+
+// do sends a request to the trading API
 func (a *AlpacaAdapter) do(ctx context.Context, method, path string, body io.Reader) ([]byte, error) {
-	req, _ := http.NewRequestWithContext(ctx, method, a.baseURL+path, body)
-	req.Header.Set("APCA-API-KEY-ID", a.key)
-	req.Header.Set("APCA-API-SECRET-KEY", a.secret)
+	return a.call(ctx, a.baseURL, method, path, body)
+}
+
+// data sends a GET request to the market data API
+func (a *AlpacaAdapter) data(ctx context.Context, path string) ([]byte, error) {
+	return a.call(ctx, a.dataURL, "GET", path, nil)
+}
+
+func (a *AlpacaAdapter) call(ctx context.Context, host, method, path string, body io.Reader) (out []byte, err error) {
+	status := 0
+	ctx, span := startHTTPSpan(ctx, a.AdapterName(), method, path)
+	defer func() { endHTTPSpan(span, status, err) }()
+
+	key, secret := a.creds.Get()
+	req, _ := http.NewRequestWithContext(ctx, method, host+path, body)
+	req.Header.Set("APCA-API-KEY-ID", key)
+	req.Header.Set("APCA-API-SECRET-KEY", secret)
 	req.Header.Set("Content-Type", "application/json")
 
+	if err := a.limit.wait(ctx, method, path); err != nil {
+		return nil, err
+	}
 	resp, err := a.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, transportError(ctx, "alpaca", err)
 	}
 	defer resp.Body.Close()
+	status = resp.StatusCode
+	if left, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		a.limit.remaining(left)
+	}
+	a.limit.backoff(resp)
 
 	b, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("alpaca error: %s", string(b))
+		return nil, alpacaError(resp, b)
 	}
 
 	return b, nil
 }
 
+// alpacaError sorts an error answer of Alpaca by its status and message
+func alpacaError(resp *http.Response, body []byte) error {
+	var e struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil || e.Message == "" {
+		return answerError("alpaca", resp, engine.ErrRejected, "", string(body))
+	}
+	msg := strings.ToLower(e.Message)
+	var class error
+	switch {
+	case strings.Contains(msg, "insufficient"):
+		class = engine.ErrInsufficientFunds
+	case strings.Contains(msg, "asset") && (strings.Contains(msg, "not found") || strings.Contains(msg, "not tradable") || strings.Contains(msg, "invalid")):
+		class = engine.ErrInvalidSymbol
+	case strings.Contains(msg, "notional") || strings.Contains(msg, "cost basis"):
+		class = engine.ErrMinNotional
+	default:
+		class = engine.ErrRejected
+	}
+	return answerError("alpaca", resp, class, strconv.Itoa(e.Code), e.Message)
+}
+
 // -----------------------------------------------------------------------------
 // Implement ExchangeAdapter interface
 // -----------------------------------------------------------------------------
@@ -64,11 +153,26 @@ func (a *AlpacaAdapter) PlaceOrder(ctx context.Context, o engine.Order) (engine.
 		"symbol":        o.Symbol,
 		"side":          strings.ToLower(string(o.Side)),
 		"type":          "market",
-		"notional":      o.Quantity,
 		"time_in_force": "gtc",
 	}
+	if o.ClientOrderID != "" {
+		req["client_order_id"] = o.ClientOrderID
+	}
+
+	if o.Type == engine.OrderMarket {
+		// quantity is in base units, market orders are sent as quote notional
+		price, err := a.marketPrice(o)
+		if err != nil {
+			return o, err
+		}
+		req["notional"] = o.Quantity.Mul(price).StringFixed(2)
+	}
 
 	if o.Type == engine.OrderLimit {
+		// alpaca has no GTT, those rest as gtc until the order manager cancels them
+		if o.TimeInForce == engine.TimeInForceIOC || o.TimeInForce == engine.TimeInForceFOK {
+			req["time_in_force"] = strings.ToLower(string(o.TimeInForce))
+		}
 		req["type"] = "limit"
 		req["limit_price"] = o.Price
 		delete(req, "notional")
@@ -83,34 +187,251 @@ func (a *AlpacaAdapter) PlaceOrder(ctx context.Context, o engine.Order) (engine.
 		return o, err
 	}
 
-	var out struct {
-		ID        string `json:"id"`
-		FilledQty string `json:"filled_qty"`
-		Status    string `json:"status"`
-	}
+	var out alpacaOrder
 	if err := json.Unmarshal(resp, &out); err != nil {
 		return o, err
 	}
 
 	o.ID = out.ID
 	o.Created = time.Now().Unix()
-	o.Filled = out.Status == "filled"
+	out.apply(&o)
 
 	return o, nil
 }
 
+type alpacaOrder struct {
+	ID             string          `json:"id"`
+	ClientOrderID  string          `json:"client_order_id"`
+	Symbol         string          `json:"symbol"`
+	Side           string          `json:"side"`
+	Type           string          `json:"type"`
+	LimitPrice     decimal.Decimal `json:"limit_price"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Qty            decimal.Decimal `json:"qty"`
+	FilledQty      decimal.Decimal `json:"filled_qty"`
+	FilledAvgPrice decimal.Decimal `json:"filled_avg_price"`
+	Status         string          `json:"status"`
+}
+
+// apply copies the order state Alpaca reports onto o
+func (ao alpacaOrder) apply(o *engine.Order) {
+	o.Status = alpacaOrderStatus(ao.Status)
+	o.Filled = o.Status == engine.OrderStatusFilled
+	o.FilledQty = ao.FilledQty
+	if ao.FilledAvgPrice.IsPositive() {
+		o.FilledPrice = ao.FilledAvgPrice
+	}
+	if ao.Qty.IsPositive() {
+		o.Quantity = ao.Qty
+	} else if o.Filled {
+		// notional orders only learn their size once filled
+		o.Quantity = ao.FilledQty
+	}
+}
+
+// GetSymbolInfo reads the increments and minimum order size of the asset of symbol
+func (a *AlpacaAdapter) GetSymbolInfo(ctx context.Context, symbol string) (engine.SymbolInfo, error) {
+	a.mt.Lock()
+	b, err := a.do(ctx, "GET", "/v2/assets/"+url.PathEscape(symbol), nil)
+	a.mt.Unlock()
+	if err != nil {
+		return engine.SymbolInfo{}, err
+	}
+
+	var asset struct {
+		Tradable          bool            `json:"tradable"`
+		MinOrderSize      decimal.Decimal `json:"min_order_size"`
+		MinTradeIncrement decimal.Decimal `json:"min_trade_increment"`
+		PriceIncrement    decimal.Decimal `json:"price_increment"`
+	}
+	if err := json.Unmarshal(b, &asset); err != nil {
+		return engine.SymbolInfo{}, err
+	}
+	if !asset.Tradable {
+		return engine.SymbolInfo{}, fmt.Errorf("alpaca does not trade %s", symbol)
+	}
+	return engine.SymbolInfo{
+		Symbol:         symbol,
+		TickSize:       asset.PriceIncrement,
+		StepSize:       asset.MinTradeIncrement,
+		MinQty:         asset.MinOrderSize,
+		PricePrecision: engine.Precision(asset.PriceIncrement),
+		QtyPrecision:   engine.Precision(asset.MinTradeIncrement),
+	}, nil
+}
+
+// GetOrder returns the status and executed amount of an order
+func (a *AlpacaAdapter) GetOrder(ctx context.Context, symbol, orderID string) (engine.Order, error) {
+	a.mt.Lock()
+	resp, err := a.do(ctx, "GET", "/v2/orders/"+orderID, nil)
+	a.mt.Unlock()
+	if err != nil {
+		return engine.Order{}, err
+	}
+
+	var out alpacaOrder
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return engine.Order{}, err
+	}
+	o := engine.Order{ID: orderID, Symbol: symbol}
+	out.apply(&o)
+	return o, nil
+}
+
+// alpacaOrderStatus maps Alpaca order states onto the engine lifecycle
+func alpacaOrderStatus(s string) engine.OrderStatus {
+	switch s {
+	case "partially_filled":
+		return engine.OrderStatusPartiallyFilled
+	case "filled":
+		return engine.OrderStatusFilled
+	case "canceled", "expired", "done_for_day", "replaced":
+		return engine.OrderStatusCanceled
+	case "rejected", "suspended":
+		return engine.OrderStatusRejected
+	}
+	// new, accepted, pending_new, pending_cancel and friends are still working
+	return engine.OrderStatusNew
+}
+
 func (a *AlpacaAdapter) AdapterName() string {
 	return "Aplaca"
 }
 
-func (a *AlpacaAdapter) CancelOrder(ctx context.Context, orderID string) error {
+// CanShort implements engine.ShortSeller, equities sell short on a margin
+// account while crypto pairs, written with a slash, trade long only
+func (a *AlpacaAdapter) CanShort(symbol string) bool {
+	return !strings.Contains(symbol, "/")
+}
+
+func (a *AlpacaAdapter) CancelOrder(ctx context.Context, symbol, orderID string) error {
 	a.mt.Lock()
 	defer a.mt.Unlock()
 	_, err := a.do(ctx, "DELETE", "/v2/orders/"+orderID, nil)
 	return err
 }
 
-func (a *AlpacaAdapter) GetBalances(ctx context.Context) (map[string]float64, error) {
+// CancelAllOrders cancels the open orders of symbol one by one, Alpaca only
+// cancels all at once across every symbol
+func (a *AlpacaAdapter) CancelAllOrders(ctx context.Context, symbol string) error {
+	a.mt.Lock()
+	defer a.mt.Unlock()
+	open, err := a.openOrders(ctx, symbol)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, o := range open {
+		if _, err := a.do(ctx, "DELETE", "/v2/orders/"+o.ID, nil); err != nil {
+			errs = append(errs, fmt.Errorf("cancel %s: %w", o.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetOpenOrders returns the orders of symbol still working
+func (a *AlpacaAdapter) GetOpenOrders(ctx context.Context, symbol string) ([]engine.Order, error) {
+	a.mt.Lock()
+	open, err := a.openOrders(ctx, symbol)
+	a.mt.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]engine.Order, 0, len(open))
+	for _, ao := range open {
+		o := engine.Order{
+			ID:            ao.ID,
+			ClientOrderID: ao.ClientOrderID,
+			Symbol:        ao.Symbol,
+			Side:          engine.Side(strings.ToUpper(ao.Side)),
+			Type:          engine.OrderType(strings.ToUpper(ao.Type)),
+			Price:         ao.LimitPrice,
+			Created:       ao.CreatedAt.Unix(),
+		}
+		ao.apply(&o)
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// openOrders lists the open orders of symbol. Callers must hold a.mt.
+func (a *AlpacaAdapter) openOrders(ctx context.Context, symbol string) ([]alpacaOrder, error) {
+	b, err := a.do(ctx, "GET", "/v2/orders?status=open&limit=500&symbols="+url.QueryEscape(symbol), nil)
+	if err != nil {
+		return nil, err
+	}
+	var open []alpacaOrder
+	if err := json.Unmarshal(b, &open); err != nil {
+		return nil, err
+	}
+	return open, nil
+}
+
+// Ping implements engine.HealthChecker by reading the market clock
+func (a *AlpacaAdapter) Ping(ctx context.Context) error {
+	a.mt.Lock()
+	defer a.mt.Unlock()
+	_, err := a.do(ctx, "GET", "/v2/clock", nil)
+	return err
+}
+
+// ServerTime implements engine.TimeSyncer with the market clock
+func (a *AlpacaAdapter) ServerTime(ctx context.Context) (time.Time, error) {
+	a.mt.Lock()
+	b, err := a.do(ctx, "GET", "/v2/clock", nil)
+	a.mt.Unlock()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var clock struct {
+		Timestamp time.Time `json:"timestamp"`
+	}
+	if err := json.Unmarshal(b, &clock); err != nil {
+		return time.Time{}, err
+	}
+	return clock.Timestamp, nil
+}
+
+// Sessions implements engine.MarketCalendar with Alpaca's calendar of the
+// US equity market, which includes the closures the exchanges announce
+func (a *AlpacaAdapter) Sessions(ctx context.Context, from, to time.Time) ([]engine.MarketSession, error) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	q.Set("start", from.In(loc).Format(time.DateOnly))
+	q.Set("end", to.In(loc).Format(time.DateOnly))
+	a.mt.Lock()
+	b, err := a.do(ctx, "GET", "/v2/calendar?"+q.Encode(), nil)
+	a.mt.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var days []struct {
+		Date  string `json:"date"`
+		Open  string `json:"open"`
+		Close string `json:"close"`
+	}
+	if err := json.Unmarshal(b, &days); err != nil {
+		return nil, err
+	}
+	out := make([]engine.MarketSession, 0, len(days))
+	for _, d := range days {
+		open, err := time.ParseInLocation(time.DateOnly+" 15:04", d.Date+" "+d.Open, loc)
+		if err != nil {
+			return nil, fmt.Errorf("alpaca calendar: %w", err)
+		}
+		closed, err := time.ParseInLocation(time.DateOnly+" 15:04", d.Date+" "+d.Close, loc)
+		if err != nil {
+			return nil, fmt.Errorf("alpaca calendar: %w", err)
+		}
+		out = append(out, engine.MarketSession{Open: open, Close: closed})
+	}
+	return out, nil
+}
+
+func (a *AlpacaAdapter) GetBalances(ctx context.Context) (map[string]decimal.Decimal, error) {
 	a.mt.Lock()
 	defer a.mt.Unlock()
 	b, err := a.do(ctx, "GET", "/v2/account", nil)
@@ -126,9 +447,9 @@ func (a *AlpacaAdapter) GetBalances(ctx context.Context) (map[string]float64, er
 		return nil, err
 	}
 
-	cash, _ := strconv.ParseFloat(acct.Cash, 64)
+	cash, _ := decimal.NewFromString(acct.Cash)
 
-	return map[string]float64{
+	return map[string]decimal.Decimal{
 		"USD": cash,
 	}, nil
 }
@@ -150,7 +471,7 @@ func (a *AlpacaAdapter) GetPosition(ctx context.Context, symbol string) (engine.
 		return engine.Position{Symbol: symbol}, err
 	}
 
-	q, _ := strconv.ParseFloat(pos.Qty, 64)
+	q, _ := decimal.NewFromString(pos.Qty)
 
 	return engine.Position{
 		Symbol:   symbol,
@@ -158,53 +479,142 @@ func (a *AlpacaAdapter) GetPosition(ctx context.Context, symbol string) (engine.
 	}, nil
 }
 
+// SubscribeTrades is not supported, bars are polled over REST
+func (a *AlpacaAdapter) SubscribeTrades(ctx context.Context, symbol string) (<-chan engine.Trade, error) {
+	return nil, engine.ErrNoTradeStream
+}
+
+// SubscribeOrderBook is not supported, stock quotes have no depth
+func (a *AlpacaAdapter) SubscribeOrderBook(ctx context.Context, symbol string, depth int) (<-chan engine.OrderBook, error) {
+	return nil, engine.ErrNoOrderBook
+}
+
+// alpacaTimeframe maps a candle interval in seconds to an Alpaca bar timeframe
+func alpacaTimeframe(interval int64) (string, error) {
+	switch {
+	case interval == 7*24*3600:
+		return "1Week", nil
+	case interval == 24*3600:
+		return "1Day", nil
+	case interval > 0 && interval%3600 == 0 && interval/3600 <= 23:
+		return fmt.Sprintf("%dHour", interval/3600), nil
+	case interval > 0 && interval%60 == 0 && interval/60 <= 59:
+		return fmt.Sprintf("%dMin", interval/60), nil
+	}
+	return "", fmt.Errorf("alpaca has no %ds bar timeframe", interval)
+}
+
+// alpacaBar is one bar of the stock or crypto bars endpoints
+type alpacaBar struct {
+	T time.Time `json:"t"`
+	O float64   `json:"o"`
+	H float64   `json:"h"`
+	L float64   `json:"l"`
+	C float64   `json:"c"`
+	V float64   `json:"v"`
+}
+
+// alpacaCrypto reports whether symbol is a crypto pair, which Alpaca writes
+// with a slash as in BTC/USD
+func alpacaCrypto(symbol string) bool {
+	return strings.Contains(symbol, "/")
+}
+
+// bars reads the bars of symbol since start from the market data API, stock
+// bars from the configured feed
+func (a *AlpacaAdapter) bars(ctx context.Context, symbol, timeframe string, start time.Time) ([]alpacaBar, error) {
+	q := url.Values{}
+	q.Set("timeframe", timeframe)
+	q.Set("start", start.UTC().Format(time.RFC3339))
+	q.Set("limit", "1000")
+	if alpacaCrypto(symbol) {
+		q.Set("symbols", symbol)
+		resp, err := a.data(ctx, "/v1beta3/crypto/us/bars?"+q.Encode())
+		if err != nil {
+			return nil, err
+		}
+		var out struct {
+			Bars map[string][]alpacaBar `json:"bars"`
+		}
+		if err := json.Unmarshal(resp, &out); err != nil {
+			return nil, err
+		}
+		return out.Bars[symbol], nil
+	}
+
+	q.Set("feed", a.feed)
+	resp, err := a.data(ctx, "/v2/stocks/"+url.PathEscape(symbol)+"/bars?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Bars []alpacaBar `json:"bars"`
+	}
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return nil, err
+	}
+	return out.Bars, nil
+}
+
+// SubscribeCandles polls the bars of symbol from the market data API, the
+// crypto endpoint for pairs such as BTC/USD and the stock one otherwise.
+// Each bar is sent once when it closes, starting with the last 200. Failed
+// polls are retried with backoff until ctx is done.
 func (a *AlpacaAdapter) SubscribeCandles(ctx context.Context, symbol string, interval int64) (<-chan engine.Candle, error) {
+	timeframe, err := alpacaTimeframe(interval)
+	if err != nil {
+		return nil, err
+	}
 	// Alpaca REST bars polling
 	ch := make(chan engine.Candle, 1024)
-	log.Printf("Subscribing to Candles from %s", a.AdapterName())
+	log.Printf("Subscribing to %s Candles from %s", timeframe, a.AdapterName())
 
 	go func() {
 		defer close(ch)
 
+		span := time.Duration(interval) * time.Second
+		last := time.Now().Add(-200 * span)
+		wait := 3 * time.Second
 		for {
-			url := fmt.Sprintf("/v2/stocks/%s/bars?timeframe=1Min&limit=200", symbol)
-
-			resp, err := a.do(ctx, "GET", url, nil)
+			bars, err := a.bars(ctx, symbol, timeframe, last)
 			if err != nil {
-				return
-			}
-
-			var bars struct {
-				Bars []struct {
-					T string  `json:"t"`
-					O float64 `json:"o"`
-					H float64 `json:"h"`
-					L float64 `json:"l"`
-					C float64 `json:"c"`
-					V float64 `json:"v"`
-				} `json:"bars"`
-			}
-
-			if err := json.Unmarshal(resp, &bars); err != nil {
-				return
+				if ctx.Err() != nil {
+					return
+				}
+				wait = min(2*wait, time.Minute)
+				log.Printf("alpaca: bars of %s: %v, retrying in %s", symbol, err, wait)
+			} else {
+				wait = 3 * time.Second
 			}
 
-			for _, b := range bars.Bars {
-				t, _ := time.Parse(time.RFC3339, b.T)
-				ch <- engine.Candle{
-					Time:   t,
+			now := time.Now()
+			for _, b := range bars {
+				if !b.T.After(last) {
+					continue
+				}
+				if b.T.Add(span).After(now) {
+					// the bar is still forming, it is sent once it closes
+					break
+				}
+				last = b.T
+				select {
+				case ch <- engine.Candle{
+					Time:   b.T,
 					Open:   b.O,
 					High:   b.H,
 					Low:    b.L,
 					Close:  b.C,
 					Volume: b.V,
+				}:
+				case <-ctx.Done():
+					return
 				}
 			}
 
 			select {
 			case <-ctx.Done():
 				return
-			case <-time.After(3 * time.Second):
+			case <-time.After(wait):
 			}
 		}
 	}()
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -17,79 +18,207 @@ import (
 	"time"
 
 	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/secrets"
 	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
 )
 
 type BinanceAdapter struct {
-	key     string
-	secret  string
+	creds   *secrets.Credentials
 	client  *http.Client
 	baseURL string
+	wsURL   string
 	mt      sync.Mutex
-	db      *store.SQLiteStore
+	db      store.Store
+	limit   *limiter
+	clock   binanceClock
+	// timePath serves the server time, the futures API has its own
+	timePath string
+	priceSource
 }
 
-func NewBinanceAdapter(apiKey, apiSecret string, db *store.SQLiteStore) (engine.ExchangeAdapter, error) {
+// binanceRateLimit is the request weight Binance allows an IP a minute and
+// the weight of the endpoints costing more than 1
+var binanceRateLimit = RateLimit{
+	Capacity: 6000,
+	Window:   time.Minute,
+	MaxWait:  10 * time.Second,
+	Weights: map[string]int{
+		"GET /api/v3/order":        4,
+		"GET /api/v3/openOrders":   6,
+		"GET /api/v3/account":      20,
+		"GET /api/v3/exchangeInfo": 20,
+		"GET /api/v3/klines":       2,
+		"/api/v3/userDataStream":   2,
+	},
+}
+
+// the REST API of the live exchange, and the REST API and streams of the
+// spot testnet
+const (
+	binanceURL          = "https://api.binance.com"
+	BinanceTestnetURL   = "https://testnet.binance.vision"
+	BinanceTestnetWSURL = "wss://stream.testnet.binance.vision/ws"
+)
+
+func NewBinanceAdapter(creds *secrets.Credentials, db store.Store) (engine.ExchangeAdapter, error) {
 	return &BinanceAdapter{
-		key:     apiKey,
-		secret:  apiSecret,
+		creds:   creds,
 		client:  &http.Client{Timeout: 15 * time.Second},
-		baseURL: "https://api.binance.com",
+		baseURL: binanceURL,
+		wsURL:   binanceWSURL,
 		db:      db,
+		limit:   newLimiter("binance", binanceRateLimit),
+
+		timePath: "/api/v3/time",
 	}, nil
 }
 
+// SetURLs points the adapter at the REST API base and the WebSocket streams
+// ws, such as the testnet or a mock server. Empty ones keep the current.
+func (b *BinanceAdapter) SetURLs(base, ws string) {
+	if base != "" {
+		b.baseURL = strings.TrimSuffix(base, "/")
+	}
+	if ws != "" {
+		b.wsURL = strings.TrimSuffix(ws, "/")
+	}
+}
+
+// SetRateLimit changes the request weight budget, zero fields keep Binance's limits
+func (b *BinanceAdapter) SetRateLimit(cfg RateLimit) {
+	b.limit.set(cfg)
+}
+
+// do sends req once the rate limit allows, keeping the bucket in step with
+// the weight Binance reports used
+func (b *BinanceAdapter) do(req *http.Request) (*http.Response, error) {
+	if err := b.limit.wait(req.Context(), req.Method, req.URL.Path); err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, transportError(req.Context(), "binance", err)
+	}
+	if used, err := strconv.Atoi(resp.Header.Get("X-MBX-USED-WEIGHT-1M")); err == nil {
+		b.limit.used(used)
+	}
+	b.limit.backoff(resp)
+	return resp, nil
+}
+
+// binanceError sorts an error answer of Binance by the code in its body
+func binanceError(resp *http.Response, body []byte) error {
+	var e struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil || e.Msg == "" {
+		return answerError("binance", resp, engine.ErrRejected, "", string(body))
+	}
+	var class error
+	switch {
+	case e.Code == -1003 || e.Code == -1015: // too many requests, too many new orders
+		class = engine.ErrRateLimited
+	case e.Code == -1001 || e.Code == -1007: // disconnected, backend timeout
+		class = engine.ErrNetworkTimeout
+	case e.Code == -1121: // invalid symbol
+		class = engine.ErrInvalidSymbol
+	case e.Code == -4164 || strings.Contains(e.Msg, "NOTIONAL") || strings.Contains(e.Msg, "LOT_SIZE"):
+		class = engine.ErrMinNotional
+	case e.Code == -2019 || strings.Contains(e.Msg, "insufficient balance"): // futures: margin is insufficient
+		class = engine.ErrInsufficientFunds
+	default:
+		class = engine.ErrRejected
+	}
+	return answerError("binance", resp, class, strconv.Itoa(e.Code), e.Msg)
+}
+
 // --- internal helpers --------------------------------------------------------
 
-func (b *BinanceAdapter) sign(params string) string {
-	h := hmac.New(sha256.New, []byte(b.secret))
+func (b *BinanceAdapter) sign(secret, params string) string {
+	h := hmac.New(sha256.New, []byte(secret))
 	h.Write([]byte(params))
 	return hex.EncodeToString(h.Sum(nil))
 }
 
 func (b *BinanceAdapter) privatePOST(ctx context.Context, path string, data url.Values) ([]byte, error) {
-	data.Set("timestamp", fmt.Sprintf("%d", time.Now().UnixMilli()))
+	return b.private(ctx, "POST", path, data)
+}
+
+func (b *BinanceAdapter) privateGET(ctx context.Context, path string, data url.Values) ([]byte, error) {
+	return b.private(ctx, "GET", path, data)
+}
+
+func (b *BinanceAdapter) privateDELETE(ctx context.Context, path string, data url.Values) ([]byte, error) {
+	return b.private(ctx, "DELETE", path, data)
+}
+
+// private sends a signed request. A timestamp Binance finds outside the
+// recvWindow means its clock moved since the offset was measured, the
+// request is signed again with a fresh one.
+func (b *BinanceAdapter) private(ctx context.Context, method, path string, data url.Values) ([]byte, error) {
+	out, err := b.signed(ctx, method, path, data)
+	var xe *engine.ExchangeError
+	if errors.As(err, &xe) && xe.Code == "-1021" {
+		b.resyncClock()
+		out, err = b.signed(ctx, method, path, data)
+	}
+	return out, err
+}
+
+// signed sends a request signed once, Binance takes the parameters in the query string for every method
+func (b *BinanceAdapter) signed(ctx context.Context, method, path string, data url.Values) (out []byte, err error) {
+	status := 0
+	ctx, span := startHTTPSpan(ctx, b.AdapterName(), method, path)
+	defer func() { endHTTPSpan(span, status, err) }()
+
+	key, secret := b.creds.Get()
+	now, recvWindow := b.signingTime(ctx)
+	data.Set("timestamp", strconv.FormatInt(now.UnixMilli(), 10))
+	if recvWindow > 0 {
+		data.Set("recvWindow", strconv.FormatInt(recvWindow.Milliseconds(), 10))
+	}
 	query := data.Encode()
-	signature := b.sign(query)
+	signature := b.sign(secret, query)
 	query += "&signature=" + signature
 
-	req, _ := http.NewRequestWithContext(ctx, "POST", b.baseURL+path+"?"+query, nil)
-	req.Header.Set("X-MBX-APIKEY", b.key)
+	req, _ := http.NewRequestWithContext(ctx, method, b.baseURL+path+"?"+query, nil)
+	req.Header.Set("X-MBX-APIKEY", key)
 
-	resp, err := b.client.Do(req)
+	resp, err := b.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	status = resp.StatusCode
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("binance error: %s", string(body))
+		return nil, binanceError(resp, body)
 	}
 
 	return body, nil
 }
 
-func (b *BinanceAdapter) privateGET(ctx context.Context, path string, data url.Values) ([]byte, error) {
-	data.Set("timestamp", fmt.Sprintf("%d", time.Now().UnixMilli()))
-	query := data.Encode()
-	signature := b.sign(query)
-	query += "&signature=" + signature
-
-	req, _ := http.NewRequestWithContext(ctx, "GET", b.baseURL+path+"?"+query, nil)
-	req.Header.Set("X-MBX-APIKEY", b.key)
+// public sends an unsigned request for market data
+func (b *BinanceAdapter) public(ctx context.Context, path string, query url.Values) (out []byte, err error) {
+	status := 0
+	ctx, span := startHTTPSpan(ctx, b.AdapterName(), "GET", path)
+	defer func() { endHTTPSpan(span, status, err) }()
 
-	resp, err := b.client.Do(req)
+	req, _ := http.NewRequestWithContext(ctx, "GET", b.baseURL+path+"?"+query.Encode(), nil)
+	resp, err := b.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	status = resp.StatusCode
 
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("binance error: %s", string(body))
+		return nil, binanceError(resp, body)
 	}
-
 	return body, nil
 }
 
@@ -99,53 +228,395 @@ func (a *BinanceAdapter) AdapterName() string {
 	return "Binance"
 }
 
+// QuoteAsset implements engine.QuoteAssetProvider, spot pairs are quoted
+// in USDT
+func (a *BinanceAdapter) QuoteAsset() string { return "USDT" }
+
 func (b *BinanceAdapter) PlaceOrder(ctx context.Context, o engine.Order) (engine.Order, error) {
 
 	val := url.Values{}
 	val.Set("symbol", strings.ToUpper(o.Symbol))
 	val.Set("side", string(o.Side))
 	val.Set("type", string(o.Type))
+	if o.ClientOrderID != "" {
+		val.Set("newClientOrderId", o.ClientOrderID)
+	}
 
 	if o.Type == engine.OrderMarket {
-		// Binance requires quantity, not notional
-		val.Set("quoteOrderQty", fmt.Sprintf("%f", o.Quantity))
+		// quantity is in base units, market orders are sent as quote notional
+		price, err := b.marketPrice(o)
+		if err != nil {
+			return o, err
+		}
+		val.Set("quoteOrderQty", o.Quantity.Mul(price).StringFixed(2))
 	} else {
-		val.Set("quantity", fmt.Sprintf("%f", o.Quantity))
-		val.Set("price", fmt.Sprintf("%f", o.Price))
+		val.Set("quantity", o.Quantity.String())
+		val.Set("price", o.Price.String())
+		val.Set("timeInForce", binanceTimeInForce(o.TimeInForce))
 	}
 	b.mt.Lock()
-
 	body, err := b.privatePOST(ctx, "/api/v3/order", val)
+	b.mt.Unlock()
 	if err != nil {
 		return o, err
 	}
-	b.mt.Unlock()
 
 	var resp struct {
 		OrderID int64  `json:"orderId"`
 		Status  string `json:"status"`
+		Fills   []struct {
+			Price           decimal.Decimal `json:"price"`
+			Qty             decimal.Decimal `json:"qty"`
+			Commission      decimal.Decimal `json:"commission"`
+			CommissionAsset string          `json:"commissionAsset"`
+		} `json:"fills"`
 	}
 	if err := json.Unmarshal(body, &resp); err != nil {
 		return o, err
 	}
 
-	o.ID = fmt.Sprintf("%d", resp.OrderID)
+	o.ID = strconv.FormatInt(resp.OrderID, 10)
 	o.Created = time.Now().Unix()
-	o.Filled = resp.Status == "FILLED"
+	o.Status = binanceOrderStatus(resp.Status)
+	o.Filled = o.Status == engine.OrderStatusFilled
+
+	// volume weighted fill price, fees are only tracked when charged in the quote asset
+	var filledQty, filledNotional decimal.Decimal
+	for _, f := range resp.Fills {
+		filledQty = filledQty.Add(f.Qty)
+		filledNotional = filledNotional.Add(f.Qty.Mul(f.Price))
+		if strings.HasSuffix(strings.ToUpper(o.Symbol), strings.ToUpper(f.CommissionAsset)) {
+			o.Fee = o.Fee.Add(f.Commission)
+		}
+	}
+	if filledQty.IsPositive() {
+		o.FilledPrice = filledNotional.DivRound(filledQty, 8)
+		o.FilledQty = filledQty
+		if o.Filled {
+			o.Quantity = filledQty
+		}
+	}
 
 	return o, nil
 }
 
-func (b *BinanceAdapter) CancelOrder(ctx context.Context, orderID string) error {
+// PlaceOCO places the exit of a position as a take-profit LIMIT_MAKER at
+// target and a STOP_LOSS at stop, Binance canceling one when the other
+// executes. A sell exit has the take-profit above the market and the stop
+// below it, a buy exit the other way round.
+func (b *BinanceAdapter) PlaceOCO(ctx context.Context, symbol string, side engine.Side, qty, stop, target decimal.Decimal) (engine.Order, engine.Order, error) {
+	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(symbol))
+	val.Set("side", string(side))
+	val.Set("quantity", qty.String())
+	limit, stopLoss := "above", "below"
+	if side == engine.SideBuy {
+		limit, stopLoss = "below", "above"
+	}
+	val.Set(limit+"Type", "LIMIT_MAKER")
+	val.Set(limit+"Price", target.String())
+	val.Set(stopLoss+"Type", "STOP_LOSS")
+	val.Set(stopLoss+"StopPrice", stop.String())
+	b.mt.Lock()
+	body, err := b.privatePOST(ctx, "/api/v3/orderList/oco", val)
+	b.mt.Unlock()
+	if err != nil {
+		return engine.Order{}, engine.Order{}, err
+	}
+
+	var resp struct {
+		OrderReports []struct {
+			binanceOrder
+			StopPrice decimal.Decimal `json:"stopPrice"`
+		} `json:"orderReports"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return engine.Order{}, engine.Order{}, err
+	}
+	var stopLeg, targetLeg engine.Order
+	for _, r := range resp.OrderReports {
+		o := engine.Order{
+			ID:            strconv.FormatInt(r.OrderID, 10),
+			ClientOrderID: r.ClientOrderID,
+			Symbol:        symbol,
+			Side:          side,
+			Created:       time.Now().Unix(),
+		}
+		r.apply(&o)
+		if r.Type == "STOP_LOSS" {
+			// the stop executes as a market order once stop trades
+			o.Type, o.Price = engine.OrderMarket, r.StopPrice
+			stopLeg = o
+		} else {
+			o.Type, o.Price = engine.OrderLimit, r.Price
+			targetLeg = o
+		}
+	}
+	if stopLeg.ID == "" || targetLeg.ID == "" {
+		return stopLeg, targetLeg, fmt.Errorf("binance OCO on %s reported %d of its 2 orders", symbol, len(resp.OrderReports))
+	}
+	return stopLeg, targetLeg, nil
+}
+
+// GetOrder returns the status and executed amount of an order.
+// Fees are not part of the order query.
+func (b *BinanceAdapter) GetOrder(ctx context.Context, symbol, orderID string) (engine.Order, error) {
 	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(symbol))
 	val.Set("orderId", orderID)
 	b.mt.Lock()
+	body, err := b.privateGET(ctx, "/api/v3/order", val)
+	b.mt.Unlock()
+	if err != nil {
+		return engine.Order{}, err
+	}
+
+	var resp binanceOrder
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return engine.Order{}, err
+	}
+
+	o := engine.Order{ID: orderID, Symbol: symbol}
+	resp.apply(&o)
+	return o, nil
+}
+
+// GetOpenOrders returns the orders resting on symbol
+func (b *BinanceAdapter) GetOpenOrders(ctx context.Context, symbol string) ([]engine.Order, error) {
+	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(symbol))
+	b.mt.Lock()
+	body, err := b.privateGET(ctx, "/api/v3/openOrders", val)
+	b.mt.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []binanceOrder
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	out := make([]engine.Order, 0, len(resp))
+	for _, r := range resp {
+		o := engine.Order{
+			ID:            strconv.FormatInt(r.OrderID, 10),
+			ClientOrderID: r.ClientOrderID,
+			Symbol:        symbol,
+			Side:          engine.Side(r.Side),
+			Type:          engine.OrderType(r.Type),
+			Price:         r.Price,
+			Created:       r.Time / 1000,
+		}
+		r.apply(&o)
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// binanceOrder is an order as Binance reports it
+type binanceOrder struct {
+	OrderID       int64           `json:"orderId"`
+	ClientOrderID string          `json:"clientOrderId"`
+	Side          string          `json:"side"`
+	Type          string          `json:"type"`
+	Price         decimal.Decimal `json:"price"`
+	Time          int64           `json:"time"` // milliseconds
+	Status        string          `json:"status"`
+	OrigQty       decimal.Decimal `json:"origQty"`
+	ExecutedQty   decimal.Decimal `json:"executedQty"`
+	QuoteQty      decimal.Decimal `json:"cummulativeQuoteQty"`
+}
+
+// apply copies the fill state Binance reports onto o
+func (bo binanceOrder) apply(o *engine.Order) {
+	o.Quantity = bo.OrigQty
+	o.FilledQty = bo.ExecutedQty
+	o.Status = binanceOrderStatus(bo.Status)
+	if bo.ExecutedQty.IsPositive() {
+		o.FilledPrice = bo.QuoteQty.DivRound(bo.ExecutedQty, 8)
+	}
+	o.Filled = o.Status == engine.OrderStatusFilled
+}
+
+// GetSymbolInfo reads the price, lot size and notional filters of symbol
+func (b *BinanceAdapter) GetSymbolInfo(ctx context.Context, symbol string) (engine.SymbolInfo, error) {
+	query := url.Values{}
+	query.Set("symbol", strings.ToUpper(symbol))
+	body, err := b.public(ctx, "/api/v3/exchangeInfo", query)
+	if err != nil {
+		return engine.SymbolInfo{}, err
+	}
+
+	var resp struct {
+		Symbols []struct {
+			Symbol  string `json:"symbol"`
+			Filters []struct {
+				FilterType  string          `json:"filterType"`
+				TickSize    decimal.Decimal `json:"tickSize"`
+				StepSize    decimal.Decimal `json:"stepSize"`
+				MinQty      decimal.Decimal `json:"minQty"`
+				MinNotional decimal.Decimal `json:"minNotional"`
+			} `json:"filters"`
+		} `json:"symbols"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return engine.SymbolInfo{}, err
+	}
+	if len(resp.Symbols) == 0 {
+		return engine.SymbolInfo{}, fmt.Errorf("binance does not list %s", symbol)
+	}
+	info := engine.SymbolInfo{Symbol: symbol}
+	for _, f := range resp.Symbols[0].Filters {
+		switch f.FilterType {
+		case "PRICE_FILTER":
+			info.TickSize = f.TickSize
+		case "LOT_SIZE":
+			info.StepSize, info.MinQty = f.StepSize, f.MinQty
+		case "MIN_NOTIONAL", "NOTIONAL":
+			info.MinNotional = f.MinNotional
+		}
+	}
+	info.PricePrecision = engine.Precision(info.TickSize)
+	info.QtyPrecision = engine.Precision(info.StepSize)
+	return info, nil
+}
+
+// binanceKlineLimit is the most klines Binance returns per request
+const binanceKlineLimit = 1000
+
+// HistoricalCandles pages through the klines of symbol starting between from
+// and to. Klines are public market data, so no API keys are needed.
+func (b *BinanceAdapter) HistoricalCandles(ctx context.Context, symbol string, interval int64, from, to time.Time) ([]engine.Candle, error) {
+	name, ok := binanceKlineIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("binance has no %ds kline interval", interval)
+	}
+	step := time.Duration(interval) * time.Second
+	now := time.Now()
+
+	var candles []engine.Candle
+	for start := from; !start.After(to); {
+		query := url.Values{}
+		query.Set("symbol", strings.ToUpper(symbol))
+		query.Set("interval", name)
+		query.Set("startTime", strconv.FormatInt(start.UnixMilli(), 10))
+		query.Set("endTime", strconv.FormatInt(to.UnixMilli(), 10))
+		query.Set("limit", strconv.Itoa(binanceKlineLimit))
+		body, err := b.public(ctx, "/api/v3/klines", query)
+		if err != nil {
+			return nil, err
+		}
+
+		// [open time, open, high, low, close, volume, close time, ...]
+		var rows [][]interface{}
+		if err := json.Unmarshal(body, &rows); err != nil {
+			return nil, fmt.Errorf("binance klines: %w", err)
+		}
+		for _, row := range rows {
+			c, err := binanceKline(row)
+			if err != nil {
+				return nil, err
+			}
+			// the newest kline may still be open
+			if c.Time.Add(step).After(now) {
+				continue
+			}
+			candles = append(candles, c)
+			start = c.Time.Add(step)
+		}
+		if len(rows) < binanceKlineLimit {
+			break
+		}
+	}
+	return candles, nil
+}
+
+// binanceKline reads a kline row of the REST API
+func binanceKline(row []interface{}) (engine.Candle, error) {
+	if len(row) < 6 {
+		return engine.Candle{}, fmt.Errorf("binance kline has %d fields", len(row))
+	}
+	start, ok := row[0].(float64)
+	if !ok {
+		return engine.Candle{}, fmt.Errorf("binance kline open time %v", row[0])
+	}
+	var vals [5]float64
+	for i := range vals {
+		s, _ := row[i+1].(string)
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return engine.Candle{}, fmt.Errorf("binance kline: %w", err)
+		}
+		vals[i] = f
+	}
+	return engine.Candle{
+		Time:   time.UnixMilli(int64(start)),
+		Open:   vals[0],
+		High:   vals[1],
+		Low:    vals[2],
+		Close:  vals[3],
+		Volume: vals[4],
+	}, nil
+}
+
+// binanceOrderStatus maps Binance order states onto the engine lifecycle
+func binanceOrderStatus(s string) engine.OrderStatus {
+	switch s {
+	case "PARTIALLY_FILLED":
+		return engine.OrderStatusPartiallyFilled
+	case "FILLED":
+		return engine.OrderStatusFilled
+	case "CANCELED", "EXPIRED", "EXPIRED_IN_MATCH":
+		return engine.OrderStatusCanceled
+	case "REJECTED":
+		return engine.OrderStatusRejected
+	}
+	// NEW, PENDING_NEW and PENDING_CANCEL are still working
+	return engine.OrderStatusNew
+}
+
+// binanceTimeInForce is the timeInForce of a limit order. Binance has no
+// GTT for spot orders, those rest as GTC until the order manager cancels them.
+func binanceTimeInForce(tif engine.TimeInForce) string {
+	switch tif {
+	case engine.TimeInForceIOC, engine.TimeInForceFOK:
+		return string(tif)
+	}
+	return string(engine.TimeInForceGTC)
+}
+
+func (b *BinanceAdapter) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(symbol))
+	val.Set("orderId", orderID)
+	b.mt.Lock()
+	defer b.mt.Unlock()
+	_, err := b.privateDELETE(ctx, "/api/v3/order", val)
+	return err
+}
+
+// CancelAllOrders cancels every order resting on symbol
+func (b *BinanceAdapter) CancelAllOrders(ctx context.Context, symbol string) error {
+	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(symbol))
+	b.mt.Lock()
 	defer b.mt.Unlock()
-	_, err := b.privatePOST(ctx, "/api/v3/order", val)
+	_, err := b.privateDELETE(ctx, "/api/v3/openOrders", val)
+	var xe *engine.ExchangeError
+	if errors.As(err, &xe) && xe.Code == "-2011" {
+		// Binance answers "Unknown order sent" when nothing is open
+		return nil
+	}
+	return err
+}
+
+// Ping implements engine.HealthChecker with Binance's connectivity test
+func (b *BinanceAdapter) Ping(ctx context.Context) error {
+	_, err := b.public(ctx, "/api/v3/ping", url.Values{})
 	return err
 }
 
-func (b *BinanceAdapter) GetBalances(ctx context.Context) (map[string]float64, error) {
+func (b *BinanceAdapter) GetBalances(ctx context.Context) (map[string]decimal.Decimal, error) {
 	b.mt.Lock()
 	body, err := b.privateGET(ctx, "/api/v3/account", url.Values{})
 	b.mt.Unlock()
@@ -164,9 +635,9 @@ func (b *BinanceAdapter) GetBalances(ctx context.Context) (map[string]float64, e
 		return nil, err
 	}
 
-	out := make(map[string]float64)
+	out := make(map[string]decimal.Decimal)
 	for _, b := range acct.Balances {
-		f, _ := strconv.ParseFloat(b.Free, 64)
+		f, _ := decimal.NewFromString(b.Free)
 		out[b.Asset] = f
 	}
 
@@ -175,15 +646,17 @@ func (b *BinanceAdapter) GetBalances(ctx context.Context) (map[string]float64, e
 
 func (b *BinanceAdapter) GetPosition(ctx context.Context, symbol string) (engine.Position, error) {
 	// Binance Spot does not have real positions; treat spot as amount of asset.
-	b.mt.Lock()
-	defer b.mt.Unlock()
+	// GetBalances takes b.mt itself
+	base, _, err := parseSymbol(symbol)
+	if err != nil {
+		return engine.Position{Symbol: symbol}, err
+	}
 	balances, err := b.GetBalances(ctx)
 	if err != nil {
 		return engine.Position{Symbol: symbol}, err
 	}
 
-	asset := symbol[:3] // crude split "BTCUSDT" -> "BTC"
-	qty := balances[asset]
+	qty := balances[base]
 
 	return engine.Position{
 		Symbol:   symbol,
@@ -191,60 +664,34 @@ func (b *BinanceAdapter) GetPosition(ctx context.Context, symbol string) (engine
 	}, nil
 }
 
+// SubscribeCandles streams closed klines over the Binance WebSocket API
 func (b *BinanceAdapter) SubscribeCandles(ctx context.Context, symbol string, interval int64) (<-chan engine.Candle, error) {
-	// For simplicity: fetch recent candles via REST in a goroutine.
-	b.mt.Lock()
-	defer b.mt.Unlock()
-
+	stream, err := binanceKlineStream(symbol, interval)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Subscribing to Candles from %s", b.AdapterName())
 	ch := make(chan engine.Candle, 1024)
+	go b.streamKlines(ctx, stream, ch)
+	return ch, nil
+}
 
-	go func() {
-		defer close(ch)
-		url := fmt.Sprintf("%s/api/v3/klines?symbol=%s&interval=1m&limit=500",
-			b.baseURL,
-			strings.ToUpper(symbol),
-		)
-		log.Printf("Subscribing to Candles from %s", b.AdapterName())
-
-		for {
-			// poll every ~3 seconds
-			req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-			resp, err := b.client.Do(req)
-			if err != nil {
-				return
-			}
-			body, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-
-			var arr [][]interface{}
-			if err := json.Unmarshal(body, &arr); err != nil {
-				return
-			}
-
-			for _, c := range arr {
-				ch <- engine.Candle{
-					Time:   time.UnixMilli(int64(c[0].(float64))),
-					Open:   mustF(c[1]),
-					High:   mustF(c[2]),
-					Low:    mustF(c[3]),
-					Close:  mustF(c[4]),
-					Volume: mustF(c[5]),
-				}
-			}
-
-			select {
-			case <-ctx.Done():
-				return
-			case <-time.After(3 * time.Second):
-			}
-		}
-	}()
-
+// SubscribeTrades streams the aggregate trades of symbol
+func (b *BinanceAdapter) SubscribeTrades(ctx context.Context, symbol string) (<-chan engine.Trade, error) {
+	log.Printf("Subscribing to %s trades from %s", symbol, b.AdapterName())
+	ch := make(chan engine.Trade, 1024)
+	go b.streamTrades(ctx, symbol, strings.ToLower(symbol)+"@aggTrade", ch)
 	return ch, nil
 }
 
-func mustF(v interface{}) float64 {
-	s := fmt.Sprintf("%v", v)
-	f, _ := strconv.ParseFloat(s, 64)
-	return f
+// SubscribeOrderBook streams the top depth levels of symbol's book every 100ms
+func (b *BinanceAdapter) SubscribeOrderBook(ctx context.Context, symbol string, depth int) (<-chan engine.OrderBook, error) {
+	stream, err := binanceDepthStream(symbol, depth)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Subscribing to %s order book from %s", symbol, b.AdapterName())
+	ch := make(chan engine.OrderBook, 64)
+	go b.streamBook(ctx, symbol, stream, depth, ch)
+	return ch, nil
 }
@@ -0,0 +1,533 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/secrets"
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// the REST API and streams of USD-M futures, live and on the testnet
+const (
+	binanceFuturesURL          = "https://fapi.binance.com"
+	binanceFuturesWSURL        = "wss://fstream.binance.com/ws"
+	BinanceFuturesTestnetURL   = "https://testnet.binancefuture.com"
+	BinanceFuturesTestnetWSURL = "wss://fstream.binancefuture.com/ws"
+)
+
+// MaxBinanceLeverage is the highest leverage Binance offers on any contract
+const MaxBinanceLeverage = 125
+
+// binanceFuturesRateLimit is the request weight Binance allows a futures
+// account a minute and the weight of the endpoints costing more than 1
+var binanceFuturesRateLimit = RateLimit{
+	Capacity: 2400,
+	Window:   time.Minute,
+	MaxWait:  10 * time.Second,
+	Weights: map[string]int{
+		"GET /fapi/v2/balance":      5,
+		"GET /fapi/v2/positionRisk": 5,
+		"GET /fapi/v1/klines":       5,
+	},
+}
+
+// BinanceFuturesAdapter trades USD-M perpetual futures. Unlike spot,
+// positions are real: long or short, leveraged, with a mark price Binance
+// values them at and a liquidation price. Requests are signed, rate limited
+// and clock corrected like the spot adapter's, whose plumbing it reuses at
+// the futures hosts.
+type BinanceFuturesAdapter struct {
+	api *BinanceAdapter
+
+	mt       sync.Mutex
+	leverage int             // set on each symbol before its first order, 0 keeps the account's
+	levered  map[string]bool // symbols the leverage was set on
+}
+
+func NewBinanceFuturesAdapter(creds *secrets.Credentials, db store.Store) (engine.ExchangeAdapter, error) {
+	return &BinanceFuturesAdapter{
+		api: &BinanceAdapter{
+			creds:    creds,
+			client:   &http.Client{Timeout: 15 * time.Second},
+			baseURL:  binanceFuturesURL,
+			wsURL:    binanceFuturesWSURL,
+			db:       db,
+			limit:    newLimiter("binance", binanceFuturesRateLimit),
+			timePath: "/fapi/v1/time",
+		},
+		levered: map[string]bool{},
+	}, nil
+}
+
+// SetURLs points the adapter at the REST API base and the WebSocket streams
+// ws, such as the testnet or a mock server. Empty ones keep the current.
+func (f *BinanceFuturesAdapter) SetURLs(base, ws string) {
+	f.api.SetURLs(base, ws)
+}
+
+// SetRateLimit changes the request weight budget, zero fields keep Binance's limits
+func (f *BinanceFuturesAdapter) SetRateLimit(cfg RateLimit) {
+	f.api.SetRateLimit(cfg)
+}
+
+// SetRecvWindow sets how long after its timestamp Binance still accepts a
+// signed request, zero keeps Binance's default
+func (f *BinanceFuturesAdapter) SetRecvWindow(d time.Duration) {
+	f.api.SetRecvWindow(d)
+}
+
+// SetLeverage sets the leverage of every symbol before its first order,
+// zero keeps what the account has
+func (f *BinanceFuturesAdapter) SetLeverage(leverage int) {
+	f.mt.Lock()
+	defer f.mt.Unlock()
+	f.leverage = leverage
+	f.levered = map[string]bool{}
+}
+
+// ChangeLeverage sets the leverage of symbol on Binance now, in place of
+// the configured one
+func (f *BinanceFuturesAdapter) ChangeLeverage(ctx context.Context, symbol string, leverage int) error {
+	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(symbol))
+	val.Set("leverage", strconv.Itoa(leverage))
+	f.api.mt.Lock()
+	_, err := f.api.privatePOST(ctx, "/fapi/v1/leverage", val)
+	f.api.mt.Unlock()
+	if err != nil {
+		return err
+	}
+	f.mt.Lock()
+	f.levered[symbol] = true
+	f.mt.Unlock()
+	return nil
+}
+
+// lever sets the configured leverage on symbol unless it was already
+func (f *BinanceFuturesAdapter) lever(ctx context.Context, symbol string) error {
+	f.mt.Lock()
+	leverage, done := f.leverage, f.levered[symbol]
+	f.mt.Unlock()
+	if leverage == 0 || done {
+		return nil
+	}
+	if err := f.ChangeLeverage(ctx, symbol, leverage); err != nil {
+		return fmt.Errorf("setting %s leverage to %dx: %w", symbol, leverage, err)
+	}
+	log.Printf("Binance futures leverage of %s set to %dx", symbol, leverage)
+	return nil
+}
+
+func (f *BinanceFuturesAdapter) AdapterName() string {
+	return "Binance Futures"
+}
+
+// CanShort implements engine.ShortSeller, perpetuals are sold short as
+// easily as bought
+func (f *BinanceFuturesAdapter) CanShort(symbol string) bool { return true }
+
+// QuoteAsset implements engine.QuoteAssetProvider, USD-M futures margin in
+// USDT
+func (f *BinanceFuturesAdapter) QuoteAsset() string { return "USDT" }
+
+// Ping implements engine.HealthChecker with the futures connectivity test
+func (f *BinanceFuturesAdapter) Ping(ctx context.Context) error {
+	_, err := f.api.public(ctx, "/fapi/v1/ping", url.Values{})
+	return err
+}
+
+// ServerTime implements engine.TimeSyncer, measuring the offset signed
+// requests are stamped with
+func (f *BinanceFuturesAdapter) ServerTime(ctx context.Context) (time.Time, error) {
+	return f.api.ServerTime(ctx)
+}
+
+// ClockOffset implements engine.ClockOffsetter
+func (f *BinanceFuturesAdapter) ClockOffset() time.Duration {
+	return f.api.ClockOffset()
+}
+
+// PlaceOrder places a market or limit order, quantities in contracts of
+// the base asset. Sells open or add to shorts as readily as they close longs.
+func (f *BinanceFuturesAdapter) PlaceOrder(ctx context.Context, o engine.Order) (engine.Order, error) {
+	if err := f.lever(ctx, o.Symbol); err != nil {
+		return o, err
+	}
+	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(o.Symbol))
+	val.Set("side", string(o.Side))
+	val.Set("type", string(o.Type))
+	val.Set("quantity", o.Quantity.String())
+	// the answer waits for the fills of market orders
+	val.Set("newOrderRespType", "RESULT")
+	if o.ClientOrderID != "" {
+		val.Set("newClientOrderId", o.ClientOrderID)
+	}
+	if o.Type != engine.OrderMarket {
+		val.Set("price", o.Price.String())
+		val.Set("timeInForce", binanceTimeInForce(o.TimeInForce))
+	}
+	f.api.mt.Lock()
+	body, err := f.api.privatePOST(ctx, "/fapi/v1/order", val)
+	f.api.mt.Unlock()
+	if err != nil {
+		return o, err
+	}
+
+	var resp binanceFuturesOrder
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return o, err
+	}
+	o.ID = strconv.FormatInt(resp.OrderID, 10)
+	o.Created = time.Now().Unix()
+	resp.apply(&o)
+	return o, nil
+}
+
+// GetOrder returns the status and executed amount of an order.
+// Fees are not part of the order query.
+func (f *BinanceFuturesAdapter) GetOrder(ctx context.Context, symbol, orderID string) (engine.Order, error) {
+	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(symbol))
+	val.Set("orderId", orderID)
+	f.api.mt.Lock()
+	body, err := f.api.privateGET(ctx, "/fapi/v1/order", val)
+	f.api.mt.Unlock()
+	if err != nil {
+		return engine.Order{}, err
+	}
+
+	var resp binanceFuturesOrder
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return engine.Order{}, err
+	}
+	o := engine.Order{ID: orderID, Symbol: symbol}
+	resp.apply(&o)
+	return o, nil
+}
+
+// GetOpenOrders returns the orders resting on symbol
+func (f *BinanceFuturesAdapter) GetOpenOrders(ctx context.Context, symbol string) ([]engine.Order, error) {
+	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(symbol))
+	f.api.mt.Lock()
+	body, err := f.api.privateGET(ctx, "/fapi/v1/openOrders", val)
+	f.api.mt.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []binanceFuturesOrder
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	out := make([]engine.Order, 0, len(resp))
+	for _, r := range resp {
+		o := engine.Order{
+			ID:            strconv.FormatInt(r.OrderID, 10),
+			ClientOrderID: r.ClientOrderID,
+			Symbol:        symbol,
+			Side:          engine.Side(r.Side),
+			Type:          engine.OrderType(r.Type),
+			Created:       r.Time / 1000,
+		}
+		r.apply(&o)
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+func (f *BinanceFuturesAdapter) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(symbol))
+	val.Set("orderId", orderID)
+	f.api.mt.Lock()
+	defer f.api.mt.Unlock()
+	_, err := f.api.privateDELETE(ctx, "/fapi/v1/order", val)
+	return err
+}
+
+// CancelAllOrders cancels every order resting on symbol
+func (f *BinanceFuturesAdapter) CancelAllOrders(ctx context.Context, symbol string) error {
+	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(symbol))
+	f.api.mt.Lock()
+	defer f.api.mt.Unlock()
+	_, err := f.api.privateDELETE(ctx, "/fapi/v1/allOpenOrders", val)
+	return err
+}
+
+// GetBalances returns the wallet balance of each margin asset, realized
+// PnL included and unrealized PnL not
+func (f *BinanceFuturesAdapter) GetBalances(ctx context.Context) (map[string]decimal.Decimal, error) {
+	f.api.mt.Lock()
+	body, err := f.api.privateGET(ctx, "/fapi/v2/balance", url.Values{})
+	f.api.mt.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []struct {
+		Asset   string          `json:"asset"`
+		Balance decimal.Decimal `json:"balance"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	out := make(map[string]decimal.Decimal, len(resp))
+	for _, b := range resp {
+		out[b.Asset] = b.Balance
+	}
+	return out, nil
+}
+
+// GetPosition returns the position in symbol, negative when short, with its
+// entry, mark and liquidation prices. In hedge mode the long and short
+// sides are netted.
+func (f *BinanceFuturesAdapter) GetPosition(ctx context.Context, symbol string) (engine.Position, error) {
+	val := url.Values{}
+	val.Set("symbol", strings.ToUpper(symbol))
+	f.api.mt.Lock()
+	body, err := f.api.privateGET(ctx, "/fapi/v2/positionRisk", val)
+	f.api.mt.Unlock()
+	if err != nil {
+		return engine.Position{Symbol: symbol}, err
+	}
+
+	var resp []struct {
+		PositionAmt      decimal.Decimal `json:"positionAmt"`
+		EntryPrice       decimal.Decimal `json:"entryPrice"`
+		MarkPrice        decimal.Decimal `json:"markPrice"`
+		LiquidationPrice decimal.Decimal `json:"liquidationPrice"`
+		Leverage         string          `json:"leverage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return engine.Position{Symbol: symbol}, err
+	}
+	pos := engine.Position{Symbol: symbol}
+	var cost decimal.Decimal
+	for _, p := range resp {
+		pos.Quantity = pos.Quantity.Add(p.PositionAmt)
+		cost = cost.Add(p.PositionAmt.Mul(p.EntryPrice))
+		pos.MarkPrice = p.MarkPrice
+		pos.Leverage, _ = strconv.Atoi(p.Leverage)
+		if !p.PositionAmt.IsZero() {
+			pos.LiquidationPrice = p.LiquidationPrice
+		}
+	}
+	if !pos.Quantity.IsZero() {
+		pos.AvgPrice = cost.DivRound(pos.Quantity, 8)
+	}
+	return pos, nil
+}
+
+// GetSymbolInfo reads the price, lot size and notional filters of symbol
+func (f *BinanceFuturesAdapter) GetSymbolInfo(ctx context.Context, symbol string) (engine.SymbolInfo, error) {
+	// the futures exchange info lists every contract
+	body, err := f.api.public(ctx, "/fapi/v1/exchangeInfo", url.Values{})
+	if err != nil {
+		return engine.SymbolInfo{}, err
+	}
+
+	var resp struct {
+		Symbols []struct {
+			Symbol  string `json:"symbol"`
+			Filters []struct {
+				FilterType string          `json:"filterType"`
+				TickSize   decimal.Decimal `json:"tickSize"`
+				StepSize   decimal.Decimal `json:"stepSize"`
+				MinQty     decimal.Decimal `json:"minQty"`
+				Notional   decimal.Decimal `json:"notional"`
+			} `json:"filters"`
+		} `json:"symbols"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return engine.SymbolInfo{}, err
+	}
+	for _, s := range resp.Symbols {
+		if !strings.EqualFold(s.Symbol, symbol) {
+			continue
+		}
+		info := engine.SymbolInfo{Symbol: symbol}
+		for _, flt := range s.Filters {
+			switch flt.FilterType {
+			case "PRICE_FILTER":
+				info.TickSize = flt.TickSize
+			case "LOT_SIZE":
+				info.StepSize, info.MinQty = flt.StepSize, flt.MinQty
+			case "MIN_NOTIONAL":
+				info.MinNotional = flt.Notional
+			}
+		}
+		info.PricePrecision = engine.Precision(info.TickSize)
+		info.QtyPrecision = engine.Precision(info.StepSize)
+		return info, nil
+	}
+	return engine.SymbolInfo{}, fmt.Errorf("binance futures does not list %s", symbol)
+}
+
+// SubscribeCandles streams the closed klines of the contract, the futures
+// streams send them like spot's
+func (f *BinanceFuturesAdapter) SubscribeCandles(ctx context.Context, symbol string, interval int64) (<-chan engine.Candle, error) {
+	stream, err := binanceKlineStream(symbol, interval)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Subscribing to Candles from %s", f.AdapterName())
+	ch := make(chan engine.Candle, 1024)
+	go f.api.streamKlines(ctx, stream, ch)
+	return ch, nil
+}
+
+// SubscribeTrades streams the aggregate trades of the contract
+func (f *BinanceFuturesAdapter) SubscribeTrades(ctx context.Context, symbol string) (<-chan engine.Trade, error) {
+	log.Printf("Subscribing to %s trades from %s", symbol, f.AdapterName())
+	ch := make(chan engine.Trade, 1024)
+	go f.api.streamTrades(ctx, symbol, strings.ToLower(symbol)+"@aggTrade", ch)
+	return ch, nil
+}
+
+// SubscribeOrderBook streams the top depth levels of the contract's book
+// every 100ms
+func (f *BinanceFuturesAdapter) SubscribeOrderBook(ctx context.Context, symbol string, depth int) (<-chan engine.OrderBook, error) {
+	stream, err := binanceDepthStream(symbol, depth)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Subscribing to %s order book from %s", symbol, f.AdapterName())
+	ch := make(chan engine.OrderBook, 64)
+	go f.streamBook(ctx, symbol, stream, depth, ch)
+	return ch, nil
+}
+
+// SubscribeMarkPrice implements engine.MarkPriceStreamer with the mark
+// price of the contract every second
+func (f *BinanceFuturesAdapter) SubscribeMarkPrice(ctx context.Context, symbol string) (<-chan engine.MarkPrice, error) {
+	log.Printf("Subscribing to %s mark prices from %s", symbol, f.AdapterName())
+	ch := make(chan engine.MarkPrice, 64)
+	go f.streamMarkPrice(ctx, symbol, strings.ToLower(symbol)+"@markPrice@1s", ch)
+	return ch, nil
+}
+
+// binanceFuturesOrder is an order as Binance futures reports it
+type binanceFuturesOrder struct {
+	OrderID       int64           `json:"orderId"`
+	ClientOrderID string          `json:"clientOrderId"`
+	Side          string          `json:"side"`
+	Type          string          `json:"type"`
+	Price         decimal.Decimal `json:"price"`
+	AvgPrice      decimal.Decimal `json:"avgPrice"`
+	Time          int64           `json:"time"` // milliseconds
+	Status        string          `json:"status"`
+	OrigQty       decimal.Decimal `json:"origQty"`
+	ExecutedQty   decimal.Decimal `json:"executedQty"`
+}
+
+// apply copies the fill state Binance reports onto o
+func (fo binanceFuturesOrder) apply(o *engine.Order) {
+	if fo.Price.IsPositive() {
+		o.Price = fo.Price
+	}
+	o.Quantity = fo.OrigQty
+	o.FilledQty = fo.ExecutedQty
+	o.Status = binanceOrderStatus(fo.Status)
+	if fo.ExecutedQty.IsPositive() {
+		o.FilledPrice = fo.AvgPrice
+	}
+	o.Filled = o.Status == engine.OrderStatusFilled
+}
+
+// binanceFuturesDepthEvent is a partial book on the futures streams.
+// encoding/json matches keys regardless of case, so the upper case twins
+// of keys are declared to keep the two apart.
+type binanceFuturesDepthEvent struct {
+	Event        string      `json:"e"`
+	EventTime    int64       `json:"E"`
+	FirstID      int64       `json:"U"`
+	LastUpdateID int64       `json:"u"`
+	Bids         [][2]string `json:"b"`
+	Asks         [][2]string `json:"a"`
+}
+
+// binanceMarkPriceEvent is a mark price update, declared like
+// binanceFuturesDepthEvent
+type binanceMarkPriceEvent struct {
+	Event       string          `json:"e"`
+	EventTime   int64           `json:"E"`
+	Symbol      string          `json:"s"`
+	Price       decimal.Decimal `json:"p"`
+	SettlePrice decimal.Decimal `json:"P"`
+	IndexPrice  decimal.Decimal `json:"i"`
+	FundingRate decimal.Decimal `json:"r"`
+	NextFunding int64           `json:"T"`
+}
+
+// streamBook keeps a partial depth stream of the contract open and sends
+// each book cut to depth levels to ch until ctx is done
+func (f *BinanceFuturesAdapter) streamBook(ctx context.Context, symbol, stream string, depth int, ch chan<- engine.OrderBook) {
+	defer close(ch)
+	var last int64
+	f.api.keepStream(ctx, stream, func(next func(v interface{}) error) error {
+		for {
+			var ev binanceFuturesDepthEvent
+			if err := next(&ev); err != nil {
+				return err
+			}
+			if ev.Event != "depthUpdate" || ev.LastUpdateID <= last {
+				continue
+			}
+			book, err := binanceDepthEvent{LastUpdateID: ev.LastUpdateID, Bids: ev.Bids, Asks: ev.Asks}.book(symbol, depth)
+			if err != nil {
+				log.Printf("Binance futures stream %s: bad depth: %v", stream, err)
+				continue
+			}
+			last = ev.LastUpdateID
+			select {
+			case ch <- book:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+}
+
+// streamMarkPrice keeps a mark price stream of the contract open and sends
+// each update to ch until ctx is done
+func (f *BinanceFuturesAdapter) streamMarkPrice(ctx context.Context, symbol, stream string, ch chan<- engine.MarkPrice) {
+	defer close(ch)
+	f.api.keepStream(ctx, stream, func(next func(v interface{}) error) error {
+		for {
+			var ev binanceMarkPriceEvent
+			if err := next(&ev); err != nil {
+				return err
+			}
+			if ev.Event != "markPriceUpdate" {
+				continue
+			}
+			m := engine.MarkPrice{
+				Symbol:      symbol,
+				Price:       ev.Price,
+				IndexPrice:  ev.IndexPrice,
+				FundingRate: ev.FundingRate,
+				NextFunding: time.UnixMilli(ev.NextFunding),
+				Time:        time.UnixMilli(ev.EventTime),
+			}
+			select {
+			case ch <- m:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+}
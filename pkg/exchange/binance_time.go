@@ -0,0 +1,99 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// binanceResync is how long a measured offset of Binance's clock is used
+// before it is measured again, binanceRetrySync how long after a failed
+// measurement
+const (
+	binanceResync    = 30 * time.Minute
+	binanceRetrySync = time.Minute
+)
+
+// MaxBinanceRecvWindow is the longest recvWindow Binance accepts
+const MaxBinanceRecvWindow = time.Minute
+
+// binanceClock is the offset of Binance's clock from the local one. Signed
+// requests are stamped with the local time moved by it, so a skewed host
+// clock does not get them rejected with -1021.
+type binanceClock struct {
+	mt         sync.Mutex
+	offset     time.Duration
+	next       time.Time     // when the offset is measured again
+	recvWindow time.Duration // 0 leaves Binance's default of 5s
+}
+
+// SetRecvWindow sets how long after its timestamp Binance still accepts a
+// signed request, zero keeps Binance's default
+func (b *BinanceAdapter) SetRecvWindow(d time.Duration) {
+	b.clock.mt.Lock()
+	defer b.clock.mt.Unlock()
+	b.clock.recvWindow = min(d, MaxBinanceRecvWindow)
+}
+
+// ClockOffset implements engine.ClockOffsetter, the offset signed requests
+// are stamped with
+func (b *BinanceAdapter) ClockOffset() time.Duration {
+	b.clock.mt.Lock()
+	defer b.clock.mt.Unlock()
+	return b.clock.offset
+}
+
+// ServerTime implements engine.TimeSyncer. It measures the offset of
+// Binance's clock at the middle of the round trip, signed requests use it
+// from then on.
+func (b *BinanceAdapter) ServerTime(ctx context.Context) (time.Time, error) {
+	start := time.Now()
+	body, err := b.public(ctx, b.timePath, url.Values{})
+	if err != nil {
+		return time.Time{}, err
+	}
+	rtt := time.Since(start)
+	var resp struct {
+		ServerTime int64 `json:"serverTime"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return time.Time{}, err
+	}
+	server := time.UnixMilli(resp.ServerTime)
+
+	b.clock.mt.Lock()
+	defer b.clock.mt.Unlock()
+	b.clock.offset = server.Sub(start.Add(rtt / 2))
+	b.clock.next = time.Now().Add(binanceResync)
+	return server, nil
+}
+
+// signingTime is the time to stamp a signed request with, on Binance's
+// clock. A stale offset is measured again first; when that fails the last
+// one is used.
+func (b *BinanceAdapter) signingTime(ctx context.Context) (time.Time, time.Duration) {
+	b.clock.mt.Lock()
+	stale := !time.Now().Before(b.clock.next)
+	b.clock.mt.Unlock()
+	if stale {
+		if _, err := b.ServerTime(ctx); err != nil {
+			log.Printf("binance: could not sync the server time, signing with the last offset: %v", err)
+			b.clock.mt.Lock()
+			b.clock.next = time.Now().Add(binanceRetrySync)
+			b.clock.mt.Unlock()
+		}
+	}
+	b.clock.mt.Lock()
+	defer b.clock.mt.Unlock()
+	return time.Now().Add(b.clock.offset), b.clock.recvWindow
+}
+
+// resyncClock makes the next signed request measure the offset again
+func (b *BinanceAdapter) resyncClock() {
+	b.clock.mt.Lock()
+	defer b.clock.mt.Unlock()
+	b.clock.next = time.Time{}
+}
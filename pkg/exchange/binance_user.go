@@ -0,0 +1,279 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/shopspring/decimal"
+)
+
+// binanceKeepAlive is how often the listen key of the user data stream is
+// extended, Binance closes streams whose key went an hour without
+const binanceKeepAlive = 30 * time.Minute
+
+// errListenKeyExpired ends a user data stream Binance stopped serving
+var errListenKeyExpired = errors.New("listen key expired")
+
+// SubscribeAccount implements engine.AccountStreamer with the user data
+// stream, pushing order changes and balances as Binance reports them. A
+// listen key is created up front, so missing or wrong API keys fail here.
+func (b *BinanceAdapter) SubscribeAccount(ctx context.Context) (<-chan engine.AccountUpdate, error) {
+	key, err := b.listenKey(ctx, "POST", "")
+	if err != nil {
+		return nil, fmt.Errorf("binance user data stream: %w", err)
+	}
+	log.Printf("Subscribing to account updates from %s", b.AdapterName())
+	ch := make(chan engine.AccountUpdate, 256)
+	go b.streamUser(ctx, key, ch)
+	return ch, nil
+}
+
+// streamUser keeps the user data stream of key open, reconnecting with
+// backoff and a fresh listen key, and sends its updates to ch until ctx is done
+func (b *BinanceAdapter) streamUser(ctx context.Context, key string, ch chan<- engine.AccountUpdate) {
+	defer close(ch)
+	// quote asset commissions so far by order ID, the stream reports them per execution
+	fees := map[string]decimal.Decimal{}
+	keepConnected(ctx, "user data", func() error {
+		if key == "" {
+			var err error
+			if key, err = b.listenKey(ctx, "POST", ""); err != nil {
+				return err
+			}
+		}
+		err := b.readUserStream(ctx, key, ch, fees)
+		key = ""
+		return err
+	})
+}
+
+// readUserStream runs one connection to the user data stream of key,
+// extending the key while it is open
+func (b *BinanceAdapter) readUserStream(ctx context.Context, key string, ch chan<- engine.AccountUpdate, fees map[string]decimal.Decimal) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, b.wsURL+"/"+key, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// a key that could not be extended closes the connection for a new one
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	go b.keepListenKey(ctx, key, cancel)
+	log.Printf("Subscribed to Binance user data stream")
+
+	// changes made while disconnected are only found by polling
+	select {
+	case ch <- engine.AccountUpdate{Resync: true}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return readConn(conn, func(next func(v interface{}) error) error {
+		for {
+			var raw json.RawMessage
+			if err := next(&raw); err != nil {
+				return err
+			}
+			u, err := binanceUserEvent(raw, fees)
+			if errors.Is(err, errListenKeyExpired) {
+				return err
+			}
+			if err != nil {
+				log.Printf("Binance user data stream: bad event: %v", err)
+				continue
+			}
+			if u == nil {
+				continue
+			}
+			select {
+			case ch <- *u:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+}
+
+// keepListenKey extends key every keep alive interval until ctx is done,
+// calling fail when Binance does not extend it
+func (b *BinanceAdapter) keepListenKey(ctx context.Context, key string, fail func()) {
+	t := time.NewTicker(binanceKeepAlive)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if _, err := b.listenKey(ctx, "PUT", key); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Binance user data stream: could not extend the listen key: %v", err)
+					fail()
+				}
+				return
+			}
+		}
+	}
+}
+
+// listenKey creates a listen key with POST or extends key with PUT. The
+// requests carry the API key but no signature.
+func (b *BinanceAdapter) listenKey(ctx context.Context, method, key string) (out string, err error) {
+	const path = "/api/v3/userDataStream"
+	status := 0
+	ctx, span := startHTTPSpan(ctx, b.AdapterName(), method, path)
+	defer func() { endHTTPSpan(span, status, err) }()
+
+	query := url.Values{}
+	if key != "" {
+		query.Set("listenKey", key)
+	}
+	apiKey, _ := b.creds.Get()
+	if apiKey == "" {
+		return "", errors.New("no API key")
+	}
+	req, _ := http.NewRequestWithContext(ctx, method, b.baseURL+path+"?"+query.Encode(), nil)
+	req.Header.Set("X-MBX-APIKEY", apiKey)
+	resp, err := b.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return "", binanceError(resp, body)
+	}
+	var r struct {
+		ListenKey string `json:"listenKey"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return "", err
+	}
+	return r.ListenKey, nil
+}
+
+// binanceExecutionReport is an order change on the user data stream.
+// encoding/json matches keys regardless of case, so every key that has an
+// upper case twin is declared to keep the two apart.
+type binanceExecutionReport struct {
+	Event           string          `json:"e"`
+	EventTime       int64           `json:"E"`
+	Symbol          string          `json:"s"`
+	Side            string          `json:"S"`
+	ClientOrderID   string          `json:"c"`
+	OrigClientID    string          `json:"C"` // the order a cancel canceled
+	Type            string          `json:"o"`
+	OrderTime       int64           `json:"O"`
+	TimeInForce     string          `json:"f"`
+	IcebergQty      decimal.Decimal `json:"F"`
+	Quantity        decimal.Decimal `json:"q"`
+	QuoteOrderQty   decimal.Decimal `json:"Q"`
+	Price           decimal.Decimal `json:"p"`
+	StopPrice       decimal.Decimal `json:"P"`
+	ExecType        string          `json:"x"` // NEW, TRADE, CANCELED, EXPIRED, ...
+	Status          string          `json:"X"`
+	OrderID         int64           `json:"i"`
+	Ignored         int64           `json:"I"`
+	LastQty         decimal.Decimal `json:"l"`
+	LastPrice       decimal.Decimal `json:"L"`
+	FilledQty       decimal.Decimal `json:"z"`
+	FilledQuote     decimal.Decimal `json:"Z"`
+	Commission      decimal.Decimal `json:"n"` // of this execution
+	CommissionAsset *string         `json:"N"`
+	TradeID         int64           `json:"t"`
+	TransactTime    int64           `json:"T"`
+	Working         bool            `json:"w"`
+	WorkingTime     int64           `json:"W"`
+	Maker           bool            `json:"m"`
+	IgnoredM        bool            `json:"M"`
+}
+
+// binanceAccountPosition is the balances of the assets an account change touched
+type binanceAccountPosition struct {
+	Event     string `json:"e"`
+	EventTime int64  `json:"E"`
+	Balances  []struct {
+		Asset  string          `json:"a"`
+		Free   decimal.Decimal `json:"f"`
+		Locked decimal.Decimal `json:"l"`
+	} `json:"B"`
+}
+
+// binanceUserEvent is the account update of a user data stream message,
+// nil for events the engine has no use for. fees adds up the quote asset
+// commissions of each order.
+func binanceUserEvent(raw []byte, fees map[string]decimal.Decimal) (*engine.AccountUpdate, error) {
+	var head struct {
+		Event     string `json:"e"`
+		EventTime int64  `json:"E"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, err
+	}
+	switch head.Event {
+	case "executionReport":
+		var r binanceExecutionReport
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, err
+		}
+		o := r.order(fees)
+		return &engine.AccountUpdate{Order: &o}, nil
+	case "outboundAccountPosition":
+		var p binanceAccountPosition
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, err
+		}
+		bals := make(map[string]decimal.Decimal, len(p.Balances))
+		for _, b := range p.Balances {
+			bals[b.Asset] = b.Free
+		}
+		return &engine.AccountUpdate{Balances: bals}, nil
+	case "listenKeyExpired":
+		return nil, errListenKeyExpired
+	}
+	return nil, nil
+}
+
+// order is the state of the order r reports
+func (r binanceExecutionReport) order(fees map[string]decimal.Decimal) engine.Order {
+	o := engine.Order{
+		ID:            strconv.FormatInt(r.OrderID, 10),
+		ClientOrderID: r.ClientOrderID,
+		Symbol:        r.Symbol,
+		Side:          engine.Side(r.Side),
+		Type:          engine.OrderType(r.Type),
+		Price:         r.Price,
+		Quantity:      r.Quantity,
+		FilledQty:     r.FilledQty,
+		Status:        binanceOrderStatus(r.Status),
+		Created:       r.OrderTime / 1000,
+	}
+	if r.FilledQty.IsPositive() {
+		o.FilledPrice = r.FilledQuote.DivRound(r.FilledQty, 8)
+	}
+	o.Filled = o.Status == engine.OrderStatusFilled
+
+	// fees are only tracked when charged in the quote asset
+	if r.ExecType == "TRADE" && r.CommissionAsset != nil && strings.HasSuffix(strings.ToUpper(r.Symbol), strings.ToUpper(*r.CommissionAsset)) {
+		fees[o.ID] = fees[o.ID].Add(r.Commission)
+	}
+	o.Fee = fees[o.ID]
+	if o.Status.Final() {
+		delete(fees, o.ID)
+	}
+	return o
+}
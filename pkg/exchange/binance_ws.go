@@ -0,0 +1,307 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/omept/trading-engine/pkg/engine"
+)
+
+const binanceWSURL = "wss://stream.binance.com:9443/ws"
+
+// binanceKlineIntervals maps candle intervals in seconds to Binance names
+var binanceKlineIntervals = map[int64]string{
+	60: "1m", 180: "3m", 300: "5m", 900: "15m", 1800: "30m",
+	3600: "1h", 7200: "2h", 14400: "4h", 21600: "6h", 28800: "8h", 43200: "12h",
+	86400: "1d", 259200: "3d", 604800: "1w",
+}
+
+// Stream events declare the upper case twins of the keys they read:
+// encoding/json matches keys regardless of case, and would decode Binance's
+// event time "E" into the event type "e" and the like.
+
+type binanceAggTradeEvent struct {
+	Event        string `json:"e"`
+	EventTime    int64  `json:"E"`
+	ID           int64  `json:"a"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	Time         int64  `json:"T"`
+	BuyerIsMaker bool   `json:"m"`
+	Ignored      bool   `json:"M"`
+}
+
+type binanceDepthEvent struct {
+	LastUpdateID int64       `json:"lastUpdateId"`
+	Bids         [][2]string `json:"bids"`
+	Asks         [][2]string `json:"asks"`
+}
+
+type binanceKlineEvent struct {
+	Event     string `json:"e"`
+	EventTime int64  `json:"E"`
+	K         struct {
+		Start       int64  `json:"t"`
+		End         int64  `json:"T"`
+		Open        string `json:"o"`
+		High        string `json:"h"`
+		Low         string `json:"l"`
+		LastTradeID int64  `json:"L"`
+		Close       string `json:"c"`
+		Volume      string `json:"v"`
+		TakerVolume string `json:"V"`
+		Closed      bool   `json:"x"`
+	} `json:"k"`
+}
+
+// streamKlines keeps a kline stream open for stream, reconnecting with
+// backoff, and sends each closed candle to ch until ctx is done
+func (b *BinanceAdapter) streamKlines(ctx context.Context, stream string, ch chan<- engine.Candle) {
+	defer close(ch)
+	// last is the newest candle sent so a reconnect never repeats one
+	var last time.Time
+	b.keepStream(ctx, stream, func(next func(v interface{}) error) error {
+		for {
+			var ev binanceKlineEvent
+			if err := next(&ev); err != nil {
+				return err
+			}
+			if ev.Event != "kline" || !ev.K.Closed {
+				// subscription acks and in-progress candles
+				continue
+			}
+			c, err := ev.candle()
+			if err != nil {
+				log.Printf("Binance stream %s: bad kline: %v", stream, err)
+				continue
+			}
+			if !c.Time.After(last) {
+				continue
+			}
+			last = c.Time
+			select {
+			case ch <- c:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+}
+
+// streamTrades keeps an aggTrade stream open for symbol, reconnecting with
+// backoff, and sends each trade to ch until ctx is done
+func (b *BinanceAdapter) streamTrades(ctx context.Context, symbol, stream string, ch chan<- engine.Trade) {
+	defer close(ch)
+	// last is the newest aggregate trade id sent so a reconnect never repeats one
+	var last int64
+	b.keepStream(ctx, stream, func(next func(v interface{}) error) error {
+		for {
+			var ev binanceAggTradeEvent
+			if err := next(&ev); err != nil {
+				return err
+			}
+			if ev.Event != "aggTrade" || ev.ID <= last {
+				continue
+			}
+			t, err := ev.trade(symbol)
+			if err != nil {
+				log.Printf("Binance stream %s: bad trade: %v", stream, err)
+				continue
+			}
+			last = ev.ID
+			select {
+			case ch <- t:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+}
+
+// streamBook keeps a partial depth stream open for symbol, reconnecting
+// with backoff, and sends each book cut to depth levels to ch until ctx is done
+func (b *BinanceAdapter) streamBook(ctx context.Context, symbol, stream string, depth int, ch chan<- engine.OrderBook) {
+	defer close(ch)
+	var last int64
+	b.keepStream(ctx, stream, func(next func(v interface{}) error) error {
+		for {
+			var ev binanceDepthEvent
+			if err := next(&ev); err != nil {
+				return err
+			}
+			if ev.LastUpdateID <= last {
+				// subscription acks carry no update id
+				continue
+			}
+			book, err := ev.book(symbol, depth)
+			if err != nil {
+				log.Printf("Binance stream %s: bad depth: %v", stream, err)
+				continue
+			}
+			last = ev.LastUpdateID
+			select {
+			case ch <- book:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+}
+
+// keepStream runs read on connections subscribed to stream, reconnecting
+// with backoff whenever it fails, until ctx is done. next reads the next
+// message into v.
+func (b *BinanceAdapter) keepStream(ctx context.Context, stream string, read func(next func(v interface{}) error) error) {
+	keepConnected(ctx, stream, func() error { return b.readStream(ctx, stream, read) })
+}
+
+// keepConnected runs connect, reconnecting with backoff whenever it fails,
+// until ctx is done
+func keepConnected(ctx context.Context, stream string, connect func() error) {
+	wait := time.Second
+	for {
+		start := time.Now()
+		err := connect()
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			// the connection was healthy for a while, start backing off from scratch
+			wait = time.Second
+		}
+		log.Printf("Binance stream %s disconnected: %v, reconnecting in %s", stream, err, wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, time.Minute)
+	}
+}
+
+// readStream runs one connection: subscribe, then read until it fails
+func (b *BinanceAdapter) readStream(ctx context.Context, stream string, read func(next func(v interface{}) error) error) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, b.wsURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// unblock reads when the subscriber goes away
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	sub := map[string]interface{}{"method": "SUBSCRIBE", "params": []string{stream}, "id": 1}
+	if err := conn.WriteJSON(sub); err != nil {
+		return err
+	}
+	log.Printf("Subscribed to Binance stream %s", stream)
+	return readConn(conn, read)
+}
+
+// readConn reads conn with read until it fails
+func readConn(conn *websocket.Conn, read func(next func(v interface{}) error) error) error {
+	// Binance pings every few minutes, the default handler answers them
+	const idle = 10 * time.Minute
+	conn.SetReadDeadline(time.Now().Add(idle))
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(idle))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(5*time.Second))
+	})
+
+	return read(func(v interface{}) error {
+		if err := conn.ReadJSON(v); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(idle))
+		return nil
+	})
+}
+
+func (ev binanceKlineEvent) candle() (engine.Candle, error) {
+	var vals [5]float64
+	for i, s := range []string{ev.K.Open, ev.K.High, ev.K.Low, ev.K.Close, ev.K.Volume} {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return engine.Candle{}, err
+		}
+		vals[i] = f
+	}
+	return engine.Candle{
+		Time:   time.UnixMilli(ev.K.Start),
+		Open:   vals[0],
+		High:   vals[1],
+		Low:    vals[2],
+		Close:  vals[3],
+		Volume: vals[4],
+	}, nil
+}
+
+// binanceDepthStream names the partial book stream holding at least depth levels
+func binanceDepthStream(symbol string, depth int) (string, error) {
+	for _, levels := range []int{5, 10, 20} {
+		if depth > 0 && depth <= levels {
+			return fmt.Sprintf("%s@depth%d@100ms", strings.ToLower(symbol), levels), nil
+		}
+	}
+	return "", fmt.Errorf("binance streams 1 to 20 book levels, not %d", depth)
+}
+
+func binanceKlineStream(symbol string, interval int64) (string, error) {
+	name, ok := binanceKlineIntervals[interval]
+	if !ok {
+		return "", fmt.Errorf("binance has no %ds kline interval", interval)
+	}
+	return strings.ToLower(symbol) + "@kline_" + name, nil
+}
+
+func (ev binanceAggTradeEvent) trade(symbol string) (engine.Trade, error) {
+	price, err := strconv.ParseFloat(ev.Price, 64)
+	if err != nil {
+		return engine.Trade{}, err
+	}
+	size, err := strconv.ParseFloat(ev.Quantity, 64)
+	if err != nil {
+		return engine.Trade{}, err
+	}
+	// the maker bought, so the taker sold
+	side := engine.SideBuy
+	if ev.BuyerIsMaker {
+		side = engine.SideSell
+	}
+	return engine.Trade{Symbol: symbol, Price: price, Size: size, Side: side, Time: time.UnixMilli(ev.Time)}, nil
+}
+
+func (ev binanceDepthEvent) book(symbol string, depth int) (engine.OrderBook, error) {
+	book := engine.OrderBook{Symbol: symbol, Time: time.Now()}
+	var err error
+	if book.Bids, err = binanceLevels(ev.Bids, depth); err != nil {
+		return engine.OrderBook{}, err
+	}
+	if book.Asks, err = binanceLevels(ev.Asks, depth); err != nil {
+		return engine.OrderBook{}, err
+	}
+	return book, nil
+}
+
+// binanceLevels parses up to depth price and quantity pairs
+func binanceLevels(raw [][2]string, depth int) ([]engine.BookLevel, error) {
+	out := make([]engine.BookLevel, 0, min(len(raw), depth))
+	for _, l := range raw[:min(len(raw), depth)] {
+		price, err := strconv.ParseFloat(l[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseFloat(l[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, engine.BookLevel{Price: price, Size: size})
+	}
+	return out, nil
+}
@@ -0,0 +1,97 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+)
+
+// ChaosConfig injects faults into the MockExchange. Rates are probabilities
+// in [0,1]; method keys are ExchangeAdapter method names, e.g. "PlaceOrder".
+// The same seed and call sequence always produce the same faults.
+type ChaosConfig struct {
+	Enabled           bool               `json:"enabled"`
+	Seed              int64              `json:"seed"`
+	ErrorRate         map[string]float64 `json:"error_rate,omitempty"`
+	TimeoutRate       map[string]float64 `json:"timeout_rate,omitempty"`
+	TimeoutMs         int64              `json:"timeout_ms,omitempty"` // how long a forced timeout hangs, 0 waits for ctx
+	OutOfOrderRate    float64            `json:"out_of_order_rate,omitempty"`
+	DuplicateFillRate float64            `json:"duplicate_fill_rate,omitempty"`
+}
+
+// ErrChaos marks errors injected by chaos testing. They stand for the
+// transient failures of a real exchange and unwrap to engine.ErrNetworkTimeout.
+type ErrChaos struct {
+	Method string
+}
+
+func (e *ErrChaos) Error() string {
+	return fmt.Sprintf("chaos: injected %s failure", e.Method)
+}
+
+func (e *ErrChaos) Unwrap() error { return engine.ErrNetworkTimeout }
+
+type chaos struct {
+	mt  sync.Mutex
+	cfg ChaosConfig
+	rnd *rand.Rand
+}
+
+func (c *chaos) set(cfg ChaosConfig) {
+	c.mt.Lock()
+	defer c.mt.Unlock()
+	c.cfg = cfg
+	c.rnd = rand.New(rand.NewSource(cfg.Seed))
+}
+
+func (c *chaos) config() ChaosConfig {
+	c.mt.Lock()
+	defer c.mt.Unlock()
+	return c.cfg
+}
+
+// roll reports whether an event with probability p happens
+func (c *chaos) roll(p float64) bool {
+	c.mt.Lock()
+	defer c.mt.Unlock()
+	if !c.cfg.Enabled || p <= 0 || c.rnd == nil {
+		return false
+	}
+	return c.rnd.Float64() < p
+}
+
+// inject returns a forced error or hangs like a timeout for method
+func (c *chaos) inject(ctx context.Context, method string) error {
+	cfg := c.config()
+	if !cfg.Enabled {
+		return nil
+	}
+	if c.roll(cfg.TimeoutRate[method]) {
+		var after <-chan time.Time
+		if cfg.TimeoutMs > 0 {
+			after = time.After(time.Duration(cfg.TimeoutMs) * time.Millisecond)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-after:
+			return context.DeadlineExceeded
+		}
+	}
+	if c.roll(cfg.ErrorRate[method]) {
+		return &ErrChaos{Method: method}
+	}
+	return nil
+}
+
+func (c *chaos) outOfOrder() bool {
+	return c.roll(c.config().OutOfOrderRate)
+}
+
+func (c *chaos) duplicateFill() bool {
+	return c.roll(c.config().DuplicateFillRate)
+}
@@ -0,0 +1,603 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/secrets"
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+const coinbaseHost = "api.coinbase.com"
+
+// CoinbaseAdapter trades on Coinbase Advanced Trade. The credentials are a
+// CDP API key name and its EC private key in PEM form.
+type CoinbaseAdapter struct {
+	creds   *secrets.Credentials
+	client  *http.Client
+	baseURL string
+	wsURL   string
+	mt      sync.Mutex
+	db      store.Store
+	limit   *limiter
+	priceSource
+}
+
+// coinbaseRateLimit is the private requests Coinbase allows a second
+var coinbaseRateLimit = RateLimit{Capacity: 30, Window: time.Second, MaxWait: 10 * time.Second}
+
+func NewCoinbaseAdapter(creds *secrets.Credentials, db store.Store) (engine.ExchangeAdapter, error) {
+	_, secret := creds.Get()
+	if _, err := parseCoinbaseKey(secret); err != nil {
+		return nil, err
+	}
+	return &CoinbaseAdapter{
+		creds:   creds,
+		client:  &http.Client{Timeout: 15 * time.Second},
+		baseURL: "https://" + coinbaseHost,
+		wsURL:   coinbaseWSURL,
+		db:      db,
+		limit:   newLimiter("coinbase", coinbaseRateLimit),
+	}, nil
+}
+
+// SetRateLimit changes the request budget, zero fields keep Coinbase's limits
+func (c *CoinbaseAdapter) SetRateLimit(cfg RateLimit) {
+	c.limit.set(cfg)
+}
+
+// --- internal helpers --------------------------------------------------------
+
+// parseCoinbaseKey reads the EC private key, accepting "\n" escaped PEM from env files
+func parseCoinbaseKey(secret string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(secret, `\n`, "\n")))
+	if block == nil {
+		return nil, errors.New("coinbase: API secret is not a PEM private key")
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("coinbase: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("coinbase: API secret is not an EC private key")
+	}
+	return key, nil
+}
+
+// jwt builds the short lived ES256 token Coinbase expects on every REST call
+func (c *CoinbaseAdapter) jwt(method, path string) (string, error) {
+	keyName, secret := c.creds.Get()
+	key, err := parseCoinbaseKey(secret)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	now := time.Now().Unix()
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "typ": "JWT", "kid": keyName, "nonce": hex.EncodeToString(nonce)})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": "cdp",
+		"sub": keyName,
+		"nbf": now,
+		"exp": now + 120,
+		"uri": method + " " + coinbaseHost + path,
+	})
+	enc := base64.RawURLEncoding
+	signing := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signing))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signing + "." + enc.EncodeToString(sig), nil
+}
+
+func (c *CoinbaseAdapter) do(ctx context.Context, method, path string, query url.Values, body interface{}) (out []byte, err error) {
+	status := 0
+	ctx, span := startHTTPSpan(ctx, c.AdapterName(), method, path)
+	defer func() { endHTTPSpan(span, status, err) }()
+
+	// the token is good for two minutes from when it is signed, after any wait for the rate limit
+	if err := c.limit.wait(ctx, method, path); err != nil {
+		return nil, err
+	}
+	token, err := c.jwt(method, path)
+	if err != nil {
+		return nil, err
+	}
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(b)
+	}
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, method, target, payload)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, transportError(ctx, "coinbase", err)
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+	c.limit.backoff(resp)
+
+	out, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(out, &e); err != nil || e.Error == "" {
+			return nil, answerError("coinbase", resp, engine.ErrRejected, "", string(out))
+		}
+		return nil, answerError("coinbase", resp, coinbaseClass(e.Error+" "+e.Message), e.Error, e.Message)
+	}
+	return out, nil
+}
+
+// coinbaseClass sorts the error or failure reason of a Coinbase answer
+func coinbaseClass(reason string) error {
+	reason = strings.ToUpper(reason)
+	switch {
+	case strings.Contains(reason, "INSUFFICIENT_FUND"):
+		return engine.ErrInsufficientFunds
+	case strings.Contains(reason, "PRODUCT_ID") || strings.Contains(reason, "INELIGIBLE_PAIR"):
+		return engine.ErrInvalidSymbol
+	case strings.Contains(reason, "TOO_SMALL"):
+		return engine.ErrMinNotional
+	}
+	return engine.ErrRejected
+}
+
+// coinbaseProduct turns an engine symbol such as BTCUSD into a product id such as BTC-USD
+func coinbaseProduct(symbol string) (string, error) {
+	base, quote, err := parseSymbol(symbol)
+	if err != nil {
+		return "", err
+	}
+	return base + "-" + quote, nil
+}
+
+// --- interface implementations -----------------------------------------------
+
+func (c *CoinbaseAdapter) AdapterName() string {
+	return "Coinbase"
+}
+
+// PlaceOrder submits an order. Coinbase acknowledges orders before they
+// execute, so the order comes back NEW and fills arrive through GetOrder.
+func (c *CoinbaseAdapter) PlaceOrder(ctx context.Context, o engine.Order) (engine.Order, error) {
+	product, err := coinbaseProduct(o.Symbol)
+	if err != nil {
+		return o, err
+	}
+	clientID := o.ClientOrderID
+	if clientID == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return o, err
+		}
+		clientID = hex.EncodeToString(b)
+	}
+
+	var config map[string]interface{}
+	switch {
+	case o.Type == engine.OrderMarket && o.Side == engine.SideBuy:
+		// market buys are sized in quote currency
+		price, err := c.marketPrice(o)
+		if err != nil {
+			return o, err
+		}
+		config = map[string]interface{}{"market_market_ioc": map[string]string{"quote_size": o.Quantity.Mul(price).StringFixed(2)}}
+	case o.Type == engine.OrderMarket:
+		config = map[string]interface{}{"market_market_ioc": map[string]string{"base_size": o.Quantity.String()}}
+	case o.TimeInForce == engine.TimeInForceGTT:
+		config = map[string]interface{}{"limit_limit_gtd": map[string]interface{}{
+			"base_size":   o.Quantity.String(),
+			"limit_price": o.Price.String(),
+			"end_time":    o.ExpireAt.UTC().Format(time.RFC3339),
+			"post_only":   false,
+		}}
+	case o.TimeInForce == engine.TimeInForceIOC:
+		config = map[string]interface{}{"sor_limit_ioc": map[string]string{
+			"base_size":   o.Quantity.String(),
+			"limit_price": o.Price.String(),
+		}}
+	case o.TimeInForce == engine.TimeInForceFOK:
+		config = map[string]interface{}{"limit_limit_fok": map[string]string{
+			"base_size":   o.Quantity.String(),
+			"limit_price": o.Price.String(),
+		}}
+	default:
+		config = map[string]interface{}{"limit_limit_gtc": map[string]interface{}{
+			"base_size":   o.Quantity.String(),
+			"limit_price": o.Price.String(),
+			"post_only":   false,
+		}}
+	}
+	req := map[string]interface{}{
+		"client_order_id":     clientID,
+		"product_id":          product,
+		"side":                string(o.Side),
+		"order_configuration": config,
+	}
+
+	c.mt.Lock()
+	body, err := c.do(ctx, "POST", "/api/v3/brokerage/orders", nil, req)
+	c.mt.Unlock()
+	if err != nil {
+		return o, err
+	}
+
+	var resp struct {
+		Success         bool `json:"success"`
+		SuccessResponse struct {
+			OrderID string `json:"order_id"`
+		} `json:"success_response"`
+		ErrorResponse struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+			Details string `json:"error_details"`
+			Reason  string `json:"new_order_failure_reason"`
+		} `json:"error_response"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return o, err
+	}
+	if !resp.Success {
+		e := resp.ErrorResponse
+		return o, &engine.ExchangeError{
+			Exchange: "coinbase",
+			Class:    coinbaseClass(e.Error + " " + e.Reason),
+			Code:     e.Error,
+			Message:  strings.TrimSpace(e.Message + " " + e.Details),
+		}
+	}
+
+	o.ID = resp.SuccessResponse.OrderID
+	o.Created = time.Now().Unix()
+	o.Status = engine.OrderStatusNew
+	return o, nil
+}
+
+// GetSymbolInfo reads the increments and minimum sizes of the product of symbol
+func (c *CoinbaseAdapter) GetSymbolInfo(ctx context.Context, symbol string) (engine.SymbolInfo, error) {
+	product, err := coinbaseProduct(symbol)
+	if err != nil {
+		return engine.SymbolInfo{}, err
+	}
+	c.mt.Lock()
+	body, err := c.do(ctx, "GET", "/api/v3/brokerage/products/"+url.PathEscape(product), nil, nil)
+	c.mt.Unlock()
+	if err != nil {
+		return engine.SymbolInfo{}, err
+	}
+
+	var resp struct {
+		PriceIncrement decimal.Decimal `json:"price_increment"`
+		BaseIncrement  decimal.Decimal `json:"base_increment"`
+		BaseMinSize    decimal.Decimal `json:"base_min_size"`
+		QuoteMinSize   decimal.Decimal `json:"quote_min_size"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return engine.SymbolInfo{}, err
+	}
+	return engine.SymbolInfo{
+		Symbol:         symbol,
+		TickSize:       resp.PriceIncrement,
+		StepSize:       resp.BaseIncrement,
+		MinQty:         resp.BaseMinSize,
+		MinNotional:    resp.QuoteMinSize,
+		PricePrecision: engine.Precision(resp.PriceIncrement),
+		QtyPrecision:   engine.Precision(resp.BaseIncrement),
+	}, nil
+}
+
+// GetOrder returns the status, executed size and fees of an order
+func (c *CoinbaseAdapter) GetOrder(ctx context.Context, symbol, orderID string) (engine.Order, error) {
+	c.mt.Lock()
+	body, err := c.do(ctx, "GET", "/api/v3/brokerage/orders/historical/"+url.PathEscape(orderID), nil, nil)
+	c.mt.Unlock()
+	if err != nil {
+		return engine.Order{}, err
+	}
+
+	var resp struct {
+		Order struct {
+			Status             string          `json:"status"`
+			FilledSize         decimal.Decimal `json:"filled_size"`
+			AverageFilledPrice decimal.Decimal `json:"average_filled_price"`
+			TotalFees          decimal.Decimal `json:"total_fees"`
+		} `json:"order"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return engine.Order{}, err
+	}
+
+	o := engine.Order{
+		ID:          orderID,
+		Symbol:      symbol,
+		FilledQty:   resp.Order.FilledSize,
+		FilledPrice: resp.Order.AverageFilledPrice,
+		Fee:         resp.Order.TotalFees,
+		Status:      coinbaseOrderStatus(resp.Order.Status, resp.Order.FilledSize),
+	}
+	o.Filled = o.Status == engine.OrderStatusFilled
+	if o.Filled {
+		// market buys are sized in quote currency, the base size is known once filled
+		o.Quantity = resp.Order.FilledSize
+	}
+	return o, nil
+}
+
+// coinbaseOrderStatus maps Coinbase order states onto the engine lifecycle
+func coinbaseOrderStatus(s string, filled decimal.Decimal) engine.OrderStatus {
+	switch s {
+	case "FILLED":
+		return engine.OrderStatusFilled
+	case "CANCELLED", "EXPIRED":
+		return engine.OrderStatusCanceled
+	case "FAILED":
+		return engine.OrderStatusRejected
+	}
+	// PENDING, OPEN, QUEUED and CANCEL_QUEUED are still working
+	if filled.IsPositive() {
+		return engine.OrderStatusPartiallyFilled
+	}
+	return engine.OrderStatusNew
+}
+
+// ExpiresOrders implements engine.ExpiringExchange, GTT orders are placed
+// good till date
+func (c *CoinbaseAdapter) ExpiresOrders() bool { return true }
+
+func (c *CoinbaseAdapter) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	return c.cancel(ctx, []string{orderID})
+}
+
+// CancelAllOrders cancels the orders still open on the product of symbol
+func (c *CoinbaseAdapter) CancelAllOrders(ctx context.Context, symbol string) error {
+	open, err := c.GetOpenOrders(ctx, symbol)
+	if err != nil || len(open) == 0 {
+		return err
+	}
+	ids := make([]string, len(open))
+	for i, o := range open {
+		ids[i] = o.ID
+	}
+	return c.cancel(ctx, ids)
+}
+
+// GetOpenOrders returns the orders still open on the product of symbol
+func (c *CoinbaseAdapter) GetOpenOrders(ctx context.Context, symbol string) ([]engine.Order, error) {
+	product, err := coinbaseProduct(symbol)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("product_ids", product)
+	query.Set("order_status", "OPEN")
+	c.mt.Lock()
+	body, err := c.do(ctx, "GET", "/api/v3/brokerage/orders/historical/batch", query, nil)
+	c.mt.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Orders []struct {
+			OrderID            string          `json:"order_id"`
+			ClientOrderID      string          `json:"client_order_id"`
+			Side               string          `json:"side"`
+			Status             string          `json:"status"`
+			FilledSize         decimal.Decimal `json:"filled_size"`
+			AverageFilledPrice decimal.Decimal `json:"average_filled_price"`
+			TotalFees          decimal.Decimal `json:"total_fees"`
+			CreatedTime        time.Time       `json:"created_time"`
+			Config             struct {
+				Limit *struct {
+					BaseSize   decimal.Decimal `json:"base_size"`
+					LimitPrice decimal.Decimal `json:"limit_price"`
+				} `json:"limit_limit_gtc"`
+			} `json:"order_configuration"`
+		} `json:"orders"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	out := make([]engine.Order, 0, len(resp.Orders))
+	for _, r := range resp.Orders {
+		o := engine.Order{
+			ID:            r.OrderID,
+			ClientOrderID: r.ClientOrderID,
+			Symbol:        symbol,
+			Side:          engine.Side(r.Side),
+			Type:          engine.OrderMarket,
+			FilledQty:     r.FilledSize,
+			FilledPrice:   r.AverageFilledPrice,
+			Fee:           r.TotalFees,
+			Status:        coinbaseOrderStatus(r.Status, r.FilledSize),
+			Created:       r.CreatedTime.Unix(),
+		}
+		if l := r.Config.Limit; l != nil {
+			o.Type, o.Quantity, o.Price = engine.OrderLimit, l.BaseSize, l.LimitPrice
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// cancel cancels orderIDs in one batch, failing if any of them could not be
+func (c *CoinbaseAdapter) cancel(ctx context.Context, orderIDs []string) error {
+	c.mt.Lock()
+	body, err := c.do(ctx, "POST", "/api/v3/brokerage/orders/batch_cancel", nil, map[string][]string{"order_ids": orderIDs})
+	c.mt.Unlock()
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Results []struct {
+			Success       bool   `json:"success"`
+			FailureReason string `json:"failure_reason"`
+			OrderID       string `json:"order_id"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return err
+	}
+	if len(resp.Results) == 0 {
+		return fmt.Errorf("coinbase could not cancel %s: no result", strings.Join(orderIDs, ", "))
+	}
+	var errs []error
+	for _, r := range resp.Results {
+		if !r.Success {
+			errs = append(errs, fmt.Errorf("coinbase could not cancel %s: %s", r.OrderID, r.FailureReason))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ping implements engine.HealthChecker by reading the server time
+func (c *CoinbaseAdapter) Ping(ctx context.Context) error {
+	c.mt.Lock()
+	defer c.mt.Unlock()
+	_, err := c.do(ctx, "GET", "/api/v3/brokerage/time", nil, nil)
+	return err
+}
+
+// ServerTime implements engine.TimeSyncer, the JWTs of requests are only
+// valid for two minutes of it
+func (c *CoinbaseAdapter) ServerTime(ctx context.Context) (time.Time, error) {
+	c.mt.Lock()
+	body, err := c.do(ctx, "GET", "/api/v3/brokerage/time", nil, nil)
+	c.mt.Unlock()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var resp struct {
+		EpochMillis string `json:"epochMillis"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return time.Time{}, err
+	}
+	millis, err := strconv.ParseInt(resp.EpochMillis, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("coinbase server time %q: %w", resp.EpochMillis, err)
+	}
+	return time.UnixMilli(millis), nil
+}
+
+// GetBalances returns the available balance of every account, following pagination
+func (c *CoinbaseAdapter) GetBalances(ctx context.Context) (map[string]decimal.Decimal, error) {
+	out := make(map[string]decimal.Decimal)
+	query := url.Values{"limit": {"250"}}
+	for {
+		c.mt.Lock()
+		body, err := c.do(ctx, "GET", "/api/v3/brokerage/accounts", query, nil)
+		c.mt.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Accounts []struct {
+				Currency         string `json:"currency"`
+				AvailableBalance struct {
+					Value decimal.Decimal `json:"value"`
+				} `json:"available_balance"`
+			} `json:"accounts"`
+			HasNext bool   `json:"has_next"`
+			Cursor  string `json:"cursor"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		for _, a := range page.Accounts {
+			out[a.Currency] = out[a.Currency].Add(a.AvailableBalance.Value)
+		}
+		if !page.HasNext || page.Cursor == "" {
+			return out, nil
+		}
+		query.Set("cursor", page.Cursor)
+	}
+}
+
+// GetPosition reports the spot holding of the symbol's base asset
+func (c *CoinbaseAdapter) GetPosition(ctx context.Context, symbol string) (engine.Position, error) {
+	base, _, err := parseSymbol(symbol)
+	if err != nil {
+		return engine.Position{Symbol: symbol}, err
+	}
+	balances, err := c.GetBalances(ctx)
+	if err != nil {
+		return engine.Position{Symbol: symbol}, err
+	}
+	return engine.Position{
+		Symbol:   symbol,
+		Quantity: balances[base],
+	}, nil
+}
+
+// SubscribeCandles builds candles of interval seconds from the public trade feed
+func (c *CoinbaseAdapter) SubscribeCandles(ctx context.Context, symbol string, interval int64) (<-chan engine.Candle, error) {
+	product, err := coinbaseProduct(symbol)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("coinbase: invalid candle interval %d", interval)
+	}
+	ch := make(chan engine.Candle, 1024)
+	go c.streamTrades(ctx, product, time.Duration(interval)*time.Second, ch)
+	return ch, nil
+}
+
+// SubscribeTrades is not supported yet, the trade feed only builds candles
+func (c *CoinbaseAdapter) SubscribeTrades(ctx context.Context, symbol string) (<-chan engine.Trade, error) {
+	return nil, engine.ErrNoTradeStream
+}
+
+// SubscribeOrderBook is not supported yet
+func (c *CoinbaseAdapter) SubscribeOrderBook(ctx context.Context, symbol string, depth int) (<-chan engine.OrderBook, error) {
+	return nil, engine.ErrNoOrderBook
+}
@@ -0,0 +1,204 @@
+package exchange
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/omept/trading-engine/pkg/engine"
+)
+
+const coinbaseWSURL = "wss://advanced-trade-ws.coinbase.com"
+
+// coinbaseTradeGrace is how long a candle stays open past its end for late trades
+const coinbaseTradeGrace = 2 * time.Second
+
+type coinbaseMessage struct {
+	Channel string `json:"channel"`
+	Events  []struct {
+		Type   string `json:"type"`
+		Trades []struct {
+			Price string    `json:"price"`
+			Size  string    `json:"size"`
+			Time  time.Time `json:"time"`
+		} `json:"trades"`
+	} `json:"events"`
+}
+
+// streamTrades keeps the trade feed of product open, reconnecting with
+// backoff, and sends each finished candle to ch until ctx is done
+func (c *CoinbaseAdapter) streamTrades(ctx context.Context, product string, step time.Duration, ch chan<- engine.Candle) {
+	defer close(ch)
+	wait := time.Second
+	var last time.Time
+	for {
+		start := time.Now()
+		err := c.readTrades(ctx, product, step, ch, &last)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			// the connection was healthy for a while, start backing off from scratch
+			wait = time.Second
+		}
+		log.Printf("Coinbase %s trade feed disconnected: %v, reconnecting in %s", product, err, wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, time.Minute)
+	}
+}
+
+// readTrades runs one connection: subscribe, then aggregate trades until it fails.
+// last holds the newest candle sent so a reconnect never repeats one.
+func (c *CoinbaseAdapter) readTrades(ctx context.Context, product string, step time.Duration, ch chan<- engine.Candle, last *time.Time) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, c.wsURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// unblock reads when the subscriber goes away
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// heartbeats keep the connection open while the market is quiet
+	for _, channel := range []string{"market_trades", "heartbeats"} {
+		sub := map[string]interface{}{"type": "subscribe", "product_ids": []string{product}, "channel": channel}
+		if err := conn.WriteJSON(sub); err != nil {
+			return err
+		}
+	}
+	log.Printf("Subscribed to Coinbase %s trades", product)
+
+	msgs := make(chan coinbaseMessage)
+	errc := make(chan error, 1)
+	go func() {
+		const idle = 30 * time.Second
+		for {
+			conn.SetReadDeadline(time.Now().Add(idle))
+			var msg coinbaseMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				errc <- err
+				return
+			}
+			if msg.Channel != "market_trades" {
+				continue
+			}
+			select {
+			case msgs <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	send := func(candle engine.Candle) error {
+		if !candle.Time.After(*last) {
+			return nil
+		}
+		*last = candle.Time
+		select {
+		case ch <- candle:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// the first bucket started before this connection saw all of its trades
+	b := &tradeCandles{step: step, partial: true}
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errc:
+			return err
+		case now := <-tick.C:
+			if candle, ok := b.flush(now); ok {
+				if err := send(candle); err != nil {
+					return err
+				}
+			}
+		case msg := <-msgs:
+			for _, ev := range msg.Events {
+				if ev.Type != "update" {
+					// snapshots replay older trades
+					continue
+				}
+				// updates list the newest trade first
+				for i := len(ev.Trades) - 1; i >= 0; i-- {
+					t := ev.Trades[i]
+					price, err1 := strconv.ParseFloat(t.Price, 64)
+					size, err2 := strconv.ParseFloat(t.Size, 64)
+					if err1 != nil || err2 != nil {
+						log.Printf("Coinbase %s: bad trade %+v", product, t)
+						continue
+					}
+					if candle, ok := b.add(price, size, t.Time); ok {
+						if err := send(candle); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// tradeCandles aggregates trades into candles of step. Buckets without
+// trades produce no candle.
+type tradeCandles struct {
+	step    time.Duration
+	cur     engine.Candle
+	open    bool // cur has at least one trade
+	partial bool // cur is missing trades from before the feed started
+}
+
+// add folds a trade in and returns the previous candle once a trade of a later bucket arrives
+func (b *tradeCandles) add(price, size float64, at time.Time) (engine.Candle, bool) {
+	start := at.Truncate(b.step)
+	if b.open && start.Before(b.cur.Time) {
+		// too late, that candle is already out
+		return engine.Candle{}, false
+	}
+
+	var done engine.Candle
+	var ok bool
+	if b.open && start.After(b.cur.Time) {
+		done, ok = b.close()
+	}
+	if !b.open {
+		b.cur = engine.Candle{Time: start, Open: price, High: price, Low: price, Close: price, Volume: size}
+		b.open = true
+		return done, ok
+	}
+	b.cur.High = max(b.cur.High, price)
+	b.cur.Low = min(b.cur.Low, price)
+	b.cur.Close = price
+	b.cur.Volume += size
+	return done, ok
+}
+
+// flush closes the current candle once its bucket and the grace period are over
+func (b *tradeCandles) flush(now time.Time) (engine.Candle, bool) {
+	if !b.open || now.Before(b.cur.Time.Add(b.step+coinbaseTradeGrace)) {
+		return engine.Candle{}, false
+	}
+	return b.close()
+}
+
+func (b *tradeCandles) close() (engine.Candle, bool) {
+	b.open = false
+	if b.partial {
+		b.partial = false
+		return engine.Candle{}, false
+	}
+	return b.cur, true
+}
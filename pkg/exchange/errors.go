@@ -0,0 +1,53 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+)
+
+// statusClass is the error class an HTTP status tells on its own, nil when
+// the body of the answer has to
+func statusClass(status int) error {
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusTeapot:
+		return engine.ErrRateLimited
+	case status == http.StatusRequestTimeout || status >= 500:
+		return engine.ErrNetworkTimeout
+	}
+	return nil
+}
+
+// retryAfter is the wait the Retry-After header of resp asks for, zero without one
+func retryAfter(resp *http.Response) time.Duration {
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
+
+// answerError is the error of an answer resp of exchange, its class taken
+// from the status when that tells it and from class otherwise
+func answerError(exchange string, resp *http.Response, class error, code, msg string) error {
+	if c := statusClass(resp.StatusCode); c != nil {
+		class = c
+	}
+	e := &engine.ExchangeError{Exchange: exchange, Class: class, Code: code, Message: msg}
+	if class == engine.ErrRateLimited {
+		e.RetryAfter = retryAfter(resp)
+	}
+	return e
+}
+
+// transportError is the error of a request to exchange that got no answer.
+// The caller's own cancellations and deadlines are left as they are.
+func transportError(ctx context.Context, exchange string, err error) error {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	return &engine.ExchangeError{Exchange: exchange, Class: engine.ErrNetworkTimeout, Message: err.Error()}
+}
@@ -0,0 +1,87 @@
+package exchange
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/shopspring/decimal"
+)
+
+// Slippage models of FillModel
+const (
+	SlippageNone   = "none"
+	SlippageSpread = "spread"
+	SlippageImpact = "impact"
+)
+
+var bps = decimal.NewFromInt(10000)
+
+// FillModel makes the MockExchange charge fees and slip fills the way a real
+// venue does, so backtests and paper trading are not too optimistic. The
+// zero value fills for free at the expected price.
+type FillModel struct {
+	MakerBps float64 `json:"maker_bps"` // fee on limit orders, in basis points of the notional
+	TakerBps float64 `json:"taker_bps"` // fee on market orders
+	// Slippage moves market fills against the order: none, spread or impact
+	Slippage  string  `json:"slippage,omitempty"`
+	SpreadBps float64 `json:"spread_bps,omitempty"` // spread: market orders cross half of this spread
+	ImpactBps float64 `json:"impact_bps,omitempty"` // impact: slippage of an order as large as the last candle's volume, less for smaller ones
+}
+
+// Validate rejects negative rates and unknown slippage models
+func (f FillModel) Validate() error {
+	if f.MakerBps < 0 || f.TakerBps < 0 || f.SpreadBps < 0 || f.ImpactBps < 0 {
+		return fmt.Errorf("fill model rates must not be negative")
+	}
+	switch f.Slippage {
+	case "", SlippageNone, SlippageSpread, SlippageImpact:
+		return nil
+	}
+	return fmt.Errorf("unknown slippage model %q, known: %s, %s, %s", f.Slippage, SlippageNone, SlippageSpread, SlippageImpact)
+}
+
+// slip returns the price a market order of qty fills at when price is
+// expected and volume traded in the last candle
+func (f FillModel) slip(side engine.Side, price, qty decimal.Decimal, volume float64) decimal.Decimal {
+	var slippage decimal.Decimal
+	switch f.Slippage {
+	case SlippageSpread:
+		slippage = decimal.NewFromFloat(f.SpreadBps).Div(bps).Div(decimal.NewFromInt(2))
+	case SlippageImpact:
+		if volume > 0 {
+			slippage = decimal.NewFromFloat(f.ImpactBps).Div(bps).Mul(qty).Div(decimal.NewFromFloat(volume))
+		}
+	}
+	if slippage.IsZero() {
+		return price
+	}
+	if side == engine.SideSell {
+		slippage = slippage.Neg()
+	}
+	return price.Mul(decimal.NewFromInt(1).Add(slippage)).Round(8)
+}
+
+// fee is what a fill of notional pays, in the quote asset
+func (f FillModel) fee(t engine.OrderType, notional decimal.Decimal) decimal.Decimal {
+	rate := f.TakerBps
+	if t == engine.OrderLimit {
+		rate = f.MakerBps
+	}
+	return notional.Mul(decimal.NewFromFloat(rate)).Div(bps).Round(8)
+}
+
+// SetFillModel replaces the fees and slippage simulated fills pay
+func (m *MockExchange) SetFillModel(f FillModel) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.fills = f
+	log.Printf("Mock exchange fill model updated (maker=%gbps taker=%gbps slippage=%s)", f.MakerBps, f.TakerBps, f.Slippage)
+}
+
+// FillModel returns the fees and slippage simulated fills pay
+func (m *MockExchange) FillModel() FillModel {
+	m.mt.RLock()
+	defer m.mt.RUnlock()
+	return m.fills
+}
@@ -0,0 +1,206 @@
+package exchange
+
+import (
+	"log"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/shopspring/decimal"
+)
+
+var year = decimal.NewFromInt(int64(365 * 24 * time.Hour / time.Second))
+
+// MarginConfig lets the MockExchange go short by borrowing the base asset.
+// Interest and liquidation run on the candle clock so backtests behave the
+// same as live paper trading.
+type MarginConfig struct {
+	Enabled bool `json:"enabled"`
+	// Leverage caps borrowed value at equity * Leverage, defaults to 1
+	Leverage decimal.Decimal `json:"leverage"`
+	// BorrowRate is the yearly interest on borrowed value, charged in the quote asset
+	BorrowRate decimal.Decimal `json:"borrow_rate"`
+	// MaintenanceMargin is the equity / borrowed value ratio below which shorts are bought back
+	MaintenanceMargin decimal.Decimal `json:"maintenance_margin"`
+}
+
+// MarginStatus reports the mock account's margin usage
+type MarginStatus struct {
+	Config       MarginConfig    `json:"config"`
+	Equity       decimal.Decimal `json:"equity"`
+	Borrowed     decimal.Decimal `json:"borrowed"`
+	InterestPaid decimal.Decimal `json:"interest_paid"`
+	Liquidations int             `json:"liquidations"`
+}
+
+type margin struct {
+	cfg          MarginConfig
+	marks        map[string]decimal.Decimal // base asset -> last price
+	accrued      map[string]time.Time       // base asset -> last interest accrual
+	interestPaid decimal.Decimal
+	liquidations int
+}
+
+// SetMargin replaces the margin settings
+func (m *MockExchange) SetMargin(cfg MarginConfig) {
+	if !cfg.Leverage.IsPositive() {
+		cfg.Leverage = decimal.NewFromInt(1)
+	}
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.margin.cfg = cfg
+	log.Printf("Mock exchange margin updated (enabled=%v leverage=%s)", cfg.Enabled, cfg.Leverage)
+}
+
+// CanShort implements engine.ShortSeller, selling short borrows on margin
+func (m *MockExchange) CanShort(symbol string) bool {
+	m.mt.RLock()
+	defer m.mt.RUnlock()
+	return m.margin.cfg.Enabled
+}
+
+// Margin returns the margin settings and current usage
+func (m *MockExchange) Margin() MarginStatus {
+	m.mt.RLock()
+	defer m.mt.RUnlock()
+	return MarginStatus{
+		Config:       m.margin.cfg,
+		Equity:       m.equity(),
+		Borrowed:     m.borrowed(),
+		InterestPaid: m.margin.interestPaid,
+		Liquidations: m.margin.liquidations,
+	}
+}
+
+// equity values every marked asset in its quote asset. Callers hold m.mt.
+func (m *MockExchange) equity() decimal.Decimal {
+	eq := decimal.Zero
+	for asset, bal := range m.balances {
+		if mark, ok := m.margin.marks[asset]; ok {
+			eq = eq.Add(bal.Mul(mark))
+		} else if isCashAsset(asset) {
+			eq = eq.Add(bal)
+		}
+	}
+	return eq
+}
+
+// borrowed is the value of all negative base balances. Callers hold m.mt.
+func (m *MockExchange) borrowed() decimal.Decimal {
+	total := decimal.Zero
+	for asset, mark := range m.margin.marks {
+		if bal := m.balances[asset]; bal.IsNegative() {
+			total = total.Add(bal.Neg().Mul(mark))
+		}
+	}
+	return total
+}
+
+// checkShort decides whether selling amount of base at price may borrow.
+// Callers hold m.mt.
+func (m *MockExchange) checkShort(base string, amount, price decimal.Decimal) error {
+	if !m.margin.cfg.Enabled {
+		return mockError(engine.ErrInsufficientFunds, "insufficient %s balance: need %s", base, amount.StringFixed(4))
+	}
+	after := m.balances[base].Sub(amount)
+	if !after.IsNegative() {
+		return nil
+	}
+	mark := price
+	if cur, ok := m.margin.marks[base]; ok {
+		mark = cur
+	}
+	// value the new borrow at the fill price, existing borrows at their mark
+	borrowed := m.borrowed()
+	if cur := m.balances[base]; cur.IsNegative() {
+		borrowed = borrowed.Sub(cur.Neg().Mul(mark))
+	}
+	borrowed = borrowed.Add(after.Neg().Mul(price))
+
+	limit := m.equity().Mul(m.margin.cfg.Leverage)
+	if borrowed.GreaterThan(limit) {
+		return mockError(engine.ErrInsufficientFunds, "margin limit exceeded: borrowing %s of %s allowed", borrowed.StringFixed(2), limit.StringFixed(2))
+	}
+	return nil
+}
+
+// mark updates the price of symbol's base asset, accrues borrow interest up to
+// at and liquidates shorts once equity drops below maintenance margin
+func (m *MockExchange) mark(symbol string, price float64, at time.Time) {
+	base, quote, err := parseSymbol(symbol)
+	if err != nil || price <= 0 {
+		return
+	}
+	m.mt.Lock()
+	defer m.mt.Unlock()
+
+	mg := &m.margin
+	if mg.marks == nil {
+		mg.marks = make(map[string]decimal.Decimal)
+		mg.accrued = make(map[string]time.Time)
+	}
+	mark := decimal.NewFromFloat(price)
+	mg.marks[base] = mark
+
+	last, seen := mg.accrued[base]
+	mg.accrued[base] = at
+	bal := m.balances[base]
+	if !mg.cfg.Enabled || !bal.IsNegative() {
+		return
+	}
+
+	if seen && at.After(last) && mg.cfg.BorrowRate.IsPositive() {
+		secs := decimal.NewFromFloat(at.Sub(last).Seconds())
+		interest := bal.Neg().Mul(mark).Mul(mg.cfg.BorrowRate).Mul(secs).Div(year)
+		m.balances[quote] = m.balances[quote].Sub(interest)
+		mg.interestPaid = mg.interestPaid.Add(interest)
+	}
+
+	borrowed := m.borrowed()
+	if borrowed.IsPositive() && m.equity().LessThan(borrowed.Mul(mg.cfg.MaintenanceMargin)) {
+		m.liquidate(symbol, base, quote, mark)
+	}
+}
+
+// liquidate buys back the borrowed base at mark. Callers hold m.mt.
+func (m *MockExchange) liquidate(symbol, base, quote string, mark decimal.Decimal) {
+	qty := m.balances[base].Neg()
+	cost := qty.Mul(mark)
+	m.balances[quote] = m.balances[quote].Sub(cost)
+	m.balances[base] = decimal.Zero
+	m.margin.liquidations++
+	m.applyPosition(symbol, engine.SideBuy, qty, mark)
+	log.Printf("Mock exchange liquidated %s %s short at %s", qty, base, mark)
+}
+
+// applyPosition moves the symbol's net position by a fill. Callers hold m.mt.
+func (m *MockExchange) applyPosition(symbol string, side engine.Side, qty, price decimal.Decimal) {
+	p := m.positions[symbol]
+	p.Symbol = symbol
+	delta := qty
+	if side == engine.SideSell {
+		delta = qty.Neg()
+	}
+	next := p.Quantity.Add(delta)
+	switch {
+	case next.IsZero():
+		delete(m.positions, symbol)
+		return
+	case p.Quantity.IsZero() || p.Quantity.Sign() == delta.Sign():
+		// opening or adding, average the entry price
+		p.AvgPrice = p.Quantity.Abs().Mul(p.AvgPrice).Add(qty.Mul(price)).Div(next.Abs())
+	case p.Quantity.Sign() != next.Sign():
+		// flipped through zero, the rest opened at this price
+		p.AvgPrice = price
+	}
+	p.Quantity = next
+	m.positions[symbol] = p
+}
+
+// isCashAsset reports whether asset is valued 1:1 without a mark
+func isCashAsset(asset string) bool {
+	switch asset {
+	case "USD", "USDT", "USDC", "BUSD", "EUR":
+		return true
+	}
+	return false
+}
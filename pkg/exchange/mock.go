@@ -5,47 +5,70 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/omept/trading-engine/pkg/engine"
 	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
 )
 
 type MockExchange struct {
 	mt        sync.RWMutex
-	balances  map[string]float64
+	balances  map[string]decimal.Decimal
 	positions map[string]engine.Position
 	feeds     map[string]chan engine.Candle
 	orders    map[string]engine.Order
-	db        *store.SQLiteStore
+	db        store.Store
+	chaos     chaos
+	flows     []CashFlow
+	seq       int64
+	margin    margin
+	fills     FillModel
+	volumes   map[string]float64 // volume of the last candle by symbol
+	clock     engine.Clock       // stamps orders and cash flows
+	priceSource
 }
 
-func NewMockExchange(bal float64, db *store.SQLiteStore) engine.ExchangeAdapter {
+func NewMockExchange(bal decimal.Decimal, db store.Store) engine.ExchangeAdapter {
 	me := &MockExchange{
-		balances:  map[string]float64{"USD": bal},
+		balances:  map[string]decimal.Decimal{"USD": bal},
 		positions: make(map[string]engine.Position),
 		feeds:     make(map[string]chan engine.Candle),
 		orders:    make(map[string]engine.Order),
+		volumes:   make(map[string]float64),
 		db:        db,
+		clock:     engine.RealClock,
 	}
 	me.SetDefaultBalances()
 	return me
 }
 
+// SetClock sets the clock orders and cash flows are stamped by, backtests
+// hand it their simulated clock
+func (m *MockExchange) SetClock(c engine.Clock) {
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.clock = c
+}
+
 func (m *MockExchange) SetDefaultBalances() {
 	m.mt.Lock()
 	defer m.mt.Unlock()
 
 	// initialize map if nil
 	if m.balances == nil {
-		m.balances = make(map[string]float64)
+		m.balances = make(map[string]decimal.Decimal)
 	}
 
 	// set common defaults
-	m.balances["USDT"] = 10000 // starting quote balance
-	m.balances["BTC"] = 1000.0 // starting base balance
+	m.balances["USDT"] = decimal.NewFromInt(10000) // starting quote balance
+	m.balances["BTC"] = decimal.NewFromInt(1000)   // starting base balance
 }
 
 // PushCandleInBacktest allows the backtester to manually feed candles
@@ -55,69 +78,175 @@ func (m *MockExchange) PushCandleInBacktest(symbol string, c engine.Candle) {
 	m.mt.RUnlock()
 
 	if ok {
+		m.candle(symbol, c)
 		ch <- c
 	}
 }
 
+// SetChaos replaces the fault injection settings and reseeds the generator
+func (m *MockExchange) SetChaos(cfg ChaosConfig) {
+	m.chaos.set(cfg)
+	log.Printf("Mock exchange chaos config updated (enabled=%v seed=%d)", cfg.Enabled, cfg.Seed)
+}
+
+// Chaos returns the current fault injection settings
+func (m *MockExchange) Chaos() ChaosConfig {
+	return m.chaos.config()
+}
+
 func (a *MockExchange) AdapterName() string {
 	return "Mock"
 }
 
 func (m *MockExchange) PlaceOrder(ctx context.Context, o engine.Order) (engine.Order, error) {
+	if err := m.chaos.inject(ctx, "PlaceOrder"); err != nil {
+		return o, err
+	}
 	m.mt.Lock()
 	defer m.mt.Unlock()
 
-	o.ID = "mock_" + time.Now().Format("150405.000")
-	o.Created = time.Now().Unix()
+	// sequence keeps ids unique when many orders land in the same millisecond
+	m.seq++
+	now := m.clock.Now()
+	o.ID = "mock_" + now.Format("150405.000") + "_" + strconv.FormatInt(m.seq, 10)
+	o.Created = now.Unix()
 
 	// immediate fill for MARKET in this mock
 	if o.Type == engine.OrderMarket {
-		o.Filled = true
-
-		// ---- BALANCE ADJUSTMENTS ----
-		base, quote, err := parseSymbol(o.Symbol)
+		price, err := m.marketPrice(o)
 		if err != nil {
 			return o, err
 		}
+		o.Price = price
+		if err := m.settle(&o, m.fills.slip(o.Side, price, o.Quantity, m.volumes[o.Symbol])); err != nil {
+			return o, err
+		}
+		m.orders[o.ID] = o
+		return o, nil
+	}
 
-		amount := o.Quantity // base amount
-		price := o.Price     // assumed available on order
+	o.Status = engine.OrderStatusNew
+	if o.TimeInForce == engine.TimeInForceIOC || o.TimeInForce == engine.TimeInForceFOK {
+		// fills at its limit when the last price crosses it, the mock fills
+		// whole so IOC and FOK are the same
+		last, err := m.marketPrice(engine.Order{Symbol: o.Symbol})
+		crosses := err == nil && (o.Side == engine.SideBuy && !last.GreaterThan(o.Price) || o.Side == engine.SideSell && !last.LessThan(o.Price))
+		o.Status = engine.OrderStatusCanceled
+		if crosses {
+			if err := m.settle(&o, o.Price); err != nil {
+				return o, err
+			}
+		}
+	}
+	m.orders[o.ID] = o
+	return o, nil
+}
 
-		cost := amount * price
+// mockError is an error answer of the mock exchange of class
+func mockError(class error, format string, args ...any) error {
+	return &engine.ExchangeError{Exchange: "mock", Class: class, Message: fmt.Sprintf(format, args...)}
+}
 
-		switch o.Side {
-		case engine.SideBuy:
-			// check sufficient balance
-			if m.balances[quote] < cost {
-				return o, fmt.Errorf("insufficient %s balance: need %.4f", quote, cost)
+// settle fills o at price: balances move by the notional and the fill
+// model's fee, paid in the quote asset. Callers hold m.mt.
+func (m *MockExchange) settle(o *engine.Order, price decimal.Decimal) error {
+	base, quote, err := parseSymbol(o.Symbol)
+	if err != nil {
+		return mockError(engine.ErrInvalidSymbol, "%v", err)
+	}
+	amount := o.Quantity // base amount
+	cost := amount.Mul(price)
+	fee := m.fills.fee(o.Type, cost)
+
+	switch o.Side {
+	case engine.SideBuy:
+		// check sufficient balance
+		if m.balances[quote].LessThan(cost.Add(fee)) {
+			return mockError(engine.ErrInsufficientFunds, "insufficient %s balance: need %s", quote, cost.Add(fee).StringFixed(4))
+		}
+		m.balances[quote] = m.balances[quote].Sub(cost).Sub(fee)
+		m.balances[base] = m.balances[base].Add(amount)
+
+	case engine.SideSell:
+		// check sufficient balance, in margin mode the shortfall is borrowed
+		if m.balances[base].LessThan(amount) {
+			if err := m.checkShort(base, amount, price); err != nil {
+				return err
 			}
-			// deduct quote
-			m.balances[quote] -= cost
-			// add base
-			m.balances[base] += amount
+		}
+		m.balances[base] = m.balances[base].Sub(amount)
+		m.balances[quote] = m.balances[quote].Add(cost).Sub(fee)
+	}
 
+	if m.chaos.duplicateFill() {
+		// the exchange executes the same order twice
+		log.Printf("chaos: duplicate fill of %s", o.ID)
+		switch o.Side {
+		case engine.SideBuy:
+			m.balances[quote] = m.balances[quote].Sub(cost)
+			m.balances[base] = m.balances[base].Add(amount)
 		case engine.SideSell:
-			// check sufficient balance
-			if m.balances[base] < amount {
-				return o, fmt.Errorf("insufficient %s balance: need %.4f", base, amount)
-			}
-			// deduct base
-			m.balances[base] -= amount
-			// add quote
-			m.balances[quote] += cost
+			m.balances[base] = m.balances[base].Sub(amount)
+			m.balances[quote] = m.balances[quote].Add(cost)
 		}
+	}
 
-		// ------------------------------
+	m.applyPosition(o.Symbol, o.Side, amount, price)
+	o.Filled = true
+	o.FilledQty = amount
+	o.FilledPrice = price
+	o.Fee = fee
+	o.Status = engine.OrderStatusFilled
+	return nil
+}
 
-		m.orders[o.ID] = o
-		return o, nil
+// candle marks symbol at the close of c and fills the resting limit orders
+// its range crossed at their limit price
+func (m *MockExchange) candle(symbol string, c engine.Candle) {
+	m.mark(symbol, c.Close, c.Time)
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	m.volumes[symbol] = c.Volume
+
+	var ids []string
+	for id, o := range m.orders {
+		if o.Symbol == symbol && o.Type == engine.OrderLimit && !o.Status.Final() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		o := m.orders[id]
+		limit := o.Price.InexactFloat64()
+		if (o.Side == engine.SideBuy && c.Low > limit) || (o.Side == engine.SideSell && c.High < limit) {
+			continue
+		}
+		if err := m.settle(&o, o.Price); err != nil {
+			log.Printf("Mock exchange canceled %s, it could not fill: %v", id, err)
+			o.Status = engine.OrderStatusCanceled
+		}
+		m.orders[id] = o
 	}
+}
 
-	m.orders[o.ID] = o
+// GetOrder returns the current state of an order placed on the mock
+func (m *MockExchange) GetOrder(ctx context.Context, symbol, orderID string) (engine.Order, error) {
+	if err := m.chaos.inject(ctx, "GetOrder"); err != nil {
+		return engine.Order{}, err
+	}
+	m.mt.RLock()
+	defer m.mt.RUnlock()
+	o, ok := m.orders[orderID]
+	if !ok {
+		return engine.Order{}, errors.New("order not found")
+	}
 	return o, nil
 }
 
 func (m *MockExchange) GetPosition(ctx context.Context, symbol string) (engine.Position, error) {
+	if err := m.chaos.inject(ctx, "GetPosition"); err != nil {
+		return engine.Position{Symbol: symbol}, err
+	}
 	m.mt.RLock()
 	defer m.mt.RUnlock()
 	if p, ok := m.positions[symbol]; ok {
@@ -126,10 +255,18 @@ func (m *MockExchange) GetPosition(ctx context.Context, symbol string) (engine.P
 	return engine.Position{Symbol: symbol}, nil
 }
 
-func (m *MockExchange) GetBalances(ctx context.Context) (map[string]float64, error) {
+// Ping implements engine.HealthChecker, failing only when chaos says so
+func (m *MockExchange) Ping(ctx context.Context) error {
+	return m.chaos.inject(ctx, "Ping")
+}
+
+func (m *MockExchange) GetBalances(ctx context.Context) (map[string]decimal.Decimal, error) {
+	if err := m.chaos.inject(ctx, "GetBalances"); err != nil {
+		return nil, err
+	}
 	m.mt.RLock()
 	defer m.mt.RUnlock()
-	out := make(map[string]float64, len(m.balances))
+	out := make(map[string]decimal.Decimal, len(m.balances))
 	for k, v := range m.balances {
 		out[k] = v
 	}
@@ -137,46 +274,213 @@ func (m *MockExchange) GetBalances(ctx context.Context) (map[string]float64, err
 }
 
 func (m *MockExchange) SubscribeCandles(ctx context.Context, symbol string, interval int64) (<-chan engine.Candle, error) {
+	if err := m.chaos.inject(ctx, "SubscribeCandles"); err != nil {
+		return nil, err
+	}
 	m.mt.Lock()
 	defer m.mt.Unlock()
 	ch := make(chan engine.Candle, 1024)
 	m.feeds[symbol] = ch
+	if interval < 0 {
+		// backtests push their own candles with PushCandleInBacktest
+		return ch, nil
+	}
+	step := time.Duration(interval) * time.Second
+	if step <= 0 {
+		step = time.Minute
+	}
 	// start a small generator for demo
-	log.Printf("Subscribing to Candles from %s", m.AdapterName())
+	log.Printf("Subscribing to %s Candles from %s", step, m.AdapterName())
 	go func() {
-		now := time.Now().Add(-time.Duration(200) * time.Minute)
+		now := time.Now().Add(-200 * step)
 		price := 30000.0
+		var held *engine.Candle
 		for i := 0; i < 200; i++ {
 			price *= 1 + (0.0005 - 0.0002*float64(i%3))
 			c := engine.Candle{
-				Time:   now.Add(time.Duration(i) * time.Minute),
+				Time:   now.Add(time.Duration(i) * step),
 				Open:   price * 0.999,
 				High:   price * 1.001,
 				Low:    price * 0.998,
 				Close:  price,
 				Volume: 10 + float64(i%5),
 			}
+			if held == nil && m.chaos.outOfOrder() {
+				// hold this candle back and emit it after the next one
+				held = &c
+				continue
+			}
+			batch := []engine.Candle{c}
+			if held != nil {
+				batch = append(batch, *held)
+				held = nil
+			}
+			for _, c := range batch {
+				m.candle(symbol, c)
+				select {
+				case ch <- c:
+				case <-ctx.Done():
+					close(ch)
+					return
+				}
+			}
+			time.Sleep(2 * time.Second)
+		}
+		if held != nil {
+			ch <- *held
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// SubscribeTrades generates a random walk of trades around the last price
+// of symbol, a few every second
+func (m *MockExchange) SubscribeTrades(ctx context.Context, symbol string) (<-chan engine.Trade, error) {
+	if err := m.chaos.inject(ctx, "SubscribeTrades"); err != nil {
+		return nil, err
+	}
+	ch := make(chan engine.Trade, 1024)
+	log.Printf("Subscribing to %s trades from %s", symbol, m.AdapterName())
+
+	go func() {
+		defer close(ch)
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		tick := time.NewTicker(250 * time.Millisecond)
+		defer tick.Stop()
+		price, anchor := 30000.0, 0.0
+		for {
 			select {
-			case ch <- c:
 			case <-ctx.Done():
-				close(ch)
 				return
+			case now := <-tick.C:
+				// follow the candles: restart the walk whenever the last price moves
+				if p, err := m.marketPrice(engine.Order{Symbol: symbol}); err == nil && p.InexactFloat64() != anchor {
+					anchor = p.InexactFloat64()
+					price = anchor
+				}
+				price *= 1 + (rng.Float64()-0.5)*0.0004
+				side := engine.SideBuy
+				if rng.Intn(2) == 0 {
+					side = engine.SideSell
+				}
+				t := engine.Trade{
+					Symbol: symbol,
+					Price:  math.Round(price*100) / 100,
+					Size:   math.Round((0.001+rng.Float64()*0.05)*1e6) / 1e6,
+					Side:   side,
+					Time:   now,
+				}
+				select {
+				case ch <- t:
+				case <-ctx.Done():
+					return
+				}
 			}
-			time.Sleep(2 * time.Second)
 		}
-		close(ch)
 	}()
+
 	return ch, nil
 }
 
-func (m *MockExchange) CancelOrder(ctx context.Context, orderID string) error {
+// SubscribeOrderBook generates a book of depth levels a side around the last
+// price of symbol, one basis point apart, twice a second
+func (m *MockExchange) SubscribeOrderBook(ctx context.Context, symbol string, depth int) (<-chan engine.OrderBook, error) {
+	if err := m.chaos.inject(ctx, "SubscribeOrderBook"); err != nil {
+		return nil, err
+	}
+	if depth <= 0 {
+		return nil, fmt.Errorf("invalid order book depth %d", depth)
+	}
+	ch := make(chan engine.OrderBook, 64)
+	log.Printf("Subscribing to %s order book from %s", symbol, m.AdapterName())
+
+	go func() {
+		defer close(ch)
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		tick := time.NewTicker(500 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-tick.C:
+				mid := 30000.0
+				if p, err := m.marketPrice(engine.Order{Symbol: symbol}); err == nil {
+					mid = p.InexactFloat64()
+				}
+				book := engine.OrderBook{Symbol: symbol, Time: now}
+				for i := 1; i <= depth; i++ {
+					off := mid * 0.0001 * float64(i)
+					book.Bids = append(book.Bids, engine.BookLevel{Price: math.Round((mid-off)*100) / 100, Size: math.Round(rng.Float64()*float64(i)*1e6) / 1e6})
+					book.Asks = append(book.Asks, engine.BookLevel{Price: math.Round((mid+off)*100) / 100, Size: math.Round(rng.Float64()*float64(i)*1e6) / 1e6})
+				}
+				select {
+				case ch <- book:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (m *MockExchange) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	if err := m.chaos.inject(ctx, "CancelOrder"); err != nil {
+		return err
+	}
+	m.mt.Lock()
+	defer m.mt.Unlock()
+	o, ok := m.orders[orderID]
+	if !ok {
+		return errors.New("order not found")
+	}
+	if o.Status.Final() {
+		return fmt.Errorf("order %s is already %s", orderID, o.Status)
+	}
+	o.Status = engine.OrderStatusCanceled
+	m.orders[orderID] = o
+	return nil
+}
+
+// GetOpenOrders returns the orders of symbol still working on the mock, oldest first
+func (m *MockExchange) GetOpenOrders(ctx context.Context, symbol string) ([]engine.Order, error) {
+	if err := m.chaos.inject(ctx, "GetOpenOrders"); err != nil {
+		return nil, err
+	}
+	m.mt.RLock()
+	defer m.mt.RUnlock()
+	out := []engine.Order{}
+	for _, o := range m.orders {
+		if o.Symbol == symbol && !o.Status.Final() {
+			out = append(out, o)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Created != out[j].Created {
+			return out[i].Created < out[j].Created
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// CancelAllOrders cancels every order of symbol still working on the mock
+func (m *MockExchange) CancelAllOrders(ctx context.Context, symbol string) error {
+	if err := m.chaos.inject(ctx, "CancelAllOrders"); err != nil {
+		return err
+	}
 	m.mt.Lock()
 	defer m.mt.Unlock()
-	if _, ok := m.orders[orderID]; ok {
-		delete(m.orders, orderID)
-		return nil
+	for id, o := range m.orders {
+		if o.Symbol == symbol && !o.Status.Final() {
+			o.Status = engine.OrderStatusCanceled
+			m.orders[id] = o
+		}
 	}
-	return errors.New("order not found")
+	return nil
 }
 
 // parseSymbol tries to split a symbol into base and quote.
@@ -199,7 +503,7 @@ func parseSymbol(sym string) (base, quote string, err error) {
 	}
 
 	// fallback: try to detect quote from known suffixes
-	knownQuotes := []string{"USDT", "USDC", "BTC", "ETH", "USD", "EUR", "BUSD", "SOL"}
+	knownQuotes := []string{"USDT", "USDC", "BUSD", "BTC", "ETH", "USD", "EUR", "SOL"}
 	upper := strings.ToUpper(sym)
 	for _, q := range knownQuotes {
 		if strings.HasSuffix(upper, q) && len(upper) > len(q) {
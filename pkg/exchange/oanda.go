@@ -0,0 +1,682 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/secrets"
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// OANDA v20 REST and streaming endpoints of practice and live accounts
+const (
+	OandaPracticeURL       = "https://api-fxpractice.oanda.com"
+	OandaPracticeStreamURL = "https://stream-fxpractice.oanda.com"
+	OandaLiveURL           = "https://api-fxtrade.oanda.com"
+	OandaLiveStreamURL     = "https://stream-fxtrade.oanda.com"
+)
+
+// OandaAdapter trades forex and CFDs on an OANDA v20 account. The
+// credentials are a personal access token and the account ID. Orders are
+// sized in units of the base currency, sells are sent as negative units.
+type OandaAdapter struct {
+	creds     *secrets.Credentials
+	client    *http.Client
+	stream    *http.Client // without a timeout, price streams stay open
+	baseURL   string
+	streamURL string
+	mt        sync.Mutex
+	db        store.Store
+	limit     *limiter
+	home      string // currency of the account, known once balances were read
+	priceSource
+}
+
+// oandaRateLimit is the REST requests OANDA allows a second
+var oandaRateLimit = RateLimit{Capacity: 100, Window: time.Second, MaxWait: 10 * time.Second}
+
+func NewOandaAdapter(creds *secrets.Credentials, db store.Store) (engine.ExchangeAdapter, error) {
+	return &OandaAdapter{
+		creds:     creds,
+		client:    &http.Client{Timeout: 15 * time.Second},
+		stream:    &http.Client{},
+		baseURL:   OandaPracticeURL,
+		streamURL: OandaPracticeStreamURL,
+		db:        db,
+		limit:     newLimiter("oanda", oandaRateLimit),
+	}, nil
+}
+
+// SetURLs points the adapter at other REST and streaming endpoints, such as
+// those of a live account, empty ones keep the current URL
+func (a *OandaAdapter) SetURLs(base, stream string) {
+	if base != "" {
+		a.baseURL = strings.TrimSuffix(base, "/")
+	}
+	if stream != "" {
+		a.streamURL = strings.TrimSuffix(stream, "/")
+	}
+}
+
+// SetRateLimit changes the request budget, zero fields keep OANDA's limits
+func (a *OandaAdapter) SetRateLimit(cfg RateLimit) {
+	a.limit.set(cfg)
+}
+
+// account is the path of the account the credentials name
+func (a *OandaAdapter) account() string {
+	_, id := a.creds.Get()
+	return "/v3/accounts/" + url.PathEscape(id)
+}
+
+func (a *OandaAdapter) do(ctx context.Context, method, path string, query url.Values, body interface{}) (out []byte, err error) {
+	status := 0
+	ctx, span := startHTTPSpan(ctx, a.AdapterName(), method, path)
+	defer func() { endHTTPSpan(span, status, err) }()
+
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(b)
+	}
+	target := a.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	token, _ := a.creds.Get()
+	req, _ := http.NewRequestWithContext(ctx, method, target, payload)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Datetime-Format", "RFC3339")
+
+	if err := a.limit.wait(ctx, method, path); err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, transportError(ctx, "oanda", err)
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+	a.limit.backoff(resp)
+
+	out, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return nil, oandaError(resp, out)
+	}
+	return out, nil
+}
+
+// oandaError sorts an error answer of OANDA by its error code and the
+// reason a rejected order transaction gives
+func oandaError(resp *http.Response, body []byte) error {
+	var e struct {
+		ErrorCode    string `json:"errorCode"`
+		ErrorMessage string `json:"errorMessage"`
+		Reject       struct {
+			RejectReason string `json:"rejectReason"`
+		} `json:"orderRejectTransaction"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil || e.ErrorMessage == "" {
+		return answerError("oanda", resp, engine.ErrRejected, "", string(body))
+	}
+	code := e.ErrorCode
+	if code == "" {
+		code = e.Reject.RejectReason
+	}
+	return answerError("oanda", resp, oandaClass(code+" "+e.Reject.RejectReason+" "+e.ErrorMessage), code, e.ErrorMessage)
+}
+
+// oandaClass sorts the error code or reject reason of an OANDA answer
+func oandaClass(reason string) error {
+	reason = strings.ToUpper(reason)
+	switch {
+	case strings.Contains(reason, "INSUFFICIENT_MARGIN") || strings.Contains(reason, "INSUFFICIENT_FUNDS"):
+		return engine.ErrInsufficientFunds
+	case strings.Contains(reason, "INSTRUMENT"):
+		return engine.ErrInvalidSymbol
+	case strings.Contains(reason, "UNITS_MINIMUM_NOT_MET"):
+		return engine.ErrMinNotional
+	}
+	return engine.ErrRejected
+}
+
+// oandaInstrument turns an engine symbol such as EURUSD or EUR/USD into an
+// instrument name such as EUR_USD
+func oandaInstrument(symbol string) (string, error) {
+	s := strings.ToUpper(strings.TrimSpace(symbol))
+	s = strings.NewReplacer("/", "_", "-", "_").Replace(s)
+	if strings.Contains(s, "_") {
+		return s, nil
+	}
+	if len(s) == 6 {
+		return s[:3] + "_" + s[3:], nil
+	}
+	return "", fmt.Errorf("oanda: cannot tell the instrument of %q, write it as EUR_USD", symbol)
+}
+
+// oandaUnits are the signed units OANDA sizes an order of o in
+func oandaUnits(o engine.Order) string {
+	if o.Side == engine.SideSell {
+		return o.Quantity.Neg().String()
+	}
+	return o.Quantity.String()
+}
+
+// --- interface implementations -----------------------------------------------
+
+func (a *OandaAdapter) AdapterName() string {
+	return "OANDA"
+}
+
+// CanShort implements engine.ShortSeller, a forex pair is sold as easily
+// as bought
+func (a *OandaAdapter) CanShort(symbol string) bool { return true }
+
+// QuoteAsset implements engine.QuoteAssetProvider with the home currency
+// of the account, "" until the balances were read
+func (a *OandaAdapter) QuoteAsset() string {
+	a.mt.Lock()
+	defer a.mt.Unlock()
+	return a.home
+}
+
+// oandaFill is the transaction of an order filling
+type oandaFill struct {
+	ID         string          `json:"id"`
+	Units      decimal.Decimal `json:"units"`
+	Price      decimal.Decimal `json:"price"` // average of the fill
+	Commission decimal.Decimal `json:"commission"`
+}
+
+// apply copies the fill f onto o
+func (f oandaFill) apply(o *engine.Order) {
+	o.Status, o.Filled = engine.OrderStatusFilled, true
+	o.FilledQty = f.Units.Abs()
+	o.FilledPrice = f.Price
+	o.Fee = f.Commission
+}
+
+// PlaceOrder submits an order sized in units. Market orders are fill or
+// kill and come back filled; limit orders rest until filled, canceled or,
+// for GTT ones, their ExpireAt.
+func (a *OandaAdapter) PlaceOrder(ctx context.Context, o engine.Order) (engine.Order, error) {
+	inst, err := oandaInstrument(o.Symbol)
+	if err != nil {
+		return o, err
+	}
+	order := map[string]interface{}{
+		"type":         "MARKET",
+		"instrument":   inst,
+		"units":        oandaUnits(o),
+		"timeInForce":  "FOK",
+		"positionFill": "DEFAULT",
+	}
+	if o.ClientOrderID != "" {
+		order["clientExtensions"] = map[string]string{"id": o.ClientOrderID}
+	}
+	if o.Type == engine.OrderLimit {
+		order["type"] = "LIMIT"
+		order["price"] = o.Price.String()
+		switch o.TimeInForce {
+		case engine.TimeInForceIOC, engine.TimeInForceFOK:
+			order["timeInForce"] = string(o.TimeInForce)
+		case engine.TimeInForceGTT:
+			order["timeInForce"] = "GTD"
+			order["gtdTime"] = o.ExpireAt.UTC().Format(time.RFC3339)
+		default:
+			order["timeInForce"] = "GTC"
+		}
+	}
+
+	a.mt.Lock()
+	body, err := a.do(ctx, "POST", a.account()+"/orders", nil, map[string]interface{}{"order": order})
+	a.mt.Unlock()
+	if err != nil {
+		return o, err
+	}
+
+	var resp struct {
+		Create struct {
+			ID   string    `json:"id"`
+			Time time.Time `json:"time"`
+		} `json:"orderCreateTransaction"`
+		Fill   *oandaFill `json:"orderFillTransaction"`
+		Cancel *struct {
+			Reason string `json:"reason"`
+		} `json:"orderCancelTransaction"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return o, err
+	}
+	// a market order that could not fill at once is canceled right away
+	if resp.Cancel != nil && resp.Fill == nil && o.Type == engine.OrderMarket {
+		return o, &engine.ExchangeError{Exchange: "oanda", Class: oandaClass(resp.Cancel.Reason), Code: resp.Cancel.Reason, Message: "order canceled: " + resp.Cancel.Reason}
+	}
+
+	o.ID = resp.Create.ID
+	o.Created = resp.Create.Time.Unix()
+	o.Status = engine.OrderStatusNew
+	if resp.Fill != nil {
+		resp.Fill.apply(&o)
+	} else if resp.Cancel != nil {
+		o.Status = engine.OrderStatusCanceled
+	}
+	return o, nil
+}
+
+// oandaOrder is an order as the order endpoints list it
+type oandaOrder struct {
+	ID               string          `json:"id"`
+	Type             string          `json:"type"`
+	Instrument       string          `json:"instrument"`
+	Units            decimal.Decimal `json:"units"`
+	Price            decimal.Decimal `json:"price"`
+	State            string          `json:"state"`
+	CreateTime       time.Time       `json:"createTime"`
+	FillingID        string          `json:"fillingTransactionID"`
+	ClientExtensions struct {
+		ID string `json:"id"`
+	} `json:"clientExtensions"`
+}
+
+// order is the engine order of oo on symbol
+func (oo oandaOrder) order(symbol string) engine.Order {
+	o := engine.Order{
+		ID:            oo.ID,
+		ClientOrderID: oo.ClientExtensions.ID,
+		Symbol:        symbol,
+		Side:          engine.SideBuy,
+		Type:          engine.OrderMarket,
+		Price:         oo.Price,
+		Quantity:      oo.Units.Abs(),
+		Status:        oandaOrderStatus(oo.State),
+		Created:       oo.CreateTime.Unix(),
+	}
+	if oo.Units.IsNegative() {
+		o.Side = engine.SideSell
+	}
+	if oo.Type == "LIMIT" {
+		o.Type = engine.OrderLimit
+	}
+	return o
+}
+
+// oandaOrderStatus maps OANDA order states onto the engine lifecycle
+func oandaOrderStatus(s string) engine.OrderStatus {
+	switch s {
+	case "FILLED":
+		return engine.OrderStatusFilled
+	case "CANCELLED":
+		return engine.OrderStatusCanceled
+	}
+	// PENDING and TRIGGERED are still working
+	return engine.OrderStatusNew
+}
+
+// GetOrder returns the status of an order, with the price and commission of
+// its fill once filled
+func (a *OandaAdapter) GetOrder(ctx context.Context, symbol, orderID string) (engine.Order, error) {
+	a.mt.Lock()
+	defer a.mt.Unlock()
+	body, err := a.do(ctx, "GET", a.account()+"/orders/"+url.PathEscape(orderID), nil, nil)
+	if err != nil {
+		return engine.Order{}, err
+	}
+	var resp struct {
+		Order oandaOrder `json:"order"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return engine.Order{}, err
+	}
+	o := resp.Order.order(symbol)
+	if o.Status != engine.OrderStatusFilled || resp.Order.FillingID == "" {
+		return o, nil
+	}
+
+	body, err = a.do(ctx, "GET", a.account()+"/transactions/"+url.PathEscape(resp.Order.FillingID), nil, nil)
+	if err != nil {
+		return engine.Order{}, err
+	}
+	var tx struct {
+		Transaction oandaFill `json:"transaction"`
+	}
+	if err := json.Unmarshal(body, &tx); err != nil {
+		return engine.Order{}, err
+	}
+	tx.Transaction.apply(&o)
+	return o, nil
+}
+
+// ExpiresOrders implements engine.ExpiringExchange, GTT orders are placed
+// good till date
+func (a *OandaAdapter) ExpiresOrders() bool { return true }
+
+func (a *OandaAdapter) CancelOrder(ctx context.Context, symbol, orderID string) error {
+	a.mt.Lock()
+	defer a.mt.Unlock()
+	_, err := a.do(ctx, "PUT", a.account()+"/orders/"+url.PathEscape(orderID)+"/cancel", nil, nil)
+	return err
+}
+
+// CancelAllOrders cancels the pending orders of symbol one by one
+func (a *OandaAdapter) CancelAllOrders(ctx context.Context, symbol string) error {
+	open, err := a.GetOpenOrders(ctx, symbol)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, o := range open {
+		if err := a.CancelOrder(ctx, symbol, o.ID); err != nil {
+			errs = append(errs, fmt.Errorf("cancel %s: %w", o.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetOpenOrders returns the pending orders of symbol. Take profit and stop
+// loss orders OANDA attaches to trades name no instrument and are left out.
+func (a *OandaAdapter) GetOpenOrders(ctx context.Context, symbol string) ([]engine.Order, error) {
+	inst, err := oandaInstrument(symbol)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"state": {"PENDING"}, "instrument": {inst}, "count": {"500"}}
+	a.mt.Lock()
+	body, err := a.do(ctx, "GET", a.account()+"/orders", query, nil)
+	a.mt.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Orders []oandaOrder `json:"orders"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	out := make([]engine.Order, 0, len(resp.Orders))
+	for _, oo := range resp.Orders {
+		if oo.Instrument == inst {
+			out = append(out, oo.order(symbol))
+		}
+	}
+	return out, nil
+}
+
+// GetSymbolInfo reads the display precision and trade units of the
+// instrument of symbol, orders are rounded to whole units for most pairs
+func (a *OandaAdapter) GetSymbolInfo(ctx context.Context, symbol string) (engine.SymbolInfo, error) {
+	inst, err := oandaInstrument(symbol)
+	if err != nil {
+		return engine.SymbolInfo{}, err
+	}
+	a.mt.Lock()
+	body, err := a.do(ctx, "GET", a.account()+"/instruments", url.Values{"instruments": {inst}}, nil)
+	a.mt.Unlock()
+	if err != nil {
+		return engine.SymbolInfo{}, err
+	}
+	var resp struct {
+		Instruments []struct {
+			Name                string          `json:"name"`
+			DisplayPrecision    int32           `json:"displayPrecision"`
+			TradeUnitsPrecision int32           `json:"tradeUnitsPrecision"`
+			MinimumTradeSize    decimal.Decimal `json:"minimumTradeSize"`
+		} `json:"instruments"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return engine.SymbolInfo{}, err
+	}
+	if len(resp.Instruments) == 0 {
+		return engine.SymbolInfo{}, fmt.Errorf("oanda does not trade %s", symbol)
+	}
+	in := resp.Instruments[0]
+	return engine.SymbolInfo{
+		Symbol:         symbol,
+		TickSize:       decimal.New(1, -in.DisplayPrecision),
+		StepSize:       decimal.New(1, -in.TradeUnitsPrecision),
+		MinQty:         in.MinimumTradeSize,
+		PricePrecision: in.DisplayPrecision,
+		QtyPrecision:   in.TradeUnitsPrecision,
+	}, nil
+}
+
+// Ping implements engine.HealthChecker by reading the account summary
+func (a *OandaAdapter) Ping(ctx context.Context) error {
+	a.mt.Lock()
+	defer a.mt.Unlock()
+	_, err := a.do(ctx, "GET", a.account()+"/summary", nil, nil)
+	return err
+}
+
+// GetBalances returns the balance of the account in its home currency
+func (a *OandaAdapter) GetBalances(ctx context.Context) (map[string]decimal.Decimal, error) {
+	a.mt.Lock()
+	body, err := a.do(ctx, "GET", a.account()+"/summary", nil, nil)
+	a.mt.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Account struct {
+			Currency string          `json:"currency"`
+			Balance  decimal.Decimal `json:"balance"`
+		} `json:"account"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	a.mt.Lock()
+	a.home = resp.Account.Currency
+	a.mt.Unlock()
+	return map[string]decimal.Decimal{resp.Account.Currency: resp.Account.Balance}, nil
+}
+
+// GetPosition nets the long and short units held in the instrument of
+// symbol, zero when the account holds none
+func (a *OandaAdapter) GetPosition(ctx context.Context, symbol string) (engine.Position, error) {
+	inst, err := oandaInstrument(symbol)
+	if err != nil {
+		return engine.Position{Symbol: symbol}, err
+	}
+	a.mt.Lock()
+	body, err := a.do(ctx, "GET", a.account()+"/openPositions", nil, nil)
+	a.mt.Unlock()
+	if err != nil {
+		return engine.Position{Symbol: symbol}, err
+	}
+	type side struct {
+		Units        decimal.Decimal `json:"units"`
+		AveragePrice decimal.Decimal `json:"averagePrice"`
+	}
+	var resp struct {
+		Positions []struct {
+			Instrument string `json:"instrument"`
+			Long       side   `json:"long"`
+			Short      side   `json:"short"` // negative units
+		} `json:"positions"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return engine.Position{Symbol: symbol}, err
+	}
+	pos := engine.Position{Symbol: symbol}
+	for _, p := range resp.Positions {
+		if p.Instrument != inst {
+			continue
+		}
+		pos.Quantity = p.Long.Units.Add(p.Short.Units)
+		switch {
+		case pos.Quantity.IsPositive():
+			pos.AvgPrice = p.Long.AveragePrice
+		case pos.Quantity.IsNegative():
+			pos.AvgPrice = p.Short.AveragePrice
+		}
+	}
+	return pos, nil
+}
+
+// oandaGranularity maps a candle interval in seconds to an OANDA granularity
+func oandaGranularity(interval int64) (string, error) {
+	switch interval {
+	case 5, 10, 15, 30:
+		return fmt.Sprintf("S%d", interval), nil
+	case 60, 2 * 60, 4 * 60, 5 * 60, 10 * 60, 15 * 60, 30 * 60:
+		return fmt.Sprintf("M%d", interval/60), nil
+	case 3600, 2 * 3600, 3 * 3600, 4 * 3600, 6 * 3600, 8 * 3600, 12 * 3600:
+		return fmt.Sprintf("H%d", interval/3600), nil
+	case 24 * 3600:
+		return "D", nil
+	case 7 * 24 * 3600:
+		return "W", nil
+	}
+	return "", fmt.Errorf("oanda has no %ds candle granularity", interval)
+}
+
+// oandaCandles are the complete mid price candles of an instrument from
+// from on, at most count of them
+func (a *OandaAdapter) oandaCandles(ctx context.Context, inst, granularity string, from time.Time, count int) ([]engine.Candle, error) {
+	query := url.Values{
+		"granularity": {granularity},
+		"price":       {"M"},
+		"from":        {from.UTC().Format(time.RFC3339)},
+		"count":       {strconv.Itoa(count)},
+	}
+	body, err := a.do(ctx, "GET", "/v3/instruments/"+url.PathEscape(inst)+"/candles", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Candles []struct {
+			Complete bool      `json:"complete"`
+			Volume   float64   `json:"volume"` // ticks
+			Time     time.Time `json:"time"`
+			Mid      struct {
+				O string `json:"o"`
+				H string `json:"h"`
+				L string `json:"l"`
+				C string `json:"c"`
+			} `json:"mid"`
+		} `json:"candles"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	out := make([]engine.Candle, 0, len(resp.Candles))
+	for _, c := range resp.Candles {
+		if !c.Complete {
+			continue
+		}
+		var vals [4]float64
+		for i, s := range []string{c.Mid.O, c.Mid.H, c.Mid.L, c.Mid.C} {
+			if vals[i], err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("oanda candle of %s at %s: %w", inst, c.Time, err)
+			}
+		}
+		out = append(out, engine.Candle{Time: c.Time, Open: vals[0], High: vals[1], Low: vals[2], Close: vals[3], Volume: c.Volume})
+	}
+	return out, nil
+}
+
+// SubscribeCandles polls the complete mid price candles of symbol, each
+// sent once, starting with the last 200. Volume is the count of price ticks.
+func (a *OandaAdapter) SubscribeCandles(ctx context.Context, symbol string, interval int64) (<-chan engine.Candle, error) {
+	inst, err := oandaInstrument(symbol)
+	if err != nil {
+		return nil, err
+	}
+	granularity, err := oandaGranularity(interval)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan engine.Candle, 1024)
+	log.Printf("Subscribing to %s Candles of %s from %s", granularity, inst, a.AdapterName())
+
+	go func() {
+		defer close(ch)
+		var last time.Time
+		from := time.Now().Add(-200 * time.Duration(interval) * time.Second)
+		for {
+			candles, err := a.oandaCandles(ctx, inst, granularity, from, 500)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("oanda: candles of %s: %v", inst, err)
+				}
+				return
+			}
+			for _, c := range candles {
+				if !c.Time.After(last) {
+					continue
+				}
+				last, from = c.Time, c.Time
+				select {
+				case ch <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(3 * time.Second):
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// HistoricalCandles implements engine.CandleHistory, paging through the
+// complete mid price candles of symbol 5000 at a time
+func (a *OandaAdapter) HistoricalCandles(ctx context.Context, symbol string, interval int64, from, to time.Time) ([]engine.Candle, error) {
+	inst, err := oandaInstrument(symbol)
+	if err != nil {
+		return nil, err
+	}
+	granularity, err := oandaGranularity(interval)
+	if err != nil {
+		return nil, err
+	}
+	var out []engine.Candle
+	for from.Before(to) {
+		page, err := a.oandaCandles(ctx, inst, granularity, from, 5000)
+		if err != nil {
+			return nil, err
+		}
+		next := from
+		for _, c := range page {
+			if c.Time.After(to) {
+				return out, nil
+			}
+			if !c.Time.Before(from) {
+				out = append(out, c)
+				next = c.Time.Add(time.Duration(interval) * time.Second)
+			}
+		}
+		if !next.After(from) {
+			break
+		}
+		from = next
+	}
+	return out, nil
+}
+
+// SubscribeTrades is not supported, OANDA streams prices rather than trades
+func (a *OandaAdapter) SubscribeTrades(ctx context.Context, symbol string) (<-chan engine.Trade, error) {
+	return nil, engine.ErrNoTradeStream
+}
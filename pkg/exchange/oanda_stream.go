@@ -0,0 +1,152 @@
+package exchange
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+)
+
+// oandaStreamIdle is how long a price stream may stay silent, OANDA sends a
+// heartbeat every five seconds
+const oandaStreamIdle = 30 * time.Second
+
+// oandaPrice is a message of the pricing stream, a PRICE or a HEARTBEAT
+type oandaPrice struct {
+	Type       string       `json:"type"`
+	Instrument string       `json:"instrument"`
+	Time       time.Time    `json:"time"`
+	Tradeable  bool         `json:"tradeable"`
+	Bids       []oandaLevel `json:"bids"`
+	Asks       []oandaLevel `json:"asks"`
+}
+
+type oandaLevel struct {
+	Price     string  `json:"price"`
+	Liquidity float64 `json:"liquidity"` // units available at the price
+}
+
+// book is the top depth levels of p, the liquidity of each price as its size
+func (p oandaPrice) book(symbol string, depth int) (engine.OrderBook, error) {
+	side := func(levels []oandaLevel) ([]engine.BookLevel, error) {
+		if depth > 0 && len(levels) > depth {
+			levels = levels[:depth]
+		}
+		out := make([]engine.BookLevel, len(levels))
+		for i, l := range levels {
+			price, err := strconv.ParseFloat(l.Price, 64)
+			if err != nil {
+				return nil, fmt.Errorf("price %q: %w", l.Price, err)
+			}
+			out[i] = engine.BookLevel{Price: price, Size: l.Liquidity}
+		}
+		return out, nil
+	}
+	bids, err := side(p.Bids)
+	if err != nil {
+		return engine.OrderBook{}, err
+	}
+	asks, err := side(p.Asks)
+	if err != nil {
+		return engine.OrderBook{}, err
+	}
+	return engine.OrderBook{Symbol: symbol, Bids: bids, Asks: asks, Time: p.Time}, nil
+}
+
+// SubscribeOrderBook streams the prices of symbol, each quote its bids and
+// asks by the liquidity OANDA offers at them, top depth levels a side
+func (a *OandaAdapter) SubscribeOrderBook(ctx context.Context, symbol string, depth int) (<-chan engine.OrderBook, error) {
+	inst, err := oandaInstrument(symbol)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Subscribing to %s prices from %s", inst, a.AdapterName())
+	ch := make(chan engine.OrderBook, 64)
+	go a.streamPrices(ctx, symbol, inst, depth, ch)
+	return ch, nil
+}
+
+// streamPrices keeps the price stream of inst open, reconnecting with
+// backoff, and sends each quote to ch until ctx is done
+func (a *OandaAdapter) streamPrices(ctx context.Context, symbol, inst string, depth int, ch chan<- engine.OrderBook) {
+	defer close(ch)
+	wait := time.Second
+	for {
+		start := time.Now()
+		err := a.readPrices(ctx, symbol, inst, depth, ch)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > time.Minute {
+			// the connection was healthy for a while, start backing off from scratch
+			wait = time.Second
+		}
+		log.Printf("OANDA %s price stream disconnected: %v, reconnecting in %s", inst, err, wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, time.Minute)
+	}
+}
+
+// readPrices runs one connection of the stream, one JSON message a line,
+// until it fails or stays silent too long
+func (a *OandaAdapter) readPrices(ctx context.Context, symbol, inst string, depth int, ch chan<- engine.OrderBook) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// a silent connection is dropped rather than waited on forever
+	idle := time.AfterFunc(oandaStreamIdle, cancel)
+	defer idle.Stop()
+
+	token, account := a.creds.Get()
+	target := a.streamURL + "/v3/accounts/" + url.PathEscape(account) + "/pricing/stream?" + url.Values{"instruments": {inst}}.Encode()
+	req, _ := http.NewRequestWithContext(ctx, "GET", target, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept-Datetime-Format", "RFC3339")
+	resp, err := a.stream.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("oanda price stream: %s", resp.Status)
+	}
+	log.Printf("Subscribed to OANDA %s prices", inst)
+
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() {
+		idle.Reset(oandaStreamIdle)
+		var msg oandaPrice
+		if err := json.Unmarshal(lines.Bytes(), &msg); err != nil {
+			log.Printf("OANDA %s price stream: bad message %q", inst, lines.Text())
+			continue
+		}
+		if msg.Type != "PRICE" || msg.Instrument != inst {
+			// heartbeats keep the connection open while the market is quiet
+			continue
+		}
+		book, err := msg.book(symbol, depth)
+		if err != nil {
+			log.Printf("OANDA %s price stream: %v", inst, err)
+			continue
+		}
+		select {
+		case ch <- book:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("oanda price stream closed")
+}
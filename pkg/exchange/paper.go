@@ -0,0 +1,77 @@
+package exchange
+
+import (
+	"context"
+	"log"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+// PaperTradingAdapter streams real candles from a live adapter while orders
+// and balances are simulated by an embedded MockExchange, so strategies can
+// be dry-run against live prices without trading permissions.
+type PaperTradingAdapter struct {
+	*MockExchange
+	live engine.ExchangeAdapter
+}
+
+func NewPaperTradingAdapter(live engine.ExchangeAdapter, bal decimal.Decimal, db store.Store) engine.ExchangeAdapter {
+	return &PaperTradingAdapter{
+		MockExchange: NewMockExchange(bal, db).(*MockExchange),
+		live:         live,
+	}
+}
+
+func (p *PaperTradingAdapter) AdapterName() string {
+	return "Paper(" + p.live.AdapterName() + ")"
+}
+
+// Live returns the adapter market data comes from
+func (p *PaperTradingAdapter) Live() engine.ExchangeAdapter {
+	return p.live
+}
+
+func (p *PaperTradingAdapter) SubscribeCandles(ctx context.Context, symbol string, interval int64) (<-chan engine.Candle, error) {
+	in, err := p.live.SubscribeCandles(ctx, symbol, interval)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan engine.Candle, 1024)
+	log.Printf("Paper trading %s on %s candles", symbol, p.live.AdapterName())
+
+	go func() {
+		defer close(ch)
+		for c := range in {
+			// simulated fills and margin run on the live prices
+			p.candle(symbol, c)
+			select {
+			case ch <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// SubscribeTrades streams the live exchange's trades
+func (p *PaperTradingAdapter) SubscribeTrades(ctx context.Context, symbol string) (<-chan engine.Trade, error) {
+	return p.live.SubscribeTrades(ctx, symbol)
+}
+
+// SubscribeOrderBook streams the live exchange's order book
+func (p *PaperTradingAdapter) SubscribeOrderBook(ctx context.Context, symbol string, depth int) (<-chan engine.OrderBook, error) {
+	return p.live.SubscribeOrderBook(ctx, symbol, depth)
+}
+
+// GetSymbolInfo returns the trading rules of the live exchange so paper
+// orders are rounded and rejected the way real ones would be
+func (p *PaperTradingAdapter) GetSymbolInfo(ctx context.Context, symbol string) (engine.SymbolInfo, error) {
+	if sp, ok := p.live.(engine.SymbolInfoProvider); ok {
+		return sp.GetSymbolInfo(ctx, symbol)
+	}
+	return engine.SymbolInfo{Symbol: symbol}, nil
+}
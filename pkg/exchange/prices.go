@@ -0,0 +1,37 @@
+package exchange
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/shopspring/decimal"
+)
+
+// priceSource gives adapters access to the engine's last-price service
+type priceSource struct {
+	mt  sync.RWMutex
+	src engine.PriceSource
+}
+
+func (p *priceSource) SetPriceSource(src engine.PriceSource) {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+	p.src = src
+}
+
+// marketPrice resolves the price of an order, preferring the price stamped on it
+func (p *priceSource) marketPrice(o engine.Order) (decimal.Decimal, error) {
+	if o.Price.IsPositive() {
+		return o.Price, nil
+	}
+	p.mt.RLock()
+	src := p.src
+	p.mt.RUnlock()
+	if src != nil {
+		if price, ok := src.LastPrice(o.Symbol); ok {
+			return price, nil
+		}
+	}
+	return decimal.Zero, fmt.Errorf("no price known for %s", o.Symbol)
+}
@@ -0,0 +1,171 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+)
+
+// RateLimit is the request budget of an exchange adapter, a token bucket of
+// Capacity weight refilled over Window. Every request takes the weight of
+// its endpoint, 1 unless Weights has "METHOD /path" or "/path". Requests
+// over budget queue for it, or fail as engine.ErrRateLimited when that
+// takes longer than MaxWait. Zero fields keep the adapter's defaults, which
+// follow the exchange's published limits.
+type RateLimit struct {
+	Capacity int            `json:"capacity"`
+	Window   time.Duration  `json:"-"`
+	MaxWait  time.Duration  `json:"-"`
+	Weights  map[string]int `json:"weights,omitempty"`
+}
+
+// limiter spends the RateLimit of an adapter
+type limiter struct {
+	mt       sync.Mutex
+	exchange string // named in the errors of rejected requests
+	defaults RateLimit
+	cfg      RateLimit
+	tokens   float64
+	last     time.Time
+	until    time.Time // the exchange asked to back off until then
+}
+
+func newLimiter(exchange string, defaults RateLimit) *limiter {
+	return &limiter{exchange: exchange, defaults: defaults, cfg: defaults, tokens: float64(defaults.Capacity), last: time.Now()}
+}
+
+// set applies the non-zero fields of cfg over the defaults, the bucket
+// starts full
+func (l *limiter) set(cfg RateLimit) {
+	l.mt.Lock()
+	defer l.mt.Unlock()
+	c := l.defaults
+	if cfg.Capacity > 0 {
+		c.Capacity = cfg.Capacity
+	}
+	if cfg.Window > 0 {
+		c.Window = cfg.Window
+	}
+	if cfg.MaxWait > 0 {
+		c.MaxWait = cfg.MaxWait
+	}
+	if len(cfg.Weights) > 0 {
+		c.Weights = make(map[string]int, len(l.defaults.Weights)+len(cfg.Weights))
+		for k, w := range l.defaults.Weights {
+			c.Weights[k] = w
+		}
+		for k, w := range cfg.Weights {
+			c.Weights[k] = w
+		}
+	}
+	l.cfg, l.tokens, l.last = c, float64(c.Capacity), time.Now()
+}
+
+// enabled reports whether requests are limited at all. Callers must hold l.mt.
+func (l *limiter) enabled() bool {
+	return l.cfg.Capacity > 0 && l.cfg.Window > 0
+}
+
+// weight is what a request to path with method costs. Callers must hold l.mt.
+func (l *limiter) weight(method, path string) float64 {
+	path, _, _ = strings.Cut(path, "?")
+	w, ok := l.cfg.Weights[method+" "+path]
+	if !ok {
+		w, ok = l.cfg.Weights[path]
+	}
+	if !ok {
+		w = 1
+	}
+	return float64(min(w, l.cfg.Capacity))
+}
+
+// refill adds the tokens earned since the last request. Callers must hold l.mt.
+func (l *limiter) refill(now time.Time) {
+	rate := float64(l.cfg.Capacity) / l.cfg.Window.Seconds()
+	l.tokens = min(float64(l.cfg.Capacity), l.tokens+now.Sub(l.last).Seconds()*rate)
+	l.last = now
+}
+
+// wait takes the weight of a request, waiting its turn when the bucket
+// is short
+func (l *limiter) wait(ctx context.Context, method, path string) error {
+	l.mt.Lock()
+	if !l.enabled() {
+		l.mt.Unlock()
+		return nil
+	}
+	now := time.Now()
+	l.refill(now)
+	w := l.weight(method, path)
+	// the tokens are reserved now, so the requests queued behind take their turn after this one
+	l.tokens -= w
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / float64(l.cfg.Capacity) * float64(l.cfg.Window))
+	}
+	d = max(d, l.until.Sub(now))
+	if d > l.cfg.MaxWait {
+		l.tokens += w
+		l.mt.Unlock()
+		return &engine.ExchangeError{
+			Exchange:   l.exchange,
+			Class:      engine.ErrRateLimited,
+			Message:    fmt.Sprintf("%s %s would wait %s", method, path, d.Round(time.Millisecond)),
+			RetryAfter: d,
+		}
+	}
+	l.mt.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// used lowers the bucket to what is left of its capacity after the weight
+// the exchange reports used in the current window
+func (l *limiter) used(weight int) {
+	l.mt.Lock()
+	capacity := l.cfg.Capacity
+	l.mt.Unlock()
+	l.remaining(capacity - weight)
+}
+
+// remaining lowers the bucket to the weight the exchange reports left
+func (l *limiter) remaining(left int) {
+	l.mt.Lock()
+	defer l.mt.Unlock()
+	if !l.enabled() {
+		return
+	}
+	l.refill(time.Now())
+	l.tokens = min(l.tokens, float64(left))
+}
+
+// backoff holds every request off for as long as a 429 or 418 answer asks,
+// from its Retry-After header or a second without one
+func (l *limiter) backoff(resp *http.Response) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusTeapot {
+		return
+	}
+	d := retryAfter(resp)
+	if d == 0 {
+		d = time.Second
+	}
+	l.mt.Lock()
+	defer l.mt.Unlock()
+	if until := time.Now().Add(d); until.After(l.until) {
+		l.until = until
+	}
+}
@@ -0,0 +1,185 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/store"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	MinReplaySpeed = 1.0
+	MaxReplaySpeed = 1000.0
+	// ReplayUnpaced as the speed replays candles as fast as the engine takes them
+	ReplayUnpaced = 0.0
+)
+
+// ReplayExchange feeds the candles of a recorded session, or the stored
+// candles of a period, back through the engine, keeping their original
+// spacing divided by speed. Orders are filled by an embedded MockExchange so
+// nothing reaches a real venue.
+type ReplayExchange struct {
+	*MockExchange
+	db        store.Store
+	sessionID string // empty when replaying stored candles
+	from, to  time.Time
+	speed     float64
+}
+
+// replayedCandle is a candle to replay and when it originally arrived
+type replayedCandle struct {
+	candle engine.Candle
+	at     time.Time
+}
+
+func NewReplayExchange(sessionID string, speed float64, bal decimal.Decimal, db store.Store) (engine.ExchangeAdapter, error) {
+	if sessionID == "" || sessionID == "latest" {
+		id, err := db.LatestSessionID()
+		if err != nil {
+			return nil, fmt.Errorf("no recorded session to replay: %w", err)
+		}
+		sessionID = id
+	}
+	if err := checkReplaySpeed(speed); err != nil {
+		return nil, err
+	}
+	return &ReplayExchange{
+		MockExchange: NewMockExchange(bal, db).(*MockExchange),
+		db:           db,
+		sessionID:    sessionID,
+		speed:        speed,
+	}, nil
+}
+
+// NewCandleReplayExchange replays the stored candles between from and to,
+// spaced by their candle times. A zero from starts at the oldest candle and a
+// zero to ends at the newest.
+func NewCandleReplayExchange(from, to time.Time, speed float64, bal decimal.Decimal, db store.Store) (engine.ExchangeAdapter, error) {
+	if !to.IsZero() && !from.Before(to) {
+		return nil, fmt.Errorf("replay from %s must be before to %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	if err := checkReplaySpeed(speed); err != nil {
+		return nil, err
+	}
+	return &ReplayExchange{
+		MockExchange: NewMockExchange(bal, db).(*MockExchange),
+		db:           db,
+		from:         from,
+		to:           to,
+		speed:        speed,
+	}, nil
+}
+
+func checkReplaySpeed(speed float64) error {
+	if speed != ReplayUnpaced && (speed < MinReplaySpeed || speed > MaxReplaySpeed) {
+		return fmt.Errorf("replay speed must be between %gx and %gx, or unpaced", MinReplaySpeed, MaxReplaySpeed)
+	}
+	return nil
+}
+
+func (r *ReplayExchange) AdapterName() string {
+	return "Replay"
+}
+
+func (r *ReplayExchange) SubscribeCandles(ctx context.Context, symbol string, interval int64) (<-chan engine.Candle, error) {
+	candles, source, err := r.load(symbol, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan engine.Candle, 1024)
+	if r.speed == ReplayUnpaced {
+		log.Printf("Replaying %d %s candles of %s unpaced", len(candles), symbol, source)
+	} else {
+		log.Printf("Replaying %d %s candles of %s at %gx", len(candles), symbol, source, r.speed)
+	}
+
+	go func() {
+		defer close(ch)
+		var last time.Time
+		for _, rc := range candles {
+			if !last.IsZero() && r.speed != ReplayUnpaced {
+				wait := time.Duration(float64(rc.at.Sub(last)) / r.speed)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(wait):
+				}
+			}
+			last = rc.at
+
+			// fills and margin run on the replayed prices
+			r.candle(symbol, rc.candle)
+			select {
+			case ch <- rc.candle:
+			case <-ctx.Done():
+				return
+			}
+		}
+		log.Printf("Replay of %s %s finished", source, symbol)
+	}()
+
+	return ch, nil
+}
+
+// load returns the candles of interval seconds of symbol to replay, oldest
+// first, and a description of where they come from
+func (r *ReplayExchange) load(symbol string, interval int64) ([]replayedCandle, string, error) {
+	var candles []replayedCandle
+	// several strategies on one symbol record the same candle, keep the first
+	seen := map[time.Time]bool{}
+	keep := func(c engine.Candle, at time.Time) {
+		if !seen[c.Time] {
+			seen[c.Time] = true
+			candles = append(candles, replayedCandle{candle: c, at: at})
+		}
+	}
+
+	if r.sessionID != "" {
+		events, err := r.db.LoadSessionEvents(r.sessionID, "candle", symbol, time.Time{}, time.Time{})
+		if err != nil {
+			return nil, "", err
+		}
+		for _, ev := range events {
+			var c engine.Candle
+			if err := json.Unmarshal(ev.Payload, &c); err != nil {
+				log.Printf("replay: bad candle event %d: %v", ev.ID, err)
+				continue
+			}
+			keep(c, ev.RecordedAt)
+		}
+		return candles, r.sessionID, nil
+	}
+
+	to := r.to
+	if to.IsZero() {
+		to = time.Now()
+	}
+	rows, err := r.db.LoadCandlesBetween(symbol, interval, r.from, to)
+	if err != nil {
+		return nil, "", fmt.Errorf("load candles: %w", err)
+	}
+	for _, c := range engine.StoredCandles(rows) {
+		keep(c, c.Time)
+	}
+	if len(candles) == 0 {
+		return nil, "", fmt.Errorf("no stored %s candles to replay", symbol)
+	}
+	first, end := candles[0].candle.Time, candles[len(candles)-1].candle.Time
+	return candles, fmt.Sprintf("%s to %s", first.Format(time.RFC3339), end.Format(time.RFC3339)), nil
+}
+
+// SubscribeTrades is not supported, sessions record candles only
+func (r *ReplayExchange) SubscribeTrades(ctx context.Context, symbol string) (<-chan engine.Trade, error) {
+	return nil, engine.ErrNoTradeStream
+}
+
+// SubscribeOrderBook is not supported, sessions record candles only
+func (r *ReplayExchange) SubscribeOrderBook(ctx context.Context, symbol string, depth int) (<-chan engine.OrderBook, error) {
+	return nil, engine.ErrNoOrderBook
+}
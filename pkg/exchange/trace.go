@@ -0,0 +1,33 @@
+package exchange
+
+import (
+	"context"
+
+	"github.com/omept/trading-engine/pkg/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startHTTPSpan opens a client span for a REST call to an exchange
+func startHTTPSpan(ctx context.Context, exchange, method, path string) (context.Context, trace.Span) {
+	return telemetry.Tracer().Start(ctx, exchange+" "+method+" "+path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("exchange", exchange),
+			attribute.String("http.request.method", method),
+			attribute.String("url.path", path),
+		))
+}
+
+// endHTTPSpan records the outcome of the call and ends the span
+func endHTTPSpan(span trace.Span, status int, err error) {
+	if status > 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,79 @@
+package exchange
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// CashFlow is an external deposit (positive) or withdrawal (negative)
+type CashFlow struct {
+	Asset  string          `json:"asset"`
+	Amount decimal.Decimal `json:"amount"`
+	Note   string          `json:"note,omitempty"`
+	Time   time.Time       `json:"time"`
+}
+
+// Deposit adds external funds to the mock account
+func (m *MockExchange) Deposit(asset string, amount decimal.Decimal, note string) (decimal.Decimal, error) {
+	if !amount.IsPositive() {
+		return decimal.Zero, fmt.Errorf("deposit amount must be positive")
+	}
+	return m.transfer(asset, amount, note)
+}
+
+// Withdraw removes funds from the mock account, it cannot overdraw
+func (m *MockExchange) Withdraw(asset string, amount decimal.Decimal, note string) (decimal.Decimal, error) {
+	if !amount.IsPositive() {
+		return decimal.Zero, fmt.Errorf("withdraw amount must be positive")
+	}
+	return m.transfer(asset, amount.Neg(), note)
+}
+
+func (m *MockExchange) transfer(asset string, amount decimal.Decimal, note string) (decimal.Decimal, error) {
+	asset = strings.ToUpper(asset)
+	if asset == "" {
+		return decimal.Zero, fmt.Errorf("asset is required")
+	}
+	m.mt.Lock()
+	defer m.mt.Unlock()
+
+	bal := m.balances[asset].Add(amount)
+	if bal.IsNegative() {
+		return m.balances[asset], fmt.Errorf("insufficient %s balance: have %s", asset, m.balances[asset].StringFixed(4))
+	}
+	m.balances[asset] = bal
+	m.flows = append(m.flows, CashFlow{Asset: asset, Amount: amount, Note: note, Time: m.clock.Now()})
+	kind := "deposit"
+	if amount.IsNegative() {
+		kind = "withdrawal"
+	}
+	log.Printf("Mock exchange %s %s %s, balance now %s", kind, amount.Abs(), asset, bal)
+	return bal, nil
+}
+
+// CashFlows lists deposits and withdrawals in the order they happened
+func (m *MockExchange) CashFlows() []CashFlow {
+	m.mt.RLock()
+	defer m.mt.RUnlock()
+	out := make([]CashFlow, len(m.flows))
+	copy(out, m.flows)
+	return out
+}
+
+// NetDeposits is the sum of external flows of asset. Subtract it from equity
+// to get trading PnL.
+func (m *MockExchange) NetDeposits(asset string) decimal.Decimal {
+	m.mt.RLock()
+	defer m.mt.RUnlock()
+	net := decimal.Zero
+	for _, f := range m.flows {
+		if f.Asset == strings.ToUpper(asset) {
+			net = net.Add(f.Amount)
+		}
+	}
+	return net
+}
@@ -0,0 +1,7 @@
+// Package grpcapi holds the code generated from proto/tradingengine/v1.
+// Regenerate it with protoc, protoc-gen-go and protoc-gen-go-grpc installed:
+//
+//	go generate ./pkg/grpcapi
+package grpcapi
+
+//go:generate protoc -I ../../proto --go_out=. --go_opt=module=github.com/omept/trading-engine/pkg/grpcapi --go-grpc_out=. --go-grpc_opt=module=github.com/omept/trading-engine/pkg/grpcapi tradingengine/v1/engine.proto
@@ -0,0 +1,2100 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: tradingengine/v1/engine.proto
+
+// Control and data API of the trading engine, served next to the REST API
+// when grpc_addr is set. Callers authenticate with the same API keys and
+// JWTs as the REST API, sent as x-api-key or authorization: Bearer metadata.
+// Decimal amounts are strings so no precision is lost.
+
+package tradingenginev1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Side int32
+
+const (
+	Side_SIDE_UNSPECIFIED Side = 0
+	Side_SIDE_BUY         Side = 1
+	Side_SIDE_SELL        Side = 2
+)
+
+// Enum value maps for Side.
+var (
+	Side_name = map[int32]string{
+		0: "SIDE_UNSPECIFIED",
+		1: "SIDE_BUY",
+		2: "SIDE_SELL",
+	}
+	Side_value = map[string]int32{
+		"SIDE_UNSPECIFIED": 0,
+		"SIDE_BUY":         1,
+		"SIDE_SELL":        2,
+	}
+)
+
+func (x Side) Enum() *Side {
+	p := new(Side)
+	*p = x
+	return p
+}
+
+func (x Side) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Side) Descriptor() protoreflect.EnumDescriptor {
+	return file_tradingengine_v1_engine_proto_enumTypes[0].Descriptor()
+}
+
+func (Side) Type() protoreflect.EnumType {
+	return &file_tradingengine_v1_engine_proto_enumTypes[0]
+}
+
+func (x Side) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Side.Descriptor instead.
+func (Side) EnumDescriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{0}
+}
+
+type OrderType int32
+
+const (
+	OrderType_ORDER_TYPE_UNSPECIFIED OrderType = 0 // market
+	OrderType_ORDER_TYPE_MARKET      OrderType = 1
+	OrderType_ORDER_TYPE_LIMIT       OrderType = 2
+)
+
+// Enum value maps for OrderType.
+var (
+	OrderType_name = map[int32]string{
+		0: "ORDER_TYPE_UNSPECIFIED",
+		1: "ORDER_TYPE_MARKET",
+		2: "ORDER_TYPE_LIMIT",
+	}
+	OrderType_value = map[string]int32{
+		"ORDER_TYPE_UNSPECIFIED": 0,
+		"ORDER_TYPE_MARKET":      1,
+		"ORDER_TYPE_LIMIT":       2,
+	}
+)
+
+func (x OrderType) Enum() *OrderType {
+	p := new(OrderType)
+	*p = x
+	return p
+}
+
+func (x OrderType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (OrderType) Descriptor() protoreflect.EnumDescriptor {
+	return file_tradingengine_v1_engine_proto_enumTypes[1].Descriptor()
+}
+
+func (OrderType) Type() protoreflect.EnumType {
+	return &file_tradingengine_v1_engine_proto_enumTypes[1]
+}
+
+func (x OrderType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use OrderType.Descriptor instead.
+func (OrderType) EnumDescriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{1}
+}
+
+type OrderEvent_Type int32
+
+const (
+	OrderEvent_TYPE_UNSPECIFIED OrderEvent_Type = 0
+	OrderEvent_TYPE_UPDATED     OrderEvent_Type = 1 // the order changed status
+	OrderEvent_TYPE_FILLED      OrderEvent_Type = 2 // an execution, order quantity and price are those of the fill
+)
+
+// Enum value maps for OrderEvent_Type.
+var (
+	OrderEvent_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "TYPE_UPDATED",
+		2: "TYPE_FILLED",
+	}
+	OrderEvent_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"TYPE_UPDATED":     1,
+		"TYPE_FILLED":      2,
+	}
+)
+
+func (x OrderEvent_Type) Enum() *OrderEvent_Type {
+	p := new(OrderEvent_Type)
+	*p = x
+	return p
+}
+
+func (x OrderEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (OrderEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_tradingengine_v1_engine_proto_enumTypes[2].Descriptor()
+}
+
+func (OrderEvent_Type) Type() protoreflect.EnumType {
+	return &file_tradingengine_v1_engine_proto_enumTypes[2]
+}
+
+func (x OrderEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use OrderEvent_Type.Descriptor instead.
+func (OrderEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{31, 0}
+}
+
+type Order struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	ClientOrderId string                 `protobuf:"bytes,2,opt,name=client_order_id,json=clientOrderId,proto3" json:"client_order_id,omitempty"`
+	Strategy      string                 `protobuf:"bytes,3,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	Symbol        string                 `protobuf:"bytes,4,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Side          Side                   `protobuf:"varint,5,opt,name=side,proto3,enum=tradingengine.v1.Side" json:"side,omitempty"`
+	Type          OrderType              `protobuf:"varint,6,opt,name=type,proto3,enum=tradingengine.v1.OrderType" json:"type,omitempty"`
+	Price         string                 `protobuf:"bytes,7,opt,name=price,proto3" json:"price,omitempty"`
+	Quantity      string                 `protobuf:"bytes,8,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	FilledQty     string                 `protobuf:"bytes,9,opt,name=filled_qty,json=filledQty,proto3" json:"filled_qty,omitempty"`
+	FilledPrice   string                 `protobuf:"bytes,10,opt,name=filled_price,json=filledPrice,proto3" json:"filled_price,omitempty"` // average over the whole order
+	Remaining     string                 `protobuf:"bytes,11,opt,name=remaining,proto3" json:"remaining,omitempty"`
+	Status        string                 `protobuf:"bytes,12,opt,name=status,proto3" json:"status,omitempty"` // NEW | PARTIALLY_FILLED | FILLED | CANCELED | REJECTED
+	TraceId       string                 `protobuf:"bytes,13,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Order) Reset() {
+	*x = Order{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Order) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Order) ProtoMessage() {}
+
+func (x *Order) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Order.ProtoReflect.Descriptor instead.
+func (*Order) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Order) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Order) GetClientOrderId() string {
+	if x != nil {
+		return x.ClientOrderId
+	}
+	return ""
+}
+
+func (x *Order) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *Order) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *Order) GetSide() Side {
+	if x != nil {
+		return x.Side
+	}
+	return Side_SIDE_UNSPECIFIED
+}
+
+func (x *Order) GetType() OrderType {
+	if x != nil {
+		return x.Type
+	}
+	return OrderType_ORDER_TYPE_UNSPECIFIED
+}
+
+func (x *Order) GetPrice() string {
+	if x != nil {
+		return x.Price
+	}
+	return ""
+}
+
+func (x *Order) GetQuantity() string {
+	if x != nil {
+		return x.Quantity
+	}
+	return ""
+}
+
+func (x *Order) GetFilledQty() string {
+	if x != nil {
+		return x.FilledQty
+	}
+	return ""
+}
+
+func (x *Order) GetFilledPrice() string {
+	if x != nil {
+		return x.FilledPrice
+	}
+	return ""
+}
+
+func (x *Order) GetRemaining() string {
+	if x != nil {
+		return x.Remaining
+	}
+	return ""
+}
+
+func (x *Order) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Order) GetTraceId() string {
+	if x != nil {
+		return x.TraceId
+	}
+	return ""
+}
+
+type Strategy struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Name            string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type            string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Symbol          string                 `protobuf:"bytes,3,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	IntervalSeconds int64                  `protobuf:"varint,4,opt,name=interval_seconds,json=intervalSeconds,proto3" json:"interval_seconds,omitempty"`
+	AccountUsd      string                 `protobuf:"bytes,5,opt,name=account_usd,json=accountUsd,proto3" json:"account_usd,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Strategy) Reset() {
+	*x = Strategy{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Strategy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Strategy) ProtoMessage() {}
+
+func (x *Strategy) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Strategy.ProtoReflect.Descriptor instead.
+func (*Strategy) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Strategy) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Strategy) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Strategy) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *Strategy) GetIntervalSeconds() int64 {
+	if x != nil {
+		return x.IntervalSeconds
+	}
+	return 0
+}
+
+func (x *Strategy) GetAccountUsd() string {
+	if x != nil {
+		return x.AccountUsd
+	}
+	return ""
+}
+
+type Position struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Strategy      string                 `protobuf:"bytes,1,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	Symbol        string                 `protobuf:"bytes,2,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Quantity      string                 `protobuf:"bytes,3,opt,name=quantity,proto3" json:"quantity,omitempty"` // negative when short
+	AvgPrice      string                 `protobuf:"bytes,4,opt,name=avg_price,json=avgPrice,proto3" json:"avg_price,omitempty"`
+	Realized      string                 `protobuf:"bytes,5,opt,name=realized,proto3" json:"realized,omitempty"`
+	Unrealized    string                 `protobuf:"bytes,6,opt,name=unrealized,proto3" json:"unrealized,omitempty"`
+	Fees          string                 `protobuf:"bytes,7,opt,name=fees,proto3" json:"fees,omitempty"`
+	MarkPrice     string                 `protobuf:"bytes,8,opt,name=mark_price,json=markPrice,proto3" json:"mark_price,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Position) Reset() {
+	*x = Position{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Position) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Position) ProtoMessage() {}
+
+func (x *Position) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Position.ProtoReflect.Descriptor instead.
+func (*Position) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Position) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *Position) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *Position) GetQuantity() string {
+	if x != nil {
+		return x.Quantity
+	}
+	return ""
+}
+
+func (x *Position) GetAvgPrice() string {
+	if x != nil {
+		return x.AvgPrice
+	}
+	return ""
+}
+
+func (x *Position) GetRealized() string {
+	if x != nil {
+		return x.Realized
+	}
+	return ""
+}
+
+func (x *Position) GetUnrealized() string {
+	if x != nil {
+		return x.Unrealized
+	}
+	return ""
+}
+
+func (x *Position) GetFees() string {
+	if x != nil {
+		return x.Fees
+	}
+	return ""
+}
+
+func (x *Position) GetMarkPrice() string {
+	if x != nil {
+		return x.MarkPrice
+	}
+	return ""
+}
+
+type Candle struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Open          float64                `protobuf:"fixed64,2,opt,name=open,proto3" json:"open,omitempty"`
+	High          float64                `protobuf:"fixed64,3,opt,name=high,proto3" json:"high,omitempty"`
+	Low           float64                `protobuf:"fixed64,4,opt,name=low,proto3" json:"low,omitempty"`
+	Close         float64                `protobuf:"fixed64,5,opt,name=close,proto3" json:"close,omitempty"`
+	Volume        float64                `protobuf:"fixed64,6,opt,name=volume,proto3" json:"volume,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Candle) Reset() {
+	*x = Candle{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Candle) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Candle) ProtoMessage() {}
+
+func (x *Candle) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Candle.ProtoReflect.Descriptor instead.
+func (*Candle) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Candle) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Candle) GetOpen() float64 {
+	if x != nil {
+		return x.Open
+	}
+	return 0
+}
+
+func (x *Candle) GetHigh() float64 {
+	if x != nil {
+		return x.High
+	}
+	return 0
+}
+
+func (x *Candle) GetLow() float64 {
+	if x != nil {
+		return x.Low
+	}
+	return 0
+}
+
+func (x *Candle) GetClose() float64 {
+	if x != nil {
+		return x.Close
+	}
+	return 0
+}
+
+func (x *Candle) GetVolume() float64 {
+	if x != nil {
+		return x.Volume
+	}
+	return 0
+}
+
+type GetStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusRequest) Reset() {
+	*x = GetStatusRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusRequest) ProtoMessage() {}
+
+func (x *GetStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{4}
+}
+
+type GetStatusResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"` // Started | Halted | Stopped
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusResponse) Reset() {
+	*x = GetStatusResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusResponse) ProtoMessage() {}
+
+func (x *GetStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusResponse.ProtoReflect.Descriptor instead.
+func (*GetStatusResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetStatusResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type StartRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartRequest) Reset() {
+	*x = StartRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartRequest) ProtoMessage() {}
+
+func (x *StartRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartRequest.ProtoReflect.Descriptor instead.
+func (*StartRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{6}
+}
+
+type StartResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartResponse) Reset() {
+	*x = StartResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartResponse) ProtoMessage() {}
+
+func (x *StartResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartResponse.ProtoReflect.Descriptor instead.
+func (*StartResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{7}
+}
+
+type StopRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StopRequest) Reset() {
+	*x = StopRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StopRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopRequest) ProtoMessage() {}
+
+func (x *StopRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopRequest.ProtoReflect.Descriptor instead.
+func (*StopRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{8}
+}
+
+type StopResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StopResponse) Reset() {
+	*x = StopResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StopResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopResponse) ProtoMessage() {}
+
+func (x *StopResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopResponse.ProtoReflect.Descriptor instead.
+func (*StopResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{9}
+}
+
+type HaltRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HaltRequest) Reset() {
+	*x = HaltRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HaltRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HaltRequest) ProtoMessage() {}
+
+func (x *HaltRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HaltRequest.ProtoReflect.Descriptor instead.
+func (*HaltRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{10}
+}
+
+type HaltResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HaltResponse) Reset() {
+	*x = HaltResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HaltResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HaltResponse) ProtoMessage() {}
+
+func (x *HaltResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HaltResponse.ProtoReflect.Descriptor instead.
+func (*HaltResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{11}
+}
+
+type ResumeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResumeRequest) Reset() {
+	*x = ResumeRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResumeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResumeRequest) ProtoMessage() {}
+
+func (x *ResumeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResumeRequest.ProtoReflect.Descriptor instead.
+func (*ResumeRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{12}
+}
+
+type ResumeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResumeResponse) Reset() {
+	*x = ResumeResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResumeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResumeResponse) ProtoMessage() {}
+
+func (x *ResumeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResumeResponse.ProtoReflect.Descriptor instead.
+func (*ResumeResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{13}
+}
+
+type ListStrategiesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListStrategiesRequest) Reset() {
+	*x = ListStrategiesRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListStrategiesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListStrategiesRequest) ProtoMessage() {}
+
+func (x *ListStrategiesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListStrategiesRequest.ProtoReflect.Descriptor instead.
+func (*ListStrategiesRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{14}
+}
+
+type ListStrategiesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Strategies    []*Strategy            `protobuf:"bytes,1,rep,name=strategies,proto3" json:"strategies,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListStrategiesResponse) Reset() {
+	*x = ListStrategiesResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListStrategiesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListStrategiesResponse) ProtoMessage() {}
+
+func (x *ListStrategiesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListStrategiesResponse.ProtoReflect.Descriptor instead.
+func (*ListStrategiesResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ListStrategiesResponse) GetStrategies() []*Strategy {
+	if x != nil {
+		return x.Strategies
+	}
+	return nil
+}
+
+type AddStrategyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"` // defaults to the type's name, must be unique
+	Symbol        string                 `protobuf:"bytes,3,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Capital       float64                `protobuf:"fixed64,4,opt,name=capital,proto3" json:"capital,omitempty"`
+	ParamsJson    string                 `protobuf:"bytes,5,opt,name=params_json,json=paramsJson,proto3" json:"params_json,omitempty"` // type specific parameters as a JSON object
+	Interval      string                 `protobuf:"bytes,6,opt,name=interval,proto3" json:"interval,omitempty"`                       // candle size like "5m", 1m when empty
+	LongOnly      *bool                  `protobuf:"varint,7,opt,name=long_only,json=longOnly,proto3,oneof" json:"long_only,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddStrategyRequest) Reset() {
+	*x = AddStrategyRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddStrategyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddStrategyRequest) ProtoMessage() {}
+
+func (x *AddStrategyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddStrategyRequest.ProtoReflect.Descriptor instead.
+func (*AddStrategyRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *AddStrategyRequest) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *AddStrategyRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *AddStrategyRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *AddStrategyRequest) GetCapital() float64 {
+	if x != nil {
+		return x.Capital
+	}
+	return 0
+}
+
+func (x *AddStrategyRequest) GetParamsJson() string {
+	if x != nil {
+		return x.ParamsJson
+	}
+	return ""
+}
+
+func (x *AddStrategyRequest) GetInterval() string {
+	if x != nil {
+		return x.Interval
+	}
+	return ""
+}
+
+func (x *AddStrategyRequest) GetLongOnly() bool {
+	if x != nil && x.LongOnly != nil {
+		return *x.LongOnly
+	}
+	return false
+}
+
+type AddStrategyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Strategy      *Strategy              `protobuf:"bytes,1,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddStrategyResponse) Reset() {
+	*x = AddStrategyResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddStrategyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddStrategyResponse) ProtoMessage() {}
+
+func (x *AddStrategyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddStrategyResponse.ProtoReflect.Descriptor instead.
+func (*AddStrategyResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *AddStrategyResponse) GetStrategy() *Strategy {
+	if x != nil {
+		return x.Strategy
+	}
+	return nil
+}
+
+type RemoveStrategyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveStrategyRequest) Reset() {
+	*x = RemoveStrategyRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveStrategyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveStrategyRequest) ProtoMessage() {}
+
+func (x *RemoveStrategyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveStrategyRequest.ProtoReflect.Descriptor instead.
+func (*RemoveStrategyRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *RemoveStrategyRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type RemoveStrategyResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveStrategyResponse) Reset() {
+	*x = RemoveStrategyResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveStrategyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveStrategyResponse) ProtoMessage() {}
+
+func (x *RemoveStrategyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveStrategyResponse.ProtoReflect.Descriptor instead.
+func (*RemoveStrategyResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{19}
+}
+
+type PlaceOrderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Side          Side                   `protobuf:"varint,2,opt,name=side,proto3,enum=tradingengine.v1.Side" json:"side,omitempty"`
+	Type          OrderType              `protobuf:"varint,3,opt,name=type,proto3,enum=tradingengine.v1.OrderType" json:"type,omitempty"`
+	Quantity      string                 `protobuf:"bytes,4,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	Price         string                 `protobuf:"bytes,5,opt,name=price,proto3" json:"price,omitempty"`                                        // limit price, market orders take the last price
+	ClientOrderId string                 `protobuf:"bytes,6,opt,name=client_order_id,json=clientOrderId,proto3" json:"client_order_id,omitempty"` // idempotency key, resubmitting it returns the first order
+	Strategy      string                 `protobuf:"bytes,7,opt,name=strategy,proto3" json:"strategy,omitempty"`                                  // attributes the order and its fills to a strategy's position
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlaceOrderRequest) Reset() {
+	*x = PlaceOrderRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlaceOrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlaceOrderRequest) ProtoMessage() {}
+
+func (x *PlaceOrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlaceOrderRequest.ProtoReflect.Descriptor instead.
+func (*PlaceOrderRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *PlaceOrderRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetSide() Side {
+	if x != nil {
+		return x.Side
+	}
+	return Side_SIDE_UNSPECIFIED
+}
+
+func (x *PlaceOrderRequest) GetType() OrderType {
+	if x != nil {
+		return x.Type
+	}
+	return OrderType_ORDER_TYPE_UNSPECIFIED
+}
+
+func (x *PlaceOrderRequest) GetQuantity() string {
+	if x != nil {
+		return x.Quantity
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetPrice() string {
+	if x != nil {
+		return x.Price
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetClientOrderId() string {
+	if x != nil {
+		return x.ClientOrderId
+	}
+	return ""
+}
+
+func (x *PlaceOrderRequest) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+type PlaceOrderResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Order         *Order                 `protobuf:"bytes,1,opt,name=order,proto3" json:"order,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlaceOrderResponse) Reset() {
+	*x = PlaceOrderResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlaceOrderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlaceOrderResponse) ProtoMessage() {}
+
+func (x *PlaceOrderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlaceOrderResponse.ProtoReflect.Descriptor instead.
+func (*PlaceOrderResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *PlaceOrderResponse) GetOrder() *Order {
+	if x != nil {
+		return x.Order
+	}
+	return nil
+}
+
+type CancelOrderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	OrderId       string                 `protobuf:"bytes,2,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelOrderRequest) Reset() {
+	*x = CancelOrderRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelOrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelOrderRequest) ProtoMessage() {}
+
+func (x *CancelOrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelOrderRequest.ProtoReflect.Descriptor instead.
+func (*CancelOrderRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *CancelOrderRequest) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *CancelOrderRequest) GetOrderId() string {
+	if x != nil {
+		return x.OrderId
+	}
+	return ""
+}
+
+type CancelOrderResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelOrderResponse) Reset() {
+	*x = CancelOrderResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelOrderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelOrderResponse) ProtoMessage() {}
+
+func (x *CancelOrderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelOrderResponse.ProtoReflect.Descriptor instead.
+func (*CancelOrderResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{23}
+}
+
+type ListOpenOrdersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListOpenOrdersRequest) Reset() {
+	*x = ListOpenOrdersRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListOpenOrdersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOpenOrdersRequest) ProtoMessage() {}
+
+func (x *ListOpenOrdersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOpenOrdersRequest.ProtoReflect.Descriptor instead.
+func (*ListOpenOrdersRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{24}
+}
+
+type ListOpenOrdersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Orders        []*Order               `protobuf:"bytes,1,rep,name=orders,proto3" json:"orders,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListOpenOrdersResponse) Reset() {
+	*x = ListOpenOrdersResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListOpenOrdersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOpenOrdersResponse) ProtoMessage() {}
+
+func (x *ListOpenOrdersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOpenOrdersResponse.ProtoReflect.Descriptor instead.
+func (*ListOpenOrdersResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *ListOpenOrdersResponse) GetOrders() []*Order {
+	if x != nil {
+		return x.Orders
+	}
+	return nil
+}
+
+type ListPositionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPositionsRequest) Reset() {
+	*x = ListPositionsRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPositionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPositionsRequest) ProtoMessage() {}
+
+func (x *ListPositionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPositionsRequest.ProtoReflect.Descriptor instead.
+func (*ListPositionsRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{26}
+}
+
+type ListPositionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Positions     []*Position            `protobuf:"bytes,1,rep,name=positions,proto3" json:"positions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPositionsResponse) Reset() {
+	*x = ListPositionsResponse{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPositionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPositionsResponse) ProtoMessage() {}
+
+func (x *ListPositionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPositionsResponse.ProtoReflect.Descriptor instead.
+func (*ListPositionsResponse) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *ListPositionsResponse) GetPositions() []*Position {
+	if x != nil {
+		return x.Positions
+	}
+	return nil
+}
+
+type StreamMarketDataRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbols       []string               `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"` // all when empty
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamMarketDataRequest) Reset() {
+	*x = StreamMarketDataRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamMarketDataRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamMarketDataRequest) ProtoMessage() {}
+
+func (x *StreamMarketDataRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamMarketDataRequest.ProtoReflect.Descriptor instead.
+func (*StreamMarketDataRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *StreamMarketDataRequest) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+type MarketDataEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbol        string                 `protobuf:"bytes,1,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Candle        *Candle                `protobuf:"bytes,2,opt,name=candle,proto3" json:"candle,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MarketDataEvent) Reset() {
+	*x = MarketDataEvent{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MarketDataEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MarketDataEvent) ProtoMessage() {}
+
+func (x *MarketDataEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MarketDataEvent.ProtoReflect.Descriptor instead.
+func (*MarketDataEvent) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *MarketDataEvent) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *MarketDataEvent) GetCandle() *Candle {
+	if x != nil {
+		return x.Candle
+	}
+	return nil
+}
+
+type StreamOrderEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Symbols       []string               `protobuf:"bytes,1,rep,name=symbols,proto3" json:"symbols,omitempty"` // all when empty
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamOrderEventsRequest) Reset() {
+	*x = StreamOrderEventsRequest{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamOrderEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamOrderEventsRequest) ProtoMessage() {}
+
+func (x *StreamOrderEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamOrderEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamOrderEventsRequest) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *StreamOrderEventsRequest) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+type OrderEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          OrderEvent_Type        `protobuf:"varint,1,opt,name=type,proto3,enum=tradingengine.v1.OrderEvent_Type" json:"type,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	Order         *Order                 `protobuf:"bytes,3,opt,name=order,proto3" json:"order,omitempty"`
+	Fee           string                 `protobuf:"bytes,4,opt,name=fee,proto3" json:"fee,omitempty"` // of a fill, in the quote asset
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OrderEvent) Reset() {
+	*x = OrderEvent{}
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OrderEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrderEvent) ProtoMessage() {}
+
+func (x *OrderEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_tradingengine_v1_engine_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrderEvent.ProtoReflect.Descriptor instead.
+func (*OrderEvent) Descriptor() ([]byte, []int) {
+	return file_tradingengine_v1_engine_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *OrderEvent) GetType() OrderEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return OrderEvent_TYPE_UNSPECIFIED
+}
+
+func (x *OrderEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *OrderEvent) GetOrder() *Order {
+	if x != nil {
+		return x.Order
+	}
+	return nil
+}
+
+func (x *OrderEvent) GetFee() string {
+	if x != nil {
+		return x.Fee
+	}
+	return ""
+}
+
+var File_tradingengine_v1_engine_proto protoreflect.FileDescriptor
+
+const file_tradingengine_v1_engine_proto_rawDesc = "" +
+	"\n" +
+	"\x1dtradingengine/v1/engine.proto\x12\x10tradingengine.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x95\x03\n" +
+	"\x05Order\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12&\n" +
+	"\x0fclient_order_id\x18\x02 \x01(\tR\rclientOrderId\x12\x1a\n" +
+	"\bstrategy\x18\x03 \x01(\tR\bstrategy\x12\x16\n" +
+	"\x06symbol\x18\x04 \x01(\tR\x06symbol\x12*\n" +
+	"\x04side\x18\x05 \x01(\x0e2\x16.tradingengine.v1.SideR\x04side\x12/\n" +
+	"\x04type\x18\x06 \x01(\x0e2\x1b.tradingengine.v1.OrderTypeR\x04type\x12\x14\n" +
+	"\x05price\x18\a \x01(\tR\x05price\x12\x1a\n" +
+	"\bquantity\x18\b \x01(\tR\bquantity\x12\x1d\n" +
+	"\n" +
+	"filled_qty\x18\t \x01(\tR\tfilledQty\x12!\n" +
+	"\ffilled_price\x18\n" +
+	" \x01(\tR\vfilledPrice\x12\x1c\n" +
+	"\tremaining\x18\v \x01(\tR\tremaining\x12\x16\n" +
+	"\x06status\x18\f \x01(\tR\x06status\x12\x19\n" +
+	"\btrace_id\x18\r \x01(\tR\atraceId\"\x96\x01\n" +
+	"\bStrategy\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x16\n" +
+	"\x06symbol\x18\x03 \x01(\tR\x06symbol\x12)\n" +
+	"\x10interval_seconds\x18\x04 \x01(\x03R\x0fintervalSeconds\x12\x1f\n" +
+	"\vaccount_usd\x18\x05 \x01(\tR\n" +
+	"accountUsd\"\xe6\x01\n" +
+	"\bPosition\x12\x1a\n" +
+	"\bstrategy\x18\x01 \x01(\tR\bstrategy\x12\x16\n" +
+	"\x06symbol\x18\x02 \x01(\tR\x06symbol\x12\x1a\n" +
+	"\bquantity\x18\x03 \x01(\tR\bquantity\x12\x1b\n" +
+	"\tavg_price\x18\x04 \x01(\tR\bavgPrice\x12\x1a\n" +
+	"\brealized\x18\x05 \x01(\tR\brealized\x12\x1e\n" +
+	"\n" +
+	"unrealized\x18\x06 \x01(\tR\n" +
+	"unrealized\x12\x12\n" +
+	"\x04fees\x18\a \x01(\tR\x04fees\x12\x1d\n" +
+	"\n" +
+	"mark_price\x18\b \x01(\tR\tmarkPrice\"\xa0\x01\n" +
+	"\x06Candle\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x12\n" +
+	"\x04open\x18\x02 \x01(\x01R\x04open\x12\x12\n" +
+	"\x04high\x18\x03 \x01(\x01R\x04high\x12\x10\n" +
+	"\x03low\x18\x04 \x01(\x01R\x03low\x12\x14\n" +
+	"\x05close\x18\x05 \x01(\x01R\x05close\x12\x16\n" +
+	"\x06volume\x18\x06 \x01(\x01R\x06volume\"\x12\n" +
+	"\x10GetStatusRequest\"-\n" +
+	"\x11GetStatusResponse\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\"\x0e\n" +
+	"\fStartRequest\"\x0f\n" +
+	"\rStartResponse\"\r\n" +
+	"\vStopRequest\"\x0e\n" +
+	"\fStopResponse\"\r\n" +
+	"\vHaltRequest\"\x0e\n" +
+	"\fHaltResponse\"\x0f\n" +
+	"\rResumeRequest\"\x10\n" +
+	"\x0eResumeResponse\"\x17\n" +
+	"\x15ListStrategiesRequest\"T\n" +
+	"\x16ListStrategiesResponse\x12:\n" +
+	"\n" +
+	"strategies\x18\x01 \x03(\v2\x1a.tradingengine.v1.StrategyR\n" +
+	"strategies\"\xdb\x01\n" +
+	"\x12AddStrategyRequest\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x16\n" +
+	"\x06symbol\x18\x03 \x01(\tR\x06symbol\x12\x18\n" +
+	"\acapital\x18\x04 \x01(\x01R\acapital\x12\x1f\n" +
+	"\vparams_json\x18\x05 \x01(\tR\n" +
+	"paramsJson\x12\x1a\n" +
+	"\binterval\x18\x06 \x01(\tR\binterval\x12 \n" +
+	"\tlong_only\x18\a \x01(\bH\x00R\blongOnly\x88\x01\x01B\f\n" +
+	"\n" +
+	"_long_only\"M\n" +
+	"\x13AddStrategyResponse\x126\n" +
+	"\bstrategy\x18\x01 \x01(\v2\x1a.tradingengine.v1.StrategyR\bstrategy\"+\n" +
+	"\x15RemoveStrategyRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"\x18\n" +
+	"\x16RemoveStrategyResponse\"\xfe\x01\n" +
+	"\x11PlaceOrderRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12*\n" +
+	"\x04side\x18\x02 \x01(\x0e2\x16.tradingengine.v1.SideR\x04side\x12/\n" +
+	"\x04type\x18\x03 \x01(\x0e2\x1b.tradingengine.v1.OrderTypeR\x04type\x12\x1a\n" +
+	"\bquantity\x18\x04 \x01(\tR\bquantity\x12\x14\n" +
+	"\x05price\x18\x05 \x01(\tR\x05price\x12&\n" +
+	"\x0fclient_order_id\x18\x06 \x01(\tR\rclientOrderId\x12\x1a\n" +
+	"\bstrategy\x18\a \x01(\tR\bstrategy\"C\n" +
+	"\x12PlaceOrderResponse\x12-\n" +
+	"\x05order\x18\x01 \x01(\v2\x17.tradingengine.v1.OrderR\x05order\"G\n" +
+	"\x12CancelOrderRequest\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x12\x19\n" +
+	"\border_id\x18\x02 \x01(\tR\aorderId\"\x15\n" +
+	"\x13CancelOrderResponse\"\x17\n" +
+	"\x15ListOpenOrdersRequest\"I\n" +
+	"\x16ListOpenOrdersResponse\x12/\n" +
+	"\x06orders\x18\x01 \x03(\v2\x17.tradingengine.v1.OrderR\x06orders\"\x16\n" +
+	"\x14ListPositionsRequest\"Q\n" +
+	"\x15ListPositionsResponse\x128\n" +
+	"\tpositions\x18\x01 \x03(\v2\x1a.tradingengine.v1.PositionR\tpositions\"3\n" +
+	"\x17StreamMarketDataRequest\x12\x18\n" +
+	"\asymbols\x18\x01 \x03(\tR\asymbols\"[\n" +
+	"\x0fMarketDataEvent\x12\x16\n" +
+	"\x06symbol\x18\x01 \x01(\tR\x06symbol\x120\n" +
+	"\x06candle\x18\x02 \x01(\v2\x18.tradingengine.v1.CandleR\x06candle\"4\n" +
+	"\x18StreamOrderEventsRequest\x12\x18\n" +
+	"\asymbols\x18\x01 \x03(\tR\asymbols\"\xf5\x01\n" +
+	"\n" +
+	"OrderEvent\x125\n" +
+	"\x04type\x18\x01 \x01(\x0e2!.tradingengine.v1.OrderEvent.TypeR\x04type\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12-\n" +
+	"\x05order\x18\x03 \x01(\v2\x17.tradingengine.v1.OrderR\x05order\x12\x10\n" +
+	"\x03fee\x18\x04 \x01(\tR\x03fee\"?\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fTYPE_UPDATED\x10\x01\x12\x0f\n" +
+	"\vTYPE_FILLED\x10\x02*9\n" +
+	"\x04Side\x12\x14\n" +
+	"\x10SIDE_UNSPECIFIED\x10\x00\x12\f\n" +
+	"\bSIDE_BUY\x10\x01\x12\r\n" +
+	"\tSIDE_SELL\x10\x02*T\n" +
+	"\tOrderType\x12\x1a\n" +
+	"\x16ORDER_TYPE_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11ORDER_TYPE_MARKET\x10\x01\x12\x14\n" +
+	"\x10ORDER_TYPE_LIMIT\x10\x022\xf1\t\n" +
+	"\rEngineService\x12T\n" +
+	"\tGetStatus\x12\".tradingengine.v1.GetStatusRequest\x1a#.tradingengine.v1.GetStatusResponse\x12H\n" +
+	"\x05Start\x12\x1e.tradingengine.v1.StartRequest\x1a\x1f.tradingengine.v1.StartResponse\x12E\n" +
+	"\x04Stop\x12\x1d.tradingengine.v1.StopRequest\x1a\x1e.tradingengine.v1.StopResponse\x12E\n" +
+	"\x04Halt\x12\x1d.tradingengine.v1.HaltRequest\x1a\x1e.tradingengine.v1.HaltResponse\x12K\n" +
+	"\x06Resume\x12\x1f.tradingengine.v1.ResumeRequest\x1a .tradingengine.v1.ResumeResponse\x12c\n" +
+	"\x0eListStrategies\x12'.tradingengine.v1.ListStrategiesRequest\x1a(.tradingengine.v1.ListStrategiesResponse\x12Z\n" +
+	"\vAddStrategy\x12$.tradingengine.v1.AddStrategyRequest\x1a%.tradingengine.v1.AddStrategyResponse\x12c\n" +
+	"\x0eRemoveStrategy\x12'.tradingengine.v1.RemoveStrategyRequest\x1a(.tradingengine.v1.RemoveStrategyResponse\x12W\n" +
+	"\n" +
+	"PlaceOrder\x12#.tradingengine.v1.PlaceOrderRequest\x1a$.tradingengine.v1.PlaceOrderResponse\x12Z\n" +
+	"\vCancelOrder\x12$.tradingengine.v1.CancelOrderRequest\x1a%.tradingengine.v1.CancelOrderResponse\x12c\n" +
+	"\x0eListOpenOrders\x12'.tradingengine.v1.ListOpenOrdersRequest\x1a(.tradingengine.v1.ListOpenOrdersResponse\x12`\n" +
+	"\rListPositions\x12&.tradingengine.v1.ListPositionsRequest\x1a'.tradingengine.v1.ListPositionsResponse\x12b\n" +
+	"\x10StreamMarketData\x12).tradingengine.v1.StreamMarketDataRequest\x1a!.tradingengine.v1.MarketDataEvent0\x01\x12_\n" +
+	"\x11StreamOrderEvents\x12*.tradingengine.v1.StreamOrderEventsRequest\x1a\x1c.tradingengine.v1.OrderEvent0\x01BMZKgithub.com/omept/trading-engine/pkg/grpcapi/tradingenginev1;tradingenginev1b\x06proto3"
+
+var (
+	file_tradingengine_v1_engine_proto_rawDescOnce sync.Once
+	file_tradingengine_v1_engine_proto_rawDescData []byte
+)
+
+func file_tradingengine_v1_engine_proto_rawDescGZIP() []byte {
+	file_tradingengine_v1_engine_proto_rawDescOnce.Do(func() {
+		file_tradingengine_v1_engine_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_tradingengine_v1_engine_proto_rawDesc), len(file_tradingengine_v1_engine_proto_rawDesc)))
+	})
+	return file_tradingengine_v1_engine_proto_rawDescData
+}
+
+var file_tradingengine_v1_engine_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_tradingengine_v1_engine_proto_msgTypes = make([]protoimpl.MessageInfo, 32)
+var file_tradingengine_v1_engine_proto_goTypes = []any{
+	(Side)(0),                        // 0: tradingengine.v1.Side
+	(OrderType)(0),                   // 1: tradingengine.v1.OrderType
+	(OrderEvent_Type)(0),             // 2: tradingengine.v1.OrderEvent.Type
+	(*Order)(nil),                    // 3: tradingengine.v1.Order
+	(*Strategy)(nil),                 // 4: tradingengine.v1.Strategy
+	(*Position)(nil),                 // 5: tradingengine.v1.Position
+	(*Candle)(nil),                   // 6: tradingengine.v1.Candle
+	(*GetStatusRequest)(nil),         // 7: tradingengine.v1.GetStatusRequest
+	(*GetStatusResponse)(nil),        // 8: tradingengine.v1.GetStatusResponse
+	(*StartRequest)(nil),             // 9: tradingengine.v1.StartRequest
+	(*StartResponse)(nil),            // 10: tradingengine.v1.StartResponse
+	(*StopRequest)(nil),              // 11: tradingengine.v1.StopRequest
+	(*StopResponse)(nil),             // 12: tradingengine.v1.StopResponse
+	(*HaltRequest)(nil),              // 13: tradingengine.v1.HaltRequest
+	(*HaltResponse)(nil),             // 14: tradingengine.v1.HaltResponse
+	(*ResumeRequest)(nil),            // 15: tradingengine.v1.ResumeRequest
+	(*ResumeResponse)(nil),           // 16: tradingengine.v1.ResumeResponse
+	(*ListStrategiesRequest)(nil),    // 17: tradingengine.v1.ListStrategiesRequest
+	(*ListStrategiesResponse)(nil),   // 18: tradingengine.v1.ListStrategiesResponse
+	(*AddStrategyRequest)(nil),       // 19: tradingengine.v1.AddStrategyRequest
+	(*AddStrategyResponse)(nil),      // 20: tradingengine.v1.AddStrategyResponse
+	(*RemoveStrategyRequest)(nil),    // 21: tradingengine.v1.RemoveStrategyRequest
+	(*RemoveStrategyResponse)(nil),   // 22: tradingengine.v1.RemoveStrategyResponse
+	(*PlaceOrderRequest)(nil),        // 23: tradingengine.v1.PlaceOrderRequest
+	(*PlaceOrderResponse)(nil),       // 24: tradingengine.v1.PlaceOrderResponse
+	(*CancelOrderRequest)(nil),       // 25: tradingengine.v1.CancelOrderRequest
+	(*CancelOrderResponse)(nil),      // 26: tradingengine.v1.CancelOrderResponse
+	(*ListOpenOrdersRequest)(nil),    // 27: tradingengine.v1.ListOpenOrdersRequest
+	(*ListOpenOrdersResponse)(nil),   // 28: tradingengine.v1.ListOpenOrdersResponse
+	(*ListPositionsRequest)(nil),     // 29: tradingengine.v1.ListPositionsRequest
+	(*ListPositionsResponse)(nil),    // 30: tradingengine.v1.ListPositionsResponse
+	(*StreamMarketDataRequest)(nil),  // 31: tradingengine.v1.StreamMarketDataRequest
+	(*MarketDataEvent)(nil),          // 32: tradingengine.v1.MarketDataEvent
+	(*StreamOrderEventsRequest)(nil), // 33: tradingengine.v1.StreamOrderEventsRequest
+	(*OrderEvent)(nil),               // 34: tradingengine.v1.OrderEvent
+	(*timestamppb.Timestamp)(nil),    // 35: google.protobuf.Timestamp
+}
+var file_tradingengine_v1_engine_proto_depIdxs = []int32{
+	0,  // 0: tradingengine.v1.Order.side:type_name -> tradingengine.v1.Side
+	1,  // 1: tradingengine.v1.Order.type:type_name -> tradingengine.v1.OrderType
+	35, // 2: tradingengine.v1.Candle.time:type_name -> google.protobuf.Timestamp
+	4,  // 3: tradingengine.v1.ListStrategiesResponse.strategies:type_name -> tradingengine.v1.Strategy
+	4,  // 4: tradingengine.v1.AddStrategyResponse.strategy:type_name -> tradingengine.v1.Strategy
+	0,  // 5: tradingengine.v1.PlaceOrderRequest.side:type_name -> tradingengine.v1.Side
+	1,  // 6: tradingengine.v1.PlaceOrderRequest.type:type_name -> tradingengine.v1.OrderType
+	3,  // 7: tradingengine.v1.PlaceOrderResponse.order:type_name -> tradingengine.v1.Order
+	3,  // 8: tradingengine.v1.ListOpenOrdersResponse.orders:type_name -> tradingengine.v1.Order
+	5,  // 9: tradingengine.v1.ListPositionsResponse.positions:type_name -> tradingengine.v1.Position
+	6,  // 10: tradingengine.v1.MarketDataEvent.candle:type_name -> tradingengine.v1.Candle
+	2,  // 11: tradingengine.v1.OrderEvent.type:type_name -> tradingengine.v1.OrderEvent.Type
+	35, // 12: tradingengine.v1.OrderEvent.time:type_name -> google.protobuf.Timestamp
+	3,  // 13: tradingengine.v1.OrderEvent.order:type_name -> tradingengine.v1.Order
+	7,  // 14: tradingengine.v1.EngineService.GetStatus:input_type -> tradingengine.v1.GetStatusRequest
+	9,  // 15: tradingengine.v1.EngineService.Start:input_type -> tradingengine.v1.StartRequest
+	11, // 16: tradingengine.v1.EngineService.Stop:input_type -> tradingengine.v1.StopRequest
+	13, // 17: tradingengine.v1.EngineService.Halt:input_type -> tradingengine.v1.HaltRequest
+	15, // 18: tradingengine.v1.EngineService.Resume:input_type -> tradingengine.v1.ResumeRequest
+	17, // 19: tradingengine.v1.EngineService.ListStrategies:input_type -> tradingengine.v1.ListStrategiesRequest
+	19, // 20: tradingengine.v1.EngineService.AddStrategy:input_type -> tradingengine.v1.AddStrategyRequest
+	21, // 21: tradingengine.v1.EngineService.RemoveStrategy:input_type -> tradingengine.v1.RemoveStrategyRequest
+	23, // 22: tradingengine.v1.EngineService.PlaceOrder:input_type -> tradingengine.v1.PlaceOrderRequest
+	25, // 23: tradingengine.v1.EngineService.CancelOrder:input_type -> tradingengine.v1.CancelOrderRequest
+	27, // 24: tradingengine.v1.EngineService.ListOpenOrders:input_type -> tradingengine.v1.ListOpenOrdersRequest
+	29, // 25: tradingengine.v1.EngineService.ListPositions:input_type -> tradingengine.v1.ListPositionsRequest
+	31, // 26: tradingengine.v1.EngineService.StreamMarketData:input_type -> tradingengine.v1.StreamMarketDataRequest
+	33, // 27: tradingengine.v1.EngineService.StreamOrderEvents:input_type -> tradingengine.v1.StreamOrderEventsRequest
+	8,  // 28: tradingengine.v1.EngineService.GetStatus:output_type -> tradingengine.v1.GetStatusResponse
+	10, // 29: tradingengine.v1.EngineService.Start:output_type -> tradingengine.v1.StartResponse
+	12, // 30: tradingengine.v1.EngineService.Stop:output_type -> tradingengine.v1.StopResponse
+	14, // 31: tradingengine.v1.EngineService.Halt:output_type -> tradingengine.v1.HaltResponse
+	16, // 32: tradingengine.v1.EngineService.Resume:output_type -> tradingengine.v1.ResumeResponse
+	18, // 33: tradingengine.v1.EngineService.ListStrategies:output_type -> tradingengine.v1.ListStrategiesResponse
+	20, // 34: tradingengine.v1.EngineService.AddStrategy:output_type -> tradingengine.v1.AddStrategyResponse
+	22, // 35: tradingengine.v1.EngineService.RemoveStrategy:output_type -> tradingengine.v1.RemoveStrategyResponse
+	24, // 36: tradingengine.v1.EngineService.PlaceOrder:output_type -> tradingengine.v1.PlaceOrderResponse
+	26, // 37: tradingengine.v1.EngineService.CancelOrder:output_type -> tradingengine.v1.CancelOrderResponse
+	28, // 38: tradingengine.v1.EngineService.ListOpenOrders:output_type -> tradingengine.v1.ListOpenOrdersResponse
+	30, // 39: tradingengine.v1.EngineService.ListPositions:output_type -> tradingengine.v1.ListPositionsResponse
+	32, // 40: tradingengine.v1.EngineService.StreamMarketData:output_type -> tradingengine.v1.MarketDataEvent
+	34, // 41: tradingengine.v1.EngineService.StreamOrderEvents:output_type -> tradingengine.v1.OrderEvent
+	28, // [28:42] is the sub-list for method output_type
+	14, // [14:28] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
+}
+
+func init() { file_tradingengine_v1_engine_proto_init() }
+func file_tradingengine_v1_engine_proto_init() {
+	if File_tradingengine_v1_engine_proto != nil {
+		return
+	}
+	file_tradingengine_v1_engine_proto_msgTypes[16].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_tradingengine_v1_engine_proto_rawDesc), len(file_tradingengine_v1_engine_proto_rawDesc)),
+			NumEnums:      3,
+			NumMessages:   32,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_tradingengine_v1_engine_proto_goTypes,
+		DependencyIndexes: file_tradingengine_v1_engine_proto_depIdxs,
+		EnumInfos:         file_tradingengine_v1_engine_proto_enumTypes,
+		MessageInfos:      file_tradingengine_v1_engine_proto_msgTypes,
+	}.Build()
+	File_tradingengine_v1_engine_proto = out.File
+	file_tradingengine_v1_engine_proto_goTypes = nil
+	file_tradingengine_v1_engine_proto_depIdxs = nil
+}
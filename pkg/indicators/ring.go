@@ -0,0 +1,58 @@
+// Package indicators holds building blocks shared by strategies.
+package indicators
+
+// Ring keeps the most recent values in a fixed buffer, overwriting the
+// oldest one once full. It never allocates after NewRing.
+type Ring[T any] struct {
+	buf  []T
+	head int // index of the oldest value
+	n    int
+}
+
+// NewRing returns a ring holding up to size values
+func NewRing[T any](size int) *Ring[T] {
+	return &Ring[T]{buf: make([]T, max(size, 1))}
+}
+
+// Push appends x and returns the value it evicted, if the ring was full
+func (r *Ring[T]) Push(x T) (evicted T, ok bool) {
+	if r.n < len(r.buf) {
+		r.buf[(r.head+r.n)%len(r.buf)] = x
+		r.n++
+		return evicted, false
+	}
+	evicted = r.buf[r.head]
+	r.buf[r.head] = x
+	r.head = (r.head + 1) % len(r.buf)
+	return evicted, true
+}
+
+// Len is the number of values held
+func (r *Ring[T]) Len() int { return r.n }
+
+// Cap is the number of values the ring holds once full
+func (r *Ring[T]) Cap() int { return len(r.buf) }
+
+// Full reports whether the next Push evicts a value
+func (r *Ring[T]) Full() bool { return r.n == len(r.buf) }
+
+// At returns the i-th value, 0 being the oldest
+func (r *Ring[T]) At(i int) T {
+	if i < 0 || i >= r.n {
+		panic("indicators: ring index out of range")
+	}
+	return r.buf[(r.head+i)%len(r.buf)]
+}
+
+// Reset empties the ring
+func (r *Ring[T]) Reset() {
+	r.head, r.n = 0, 0
+}
+
+// Values appends the values oldest first to dst
+func (r *Ring[T]) Values(dst []T) []T {
+	for i := 0; i < r.n; i++ {
+		dst = append(dst, r.buf[(r.head+i)%len(r.buf)])
+	}
+	return dst
+}
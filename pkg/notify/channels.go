@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Telegram posts alerts to a chat through a bot
+type Telegram struct {
+	token  string
+	chatID string
+	client *http.Client
+}
+
+func NewTelegram(token, chatID string) *Telegram {
+	return &Telegram{token: token, chatID: chatID, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (t *Telegram) Name() string { return "telegram" }
+
+func (t *Telegram) Send(ctx context.Context, m Message) error {
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", t.token)
+	return postJSON(ctx, t.client, url, map[string]string{
+		"chat_id": t.chatID,
+		"text":    m.Subject + "\n" + m.Text,
+	})
+}
+
+// Slack posts alerts to an incoming webhook
+type Slack struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlack(url string) *Slack {
+	return &Slack{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *Slack) Name() string { return "slack" }
+
+func (s *Slack) Send(ctx context.Context, m Message) error {
+	return postJSON(ctx, s.client, s.url, map[string]string{
+		"text": "*" + m.Subject + "*\n" + m.Text,
+	})
+}
+
+// Webhook posts every alert as a JSON Message
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *Webhook) Name() string { return "webhook" }
+
+func (w *Webhook) Send(ctx context.Context, m Message) error {
+	return postJSON(ctx, w.client, w.url, m)
+}
+
+// Email mails alerts over SMTP, authenticating when a username is set
+type Email struct {
+	addr     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func NewEmail(addr, username, password, from string, to []string) *Email {
+	return &Email{addr: addr, username: username, password: password, from: from, to: to}
+}
+
+func (e *Email) Name() string { return "email" }
+
+// Send hands the mail to the SMTP server. net/smtp takes no context, so ctx
+// is only checked before sending.
+func (e *Email) Send(ctx context.Context, m Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if e.username != "" {
+		host, _, err := net.SplitHostPort(e.addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", e.username, e.password, host)
+	}
+	msg := "From: " + e.from + "\r\n" +
+		"To: " + strings.Join(e.to, ", ") + "\r\n" +
+		"Subject: [trading-engine] " + m.Subject + "\r\n" +
+		"Date: " + m.Time.Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + strings.ReplaceAll(m.Text, "\n", "\r\n") + "\r\n"
+	return smtp.SendMail(e.addr, auth, e.from, e.to, []byte(msg))
+}
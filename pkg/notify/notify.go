@@ -0,0 +1,429 @@
+// Package notify sends operator alerts about fills, rejected orders, signals,
+// kill switch trips, exchange outages, shutdowns and daily PnL to Telegram, Slack, email or a
+// webhook.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/secrets"
+	"github.com/omept/trading-engine/pkg/store"
+)
+
+// Kind is what an alert is about, channels filter on it
+type Kind string
+
+const (
+	KindFill       Kind = "fill"            // an order filled, in part or in full
+	KindError      Kind = "error"           // an order was rejected
+	KindSignal     Kind = "signal"          // a signal-only strategy signaled
+	KindKillSwitch Kind = "kill_switch"     // the daily loss kill switch tripped
+	KindBreaker    Kind = "circuit_breaker" // order submission to an unreachable exchange paused or resumed
+	KindDailyPnL   Kind = "daily_pnl"       // PnL summary of the UTC day just closed
+	KindEngine     Kind = "engine"          // other engine notifications such as the shutdown report
+)
+
+var kinds = []Kind{KindFill, KindError, KindSignal, KindKillSwitch, KindBreaker, KindDailyPnL, KindEngine}
+
+// Message is one alert
+type Message struct {
+	Kind    Kind          `json:"kind"`
+	Subject string        `json:"subject"`
+	Text    string        `json:"text"`
+	Time    time.Time     `json:"time"`
+	Symbol  string        `json:"symbol,omitempty"`
+	Order   *engine.Order `json:"order,omitempty"`
+}
+
+// Channel delivers alerts to one destination
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, m Message) error
+}
+
+// EquitySource values the account for the daily PnL summary
+type EquitySource interface {
+	Equity(ctx context.Context) (store.EquityRecord, error)
+}
+
+// route is a channel with the alerts it wants
+type route struct {
+	ch      Channel
+	kinds   map[Kind]bool // all when empty
+	symbols map[string]bool
+}
+
+func (r route) wants(m Message) bool {
+	if len(r.kinds) > 0 && !r.kinds[m.Kind] {
+		return false
+	}
+	return m.Symbol == "" || len(r.symbols) == 0 || r.symbols[m.Symbol]
+}
+
+// dispatchQueue is how many alerts wait to be sent before new ones are
+// dropped
+const dispatchQueue = 256
+
+// Dispatcher turns engine events and notifications into alerts and sends
+// each to the channels whose filters let it through. It is an
+// engine.Notifier, so the kill switch and shutdown reports reach it too.
+// Alerts are sent one at a time from a queue, so a slow channel holds up
+// neither the event bus nor the engine.
+type Dispatcher struct {
+	mt      sync.Mutex
+	routes  []route
+	secrets secrets.Provider
+	timeout time.Duration
+	queue   chan dispatch
+}
+
+// dispatch is an alert waiting to be sent, or a flush waiting for the
+// alerts before it when done is set
+type dispatch struct {
+	m    Message
+	done chan struct{}
+}
+
+// NewDispatcher builds the channels of cfgs, reading the secrets they name
+// from sp
+func NewDispatcher(cfgs []ChannelConfig, sp secrets.Provider) (*Dispatcher, error) {
+	d := &Dispatcher{secrets: sp, timeout: 15 * time.Second, queue: make(chan dispatch, dispatchQueue)}
+	if err := d.SetChannels(cfgs); err != nil {
+		return nil, err
+	}
+	go d.run()
+	return d, nil
+}
+
+// SetChannels replaces every channel with the channels of cfgs, keeping the
+// current ones when any of cfgs is invalid or names a secret that cannot
+// be read
+func (d *Dispatcher) SetChannels(cfgs []ChannelConfig) error {
+	routes := make([]route, 0, len(cfgs))
+	for i, c := range cfgs {
+		c, err := c.resolve(context.Background(), d.secrets)
+		if err != nil {
+			return fmt.Errorf("notify channel %d: %w", i, err)
+		}
+		ch, err := c.Channel()
+		if err != nil {
+			return fmt.Errorf("notify channel %d: %w", i, err)
+		}
+		routes = append(routes, newRoute(ch, c.Events, c.Symbols))
+	}
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	d.routes = routes
+	return nil
+}
+
+// AddChannel sends the alerts of kinds about symbols to ch, empty filters let everything through
+func (d *Dispatcher) AddChannel(ch Channel, kinds []Kind, symbols []string) {
+	r := newRoute(ch, kinds, symbols)
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	d.routes = append(d.routes, r)
+}
+
+func newRoute(ch Channel, kinds []Kind, symbols []string) route {
+	r := route{ch: ch, kinds: map[Kind]bool{}, symbols: map[string]bool{}}
+	for _, k := range kinds {
+		r.kinds[k] = true
+	}
+	for _, s := range symbols {
+		r.symbols[strings.ToUpper(s)] = true
+	}
+	return r
+}
+
+// Empty reports whether no channel is configured
+func (d *Dispatcher) Empty() bool {
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	return len(d.routes) == 0
+}
+
+// wants reports whether any channel takes alerts of kind k
+func (d *Dispatcher) wants(k Kind) bool {
+	d.mt.Lock()
+	defer d.mt.Unlock()
+	for _, r := range d.routes {
+		if len(r.kinds) == 0 || r.kinds[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// Send queues m for every channel that wants it. m is dropped with a log
+// line when the queue is full.
+func (d *Dispatcher) Send(ctx context.Context, m Message) {
+	if m.Time.IsZero() {
+		m.Time = time.Now().UTC()
+	}
+	select {
+	case d.queue <- dispatch{m: m}:
+	default:
+		log.Printf("notify: queue full, dropped %q", m.Subject)
+	}
+}
+
+// Flush waits until the alerts queued so far are sent or ctx is done
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case d.queue <- dispatch{done: done}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run sends the queued alerts, each channel given the timeout of d
+func (d *Dispatcher) run() {
+	for q := range d.queue {
+		if q.done != nil {
+			close(q.done)
+			continue
+		}
+		d.deliver(q.m)
+	}
+}
+
+// deliver sends m to every channel that wants it, logging failures
+func (d *Dispatcher) deliver(m Message) {
+	d.mt.Lock()
+	routes := append([]route(nil), d.routes...)
+	d.mt.Unlock()
+	for _, r := range routes {
+		if !r.wants(m) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		if err := r.ch.Send(ctx, m); err != nil {
+			log.Printf("notify %s: %q failed: %v", r.ch.Name(), m.Subject, err)
+		}
+		cancel()
+	}
+}
+
+// Notify implements engine.Notifier
+func (d *Dispatcher) Notify(ctx context.Context, subject, message string) error {
+	kind := KindEngine
+	switch subject {
+	case engine.SubjectKillSwitch:
+		kind = KindKillSwitch
+	case engine.SubjectCircuitOpen, engine.SubjectCircuitClosed:
+		kind = KindBreaker
+	}
+	d.Send(ctx, Message{Kind: kind, Subject: subject, Text: message})
+	return nil
+}
+
+// Track alerts on fills, rejected orders and signals published on bus
+func (d *Dispatcher) Track(bus *engine.EventBus) {
+	bus.Subscribe(engine.EventOrderFilled, func(ev engine.Event) {
+		o := ev.Order
+		text := fmt.Sprintf("%s %s %s at %s", o.Side, o.Quantity, o.Symbol, o.FilledPrice)
+		if o.Fee.IsPositive() {
+			text += fmt.Sprintf(", fee %s", o.Fee)
+		}
+		if o.Strategy != "" {
+			text += " for " + o.Strategy
+		}
+		d.Send(context.Background(), Message{Kind: KindFill, Subject: "Order filled", Text: text, Time: ev.Time, Symbol: o.Symbol, Order: &o})
+	})
+	bus.Subscribe(engine.EventOrderUpdated, func(ev engine.Event) {
+		o := ev.Order
+		if o.Status != engine.OrderStatusRejected {
+			return
+		}
+		text := fmt.Sprintf("%s %s %s was rejected", o.Side, o.Quantity, o.Symbol)
+		if o.Strategy != "" {
+			text += ", submitted by " + o.Strategy
+		}
+		d.Send(context.Background(), Message{Kind: KindError, Subject: "Order rejected", Text: text, Time: ev.Time, Symbol: o.Symbol, Order: &o})
+	})
+	bus.Subscribe(engine.EventSignal, func(ev engine.Event) {
+		o := ev.Order
+		text := fmt.Sprintf("%s %s %s at %s from %s", o.Side, o.Quantity, o.Symbol, o.Price, o.Strategy)
+		d.Send(context.Background(), Message{Kind: KindSignal, Subject: "Signal", Text: text, Time: ev.Time, Symbol: o.Symbol, Order: &o})
+	})
+}
+
+// RunDailySummary sends the PnL of each UTC day just after midnight until
+// ctx is done, while a channel takes it. The first day is measured from
+// when it starts.
+func (d *Dispatcher) RunDailySummary(ctx context.Context, src EquitySource) {
+	open, err := src.Equity(ctx)
+	if err != nil {
+		log.Printf("notify: daily summary: %v", err)
+	}
+	for {
+		now := time.Now().UTC()
+		midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		t := time.NewTimer(midnight.Sub(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		closed, err := src.Equity(ctx)
+		if err != nil {
+			log.Printf("notify: daily summary: %v", err)
+			continue
+		}
+		if d.wants(KindDailyPnL) {
+			d.Send(ctx, dailySummary(midnight.Add(-24*time.Hour), open, closed))
+		}
+		open = closed
+	}
+}
+
+// dailySummary reports the change in equity of day between two equity samples
+func dailySummary(day time.Time, open, closed store.EquityRecord) Message {
+	text := fmt.Sprintf("equity %.2f USD", closed.Equity)
+	if open.Equity != 0 {
+		change := closed.Equity - open.Equity
+		text += fmt.Sprintf(", %+.2f USD (%+.2f%%) on the day", change, change/open.Equity*100)
+	}
+	text += fmt.Sprintf("\nrealized %.2f USD, unrealized %.2f USD, cash %.2f USD", closed.Realized, closed.Unrealized, closed.Cash)
+	return Message{Kind: KindDailyPnL, Subject: "Daily PnL " + day.Format("2006-01-02"), Text: text}
+}
+
+// postJSON sends v to url and fails on non 2xx responses
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// ChannelConfig is one alert destination in the config file. The URL, bot
+// token and password may each be named as a secret of the secrets provider
+// instead of written in the file, the secret wins when both are set.
+type ChannelConfig struct {
+	Type    string   `json:"type"`              // telegram | slack | email | webhook
+	Events  []Kind   `json:"events,omitempty"`  // fill | error | signal | kill_switch | circuit_breaker | daily_pnl | engine, all when empty
+	Symbols []string `json:"symbols,omitempty"` // symbols of fill, error and signal alerts, all when empty
+
+	URL       string `json:"url,omitempty"`        // slack incoming webhook or webhook endpoint
+	URLSecret string `json:"url_secret,omitempty"` // secret holding url
+
+	BotToken       string `json:"bot_token,omitempty"` // telegram
+	BotTokenSecret string `json:"bot_token_secret,omitempty"`
+	ChatID         string `json:"chat_id,omitempty"`
+
+	SMTPAddr       string   `json:"smtp_addr,omitempty"` // email, host:port
+	Username       string   `json:"username,omitempty"`
+	Password       string   `json:"password,omitempty"`
+	PasswordSecret string   `json:"password_secret,omitempty"`
+	From           string   `json:"from,omitempty"`
+	To             []string `json:"to,omitempty"`
+}
+
+// secretRefs pairs the settings of c that may come from the secrets
+// provider with the names of their secrets
+func (c *ChannelConfig) secretRefs() map[*string]string {
+	return map[*string]string{
+		&c.URL:      c.URLSecret,
+		&c.BotToken: c.BotTokenSecret,
+		&c.Password: c.PasswordSecret,
+	}
+}
+
+// resolve returns c with the secrets it names read from sp
+func (c ChannelConfig) resolve(ctx context.Context, sp secrets.Provider) (ChannelConfig, error) {
+	for field, name := range c.secretRefs() {
+		if name == "" {
+			continue
+		}
+		if sp == nil {
+			return c, fmt.Errorf("secret %s named without a secrets provider", name)
+		}
+		v, err := sp.Get(ctx, name)
+		if err != nil {
+			return c, fmt.Errorf("%s secrets: %w", sp.Name(), err)
+		}
+		*field = v
+	}
+	return c, nil
+}
+
+// Validate reports the first missing or unknown setting. Secrets named for
+// the secrets provider count as set, they are read when the channel is
+// built.
+func (c ChannelConfig) Validate() error {
+	for field, name := range c.secretRefs() {
+		if name != "" {
+			*field = name
+		}
+	}
+	_, err := c.Channel()
+	return err
+}
+
+// Channel builds the channel c describes
+func (c ChannelConfig) Channel() (Channel, error) {
+	for _, k := range c.Events {
+		if !slices.Contains(kinds, k) {
+			return nil, fmt.Errorf("unknown event %q, known: fill, error, signal, kill_switch, circuit_breaker, daily_pnl, engine", k)
+		}
+	}
+	switch c.Type {
+	case "telegram":
+		if c.BotToken == "" || c.ChatID == "" {
+			return nil, fmt.Errorf("telegram needs bot_token and chat_id")
+		}
+		return NewTelegram(c.BotToken, c.ChatID), nil
+	case "slack":
+		if c.URL == "" {
+			return nil, fmt.Errorf("slack needs the url of an incoming webhook")
+		}
+		return NewSlack(c.URL), nil
+	case "email":
+		if c.SMTPAddr == "" || c.From == "" || len(c.To) == 0 {
+			return nil, fmt.Errorf("email needs smtp_addr, from and to")
+		}
+		return NewEmail(c.SMTPAddr, c.Username, c.Password, c.From, c.To), nil
+	case "webhook":
+		if c.URL == "" {
+			return nil, fmt.Errorf("webhook needs a url")
+		}
+		return NewWebhook(c.URL), nil
+	default:
+		return nil, fmt.Errorf("type %q must be telegram, slack, email or webhook", c.Type)
+	}
+}
@@ -0,0 +1,236 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/shopspring/decimal"
+)
+
+// Headers of every event the sink posts
+const (
+	HeaderEventID   = "X-Event-Id"
+	HeaderTimestamp = "X-Event-Timestamp"
+	// HeaderSignature is "sha256=" and the hex HMAC-SHA256 of the timestamp,
+	// a dot and the body, keyed with the sink's secret
+	HeaderSignature = "X-Event-Signature"
+)
+
+// EventPayload is the JSON body posted for an order update or a trade
+type EventPayload struct {
+	ID    string      `json:"id"`   // unique per event, receivers can drop redeliveries by it
+	Type  string      `json:"type"` // order.updated | trade
+	Time  time.Time   `json:"time"`
+	Order EventOrder  `json:"order"`
+	Trade *EventTrade `json:"trade,omitempty"`
+}
+
+// EventOrder is the order an event is about
+type EventOrder struct {
+	ID            string             `json:"id"`
+	ClientOrderID string             `json:"client_order_id,omitempty"`
+	Strategy      string             `json:"strategy"`
+	Symbol        string             `json:"symbol"`
+	Side          engine.Side        `json:"side"`
+	Type          engine.OrderType   `json:"type"`
+	Price         decimal.Decimal    `json:"price"`
+	Quantity      decimal.Decimal    `json:"quantity"`
+	FilledQty     decimal.Decimal    `json:"filled_qty"`
+	FilledPrice   decimal.Decimal    `json:"filled_price"` // average over the whole order
+	Status        engine.OrderStatus `json:"status"`
+}
+
+// EventTrade is one execution of an order
+type EventTrade struct {
+	Symbol   string          `json:"symbol"`
+	Side     engine.Side     `json:"side"`
+	Quantity decimal.Decimal `json:"quantity"`
+	Price    decimal.Decimal `json:"price"`
+	Fee      decimal.Decimal `json:"fee"`
+}
+
+// sinkQueue is how many events wait to be posted before new ones are
+// dropped
+const sinkQueue = 1024
+
+// EventSink posts every order update and trade to a URL, signed with a
+// shared secret so the receiver can tell the engine sent it. Failed
+// deliveries are retried with exponential backoff, then dropped with a log
+// line. Events are posted one at a time in publish order from a queue, so
+// a slow receiver does not hold up the event bus.
+type EventSink struct {
+	url         string
+	secret      []byte
+	maxAttempts int
+	backoff     time.Duration
+	client      *http.Client
+	queue       chan sinkItem
+}
+
+// sinkItem is an event waiting to be posted, or a flush waiting for the
+// events before it when done is set
+type sinkItem struct {
+	p    EventPayload
+	done chan struct{}
+}
+
+// NewEventSink posts to url, trying each event up to maxAttempts times and
+// waiting backoff before the first retry, twice as long before each next one
+func NewEventSink(url, secret string, maxAttempts int, backoff time.Duration) *EventSink {
+	s := &EventSink{
+		url:         url,
+		secret:      []byte(secret),
+		maxAttempts: max(maxAttempts, 1),
+		backoff:     backoff,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan sinkItem, sinkQueue),
+	}
+	go s.run()
+	return s
+}
+
+// Track posts the order and trade events published on bus
+func (s *EventSink) Track(bus *engine.EventBus) {
+	bus.Subscribe(engine.EventOrderUpdated, func(ev engine.Event) {
+		s.enqueue(newEventPayload("order.updated", ev))
+	})
+	bus.Subscribe(engine.EventOrderFilled, func(ev engine.Event) {
+		p := newEventPayload("trade", ev)
+		o := ev.Order
+		p.Trade = &EventTrade{Symbol: o.Symbol, Side: o.Side, Quantity: o.Quantity, Price: o.FilledPrice, Fee: o.Fee}
+		s.enqueue(p)
+	})
+}
+
+// enqueue queues p, dropping it with a log line when the queue is full
+func (s *EventSink) enqueue(p EventPayload) {
+	select {
+	case s.queue <- sinkItem{p: p}:
+	default:
+		log.Printf("event webhook: queue full, dropped %s %s of order %s", p.Type, p.ID, p.Order.ID)
+	}
+}
+
+// Flush waits until the events queued so far are posted or dropped, or
+// ctx is done
+func (s *EventSink) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case s.queue <- sinkItem{done: done}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run posts the queued events in order
+func (s *EventSink) run() {
+	for it := range s.queue {
+		if it.done != nil {
+			close(it.done)
+			continue
+		}
+		s.deliver(context.Background(), it.p)
+	}
+}
+
+func newEventPayload(typ string, ev engine.Event) EventPayload {
+	o := ev.Order
+	return EventPayload{
+		ID:   newEventID(),
+		Type: typ,
+		Time: ev.Time.UTC(),
+		Order: EventOrder{
+			ID: o.ID, ClientOrderID: o.ClientOrderID, Strategy: o.Strategy, Symbol: o.Symbol, Side: o.Side, Type: o.Type,
+			Price: o.Price, Quantity: o.Quantity, FilledQty: o.FilledQty, FilledPrice: o.FilledPrice, Status: o.Status,
+		},
+	}
+}
+
+func newEventID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "evt_" + hex.EncodeToString(b)
+}
+
+// deliver posts p until it is accepted, the attempts run out or ctx is done
+func (s *EventSink) deliver(ctx context.Context, p EventPayload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("event webhook: encode %s %s: %v", p.Type, p.ID, err)
+		return
+	}
+	wait := s.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, p.ID, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= s.maxAttempts {
+			log.Printf("event webhook: dropped %s %s of order %s after %d attempts: %v", p.Type, p.ID, p.Order.ID, attempt, err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("event webhook: dropped %s %s of order %s: %v", p.Type, p.ID, p.Order.ID, ctx.Err())
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// post sends one signed attempt and reports whether a failure is worth
+// retrying, 4xx answers other than 408 and 429 are not
+func (s *EventSink) post(ctx context.Context, id string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, id)
+	req.Header.Set(HeaderTimestamp, ts)
+	if len(s.secret) > 0 {
+		req.Header.Set(HeaderSignature, "sha256="+Sign(s.secret, ts, body))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		code := resp.StatusCode
+		retry = code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return false, nil
+}
+
+// Sign is the hex HMAC-SHA256 receivers compare HeaderSignature against
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,131 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSSecretsManagerProvider reads fields of a JSON secret from AWS Secrets Manager.
+// Requests are signed with SigV4 using static credentials.
+type AWSSecretsManagerProvider struct {
+	region       string
+	secretID     string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	endpoint     string
+	client       *http.Client
+}
+
+func NewAWSSecretsManagerProvider(region, secretID, accessKey, secretKey, sessionToken string) *AWSSecretsManagerProvider {
+	return &AWSSecretsManagerProvider{
+		region:       region,
+		secretID:     secretID,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: sessionToken,
+		endpoint:     fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region),
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (a *AWSSecretsManagerProvider) Name() string { return "aws-secrets-manager" }
+
+func (a *AWSSecretsManagerProvider) Get(ctx context.Context, name string) (string, error) {
+	payload, _ := json.Marshal(map[string]string{"SecretId": a.secretID})
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", a.endpoint+"/", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.sign(req, payload, time.Now().UTC())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("aws secrets manager error: %s", string(body))
+	}
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", err
+	}
+
+	fields := map[string]string{}
+	if err := json.Unmarshal([]byte(out.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %w", a.secretID, err)
+	}
+	val, ok := fields[name]
+	if !ok || val == "" {
+		return "", fmt.Errorf("secret %s not found in %s", name, a.secretID)
+	}
+	return val, nil
+}
+
+// sign adds SigV4 headers for the secretsmanager service
+func (a *AWSSecretsManagerProvider) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.sessionToken)
+	}
+
+	var names []string
+	for k := range req.Header {
+		names = append(names, strings.ToLower(k))
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, n := range names {
+		canonHeaders.WriteString(n + ":" + strings.TrimSpace(req.Header.Get(n)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(payload)
+	canonical := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		canonHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + a.region + "/secretsmanager/aws4_request"
+	canonHash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+a.secretKey), date)
+	key = hmacSHA256(key, a.region)
+	key = hmacSHA256(key, "secretsmanager")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
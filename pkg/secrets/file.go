@@ -0,0 +1,96 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EncryptedFileProvider reads secrets from a JSON object encrypted with AES-256-GCM.
+// The file holds base64(nonce || ciphertext). It is re-read on every Get so an
+// updated file is picked up on the next refresh.
+type EncryptedFileProvider struct {
+	path string
+	key  []byte
+}
+
+// NewEncryptedFileProvider takes the file path and a base64 encoded 32 byte key
+func NewEncryptedFileProvider(path, keyB64 string) (*EncryptedFileProvider, error) {
+	key, err := base64.StdEncoding.DecodeString(keyB64)
+	if err != nil {
+		return nil, fmt.Errorf("secrets file key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, errors.New("secrets file key must be 32 bytes")
+	}
+	return &EncryptedFileProvider{path: path, key: key}, nil
+}
+
+func (f *EncryptedFileProvider) Name() string { return "encrypted-file" }
+
+func (f *EncryptedFileProvider) Get(ctx context.Context, name string) (string, error) {
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+	plain, err := Decrypt(f.key, strings.TrimSpace(string(raw)))
+	if err != nil {
+		return "", err
+	}
+
+	fields := map[string]string{}
+	if err := json.Unmarshal(plain, &fields); err != nil {
+		return "", fmt.Errorf("secrets file %s: %w", f.path, err)
+	}
+	val, ok := fields[name]
+	if !ok || val == "" {
+		return "", fmt.Errorf("secret %s not found in %s", name, f.path)
+	}
+	return val, nil
+}
+
+// Encrypt seals plain with key and returns the base64 file contents
+func Encrypt(key, plain []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens base64 contents produced by Encrypt
+func Decrypt(key []byte, contents string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(contents)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("secrets file too short")
+	}
+	nonce, ct := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ct, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Provider resolves a named secret (e.g. BINANCE_API_KEY) to its value
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+	Name() string
+}
+
+// EnvProvider reads secrets from environment variables. It is the default.
+type EnvProvider struct{}
+
+func (EnvProvider) Name() string { return "env" }
+
+func (EnvProvider) Get(ctx context.Context, name string) (string, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return "", fmt.Errorf("secret %s not set", name)
+	}
+	return v, nil
+}
+
+// Credentials is an API key/secret pair that can be swapped while adapters use it
+type Credentials struct {
+	mt     sync.RWMutex
+	key    string
+	secret string
+}
+
+func NewCredentials(key, secret string) *Credentials {
+	return &Credentials{key: key, secret: secret}
+}
+
+func (c *Credentials) Get() (key, secret string) {
+	c.mt.RLock()
+	defer c.mt.RUnlock()
+	return c.key, c.secret
+}
+
+func (c *Credentials) Set(key, secret string) {
+	c.mt.Lock()
+	defer c.mt.Unlock()
+	c.key, c.secret = key, secret
+}
+
+// LoadCredentials fetches the key/secret pair once
+func LoadCredentials(ctx context.Context, p Provider, keyName, secretName string) (*Credentials, error) {
+	key, secret, err := fetchPair(ctx, p, keyName, secretName)
+	if err != nil {
+		return nil, err
+	}
+	return NewCredentials(key, secret), nil
+}
+
+// WatchCredentials loads the pair and re-reads it from p every interval until ctx is done,
+// so keys rotated in the secret store are picked up without a restart.
+func WatchCredentials(ctx context.Context, p Provider, keyName, secretName string, every time.Duration) (*Credentials, error) {
+	creds, err := LoadCredentials(ctx, p, keyName, secretName)
+	if err != nil {
+		return nil, err
+	}
+	if every <= 0 {
+		return creds, nil
+	}
+
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			key, secret, err := fetchPair(ctx, p, keyName, secretName)
+			if err != nil {
+				log.Printf("secrets: refresh %s from %s failed: %v", keyName, p.Name(), err)
+				continue
+			}
+			if oldKey, oldSecret := creds.Get(); oldKey != key || oldSecret != secret {
+				creds.Set(key, secret)
+				log.Printf("secrets: %s rotated from %s", keyName, p.Name())
+			}
+		}
+	}()
+
+	return creds, nil
+}
+
+func fetchPair(ctx context.Context, p Provider, keyName, secretName string) (string, string, error) {
+	key, err := p.Get(ctx, keyName)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := p.Get(ctx, secretName)
+	if err != nil {
+		return "", "", err
+	}
+	return key, secret, nil
+}
@@ -0,0 +1,67 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultProvider reads fields of a single KV v2 secret from HashiCorp Vault
+type VaultProvider struct {
+	addr   string
+	token  string
+	mount  string
+	path   string
+	client *http.Client
+}
+
+func NewVaultProvider(addr, token, mount, path string) *VaultProvider {
+	if mount == "" {
+		mount = "secret"
+	}
+	return &VaultProvider{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		mount:  strings.Trim(mount, "/"),
+		path:   strings.Trim(path, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (v *VaultProvider) Name() string { return "vault" }
+
+func (v *VaultProvider) Get(ctx context.Context, name string) (string, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", v.addr, v.mount, v.path)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("vault error: %s", string(body))
+	}
+
+	var out struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", err
+	}
+
+	val, ok := out.Data.Data[name]
+	if !ok || val == "" {
+		return "", fmt.Errorf("secret %s not found in vault %s/%s", name, v.mount, v.path)
+	}
+	return val, nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+)
+
+// pendingCandle is a candle waiting to be written
+type pendingCandle struct {
+	id, symbol, time               string
+	interval                       int64
+	open, high, low, close, volume float64
+	run                            string
+}
+
+// candleBatcher writes candles behind the callers that save them, many per
+// transaction, so candle feeds do not wait on a disk sync per candle. A batch
+// is written once it holds size candles or every interval, whichever comes
+// first, and on close.
+type candleBatcher struct {
+	db    *sql.DB
+	size  int
+	every time.Duration
+
+	mt      sync.Mutex
+	pending []pendingCandle
+	writeMt sync.Mutex // one batch written at a time
+
+	kick chan struct{}
+	quit chan struct{}
+	done chan struct{}
+}
+
+func newCandleBatcher(db *sql.DB, size int, every time.Duration) *candleBatcher {
+	b := &candleBatcher{
+		db:    db,
+		size:  size,
+		every: every,
+		kick:  make(chan struct{}, 1),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add queues c, waking the writer when a batch is full
+func (b *candleBatcher) add(c pendingCandle) {
+	b.mt.Lock()
+	b.pending = append(b.pending, c)
+	full := len(b.pending) >= b.size
+	b.mt.Unlock()
+	if full {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *candleBatcher) run() {
+	defer close(b.done)
+	t := time.NewTicker(b.every)
+	defer t.Stop()
+	for {
+		select {
+		case <-b.quit:
+			b.flush()
+			return
+		case <-t.C:
+		case <-b.kick:
+		}
+		b.flush()
+	}
+}
+
+// flush writes every queued candle. A batch that fails is logged and
+// dropped, like a candle whose synchronous write fails.
+func (b *candleBatcher) flush() {
+	b.writeMt.Lock()
+	defer b.writeMt.Unlock()
+
+	b.mt.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.mt.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	if err := b.write(batch); err != nil {
+		log.Printf("sqlite: dropped %d candles: %v", len(batch), err)
+	}
+}
+
+func (b *candleBatcher) write(batch []pendingCandle) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO candles(id,symbol,interval_sec,time,open,high,low,close,volume,run_id) VALUES(?,?,?,?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, c := range batch {
+		if _, err := stmt.Exec(c.id, c.symbol, c.interval, c.time, c.open, c.high, c.low, c.close, c.volume, c.run); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// close writes what is queued and stops the writer
+func (b *candleBatcher) close() {
+	close(b.quit)
+	<-b.done
+}
@@ -0,0 +1,203 @@
+package store
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles holds the schema of each dialect as numbered steps,
+// migrations/<dialect>/<version>_<name>.up.sql and the .down.sql undoing
+// it. Versions start at 1 and have no gaps. Add new steps, never edit
+// applied ones.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrator is implemented by stores with versioned schema migrations
+type Migrator interface {
+	// SchemaVersion is the last migration applied, 0 for an empty database
+	SchemaVersion() (int, error)
+	// MigrateTo applies or reverts migrations until version is the last
+	// one applied, a negative version means the latest
+	MigrateTo(version int) error
+}
+
+// loadMigrations reads the migrations of dialect, ordered by version
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		base, dirn, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (dirn != "up" && dirn != "down") {
+			return nil, fmt.Errorf("migration %s: want <version>_<name>.up.sql or .down.sql", name)
+		}
+		num, label, _ := strings.Cut(base, "_")
+		v, err := strconv.Atoi(num)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("migration %s: bad version %q", name, num)
+		}
+		body, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[v]
+		if m == nil {
+			m = &Migration{Version: v, Name: label}
+			byVersion[v] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", v, m.Name, label)
+		}
+		if dirn == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("%s migrations: version %d missing", dialect, i+1)
+		}
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("%s migration %d_%s: needs both an up and a down file", dialect, m.Version, m.Name)
+		}
+	}
+	return out, nil
+}
+
+// migrator applies the migrations of one dialect in a transaction and
+// records them in schema_migrations
+type migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	bind       string                 // placeholder of the version parameter
+	lock       func(tx *sql.Tx) error // serializes instances migrating together, may be nil
+}
+
+func newMigrator(db *sql.DB, dialect, bind string, lock func(tx *sql.Tx) error) (*migrator, error) {
+	ms, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, migrations: ms, bind: bind, lock: lock}, nil
+}
+
+// latest is the version of the newest migration
+func (m *migrator) latest() int {
+	return len(m.migrations)
+}
+
+// execQuerier is a *sql.DB or a *sql.Tx
+type execQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// ensureTable creates schema_migrations when the database has none yet
+func (m *migrator) ensureTable(q execQuerier) error {
+	_, err := q.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	return err
+}
+
+// version is the last migration applied
+func (m *migrator) version(q execQuerier) (int, error) {
+	var v int
+	err := q.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v)
+	return v, err
+}
+
+// to moves the schema to version, the latest when negative
+func (m *migrator) to(version int) error {
+	if version < 0 {
+		version = m.latest()
+	}
+	if version > m.latest() {
+		return fmt.Errorf("no migration %d, the latest is %d", version, m.latest())
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if m.lock != nil {
+		if err := m.lock(tx); err != nil {
+			return err
+		}
+	}
+	if err := m.ensureTable(tx); err != nil {
+		return err
+	}
+	current, err := m.version(tx)
+	if err != nil {
+		return err
+	}
+	if current > m.latest() {
+		return fmt.Errorf("schema is at version %d, newer than the %d this build knows", current, m.latest())
+	}
+	for v := current + 1; v <= version; v++ {
+		mg := m.migrations[v-1]
+		if _, err := tx.Exec(mg.Up); err != nil {
+			return fmt.Errorf("migration %d_%s: %w", v, mg.Name, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations(version) VALUES(`+m.bind+`)`, v); err != nil {
+			return err
+		}
+	}
+	for v := current; v > version; v-- {
+		mg := m.migrations[v-1]
+		if _, err := tx.Exec(mg.Down); err != nil {
+			return fmt.Errorf("revert migration %d_%s: %w", v, mg.Name, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM schema_migrations WHERE version=`+m.bind, v); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// baseline records versions up to version as applied without running
+// them, for databases whose schema was built before they were tracked
+func (m *migrator) baseline(version int) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := m.ensureTable(tx); err != nil {
+		return err
+	}
+	for v := 1; v <= version; v++ {
+		if _, err := tx.Exec(`INSERT INTO schema_migrations(version) VALUES(`+m.bind+`)`, v); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
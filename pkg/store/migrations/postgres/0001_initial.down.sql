@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS session_events;
+DROP TABLE IF EXISTS snapshots;
+DROP TABLE IF EXISTS backtests;
+DROP TABLE IF EXISTS candles;
+DROP TABLE IF EXISTS runs;
+DROP TABLE IF EXISTS trades;
+DROP TABLE IF EXISTS orders;
@@ -0,0 +1,83 @@
+CREATE TABLE IF NOT EXISTS orders (
+	id TEXT PRIMARY KEY,
+	symbol TEXT,
+	side TEXT,
+	type TEXT,
+	price DOUBLE PRECISION,
+	quantity DOUBLE PRECISION,
+	filled BOOLEAN,
+	filled_price DOUBLE PRECISION,
+	created_at TIMESTAMPTZ,
+	trace_id TEXT,
+	status TEXT
+);
+
+CREATE TABLE IF NOT EXISTS trades (
+	id TEXT PRIMARY KEY,
+	order_id TEXT,
+	symbol TEXT,
+	side TEXT,
+	price DOUBLE PRECISION,
+	quantity DOUBLE PRECISION,
+	created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS runs (
+	id TEXT PRIMARY KEY,
+	strategy TEXT,
+	started_at TIMESTAMPTZ,
+	stopped_at TIMESTAMPTZ,
+	final_pnl DOUBLE PRECISION
+);
+
+CREATE TABLE IF NOT EXISTS candles (
+	id TEXT PRIMARY KEY,
+	symbol TEXT,
+	time TIMESTAMPTZ,
+	open DOUBLE PRECISION,
+	high DOUBLE PRECISION,
+	low DOUBLE PRECISION,
+	close DOUBLE PRECISION,
+	volume DOUBLE PRECISION
+);
+
+CREATE INDEX IF NOT EXISTS idx_candles_symbol_time ON candles(symbol, time);
+CREATE INDEX IF NOT EXISTS idx_trades_symbol_time ON trades(symbol, created_at);
+CREATE INDEX IF NOT EXISTS idx_orders_symbol_open ON orders(symbol, created_at) WHERE NOT filled;
+
+CREATE TABLE IF NOT EXISTS backtests (
+	id TEXT PRIMARY KEY,
+	strategy TEXT,
+	symbol TEXT,
+	started_at TIMESTAMPTZ,
+	finished_at TIMESTAMPTZ,
+	final_equity DOUBLE PRECISION,
+	stats TEXT,
+	created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS snapshots (
+	id TEXT PRIMARY KEY,
+	data TEXT,
+	created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS session_events (
+	id BIGSERIAL PRIMARY KEY,
+	session_id TEXT,
+	kind TEXT,
+	source TEXT,
+	symbol TEXT,
+	recorded_at TIMESTAMPTZ,
+	payload TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_events_session ON session_events(session_id, id);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	actor TEXT,
+	action TEXT,
+	payload TEXT,
+	created_at TIMESTAMPTZ
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS trade_results (
+	id BIGSERIAL PRIMARY KEY,
+	strategy TEXT,
+	symbol TEXT,
+	pnl DOUBLE PRECISION,
+	closed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_trade_results_strategy ON trade_results(strategy, id);
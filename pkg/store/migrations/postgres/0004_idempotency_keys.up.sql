@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	client_order_id TEXT PRIMARY KEY,
+	order_id TEXT,
+	expires_at TIMESTAMPTZ
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS equity (
+	id BIGSERIAL PRIMARY KEY,
+	recorded_at TIMESTAMPTZ,
+	equity DOUBLE PRECISION,
+	cash DOUBLE PRECISION,
+	realized DOUBLE PRECISION,
+	unrealized DOUBLE PRECISION
+);
+
+CREATE INDEX IF NOT EXISTS idx_equity_recorded_at ON equity(recorded_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_candles_symbol_interval_time;
+ALTER TABLE candles DROP COLUMN IF EXISTS interval_sec;
+ALTER TABLE orders DROP COLUMN IF EXISTS strategy;
@@ -0,0 +1,3 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS strategy TEXT;
+ALTER TABLE candles ADD COLUMN IF NOT EXISTS interval_sec BIGINT;
+CREATE INDEX IF NOT EXISTS idx_candles_symbol_interval_time ON candles(symbol, interval_sec, time);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_trades_run;
+DROP INDEX IF EXISTS idx_orders_run;
+ALTER TABLE candles DROP COLUMN IF EXISTS run_id;
+ALTER TABLE trades DROP COLUMN IF EXISTS run_id;
+ALTER TABLE orders DROP COLUMN IF EXISTS run_id;
@@ -0,0 +1,5 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS run_id TEXT;
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS run_id TEXT;
+ALTER TABLE candles ADD COLUMN IF NOT EXISTS run_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_orders_run ON orders(run_id);
+CREATE INDEX IF NOT EXISTS idx_trades_run ON trades(run_id);
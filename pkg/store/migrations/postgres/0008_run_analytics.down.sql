@@ -0,0 +1,5 @@
+ALTER TABLE runs DROP COLUMN IF EXISTS trade_count;
+ALTER TABLE runs DROP COLUMN IF EXISTS max_drawdown;
+ALTER TABLE runs DROP COLUMN IF EXISTS final_equity;
+ALTER TABLE runs DROP COLUMN IF EXISTS start_equity;
+ALTER TABLE runs DROP COLUMN IF EXISTS symbols;
@@ -0,0 +1,5 @@
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS symbols TEXT;
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS start_equity DOUBLE PRECISION;
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS final_equity DOUBLE PRECISION;
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS max_drawdown DOUBLE PRECISION;
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS trade_count BIGINT;
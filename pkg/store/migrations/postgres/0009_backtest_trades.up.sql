@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS backtest_trades (
+	backtest_id TEXT NOT NULL,
+	seq INTEGER NOT NULL,
+	strategy TEXT,
+	side TEXT,
+	entry_time TIMESTAMPTZ,
+	exit_time TIMESTAMPTZ,
+	entry_price DOUBLE PRECISION,
+	exit_price DOUBLE PRECISION,
+	quantity DOUBLE PRECISION,
+	pnl DOUBLE PRECISION,
+	holding_sec DOUBLE PRECISION,
+	PRIMARY KEY (backtest_id, seq)
+);
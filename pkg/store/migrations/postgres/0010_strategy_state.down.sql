@@ -0,0 +1 @@
+DROP TABLE IF EXISTS strategy_state;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS signals (
+	id TEXT PRIMARY KEY,
+	strategy TEXT,
+	symbol TEXT,
+	side TEXT,
+	price DOUBLE PRECISION,
+	quantity DOUBLE PRECISION,
+	created_at TIMESTAMPTZ,
+	run_id TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_signals_created ON signals(created_at);
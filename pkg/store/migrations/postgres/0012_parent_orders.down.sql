@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS parent_orders;
+DROP INDEX IF EXISTS idx_orders_parent;
+ALTER TABLE orders DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,21 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS parent_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_orders_parent ON orders(parent_id);
+CREATE TABLE IF NOT EXISTS parent_orders (
+	id TEXT PRIMARY KEY,
+	client_order_id TEXT,
+	strategy TEXT,
+	symbol TEXT,
+	side TEXT,
+	type TEXT,
+	method TEXT,
+	price DOUBLE PRECISION,
+	quantity DOUBLE PRECISION,
+	filled_qty DOUBLE PRECISION,
+	filled_price DOUBLE PRECISION,
+	fee DOUBLE PRECISION,
+	status TEXT,
+	created_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ,
+	run_id TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_parent_orders_created ON parent_orders(created_at);
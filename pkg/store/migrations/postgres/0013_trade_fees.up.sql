@@ -0,0 +1 @@
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS fee DOUBLE PRECISION NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS expire_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS time_in_force;
@@ -0,0 +1,2 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS time_in_force TEXT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS expire_at TIMESTAMPTZ;
@@ -0,0 +1 @@
+ALTER TABLE candles ADD COLUMN IF NOT EXISTS rolled_up BOOLEAN NOT NULL DEFAULT FALSE;
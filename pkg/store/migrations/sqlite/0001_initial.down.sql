@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS equity;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS session_events;
+DROP TABLE IF EXISTS snapshots;
+DROP TABLE IF EXISTS backtests;
+DROP TABLE IF EXISTS candles;
+DROP TABLE IF EXISTS runs;
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS trade_results;
+DROP TABLE IF EXISTS trades;
+DROP TABLE IF EXISTS orders;
@@ -0,0 +1,117 @@
+CREATE TABLE IF NOT EXISTS orders (
+	id TEXT PRIMARY KEY,
+	symbol TEXT,
+	side TEXT,
+	type TEXT,
+	price REAL,
+	quantity REAL,
+	filled INTEGER,
+	filled_price REAL,
+	created_at DATETIME,
+	trace_id TEXT,
+	status TEXT,
+	filled_qty REAL,
+	strategy TEXT,
+	run_id TEXT
+);
+
+CREATE TABLE IF NOT EXISTS trades (
+	id TEXT PRIMARY KEY,
+	order_id TEXT,
+	symbol TEXT,
+	side TEXT,
+	price REAL,
+	quantity REAL,
+	created_at DATETIME,
+	run_id TEXT
+);
+
+CREATE TABLE IF NOT EXISTS trade_results (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	strategy TEXT,
+	symbol TEXT,
+	pnl REAL,
+	closed_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_trade_results_strategy ON trade_results(strategy, id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	client_order_id TEXT PRIMARY KEY,
+	order_id TEXT,
+	expires_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS runs (
+	id TEXT PRIMARY KEY,
+	strategy TEXT,
+	started_at DATETIME,
+	stopped_at DATETIME,
+	final_pnl REAL,
+	symbols TEXT,
+	start_equity REAL,
+	final_equity REAL,
+	max_drawdown REAL,
+	trade_count INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS candles (
+	id TEXT PRIMARY KEY,
+	symbol TEXT,
+	time DATETIME,
+	open REAL,
+	high REAL,
+	low REAL,
+	close REAL,
+	volume REAL,
+	interval_sec INTEGER,
+	run_id TEXT
+);
+
+CREATE TABLE IF NOT EXISTS backtests (
+	id TEXT PRIMARY KEY,
+	strategy TEXT,
+	symbol TEXT,
+	started_at DATETIME,
+	finished_at DATETIME,
+	final_equity REAL,
+	stats TEXT,
+	created_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS snapshots (
+	id TEXT PRIMARY KEY,
+	data TEXT,
+	created_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS session_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id TEXT,
+	kind TEXT,
+	source TEXT,
+	symbol TEXT,
+	recorded_at DATETIME,
+	payload TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_events_session ON session_events(session_id, id);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	actor TEXT,
+	action TEXT,
+	payload TEXT,
+	created_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS equity (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	recorded_at DATETIME,
+	equity REAL,
+	cash REAL,
+	realized REAL,
+	unrealized REAL
+);
+
+CREATE INDEX IF NOT EXISTS idx_equity_recorded_at ON equity(recorded_at);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS backtest_trades (
+	backtest_id TEXT NOT NULL,
+	seq INTEGER NOT NULL,
+	strategy TEXT,
+	side TEXT,
+	entry_time DATETIME,
+	exit_time DATETIME,
+	entry_price REAL,
+	exit_price REAL,
+	quantity REAL,
+	pnl REAL,
+	holding_sec REAL,
+	PRIMARY KEY (backtest_id, seq)
+);
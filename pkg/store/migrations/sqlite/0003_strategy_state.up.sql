@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS strategy_state (
+	name TEXT PRIMARY KEY,
+	state TEXT,
+	saved_at DATETIME
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS signals (
+	id TEXT PRIMARY KEY,
+	strategy TEXT,
+	symbol TEXT,
+	side TEXT,
+	price REAL,
+	quantity REAL,
+	created_at DATETIME,
+	run_id TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_signals_created ON signals(created_at);
@@ -0,0 +1,21 @@
+ALTER TABLE orders ADD COLUMN parent_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_orders_parent ON orders(parent_id);
+CREATE TABLE IF NOT EXISTS parent_orders (
+	id TEXT PRIMARY KEY,
+	client_order_id TEXT,
+	strategy TEXT,
+	symbol TEXT,
+	side TEXT,
+	type TEXT,
+	method TEXT,
+	price REAL,
+	quantity REAL,
+	filled_qty REAL,
+	filled_price REAL,
+	fee REAL,
+	status TEXT,
+	created_at DATETIME,
+	updated_at DATETIME,
+	run_id TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_parent_orders_created ON parent_orders(created_at);
@@ -0,0 +1 @@
+ALTER TABLE trades ADD COLUMN fee REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS held_orders (
+	kind TEXT NOT NULL,
+	id TEXT NOT NULL,
+	payload TEXT,
+	saved_at DATETIME,
+	PRIMARY KEY (kind, id)
+);
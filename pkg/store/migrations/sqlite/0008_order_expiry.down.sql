@@ -0,0 +1,2 @@
+ALTER TABLE orders DROP COLUMN expire_at;
+ALTER TABLE orders DROP COLUMN time_in_force;
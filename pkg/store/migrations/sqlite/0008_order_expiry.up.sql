@@ -0,0 +1,2 @@
+ALTER TABLE orders ADD COLUMN time_in_force TEXT;
+ALTER TABLE orders ADD COLUMN expire_at DATETIME;
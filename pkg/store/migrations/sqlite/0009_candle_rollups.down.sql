@@ -0,0 +1 @@
+ALTER TABLE candles DROP COLUMN rolled_up;
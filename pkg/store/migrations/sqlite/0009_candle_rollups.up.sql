@@ -0,0 +1 @@
+ALTER TABLE candles ADD COLUMN rolled_up BOOLEAN NOT NULL DEFAULT 0;
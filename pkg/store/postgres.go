@@ -0,0 +1,1158 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// PostgresStore keeps the same data as SQLiteStore in PostgreSQL so several
+// engine instances can share one database
+type PostgresStore struct {
+	runTag
+	db         *sql.DB
+	migrations *migrator
+}
+
+// PoolConfig sizes the connection pool, zero values keep the defaults
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+func NewPostgresStore(dsn string, pool PoolConfig) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if pool.MaxOpenConns <= 0 {
+		pool.MaxOpenConns = 10
+	}
+	if pool.MaxIdleConns <= 0 {
+		pool.MaxIdleConns = pool.MaxOpenConns / 2
+	}
+	if pool.ConnMaxLifetime <= 0 {
+		pool.ConnMaxLifetime = 30 * time.Minute
+	}
+	if pool.ConnMaxIdleTime <= 0 {
+		pool.ConnMaxIdleTime = 5 * time.Minute
+	}
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+	store := &PostgresStore{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("postgres: migrate: %w", err)
+	}
+	return store, nil
+}
+
+func (s *PostgresStore) Close() error {
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
+
+// postgresMigrationLock serializes migrations of instances starting together
+const postgresMigrationLock = 7201330
+
+// migrate applies the migrations this database has not seen yet
+func (s *PostgresStore) migrate() error {
+	m, err := newMigrator(s.db, "postgres", "$1", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, postgresMigrationLock)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.migrations = m
+	return m.to(-1)
+}
+
+// SchemaVersion is the last migration applied
+func (s *PostgresStore) SchemaVersion() (int, error) {
+	return s.migrations.version(s.db)
+}
+
+// MigrateTo applies or reverts migrations until version is the last one
+// applied, a negative version means the latest
+func (s *PostgresStore) MigrateTo(version int) error {
+	return s.migrations.to(version)
+}
+
+// CountOrders returns total orders
+func (s *PostgresStore) CountOrders() (int64, error) {
+	var count int64
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM orders`).Scan(&count)
+	return count, err
+}
+
+// CountTrades returns total trades
+func (s *PostgresStore) CountTrades() (int64, error) {
+	var count int64
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM trades`).Scan(&count)
+	return count, err
+}
+
+// CountRuns returns total runs
+func (s *PostgresStore) CountRuns() (int64, error) {
+	var count int64
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM runs`).Scan(&count)
+	return count, err
+}
+
+// SaveCandle persists a candle of interval seconds, keeping the first one stored for a time
+func (s *PostgresStore) SaveCandle(symbol string, interval int64, cTime string, open, high, low, close, volume float64) error {
+	id := fmt.Sprintf("%s_%d_%s", symbol, interval, cTime)
+	_, err := s.db.Exec(`
+        INSERT INTO candles(id,symbol,interval_sec,time,open,high,low,close,volume,run_id)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+        ON CONFLICT (id) DO NOTHING
+    `, id, symbol, interval, cTime, open, high, low, close, volume, s.run())
+	return err
+}
+
+// LoadCandles returns the oldest limit candles of interval seconds for symbol
+func (s *PostgresStore) LoadCandles(symbol string, interval int64, limit int) ([]map[string]interface{}, error) {
+	rows, err := s.db.Query(`SELECT time,open,high,low,close,volume FROM candles WHERE symbol=$1 AND interval_sec=$2 AND NOT rolled_up ORDER BY time ASC LIMIT $3`, symbol, interval, limit)
+	if err != nil {
+		return []map[string]interface{}{}, err
+	}
+	return scanCandleRows(rows)
+}
+
+// LoadCandlesBetween returns the candles of interval seconds for symbol with
+// from <= time <= to, oldest first, leaving out candles rolled up by
+// retention
+func (s *PostgresStore) LoadCandlesBetween(symbol string, interval int64, from, to time.Time) ([]map[string]interface{}, error) {
+	return s.loadCandlesBetween(symbol, interval, from, to, false)
+}
+
+// LoadCandleHistory is LoadCandlesBetween with the candles rolled up by
+// retention
+func (s *PostgresStore) LoadCandleHistory(symbol string, interval int64, from, to time.Time) ([]map[string]interface{}, error) {
+	return s.loadCandlesBetween(symbol, interval, from, to, true)
+}
+
+func (s *PostgresStore) loadCandlesBetween(symbol string, interval int64, from, to time.Time, rolledUp bool) ([]map[string]interface{}, error) {
+	rows, err := s.db.Query(`
+        SELECT time,open,high,low,close,volume FROM candles
+        WHERE symbol=$1 AND interval_sec=$2 AND (NOT rolled_up OR $3) AND time BETWEEN $4 AND $5
+        ORDER BY time ASC
+    `, symbol, interval, rolledUp, from.UTC(), to.UTC())
+	if err != nil {
+		return []map[string]interface{}{}, err
+	}
+	return scanCandleRows(rows)
+}
+
+// LoadRecentCandles returns the newest limit candles of interval seconds for symbol, oldest first
+func (s *PostgresStore) LoadRecentCandles(symbol string, interval int64, limit int) ([]map[string]interface{}, error) {
+	rows, err := s.db.Query(`
+        SELECT time,open,high,low,close,volume FROM (
+            SELECT time,open,high,low,close,volume FROM candles
+            WHERE symbol=$1 AND interval_sec=$2 AND NOT rolled_up ORDER BY time DESC LIMIT $3
+        ) recent ORDER BY time ASC
+    `, symbol, interval, limit)
+	if err != nil {
+		return []map[string]interface{}{}, err
+	}
+	return scanCandleRows(rows)
+}
+
+// scanCandleRows reads candle rows with times formatted like the SQLite store returns them
+func scanCandleRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+	defer rows.Close()
+	candles := []map[string]interface{}{}
+	for rows.Next() {
+		var t time.Time
+		var o, h, l, c, v float64
+		if err := rows.Scan(&t, &o, &h, &l, &c, &v); err != nil {
+			return nil, err
+		}
+		candles = append(candles, map[string]interface{}{
+			"time": t.UTC().Format(time.RFC3339), "open": o, "high": h, "low": l, "close": c, "volume": v,
+		})
+	}
+	return candles, rows.Err()
+}
+
+// LoadTradesBetween returns trades for symbol executed between from and to, oldest first
+func (s *PostgresStore) LoadTradesBetween(symbol string, from, to time.Time) ([]TradeRecord, error) {
+	trades := []TradeRecord{}
+	rows, err := s.db.Query(`
+        SELECT id, order_id, symbol, side, price, quantity, fee, created_at FROM trades
+        WHERE symbol=$1 AND created_at BETWEEN $2 AND $3
+        ORDER BY created_at ASC
+    `, symbol, from.UTC(), to.UTC())
+	if err != nil {
+		return trades, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TradeRecord
+		if err := rows.Scan(&t.ID, &t.OrderID, &t.Symbol, &t.Side, &t.Price, &t.Quantity, &t.Fee, &t.Created); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+	return trades, rows.Err()
+}
+
+// LoadTradesSince returns the trades of every symbol executed after from,
+// oldest first, with the strategy of their order
+func (s *PostgresStore) LoadTradesSince(from time.Time) ([]TradeRecord, error) {
+	trades := []TradeRecord{}
+	rows, err := s.db.Query(`
+        SELECT t.id, t.order_id, t.symbol, t.side, t.price, t.quantity, t.fee, t.created_at, COALESCE(o.strategy, '')
+        FROM trades t LEFT JOIN orders o ON o.id = t.order_id
+        WHERE t.created_at > $1
+        ORDER BY t.created_at ASC, t.id ASC
+    `, from.UTC())
+	if err != nil {
+		return trades, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TradeRecord
+		if err := rows.Scan(&t.ID, &t.OrderID, &t.Symbol, &t.Side, &t.Price, &t.Quantity, &t.Fee, &t.Created, &t.Strategy); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+	return trades, rows.Err()
+}
+
+// SaveTradeResult records a closed round trip
+func (s *PostgresStore) SaveTradeResult(strategy, symbol string, pnl float64, closedAt time.Time) error {
+	_, err := s.db.Exec(`
+        INSERT INTO trade_results(strategy,symbol,pnl,closed_at)
+        VALUES($1,$2,$3,$4)
+    `, strategy, symbol, pnl, closedAt.UTC())
+	return err
+}
+
+// LoadTradeResults returns the most recent round trips of strategy, newest first
+func (s *PostgresStore) LoadTradeResults(strategy string, limit int) ([]TradeResult, error) {
+	results := []TradeResult{}
+	rows, err := s.db.Query(`
+        SELECT strategy, symbol, pnl, closed_at FROM trade_results
+        WHERE strategy=$1 ORDER BY id DESC LIMIT $2
+    `, strategy, limit)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r TradeResult
+		if err := rows.Scan(&r.Strategy, &r.Symbol, &r.PnL, &r.Closed); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// SaveEquity records an equity sample
+func (s *PostgresStore) SaveEquity(e EquityRecord) error {
+	_, err := s.db.Exec(`
+        INSERT INTO equity(recorded_at,equity,cash,realized,unrealized)
+        VALUES($1,$2,$3,$4,$5)
+    `, e.Time.UTC(), e.Equity, e.Cash, e.Realized, e.Unrealized)
+	return err
+}
+
+// LoadEquity returns the equity samples recorded between from and to, oldest first
+func (s *PostgresStore) LoadEquity(from, to time.Time) ([]EquityRecord, error) {
+	records := []EquityRecord{}
+	rows, err := s.db.Query(`
+        SELECT recorded_at, equity, cash, realized, unrealized FROM equity
+        WHERE recorded_at BETWEEN $1 AND $2
+        ORDER BY id ASC
+    `, from.UTC(), to.UTC())
+	if err != nil {
+		return records, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e EquityRecord
+		if err := rows.Scan(&e.Time, &e.Equity, &e.Cash, &e.Realized, &e.Unrealized); err != nil {
+			return nil, err
+		}
+		records = append(records, e)
+	}
+	return records, rows.Err()
+}
+
+// SaveIdempotencyKey records the order placed for clientOrderID until expiresAt
+func (s *PostgresStore) SaveIdempotencyKey(clientOrderID, orderID string, expiresAt time.Time) error {
+	_, err := s.db.Exec(`
+        INSERT INTO idempotency_keys(client_order_id,order_id,expires_at)
+        VALUES($1,$2,$3)
+        ON CONFLICT (client_order_id) DO UPDATE SET order_id=EXCLUDED.order_id, expires_at=EXCLUDED.expires_at
+    `, clientOrderID, orderID, expiresAt.UTC())
+	return err
+}
+
+// DeleteIdempotencyKey frees clientOrderID for a new order
+func (s *PostgresStore) DeleteIdempotencyKey(clientOrderID string) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE client_order_id=$1`, clientOrderID)
+	return err
+}
+
+// LoadIdempotencyKeys returns the keys still valid at asOf, dropping the expired ones
+func (s *PostgresStore) LoadIdempotencyKeys(asOf time.Time) ([]IdempotencyKey, error) {
+	keys := []IdempotencyKey{}
+	if _, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= $1`, asOf.UTC()); err != nil {
+		return keys, err
+	}
+	rows, err := s.db.Query(`SELECT client_order_id, order_id, expires_at FROM idempotency_keys`)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k IdempotencyKey
+		if err := rows.Scan(&k.ClientOrderID, &k.OrderID, &k.Expires); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// LoadOpenOrders returns unfilled orders for symbol placed at or before asOf
+func (s *PostgresStore) LoadOpenOrders(symbol string, asOf time.Time) ([]OrderRecord, error) {
+	orders := []OrderRecord{}
+	rows, err := s.db.Query(`
+        SELECT id, symbol, side, type, price, quantity, filled, filled_price, created_at,
+            COALESCE(trace_id, ''), COALESCE(status, 'NEW'), COALESCE(filled_qty, 0), COALESCE(strategy, ''), COALESCE(run_id, ''),
+            COALESCE(time_in_force, ''), expire_at
+        FROM orders
+        WHERE symbol=$1 AND NOT filled AND COALESCE(status, 'NEW') NOT IN ('CANCELED', 'REJECTED')
+        AND created_at <= $2
+        ORDER BY created_at ASC
+    `, symbol, asOf.UTC())
+	if err != nil {
+		return orders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o OrderRecord
+		var expireAt sql.NullTime
+		if err := rows.Scan(&o.ID, &o.Symbol, &o.Side, &o.Type, &o.Price, &o.Quantity, &o.Filled, &o.FilledPrice, &o.Created, &o.TraceID, &o.Status, &o.FilledQty, &o.Strategy, &o.RunID, &o.TimeInForce, &expireAt); err != nil {
+			return nil, err
+		}
+		if expireAt.Valid {
+			o.ExpireAt = &expireAt.Time
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// postgresWhere returns the WHERE clause and arguments of f, status is
+// skipped unless withStatus is set
+func (f HistoryFilter) postgresWhere(withStatus bool) (string, []interface{}) {
+	q := ` WHERE TRUE`
+	args := []interface{}{}
+	if f.Symbol != "" {
+		args = append(args, f.Symbol)
+		q += fmt.Sprintf(` AND symbol=$%d`, len(args))
+	}
+	if f.Side != "" {
+		args = append(args, f.Side)
+		q += fmt.Sprintf(` AND side=$%d`, len(args))
+	}
+	if withStatus && f.Status != "" {
+		args = append(args, f.Status)
+		q += fmt.Sprintf(` AND COALESCE(status, 'NEW')=$%d`, len(args))
+	}
+	if withStatus && f.Parent != "" {
+		args = append(args, f.Parent)
+		q += fmt.Sprintf(` AND parent_id=$%d`, len(args))
+	}
+	if f.Run != "" {
+		args = append(args, f.Run)
+		q += fmt.Sprintf(` AND run_id=$%d`, len(args))
+	}
+	if !f.From.IsZero() {
+		args = append(args, f.From.UTC())
+		q += fmt.Sprintf(` AND created_at >= $%d`, len(args))
+	}
+	if !f.To.IsZero() {
+		args = append(args, f.To.UTC())
+		q += fmt.Sprintf(` AND created_at <= $%d`, len(args))
+	}
+	return q, args
+}
+
+// ListOrders returns the orders f matches newest first, with their total count
+func (s *PostgresStore) ListOrders(f HistoryFilter) ([]OrderRecord, int64, error) {
+	where, args := f.postgresWhere(true)
+
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM orders`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	orders := []OrderRecord{}
+	rows, err := s.db.Query(fmt.Sprintf(`
+        SELECT id, symbol, side, type, price, quantity, filled, filled_price, created_at,
+            COALESCE(trace_id, ''), COALESCE(status, 'NEW'), COALESCE(filled_qty, 0), COALESCE(strategy, ''), COALESCE(run_id, ''),
+            COALESCE(parent_id, '')
+        FROM orders%s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d
+    `, where, len(args)+1, len(args)+2), append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return orders, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o OrderRecord
+		if err := rows.Scan(&o.ID, &o.Symbol, &o.Side, &o.Type, &o.Price, &o.Quantity, &o.Filled, &o.FilledPrice, &o.Created, &o.TraceID, &o.Status, &o.FilledQty, &o.Strategy, &o.RunID, &o.ParentID); err != nil {
+			return nil, total, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, total, rows.Err()
+}
+
+// ListTrades returns the trades f matches newest first, with their total count
+func (s *PostgresStore) ListTrades(f HistoryFilter) ([]TradeRecord, int64, error) {
+	where, args := f.postgresWhere(false)
+
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM trades`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	trades := []TradeRecord{}
+	rows, err := s.db.Query(fmt.Sprintf(`
+        SELECT id, order_id, symbol, side, price, quantity, fee, created_at, COALESCE(run_id, '')
+        FROM trades%s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d
+    `, where, len(args)+1, len(args)+2), append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return trades, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TradeRecord
+		if err := rows.Scan(&t.ID, &t.OrderID, &t.Symbol, &t.Side, &t.Price, &t.Quantity, &t.Fee, &t.Created, &t.RunID); err != nil {
+			return nil, total, err
+		}
+		trades = append(trades, t)
+	}
+	return trades, total, rows.Err()
+}
+
+// SaveSignal records a signal
+func (s *PostgresStore) SaveSignal(r SignalRecord) error {
+	_, err := s.db.Exec(`
+        INSERT INTO signals(id,strategy,symbol,side,price,quantity,created_at,run_id)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8)
+        ON CONFLICT (id) DO NOTHING
+    `, r.ID, r.Strategy, r.Symbol, r.Side, r.Price, r.Quantity, r.Created.UTC(), s.run())
+	return err
+}
+
+// ListSignals returns the signals f matches newest first, with their total count
+func (s *PostgresStore) ListSignals(f HistoryFilter) ([]SignalRecord, int64, error) {
+	where, args := f.postgresWhere(false)
+
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM signals`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	signals := []SignalRecord{}
+	rows, err := s.db.Query(fmt.Sprintf(`
+        SELECT id, strategy, symbol, side, price, quantity, created_at, COALESCE(run_id, '')
+        FROM signals%s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d
+    `, where, len(args)+1, len(args)+2), append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return signals, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r SignalRecord
+		if err := rows.Scan(&r.ID, &r.Strategy, &r.Symbol, &r.Side, &r.Price, &r.Quantity, &r.Created, &r.RunID); err != nil {
+			return nil, total, err
+		}
+		signals = append(signals, r)
+	}
+	return signals, total, rows.Err()
+}
+
+// SetOrderParent records that order orderID is a child of parentID
+func (s *PostgresStore) SetOrderParent(orderID, parentID string) error {
+	_, err := s.db.Exec(`UPDATE orders SET parent_id=$1 WHERE id=$2`, parentID, orderID)
+	return err
+}
+
+// SetOrderExpiry records the time in force of order orderID and, for a GTT
+// order, when it expires
+func (s *PostgresStore) SetOrderExpiry(orderID, timeInForce string, expireAt time.Time) error {
+	var at interface{}
+	if !expireAt.IsZero() {
+		at = expireAt.UTC()
+	}
+	_, err := s.db.Exec(`UPDATE orders SET time_in_force=$1, expire_at=$2 WHERE id=$3`, timeInForce, at, orderID)
+	return err
+}
+
+// SaveParentOrder stores r, replacing the state stored before
+func (s *PostgresStore) SaveParentOrder(r ParentOrderRecord) error {
+	_, err := s.db.Exec(`
+        INSERT INTO parent_orders(id,client_order_id,strategy,symbol,side,type,method,price,quantity,filled_qty,filled_price,fee,status,created_at,updated_at,run_id)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)
+        ON CONFLICT (id) DO UPDATE SET filled_qty=EXCLUDED.filled_qty, filled_price=EXCLUDED.filled_price,
+            fee=EXCLUDED.fee, status=EXCLUDED.status, updated_at=EXCLUDED.updated_at
+    `, r.ID, r.ClientOrderID, r.Strategy, r.Symbol, r.Side, r.Type, r.Method, r.Price, r.Quantity,
+		r.FilledQty, r.FilledPrice, r.Fee, r.Status, r.Created.UTC(), r.Updated.UTC(), s.run())
+	return err
+}
+
+// ListParentOrders returns the parent orders f matches newest first, with their total count
+func (s *PostgresStore) ListParentOrders(f HistoryFilter) ([]ParentOrderRecord, int64, error) {
+	f.Parent = ""
+	where, args := f.postgresWhere(true)
+
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM parent_orders`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	parents := []ParentOrderRecord{}
+	rows, err := s.db.Query(fmt.Sprintf(`
+        SELECT id, COALESCE(client_order_id, ''), COALESCE(strategy, ''), symbol, side, type, method, price, quantity,
+            filled_qty, filled_price, fee, status, created_at, updated_at, COALESCE(run_id, '')
+        FROM parent_orders%s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d
+    `, where, len(args)+1, len(args)+2), append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return parents, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r ParentOrderRecord
+		if err := rows.Scan(&r.ID, &r.ClientOrderID, &r.Strategy, &r.Symbol, &r.Side, &r.Type, &r.Method, &r.Price, &r.Quantity,
+			&r.FilledQty, &r.FilledPrice, &r.Fee, &r.Status, &r.Created, &r.Updated, &r.RunID); err != nil {
+			return nil, total, err
+		}
+		parents = append(parents, r)
+	}
+	return parents, total, rows.Err()
+}
+
+// Save Order
+func (s *PostgresStore) SaveOrder(id string,
+	symbol string,
+	side string,
+	orderType string,
+	price float64,
+	filledPrice float64,
+	quantity float64,
+	filled bool,
+	traceID string,
+	strategy string,
+) error {
+	status := "NEW"
+	if filled {
+		status = "FILLED"
+	}
+	_, err := s.db.Exec(`
+        INSERT INTO orders(id,symbol,side,type,price,quantity,filled,filled_price,created_at,trace_id,status,strategy,run_id)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
+        ON CONFLICT (id) DO UPDATE SET
+            symbol=EXCLUDED.symbol, side=EXCLUDED.side, type=EXCLUDED.type, price=EXCLUDED.price,
+            quantity=EXCLUDED.quantity, filled=EXCLUDED.filled, filled_price=EXCLUDED.filled_price,
+            created_at=EXCLUDED.created_at, trace_id=EXCLUDED.trace_id, status=EXCLUDED.status, strategy=EXCLUDED.strategy, run_id=EXCLUDED.run_id
+    `, id, symbol, side, orderType, price, quantity, filled, filledPrice, time.Now().UTC(), traceID, status, strategy, s.run())
+	return err
+}
+
+// UpdateOrderStatus sets the lifecycle status of order id
+func (s *PostgresStore) UpdateOrderStatus(id, status string) error {
+	_, err := s.db.Exec(`UPDATE orders SET status=$1 WHERE id=$2`, status, id)
+	return err
+}
+
+// UpdateOrderFill records a status change of order id with its cumulative fill
+func (s *PostgresStore) UpdateOrderFill(id, status string, filledQty, filledPrice float64) error {
+	_, err := s.db.Exec(`UPDATE orders SET status=$1, filled=$2, filled_qty=$3, filled_price=$4 WHERE id=$5`,
+		status, status == "FILLED", filledQty, filledPrice, id)
+	return err
+}
+
+func (s *PostgresStore) SaveTrade(
+	id, orderID, symbol, side string,
+	price, quantity, fee float64,
+) error {
+	_, err := s.db.Exec(`
+        INSERT INTO trades(id,order_id,symbol,side,price,quantity,fee,created_at,run_id)
+        VALUES($1,$2,$3,$4,$5,$6,$7,now(),$8)
+        ON CONFLICT (id) DO UPDATE SET
+            order_id=EXCLUDED.order_id, symbol=EXCLUDED.symbol, side=EXCLUDED.side,
+            price=EXCLUDED.price, quantity=EXCLUDED.quantity, fee=EXCLUDED.fee, created_at=EXCLUDED.created_at, run_id=EXCLUDED.run_id
+    `, id, orderID, symbol, side, price, quantity, fee, s.run())
+	return err
+}
+
+// SaveRunStart records the start of run r: its id, strategies, symbols,
+// start time and starting equity
+func (s *PostgresStore) SaveRunStart(r RunRecord) error {
+	_, err := s.db.Exec(`
+        INSERT INTO runs(id,strategy,symbols,started_at,start_equity)
+        VALUES($1,$2,$3,$4,$5)
+        ON CONFLICT (id) DO UPDATE SET strategy=EXCLUDED.strategy, symbols=EXCLUDED.symbols,
+            started_at=EXCLUDED.started_at, start_equity=EXCLUDED.start_equity, stopped_at=NULL
+    `, r.ID, strings.Join(r.Strategies, ","), strings.Join(r.Symbols, ","), r.Started.UTC(), r.StartEquity)
+	return err
+}
+
+// SaveRunStop records the stop of run r with its final PnL, equity and
+// drawdown, and counts the trades made during it
+func (s *PostgresStore) SaveRunStop(r RunRecord) error {
+	stopped := time.Now().UTC()
+	if r.Stopped != nil {
+		stopped = r.Stopped.UTC()
+	}
+	_, err := s.db.Exec(`
+        UPDATE runs SET stopped_at=$1, final_pnl=$2, final_equity=$3, max_drawdown=$4,
+            trade_count=(SELECT COUNT(*) FROM trades WHERE run_id=$5)
+        WHERE id=$5
+    `, stopped, r.FinalPnL, r.FinalEquity, r.MaxDrawdown, r.ID)
+	return err
+}
+
+// ListRuns returns runs newest first, with their total count
+func (s *PostgresStore) ListRuns(limit, offset int) ([]RunRecord, int64, error) {
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM runs`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	runs := []RunRecord{}
+	rows, err := s.db.Query(`
+        SELECT r.id, COALESCE(r.strategy, ''), COALESCE(r.symbols, ''), r.started_at, r.stopped_at,
+            r.start_equity, r.final_equity, r.final_pnl, r.max_drawdown,
+            (SELECT COUNT(*) FROM orders o WHERE o.run_id = r.id),
+            COALESCE(r.trade_count, (SELECT COUNT(*) FROM trades t WHERE t.run_id = r.id))
+        FROM runs r ORDER BY r.started_at DESC, r.id DESC LIMIT $1 OFFSET $2
+    `, limit, offset)
+	if err != nil {
+		return runs, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return nil, total, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, total, rows.Err()
+}
+
+// StopOpenRuns marks the runs that never recorded a stop, such as those of
+// a crashed process, stopped now and returns their ids
+func (s *PostgresStore) StopOpenRuns() ([]string, error) {
+	ids := []string{}
+	rows, err := s.db.Query(`
+        UPDATE runs r SET stopped_at=now(), trade_count=(SELECT COUNT(*) FROM trades t WHERE t.run_id = r.id)
+        WHERE stopped_at IS NULL RETURNING id
+    `)
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *PostgresStore) PnL(symbol string) (float64, error) {
+	rows, err := s.db.Query(`
+        SELECT side, price, quantity FROM trades WHERE symbol=$1 ORDER BY created_at ASC
+    `, symbol)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var pnl float64
+	var pos float64
+	var avg float64
+
+	for rows.Next() {
+		var side string
+		var price, qty float64
+		if err := rows.Scan(&side, &price, &qty); err != nil {
+			return 0, err
+		}
+
+		if side == "BUY" {
+			avg = (avg*pos + price*qty) / (pos + qty)
+			pos += qty
+		} else {
+			// SELL
+			pnl += (price - avg) * qty
+			pos -= qty
+		}
+	}
+
+	return pnl, rows.Err()
+}
+
+func (s *PostgresStore) SaveRun(id string, start, end time.Time, final float64) error {
+	_, err := s.db.Exec(`
+        INSERT INTO runs(id,started_at,stopped_at,final_pnl)
+        VALUES($1,$2,$3,$4)
+        ON CONFLICT (id) DO UPDATE SET
+            started_at=EXCLUDED.started_at, stopped_at=EXCLUDED.stopped_at, final_pnl=EXCLUDED.final_pnl
+    `, id, start.UTC(), end.UTC(), final)
+	if err != nil {
+		return fmt.Errorf("postgres: SaveRun failed: %w", err)
+	}
+	return nil
+}
+
+// SaveAudit records a control-plane action
+func (s *PostgresStore) SaveAudit(actor, action, payload string) error {
+	_, err := s.db.Exec(`
+        INSERT INTO audit_log(actor,action,payload,created_at)
+        VALUES($1,$2,$3,$4)
+    `, actor, action, payload, time.Now().UTC())
+	return err
+}
+
+// LoadAudit returns the most recent audit entries, newest first
+func (s *PostgresStore) LoadAudit(limit int) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	rows, err := s.db.Query(`
+        SELECT id, actor, action, payload, created_at FROM audit_log
+        ORDER BY id DESC LIMIT $1
+    `, limit)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Payload, &e.Created); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// SaveBacktest stores a finished backtest with its full stats as JSON
+func (s *PostgresStore) SaveBacktest(rec BacktestRecord, stats []byte) error {
+	_, err := s.db.Exec(`
+        INSERT INTO backtests(id,strategy,symbol,started_at,finished_at,final_equity,stats,created_at)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8)
+        ON CONFLICT (id) DO UPDATE SET
+            strategy=EXCLUDED.strategy, symbol=EXCLUDED.symbol, started_at=EXCLUDED.started_at,
+            finished_at=EXCLUDED.finished_at, final_equity=EXCLUDED.final_equity,
+            stats=EXCLUDED.stats, created_at=EXCLUDED.created_at
+    `, rec.ID, rec.Strategy, rec.Symbol, rec.Started.UTC(), rec.Finished.UTC(), rec.FinalEquity, string(stats), time.Now().UTC())
+	return err
+}
+
+// ListBacktests pages through stored backtests ordered by sortBy.
+// It returns the page and the total number of backtests.
+func (s *PostgresStore) ListBacktests(sortBy string, desc bool, limit, offset int) ([]BacktestRecord, int64, error) {
+	col, ok := backtestSortColumns[sortBy]
+	if !ok {
+		return nil, 0, fmt.Errorf("cannot sort backtests by %q", sortBy)
+	}
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM backtests`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	records := []BacktestRecord{}
+	rows, err := s.db.Query(fmt.Sprintf(`
+        SELECT id, strategy, symbol, started_at, finished_at, final_equity, created_at
+        FROM backtests ORDER BY %s %s, id %s LIMIT $1 OFFSET $2
+    `, col, dir, dir), limit, offset)
+	if err != nil {
+		return records, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r BacktestRecord
+		if err := rows.Scan(&r.ID, &r.Strategy, &r.Symbol, &r.Started, &r.Finished, &r.FinalEquity, &r.Created); err != nil {
+			return nil, total, err
+		}
+		records = append(records, r)
+	}
+	return records, total, rows.Err()
+}
+
+// LoadBacktestStats returns the stored stats JSON of backtest id, or sql.ErrNoRows
+func (s *PostgresStore) LoadBacktestStats(id string) ([]byte, error) {
+	var stats string
+	if err := s.db.QueryRow(`SELECT stats FROM backtests WHERE id=$1`, id).Scan(&stats); err != nil {
+		return nil, err
+	}
+	return []byte(stats), nil
+}
+
+// SaveBacktestTrades replaces the trade log of backtest id
+func (s *PostgresStore) SaveBacktestTrades(id string, trades []BacktestTrade) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM backtest_trades WHERE backtest_id=$1`, id); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+        INSERT INTO backtest_trades(backtest_id,seq,strategy,side,entry_time,exit_time,entry_price,exit_price,quantity,pnl,holding_sec)
+        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+    `)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, t := range trades {
+		if _, err := stmt.Exec(id, i, t.Strategy, t.Side, t.EntryTime.UTC(), t.ExitTime.UTC(),
+			t.EntryPrice, t.ExitPrice, t.Quantity, t.PnL, t.Holding); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadBacktestTrades returns the trade log of backtest id in the order the trades closed
+func (s *PostgresStore) LoadBacktestTrades(id string) ([]BacktestTrade, error) {
+	trades := []BacktestTrade{}
+	rows, err := s.db.Query(`
+        SELECT strategy, side, entry_time, exit_time, entry_price, exit_price, quantity, pnl, holding_sec
+        FROM backtest_trades WHERE backtest_id=$1 ORDER BY seq ASC
+    `, id)
+	if err != nil {
+		return trades, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t BacktestTrade
+		if err := rows.Scan(&t.Strategy, &t.Side, &t.EntryTime, &t.ExitTime, &t.EntryPrice, &t.ExitPrice, &t.Quantity, &t.PnL, &t.Holding); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+	return trades, rows.Err()
+}
+
+// SaveSnapshot stores a serialized engine snapshot
+func (s *PostgresStore) SaveSnapshot(id string, data []byte) error {
+	_, err := s.db.Exec(`
+        INSERT INTO snapshots(id,data,created_at)
+        VALUES($1,$2,$3)
+        ON CONFLICT (id) DO UPDATE SET data=EXCLUDED.data, created_at=EXCLUDED.created_at
+    `, id, string(data), time.Now().UTC())
+	return err
+}
+
+// LoadSnapshot returns snapshot id, or the newest one when id is "" or "latest"
+func (s *PostgresStore) LoadSnapshot(id string) ([]byte, error) {
+	var data string
+	var err error
+	if id == "" || id == "latest" {
+		err = s.db.QueryRow(`SELECT data FROM snapshots ORDER BY created_at DESC LIMIT 1`).Scan(&data)
+	} else {
+		err = s.db.QueryRow(`SELECT data FROM snapshots WHERE id=$1`, id).Scan(&data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(data), nil
+}
+
+// SaveStrategyState replaces the saved state of strategy name
+func (s *PostgresStore) SaveStrategyState(name string, state []byte, at time.Time) error {
+	_, err := s.db.Exec(`
+        INSERT INTO strategy_state(name,state,saved_at)
+        VALUES($1,$2,$3)
+        ON CONFLICT (name) DO UPDATE SET state=EXCLUDED.state, saved_at=EXCLUDED.saved_at
+    `, name, string(state), at.UTC())
+	return err
+}
+
+// LoadStrategyStates returns the saved state of every strategy
+func (s *PostgresStore) LoadStrategyStates() ([]StrategyState, error) {
+	states := []StrategyState{}
+	rows, err := s.db.Query(`SELECT name, state, saved_at FROM strategy_state ORDER BY name ASC`)
+	if err != nil {
+		return states, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var st StrategyState
+		var data string
+		if err := rows.Scan(&st.Name, &data, &st.Saved); err != nil {
+			return nil, err
+		}
+		st.State = []byte(data)
+		states = append(states, st)
+	}
+	return states, rows.Err()
+}
+
+// SaveHeldOrder replaces the held order id of kind
+func (s *PostgresStore) SaveHeldOrder(kind, id string, payload []byte, at time.Time) error {
+	_, err := s.db.Exec(`
+        INSERT INTO held_orders(kind,id,payload,saved_at)
+        VALUES($1,$2,$3,$4)
+        ON CONFLICT (kind, id) DO UPDATE SET payload=EXCLUDED.payload, saved_at=EXCLUDED.saved_at
+    `, kind, id, string(payload), at.UTC())
+	return err
+}
+
+// DeleteHeldOrder forgets the held order id of kind
+func (s *PostgresStore) DeleteHeldOrder(kind, id string) error {
+	_, err := s.db.Exec(`DELETE FROM held_orders WHERE kind=$1 AND id=$2`, kind, id)
+	return err
+}
+
+// LoadHeldOrders returns the held orders of kind, oldest first
+func (s *PostgresStore) LoadHeldOrders(kind string) ([]HeldOrder, error) {
+	held := []HeldOrder{}
+	rows, err := s.db.Query(`SELECT kind, id, payload, saved_at FROM held_orders WHERE kind=$1 ORDER BY saved_at ASC, id ASC`, kind)
+	if err != nil {
+		return held, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h HeldOrder
+		var data string
+		if err := rows.Scan(&h.Kind, &h.ID, &data, &h.Saved); err != nil {
+			return nil, err
+		}
+		h.Payload = []byte(data)
+		held = append(held, h)
+	}
+	return held, rows.Err()
+}
+
+// SaveSessionEvent appends an event to a recorded session
+func (s *PostgresStore) SaveSessionEvent(sessionID, kind, source, symbol string, at time.Time, payload []byte) error {
+	_, err := s.db.Exec(`
+        INSERT INTO session_events(session_id,kind,source,symbol,recorded_at,payload)
+        VALUES($1,$2,$3,$4,$5,$6)
+    `, sessionID, kind, source, symbol, at.UTC(), string(payload))
+	return err
+}
+
+// LoadSessionEvents returns events of a session in recording order.
+// Empty kind or symbol match everything; zero from/to leave the window open.
+func (s *PostgresStore) LoadSessionEvents(sessionID, kind, symbol string, from, to time.Time) ([]SessionEvent, error) {
+	q := `SELECT id, session_id, kind, source, symbol, recorded_at, payload FROM session_events WHERE session_id=$1`
+	args := []interface{}{sessionID}
+	if kind != "" {
+		args = append(args, kind)
+		q += fmt.Sprintf(` AND kind=$%d`, len(args))
+	}
+	if symbol != "" {
+		args = append(args, symbol)
+		q += fmt.Sprintf(` AND symbol=$%d`, len(args))
+	}
+	if !from.IsZero() {
+		args = append(args, from.UTC())
+		q += fmt.Sprintf(` AND recorded_at >= $%d`, len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to.UTC())
+		q += fmt.Sprintf(` AND recorded_at <= $%d`, len(args))
+	}
+	q += ` ORDER BY id ASC`
+
+	events := []SessionEvent{}
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return events, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e SessionEvent
+		var payload string
+		if err := rows.Scan(&e.ID, &e.SessionID, &e.Kind, &e.Source, &e.Symbol, &e.RecordedAt, &payload); err != nil {
+			return nil, err
+		}
+		e.Payload = json.RawMessage(payload)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ListSessions returns recorded sessions, newest first
+func (s *PostgresStore) ListSessions(limit int) ([]SessionSummary, error) {
+	sessions := []SessionSummary{}
+	rows, err := s.db.Query(`
+        SELECT session_id, MIN(recorded_at), MAX(recorded_at), COUNT(*) FROM session_events
+        GROUP BY session_id ORDER BY MIN(id) DESC LIMIT $1
+    `, limit)
+	if err != nil {
+		return sessions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ss SessionSummary
+		if err := rows.Scan(&ss.ID, &ss.Started, &ss.Ended, &ss.Events); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, ss)
+	}
+	return sessions, rows.Err()
+}
+
+// LatestSessionID returns the most recently recorded session
+func (s *PostgresStore) LatestSessionID() (string, error) {
+	var id string
+	err := s.db.QueryRow(`SELECT session_id FROM session_events ORDER BY id DESC LIMIT 1`).Scan(&id)
+	return id, err
+}
+
+// Compact applies retention policy p as of now: candle roll ups and the
+// deletes of each kind of data run in one transaction. Trades and candles
+// newer than the latest snapshot are kept for Recover, and no trade is
+// deleted before there is one.
+func (s *PostgresStore) Compact(p RetentionPolicy, now time.Time) (CompactReport, error) {
+	var rep CompactReport
+	if p.Empty() {
+		return rep, nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return rep, err
+	}
+	defer tx.Rollback()
+
+	exec := func(n *int64, q string, args ...any) error {
+		res, err := tx.Exec(q, args...)
+		if err != nil {
+			return err
+		}
+		affected, _ := res.RowsAffected()
+		*n += affected
+		return nil
+	}
+	var snapAt sql.NullTime
+	if err := tx.QueryRow(`SELECT MAX(created_at) FROM snapshots`).Scan(&snapAt); err != nil {
+		return rep, err
+	}
+	snap := snapAt.Time
+	for _, rule := range p.candleRules() {
+		cut := recoveryCutoff(rollUpCutoff(now, rule.Keep, rule.RollUp), snap, rule.RollUp)
+		if rule.RollUp > 0 {
+			symbols, err := queryStrings(tx, `SELECT DISTINCT symbol FROM candles WHERE interval_sec=$1 AND time < $2`, rule.Interval, cut)
+			if err != nil {
+				return rep, err
+			}
+			for _, symbol := range symbols {
+				rows, err := tx.Query(`
+                    SELECT time,open,high,low,close,volume FROM candles
+                    WHERE symbol=$1 AND interval_sec=$2 AND time < $3
+                    ORDER BY time ASC
+                `, symbol, rule.Interval, cut)
+				if err != nil {
+					return rep, err
+				}
+				old, err := scanStoredCandles(rows)
+				if err != nil {
+					return rep, err
+				}
+				for _, c := range rollUp(symbol, rule.RollUp, old) {
+					if err := exec(&rep.RolledUp, `
+                        INSERT INTO candles(id,symbol,interval_sec,time,open,high,low,close,volume,rolled_up)
+                        VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,TRUE)
+                        ON CONFLICT (id) DO NOTHING
+                    `, c.id, c.symbol, c.interval, c.time, c.open, c.high, c.low, c.close, c.volume); err != nil {
+						return rep, err
+					}
+				}
+			}
+		}
+		if err := exec(&rep.Candles, `DELETE FROM candles WHERE interval_sec=$1 AND time < $2`, rule.Interval, cut); err != nil {
+			return rep, err
+		}
+	}
+	if p.Trades > 0 && !snap.IsZero() {
+		cut := recoveryCutoff(now.Add(-p.Trades), snap, 0)
+		if err := exec(&rep.Trades, `DELETE FROM trades WHERE created_at < $1`, cut); err != nil {
+			return rep, err
+		}
+		if err := exec(&rep.Orders, `
+            DELETE FROM orders WHERE created_at < $1
+            AND (filled OR COALESCE(status, 'NEW') IN ('FILLED', 'CANCELED', 'REJECTED'))
+        `, cut); err != nil {
+			return rep, err
+		}
+		if err := exec(&rep.Orders, `
+            DELETE FROM parent_orders WHERE created_at < $1
+            AND status IN ('FILLED', 'CANCELED', 'REJECTED')
+        `, cut); err != nil {
+			return rep, err
+		}
+	}
+	if p.SessionEvents > 0 {
+		if err := exec(&rep.SessionEvents, `DELETE FROM session_events WHERE recorded_at < $1`, now.Add(-p.SessionEvents)); err != nil {
+			return rep, err
+		}
+	}
+	if p.Equity > 0 {
+		if err := exec(&rep.Equity, `DELETE FROM equity WHERE recorded_at < $1`, now.Add(-p.Equity)); err != nil {
+			return rep, err
+		}
+	}
+	return rep, tx.Commit()
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// CandleRetention keeps candles of Interval seconds for Keep. With RollUp
+// set they are first aggregated into candles of RollUp seconds, which are
+// kept until a rule for that interval removes them.
+type CandleRetention struct {
+	Interval int64
+	Keep     time.Duration
+	RollUp   int64 // 0 deletes without rolling up
+}
+
+// RetentionPolicy is how long the store keeps each kind of data, a zero
+// duration keeps it forever
+type RetentionPolicy struct {
+	Candles       []CandleRetention
+	Trades        time.Duration // trades and the orders that are final
+	SessionEvents time.Duration
+	Equity        time.Duration
+}
+
+// Empty reports whether p keeps everything
+func (p RetentionPolicy) Empty() bool {
+	return len(p.Candles) == 0 && p.Trades <= 0 && p.SessionEvents <= 0 && p.Equity <= 0
+}
+
+// candleRules returns the candle rules finest interval first, so candles
+// rolled up by one rule are in place for the rule of their interval
+func (p RetentionPolicy) candleRules() []CandleRetention {
+	rules := append([]CandleRetention(nil), p.Candles...)
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Interval < rules[j].Interval })
+	return rules
+}
+
+// CompactReport counts what one compaction pass wrote and removed
+type CompactReport struct {
+	RolledUp      int64 `json:"rolled_up"` // candles written by roll ups
+	Candles       int64 `json:"candles"`
+	Trades        int64 `json:"trades"`
+	Orders        int64 `json:"orders"`
+	SessionEvents int64 `json:"session_events"`
+	Equity        int64 `json:"equity"`
+}
+
+func (r CompactReport) String() string {
+	return fmt.Sprintf("rolled up %d candles, removed %d candles, %d trades, %d orders, %d session events, %d equity samples",
+		r.RolledUp, r.Candles, r.Trades, r.Orders, r.SessionEvents, r.Equity)
+}
+
+// RunRetention compacts db by p every interval until ctx ends
+func RunRetention(ctx context.Context, db Store, p RetentionPolicy, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			start := time.Now()
+			rep, err := db.Compact(p, start)
+			if err != nil {
+				log.Printf("retention: %v", err)
+				continue
+			}
+			if rep != (CompactReport{}) {
+				log.Printf("retention: %s in %s", rep, time.Since(start).Round(time.Millisecond))
+			}
+		}
+	}
+}
+
+// rollUpCutoff is the start of the bucket of every seconds holding
+// now-keep. Only candles before it are compacted, so a bucket is never
+// rolled up while part of it is still kept.
+func rollUpCutoff(now time.Time, keep time.Duration, every int64) time.Time {
+	cut := now.Add(-keep).UTC()
+	if every <= 0 {
+		return cut
+	}
+	return time.Unix(cut.Unix()-cut.Unix()%every, 0).UTC()
+}
+
+// recoveryCutoff moves cut back to snap, the time of the latest snapshot,
+// when snap is earlier: Recover replays the trades and candles stored
+// since the snapshot, so those are kept. Candles are cut at the start of
+// the bucket of every seconds holding snap. A zero snap leaves cut.
+func recoveryCutoff(cut, snap time.Time, every int64) time.Time {
+	if snap.IsZero() {
+		return cut
+	}
+	floor := snap.UTC().Truncate(time.Second)
+	if every > 0 {
+		floor = rollUpCutoff(floor, 0, every)
+	}
+	if floor.Before(cut) {
+		return floor
+	}
+	return cut
+}
+
+// storedCandle is a candle row read back for a roll up
+type storedCandle struct {
+	time                           time.Time
+	open, high, low, close, volume float64
+}
+
+// rollUp aggregates the candles of symbol, oldest first, into candles of
+// every seconds aligned to the Unix epoch
+func rollUp(symbol string, every int64, in []storedCandle) []pendingCandle {
+	var out []pendingCandle
+	var cur *pendingCandle
+	var bucket int64
+	for _, c := range in {
+		b := c.time.Unix() - c.time.Unix()%every
+		if cur == nil || b != bucket {
+			if cur != nil {
+				out = append(out, *cur)
+			}
+			bucket = b
+			ts := time.Unix(b, 0).UTC().Format(time.RFC3339)
+			cur = &pendingCandle{
+				id: fmt.Sprintf("%s_%d_%s", symbol, every, ts), symbol: symbol, interval: every, time: ts,
+				open: c.open, high: c.high, low: c.low, close: c.close,
+			}
+		}
+		cur.high = max(cur.high, c.high)
+		cur.low = min(cur.low, c.low)
+		cur.close = c.close
+		cur.volume += c.volume
+	}
+	if cur != nil {
+		out = append(out, *cur)
+	}
+	return out
+}
+
+// queryStrings returns the single string column of the rows of q
+func queryStrings(tx *sql.Tx, q string, args ...any) ([]string, error) {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// scanStoredCandles reads and closes rows of time, open, high, low, close
+// and volume. Times are read as text so both stores' columns scan.
+func scanStoredCandles(rows *sql.Rows) ([]storedCandle, error) {
+	defer rows.Close()
+	var out []storedCandle
+	for rows.Next() {
+		var c storedCandle
+		var ts string
+		if err := rows.Scan(&ts, &c.open, &c.high, &c.low, &c.close, &c.volume); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return nil, fmt.Errorf("candle time %q: %w", ts, err)
+		}
+		c.time = t
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
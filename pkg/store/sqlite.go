@@ -2,7 +2,9 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -10,72 +12,164 @@ import (
 
 // SQLiteStore wraps a *sql.DB
 type SQLiteStore struct {
-	db *sql.DB
+	runTag
+	db         *sql.DB
+	migrations *migrator
+	candles    *candleBatcher // nil when candles are written as they are saved
+}
+
+// SQLiteConfig tunes the SQLite store
+type SQLiteConfig struct {
+	BusyTimeout time.Duration // how long a write waits for the database lock, 5s when zero
+	CandleBatch int           // candles written per transaction, 0 writes each as it is saved
+	CandleFlush time.Duration // longest a batched candle waits to be written, 1s when zero
 }
 
 func (s *SQLiteStore) Close() error {
+	if s.candles != nil {
+		s.candles.close()
+	}
 	if s.db != nil {
 		return s.db.Close()
 	}
 	return nil
 }
 
-func NewSQLiteStore(path string) (*SQLiteStore, error) {
-	db, err := sql.Open("sqlite3", path)
+// NewSQLiteStore opens the database at path in WAL mode, so reads do not
+// block on writes and commits sync less often
+func NewSQLiteStore(path string, cfg SQLiteConfig) (*SQLiteStore, error) {
+	if cfg.BusyTimeout <= 0 {
+		cfg.BusyTimeout = 5 * time.Second
+	}
+	if cfg.CandleFlush <= 0 {
+		cfg.CandleFlush = time.Second
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	// transactions take the write lock up front so they wait out busy_timeout
+	// instead of failing when a reader's snapshot goes stale
+	dsn := fmt.Sprintf("%s%s_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=%d&_txlock=immediate",
+		path, sep, cfg.BusyTimeout.Milliseconds())
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
 	store := &SQLiteStore{db: db}
 	if err := store.migrate(); err != nil {
+		db.Close()
 		return nil, err
 	}
+	if cfg.CandleBatch > 0 {
+		store.candles = newCandleBatcher(db, cfg.CandleBatch, cfg.CandleFlush)
+	}
 	return store, nil
 }
 
-// migrate runs initial schema creation
+// migrate applies the migrations this database has not seen yet
 func (s *SQLiteStore) migrate() error {
-	schema := `
-CREATE TABLE IF NOT EXISTS orders (
-	id TEXT PRIMARY KEY,
-	symbol TEXT,
-	side TEXT,
-	type TEXT,
-	price REAL,
-	quantity REAL,
-	filled INTEGER,
-	filled_price REAL,
-	created_at DATETIME
-);
-
-CREATE TABLE IF NOT EXISTS trades (
-	id TEXT PRIMARY KEY,
-	order_id TEXT,
-	symbol TEXT,
-	side TEXT,
-	price REAL,
-	quantity REAL,
-	created_at DATETIME
-);
-
-CREATE TABLE IF NOT EXISTS runs (
-	id TEXT PRIMARY KEY,
-	strategy TEXT,
-	started_at DATETIME,
-	stopped_at DATETIME
-);
-
-CREATE TABLE IF NOT EXISTS candles (
-	id TEXT PRIMARY KEY,
-	symbol TEXT,
-	time DATETIME,
-	open REAL,
-	high REAL,
-	low REAL,
-	close REAL,
-	volume REAL
-);
-`
-	_, err := s.db.Exec(schema)
+	m, err := newMigrator(s.db, "sqlite", "?", nil)
+	if err != nil {
+		return err
+	}
+	s.migrations = m
+
+	var tracked, tables int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='schema_migrations'`).Scan(&tracked); err != nil {
+		return err
+	}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='orders'`).Scan(&tables); err != nil {
+		return err
+	}
+	if tracked == 0 && tables > 0 {
+		if err := s.upgradeUntracked(m.migrations[0]); err != nil {
+			return fmt.Errorf("sqlite: upgrade schema to migration 1: %w", err)
+		}
+		if err := m.baseline(1); err != nil {
+			return err
+		}
+	}
+	return m.to(-1)
+}
+
+// SchemaVersion is the last migration applied
+func (s *SQLiteStore) SchemaVersion() (int, error) {
+	return s.migrations.version(s.db)
+}
+
+// MigrateTo applies or reverts migrations until version is the last one
+// applied, a negative version means the latest
+func (s *SQLiteStore) MigrateTo(version int) error {
+	return s.migrations.to(version)
+}
+
+// upgradeUntracked brings a database created before migrations were
+// tracked to the schema of the first one: missing tables are created and
+// the columns added since are added where they are not there yet
+func (s *SQLiteStore) upgradeUntracked(initial Migration) error {
+	if _, err := s.db.Exec(initial.Up); err != nil {
+		return err
+	}
+
+	// columns added after the initial schema
+	if err := s.addColumn("orders", "trace_id", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.addColumn("orders", "status", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.addColumn("orders", "filled_qty", "REAL"); err != nil {
+		return err
+	}
+	if err := s.addColumn("orders", "strategy", "TEXT"); err != nil {
+		return err
+	}
+	if err := s.addColumn("candles", "interval_sec", "INTEGER"); err != nil {
+		return err
+	}
+	for _, c := range []struct{ name, typ string }{
+		{"final_pnl", "REAL"},
+		{"symbols", "TEXT"},
+		{"start_equity", "REAL"},
+		{"final_equity", "REAL"},
+		{"max_drawdown", "REAL"},
+		{"trade_count", "INTEGER"},
+	} {
+		if err := s.addColumn("runs", c.name, c.typ); err != nil {
+			return err
+		}
+	}
+	for _, table := range []string{"orders", "trades", "candles"} {
+		if err := s.addColumn(table, "run_id", "TEXT"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumn adds a column to an existing table if it is not there yet
+func (s *SQLiteStore) addColumn(table, column, typ string) error {
+	rows, err := s.db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = s.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, typ))
 	return err
 }
 
@@ -100,22 +194,34 @@ func (s *SQLiteStore) CountRuns() (int64, error) {
 	return count, err
 }
 
-// Persist candle
-func (s *SQLiteStore) SaveCandle(symbol string, cTime string, open, high, low, close, volume float64) error {
-	stmt, err := s.db.Prepare(`INSERT OR IGNORE INTO candles(id,symbol,time,open,high,low,close,volume) VALUES(?,?,?,?,?,?,?,?,?)`)
-	if err != nil {
-		return err
+// SaveCandle persists a candle of interval seconds, keeping the first one
+// stored for a time. With candle batching on it is queued and written later.
+func (s *SQLiteStore) SaveCandle(symbol string, interval int64, cTime string, open, high, low, close, volume float64) error {
+	id := fmt.Sprintf("%s_%d_%s", symbol, interval, cTime)
+	if s.candles != nil {
+		s.candles.add(pendingCandle{
+			id: id, symbol: symbol, interval: interval, time: cTime,
+			open: open, high: high, low: low, close: close, volume: volume, run: s.run(),
+		})
+		return nil
 	}
-	defer stmt.Close()
-	id := fmt.Sprintf("%s_%s", symbol, cTime)
-	_, err = stmt.Exec(id, symbol, cTime, open, high, low, close, volume)
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO candles(id,symbol,interval_sec,time,open,high,low,close,volume,run_id) VALUES(?,?,?,?,?,?,?,?,?,?)`,
+		id, symbol, interval, cTime, open, high, low, close, volume, s.run())
 	return err
 }
 
-// Load candles for symbol
-func (s *SQLiteStore) LoadCandles(symbol string, limit int) ([]map[string]interface{}, error) {
+// flushCandles writes the queued candles so reads see them
+func (s *SQLiteStore) flushCandles() {
+	if s.candles != nil {
+		s.candles.flush()
+	}
+}
+
+// LoadCandles returns the oldest limit candles of interval seconds for symbol
+func (s *SQLiteStore) LoadCandles(symbol string, interval int64, limit int) ([]map[string]interface{}, error) {
+	s.flushCandles()
 	var candles = []map[string]interface{}{}
-	rows, err := s.db.Query(`SELECT time,open,high,low,close,volume FROM candles WHERE symbol=? ORDER BY time ASC LIMIT ?`, symbol, limit)
+	rows, err := s.db.Query(`SELECT time,open,high,low,close,volume FROM candles WHERE symbol=? AND interval_sec=? AND rolled_up=0 ORDER BY time ASC LIMIT ?`, symbol, interval, limit)
 	if err != nil {
 		return candles, err
 	}
@@ -134,6 +240,555 @@ func (s *SQLiteStore) LoadCandles(symbol string, limit int) ([]map[string]interf
 	return candles, nil
 }
 
+// LoadCandlesBetween returns the candles of interval seconds for symbol with
+// from <= time <= to, oldest first, leaving out candles rolled up by
+// retention
+func (s *SQLiteStore) LoadCandlesBetween(symbol string, interval int64, from, to time.Time) ([]map[string]interface{}, error) {
+	return s.loadCandlesBetween(symbol, interval, from, to, false)
+}
+
+// LoadCandleHistory is LoadCandlesBetween with the candles rolled up by
+// retention
+func (s *SQLiteStore) LoadCandleHistory(symbol string, interval int64, from, to time.Time) ([]map[string]interface{}, error) {
+	return s.loadCandlesBetween(symbol, interval, from, to, true)
+}
+
+func (s *SQLiteStore) loadCandlesBetween(symbol string, interval int64, from, to time.Time, rolledUp bool) ([]map[string]interface{}, error) {
+	s.flushCandles()
+	var candles = []map[string]interface{}{}
+	rows, err := s.db.Query(`
+        SELECT time,open,high,low,close,volume FROM candles
+        WHERE symbol=? AND interval_sec=? AND (rolled_up=0 OR ?) AND datetime(time) BETWEEN datetime(?) AND datetime(?)
+        ORDER BY time ASC
+    `, symbol, interval, rolledUp, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	if err != nil {
+		return candles, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t string
+		var o, h, l, c, v float64
+		if err := rows.Scan(&t, &o, &h, &l, &c, &v); err != nil {
+			return nil, err
+		}
+		candles = append(candles, map[string]interface{}{
+			"time": t, "open": o, "high": h, "low": l, "close": c, "volume": v,
+		})
+	}
+	return candles, rows.Err()
+}
+
+// LoadRecentCandles returns the newest limit candles of interval seconds for symbol, oldest first
+func (s *SQLiteStore) LoadRecentCandles(symbol string, interval int64, limit int) ([]map[string]interface{}, error) {
+	s.flushCandles()
+	var candles = []map[string]interface{}{}
+	rows, err := s.db.Query(`
+        SELECT time,open,high,low,close,volume FROM (
+            SELECT time,open,high,low,close,volume FROM candles
+            WHERE symbol=? AND interval_sec=? AND rolled_up=0 ORDER BY datetime(time) DESC LIMIT ?
+        ) ORDER BY datetime(time) ASC
+    `, symbol, interval, limit)
+	if err != nil {
+		return candles, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t string
+		var o, h, l, c, v float64
+		if err := rows.Scan(&t, &o, &h, &l, &c, &v); err != nil {
+			return nil, err
+		}
+		candles = append(candles, map[string]interface{}{
+			"time": t, "open": o, "high": h, "low": l, "close": c, "volume": v,
+		})
+	}
+	return candles, rows.Err()
+}
+
+// OrderRecord is a persisted order row
+type OrderRecord struct {
+	ID          string     `json:"id"`
+	Symbol      string     `json:"symbol"`
+	Side        string     `json:"side"`
+	Type        string     `json:"type"`
+	Price       float64    `json:"price"`
+	Quantity    float64    `json:"quantity"`
+	Filled      bool       `json:"filled"`
+	FilledPrice float64    `json:"filled_price"`
+	Created     time.Time  `json:"created_at"`
+	TraceID     string     `json:"trace_id,omitempty"`
+	Status      string     `json:"status"`
+	FilledQty   float64    `json:"filled_qty"` // executed so far, orders can fill in parts
+	Strategy    string     `json:"strategy,omitempty"`
+	RunID       string     `json:"run_id,omitempty"`
+	ParentID    string     `json:"parent_id,omitempty"` // the parent order it was split or sliced from
+	TimeInForce string     `json:"time_in_force,omitempty"`
+	ExpireAt    *time.Time `json:"expire_at,omitempty"` // when a GTT order still resting is canceled
+}
+
+// HistoryFilter selects orders or trades for the history API. Empty strings
+// match everything and zero from/to leave the window open.
+type HistoryFilter struct {
+	Symbol string
+	Side   string
+	Status string // orders only
+	Parent string // orders only, the children of a parent order
+	Run    string
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+}
+
+// TradeRecord is a persisted trade (fill) row
+type TradeRecord struct {
+	ID       string    `json:"id"`
+	OrderID  string    `json:"order_id"`
+	Symbol   string    `json:"symbol"`
+	Side     string    `json:"side"`
+	Price    float64   `json:"price"`
+	Quantity float64   `json:"quantity"`
+	Fee      float64   `json:"fee"`
+	Created  time.Time `json:"created_at"`
+	Strategy string    `json:"strategy,omitempty"` // of the order, set by LoadTradesSince
+	RunID    string    `json:"run_id,omitempty"`
+}
+
+// LoadTradesBetween returns trades for symbol executed between from and to, oldest first
+func (s *SQLiteStore) LoadTradesBetween(symbol string, from, to time.Time) ([]TradeRecord, error) {
+	trades := []TradeRecord{}
+	rows, err := s.db.Query(`
+        SELECT id, order_id, symbol, side, price, quantity, fee, created_at FROM trades
+        WHERE symbol=? AND datetime(created_at) BETWEEN datetime(?) AND datetime(?)
+        ORDER BY created_at ASC
+    `, symbol, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	if err != nil {
+		return trades, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TradeRecord
+		if err := rows.Scan(&t.ID, &t.OrderID, &t.Symbol, &t.Side, &t.Price, &t.Quantity, &t.Fee, &t.Created); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+	return trades, rows.Err()
+}
+
+// LoadTradesSince returns the trades of every symbol executed after from,
+// oldest first, with the strategy of their order
+func (s *SQLiteStore) LoadTradesSince(from time.Time) ([]TradeRecord, error) {
+	trades := []TradeRecord{}
+	rows, err := s.db.Query(`
+        SELECT t.id, t.order_id, t.symbol, t.side, t.price, t.quantity, t.fee, t.created_at, COALESCE(o.strategy, '')
+        FROM trades t LEFT JOIN orders o ON o.id = t.order_id
+        WHERE datetime(t.created_at) > datetime(?)
+        ORDER BY t.created_at ASC, t.id ASC
+    `, from.UTC().Format(time.RFC3339))
+	if err != nil {
+		return trades, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TradeRecord
+		if err := rows.Scan(&t.ID, &t.OrderID, &t.Symbol, &t.Side, &t.Price, &t.Quantity, &t.Fee, &t.Created, &t.Strategy); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+	return trades, rows.Err()
+}
+
+// TradeResult is the PnL of one closed round trip of a strategy, net of fees
+type TradeResult struct {
+	Strategy string    `json:"strategy"`
+	Symbol   string    `json:"symbol"`
+	PnL      float64   `json:"pnl"`
+	Closed   time.Time `json:"closed_at"`
+}
+
+// SaveTradeResult records a closed round trip
+func (s *SQLiteStore) SaveTradeResult(strategy, symbol string, pnl float64, closedAt time.Time) error {
+	_, err := s.db.Exec(`
+        INSERT INTO trade_results(strategy,symbol,pnl,closed_at)
+        VALUES(?,?,?,?)
+    `, strategy, symbol, pnl, closedAt.UTC())
+	return err
+}
+
+// LoadTradeResults returns the most recent round trips of strategy, newest first
+func (s *SQLiteStore) LoadTradeResults(strategy string, limit int) ([]TradeResult, error) {
+	results := []TradeResult{}
+	rows, err := s.db.Query(`
+        SELECT strategy, symbol, pnl, closed_at FROM trade_results
+        WHERE strategy=? ORDER BY id DESC LIMIT ?
+    `, strategy, limit)
+	if err != nil {
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r TradeResult
+		if err := rows.Scan(&r.Strategy, &r.Symbol, &r.PnL, &r.Closed); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// EquityRecord is one sample of account equity, cash plus open positions
+// marked to their last price
+type EquityRecord struct {
+	Time       time.Time `json:"time"`
+	Equity     float64   `json:"equity"`
+	Cash       float64   `json:"cash"`
+	Realized   float64   `json:"realized"`
+	Unrealized float64   `json:"unrealized"`
+}
+
+// SaveEquity records an equity sample
+func (s *SQLiteStore) SaveEquity(e EquityRecord) error {
+	_, err := s.db.Exec(`
+        INSERT INTO equity(recorded_at,equity,cash,realized,unrealized)
+        VALUES(?,?,?,?,?)
+    `, e.Time.UTC(), e.Equity, e.Cash, e.Realized, e.Unrealized)
+	return err
+}
+
+// LoadEquity returns the equity samples recorded between from and to, oldest first
+func (s *SQLiteStore) LoadEquity(from, to time.Time) ([]EquityRecord, error) {
+	records := []EquityRecord{}
+	rows, err := s.db.Query(`
+        SELECT recorded_at, equity, cash, realized, unrealized FROM equity
+        WHERE datetime(recorded_at) BETWEEN datetime(?) AND datetime(?)
+        ORDER BY id ASC
+    `, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	if err != nil {
+		return records, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e EquityRecord
+		if err := rows.Scan(&e.Time, &e.Equity, &e.Cash, &e.Realized, &e.Unrealized); err != nil {
+			return nil, err
+		}
+		records = append(records, e)
+	}
+	return records, rows.Err()
+}
+
+// IdempotencyKey ties the client order id of a submit to the order it placed
+type IdempotencyKey struct {
+	ClientOrderID string    `json:"client_order_id"`
+	OrderID       string    `json:"order_id"`
+	Expires       time.Time `json:"expires_at"`
+}
+
+// SaveIdempotencyKey records the order placed for clientOrderID until expiresAt
+func (s *SQLiteStore) SaveIdempotencyKey(clientOrderID, orderID string, expiresAt time.Time) error {
+	_, err := s.db.Exec(`
+        INSERT OR REPLACE INTO idempotency_keys(client_order_id,order_id,expires_at)
+        VALUES(?,?,?)
+    `, clientOrderID, orderID, expiresAt.UTC())
+	return err
+}
+
+// DeleteIdempotencyKey frees clientOrderID for a new order
+func (s *SQLiteStore) DeleteIdempotencyKey(clientOrderID string) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE client_order_id=?`, clientOrderID)
+	return err
+}
+
+// LoadIdempotencyKeys returns the keys still valid at asOf, dropping the expired ones
+func (s *SQLiteStore) LoadIdempotencyKeys(asOf time.Time) ([]IdempotencyKey, error) {
+	keys := []IdempotencyKey{}
+	if _, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= ?`, asOf.UTC()); err != nil {
+		return keys, err
+	}
+	rows, err := s.db.Query(`SELECT client_order_id, order_id, expires_at FROM idempotency_keys`)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var k IdempotencyKey
+		if err := rows.Scan(&k.ClientOrderID, &k.OrderID, &k.Expires); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// LoadOpenOrders returns unfilled orders for symbol placed at or before asOf
+func (s *SQLiteStore) LoadOpenOrders(symbol string, asOf time.Time) ([]OrderRecord, error) {
+	orders := []OrderRecord{}
+	rows, err := s.db.Query(`
+        SELECT id, symbol, side, type, price, quantity, filled, filled_price, created_at,
+            COALESCE(trace_id, ''), COALESCE(status, 'NEW'), COALESCE(filled_qty, 0), COALESCE(strategy, ''), COALESCE(run_id, ''),
+            COALESCE(time_in_force, ''), expire_at
+        FROM orders
+        WHERE symbol=? AND filled=0 AND COALESCE(status, 'NEW') NOT IN ('CANCELED', 'REJECTED')
+        AND datetime(created_at) <= datetime(?)
+        ORDER BY created_at ASC
+    `, symbol, asOf.UTC().Format(time.RFC3339))
+	if err != nil {
+		return orders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o OrderRecord
+		var expireAt sql.NullTime
+		if err := rows.Scan(&o.ID, &o.Symbol, &o.Side, &o.Type, &o.Price, &o.Quantity, &o.Filled, &o.FilledPrice, &o.Created, &o.TraceID, &o.Status, &o.FilledQty, &o.Strategy, &o.RunID, &o.TimeInForce, &expireAt); err != nil {
+			return nil, err
+		}
+		if expireAt.Valid {
+			o.ExpireAt = &expireAt.Time
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// sqliteWhere returns the WHERE clause and arguments of f, status is skipped
+// unless withStatus is set
+func (f HistoryFilter) sqliteWhere(withStatus bool) (string, []interface{}) {
+	q := ` WHERE 1=1`
+	args := []interface{}{}
+	if f.Symbol != "" {
+		q += ` AND symbol=?`
+		args = append(args, f.Symbol)
+	}
+	if f.Side != "" {
+		q += ` AND side=?`
+		args = append(args, f.Side)
+	}
+	if withStatus && f.Status != "" {
+		q += ` AND COALESCE(status, 'NEW')=?`
+		args = append(args, f.Status)
+	}
+	if withStatus && f.Parent != "" {
+		q += ` AND parent_id=?`
+		args = append(args, f.Parent)
+	}
+	if f.Run != "" {
+		q += ` AND run_id=?`
+		args = append(args, f.Run)
+	}
+	if !f.From.IsZero() {
+		q += ` AND datetime(created_at) >= datetime(?)`
+		args = append(args, f.From.UTC().Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		q += ` AND datetime(created_at) <= datetime(?)`
+		args = append(args, f.To.UTC().Format(time.RFC3339))
+	}
+	return q, args
+}
+
+// ListOrders returns the orders f matches newest first, with their total count
+func (s *SQLiteStore) ListOrders(f HistoryFilter) ([]OrderRecord, int64, error) {
+	where, args := f.sqliteWhere(true)
+
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM orders`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	orders := []OrderRecord{}
+	rows, err := s.db.Query(`
+        SELECT id, symbol, side, type, price, quantity, filled, filled_price, created_at,
+            COALESCE(trace_id, ''), COALESCE(status, 'NEW'), COALESCE(filled_qty, 0), COALESCE(strategy, ''), COALESCE(run_id, ''),
+            COALESCE(parent_id, '')
+        FROM orders`+where+` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?
+    `, append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return orders, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o OrderRecord
+		if err := rows.Scan(&o.ID, &o.Symbol, &o.Side, &o.Type, &o.Price, &o.Quantity, &o.Filled, &o.FilledPrice, &o.Created, &o.TraceID, &o.Status, &o.FilledQty, &o.Strategy, &o.RunID, &o.ParentID); err != nil {
+			return nil, total, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, total, rows.Err()
+}
+
+// ListTrades returns the trades f matches newest first, with their total count
+func (s *SQLiteStore) ListTrades(f HistoryFilter) ([]TradeRecord, int64, error) {
+	where, args := f.sqliteWhere(false)
+
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM trades`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	trades := []TradeRecord{}
+	rows, err := s.db.Query(`
+        SELECT id, order_id, symbol, side, price, quantity, fee, created_at, COALESCE(run_id, '')
+        FROM trades`+where+` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?
+    `, append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return trades, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TradeRecord
+		if err := rows.Scan(&t.ID, &t.OrderID, &t.Symbol, &t.Side, &t.Price, &t.Quantity, &t.Fee, &t.Created, &t.RunID); err != nil {
+			return nil, total, err
+		}
+		trades = append(trades, t)
+	}
+	return trades, total, rows.Err()
+}
+
+// SignalRecord is a persisted signal of a signal-only strategy, the order
+// it would have submitted
+type SignalRecord struct {
+	ID       string    `json:"id"`
+	Strategy string    `json:"strategy"`
+	Symbol   string    `json:"symbol"`
+	Side     string    `json:"side"`
+	Price    float64   `json:"price"`
+	Quantity float64   `json:"quantity"`
+	Created  time.Time `json:"created_at"`
+	RunID    string    `json:"run_id,omitempty"`
+}
+
+// SaveSignal records a signal
+func (s *SQLiteStore) SaveSignal(r SignalRecord) error {
+	_, err := s.db.Exec(`
+        INSERT OR REPLACE INTO signals(id,strategy,symbol,side,price,quantity,created_at,run_id)
+        VALUES(?,?,?,?,?,?,?,?)
+    `, r.ID, r.Strategy, r.Symbol, r.Side, r.Price, r.Quantity, r.Created.UTC(), s.run())
+	return err
+}
+
+// ListSignals returns the signals f matches newest first, with their total count
+func (s *SQLiteStore) ListSignals(f HistoryFilter) ([]SignalRecord, int64, error) {
+	where, args := f.sqliteWhere(false)
+
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM signals`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	signals := []SignalRecord{}
+	rows, err := s.db.Query(`
+        SELECT id, strategy, symbol, side, price, quantity, created_at, COALESCE(run_id, '')
+        FROM signals`+where+` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?
+    `, append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return signals, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r SignalRecord
+		if err := rows.Scan(&r.ID, &r.Strategy, &r.Symbol, &r.Side, &r.Price, &r.Quantity, &r.Created, &r.RunID); err != nil {
+			return nil, total, err
+		}
+		signals = append(signals, r)
+	}
+	return signals, total, rows.Err()
+}
+
+// ParentOrderRecord is a persisted parent order, split or sliced into the
+// child orders that name it as their parent. Its fills add up theirs.
+type ParentOrderRecord struct {
+	ID            string    `json:"id"`
+	ClientOrderID string    `json:"client_order_id,omitempty"`
+	Strategy      string    `json:"strategy,omitempty"`
+	Symbol        string    `json:"symbol"`
+	Side          string    `json:"side"`
+	Type          string    `json:"type"`
+	Method        string    `json:"method"` // how it was worked: twap, vwap or split
+	Price         float64   `json:"price"`
+	Quantity      float64   `json:"quantity"`
+	FilledQty     float64   `json:"filled_qty"`
+	FilledPrice   float64   `json:"filled_price"` // average over the children's fills
+	Fee           float64   `json:"fee"`
+	Status        string    `json:"status"`
+	Created       time.Time `json:"created_at"`
+	Updated       time.Time `json:"updated_at"`
+	RunID         string    `json:"run_id,omitempty"`
+}
+
+// SetOrderParent records that order orderID is a child of parentID
+func (s *SQLiteStore) SetOrderParent(orderID, parentID string) error {
+	_, err := s.db.Exec(`UPDATE orders SET parent_id=? WHERE id=?`, parentID, orderID)
+	return err
+}
+
+// SetOrderExpiry records the time in force of order orderID and, for a GTT
+// order, when it expires
+func (s *SQLiteStore) SetOrderExpiry(orderID, timeInForce string, expireAt time.Time) error {
+	var at interface{}
+	if !expireAt.IsZero() {
+		at = expireAt.UTC()
+	}
+	_, err := s.db.Exec(`UPDATE orders SET time_in_force=?, expire_at=? WHERE id=?`, timeInForce, at, orderID)
+	return err
+}
+
+// SaveParentOrder stores r, replacing the state stored before
+func (s *SQLiteStore) SaveParentOrder(r ParentOrderRecord) error {
+	_, err := s.db.Exec(`
+        INSERT INTO parent_orders(id,client_order_id,strategy,symbol,side,type,method,price,quantity,filled_qty,filled_price,fee,status,created_at,updated_at,run_id)
+        VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+        ON CONFLICT(id) DO UPDATE SET filled_qty=excluded.filled_qty, filled_price=excluded.filled_price,
+            fee=excluded.fee, status=excluded.status, updated_at=excluded.updated_at
+    `, r.ID, r.ClientOrderID, r.Strategy, r.Symbol, r.Side, r.Type, r.Method, r.Price, r.Quantity,
+		r.FilledQty, r.FilledPrice, r.Fee, r.Status, r.Created.UTC(), r.Updated.UTC(), s.run())
+	return err
+}
+
+// ListParentOrders returns the parent orders f matches newest first, with their total count
+func (s *SQLiteStore) ListParentOrders(f HistoryFilter) ([]ParentOrderRecord, int64, error) {
+	f.Parent = ""
+	where, args := f.sqliteWhere(true)
+
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM parent_orders`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	parents := []ParentOrderRecord{}
+	rows, err := s.db.Query(`
+        SELECT id, COALESCE(client_order_id, ''), COALESCE(strategy, ''), symbol, side, type, method, price, quantity,
+            filled_qty, filled_price, fee, status, created_at, updated_at, COALESCE(run_id, '')
+        FROM parent_orders`+where+` ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?
+    `, append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return parents, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r ParentOrderRecord
+		if err := rows.Scan(&r.ID, &r.ClientOrderID, &r.Strategy, &r.Symbol, &r.Side, &r.Type, &r.Method, &r.Price, &r.Quantity,
+			&r.FilledQty, &r.FilledPrice, &r.Fee, &r.Status, &r.Created, &r.Updated, &r.RunID); err != nil {
+			return nil, total, err
+		}
+		parents = append(parents, r)
+	}
+	return parents, total, rows.Err()
+}
+
 // Save Order
 func (s *SQLiteStore) SaveOrder(id string,
 	symbol string,
@@ -142,43 +797,183 @@ func (s *SQLiteStore) SaveOrder(id string,
 	price float64,
 	filledPrice float64,
 	quantity float64,
+	filled bool,
+	traceID string,
+	strategy string,
 ) error {
-	_, err := s.db.Exec(`INSERT OR REPLACE INTO orders(id,symbol,side,type,price,quantity,filled,filled_price,created_at)
-VALUES(?,?,?,?,?,?,?,?,?)`,
-		id, symbol, side, orderType, price, quantity, true, filledPrice, time.Now())
+	status := "NEW"
+	if filled {
+		status = "FILLED"
+	}
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO orders(id,symbol,side,type,price,quantity,filled,filled_price,created_at,trace_id,status,strategy,run_id)
+VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		id, symbol, side, orderType, price, quantity, filled, filledPrice, time.Now(), traceID, status, strategy, s.run())
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// UpdateOrderStatus sets the lifecycle status of order id
+func (s *SQLiteStore) UpdateOrderStatus(id, status string) error {
+	_, err := s.db.Exec(`UPDATE orders SET status=? WHERE id=?`, status, id)
+	return err
+}
+
+// UpdateOrderFill records a status change of order id with its cumulative fill
+func (s *SQLiteStore) UpdateOrderFill(id, status string, filledQty, filledPrice float64) error {
+	_, err := s.db.Exec(`UPDATE orders SET status=?, filled=?, filled_qty=?, filled_price=? WHERE id=?`,
+		status, status == "FILLED", filledQty, filledPrice, id)
+	return err
+}
+
 func (s *SQLiteStore) SaveTrade(
 	id, orderID, symbol, side string,
-	price, quantity float64,
+	price, quantity, fee float64,
 ) error {
 	_, err := s.db.Exec(`
-        INSERT OR REPLACE INTO trades(id,order_id,symbol,side,price,quantity,created_at)
-        VALUES(?,?,?,?,?,?,datetime('now'))
-    `, id, orderID, symbol, side, price, quantity)
+        INSERT OR REPLACE INTO trades(id,order_id,symbol,side,price,quantity,fee,created_at,run_id)
+        VALUES(?,?,?,?,?,?,?,datetime('now'),?)
+    `, id, orderID, symbol, side, price, quantity, fee, s.run())
 	return err
 }
 
-func (s *SQLiteStore) SaveRunStart(id, strategy string) error {
+// SaveRunStart records the start of run r: its id, strategies, symbols,
+// start time and starting equity
+func (s *SQLiteStore) SaveRunStart(r RunRecord) error {
 	_, err := s.db.Exec(`
-        INSERT OR REPLACE INTO runs(id,strategy,started_at)
-        VALUES(?,?,datetime('now'))
-    `, id, strategy)
+        INSERT OR REPLACE INTO runs(id,strategy,symbols,started_at,start_equity)
+        VALUES(?,?,?,?,?)
+    `, r.ID, strings.Join(r.Strategies, ","), strings.Join(r.Symbols, ","), r.Started.UTC(), r.StartEquity)
 	return err
 }
 
-func (s *SQLiteStore) SaveRunStop(id string) error {
+// SaveRunStop records the stop of run r with its final PnL, equity and
+// drawdown, and counts the trades made during it
+func (s *SQLiteStore) SaveRunStop(r RunRecord) error {
+	stopped := time.Now().UTC()
+	if r.Stopped != nil {
+		stopped = r.Stopped.UTC()
+	}
 	_, err := s.db.Exec(`
-        UPDATE runs SET stopped_at=datetime('now')
+        UPDATE runs SET stopped_at=?, final_pnl=?, final_equity=?, max_drawdown=?,
+            trade_count=(SELECT COUNT(*) FROM trades WHERE run_id=?)
         WHERE id=?
-    `, id)
+    `, stopped, r.FinalPnL, r.FinalEquity, r.MaxDrawdown, r.ID, r.ID)
 	return err
 }
 
+// RunRecord is one live session of the engine, from Start to Stop. The
+// figures only known at the stop are nil while it runs, and for runs a
+// crash ended.
+type RunRecord struct {
+	ID          string     `json:"id"`
+	Strategies  []string   `json:"strategies"`
+	Symbols     []string   `json:"symbols"`
+	Started     time.Time  `json:"started_at"`
+	Stopped     *time.Time `json:"stopped_at,omitempty"`
+	StartEquity *float64   `json:"start_equity,omitempty"` // nil when the account could not be valued
+	FinalEquity *float64   `json:"final_equity,omitempty"`
+	FinalPnL    *float64   `json:"final_pnl,omitempty"`
+	MaxDrawdown *float64   `json:"max_drawdown,omitempty"` // largest peak to trough drop of equity as a fraction of the peak
+	Orders      int64      `json:"orders"`
+	Trades      int64      `json:"trades"`
+}
+
+// splitList splits a comma separated column, empty for none
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// scanRun reads a runs row of ListRuns
+func scanRun(rows *sql.Rows) (RunRecord, error) {
+	var r RunRecord
+	var strategies, symbols string
+	var stopped sql.NullTime
+	var startEq, finalEq, pnl, dd sql.NullFloat64
+	if err := rows.Scan(&r.ID, &strategies, &symbols, &r.Started, &stopped, &startEq, &finalEq, &pnl, &dd, &r.Orders, &r.Trades); err != nil {
+		return r, err
+	}
+	r.Strategies, r.Symbols = splitList(strategies), splitList(symbols)
+	if stopped.Valid {
+		r.Stopped = &stopped.Time
+	}
+	r.StartEquity, r.FinalEquity = nullFloat(startEq), nullFloat(finalEq)
+	r.FinalPnL, r.MaxDrawdown = nullFloat(pnl), nullFloat(dd)
+	return r, nil
+}
+
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+// ListRuns returns runs newest first, with their total count
+func (s *SQLiteStore) ListRuns(limit, offset int) ([]RunRecord, int64, error) {
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM runs`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	runs := []RunRecord{}
+	rows, err := s.db.Query(`
+        SELECT r.id, COALESCE(r.strategy, ''), COALESCE(r.symbols, ''), r.started_at, r.stopped_at,
+            r.start_equity, r.final_equity, r.final_pnl, r.max_drawdown,
+            (SELECT COUNT(*) FROM orders o WHERE o.run_id = r.id),
+            COALESCE(r.trade_count, (SELECT COUNT(*) FROM trades t WHERE t.run_id = r.id))
+        FROM runs r ORDER BY r.started_at DESC, r.id DESC LIMIT ? OFFSET ?
+    `, limit, offset)
+	if err != nil {
+		return runs, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return nil, total, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, total, rows.Err()
+}
+
+// StopOpenRuns marks the runs that never recorded a stop, such as those of
+// a crashed process, stopped now and returns their ids
+func (s *SQLiteStore) StopOpenRuns() ([]string, error) {
+	ids := []string{}
+	rows, err := s.db.Query(`SELECT id FROM runs WHERE stopped_at IS NULL`)
+	if err != nil {
+		return ids, err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if _, err := s.db.Exec(`
+            UPDATE runs SET stopped_at=?, trade_count=(SELECT COUNT(*) FROM trades WHERE run_id=?)
+            WHERE id=?
+        `, time.Now().UTC(), id, id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
 func (s *SQLiteStore) PnL(symbol string) (float64, error) {
 	rows, err := s.db.Query(`
         SELECT side, price, quantity FROM trades WHERE symbol=?
@@ -210,9 +1005,10 @@ func (s *SQLiteStore) PnL(symbol string) (float64, error) {
 	return pnl, nil
 }
 
+// SaveRun records a whole run at once
 func (s *SQLiteStore) SaveRun(id string, start, end time.Time, final float64) error {
 	const q = `
-        INSERT INTO runs (id, start_time, end_time, final_pnl)
+        INSERT OR REPLACE INTO runs (id, started_at, stopped_at, final_pnl)
         VALUES (?, ?, ?, ?)
     `
 
@@ -222,3 +1018,506 @@ func (s *SQLiteStore) SaveRun(id string, start, end time.Time, final float64) er
 	}
 	return nil
 }
+
+// AuditEntry is a single control-plane action
+type AuditEntry struct {
+	ID      int64     `json:"id"`
+	Actor   string    `json:"actor"`
+	Action  string    `json:"action"`
+	Payload string    `json:"payload"`
+	Created time.Time `json:"created_at"`
+}
+
+// SaveAudit records a control-plane action
+func (s *SQLiteStore) SaveAudit(actor, action, payload string) error {
+	_, err := s.db.Exec(`
+        INSERT INTO audit_log(actor,action,payload,created_at)
+        VALUES(?,?,?,?)
+    `, actor, action, payload, time.Now().UTC())
+	return err
+}
+
+// LoadAudit returns the most recent audit entries, newest first
+func (s *SQLiteStore) LoadAudit(limit int) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	rows, err := s.db.Query(`
+        SELECT id, actor, action, payload, created_at FROM audit_log
+        ORDER BY id DESC LIMIT ?
+    `, limit)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Payload, &e.Created); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// BacktestRecord is the summary row of a stored backtest
+type BacktestRecord struct {
+	ID          string    `json:"id"`
+	Strategy    string    `json:"strategy"`
+	Symbol      string    `json:"symbol"`
+	Started     time.Time `json:"started_at"`
+	Finished    time.Time `json:"finished_at"`
+	FinalEquity float64   `json:"final_equity"`
+	Created     time.Time `json:"created_at"`
+}
+
+// backtestSortColumns whitelists the columns backtests can be ordered by
+var backtestSortColumns = map[string]string{
+	"created_at":   "created_at",
+	"final_equity": "final_equity",
+	"strategy":     "strategy",
+	"symbol":       "symbol",
+}
+
+// BacktestSortable reports whether backtests can be sorted by metric
+func BacktestSortable(metric string) bool {
+	_, ok := backtestSortColumns[metric]
+	return ok
+}
+
+// SaveBacktest stores a finished backtest with its full stats as JSON
+func (s *SQLiteStore) SaveBacktest(rec BacktestRecord, stats []byte) error {
+	_, err := s.db.Exec(`
+        INSERT OR REPLACE INTO backtests(id,strategy,symbol,started_at,finished_at,final_equity,stats,created_at)
+        VALUES(?,?,?,?,?,?,?,?)
+    `, rec.ID, rec.Strategy, rec.Symbol, rec.Started.UTC(), rec.Finished.UTC(), rec.FinalEquity, string(stats), time.Now().UTC())
+	return err
+}
+
+// ListBacktests pages through stored backtests ordered by sortBy.
+// It returns the page and the total number of backtests.
+func (s *SQLiteStore) ListBacktests(sortBy string, desc bool, limit, offset int) ([]BacktestRecord, int64, error) {
+	col, ok := backtestSortColumns[sortBy]
+	if !ok {
+		return nil, 0, fmt.Errorf("cannot sort backtests by %q", sortBy)
+	}
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+
+	var total int64
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM backtests`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	records := []BacktestRecord{}
+	rows, err := s.db.Query(fmt.Sprintf(`
+        SELECT id, strategy, symbol, started_at, finished_at, final_equity, created_at
+        FROM backtests ORDER BY %s %s, id %s LIMIT ? OFFSET ?
+    `, col, dir, dir), limit, offset)
+	if err != nil {
+		return records, total, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r BacktestRecord
+		if err := rows.Scan(&r.ID, &r.Strategy, &r.Symbol, &r.Started, &r.Finished, &r.FinalEquity, &r.Created); err != nil {
+			return nil, total, err
+		}
+		records = append(records, r)
+	}
+	return records, total, rows.Err()
+}
+
+// LoadBacktestStats returns the stored stats JSON of backtest id, or sql.ErrNoRows
+func (s *SQLiteStore) LoadBacktestStats(id string) ([]byte, error) {
+	var stats string
+	err := s.db.QueryRow(`SELECT stats FROM backtests WHERE id=?`, id).Scan(&stats)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(stats), nil
+}
+
+// BacktestTrade is one closed round trip of a stored backtest
+type BacktestTrade struct {
+	Strategy   string    `json:"strategy"`
+	Side       string    `json:"side"` // of the position, BUY for a long and SELL for a short
+	EntryTime  time.Time `json:"entry_time"`
+	ExitTime   time.Time `json:"exit_time"`
+	EntryPrice float64   `json:"entry_price"`
+	ExitPrice  float64   `json:"exit_price"`
+	Quantity   float64   `json:"quantity"`
+	PnL        float64   `json:"pnl"`
+	Holding    float64   `json:"holding_sec"`
+}
+
+// SaveBacktestTrades replaces the trade log of backtest id
+func (s *SQLiteStore) SaveBacktestTrades(id string, trades []BacktestTrade) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM backtest_trades WHERE backtest_id=?`, id); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+        INSERT INTO backtest_trades(backtest_id,seq,strategy,side,entry_time,exit_time,entry_price,exit_price,quantity,pnl,holding_sec)
+        VALUES(?,?,?,?,?,?,?,?,?,?,?)
+    `)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, t := range trades {
+		if _, err := stmt.Exec(id, i, t.Strategy, t.Side, t.EntryTime.UTC(), t.ExitTime.UTC(),
+			t.EntryPrice, t.ExitPrice, t.Quantity, t.PnL, t.Holding); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadBacktestTrades returns the trade log of backtest id in the order the trades closed
+func (s *SQLiteStore) LoadBacktestTrades(id string) ([]BacktestTrade, error) {
+	trades := []BacktestTrade{}
+	rows, err := s.db.Query(`
+        SELECT strategy, side, entry_time, exit_time, entry_price, exit_price, quantity, pnl, holding_sec
+        FROM backtest_trades WHERE backtest_id=? ORDER BY seq ASC
+    `, id)
+	if err != nil {
+		return trades, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t BacktestTrade
+		if err := rows.Scan(&t.Strategy, &t.Side, &t.EntryTime, &t.ExitTime, &t.EntryPrice, &t.ExitPrice, &t.Quantity, &t.PnL, &t.Holding); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+	return trades, rows.Err()
+}
+
+// SaveSnapshot stores a serialized engine snapshot
+func (s *SQLiteStore) SaveSnapshot(id string, data []byte) error {
+	_, err := s.db.Exec(`
+        INSERT OR REPLACE INTO snapshots(id,data,created_at)
+        VALUES(?,?,?)
+    `, id, string(data), time.Now().UTC())
+	return err
+}
+
+// LoadSnapshot returns snapshot id, or the newest one when id is "" or "latest"
+func (s *SQLiteStore) LoadSnapshot(id string) ([]byte, error) {
+	var data string
+	var err error
+	if id == "" || id == "latest" {
+		err = s.db.QueryRow(`SELECT data FROM snapshots ORDER BY created_at DESC LIMIT 1`).Scan(&data)
+	} else {
+		err = s.db.QueryRow(`SELECT data FROM snapshots WHERE id=?`, id).Scan(&data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(data), nil
+}
+
+// StrategyState is the internal state a strategy saved last
+type StrategyState struct {
+	Name  string    `json:"name"`
+	State []byte    `json:"state"`
+	Saved time.Time `json:"saved_at"`
+}
+
+// SaveStrategyState replaces the saved state of strategy name
+func (s *SQLiteStore) SaveStrategyState(name string, state []byte, at time.Time) error {
+	_, err := s.db.Exec(`
+        INSERT OR REPLACE INTO strategy_state(name,state,saved_at)
+        VALUES(?,?,?)
+    `, name, string(state), at.UTC())
+	return err
+}
+
+// LoadStrategyStates returns the saved state of every strategy
+func (s *SQLiteStore) LoadStrategyStates() ([]StrategyState, error) {
+	states := []StrategyState{}
+	rows, err := s.db.Query(`SELECT name, state, saved_at FROM strategy_state ORDER BY name ASC`)
+	if err != nil {
+		return states, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var st StrategyState
+		var data string
+		if err := rows.Scan(&st.Name, &data, &st.Saved); err != nil {
+			return nil, err
+		}
+		st.State = []byte(data)
+		states = append(states, st)
+	}
+	return states, rows.Err()
+}
+
+// HeldOrder is an order the engine holds back from the exchange, such as
+// one queued for the market open, stored so a restart does not drop it
+type HeldOrder struct {
+	Kind    string    `json:"kind"`
+	ID      string    `json:"id"`
+	Payload []byte    `json:"payload"`
+	Saved   time.Time `json:"saved_at"`
+}
+
+// SaveHeldOrder replaces the held order id of kind
+func (s *SQLiteStore) SaveHeldOrder(kind, id string, payload []byte, at time.Time) error {
+	_, err := s.db.Exec(`
+        INSERT OR REPLACE INTO held_orders(kind,id,payload,saved_at)
+        VALUES(?,?,?,?)
+    `, kind, id, string(payload), at.UTC())
+	return err
+}
+
+// DeleteHeldOrder forgets the held order id of kind
+func (s *SQLiteStore) DeleteHeldOrder(kind, id string) error {
+	_, err := s.db.Exec(`DELETE FROM held_orders WHERE kind=? AND id=?`, kind, id)
+	return err
+}
+
+// LoadHeldOrders returns the held orders of kind, oldest first
+func (s *SQLiteStore) LoadHeldOrders(kind string) ([]HeldOrder, error) {
+	held := []HeldOrder{}
+	rows, err := s.db.Query(`SELECT kind, id, payload, saved_at FROM held_orders WHERE kind=? ORDER BY saved_at ASC, id ASC`, kind)
+	if err != nil {
+		return held, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h HeldOrder
+		var data string
+		if err := rows.Scan(&h.Kind, &h.ID, &data, &h.Saved); err != nil {
+			return nil, err
+		}
+		h.Payload = []byte(data)
+		held = append(held, h)
+	}
+	return held, rows.Err()
+}
+
+// SessionEvent is one recorded candle or order of a live session
+type SessionEvent struct {
+	ID         int64           `json:"id"`
+	SessionID  string          `json:"session_id"`
+	Kind       string          `json:"kind"`
+	Source     string          `json:"source"`
+	Symbol     string          `json:"symbol"`
+	RecordedAt time.Time       `json:"recorded_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// SessionSummary describes a recorded session
+type SessionSummary struct {
+	ID      string    `json:"id"`
+	Started time.Time `json:"started_at"`
+	Ended   time.Time `json:"ended_at"`
+	Events  int64     `json:"events"`
+}
+
+// SaveSessionEvent appends an event to a recorded session
+func (s *SQLiteStore) SaveSessionEvent(sessionID, kind, source, symbol string, at time.Time, payload []byte) error {
+	_, err := s.db.Exec(`
+        INSERT INTO session_events(session_id,kind,source,symbol,recorded_at,payload)
+        VALUES(?,?,?,?,?,?)
+    `, sessionID, kind, source, symbol, at.UTC(), string(payload))
+	return err
+}
+
+// LoadSessionEvents returns events of a session in recording order.
+// Empty kind or symbol match everything; zero from/to leave the window open.
+func (s *SQLiteStore) LoadSessionEvents(sessionID, kind, symbol string, from, to time.Time) ([]SessionEvent, error) {
+	q := `SELECT id, session_id, kind, source, symbol, recorded_at, payload FROM session_events WHERE session_id=?`
+	args := []interface{}{sessionID}
+	if kind != "" {
+		q += ` AND kind=?`
+		args = append(args, kind)
+	}
+	if symbol != "" {
+		q += ` AND symbol=?`
+		args = append(args, symbol)
+	}
+	if !from.IsZero() {
+		q += ` AND datetime(recorded_at) >= datetime(?)`
+		args = append(args, from.UTC().Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		q += ` AND datetime(recorded_at) <= datetime(?)`
+		args = append(args, to.UTC().Format(time.RFC3339))
+	}
+	q += ` ORDER BY id ASC`
+
+	events := []SessionEvent{}
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return events, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e SessionEvent
+		var payload string
+		if err := rows.Scan(&e.ID, &e.SessionID, &e.Kind, &e.Source, &e.Symbol, &e.RecordedAt, &payload); err != nil {
+			return nil, err
+		}
+		e.Payload = json.RawMessage(payload)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ListSessions returns recorded sessions, newest first
+func (s *SQLiteStore) ListSessions(limit int) ([]SessionSummary, error) {
+	sessions := []SessionSummary{}
+	rows, err := s.db.Query(`
+        SELECT session_id, MIN(recorded_at), MAX(recorded_at), COUNT(*) FROM session_events
+        GROUP BY session_id ORDER BY MIN(id) DESC LIMIT ?
+    `, limit)
+	if err != nil {
+		return sessions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ss SessionSummary
+		var started, ended string
+		if err := rows.Scan(&ss.ID, &started, &ended, &ss.Events); err != nil {
+			return nil, err
+		}
+		ss.Started = parseDBTime(started)
+		ss.Ended = parseDBTime(ended)
+		sessions = append(sessions, ss)
+	}
+	return sessions, rows.Err()
+}
+
+// LatestSessionID returns the most recently recorded session
+func (s *SQLiteStore) LatestSessionID() (string, error) {
+	var id string
+	err := s.db.QueryRow(`SELECT session_id FROM session_events ORDER BY id DESC LIMIT 1`).Scan(&id)
+	return id, err
+}
+
+// parseDBTime parses times the sqlite driver wrote, for aggregates it returns as text
+func parseDBTime(v string) time.Time {
+	for _, layout := range []string{
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02T15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05Z07:00",
+		"2006-01-02 15:04:05",
+	} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Compact applies retention policy p as of now: candle roll ups and the
+// deletes of each kind of data run in one transaction. Trades and candles
+// newer than the latest snapshot are kept for Recover, and no trade is
+// deleted before there is one. SQLite reuses the pages freed, so the file
+// stops growing rather than shrinking.
+func (s *SQLiteStore) Compact(p RetentionPolicy, now time.Time) (CompactReport, error) {
+	var rep CompactReport
+	if p.Empty() {
+		return rep, nil
+	}
+	s.flushCandles()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return rep, err
+	}
+	defer tx.Rollback()
+
+	exec := func(n *int64, q string, args ...any) error {
+		res, err := tx.Exec(q, args...)
+		if err != nil {
+			return err
+		}
+		affected, _ := res.RowsAffected()
+		*n += affected
+		return nil
+	}
+	var snapAt sql.NullString
+	if err := tx.QueryRow(`SELECT MAX(created_at) FROM snapshots`).Scan(&snapAt); err != nil {
+		return rep, err
+	}
+	snap := parseDBTime(snapAt.String)
+	for _, rule := range p.candleRules() {
+		cut := recoveryCutoff(rollUpCutoff(now, rule.Keep, rule.RollUp), snap, rule.RollUp).Format(time.RFC3339)
+		if rule.RollUp > 0 {
+			symbols, err := queryStrings(tx, `SELECT DISTINCT symbol FROM candles WHERE interval_sec=? AND datetime(time) < datetime(?)`, rule.Interval, cut)
+			if err != nil {
+				return rep, err
+			}
+			for _, symbol := range symbols {
+				rows, err := tx.Query(`
+                    SELECT time,open,high,low,close,volume FROM candles
+                    WHERE symbol=? AND interval_sec=? AND datetime(time) < datetime(?)
+                    ORDER BY datetime(time) ASC
+                `, symbol, rule.Interval, cut)
+				if err != nil {
+					return rep, err
+				}
+				old, err := scanStoredCandles(rows)
+				if err != nil {
+					return rep, err
+				}
+				for _, c := range rollUp(symbol, rule.RollUp, old) {
+					if err := exec(&rep.RolledUp, `INSERT OR IGNORE INTO candles(id,symbol,interval_sec,time,open,high,low,close,volume,rolled_up) VALUES(?,?,?,?,?,?,?,?,?,1)`,
+						c.id, c.symbol, c.interval, c.time, c.open, c.high, c.low, c.close, c.volume); err != nil {
+						return rep, err
+					}
+				}
+			}
+		}
+		if err := exec(&rep.Candles, `DELETE FROM candles WHERE interval_sec=? AND datetime(time) < datetime(?)`, rule.Interval, cut); err != nil {
+			return rep, err
+		}
+	}
+	if p.Trades > 0 && !snap.IsZero() {
+		cut := recoveryCutoff(now.Add(-p.Trades).UTC(), snap, 0).Format(time.RFC3339)
+		if err := exec(&rep.Trades, `DELETE FROM trades WHERE datetime(created_at) < datetime(?)`, cut); err != nil {
+			return rep, err
+		}
+		if err := exec(&rep.Orders, `
+            DELETE FROM orders WHERE datetime(created_at) < datetime(?)
+            AND (filled=1 OR COALESCE(status, 'NEW') IN ('FILLED', 'CANCELED', 'REJECTED'))
+        `, cut); err != nil {
+			return rep, err
+		}
+		if err := exec(&rep.Orders, `
+            DELETE FROM parent_orders WHERE datetime(created_at) < datetime(?)
+            AND status IN ('FILLED', 'CANCELED', 'REJECTED')
+        `, cut); err != nil {
+			return rep, err
+		}
+	}
+	if p.SessionEvents > 0 {
+		cut := now.Add(-p.SessionEvents).UTC().Format(time.RFC3339)
+		if err := exec(&rep.SessionEvents, `DELETE FROM session_events WHERE datetime(recorded_at) < datetime(?)`, cut); err != nil {
+			return rep, err
+		}
+	}
+	if p.Equity > 0 {
+		cut := now.Add(-p.Equity).UTC().Format(time.RFC3339)
+		if err := exec(&rep.Equity, `DELETE FROM equity WHERE datetime(recorded_at) < datetime(?)`, cut); err != nil {
+			return rep, err
+		}
+	}
+	return rep, tx.Commit()
+}
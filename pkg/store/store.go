@@ -0,0 +1,101 @@
+package store
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Store is the persistence the engine, order manager, exchange adapters and
+// API depend on. SQLiteStore is the default implementation, PostgresStore
+// lets several instances share one database.
+type Store interface {
+	Close() error
+
+	// orders, trades and signals
+	SaveOrder(id, symbol, side, orderType string, price, filledPrice, quantity float64, filled bool, traceID, strategy string) error
+	UpdateOrderStatus(id, status string) error
+	UpdateOrderFill(id, status string, filledQty, filledPrice float64) error
+	SaveTrade(id, orderID, symbol, side string, price, quantity, fee float64) error
+	LoadOpenOrders(symbol string, asOf time.Time) ([]OrderRecord, error)
+	LoadTradesBetween(symbol string, from, to time.Time) ([]TradeRecord, error)
+	LoadTradesSince(from time.Time) ([]TradeRecord, error)
+	ListOrders(f HistoryFilter) ([]OrderRecord, int64, error)
+	ListTrades(f HistoryFilter) ([]TradeRecord, int64, error)
+	CountOrders() (int64, error)
+	CountTrades() (int64, error)
+	PnL(symbol string) (float64, error)
+	SaveTradeResult(strategy, symbol string, pnl float64, closedAt time.Time) error
+	LoadTradeResults(strategy string, limit int) ([]TradeResult, error)
+	SaveIdempotencyKey(clientOrderID, orderID string, expiresAt time.Time) error
+	DeleteIdempotencyKey(clientOrderID string) error
+	LoadIdempotencyKeys(asOf time.Time) ([]IdempotencyKey, error)
+	SetOrderParent(orderID, parentID string) error
+	SetOrderExpiry(orderID, timeInForce string, expireAt time.Time) error
+	SaveParentOrder(r ParentOrderRecord) error
+	ListParentOrders(f HistoryFilter) ([]ParentOrderRecord, int64, error)
+	SaveSignal(r SignalRecord) error
+	ListSignals(f HistoryFilter) ([]SignalRecord, int64, error)
+	SaveEquity(e EquityRecord) error
+	LoadEquity(from, to time.Time) ([]EquityRecord, error)
+
+	// market data
+	SaveCandle(symbol string, interval int64, cTime string, open, high, low, close, volume float64) error
+	LoadCandles(symbol string, interval int64, limit int) ([]map[string]interface{}, error)
+	LoadCandlesBetween(symbol string, interval int64, from, to time.Time) ([]map[string]interface{}, error)
+	LoadCandleHistory(symbol string, interval int64, from, to time.Time) ([]map[string]interface{}, error)
+	LoadRecentCandles(symbol string, interval int64, limit int) ([]map[string]interface{}, error)
+
+	// runs and backtests. SetRun tags the orders, trades and candles saved
+	// from then on with run id, "" for none.
+	SetRun(id string)
+	SaveRunStart(r RunRecord) error
+	SaveRunStop(r RunRecord) error
+	StopOpenRuns() ([]string, error)
+	SaveRun(id string, start, end time.Time, final float64) error
+	CountRuns() (int64, error)
+	ListRuns(limit, offset int) ([]RunRecord, int64, error)
+	SaveBacktest(rec BacktestRecord, stats []byte) error
+	ListBacktests(sortBy string, desc bool, limit, offset int) ([]BacktestRecord, int64, error)
+	LoadBacktestStats(id string) ([]byte, error)
+	SaveBacktestTrades(id string, trades []BacktestTrade) error
+	LoadBacktestTrades(id string) ([]BacktestTrade, error)
+
+	// audit log
+	SaveAudit(actor, action, payload string) error
+	LoadAudit(limit int) ([]AuditEntry, error)
+
+	// snapshots, strategy state and recorded sessions
+	SaveSnapshot(id string, data []byte) error
+	LoadSnapshot(id string) ([]byte, error)
+	SaveStrategyState(name string, state []byte, at time.Time) error
+	LoadStrategyStates() ([]StrategyState, error)
+	SaveHeldOrder(kind, id string, payload []byte, at time.Time) error
+	DeleteHeldOrder(kind, id string) error
+	LoadHeldOrders(kind string) ([]HeldOrder, error)
+	SaveSessionEvent(sessionID, kind, source, symbol string, at time.Time, payload []byte) error
+	LoadSessionEvents(sessionID, kind, symbol string, from, to time.Time) ([]SessionEvent, error)
+	ListSessions(limit int) ([]SessionSummary, error)
+	LatestSessionID() (string, error)
+
+	// retention
+	Compact(p RetentionPolicy, now time.Time) (CompactReport, error)
+}
+
+var (
+	_ Store    = (*SQLiteStore)(nil)
+	_ Migrator = (*SQLiteStore)(nil)
+	_ Migrator = (*PostgresStore)(nil)
+)
+
+// runTag holds the run stores tag new rows with
+type runTag struct {
+	id atomic.Value
+}
+
+// SetRun tags the orders, trades and candles saved from now on with run id
+func (t *runTag) SetRun(id string) { t.id.Store(id) }
+
+func (t *runTag) run() string {
+	id, _ := t.id.Load().(string)
+	return id
+}
@@ -0,0 +1,54 @@
+package strategy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/shopspring/decimal"
+)
+
+// nopExecutor accepts every order without doing anything
+type nopExecutor struct{}
+
+func (nopExecutor) Submit(ctx context.Context, o engine.Order) (engine.Order, error) { return o, nil }
+
+// zeroRisk never sizes an order so the benchmarks measure indicator updates only
+type zeroRisk struct{}
+
+func (zeroRisk) Size(strategy, symbol string, price, balance decimal.Decimal) decimal.Decimal {
+	return decimal.Zero
+}
+
+func (zeroRisk) Observe(symbol string, c engine.Candle) {}
+
+func benchCandles(n int) []engine.Candle {
+	out := make([]engine.Candle, n)
+	p := 30000.0
+	for i := range out {
+		p *= 1 + (0.0005 - 0.0002*float64(i%3))
+		out[i] = engine.Candle{Time: time.Unix(int64(i)*60, 0), Open: p, High: p, Low: p, Close: p, Volume: 1}
+	}
+	return out
+}
+
+func BenchmarkEMACrossoverOnCandle(b *testing.B) {
+	s := NewEMACrossover("BTCUSD", 9, 21, nopExecutor{}, zeroRisk{})
+	candles := benchCandles(4096)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.OnCandle(candles[i%len(candles)])
+	}
+}
+
+func BenchmarkMeanReversionOnCandle(b *testing.B) {
+	s := NewMeanReversion("BTCUSD", 20, 2.0, nopExecutor{}, zeroRisk{})
+	candles := benchCandles(4096)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.OnCandle(candles[i%len(candles)])
+	}
+}
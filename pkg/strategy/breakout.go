@@ -0,0 +1,340 @@
+package strategy
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"sync"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/indicators"
+	"github.com/shopspring/decimal"
+)
+
+const ST_NAME_BREAKOUT = "Breakout"
+
+// Breakout follows trends out of a Donchian channel: it buys a close above
+// the highest high of the last window candles, or sells one below their
+// lowest low when it may short, and rides the move behind a trailing stop
+// atrMult average true ranges from the best close since entry.
+type Breakout struct {
+	window     int
+	atrPeriod  int
+	atrMult    float64
+	highs      *indicators.Ring[float64] // highs of the last window candles, the current one excluded
+	lows       *indicators.Ring[float64]
+	ranges     *indicators.Ring[float64] // true ranges of the last atrPeriod candles
+	prevClose  float64
+	dir        int             // 1 long, -1 short, 0 flat
+	stop       float64         // trailing stop of the open trade
+	qty        decimal.Decimal // entered by the open trade, what its exit closes without a position reader
+	last       *lastSignal
+	exec       engine.OrderExecutor
+	risk       engine.RiskManager
+	positions  engine.PositionReader
+	longOnly   bool // breakouts below the channel are not traded
+	signalOnly bool // exec records signals instead of submitting orders
+	accountUSD decimal.Decimal
+	symbol     string
+	interval   int64 // candle size in seconds
+	lock       sync.Mutex
+	name       string
+}
+
+func NewBreakout(symbol string, window, atrPeriod int, atrMult float64, exec engine.OrderExecutor, risk engine.RiskManager) engine.Strategy {
+	return &Breakout{
+		window:    window,
+		atrPeriod: atrPeriod,
+		atrMult:   atrMult,
+		highs:     indicators.NewRing[float64](window),
+		lows:      indicators.NewRing[float64](window),
+		ranges:    indicators.NewRing[float64](atrPeriod),
+		exec:      exec,
+		risk:      risk,
+		symbol:    symbol,
+		interval:  engine.DefaultCandleInterval,
+		name:      ST_NAME_BREAKOUT,
+		longOnly:  true,
+	}
+}
+
+func (b *Breakout) Name() string    { return b.name }
+func (b *Breakout) Symbol() string  { return b.symbol }
+func (b *Breakout) Type() string    { return TypeBreakout }
+func (b *Breakout) Interval() int64 { return b.interval }
+func (b *Breakout) OnStart()        { log.Println("Started Breakout Strategy") }
+func (b *Breakout) OnStop()         { log.Println("Stopped Breakout Strategy") }
+
+// SetPositionReader lets exits close the position actually held
+func (b *Breakout) SetPositionReader(r engine.PositionReader) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.positions = r
+}
+
+// SetInterval sets the candle size in seconds the strategy trades on, it
+// takes effect when the strategy is registered
+func (b *Breakout) SetInterval(seconds int64) {
+	b.interval = seconds
+}
+
+// SetLongOnly sets whether breakouts below the channel open a short,
+// strategies start long-only
+func (b *Breakout) SetLongOnly(v bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.longOnly = v
+}
+
+// SetSignalOnly marks the strategy as signal-only, reading the paper
+// positions of its signals. It takes effect when the strategy is registered.
+func (b *Breakout) SetSignalOnly(v bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.signalOnly = v
+}
+
+// SignalOnly implements engine.SignalOnlyStrategy
+func (b *Breakout) SignalOnly() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.signalOnly
+}
+
+// OnOrderUpdate logs the lifecycle of orders the strategy submitted
+func (b *Breakout) OnOrderUpdate(o engine.Order) {
+	log.Printf("%s order %s %s %s: %s (filled %s/%s, %s remaining)", b.name, o.ID, o.Side, o.Symbol, o.Status, o.FilledQty, o.Quantity, o.Remaining())
+}
+
+// channel returns the highest high and lowest low of the window
+func channel(highs, lows *indicators.Ring[float64]) (float64, float64) {
+	upper, lower := math.Inf(-1), math.Inf(1)
+	for i := 0; i < highs.Len(); i++ {
+		upper = max(upper, highs.At(i))
+		lower = min(lower, lows.At(i))
+	}
+	return upper, lower
+}
+
+// observe adds c to the channel and the true ranges. Callers must hold b.lock.
+func (b *Breakout) observe(c engine.Candle) {
+	tr := c.High - c.Low
+	if b.prevClose > 0 {
+		tr = max(tr, math.Abs(c.High-b.prevClose), math.Abs(c.Low-b.prevClose))
+	}
+	b.ranges.Push(tr)
+	b.highs.Push(c.High)
+	b.lows.Push(c.Low)
+	b.prevClose = c.Close
+}
+
+// atr is the average true range of the last atrPeriod candles. Callers must hold b.lock.
+func (b *Breakout) atr() float64 {
+	if b.ranges.Len() == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < b.ranges.Len(); i++ {
+		sum += b.ranges.At(i)
+	}
+	return sum / float64(b.ranges.Len())
+}
+
+func (b *Breakout) OnCandle(c engine.Candle) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.risk.Observe(b.symbol, c)
+	// the channel is the candles before c, so c's own high cannot hold it
+	ready := b.highs.Len() >= b.window && b.ranges.Len() >= b.atrPeriod
+	upper, lower := channel(b.highs, b.lows)
+	b.observe(c)
+	if !ready {
+		return
+	}
+	atr := b.atr()
+
+	switch {
+	case b.dir > 0 && c.Close <= b.stop:
+		b.trade(engine.SideSell, c)
+	case b.dir < 0 && c.Close >= b.stop:
+		b.trade(engine.SideBuy, c)
+	case b.dir > 0:
+		b.stop = max(b.stop, c.Close-b.atrMult*atr)
+	case b.dir < 0:
+		b.stop = min(b.stop, c.Close+b.atrMult*atr)
+	case c.Close > upper:
+		if b.trade(engine.SideBuy, c) {
+			b.dir, b.stop = 1, c.Close-b.atrMult*atr
+		}
+	case c.Close < lower && !b.longOnly:
+		if b.trade(engine.SideSell, c) {
+			b.dir, b.stop = -1, c.Close+b.atrMult*atr
+		}
+	}
+}
+
+// trade submits a market order on side at the close of c, entering from
+// flat or exiting the open trade, and reports whether it was submitted.
+// Callers must hold b.lock.
+func (b *Breakout) trade(side engine.Side, c engine.Candle) bool {
+	exit := b.dir != 0
+	b.last = &lastSignal{Side: side, Price: c.Close, Time: c.Time}
+	ctx, span := startSignal(b.name, b.symbol, side, c.Close)
+	defer span.End()
+	var qty decimal.Decimal
+	switch {
+	case exit && b.positions != nil:
+		// an exit only closes what is held, a stop or the kill switch may
+		// have closed it already
+		held := b.positions.Position(b.name, b.symbol).Quantity
+		if held.IsPositive() == (side == engine.SideSell) {
+			qty = held.Abs()
+		}
+	case exit:
+		qty = b.qty
+	default:
+		qty = tradeQty(ctx, b.risk, b.positions, b.longOnly, side, b.name, b.symbol, decimal.NewFromFloat(c.Close), b.accountUSD)
+	}
+	if !qty.IsPositive() {
+		if exit {
+			// the trade is over when there is nothing left to close
+			b.dir, b.stop, b.qty = 0, 0, decimal.Zero
+		}
+		return false
+	}
+	o := engine.Order{Symbol: b.symbol, Side: side, Type: engine.OrderMarket, Quantity: qty, Strategy: b.name}
+	if _, err := b.exec.Submit(ctx, o); err != nil {
+		// an exit keeps its stop armed, the next candle past it tries again
+		log.Printf("Breakout %s err: %v", side, err)
+		return false
+	}
+	if exit {
+		b.dir, b.stop, b.qty = 0, 0, decimal.Zero
+	} else {
+		b.qty = qty
+	}
+	log.Printf("Breakout %s executed %s", side, qty)
+	return true
+}
+
+// WarmUpCandles is the channel and the true ranges before the next candle
+func (b *Breakout) WarmUpCandles() int { return max(b.window, b.atrPeriod+1) }
+
+// WarmUp fills the channel and true ranges from candles without trading
+func (b *Breakout) WarmUp(candles []engine.Candle) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, c := range candles {
+		b.risk.Observe(b.symbol, c)
+		b.observe(c)
+	}
+}
+
+// Params implements Tunable
+func (b *Breakout) Params() json.RawMessage {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	raw, _ := json.Marshal(breakoutParams{Window: b.window, ATRPeriod: b.atrPeriod, ATRMult: b.atrMult})
+	return raw
+}
+
+// SetParams implements Tunable. New periods keep the newest candles that
+// fit in them, the stop of an open trade trails at the new multiple from
+// the next candle.
+func (b *Breakout) SetParams(raw json.RawMessage) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	p := breakoutParams{Window: b.window, ATRPeriod: b.atrPeriod, ATRMult: b.atrMult}
+	if err := decodeParams(raw, &p); err != nil {
+		return err
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+	if p.Window != b.window {
+		b.highs, b.lows = resizeRing(b.highs, p.Window), resizeRing(b.lows, p.Window)
+		b.window = p.Window
+	}
+	if p.ATRPeriod != b.atrPeriod {
+		b.ranges = resizeRing(b.ranges, p.ATRPeriod)
+		b.atrPeriod = p.ATRPeriod
+	}
+	b.atrMult = p.ATRMult
+	log.Printf("%s params set to window %d, atr period %d, atr mult %g", b.name, b.window, b.atrPeriod, b.atrMult)
+	return nil
+}
+
+type breakoutState struct {
+	Highs      []float64       `json:"highs"`
+	Lows       []float64       `json:"lows"`
+	Ranges     []float64       `json:"ranges"`
+	PrevClose  float64         `json:"prev_close"`
+	Dir        int             `json:"dir,omitempty"`
+	Stop       float64         `json:"stop,omitempty"`
+	Qty        decimal.Decimal `json:"qty"`
+	AccountUSD decimal.Decimal `json:"account_usd"`
+	LastSignal *lastSignal     `json:"last_signal,omitempty"`
+}
+
+// SaveState serializes the channel, true ranges, open trade with its stop
+// and quantity, last signal and allocated capital
+func (b *Breakout) SaveState() ([]byte, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return json.Marshal(breakoutState{
+		Highs:      b.highs.Values(nil),
+		Lows:       b.lows.Values(nil),
+		Ranges:     b.ranges.Values(nil),
+		PrevClose:  b.prevClose,
+		Dir:        b.dir,
+		Stop:       b.stop,
+		Qty:        b.qty,
+		AccountUSD: b.accountUSD,
+		LastSignal: b.last,
+	})
+}
+
+// LoadState restores state produced by SaveState
+func (b *Breakout) LoadState(data []byte) error {
+	var st breakoutState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	// the rings keep the newest candles of longer histories
+	for _, r := range []struct {
+		ring *indicators.Ring[float64]
+		vals []float64
+	}{{b.highs, st.Highs}, {b.lows, st.Lows}, {b.ranges, st.Ranges}} {
+		r.ring.Reset()
+		for _, v := range r.vals {
+			r.ring.Push(v)
+		}
+	}
+	b.prevClose, b.dir, b.stop, b.qty = st.PrevClose, st.Dir, st.Stop, st.Qty
+	b.accountUSD, b.last = st.AccountUSD, st.LastSignal
+	return nil
+}
+
+func (b *Breakout) SetAccountUSD(v decimal.Decimal) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.accountUSD = v
+}
+
+func (b *Breakout) AccountBalUSD() decimal.Decimal {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.accountUSD
+}
+
+// Clone returns a fresh Breakout with the same name, parameters and capital
+func (b *Breakout) Clone(exec engine.OrderExecutor) engine.Strategy {
+	c := NewBreakout(b.symbol, b.window, b.atrPeriod, b.atrMult, exec, engine.CloneRisk(b.risk)).(*Breakout)
+	c.name = b.name
+	c.longOnly = b.longOnly
+	c.interval = b.interval
+	c.SetAccountUSD(b.AccountBalUSD())
+	return c
+}
@@ -0,0 +1,70 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/shopspring/decimal"
+)
+
+// recordingExecutor keeps the orders submitted to it, failing them while fail is set
+type recordingExecutor struct {
+	fail   bool
+	orders []engine.Order
+}
+
+func (x *recordingExecutor) Submit(ctx context.Context, o engine.Order) (engine.Order, error) {
+	if x.fail {
+		return engine.Order{}, errors.New("exchange unavailable")
+	}
+	x.orders = append(x.orders, o)
+	return o, nil
+}
+
+// stepRisk sizes each order one more than the last, starting at 2
+type stepRisk struct{ n int64 }
+
+func (r *stepRisk) Size(strategy, symbol string, price, balance decimal.Decimal) decimal.Decimal {
+	r.n++
+	return decimal.NewFromInt(r.n + 1)
+}
+
+func (r *stepRisk) Observe(symbol string, c engine.Candle) {}
+
+func TestBreakoutRetriesFailedExitWithEntryQuantity(t *testing.T) {
+	exec := &recordingExecutor{}
+	b := NewBreakout("BTCUSD", 2, 1, 1, exec, &stepRisk{})
+	candle := func(i int, high, low, close float64) engine.Candle {
+		return engine.Candle{Time: time.Unix(int64(i)*60, 0), Open: close, High: high, Low: low, Close: close}
+	}
+
+	b.OnCandle(candle(0, 101, 99, 100))
+	b.OnCandle(candle(1, 101, 99, 100))
+	b.OnCandle(candle(2, 105, 100, 105)) // above the channel, long 2 with the stop at 100
+	if len(exec.orders) != 1 || exec.orders[0].Side != engine.SideBuy || !exec.orders[0].Quantity.Equal(decimal.NewFromInt(2)) {
+		t.Fatalf("orders %+v, want a buy of 2", exec.orders)
+	}
+
+	exec.fail = true
+	b.OnCandle(candle(3, 100, 98, 99)) // through the stop, the exit fails
+	exec.fail = false
+	if len(exec.orders) != 1 {
+		t.Fatalf("orders %+v after the failed exit", exec.orders)
+	}
+
+	b.OnCandle(candle(4, 99, 97, 98))
+	if len(exec.orders) != 2 {
+		t.Fatalf("orders %+v, want the exit tried again", exec.orders)
+	}
+	if o := exec.orders[1]; o.Side != engine.SideSell || !o.Quantity.Equal(decimal.NewFromInt(2)) {
+		t.Fatalf("exit %s %s, want a sell of the 2 entered", o.Side, o.Quantity)
+	}
+
+	b.OnCandle(candle(5, 97, 95, 96))
+	if len(exec.orders) != 2 {
+		t.Fatalf("orders %+v, a flat strategy exited again", exec.orders)
+	}
+}
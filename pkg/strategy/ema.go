@@ -1,11 +1,14 @@
 package strategy
 
 import (
-	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"sync"
 
 	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/indicators"
+	"github.com/shopspring/decimal"
 )
 
 const ST_NAME_EMA = "EMA strategy"
@@ -13,87 +16,353 @@ const ST_NAME_EMA = "EMA strategy"
 type EMACrossover struct {
 	shortP     int
 	longP      int
-	prices     []float64
+	prices     *indicators.Ring[float64] // closes of the last long period, kept for snapshots
+	short      emaValue
+	long       emaValue
+	prevShort  float64
+	prevLong   float64
+	trendTF    int64 // seconds, 0 takes every buy signal
+	trend      emaValue
+	trendP     int
+	trendClose float64 // last close of the trend timeframe
+	last       *lastSignal
 	exec       engine.OrderExecutor
 	risk       engine.RiskManager
+	positions  engine.PositionReader
+	longOnly   bool // sell signals never open a short
+	signalOnly bool // exec records signals instead of submitting orders
 	symbol     string
+	interval   int64 // candle size in seconds
 	lock       sync.Mutex
-	accountUSD float64
+	accountUSD decimal.Decimal
 	name       string
 }
 
 func NewEMACrossover(symbol string, shortP, longP int, exec engine.OrderExecutor, risk engine.RiskManager) engine.Strategy {
 	return &EMACrossover{
-		shortP: shortP,
-		longP:  longP,
-		prices: []float64{},
-		exec:   exec,
-		risk:   risk,
-		symbol: symbol,
-		name:   ST_NAME_EMA,
+		shortP:   shortP,
+		longP:    longP,
+		prices:   indicators.NewRing[float64](longP + 1),
+		short:    newEMAValue(shortP),
+		long:     newEMAValue(longP),
+		exec:     exec,
+		risk:     risk,
+		symbol:   symbol,
+		interval: engine.DefaultCandleInterval,
+		name:     ST_NAME_EMA,
+		longOnly: true,
 	}
 }
 
-func (e *EMACrossover) Name() string            { return e.name }
-func (e *EMACrossover) SetAccountUSD(v float64) { e.accountUSD = v }
-func (e *EMACrossover) Symbol() string          { return e.symbol }
-func (e *EMACrossover) AccountBalUSD() float64  { return e.accountUSD }
-func (e *EMACrossover) OnStart()                { log.Println("Started EMAC Crossover Strategy") }
-func (e *EMACrossover) OnStop()                 { log.Println("Stopped EMAC Crossover Strategy") }
+func (e *EMACrossover) Name() string    { return e.name }
+func (e *EMACrossover) Symbol() string  { return e.symbol }
+func (e *EMACrossover) Type() string    { return TypeEMA }
+func (e *EMACrossover) Interval() int64 { return e.interval }
+func (e *EMACrossover) OnStart()        { log.Println("Started EMAC Crossover Strategy") }
+func (e *EMACrossover) OnStop()         { log.Println("Stopped EMAC Crossover Strategy") }
 
-func ema(series []float64, period int) []float64 {
-	out := make([]float64, len(series))
-	if period <= 0 {
-		return out
-	}
-	k := 2.0 / float64(period+1)
-	var prev float64
-	for i := range series {
-		if i == 0 {
-			prev = series[0]
-			out[0] = prev
-			continue
+// SetPositionReader lets sell signals close the position actually held
+func (e *EMACrossover) SetPositionReader(r engine.PositionReader) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.positions = r
+}
+
+// SetTrendFilter makes buy signals wait for an uptrend: the last candle of
+// timeframe tf seconds closing above the EMA of period of those candles. A
+// zero tf removes the filter.
+func (e *EMACrossover) SetTrendFilter(tf int64, period int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.trendTF, e.trendP = tf, period
+	e.trend, e.trendClose = newEMAValue(period), 0
+}
+
+// Timeframes implements engine.MultiTimeframeStrategy
+func (e *EMACrossover) Timeframes() []int64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.trendTF <= 0 {
+		return nil
+	}
+	return []int64{e.trendTF}
+}
+
+// OnCandleTF advances the trend filter
+func (e *EMACrossover) OnCandleTF(tf int64, c engine.Candle) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if tf != e.trendTF {
+		return
+	}
+	e.trend.update(c.Close)
+	e.trendClose = c.Close
+}
+
+// trendUp reports whether the trend filter lets buys through. Callers must hold e.lock.
+func (e *EMACrossover) trendUp() bool {
+	return e.trendTF <= 0 || (e.trend.n >= e.trendP && e.trendClose > e.trend.value)
+}
+
+// SetInterval sets the candle size in seconds the strategy trades on, it
+// takes effect when the strategy is registered
+func (e *EMACrossover) SetInterval(seconds int64) {
+	e.interval = seconds
+}
+
+// SetLongOnly sets whether sell signals may open a short, strategies start long-only
+func (e *EMACrossover) SetLongOnly(v bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.longOnly = v
+}
+
+// SetSignalOnly marks the strategy as signal-only, reading the paper
+// positions of its signals. It takes effect when the strategy is registered.
+func (e *EMACrossover) SetSignalOnly(v bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.signalOnly = v
+}
+
+// SignalOnly implements engine.SignalOnlyStrategy
+func (e *EMACrossover) SignalOnly() bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.signalOnly
+}
+
+// OnOrderUpdate logs the lifecycle of orders the strategy submitted
+func (e *EMACrossover) OnOrderUpdate(o engine.Order) {
+	log.Printf("%s order %s %s %s: %s (filled %s/%s, %s remaining)", e.name, o.ID, o.Side, o.Symbol, o.Status, o.FilledQty, o.Quantity, o.Remaining())
+}
+
+// Params implements Tunable
+func (e *EMACrossover) Params() json.RawMessage {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	raw, _ := json.Marshal(e.params())
+	return raw
+}
+
+// params returns the current params. Callers must hold e.lock.
+func (e *EMACrossover) params() emaParams {
+	p := emaParams{Short: e.shortP, Long: e.longP, TrendPeriod: defaultTrendPeriod}
+	if e.trendTF > 0 {
+		p.Trend, p.TrendPeriod = intervalName(e.trendTF), e.trendP
+	}
+	return p
+}
+
+// SetParams implements Tunable. New periods restart the averages on the
+// closes kept, so signals resume once they cover the long period again.
+// The trend timeframe is fixed while trading, its period may change.
+func (e *EMACrossover) SetParams(raw json.RawMessage) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	p := e.params()
+	if err := decodeParams(raw, &p); err != nil {
+		return err
+	}
+	trendTF, err := p.validate()
+	if err != nil {
+		return err
+	}
+	if trendTF != e.trendTF {
+		return fmt.Errorf("trend cannot change while trading, remove and add the strategy instead")
+	}
+
+	if p.Short != e.shortP || p.Long != e.longP {
+		closes := e.prices.Values(nil)
+		e.shortP, e.longP = p.Short, p.Long
+		e.prices = indicators.NewRing[float64](p.Long + 1)
+		e.short, e.long = newEMAValue(p.Short), newEMAValue(p.Long)
+		e.prevShort, e.prevLong = 0, 0
+		for _, c := range closes {
+			e.push(c)
 		}
-		prev = (series[i]-prev)*k + prev
-		out[i] = prev
 	}
-	return out
+	if e.trendTF > 0 && p.TrendPeriod != e.trendP {
+		e.trendP = p.TrendPeriod
+		e.trend = newEMAValue(p.TrendPeriod)
+	}
+	log.Printf("%s params set to short %d, long %d", e.name, e.shortP, e.longP)
+	return nil
+}
+
+// emaValue is an exponential moving average updated one price at a time,
+// seeded with the first price
+type emaValue struct {
+	k     float64
+	value float64
+	n     int
+}
+
+func newEMAValue(period int) emaValue {
+	if period <= 0 {
+		return emaValue{}
+	}
+	return emaValue{k: 2.0 / float64(period+1)}
+}
+
+func (m *emaValue) update(x float64) float64 {
+	if m.n == 0 {
+		m.value = x
+	} else {
+		m.value = (x-m.value)*m.k + m.value
+	}
+	m.n++
+	return m.value
+}
+
+// push adds a close and advances both averages
+func (e *EMACrossover) push(price float64) {
+	e.prices.Push(price)
+	e.prevShort, e.prevLong = e.short.value, e.long.value
+	e.short.update(price)
+	e.long.update(price)
 }
 
 func (e *EMACrossover) OnCandle(c engine.Candle) {
 	e.lock.Lock()
 	defer e.lock.Unlock()
 	price := c.Close
-	e.prices = append(e.prices, price)
-	if len(e.prices) < e.longP+2 {
+	e.risk.Observe(e.symbol, c)
+	e.push(price)
+	if e.long.n < e.longP+2 {
 		return
 	}
-	short := ema(e.prices, e.shortP)
-	long := ema(e.prices, e.longP)
-	n := len(short) - 1
-	prev := n - 1
-	if short[prev] <= long[prev] && short[n] > long[n] {
-		qty := e.risk.Size(e.symbol, price, e.accountUSD)
-		if qty <= 0 {
+	short, long := e.short.value, e.long.value
+	if e.prevShort <= e.prevLong && short > long {
+		if !e.trendUp() {
+			log.Printf("%s skipped a buy signal against the trend", e.name)
 			return
 		}
-		o := engine.Order{Price: price, Symbol: e.symbol, Side: engine.SideBuy, Type: engine.OrderMarket, Quantity: qty}
-		if _, err := e.exec.Submit(context.TODO(), o); err != nil {
+		e.last = &lastSignal{Side: engine.SideBuy, Price: price, Time: c.Time}
+		ctx, span := startSignal(e.name, e.symbol, engine.SideBuy, price)
+		defer span.End()
+		qty := tradeQty(ctx, e.risk, e.positions, e.longOnly, engine.SideBuy, e.name, e.symbol, decimal.NewFromFloat(price), e.accountUSD)
+		if !qty.IsPositive() {
+			return
+		}
+		o := engine.Order{Price: decimal.NewFromFloat(price), Symbol: e.symbol, Side: engine.SideBuy, Type: engine.OrderMarket, Quantity: qty, Strategy: e.name}
+		if _, err := e.exec.Submit(ctx, o); err != nil {
 			log.Println("EMA buy error:", err)
 		} else {
 			log.Println("EMA buy executed", qty)
 		}
 	}
-	if short[prev] >= long[prev] && short[n] < long[n] {
-		qty := e.risk.Size(e.symbol, price, e.accountUSD)
-		if qty <= 0 {
+	if e.prevShort >= e.prevLong && short < long {
+		e.last = &lastSignal{Side: engine.SideSell, Price: price, Time: c.Time}
+		ctx, span := startSignal(e.name, e.symbol, engine.SideSell, price)
+		defer span.End()
+		qty := tradeQty(ctx, e.risk, e.positions, e.longOnly, engine.SideSell, e.name, e.symbol, decimal.NewFromFloat(price), e.accountUSD)
+		if !qty.IsPositive() {
 			return
 		}
-		o := engine.Order{Symbol: e.symbol, Side: engine.SideSell, Type: engine.OrderMarket, Quantity: qty}
-		if _, err := e.exec.Submit(context.TODO(), o); err != nil {
+		o := engine.Order{Symbol: e.symbol, Side: engine.SideSell, Type: engine.OrderMarket, Quantity: qty, Strategy: e.name}
+		if _, err := e.exec.Submit(ctx, o); err != nil {
 			log.Println("EMA sell error:", err)
 		} else {
 			log.Println("EMA sell executed", qty)
 		}
 	}
 }
+
+// WarmUpCandles is the history the averages need before the first signal
+func (e *EMACrossover) WarmUpCandles() int { return e.longP + 2 }
+
+// WarmUp advances the averages over candles without trading
+func (e *EMACrossover) WarmUp(candles []engine.Candle) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, c := range candles {
+		e.risk.Observe(e.symbol, c)
+		e.push(c.Close)
+	}
+}
+
+type eMACrossoverState struct {
+	Prices     []float64       `json:"prices"`
+	AccountUSD decimal.Decimal `json:"account_usd"`
+	Short      float64         `json:"short,omitempty"`
+	Long       float64         `json:"long,omitempty"`
+	PrevShort  float64         `json:"prev_short,omitempty"`
+	PrevLong   float64         `json:"prev_long,omitempty"`
+	Count      int             `json:"count,omitempty"`
+	Trend      float64         `json:"trend,omitempty"`
+	TrendClose float64         `json:"trend_close,omitempty"`
+	TrendCount int             `json:"trend_count,omitempty"`
+	LastSignal *lastSignal     `json:"last_signal,omitempty"`
+}
+
+// SaveState serializes the averages, recent closes, last signal and allocated capital
+func (e *EMACrossover) SaveState() ([]byte, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return json.Marshal(eMACrossoverState{
+		Prices:     e.prices.Values(nil),
+		AccountUSD: e.accountUSD,
+		Short:      e.short.value,
+		Long:       e.long.value,
+		PrevShort:  e.prevShort,
+		PrevLong:   e.prevLong,
+		Count:      e.long.n,
+		Trend:      e.trend.value,
+		TrendClose: e.trendClose,
+		TrendCount: e.trend.n,
+		LastSignal: e.last,
+	})
+}
+
+// LoadState restores state produced by SaveState
+func (e *EMACrossover) LoadState(data []byte) error {
+	var st eMACrossoverState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.accountUSD, e.last = st.AccountUSD, st.LastSignal
+	e.prices.Reset()
+	e.short, e.long = newEMAValue(e.shortP), newEMAValue(e.longP)
+	e.trend = newEMAValue(e.trendP)
+	e.trend.value, e.trend.n, e.trendClose = st.Trend, st.TrendCount, st.TrendClose
+	if st.Count == 0 {
+		// older snapshots only hold the price history, replay it
+		for _, p := range st.Prices {
+			e.push(p)
+		}
+		return nil
+	}
+	for _, p := range st.Prices {
+		e.prices.Push(p)
+	}
+	e.short.value, e.short.n = st.Short, st.Count
+	e.long.value, e.long.n = st.Long, st.Count
+	e.prevShort, e.prevLong = st.PrevShort, st.PrevLong
+	return nil
+}
+
+func (e *EMACrossover) SetAccountUSD(v decimal.Decimal) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.accountUSD = v
+}
+
+func (e *EMACrossover) AccountBalUSD() decimal.Decimal {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.accountUSD
+}
+
+// Clone returns a fresh EMACrossover with the same name, parameters and capital
+func (e *EMACrossover) Clone(exec engine.OrderExecutor) engine.Strategy {
+	c := NewEMACrossover(e.symbol, e.shortP, e.longP, exec, engine.CloneRisk(e.risk)).(*EMACrossover)
+	c.name = e.name
+	c.longOnly = e.longOnly
+	c.interval = e.interval
+	c.SetTrendFilter(e.trendTF, e.trendP)
+	c.SetAccountUSD(e.AccountBalUSD())
+	return c
+}
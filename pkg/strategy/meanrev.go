@@ -1,12 +1,14 @@
 package strategy
 
 import (
-	"context"
+	"encoding/json"
 	"log"
 	"math"
 	"sync"
 
 	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/indicators"
+	"github.com/shopspring/decimal"
 )
 
 const ST_NAME_MEAN = "MeanReversion"
@@ -14,47 +16,94 @@ const ST_NAME_MEAN = "MeanReversion"
 type MeanReversion struct {
 	window     int
 	k          float64
-	prices     []float64
+	prices     *indicators.Ring[float64] // closes of the last window
+	last       *lastSignal
 	exec       engine.OrderExecutor
 	risk       engine.RiskManager
-	accountUSD float64
+	positions  engine.PositionReader
+	longOnly   bool // sell signals never open a short
+	signalOnly bool // exec records signals instead of submitting orders
+	accountUSD decimal.Decimal
 	symbol     string
+	interval   int64 // candle size in seconds
 	lock       sync.Mutex
 	name       string
 }
 
 func NewMeanReversion(symbol string, window int, k float64, exec engine.OrderExecutor, risk engine.RiskManager) engine.Strategy {
 	return &MeanReversion{
-		window: window,
-		k:      k,
-		prices: []float64{},
-		exec:   exec,
-		risk:   risk,
-		symbol: symbol,
-		name:   ST_NAME_MEAN,
+		window:   window,
+		k:        k,
+		prices:   indicators.NewRing[float64](window),
+		exec:     exec,
+		risk:     risk,
+		symbol:   symbol,
+		interval: engine.DefaultCandleInterval,
+		name:     ST_NAME_MEAN,
+		longOnly: true,
 	}
 }
 
-func (m *MeanReversion) Name() string            { return m.name }
-func (m *MeanReversion) Symbol() string          { return m.symbol }
-func (m *MeanReversion) SetAccountUSD(v float64) { m.accountUSD = v }
-func (m *MeanReversion) AccountBalUSD() float64  { return m.accountUSD }
-func (m *MeanReversion) OnStart()                { log.Println("Started Mean Reversion Strategy") }
-func (m *MeanReversion) OnStop()                 { log.Println("Stopped Mean Reversion Strategy") }
+func (m *MeanReversion) Name() string    { return m.name }
+func (m *MeanReversion) Symbol() string  { return m.symbol }
+func (m *MeanReversion) Type() string    { return TypeMeanReversion }
+func (m *MeanReversion) Interval() int64 { return m.interval }
+func (m *MeanReversion) OnStart()        { log.Println("Started Mean Reversion Strategy") }
+func (m *MeanReversion) OnStop()         { log.Println("Stopped Mean Reversion Strategy") }
 
-func meanStd(xs []float64) (float64, float64) {
-	n := float64(len(xs))
+// SetPositionReader lets sell signals close the position actually held
+func (m *MeanReversion) SetPositionReader(r engine.PositionReader) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.positions = r
+}
+
+// SetInterval sets the candle size in seconds the strategy trades on, it
+// takes effect when the strategy is registered
+func (m *MeanReversion) SetInterval(seconds int64) {
+	m.interval = seconds
+}
+
+// SetLongOnly sets whether sell signals may open a short, strategies start long-only
+func (m *MeanReversion) SetLongOnly(v bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.longOnly = v
+}
+
+// SetSignalOnly marks the strategy as signal-only, reading the paper
+// positions of its signals. It takes effect when the strategy is registered.
+func (m *MeanReversion) SetSignalOnly(v bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.signalOnly = v
+}
+
+// SignalOnly implements engine.SignalOnlyStrategy
+func (m *MeanReversion) SignalOnly() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.signalOnly
+}
+
+// OnOrderUpdate logs the lifecycle of orders the strategy submitted
+func (m *MeanReversion) OnOrderUpdate(o engine.Order) {
+	log.Printf("%s order %s %s %s: %s (filled %s/%s, %s remaining)", m.name, o.ID, o.Side, o.Symbol, o.Status, o.FilledQty, o.Quantity, o.Remaining())
+}
+
+func meanStd(xs *indicators.Ring[float64]) (float64, float64) {
+	n := float64(xs.Len())
 	if n == 0 {
 		return 0, 0
 	}
 	var sum float64
-	for _, v := range xs {
-		sum += v
+	for i := 0; i < xs.Len(); i++ {
+		sum += xs.At(i)
 	}
 	mean := sum / n
 	var sq float64
-	for _, v := range xs {
-		diff := v - mean
+	for i := 0; i < xs.Len(); i++ {
+		diff := xs.At(i) - mean
 		sq += diff * diff
 	}
 	variance := sq / n
@@ -64,34 +113,138 @@ func meanStd(xs []float64) (float64, float64) {
 func (m *MeanReversion) OnCandle(c engine.Candle) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	m.prices = append(m.prices, c.Close)
-	if len(m.prices) < m.window {
+	m.risk.Observe(m.symbol, c)
+	m.prices.Push(c.Close)
+	if m.prices.Len() < m.window {
 		return
 	}
-	window := m.prices[len(m.prices)-m.window:]
-	mean, sd := meanStd(window)
+	mean, sd := meanStd(m.prices)
 	last := c.Close
 	if last < mean-m.k*sd {
-		qty := m.risk.Size(m.symbol, last, m.accountUSD)
-		if qty <= 0 {
+		m.last = &lastSignal{Side: engine.SideBuy, Price: last, Time: c.Time}
+		ctx, span := startSignal(m.name, m.symbol, engine.SideBuy, last)
+		defer span.End()
+		qty := tradeQty(ctx, m.risk, m.positions, m.longOnly, engine.SideBuy, m.name, m.symbol, decimal.NewFromFloat(last), m.accountUSD)
+		if !qty.IsPositive() {
 			return
 		}
-		o := engine.Order{Symbol: m.symbol, Side: engine.SideBuy, Type: engine.OrderMarket, Quantity: qty}
-		if _, err := m.exec.Submit(context.TODO(), o); err != nil {
+		o := engine.Order{Symbol: m.symbol, Side: engine.SideBuy, Type: engine.OrderMarket, Quantity: qty, Strategy: m.name}
+		if _, err := m.exec.Submit(ctx, o); err != nil {
 			log.Println("MeanRev buy err:", err)
 		} else {
 			log.Println("MeanRev buy executed", qty)
 		}
 	} else if last > mean+m.k*sd {
-		qty := m.risk.Size(m.symbol, last, m.accountUSD)
-		if qty <= 0 {
+		m.last = &lastSignal{Side: engine.SideSell, Price: last, Time: c.Time}
+		ctx, span := startSignal(m.name, m.symbol, engine.SideSell, last)
+		defer span.End()
+		qty := tradeQty(ctx, m.risk, m.positions, m.longOnly, engine.SideSell, m.name, m.symbol, decimal.NewFromFloat(last), m.accountUSD)
+		if !qty.IsPositive() {
 			return
 		}
-		o := engine.Order{Symbol: m.symbol, Side: engine.SideSell, Type: engine.OrderMarket, Quantity: qty}
-		if _, err := m.exec.Submit(context.TODO(), o); err != nil {
+		o := engine.Order{Symbol: m.symbol, Side: engine.SideSell, Type: engine.OrderMarket, Quantity: qty, Strategy: m.name}
+		if _, err := m.exec.Submit(ctx, o); err != nil {
 			log.Println("MeanRev sell err:", err)
 		} else {
 			log.Println("MeanRev sell executed", qty)
 		}
 	}
 }
+
+// WarmUpCandles is the window of closes the bands are computed over
+func (m *MeanReversion) WarmUpCandles() int { return m.window }
+
+// WarmUp fills the window with the closes of candles without trading
+func (m *MeanReversion) WarmUp(candles []engine.Candle) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, c := range candles {
+		m.risk.Observe(m.symbol, c)
+		m.prices.Push(c.Close)
+	}
+}
+
+// Params implements Tunable
+func (m *MeanReversion) Params() json.RawMessage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	raw, _ := json.Marshal(meanReversionParams{Window: m.window, K: m.k})
+	return raw
+}
+
+// SetParams implements Tunable. A new window keeps the newest closes that
+// fit in it.
+func (m *MeanReversion) SetParams(raw json.RawMessage) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	p := meanReversionParams{Window: m.window, K: m.k}
+	if err := decodeParams(raw, &p); err != nil {
+		return err
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+	if p.Window != m.window {
+		closes := m.prices.Values(nil)
+		m.prices = indicators.NewRing[float64](p.Window)
+		for _, c := range closes {
+			m.prices.Push(c)
+		}
+		m.window = p.Window
+	}
+	m.k = p.K
+	log.Printf("%s params set to window %d, k %g", m.name, m.window, m.k)
+	return nil
+}
+
+type meanReversionState struct {
+	Prices     []float64       `json:"prices"`
+	AccountUSD decimal.Decimal `json:"account_usd"`
+	LastSignal *lastSignal     `json:"last_signal,omitempty"`
+}
+
+// SaveState serializes the price history, last signal and allocated capital
+func (m *MeanReversion) SaveState() ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return json.Marshal(meanReversionState{Prices: m.prices.Values(nil), AccountUSD: m.accountUSD, LastSignal: m.last})
+}
+
+// LoadState restores state produced by SaveState
+func (m *MeanReversion) LoadState(data []byte) error {
+	var st meanReversionState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	// the ring keeps the newest window of longer histories
+	m.prices.Reset()
+	for _, p := range st.Prices {
+		m.prices.Push(p)
+	}
+	m.accountUSD, m.last = st.AccountUSD, st.LastSignal
+	return nil
+}
+
+func (m *MeanReversion) SetAccountUSD(v decimal.Decimal) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.accountUSD = v
+}
+
+func (m *MeanReversion) AccountBalUSD() decimal.Decimal {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.accountUSD
+}
+
+// Clone returns a fresh MeanReversion with the same name, parameters and capital
+func (m *MeanReversion) Clone(exec engine.OrderExecutor) engine.Strategy {
+	c := NewMeanReversion(m.symbol, m.window, m.k, exec, engine.CloneRisk(m.risk)).(*MeanReversion)
+	c.name = m.name
+	c.longOnly = m.longOnly
+	c.interval = m.interval
+	c.SetAccountUSD(m.AccountBalUSD())
+	return c
+}
@@ -0,0 +1,399 @@
+package strategy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/indicators"
+	"github.com/shopspring/decimal"
+)
+
+const ST_NAME_PAIRS = "Pairs"
+
+// PairsTrade trades the spread of two symbols: the close of its symbol less
+// the hedge ratio times the close of its pair, the ratio regressed over the
+// closes of the last window. It sells the spread when the spread's z-score
+// rises above entryZ, buys it when the z-score falls below -entryZ and
+// closes both legs once the z-score is back within exitZ. Both legs are
+// traded long and short, the spread is not opened on an exchange that
+// cannot sell its short leg.
+type PairsTrade struct {
+	symbol     string
+	pair       string
+	window     int
+	entryZ     float64
+	exitZ      float64
+	a          *indicators.Ring[float64] // closes of symbol, aligned by time with b
+	b          *indicators.Ring[float64] // closes of pair
+	lastA      engine.Candle             // newest candle of each leg, waiting for the other's
+	lastB      engine.Candle
+	paired     time.Time          // time of the last candles pushed
+	dir        int                // 1 long the spread, -1 short, 0 flat
+	legs       [2]decimal.Decimal // signed quantities opened, read when there is no position reader
+	hedge      float64
+	exec       engine.OrderExecutor
+	risk       engine.RiskManager
+	positions  engine.PositionReader
+	signalOnly bool // exec records signals instead of submitting orders
+	last       *lastSignal
+	interval   int64 // candle size in seconds
+	lock       sync.Mutex
+	accountUSD decimal.Decimal
+	name       string
+}
+
+func NewPairsTrade(symbol, pair string, window int, entryZ, exitZ float64, exec engine.OrderExecutor, risk engine.RiskManager) engine.Strategy {
+	return &PairsTrade{
+		symbol:   symbol,
+		pair:     pair,
+		window:   window,
+		entryZ:   entryZ,
+		exitZ:    exitZ,
+		a:        indicators.NewRing[float64](window),
+		b:        indicators.NewRing[float64](window),
+		exec:     exec,
+		risk:     risk,
+		interval: engine.DefaultCandleInterval,
+		name:     ST_NAME_PAIRS,
+	}
+}
+
+func (p *PairsTrade) Name() string    { return p.name }
+func (p *PairsTrade) Symbol() string  { return p.symbol }
+func (p *PairsTrade) Type() string    { return TypePairs }
+func (p *PairsTrade) Interval() int64 { return p.interval }
+func (p *PairsTrade) OnStart()        { log.Printf("Started Pairs Strategy on %s/%s", p.symbol, p.pair) }
+func (p *PairsTrade) OnStop()         { log.Printf("Stopped Pairs Strategy on %s/%s", p.symbol, p.pair) }
+
+// Symbols implements engine.MultiSymbolStrategy
+func (p *PairsTrade) Symbols() []string { return []string{p.symbol, p.pair} }
+
+// SetPositionReader lets exits close the legs actually held
+func (p *PairsTrade) SetPositionReader(r engine.PositionReader) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.positions = r
+}
+
+// SetInterval sets the candle size in seconds the strategy trades on, it
+// takes effect when the strategy is registered
+func (p *PairsTrade) SetInterval(seconds int64) {
+	p.interval = seconds
+}
+
+// SetSignalOnly marks the strategy as signal-only, reading the paper
+// positions of its signals. It takes effect when the strategy is registered.
+func (p *PairsTrade) SetSignalOnly(v bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.signalOnly = v
+}
+
+// SignalOnly implements engine.SignalOnlyStrategy
+func (p *PairsTrade) SignalOnly() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.signalOnly
+}
+
+// OnOrderUpdate logs the lifecycle of orders the strategy submitted
+func (p *PairsTrade) OnOrderUpdate(o engine.Order) {
+	log.Printf("%s order %s %s %s: %s (filled %s/%s, %s remaining)", p.name, o.ID, o.Side, o.Symbol, o.Status, o.FilledQty, o.Quantity, o.Remaining())
+}
+
+func (p *PairsTrade) OnCandle(c engine.Candle) {
+	p.OnSymbolCandle(p.symbol, c)
+}
+
+// OnSymbolCandle implements engine.MultiSymbolStrategy. The spread moves
+// once both legs have a candle of the same time.
+func (p *PairsTrade) OnSymbolCandle(symbol string, c engine.Candle) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.risk.Observe(symbol, c)
+	switch symbol {
+	case p.symbol:
+		p.lastA = c
+	case p.pair:
+		p.lastB = c
+	default:
+		return
+	}
+	if !p.lastA.Time.Equal(p.lastB.Time) || !p.lastA.Time.After(p.paired) {
+		return
+	}
+	p.paired = c.Time
+	p.a.Push(p.lastA.Close)
+	p.b.Push(p.lastB.Close)
+	if p.a.Len() < p.window {
+		return
+	}
+
+	z, ok := p.zscore()
+	if !ok {
+		return
+	}
+	switch {
+	case p.dir == 0 && z > p.entryZ:
+		p.open(-1, c.Time)
+	case p.dir == 0 && z < -p.entryZ:
+		p.open(1, c.Time)
+	case p.dir != 0 && math.Abs(z) < p.exitZ:
+		p.close(c.Time)
+	}
+}
+
+// zscore regresses the closes of symbol on those of pair for the hedge
+// ratio and returns how many standard deviations the newest spread is off
+// the mean spread, false while either leg is flat. Callers must hold p.lock.
+func (p *PairsTrade) zscore() (float64, bool) {
+	n := float64(p.a.Len())
+	var meanA, meanB float64
+	for i := 0; i < p.a.Len(); i++ {
+		meanA += p.a.At(i)
+		meanB += p.b.At(i)
+	}
+	meanA, meanB = meanA/n, meanB/n
+	var cov, varB float64
+	for i := 0; i < p.a.Len(); i++ {
+		cov += (p.a.At(i) - meanA) * (p.b.At(i) - meanB)
+		varB += (p.b.At(i) - meanB) * (p.b.At(i) - meanB)
+	}
+	if varB == 0 {
+		return 0, false
+	}
+	p.hedge = cov / varB
+
+	spread := make([]float64, p.a.Len())
+	var mean float64
+	for i := range spread {
+		spread[i] = p.a.At(i) - p.hedge*p.b.At(i)
+		mean += spread[i]
+	}
+	mean /= n
+	var sq float64
+	for _, s := range spread {
+		sq += (s - mean) * (s - mean)
+	}
+	sd := math.Sqrt(sq / n)
+	if sd == 0 {
+		return 0, false
+	}
+	return (spread[len(spread)-1] - mean) / sd, true
+}
+
+// open buys the spread for dir 1, buying symbol and selling hedge times as
+// much of pair, or sells it for dir -1. Callers must hold p.lock.
+func (p *PairsTrade) open(dir int, at time.Time) {
+	side := engine.SideBuy
+	if dir < 0 {
+		side = engine.SideSell
+	}
+	priceA, priceB := p.lastA.Close, p.lastB.Close
+	p.last = &lastSignal{Side: side, Price: priceA, Time: at}
+	ctx, span := startSignal(p.name, p.symbol, side, priceA)
+	defer span.End()
+
+	qtyA := sizeOrder(ctx, p.risk, p.name, p.symbol, decimal.NewFromFloat(priceA), p.accountUSD)
+	if !qtyA.IsPositive() {
+		return
+	}
+	legA := qtyA
+	if dir < 0 {
+		legA = legA.Neg()
+	}
+	legB := legA.Mul(decimal.NewFromFloat(-p.hedge)).Round(8)
+	for _, leg := range []struct {
+		symbol string
+		qty    decimal.Decimal
+	}{{p.symbol, legA}, {p.pair, legB}} {
+		if leg.qty.IsNegative() && !p.canShort(leg.symbol) {
+			log.Printf("%s not opening the %s/%s spread, %s cannot be sold short", p.name, p.symbol, p.pair, leg.symbol)
+			return
+		}
+	}
+	if !p.submit(ctx, p.symbol, legA, priceA) {
+		return
+	}
+	p.dir, p.legs = dir, [2]decimal.Decimal{legA, legB}
+	// one retry, then leg A is unwound rather than left unhedged
+	if !p.submit(ctx, p.pair, legB, priceB) && !p.submit(ctx, p.pair, legB, priceB) {
+		if p.submit(ctx, p.symbol, legA.Neg(), priceA) {
+			p.dir, p.legs = 0, [2]decimal.Decimal{}
+			log.Printf("%s unwound %s %s, the %s leg of the spread could not be placed", p.name, legA, p.symbol, p.pair)
+			return
+		}
+		// close flattens what is left of leg A
+		p.legs[1] = decimal.Zero
+		log.Printf("%s holds %s %s unhedged, the %s leg failed and leg A could not be unwound", p.name, legA, p.symbol, p.pair)
+		return
+	}
+	log.Printf("%s %s the %s/%s spread, hedge ratio %.4f", p.name, side, p.symbol, p.pair, p.hedge)
+}
+
+// canShort reports whether symbol may be sold short. Signal-only
+// strategies trade nothing and so may.
+func (p *PairsTrade) canShort(symbol string) bool {
+	s, ok := p.exec.(engine.ShortSeller)
+	return !ok || s.CanShort(symbol)
+}
+
+// close flattens both legs. Callers must hold p.lock.
+func (p *PairsTrade) close(at time.Time) {
+	side := engine.SideSell
+	if p.dir < 0 {
+		side = engine.SideBuy
+	}
+	p.last = &lastSignal{Side: side, Price: p.lastA.Close, Time: at}
+	ctx, span := startSignal(p.name, p.symbol, side, p.lastA.Close)
+	defer span.End()
+
+	held := p.legs
+	if p.positions != nil {
+		held = [2]decimal.Decimal{
+			p.positions.Position(p.name, p.symbol).Quantity,
+			p.positions.Position(p.name, p.pair).Quantity,
+		}
+	}
+	okA := p.submit(ctx, p.symbol, held[0].Neg(), p.lastA.Close)
+	okB := p.submit(ctx, p.pair, held[1].Neg(), p.lastB.Close)
+	if okA && okB {
+		p.dir, p.legs = 0, [2]decimal.Decimal{}
+		log.Printf("%s closed the %s/%s spread", p.name, p.symbol, p.pair)
+	}
+}
+
+// submit sends a market order for qty of symbol, selling when it is
+// negative. A zero qty has nothing to do and succeeds.
+func (p *PairsTrade) submit(ctx context.Context, symbol string, qty decimal.Decimal, price float64) bool {
+	if qty.IsZero() {
+		return true
+	}
+	side := engine.SideBuy
+	if qty.IsNegative() {
+		side = engine.SideSell
+	}
+	o := engine.Order{Price: decimal.NewFromFloat(price), Symbol: symbol, Side: side, Type: engine.OrderMarket, Quantity: qty.Abs(), Strategy: p.name}
+	if _, err := p.exec.Submit(ctx, o); err != nil {
+		log.Printf("Pairs %s %s error: %v", side, symbol, err)
+		return false
+	}
+	log.Printf("Pairs %s %s executed %s", side, symbol, qty.Abs())
+	return true
+}
+
+// Params implements Tunable
+func (p *PairsTrade) Params() json.RawMessage {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	raw, _ := json.Marshal(pairsParams{Pair: p.pair, Window: p.window, EntryZ: p.entryZ, ExitZ: p.exitZ})
+	return raw
+}
+
+// SetParams implements Tunable. A new window keeps the newest closes that
+// fit in it, the pair is fixed while trading.
+func (p *PairsTrade) SetParams(raw json.RawMessage) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	np := pairsParams{Pair: p.pair, Window: p.window, EntryZ: p.entryZ, ExitZ: p.exitZ}
+	if err := decodeParams(raw, &np); err != nil {
+		return err
+	}
+	if err := np.validate(p.symbol); err != nil {
+		return err
+	}
+	if np.Pair != p.pair {
+		return fmt.Errorf("pair cannot change while trading, remove and add the strategy instead")
+	}
+	if np.Window != p.window {
+		p.a, p.b = resizeRing(p.a, np.Window), resizeRing(p.b, np.Window)
+		p.window = np.Window
+	}
+	p.entryZ, p.exitZ = np.EntryZ, np.ExitZ
+	log.Printf("%s params set to window %d, entry z %g, exit z %g", p.name, p.window, p.entryZ, p.exitZ)
+	return nil
+}
+
+// resizeRing returns a ring of size holding the newest values of r
+func resizeRing(r *indicators.Ring[float64], size int) *indicators.Ring[float64] {
+	out := indicators.NewRing[float64](size)
+	for _, v := range r.Values(nil) {
+		out.Push(v)
+	}
+	return out
+}
+
+type pairsState struct {
+	A          []float64          `json:"a"`
+	B          []float64          `json:"b"`
+	Paired     time.Time          `json:"paired,omitzero"`
+	Dir        int                `json:"dir,omitempty"`
+	Legs       [2]decimal.Decimal `json:"legs"`
+	AccountUSD decimal.Decimal    `json:"account_usd"`
+	LastSignal *lastSignal        `json:"last_signal,omitempty"`
+}
+
+// SaveState serializes the closes of both legs, the open spread, last
+// signal and allocated capital
+func (p *PairsTrade) SaveState() ([]byte, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return json.Marshal(pairsState{
+		A:          p.a.Values(nil),
+		B:          p.b.Values(nil),
+		Paired:     p.paired,
+		Dir:        p.dir,
+		Legs:       p.legs,
+		AccountUSD: p.accountUSD,
+		LastSignal: p.last,
+	})
+}
+
+// LoadState restores state produced by SaveState
+func (p *PairsTrade) LoadState(data []byte) error {
+	var st pairsState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	if len(st.A) != len(st.B) {
+		return fmt.Errorf("pairs state has %d closes of %s and %d of %s", len(st.A), p.symbol, len(st.B), p.pair)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.a.Reset()
+	p.b.Reset()
+	for i := range st.A {
+		p.a.Push(st.A[i])
+		p.b.Push(st.B[i])
+	}
+	p.paired, p.dir, p.legs = st.Paired, st.Dir, st.Legs
+	p.accountUSD, p.last = st.AccountUSD, st.LastSignal
+	return nil
+}
+
+func (p *PairsTrade) SetAccountUSD(v decimal.Decimal) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.accountUSD = v
+}
+
+func (p *PairsTrade) AccountBalUSD() decimal.Decimal {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.accountUSD
+}
+
+// Clone returns a fresh PairsTrade with the same name, parameters and capital
+func (p *PairsTrade) Clone(exec engine.OrderExecutor) engine.Strategy {
+	c := NewPairsTrade(p.symbol, p.pair, p.window, p.entryZ, p.exitZ, exec, engine.CloneRisk(p.risk)).(*PairsTrade)
+	c.name = p.name
+	c.interval = p.interval
+	c.SetAccountUSD(p.AccountBalUSD())
+	return c
+}
@@ -0,0 +1,37 @@
+package strategy
+
+import (
+	"context"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/shopspring/decimal"
+)
+
+// tradeQty is how much a signal on side trades. A strategy that can read its
+// position first closes one on the other side: a sell closes the long it
+// holds, a buy covers its short. From flat, buys take the sized amount and
+// sells open a sized short unless the strategy is long-only. Without a
+// position reader every signal takes the sized amount.
+func tradeQty(ctx context.Context, risk engine.RiskManager, positions engine.PositionReader, longOnly bool, side engine.Side, name, symbol string, price, balance decimal.Decimal) decimal.Decimal {
+	if positions == nil {
+		return sizeOrder(ctx, risk, name, symbol, price, balance)
+	}
+	held := positions.Position(name, symbol).Quantity
+	switch {
+	case side == engine.SideSell && held.IsPositive():
+		return held
+	case side == engine.SideBuy && held.IsNegative():
+		return held.Abs()
+	case side == engine.SideSell && longOnly:
+		return decimal.Zero
+	}
+	return sizeOrder(ctx, risk, name, symbol, price, balance)
+}
+
+// lastSignal is the latest signal of a strategy, kept in its state
+type lastSignal struct {
+	Side  engine.Side `json:"side"`
+	Price float64     `json:"price"`
+	Time  time.Time   `json:"time"`
+}
@@ -0,0 +1,314 @@
+package strategy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/shopspring/decimal"
+)
+
+// Strategy types known to the registry
+const (
+	TypeEMA           = "ema"
+	TypeMeanReversion = "mean_reversion"
+	TypePairs         = "pairs"
+	TypeBreakout      = "breakout"
+)
+
+// Spec declares one strategy instance
+type Spec struct {
+	Type     string               `json:"type"`
+	Name     string               `json:"name,omitempty"` // defaults to the type's name, must be unique
+	Symbol   string               `json:"symbol"`
+	Capital  float64              `json:"capital"`             // USD allocated to the instance
+	Params   json.RawMessage      `json:"params,omitempty"`    // type specific, missing ones use defaults
+	Sizing   *engine.SizingConfig `json:"sizing,omitempty"`    // order sizing, risk.fixed_percent when unset
+	LongOnly *bool                `json:"long_only,omitempty"` // sell signals never open shorts, true unless set to false
+	Interval string               `json:"interval,omitempty"`  // candle size like "5m" or "1h", 1m when unset
+	// SignalOnly records signals instead of submitting orders, to evaluate
+	// the strategy live without risking capital
+	SignalOnly bool `json:"signal_only,omitempty"`
+}
+
+// Factory builds a strategy of one type from its spec. A signal-only spec
+// gets the engine's SignalExecutor as exec.
+type Factory func(spec Spec, exec engine.OrderExecutor, risk engine.RiskManager) (engine.Strategy, error)
+
+var (
+	registryMt sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+func init() {
+	Register(TypeEMA, newEMAFromSpec)
+	Register(TypeMeanReversion, newMeanReversionFromSpec)
+	Register(TypePairs, newPairsFromSpec)
+	Register(TypeBreakout, newBreakoutFromSpec)
+}
+
+// Register makes a strategy type available to New, replacing any factory of the same type
+func Register(typ string, f Factory) {
+	registryMt.Lock()
+	defer registryMt.Unlock()
+	registry[typ] = f
+}
+
+// Types lists the registered strategy types
+func Types() []string {
+	registryMt.RLock()
+	defer registryMt.RUnlock()
+	out := make([]string, 0, len(registry))
+	for t := range registry {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// New builds the strategy spec declares and allocates its capital
+func New(spec Spec, exec engine.OrderExecutor, risk engine.RiskManager) (engine.Strategy, error) {
+	registryMt.RLock()
+	f, ok := registry[spec.Type]
+	registryMt.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy type %q, known: %v", spec.Type, Types())
+	}
+	if spec.Symbol == "" {
+		return nil, fmt.Errorf("strategy %s: symbol is required", spec.Type)
+	}
+	if spec.Capital <= 0 {
+		return nil, fmt.Errorf("strategy %s %s: capital must be positive", spec.Type, spec.Symbol)
+	}
+	s, err := f(spec, exec, risk)
+	if err != nil {
+		return nil, fmt.Errorf("strategy %s %s: %w", spec.Type, spec.Symbol, err)
+	}
+	s.SetAccountUSD(decimal.NewFromFloat(spec.Capital))
+	if spec.Interval != "" {
+		d, err := engine.ParseInterval(spec.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("strategy %s %s: %w", spec.Type, spec.Symbol, err)
+		}
+		iv, ok := s.(interface{ SetInterval(int64) })
+		if !ok {
+			return nil, fmt.Errorf("strategy %s %s: interval is not supported", spec.Type, spec.Symbol)
+		}
+		iv.SetInterval(int64(d / time.Second))
+	}
+	if mtf, ok := s.(engine.MultiTimeframeStrategy); ok && len(mtf.Timeframes()) > 0 {
+		if _, err := engine.NewCandleAggregator(s.Interval(), mtf.Timeframes()); err != nil {
+			return nil, fmt.Errorf("strategy %s %s: %w", spec.Type, spec.Symbol, err)
+		}
+	}
+	if spec.LongOnly != nil {
+		lo, ok := s.(interface{ SetLongOnly(bool) })
+		if !ok {
+			return nil, fmt.Errorf("strategy %s %s: long_only is not supported", spec.Type, spec.Symbol)
+		}
+		lo.SetLongOnly(*spec.LongOnly)
+	}
+	if spec.SignalOnly {
+		so, ok := s.(interface{ SetSignalOnly(bool) })
+		if !ok {
+			return nil, fmt.Errorf("strategy %s %s: signal_only is not supported", spec.Type, spec.Symbol)
+		}
+		so.SetSignalOnly(true)
+	}
+	return s, nil
+}
+
+// Tunable is implemented by strategies whose params can be read and changed
+// while they trade
+type Tunable interface {
+	Params() json.RawMessage
+	// SetParams changes the params raw sets, the others keep their value.
+	// Invalid params change nothing.
+	SetParams(raw json.RawMessage) error
+}
+
+// TypeOf returns the registry type of s, or "" for strategies built elsewhere
+func TypeOf(s engine.Strategy) string {
+	if t, ok := s.(interface{ Type() string }); ok {
+		return t.Type()
+	}
+	return ""
+}
+
+// decodeParams fills params from raw, leaving fields raw does not set alone
+func decodeParams(raw json.RawMessage, params interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(params); err != nil {
+		return fmt.Errorf("params: %w", err)
+	}
+	return nil
+}
+
+// defaultTrendPeriod is the EMA period of the trend filter unless set
+const defaultTrendPeriod = 50
+
+type emaParams struct {
+	Short       int    `json:"short"`
+	Long        int    `json:"long"`
+	Trend       string `json:"trend,omitempty"` // timeframe like "1h" whose EMA filters buys
+	TrendPeriod int    `json:"trend_period"`
+}
+
+// validate checks p and returns its trend timeframe in seconds, 0 for none
+func (p emaParams) validate() (int64, error) {
+	if p.Short <= 0 || p.Short >= p.Long {
+		return 0, fmt.Errorf("needs 0 < short < long, got %d and %d", p.Short, p.Long)
+	}
+	if p.Trend == "" {
+		return 0, nil
+	}
+	d, err := engine.ParseInterval(p.Trend)
+	if err != nil {
+		return 0, fmt.Errorf("trend: %w", err)
+	}
+	if p.TrendPeriod <= 0 {
+		return 0, fmt.Errorf("trend_period must be positive, got %d", p.TrendPeriod)
+	}
+	return int64(d / time.Second), nil
+}
+
+func newEMAFromSpec(spec Spec, exec engine.OrderExecutor, risk engine.RiskManager) (engine.Strategy, error) {
+	p := emaParams{Short: 9, Long: 21, TrendPeriod: defaultTrendPeriod}
+	if err := decodeParams(spec.Params, &p); err != nil {
+		return nil, err
+	}
+	trendTF, err := p.validate()
+	if err != nil {
+		return nil, err
+	}
+	s := NewEMACrossover(spec.Symbol, p.Short, p.Long, exec, risk).(*EMACrossover)
+	if trendTF > 0 {
+		s.SetTrendFilter(trendTF, p.TrendPeriod)
+	}
+	if spec.Name != "" {
+		s.name = spec.Name
+	}
+	return s, nil
+}
+
+type meanReversionParams struct {
+	Window int     `json:"window"`
+	K      float64 `json:"k"`
+}
+
+func (p meanReversionParams) validate() error {
+	if p.Window < 2 {
+		return fmt.Errorf("window must be at least 2, got %d", p.Window)
+	}
+	if p.K <= 0 {
+		return fmt.Errorf("k must be positive, got %g", p.K)
+	}
+	return nil
+}
+
+func newMeanReversionFromSpec(spec Spec, exec engine.OrderExecutor, risk engine.RiskManager) (engine.Strategy, error) {
+	p := meanReversionParams{Window: 20, K: 2}
+	if err := decodeParams(spec.Params, &p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	s := NewMeanReversion(spec.Symbol, p.Window, p.K, exec, risk).(*MeanReversion)
+	if spec.Name != "" {
+		s.name = spec.Name
+	}
+	return s, nil
+}
+
+type pairsParams struct {
+	Pair   string  `json:"pair"` // the second symbol, hedging the spec's symbol
+	Window int     `json:"window"`
+	EntryZ float64 `json:"entry_z"`
+	ExitZ  float64 `json:"exit_z"`
+}
+
+func (p pairsParams) validate(symbol string) error {
+	if p.Pair == "" || p.Pair == symbol {
+		return fmt.Errorf("pair must be a symbol other than %s", symbol)
+	}
+	if p.Window < 3 {
+		return fmt.Errorf("window must be at least 3, got %d", p.Window)
+	}
+	if p.ExitZ < 0 || p.ExitZ >= p.EntryZ {
+		return fmt.Errorf("needs 0 <= exit_z < entry_z, got %g and %g", p.ExitZ, p.EntryZ)
+	}
+	return nil
+}
+
+func newPairsFromSpec(spec Spec, exec engine.OrderExecutor, risk engine.RiskManager) (engine.Strategy, error) {
+	p := pairsParams{Window: 60, EntryZ: 2, ExitZ: 0.5}
+	if err := decodeParams(spec.Params, &p); err != nil {
+		return nil, err
+	}
+	p.Pair = strings.ToUpper(p.Pair)
+	if err := p.validate(spec.Symbol); err != nil {
+		return nil, err
+	}
+	s := NewPairsTrade(spec.Symbol, p.Pair, p.Window, p.EntryZ, p.ExitZ, exec, risk).(*PairsTrade)
+	if spec.Name != "" {
+		s.name = spec.Name
+	}
+	return s, nil
+}
+
+type breakoutParams struct {
+	Window    int     `json:"window"`     // candles of the Donchian channel
+	ATRPeriod int     `json:"atr_period"` // candles of the average true range
+	ATRMult   float64 `json:"atr_mult"`   // average true ranges the stop trails by
+}
+
+func (p breakoutParams) validate() error {
+	if p.Window < 2 {
+		return fmt.Errorf("window must be at least 2, got %d", p.Window)
+	}
+	if p.ATRPeriod < 1 {
+		return fmt.Errorf("atr_period must be positive, got %d", p.ATRPeriod)
+	}
+	if p.ATRMult <= 0 {
+		return fmt.Errorf("atr_mult must be positive, got %g", p.ATRMult)
+	}
+	return nil
+}
+
+func newBreakoutFromSpec(spec Spec, exec engine.OrderExecutor, risk engine.RiskManager) (engine.Strategy, error) {
+	p := breakoutParams{Window: 20, ATRPeriod: 14, ATRMult: 3}
+	if err := decodeParams(spec.Params, &p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	s := NewBreakout(spec.Symbol, p.Window, p.ATRPeriod, p.ATRMult, exec, risk).(*Breakout)
+	if spec.Name != "" {
+		s.name = spec.Name
+	}
+	return s, nil
+}
+
+// intervalName writes an interval of seconds the way ParseInterval reads it
+func intervalName(seconds int64) string {
+	for _, u := range []struct {
+		suffix string
+		secs   int64
+	}{{"w", 604800}, {"d", 86400}, {"h", 3600}, {"m", 60}} {
+		if seconds%u.secs == 0 {
+			return fmt.Sprintf("%d%s", seconds/u.secs, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
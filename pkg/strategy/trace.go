@@ -0,0 +1,34 @@
+package strategy
+
+import (
+	"context"
+
+	"github.com/omept/trading-engine/pkg/engine"
+	"github.com/omept/trading-engine/pkg/telemetry"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSignal opens the root span of the order path for a strategy signal
+func startSignal(name, symbol string, side engine.Side, price float64) (context.Context, trace.Span) {
+	return telemetry.Tracer().Start(context.Background(), "strategy.signal",
+		trace.WithAttributes(
+			attribute.String("strategy", name),
+			attribute.String("symbol", symbol),
+			attribute.String("side", string(side)),
+			attribute.Float64("price", price),
+		))
+}
+
+// sizeOrder runs the risk manager inside its own span
+func sizeOrder(ctx context.Context, risk engine.RiskManager, strategy, symbol string, price, balance decimal.Decimal) decimal.Decimal {
+	_, span := telemetry.Tracer().Start(ctx, "risk.size")
+	defer span.End()
+	qty := risk.Size(strategy, symbol, price, balance)
+	span.SetAttributes(
+		attribute.String("account_balance", balance.String()),
+		attribute.String("quantity", qty.String()),
+	)
+	return qty
+}
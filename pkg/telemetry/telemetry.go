@@ -0,0 +1,93 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/omept/trading-engine"
+
+// Tracer returns the tracer used across the order path
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// TraceID returns the hex trace id carried by ctx, or "" when ctx has no valid span
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Init installs a global tracer provider so spans get real trace ids.
+// OTEL_TRACES_EXPORTER selects where spans go: "otlp", "stdout" or "none"
+// (default). The OTLP exporter sends to Jaeger, Tempo or a collector over
+// HTTP and reads the standard OTEL_EXPORTER_OTLP_* variables, the endpoint
+// defaulting to localhost:4318. OTEL_SERVICE_NAME names the service.
+// The returned func flushes and shuts the provider down.
+func Init() (func(context.Context) error, error) {
+	var opts []sdktrace.TracerProviderOption
+
+	switch exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter {
+	case "otlp":
+		exp, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+		log.Println("Tracing spans exported over OTLP")
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+		log.Println("Tracing spans exported to stdout")
+	case "", "none":
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q, known: otlp, stdout, none", exporter)
+	}
+	if os.Getenv("OTEL_SERVICE_NAME") == "" {
+		res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", "trading-engine")))
+		if err == nil {
+			opts = append(opts, sdktrace.WithResource(res))
+		}
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return tp.Shutdown, nil
+}
+
+// Handler continues the trace of callers that send a traceparent header and
+// wraps every request to h in a server span, so orders placed through the
+// API join the caller's trace
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+			))
+		defer span.End()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}